@@ -20,6 +20,7 @@ import (
 	"github.com/Wei-Shaw/sub2api/internal/handler"
 	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
 	"github.com/Wei-Shaw/sub2api/internal/server/middleware"
+	"github.com/Wei-Shaw/sub2api/internal/service"
 	"github.com/Wei-Shaw/sub2api/internal/setup"
 	"github.com/Wei-Shaw/sub2api/internal/web"
 
@@ -61,6 +62,7 @@ func main() {
 	// Parse command line flags
 	setupMode := flag.Bool("setup", false, "Run setup wizard in CLI mode")
 	showVersion := flag.Bool("version", false, "Show version information")
+	dumpStateOnPanic := flag.Bool("dump-state-on-panic", false, "Write a scheduler state snapshot to disk before crashing on panic")
 	flag.Parse()
 
 	if *showVersion {
@@ -93,7 +95,7 @@ func main() {
 	}
 
 	// Normal server mode
-	runMainServer()
+	runMainServer(*dumpStateOnPanic)
 }
 
 func runSetupServer() {
@@ -128,7 +130,7 @@ func runSetupServer() {
 	}
 }
 
-func runMainServer() {
+func runMainServer(dumpStateOnPanic bool) {
 	cfg, err := config.LoadForBootstrap()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
@@ -151,28 +153,111 @@ func runMainServer() {
 	}
 	defer app.Cleanup()
 
+	if dumpStateOnPanic {
+		// 主 goroutine 的 panic 在此兜底；后台 goroutine 经 service.GoWithPanicStateDump 启动，
+		// HTTP handler 的 panic 由 SchedulerStateDumpOnPanic 中间件处理。
+		defer app.OpenAIGateway.EnableOpenAISchedulerStateDumpOnPanic()()
+		defer func() {
+			if r := recover(); r != nil {
+				service.DumpOpenAISchedulerStateOnPanic()
+				panic(r)
+			}
+		}()
+	}
+	stopStateDumper := app.OpenAIGateway.StartOpenAISchedulerStateDumper()
+	defer stopStateDumper()
+	stopMetricsServer := app.OpenAIGateway.StartOpenAIWSMetricsServer()
+	defer stopMetricsServer()
+	restoreOpenAIWSSessionHandoff(app)
+
 	// 启动服务器
-	go func() {
+	service.GoWithPanicStateDump(func() {
 		if err := app.Server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("Failed to start server: %v", err)
 		}
-	}()
+	})
 
 	log.Printf("Server started on %s", app.Server.Addr)
 
+	// SIGHUP 触发 gateway.openai_ws 配置热加载，不中断已建立的连接
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	service.GoWithPanicStateDump(func() {
+		for range reload {
+			reloadOpenAIWSConfig(app)
+		}
+	})
+
 	// 等待中断信号
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
+	signal.Stop(reload)
 
 	log.Println("Shutting down server...")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := app.Server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+	shutdownErr := app.Server.Shutdown(ctx)
+	// 监听已关闭、不再接受新会话：写入会话交接文件，供新实例回灌
+	writeOpenAIWSSessionHandoff(app)
+	if shutdownErr != nil {
+		log.Fatalf("Server forced to shutdown: %v", shutdownErr)
 	}
 
 	log.Println("Server exited")
 }
+
+// restoreOpenAIWSSessionHandoff 读取上一实例停机时写入的会话交接文件并回灌；未配置路径时为空操作。
+func restoreOpenAIWSSessionHandoff(app *Application) {
+	path := app.OpenAIGateway.OpenAIWSSessionHandoffPath()
+	if path == "" {
+		return
+	}
+	restored, err := app.OpenAIGateway.RestoreOpenAIWSSessionHandoff(context.Background(), path)
+	if err != nil {
+		log.Printf("Session handoff restore skipped: %v", err)
+		return
+	}
+	if restored > 0 {
+		log.Printf("Session handoff restored %d sessions from %s", restored, path)
+	}
+}
+
+// writeOpenAIWSSessionHandoff 停机时写入会话交接文件；未配置路径时为空操作。
+func writeOpenAIWSSessionHandoff(app *Application) {
+	path := app.OpenAIGateway.OpenAIWSSessionHandoffPath()
+	if path == "" {
+		return
+	}
+	written, err := app.OpenAIGateway.WriteOpenAIWSSessionHandoff(path)
+	if err != nil {
+		log.Printf("Failed to write session handoff: %v", err)
+		return
+	}
+	log.Printf("Session handoff wrote %d sessions to %s", written, path)
+}
+
+// reloadOpenAIWSConfig 重新读取配置文件，将可热更新的 gateway.openai_ws 字段应用到运行中的服务。
+// 校验失败时保留原配置；不可热更新的变更仅记录日志，需重启后生效。
+func reloadOpenAIWSConfig(app *Application) {
+	next, err := config.LoadForBootstrap()
+	if err != nil {
+		log.Printf("Config reload failed: %v", err)
+		return
+	}
+	result, err := app.OpenAIGateway.ReloadOpenAIWSConfig(next)
+	if err != nil {
+		log.Printf("Config reload rejected: %v", err)
+		return
+	}
+	if len(result.Applied) > 0 {
+		log.Printf("Config reloaded: %s", strings.Join(result.Applied, ", "))
+	} else {
+		log.Println("Config reloaded: no hot-reloadable changes")
+	}
+	if len(result.RestartRequired) > 0 {
+		log.Printf("Config changes require restart to take effect: %s", strings.Join(result.RestartRequired, ", "))
+	}
+}
@@ -23,8 +23,9 @@ import (
 )
 
 type Application struct {
-	Server  *http.Server
-	Cleanup func()
+	Server        *http.Server
+	Cleanup       func()
+	OpenAIGateway *service.OpenAIGatewayService
 }
 
 func initializeApplication(buildInfo handler.BuildInfo) (*Application, error) {
@@ -51,7 +52,7 @@ func initializeApplication(buildInfo handler.BuildInfo) (*Application, error) {
 		provideCleanup,
 
 		// Application struct
-		wire.Struct(new(Application), "Server", "Cleanup"),
+		wire.Struct(new(Application), "Server", "Cleanup", "OpenAIGateway"),
 	)
 	return nil, nil
 }
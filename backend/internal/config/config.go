@@ -4,8 +4,11 @@ package config
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"math"
+	"net"
 	"net/url"
 	"os"
 	"strings"
@@ -289,6 +292,19 @@ type ProxyProbeConfig struct {
 
 type BillingConfig struct {
 	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+	// TokenMultipliers: 按模型配置各 token 类型的计费倍率，model 为 "*" 的规则作为默认。
+	// 仅影响费用计算，使用记录中的原始 token 数量保持不变。
+	TokenMultipliers []BillingTokenMultiplierConfig `mapstructure:"token_multipliers"`
+}
+
+// BillingTokenMultiplierConfig 单个模型的 token 类型计费倍率；未配置的类型按 1 计算。
+// 使用列表而非 map，避免模型名中的 "." 被 viper 解析为嵌套键。
+type BillingTokenMultiplierConfig struct {
+	Model         string   `mapstructure:"model"`
+	Input         *float64 `mapstructure:"input"`
+	Output        *float64 `mapstructure:"output"`
+	CacheCreation *float64 `mapstructure:"cache_creation"`
+	CacheRead     *float64 `mapstructure:"cache_read"`
 }
 
 type CircuitBreakerConfig struct {
@@ -518,6 +534,80 @@ type GatewayOpenAIWSConfig struct {
 	ModeRouterV2Enabled bool `mapstructure:"mode_router_v2_enabled"`
 	// IngressModeDefault: ingress 默认模式（off/ctx_pool/passthrough）
 	IngressModeDefault string `mapstructure:"ingress_mode_default"`
+	// IngressModeGroupDefaults: 按分组覆盖 ingress 默认模式，账号未显式配置 mode 时优先使用请求所属分组的值，
+	// 未配置的分组回退到 IngressModeDefault（仅 ModeRouterV2Enabled 时生效）
+	IngressModeGroupDefaults []GatewayOpenAIWSIngressModeGroupDefault `mapstructure:"ingress_mode_group_defaults"`
+	// ModelTransports: 按模型限制可用的上游传输协议（匹配请求模型或账号映射后的模型，大小写不敏感）；
+	// 规则间按精确匹配优先、其次最长前缀（以 * 结尾）匹配；未命中任何规则的模型不受限制
+	ModelTransports []GatewayOpenAIWSModelTransport `mapstructure:"model_transports"`
+	// ModelTransportPolicy: 仅 HTTP 模型在非 HTTP 入站请求上的处理策略（downgrade/reject，默认 downgrade）
+	// - downgrade: 改走 HTTP 上游
+	// - reject: 直接拒绝请求
+	// WS ingress 会话没有 HTTP 上游中继，两种策略下均以策略违规关闭连接
+	ModelTransportPolicy string `mapstructure:"model_transport_policy"`
+	// ForceDedicatedAll: 调试开关，强制所有会话使用独占连接、完全禁用连接复用（默认 false）。
+	// 覆盖账号级 mode（off 除外）：HTTP WS 请求与 ingress 会话均每轮新建连接，轮次结束后关闭。
+	ForceDedicatedAll bool `mapstructure:"force_dedicated_all"`
+	// MalformedUpstreamEventPolicy: 上游下发非法 JSON 帧时的处理策略（drop/terminate，默认 drop）
+	// - drop: 记录日志与指标后丢弃该帧，继续转发后续事件
+	// - terminate: 记录日志与指标后终止当前 turn，并废弃该上游连接
+	// 注意：合法 JSON 但事件结构未知（如缺少 type）的帧始终原样透传，不受该策略影响。
+	MalformedUpstreamEventPolicy string `mapstructure:"malformed_upstream_event_policy"`
+	// UsageMissingPolicy: 上游终止响应完全缺失 usage 时的计费策略（unbilled/zero/estimate，默认 unbilled）
+	// - unbilled: 标记该 turn 未计费，不写入用量记录（与历史行为一致）
+	// - zero: 写入一条 token 全为 0 的用量记录，便于在用量日志中追溯
+	// - estimate: 按请求输入与响应输出文本估算 token 数后计费
+	UsageMissingPolicy string `mapstructure:"usage_missing_policy"`
+	// ClientCloseErrorEventEnabled: 主动关闭客户端 WS 前，是否先下发一条结构化 error 事件
+	// （含 code/retryable/retry_after，默认 false）。close code 与 reason 保持不变。
+	ClientCloseErrorEventEnabled bool `mapstructure:"client_close_error_event_enabled"`
+	// IngressCapabilitiesEventEnabled: ingress 握手完成后、读取首条客户端消息前，是否向所有客户端下发 gateway.capabilities 事件
+	// （默认 false）。关闭时仍会对握手协商了 sub2api.capabilities.v1 子协议的客户端下发。
+	IngressCapabilitiesEventEnabled bool `mapstructure:"ingress_capabilities_event_enabled"`
+	// IngressRequiredHeader: WS ingress 升级请求必须携带的请求头（如独立于 api_key 的内部鉴权令牌），
+	// 在 Accept 之前校验，缺失时以 401 拒绝升级；默认空（不校验）
+	IngressRequiredHeader string `mapstructure:"ingress_required_header"`
+	// IngressRequiredHeaderValue: IngressRequiredHeader 的期望值，非空时值不一致以 403 拒绝；空表示仅要求存在
+	IngressRequiredHeaderValue string `mapstructure:"ingress_required_header_value"`
+	// IngressSessionCreatePerMinute: 每个 API Key 每分钟允许新建的 ingress 会话数（令牌桶补充速率），
+	// 防止客户端快速开关会话绕过并发上限、冲击建连与状态存储；超限的升级以可重试关闭（1013）拒绝。默认 0（不限制）
+	IngressSessionCreatePerMinute int `mapstructure:"ingress_session_create_per_minute"`
+	// IngressSessionCreateBurst: 新建会话令牌桶容量（允许的瞬时突发数），0 表示与 IngressSessionCreatePerMinute 相同
+	IngressSessionCreateBurst int `mapstructure:"ingress_session_create_burst"`
+	// FirstMessageTimeoutSeconds: ingress 握手完成后等待客户端首条消息的超时（秒），超时以 1008（first_message_timeout）
+	// 关闭并附带说明；与上游单事件读超时 read_timeout_seconds 相互独立。默认 30
+	FirstMessageTimeoutSeconds int `mapstructure:"first_message_timeout_seconds"`
+	// IngressCompressionThresholdBytes: 客户端协商了 permessage-deflate 时，下发消息达到该字节数才压缩；
+	// 大事件（如整段推理输出、response.completed）压缩以节省带宽，细碎 delta 直接透传避免压缩开销。默认 512
+	IngressCompressionThresholdBytes int `mapstructure:"ingress_compression_threshold_bytes"`
+	// ForwardClientHeaders: 建连时从客户端请求复制到上游 WS 握手的请求头白名单（key=客户端头，value=上游头，空表示同名）。
+	// 未列入白名单的客户端头一律不转发；鉴权、Cookie 与握手相关头不允许作为目标。默认空（不转发任何头）。
+	// 注意：仅在新建上游连接时生效，复用的池化连接沿用建连时的请求头。
+	ForwardClientHeaders map[string]string `mapstructure:"forward_client_headers"`
+	// AccountRequestRewrites: 按账号对发往上游的 response.create 请求体执行 set/remove 改写（如强制 service_tier）。
+	// 路径为以 . 分隔的字段名（仅字母、数字、_、-），改写在模型映射之后、发送之前执行且幂等，全量重放时结果一致；
+	// type/model/input/previous_response_id/prompt_cache_key/stream 不允许改写。默认空
+	AccountRequestRewrites []GatewayOpenAIWSAccountRequestRewrite `mapstructure:"account_request_rewrites"`
+	// ModelDefaultParams: 按模型为发往上游的 response.create 补充默认参数（如 reasoning.effort: medium），客户端已携带的字段不覆盖。
+	// 按账号映射后的上游模型名匹配（大小写不敏感，精确匹配优先，其次最长前缀 *）；在 account_request_rewrites 之前写入，
+	// 路径规则与受保护字段同 account_request_rewrites，全量重放时结果一致。默认空
+	ModelDefaultParams []GatewayOpenAIWSModelDefaultParams `mapstructure:"model_default_params"`
+	// ShadowAccountID: 影子转发目标账号（OpenAI 平台），用于在不影响客户端的前提下试跑新账号/端点；0 表示关闭（默认）
+	ShadowAccountID int64 `mapstructure:"shadow_account_id"`
+	// ShadowSampleRatio: ingress 会话中成功完成的 turn 按该比例（0~1）额外复制一份发往影子账号。
+	// 影子请求使用独立建连、不占用主账号并发槽位与连接池，响应丢弃不下发客户端，仅记录延迟与错误用于对比。默认 0
+	ShadowSampleRatio float64 `mapstructure:"shadow_sample_ratio"`
+	// CanaryAccountIDs: 金丝雀账号 ID 列表（OpenAI 平台），用于在生产流量中小比例验证新账号/端点；与影子转发不同，金丝雀响应会正常下发客户端。
+	// 金丝雀账号只承接按 CanaryTrafficRatio 分流的新选号请求，不参与常规负载均衡。默认空
+	CanaryAccountIDs []int64 `mapstructure:"canary_account_ids"`
+	// CanaryTrafficRatio: 负载均衡选号前按该比例（0~1）优先尝试金丝雀账号；0 表示关闭（默认）
+	CanaryTrafficRatio float64 `mapstructure:"canary_traffic_ratio"`
+	// CanaryErrorRateThreshold: 金丝雀账号在统计窗口内错误率超过该值（0-1，不含 0）时自动移出金丝雀池（回滚），默认 0.2
+	CanaryErrorRateThreshold float64 `mapstructure:"canary_error_rate_threshold"`
+	// CanaryWindowSeconds: 金丝雀错误率统计窗口（秒），窗口结束后重新计数，默认 300
+	CanaryWindowSeconds int `mapstructure:"canary_window_seconds"`
+	// CanaryMinRequests: 窗口内至少积累该数量的结果才判断是否回滚，避免少量样本误判，默认 20
+	CanaryMinRequests int `mapstructure:"canary_min_requests"`
 	// Enabled: 全局总开关（默认 true）
 	Enabled bool `mapstructure:"enabled"`
 	// OAuthEnabled: 是否允许 OpenAI OAuth 账号使用 WS
@@ -530,6 +620,86 @@ type GatewayOpenAIWSConfig struct {
 	AllowStoreRecovery bool `mapstructure:"allow_store_recovery"`
 	// IngressPreviousResponseRecoveryEnabled: ingress 模式收到 previous_response_not_found 时，是否允许自动去掉 previous_response_id 重试一次（默认 true）
 	IngressPreviousResponseRecoveryEnabled bool `mapstructure:"ingress_previous_response_recovery_enabled"`
+	// IngressClientPingEnabled: ingress 模式是否处理客户端 {"type":"ping"} 控制消息（在 turn 之间对已绑定的上游连接做预检 ping 并回复 pong，不获取新连接，默认 false）
+	IngressClientPingEnabled bool `mapstructure:"ingress_client_ping_enabled"`
+	// MaxFullCreateReplaysPerSession: 单个 ingress 会话内由恢复逻辑触发的全量 create 重放上限；
+	// 超出后不再自动重放，直接把上游错误返回客户端；0 表示不限制
+	MaxFullCreateReplaysPerSession int `mapstructure:"max_full_create_replays_per_session"`
+	// MaxReplayInputBytes: ingress 会话为全量 create 重放在内存中保留的累计 input 字节上限；
+	// 超出后当前 turn 以 1009 关闭并提示客户端开启新会话，避免超大会话反复复制占满内存；0 表示不限制
+	MaxReplayInputBytes int `mapstructure:"max_replay_input_bytes"`
+	// ReplayInputDedupeConsecutive: 将增量 input 追加进全量重放缓冲时，是否丢弃与紧邻前一项完全相同（规范化 JSON 后）的条目，
+	// 用于吸收客户端重发同一条消息；客户端发送的全量 input（以缓冲为前缀）始终原样采用。默认 false
+	ReplayInputDedupeConsecutive bool `mapstructure:"replay_input_dedupe_consecutive"`
+	// ReplayInputFunctionCallOutputMerge: 增量中的 function_call_output 如何并入全量重放缓冲：
+	// append（默认）按到达顺序追加；replace 在缓冲中已有同 call_id 的 function_call_output 时原位替换，保持其在 function_call 之后的位置
+	ReplayInputFunctionCallOutputMerge string `mapstructure:"replay_input_function_call_output_merge"`
+	// MaxConcurrentRecoveryReconnects: 全服务范围内同时进行的恢复重连（预检 ping 失败、previous_response_not_found 等）上限；
+	// 超出的会话短暂排队等待空位，用于平滑上游抖动引发的重连风暴；0 表示不限制
+	MaxConcurrentRecoveryReconnects int `mapstructure:"max_concurrent_recovery_reconnects"`
+	// IngressStaleFunctionCallOutputPolicy: ingress 续链 turn 中 function_call_output 的 call_id 不属于上一轮输出的工具调用时的处理策略
+	// - off: 不校验，原样转发（默认）
+	// - drop: 丢弃不匹配的 function_call_output 后再发送
+	// - full_create: 去掉 previous_response_id 降级为全量 create（受 MaxFullCreateReplaysPerSession 约束，超限时按 drop 处理）
+	IngressStaleFunctionCallOutputPolicy string `mapstructure:"ingress_stale_function_call_output_policy"`
+	// IngressStoreDisabledFullInputPolicy: store=false 的续链 turn 同时携带 previous_response_id 与完整历史 input
+	// （input 以会话上一轮的全量 input 为前缀）时的解释策略
+	// - auto: 沿用严格续链判定（默认）
+	// - incremental: 信任 previous_response_id，去掉 input 中已在链上的前缀后增量发送
+	// - full_create: 信任完整 input，去掉 previous_response_id 按全量 create 发送
+	// incremental/full_create 下，previous_response_id 与上一轮响应 ID 不一致或 input 无新增项时视为矛盾，按 full_create 处理
+	IngressStoreDisabledFullInputPolicy string `mapstructure:"ingress_store_disabled_full_input_policy"`
+	// IngressMidTurnReconnectMode: ingress turn 已向客户端下发部分事件后上游读取失败时的处理方式
+	// - off: 不重连，直接结束 turn（默认）
+	// - resume: 重连后重放当前 turn，只下发 sequence_number（缺失时按事件序号）超过已下发进度的事件；
+	//   适用于上游对同一请求输出确定的场景，重放的 response.id 与已下发的可能不同
+	// - reset: 重连后先向客户端发送 gateway.turn_reset 事件，再完整下发重放的 turn，客户端需丢弃此前的部分输出
+	// 与未下发时的 turn 重试共用单次重试额度；store=false 续链 turn 不重试
+	IngressMidTurnReconnectMode string `mapstructure:"ingress_mid_turn_reconnect_mode"`
+	// ReselectAccountOnContinuityBreak: ingress 续链断裂（previous_response_not_found）降级为全量 create 时，
+	// 是否释放当前账号并通过调度器重新选择负载更低的账号执行重放（默认 false，保持在原账号）
+	ReselectAccountOnContinuityBreak bool `mapstructure:"reselect_account_on_continuity_break"`
+	// ModelChangeForcesReselect: ingress 会话中后续 turn 切换模型时是否强制重新选择账号。
+	// 默认 false：当前账号支持新模型时保持粘连（复用上游缓存），仅在不支持时重新调度
+	ModelChangeForcesReselect bool `mapstructure:"model_change_forces_reselect"`
+	// IngressStreamConsistencyPolicy: ingress 会话首个 turn 确定 stream 模式后，后续 turn 翻转 stream 时的处理策略
+	// - off: 不校验，允许混用（默认）
+	// - reject: 以 policy violation 关闭客户端连接
+	// - coerce: 将该 turn 的 stream 改写为会话首个 turn 的取值后继续转发
+	IngressStreamConsistencyPolicy string `mapstructure:"ingress_stream_consistency_policy"`
+	// IngressDuplicateKeyPolicy: ingress 客户端消息顶层出现重复键（如两个 model）时的处理策略。
+	// 网关按首个值解析，而上游 JSON 解析器通常取最后一个值，可能导致路由与实际请求不一致。
+	// - off: 不检测，原样转发（默认）
+	// - reject: 以 policy violation 关闭客户端连接，并在原因中列出重复的键
+	// - last_wins: 每个重复键仅保留最后一个值（位于首次出现的位置）后继续处理与转发
+	IngressDuplicateKeyPolicy string `mapstructure:"ingress_duplicate_key_policy"`
+	// IngressRequireSessionID: 为 true 时会话首个 turn 必须携带显式会话标识
+	// （session_id / conversation_id 请求头或 prompt_cache_key），否则以 policy violation 拒绝，
+	// 不再回退到按用户/API Key 生成的兜底会话哈希；默认 false
+	IngressRequireSessionID bool `mapstructure:"ingress_require_session_id"`
+	// IngressStreamHeartbeatIntervalMS: ingress 模式 stream=true 的 turn 在上游静默（如长推理）期间，
+	// 按该间隔向客户端下发合成 {"type":"ping"} 心跳以保活客户端空闲计时；首个真实事件下发后本 turn 不再发送；0 表示关闭
+	IngressStreamHeartbeatIntervalMS int `mapstructure:"ingress_stream_heartbeat_interval_ms"`
+	// IngressDownstreamBufferSize: ingress 模式每个 turn 下发给客户端的事件缓冲条数（>0 启用）。
+	// 启用后上游读取与客户端写入解耦，慢客户端不会阻塞上游读取导致上游读超时；0 表示关闭（同步写入）
+	IngressDownstreamBufferSize int `mapstructure:"ingress_downstream_buffer_size"`
+	// IngressSlowClientPolicy: 下发缓冲写满（客户端消费过慢）时的处理策略，仅在 ingress_downstream_buffer_size > 0 时生效。
+	// - disconnect: 立即关闭客户端连接，上游继续读完当前 turn（默认）
+	// - drop_deltas: 丢弃 *.delta 增量事件，其余事件等待缓冲空位后下发；等待超过 write_timeout_seconds 时按 disconnect 处理
+	IngressSlowClientPolicy string `mapstructure:"ingress_slow_client_policy"`
+	// ClientDisconnectDrainMaxConcurrency: 客户端断连后继续读取上游直到 turn 结束（保证计费）的最大并发 turn 数；
+	// 超出时直接中止上游、按已观测到的部分 usage 处理。0 表示不限制
+	ClientDisconnectDrainMaxConcurrency int `mapstructure:"client_disconnect_drain_max_concurrency"`
+	// InjectGatewayTurnID: 为 true 时在下发给客户端的 response 生命周期事件与 error 事件顶层注入 gateway_turn_id，
+	// 值为网关侧稳定的 turn 标识（<请求 ID>-<turn 序号>），便于客户端把网关日志与上游 response.id 关联。
+	// 上游 response.id 始终原样透传，不受该开关影响
+	InjectGatewayTurnID bool `mapstructure:"inject_gateway_turn_id"`
+	// IngressSessionCaptureDir: 非空时将每个 ingress 会话的客户端消息与上游事件（凭证已脱敏）录制为 JSON 文件写入该目录，
+	// 用于复现线上问题与构造回放测试夹具；默认空表示关闭
+	IngressSessionCaptureDir string `mapstructure:"ingress_session_capture_dir"`
+	// IngressSessionCaptureRecentMax: 内存中保留最近 N 条会话录制（环形缓冲，满时丢弃最旧并计数），
+	// 供管理端查看近期录制；大于 0 时即使未配置 IngressSessionCaptureDir 也会录制；0 表示关闭（默认）
+	IngressSessionCaptureRecentMax int `mapstructure:"ingress_session_capture_recent_max"`
 	// StoreDisabledConnMode: store=false 且无可复用会话连接时的建连策略（strict/adaptive/off）
 	// - strict: 强制新建连接（隔离优先）
 	// - adaptive: 仅在高风险失败后强制新建连接（性能与隔离折中）
@@ -549,6 +719,14 @@ type GatewayOpenAIWSConfig struct {
 	MaxConnsPerAccount int `mapstructure:"max_conns_per_account"`
 	MinIdlePerAccount  int `mapstructure:"min_idle_per_account"`
 	MaxIdlePerAccount  int `mapstructure:"max_idle_per_account"`
+	// ConnIdleTimeoutSeconds: 池内连接空闲超过该时长即关闭移除，不再留给下次预检 ping（大概率失败）；
+	// 移除后低于 MinIdlePerAccount 时会重新预热补足。0 表示关闭（默认），仅受 60 分钟最大存活时间约束。
+	// 账号可通过 extra.openai_ws_max_idle_per_account / openai_ws_conn_idle_timeout_seconds /
+	// openai_ws_conn_max_lifetime_seconds 单独覆盖空闲连接数、空闲回收与最大存活时长
+	ConnIdleTimeoutSeconds int `mapstructure:"conn_idle_timeout_seconds"`
+	// LeaseLeakThresholdSeconds: 连接租约持有超过该时长即判定为疑似泄漏，由后台巡检记录告警日志并计数（每个租约只报告一次），
+	// 不会强制回收。ingress 会话在整个会话期间持有租约，应按最长会话时长设置。0 表示关闭（默认）
+	LeaseLeakThresholdSeconds int `mapstructure:"lease_leak_threshold_seconds"`
 	// DynamicMaxConnsByAccountConcurrencyEnabled: 是否按账号并发动态计算连接池上限
 	DynamicMaxConnsByAccountConcurrencyEnabled bool `mapstructure:"dynamic_max_conns_by_account_concurrency_enabled"`
 	// OAuthMaxConnsFactor: OAuth 账号连接池系数（effective=ceil(concurrency*factor)）
@@ -560,6 +738,13 @@ type GatewayOpenAIWSConfig struct {
 	WriteTimeoutSeconds   int     `mapstructure:"write_timeout_seconds"`
 	PoolTargetUtilization float64 `mapstructure:"pool_target_utilization"`
 	QueueLimitPerConn     int     `mapstructure:"queue_limit_per_conn"`
+
+	// RequestTimeoutOverrideMinSeconds/RequestTimeoutOverrideMaxSeconds: 请求覆盖建连/读超时时允许的上下限（秒），
+	// 客户端通过 X-Upstream-Dial-Timeout-Seconds/X-Upstream-Read-Timeout-Seconds 请求头指定覆盖值，
+	// 超出区间时被钳制；未覆盖的请求仍使用 dial_timeout_seconds/read_timeout_seconds
+	RequestTimeoutOverrideMinSeconds int `mapstructure:"request_timeout_override_min_seconds"`
+	RequestTimeoutOverrideMaxSeconds int `mapstructure:"request_timeout_override_max_seconds"`
+
 	// EventFlushBatchSize: WS 流式写出批量 flush 阈值（事件条数）
 	EventFlushBatchSize int `mapstructure:"event_flush_batch_size"`
 	// EventFlushIntervalMS: WS 流式写出最大等待时间（毫秒）；0 表示仅按 batch 触发
@@ -583,6 +768,28 @@ type GatewayOpenAIWSConfig struct {
 	LBTopK int `mapstructure:"lb_top_k"`
 	// StickySessionTTLSeconds: session_hash -> account_id 粘连 TTL
 	StickySessionTTLSeconds int `mapstructure:"sticky_session_ttl_seconds"`
+	// StickySessionsPerAccountMax: 单账号在本进程内同时绑定的会话粘连数上限，达到后新的粘连绑定不再写入，
+	// 该会话后续请求改走负载均衡，避免单个账号吸走大量粘连会话。0 表示不限制（默认）
+	StickySessionsPerAccountMax int `mapstructure:"sticky_sessions_per_account_max"`
+	// StickyTTLSkewSampleRate: 会话粘连绑定的寿命采样率（0-1），采样绑定在后续查询时比对实际过期时间与配置 TTL，
+	// 用于发现 TTL 配置错误或网关与缓存之间的时钟偏差；0 表示关闭
+	StickyTTLSkewSampleRate float64 `mapstructure:"sticky_ttl_skew_sample_rate"`
+	// StickyTTLSkewAlertRatio: 单次观测的偏差占配置 TTL 的比例超过该值时记录告警日志（每分钟最多一条）；0 表示不告警（默认）
+	StickyTTLSkewAlertRatio float64 `mapstructure:"sticky_ttl_skew_alert_ratio"`
+	// APIKeyStickyWindowSeconds: 无会话粘连（无 session_hash / previous_response_id）时，
+	// 同一 API Key 在窗口期内的连续请求优先复用上次选中的账号；0 表示关闭
+	APIKeyStickyWindowSeconds int `mapstructure:"api_key_sticky_window_seconds"`
+	// PromptCacheKeyFingerprintEnabled: 仅凭 prompt_cache_key 派生会话哈希时，额外混入首条 input 消息指纹，
+	// 避免不相关会话偶然共用同一 prompt_cache_key 时串用粘连账号/连接上下文（默认 false；开启会改变缓存命中行为）
+	PromptCacheKeyFingerprintEnabled bool `mapstructure:"prompt_cache_key_fingerprint_enabled"`
+	// SchedulerMaxConsecutiveStickyTurns: 同一会话连续命中会话粘连的轮数上限，达到后下一轮重新走负载均衡
+	// （仍可能选回原账号；仅实际切换时才放弃连接上下文改为全量 create）。0 表示不限制（默认）。
+	// 账号可通过 extra.openai_max_consecutive_sticky_turns 单独覆盖。
+	SchedulerMaxConsecutiveStickyTurns int `mapstructure:"scheduler_max_consecutive_sticky_turns"`
+	// SchedulerMaxStickyLifetimeSeconds: 同一会话粘连到同一账号的最长持续秒数，超过后下一轮重新走负载均衡
+	// （选回原账号时保留连接上下文并重新计时）。0 表示不限制（默认）。
+	// 账号可通过 extra.openai_max_sticky_lifetime_seconds 单独覆盖。计时记录随会话粘连 TTL 过期并周期清理。
+	SchedulerMaxStickyLifetimeSeconds int `mapstructure:"scheduler_max_sticky_lifetime_seconds"`
 	// SessionHashReadOldFallback: 会话哈希迁移期是否允许“新 key 未命中时回退读旧 SHA-256 key”
 	SessionHashReadOldFallback bool `mapstructure:"session_hash_read_old_fallback"`
 	// SessionHashDualWriteOld: 会话哈希迁移期是否双写旧 SHA-256 key（短 TTL）
@@ -593,8 +800,150 @@ type GatewayOpenAIWSConfig struct {
 	StickyResponseIDTTLSeconds int `mapstructure:"sticky_response_id_ttl_seconds"`
 	// StickyPreviousResponseTTLSeconds: 兼容旧键（当新键未设置时回退）
 	StickyPreviousResponseTTLSeconds int `mapstructure:"sticky_previous_response_ttl_seconds"`
+	// SessionResponseMaxAgeSeconds: 会话续链（previous_response_id 链与会话 response 锚点）的绝对最长存活时间，
+	// 从链上首个 response 起算、不因续期刷新；超过后锚点强制失效，ingress 下一 turn 去掉 previous_response_id 改为全量 create，
+	// 避免追逐上游已回收的 response。0 表示不限制（默认）
+	SessionResponseMaxAgeSeconds int `mapstructure:"session_response_max_age_seconds"`
+	// StateStoreFailureMode: 粘连状态存储后端（Redis）读写失败时的处理方式（open/closed，默认 open）
+	// - open: 降级为进程内状态（视为无粘连）继续服务，记录日志与降级计数
+	// - closed: 需要查询粘连的请求以可重试错误拒绝（HTTP 503 / WS 1013）
+	StateStoreFailureMode string `mapstructure:"state_store_failure_mode"`
 
 	SchedulerScoreWeights GatewayOpenAIWSSchedulerScoreWeights `mapstructure:"scheduler_score_weights"`
+
+	// SchedulerCircuitBreakerEnabled: 是否启用账号级调度熔断（连续失败后暂停调度，冷却后半开探测；默认 false）
+	SchedulerCircuitBreakerEnabled bool `mapstructure:"scheduler_circuit_breaker_enabled"`
+	// SchedulerCircuitBreakerFailThreshold: 连续失败多少次后熔断
+	SchedulerCircuitBreakerFailThreshold int `mapstructure:"scheduler_circuit_breaker_fail_threshold"`
+	// SchedulerCircuitBreakerCooldownSeconds: 熔断后冷却时长（秒），到期进入半开状态
+	SchedulerCircuitBreakerCooldownSeconds int `mapstructure:"scheduler_circuit_breaker_cooldown_seconds"`
+	// SchedulerCircuitBreakerHalfOpenMax: 半开状态下允许的并发探测请求数
+	SchedulerCircuitBreakerHalfOpenMax int `mapstructure:"scheduler_circuit_breaker_half_open_max"`
+	// SchedulerCircuitBreakerWarmupSeconds: 账号创建（created_at）后的 N 秒作为预热期，
+	// 期间的失败不计入连续失败次数，避免新账号因接入初期的瞬时错误直接熔断；按账号创建时间判断，不随进程重启重新计算；0 表示关闭（默认）
+	SchedulerCircuitBreakerWarmupSeconds int `mapstructure:"scheduler_circuit_breaker_warmup_seconds"`
+	// SchedulerCircuitBreakerAutoDisableTrips: 账号全局熔断器在 SchedulerCircuitBreakerAutoDisableWindowSeconds 内
+	// 累计熔断达到该次数时，判定为持续故障（如 key 已吊销）并将账号置为 error 状态停止调度，需管理员手动清除错误后恢复；
+	// 0 表示关闭（默认）
+	SchedulerCircuitBreakerAutoDisableTrips int `mapstructure:"scheduler_circuit_breaker_auto_disable_trips"`
+	// SchedulerCircuitBreakerAutoDisableWindowSeconds: 统计熔断次数的滑动窗口（秒）
+	SchedulerCircuitBreakerAutoDisableWindowSeconds int `mapstructure:"scheduler_circuit_breaker_auto_disable_window_seconds"`
+	// SchedulerCircuitBreakerGroupOverrides: 按分组覆盖熔断阈值/冷却/半开探测数，调度限定在该分组时生效；
+	// 覆盖分组使用独立的熔断状态，未覆盖的字段沿用全局值
+	SchedulerCircuitBreakerGroupOverrides []GatewayOpenAIWSCircuitBreakerGroupOverride `mapstructure:"scheduler_circuit_breaker_group_overrides"`
+	// SchedulerHalfOpenProbeStrategy: 单次调度中有多个半开账号可被探测时的处理策略：
+	// all（默认，全部参与打分）/closest_recovery（仅保留最接近恢复的账号）/best_score（仅保留历史表现最好的账号）；
+	// 探测名额只由最终选中的账号占用
+	SchedulerHalfOpenProbeStrategy string `mapstructure:"scheduler_half_open_probe_strategy"`
+
+	// SchedulerZeroConcurrencyMode: 未配置并发（concurrency=0）账号的调度方式（unbounded/assumed）
+	// - unbounded: 视为不限并发，不占用槽位，负载率始终为 0（默认，兼容旧行为）
+	// - assumed: 按 SchedulerAssumedConcurrency 占用槽位并参与负载打分，同时以该值作为并发上限
+	SchedulerZeroConcurrencyMode string `mapstructure:"scheduler_zero_concurrency_mode"`
+	// SchedulerAssumedConcurrency: assumed 模式下为未配置并发的账号假定的并发数
+	SchedulerAssumedConcurrency int `mapstructure:"scheduler_assumed_concurrency"`
+
+	// SchedulerCandidatePrefilterThreshold: 负载均衡候选数超过该阈值时先预筛再打分（0 表示关闭，始终全量打分）
+	SchedulerCandidatePrefilterThreshold int `mapstructure:"scheduler_candidate_prefilter_threshold"`
+	// SchedulerCandidatePrefilterSize: 预筛保留的候选数上限；按优先级从高到低分层保留，溢出的层内随机抽样
+	SchedulerCandidatePrefilterSize int `mapstructure:"scheduler_candidate_prefilter_size"`
+	// SchedulerRuntimeStatsReplicaIntervalMS: 运行时统计只读副本的刷新间隔（毫秒）。>0 时看板/导出读取的是
+	// 每个间隔最多重建一次的副本，高频抓取不会在上报热路径上反复争用锁；0 表示关闭（默认，每次读取实时构建）
+	SchedulerRuntimeStatsReplicaIntervalMS int `mapstructure:"scheduler_runtime_stats_replica_interval_ms"`
+	// SchedulerMinScoreThreshold: 负载均衡打分低于该值的候选被排除；全部低于阈值时仅保留得分最高者，保证总有候选。
+	// 分值尺度与 scheduler_score_weights 一致（各因子取值 0-1 后按权重求和）；0 表示关闭（默认）
+	SchedulerMinScoreThreshold float64 `mapstructure:"scheduler_min_score_threshold"`
+	// SchedulerErrorRateEWMAAlpha: 账号错误率 EWMA 的平滑系数（0-1，不含端点，默认 0.2）；越大对近期结果越敏感，故障与恢复都反应更快
+	SchedulerErrorRateEWMAAlpha float64 `mapstructure:"scheduler_error_rate_ewma_alpha"`
+	// SchedulerTTFTEWMAAlpha: 账号级与按模型 TTFT EWMA 的平滑系数（0-1，不含端点，默认 0.2）
+	SchedulerTTFTEWMAAlpha float64 `mapstructure:"scheduler_ttft_ewma_alpha"`
+
+	// SchedulerTransportFallbackGroupIDs: 要求 WS v2 传输但分组内没有可用 WS 账号时，允许降级为任意传输（HTTP）重新选号的分组 ID 列表；
+	// 降级会记录在调度决策中。默认空（严格失败）
+	SchedulerTransportFallbackGroupIDs []int64 `mapstructure:"scheduler_transport_fallback_group_ids"`
+
+	// SchedulerRegionAffinityEnabled: 是否按客户端地域偏向选择同地域账号（accounts.extra.openai_regions 标记）；默认 false。
+	// 地域优先取 SchedulerRegionHeader 请求头，缺失时交由注入的 ClientRegionResolver（如 IP 地理库）解析
+	SchedulerRegionAffinityEnabled bool `mapstructure:"scheduler_region_affinity_enabled"`
+	// SchedulerRegionHeader: 携带客户端地域提示的请求头名称，空表示不读取请求头
+	SchedulerRegionHeader string `mapstructure:"scheduler_region_header"`
+
+	// SchedulerDecisionEventBufferSize: 调度决策事件异步投递缓冲区大小，缓冲满时丢弃并计数（仅注册 sink 后生效）
+	SchedulerDecisionEventBufferSize int `mapstructure:"scheduler_decision_event_buffer_size"`
+	// SchedulerDecisionEventSampleRate: 调度决策事件采样率（0-1）
+	SchedulerDecisionEventSampleRate float64 `mapstructure:"scheduler_decision_event_sample_rate"`
+
+	// SchedulerStateDumpPath: 调度状态（运行时统计 EWMA、熔断器、响应绑定计数）诊断快照的写入路径，默认空（关闭周期写入）。
+	// 启动时若已存在旧快照，会先改名为 <path>.prev 保留，避免覆盖事故现场。
+	SchedulerStateDumpPath string `mapstructure:"scheduler_state_dump_path"`
+	// SchedulerStateDumpIntervalSeconds: 周期写入调度状态快照的间隔（秒），0 表示关闭（默认）；需同时配置 scheduler_state_dump_path
+	SchedulerStateDumpIntervalSeconds int `mapstructure:"scheduler_state_dump_interval_seconds"`
+
+	// SessionHandoffPath: 热升级会话交接文件路径，默认空（关闭）。
+	// 停机时写入 ingress 会话状态（粘连绑定、最近 response_id、turn 序号等），新实例启动时读取并回灌后删除。
+	SessionHandoffPath string `mapstructure:"session_handoff_path"`
+	// SessionHandoffMaxAgeSeconds: 交接文件的最长有效期（秒），启动时超过该时长的文件视为过期，不回灌
+	SessionHandoffMaxAgeSeconds int `mapstructure:"session_handoff_max_age_seconds"`
+
+	// MetricsListenAddr: OpenMetrics 文本指标（调度、连接池、账号运行时统计）的独立监听地址（host:port），
+	// 路径为 /metrics，默认空（关闭）。指标含账号 ID，应仅绑定内网地址，不经过对外路由。
+	MetricsListenAddr string `mapstructure:"metrics_listen_addr"`
+	// MetricsMaxAccounts: OpenMetrics 输出中按账号打标签的指标最多包含的账号数（按账号 ID 升序截取），用于限制标签基数。默认 100
+	MetricsMaxAccounts int `mapstructure:"metrics_max_accounts"`
+}
+
+// GatewayOpenAIWSModelTransport 单个模型的上游传输协议限制。
+type GatewayOpenAIWSModelTransport struct {
+	// Model: 模型名，以 * 结尾表示前缀匹配（如 gpt-image-*）
+	Model string `mapstructure:"model"`
+	// Transport: 允许的传输协议（http/any）：http 表示仅允许 HTTP，any 表示不限制（用于在前缀规则下豁免个别模型）
+	Transport string `mapstructure:"transport"`
+}
+
+// GatewayOpenAIWSIngressModeGroupDefault 单个分组的 ingress 默认模式。
+type GatewayOpenAIWSIngressModeGroupDefault struct {
+	GroupID int64 `mapstructure:"group_id"`
+	// Mode: off/ctx_pool/passthrough
+	Mode string `mapstructure:"mode"`
+}
+
+// GatewayOpenAIWSCircuitBreakerGroupOverride 单个分组的熔断参数覆盖，字段为 0 时沿用全局配置。
+type GatewayOpenAIWSCircuitBreakerGroupOverride struct {
+	GroupID         int64 `mapstructure:"group_id"`
+	FailThreshold   int   `mapstructure:"fail_threshold"`
+	CooldownSeconds int   `mapstructure:"cooldown_seconds"`
+	HalfOpenMax     int   `mapstructure:"half_open_max"`
+}
+
+// GatewayOpenAIWSAccountRequestRewrite 单个账号的请求体改写规则集。
+type GatewayOpenAIWSAccountRequestRewrite struct {
+	AccountID int64                               `mapstructure:"account_id"`
+	Rules     []GatewayOpenAIWSRequestRewriteRule `mapstructure:"rules"`
+}
+
+// GatewayOpenAIWSRequestRewriteRule 单条请求体改写规则，按配置顺序执行。
+type GatewayOpenAIWSRequestRewriteRule struct {
+	// Op: set 写入 Value（覆盖已有值）；remove 删除字段（字段不存在时忽略）
+	Op string `mapstructure:"op"`
+	// Path: 以 . 分隔的字段路径，如 service_tier、reasoning.effort
+	Path string `mapstructure:"path"`
+	// Value: set 写入的值，可为任意 JSON 值
+	Value any `mapstructure:"value"`
+}
+
+// GatewayOpenAIWSModelDefaultParams 单个模型的 response.create 默认参数。
+type GatewayOpenAIWSModelDefaultParams struct {
+	// Model: 模型名，以 * 结尾表示前缀匹配（如 gpt-5*）
+	Model  string                             `mapstructure:"model"`
+	Params []GatewayOpenAIWSModelDefaultParam `mapstructure:"params"`
+}
+
+// GatewayOpenAIWSModelDefaultParam 单条默认参数；请求体中该路径已存在（含 null）时视为客户端已指定，不写入。
+type GatewayOpenAIWSModelDefaultParam struct {
+	// Path: 以 . 分隔的字段路径，如 reasoning.effort
+	Path string `mapstructure:"path"`
+	// Value: 默认值，可为任意 JSON 值
+	Value any `mapstructure:"value"`
 }
 
 // GatewayOpenAIWSSchedulerScoreWeights 账号调度打分权重。
@@ -604,6 +953,10 @@ type GatewayOpenAIWSSchedulerScoreWeights struct {
 	Queue     float64 `mapstructure:"queue"`
 	ErrorRate float64 `mapstructure:"error_rate"`
 	TTFT      float64 `mapstructure:"ttft"`
+	// PrevNotFound: 账号近期 previous_response_not_found 比例的惩罚权重，仅对携带 previous_response_id 的请求生效
+	PrevNotFound float64 `mapstructure:"prev_not_found"`
+	// Region: 账号地域与客户端地域匹配时的加分权重，仅在开启 scheduler_region_affinity_enabled 且请求带地域时生效
+	Region float64 `mapstructure:"region"`
 }
 
 // GatewayUsageRecordConfig 使用量记录异步队列配置
@@ -1338,11 +1691,55 @@ func setDefaults() {
 	viper.SetDefault("gateway.openai_ws.enabled", true)
 	viper.SetDefault("gateway.openai_ws.mode_router_v2_enabled", false)
 	viper.SetDefault("gateway.openai_ws.ingress_mode_default", "ctx_pool")
+	viper.SetDefault("gateway.openai_ws.ingress_mode_group_defaults", []GatewayOpenAIWSIngressModeGroupDefault{})
+	viper.SetDefault("gateway.openai_ws.model_transport_policy", "downgrade")
+	viper.SetDefault("gateway.openai_ws.force_dedicated_all", false)
+	viper.SetDefault("gateway.openai_ws.malformed_upstream_event_policy", "drop")
+	viper.SetDefault("gateway.openai_ws.usage_missing_policy", "unbilled")
+	viper.SetDefault("gateway.openai_ws.client_close_error_event_enabled", false)
+	viper.SetDefault("gateway.openai_ws.ingress_capabilities_event_enabled", false)
+	viper.SetDefault("gateway.openai_ws.ingress_required_header", "")
+	viper.SetDefault("gateway.openai_ws.ingress_required_header_value", "")
+	viper.SetDefault("gateway.openai_ws.ingress_session_create_per_minute", 0)
+	viper.SetDefault("gateway.openai_ws.ingress_session_create_burst", 0)
+	viper.SetDefault("gateway.openai_ws.first_message_timeout_seconds", 30)
+	viper.SetDefault("gateway.openai_ws.ingress_compression_threshold_bytes", 512)
+	viper.SetDefault("gateway.openai_ws.forward_client_headers", map[string]string{})
+	viper.SetDefault("gateway.openai_ws.account_request_rewrites", []GatewayOpenAIWSAccountRequestRewrite{})
+	viper.SetDefault("gateway.openai_ws.model_default_params", []GatewayOpenAIWSModelDefaultParams{})
+	viper.SetDefault("gateway.openai_ws.shadow_account_id", 0)
+	viper.SetDefault("gateway.openai_ws.shadow_sample_ratio", 0.0)
+	viper.SetDefault("gateway.openai_ws.canary_account_ids", []int64{})
+	viper.SetDefault("gateway.openai_ws.canary_traffic_ratio", 0.0)
+	viper.SetDefault("gateway.openai_ws.canary_error_rate_threshold", 0.2)
+	viper.SetDefault("gateway.openai_ws.canary_window_seconds", 300)
+	viper.SetDefault("gateway.openai_ws.canary_min_requests", 20)
 	viper.SetDefault("gateway.openai_ws.oauth_enabled", true)
 	viper.SetDefault("gateway.openai_ws.apikey_enabled", true)
 	viper.SetDefault("gateway.openai_ws.force_http", false)
 	viper.SetDefault("gateway.openai_ws.allow_store_recovery", false)
 	viper.SetDefault("gateway.openai_ws.ingress_previous_response_recovery_enabled", true)
+	viper.SetDefault("gateway.openai_ws.ingress_client_ping_enabled", false)
+	viper.SetDefault("gateway.openai_ws.max_full_create_replays_per_session", 8)
+	viper.SetDefault("gateway.openai_ws.max_replay_input_bytes", 32*1024*1024)
+	viper.SetDefault("gateway.openai_ws.replay_input_dedupe_consecutive", false)
+	viper.SetDefault("gateway.openai_ws.replay_input_function_call_output_merge", "append")
+	viper.SetDefault("gateway.openai_ws.max_concurrent_recovery_reconnects", 0)
+	viper.SetDefault("gateway.openai_ws.ingress_stale_function_call_output_policy", "off")
+	viper.SetDefault("gateway.openai_ws.ingress_store_disabled_full_input_policy", "auto")
+	viper.SetDefault("gateway.openai_ws.ingress_mid_turn_reconnect_mode", "off")
+	viper.SetDefault("gateway.openai_ws.reselect_account_on_continuity_break", false)
+	viper.SetDefault("gateway.openai_ws.model_change_forces_reselect", false)
+	viper.SetDefault("gateway.openai_ws.ingress_stream_consistency_policy", "off")
+	viper.SetDefault("gateway.openai_ws.ingress_duplicate_key_policy", "off")
+	viper.SetDefault("gateway.openai_ws.ingress_require_session_id", false)
+	viper.SetDefault("gateway.openai_ws.ingress_stream_heartbeat_interval_ms", 0)
+	viper.SetDefault("gateway.openai_ws.ingress_downstream_buffer_size", 0)
+	viper.SetDefault("gateway.openai_ws.ingress_slow_client_policy", "disconnect")
+	viper.SetDefault("gateway.openai_ws.client_disconnect_drain_max_concurrency", 256)
+	viper.SetDefault("gateway.openai_ws.inject_gateway_turn_id", false)
+	viper.SetDefault("gateway.openai_ws.ingress_session_capture_dir", "")
+	viper.SetDefault("gateway.openai_ws.ingress_session_capture_recent_max", 0)
 	viper.SetDefault("gateway.openai_ws.store_disabled_conn_mode", "strict")
 	viper.SetDefault("gateway.openai_ws.store_disabled_force_new_conn", true)
 	viper.SetDefault("gateway.openai_ws.prewarm_generate_enabled", false)
@@ -1351,11 +1748,15 @@ func setDefaults() {
 	viper.SetDefault("gateway.openai_ws.max_conns_per_account", 128)
 	viper.SetDefault("gateway.openai_ws.min_idle_per_account", 4)
 	viper.SetDefault("gateway.openai_ws.max_idle_per_account", 12)
+	viper.SetDefault("gateway.openai_ws.conn_idle_timeout_seconds", 0)
+	viper.SetDefault("gateway.openai_ws.lease_leak_threshold_seconds", 0)
 	viper.SetDefault("gateway.openai_ws.dynamic_max_conns_by_account_concurrency_enabled", true)
 	viper.SetDefault("gateway.openai_ws.oauth_max_conns_factor", 1.0)
 	viper.SetDefault("gateway.openai_ws.apikey_max_conns_factor", 1.0)
 	viper.SetDefault("gateway.openai_ws.dial_timeout_seconds", 10)
 	viper.SetDefault("gateway.openai_ws.read_timeout_seconds", 900)
+	viper.SetDefault("gateway.openai_ws.request_timeout_override_min_seconds", 1)
+	viper.SetDefault("gateway.openai_ws.request_timeout_override_max_seconds", 1800)
 	viper.SetDefault("gateway.openai_ws.write_timeout_seconds", 120)
 	viper.SetDefault("gateway.openai_ws.pool_target_utilization", 0.7)
 	viper.SetDefault("gateway.openai_ws.queue_limit_per_conn", 64)
@@ -1370,16 +1771,55 @@ func setDefaults() {
 	viper.SetDefault("gateway.openai_ws.payload_log_sample_rate", 0.2)
 	viper.SetDefault("gateway.openai_ws.lb_top_k", 7)
 	viper.SetDefault("gateway.openai_ws.sticky_session_ttl_seconds", 3600)
+	viper.SetDefault("gateway.openai_ws.sticky_sessions_per_account_max", 0)
+	viper.SetDefault("gateway.openai_ws.sticky_ttl_skew_sample_rate", 0.01)
+	viper.SetDefault("gateway.openai_ws.sticky_ttl_skew_alert_ratio", 0)
+	viper.SetDefault("gateway.openai_ws.prompt_cache_key_fingerprint_enabled", false)
+	viper.SetDefault("gateway.openai_ws.scheduler_max_consecutive_sticky_turns", 0)
+	viper.SetDefault("gateway.openai_ws.scheduler_max_sticky_lifetime_seconds", 0)
+	viper.SetDefault("gateway.openai_ws.api_key_sticky_window_seconds", 0)
 	viper.SetDefault("gateway.openai_ws.session_hash_read_old_fallback", true)
 	viper.SetDefault("gateway.openai_ws.session_hash_dual_write_old", true)
 	viper.SetDefault("gateway.openai_ws.metadata_bridge_enabled", true)
 	viper.SetDefault("gateway.openai_ws.sticky_response_id_ttl_seconds", 3600)
 	viper.SetDefault("gateway.openai_ws.sticky_previous_response_ttl_seconds", 3600)
+	viper.SetDefault("gateway.openai_ws.session_response_max_age_seconds", 0)
+	viper.SetDefault("gateway.openai_ws.state_store_failure_mode", "open")
 	viper.SetDefault("gateway.openai_ws.scheduler_score_weights.priority", 1.0)
 	viper.SetDefault("gateway.openai_ws.scheduler_score_weights.load", 1.0)
 	viper.SetDefault("gateway.openai_ws.scheduler_score_weights.queue", 0.7)
 	viper.SetDefault("gateway.openai_ws.scheduler_score_weights.error_rate", 0.8)
 	viper.SetDefault("gateway.openai_ws.scheduler_score_weights.ttft", 0.5)
+	viper.SetDefault("gateway.openai_ws.scheduler_score_weights.prev_not_found", 0.6)
+	viper.SetDefault("gateway.openai_ws.scheduler_score_weights.region", 1.0)
+	viper.SetDefault("gateway.openai_ws.scheduler_circuit_breaker_enabled", false)
+	viper.SetDefault("gateway.openai_ws.scheduler_circuit_breaker_fail_threshold", 5)
+	viper.SetDefault("gateway.openai_ws.scheduler_circuit_breaker_cooldown_seconds", 30)
+	viper.SetDefault("gateway.openai_ws.scheduler_circuit_breaker_half_open_max", 2)
+	viper.SetDefault("gateway.openai_ws.scheduler_circuit_breaker_warmup_seconds", 0)
+	viper.SetDefault("gateway.openai_ws.scheduler_circuit_breaker_auto_disable_trips", 0)
+	viper.SetDefault("gateway.openai_ws.scheduler_circuit_breaker_auto_disable_window_seconds", 3600)
+	viper.SetDefault("gateway.openai_ws.scheduler_circuit_breaker_group_overrides", []GatewayOpenAIWSCircuitBreakerGroupOverride{})
+	viper.SetDefault("gateway.openai_ws.scheduler_half_open_probe_strategy", "all")
+	viper.SetDefault("gateway.openai_ws.scheduler_zero_concurrency_mode", "unbounded")
+	viper.SetDefault("gateway.openai_ws.scheduler_assumed_concurrency", 4)
+	viper.SetDefault("gateway.openai_ws.scheduler_candidate_prefilter_threshold", 0)
+	viper.SetDefault("gateway.openai_ws.scheduler_candidate_prefilter_size", 32)
+	viper.SetDefault("gateway.openai_ws.scheduler_runtime_stats_replica_interval_ms", 0)
+	viper.SetDefault("gateway.openai_ws.scheduler_min_score_threshold", 0.0)
+	viper.SetDefault("gateway.openai_ws.scheduler_error_rate_ewma_alpha", 0.2)
+	viper.SetDefault("gateway.openai_ws.scheduler_ttft_ewma_alpha", 0.2)
+	viper.SetDefault("gateway.openai_ws.scheduler_transport_fallback_group_ids", []int64{})
+	viper.SetDefault("gateway.openai_ws.scheduler_region_affinity_enabled", false)
+	viper.SetDefault("gateway.openai_ws.scheduler_region_header", "X-Client-Region")
+	viper.SetDefault("gateway.openai_ws.scheduler_decision_event_buffer_size", 1024)
+	viper.SetDefault("gateway.openai_ws.scheduler_decision_event_sample_rate", 1.0)
+	viper.SetDefault("gateway.openai_ws.scheduler_state_dump_path", "")
+	viper.SetDefault("gateway.openai_ws.scheduler_state_dump_interval_seconds", 0)
+	viper.SetDefault("gateway.openai_ws.session_handoff_path", "")
+	viper.SetDefault("gateway.openai_ws.session_handoff_max_age_seconds", 120)
+	viper.SetDefault("gateway.openai_ws.metrics_listen_addr", "")
+	viper.SetDefault("gateway.openai_ws.metrics_max_accounts", 100)
 	viper.SetDefault("gateway.antigravity_fallback_cooldown_minutes", 1)
 	viper.SetDefault("gateway.antigravity_extra_retries", 10)
 	viper.SetDefault("gateway.max_body_size", int64(256*1024*1024))
@@ -1687,6 +2127,9 @@ func (c *Config) Validate() error {
 			return fmt.Errorf("billing.circuit_breaker.half_open_requests must be positive")
 		}
 	}
+	if err := validateBillingTokenMultipliers(c.Billing.TokenMultipliers); err != nil {
+		return err
+	}
 	if c.Database.MaxOpenConns <= 0 {
 		return fmt.Errorf("database.max_open_conns must be positive")
 	}
@@ -2008,6 +2451,12 @@ func (c *Config) Validate() error {
 	if c.Gateway.OpenAIWS.MaxIdlePerAccount > c.Gateway.OpenAIWS.MaxConnsPerAccount {
 		return fmt.Errorf("gateway.openai_ws.max_idle_per_account must be <= max_conns_per_account")
 	}
+	if c.Gateway.OpenAIWS.ConnIdleTimeoutSeconds < 0 {
+		return fmt.Errorf("gateway.openai_ws.conn_idle_timeout_seconds must be non-negative")
+	}
+	if c.Gateway.OpenAIWS.LeaseLeakThresholdSeconds < 0 {
+		return fmt.Errorf("gateway.openai_ws.lease_leak_threshold_seconds must be non-negative")
+	}
 	if c.Gateway.OpenAIWS.OAuthMaxConnsFactor <= 0 {
 		return fmt.Errorf("gateway.openai_ws.oauth_max_conns_factor must be positive")
 	}
@@ -2023,6 +2472,12 @@ func (c *Config) Validate() error {
 	if c.Gateway.OpenAIWS.WriteTimeoutSeconds <= 0 {
 		return fmt.Errorf("gateway.openai_ws.write_timeout_seconds must be positive")
 	}
+	if c.Gateway.OpenAIWS.RequestTimeoutOverrideMinSeconds <= 0 {
+		return fmt.Errorf("gateway.openai_ws.request_timeout_override_min_seconds must be positive")
+	}
+	if c.Gateway.OpenAIWS.RequestTimeoutOverrideMaxSeconds < c.Gateway.OpenAIWS.RequestTimeoutOverrideMinSeconds {
+		return fmt.Errorf("gateway.openai_ws.request_timeout_override_max_seconds must be >= request_timeout_override_min_seconds")
+	}
 	if c.Gateway.OpenAIWS.PoolTargetUtilization <= 0 || c.Gateway.OpenAIWS.PoolTargetUtilization > 1 {
 		return fmt.Errorf("gateway.openai_ws.pool_target_utilization must be within (0,1]")
 	}
@@ -2066,6 +2521,26 @@ func (c *Config) Validate() error {
 			return fmt.Errorf("gateway.openai_ws.ingress_mode_default must be one of off|ctx_pool|passthrough")
 		}
 	}
+	if err := validateOpenAIWSIngressModeGroupDefaults(c.Gateway.OpenAIWS.IngressModeGroupDefaults); err != nil {
+		return err
+	}
+	for i, rule := range c.Gateway.OpenAIWS.ModelTransports {
+		if strings.TrimSpace(rule.Model) == "" {
+			return fmt.Errorf("gateway.openai_ws.model_transports[%d].model must not be empty", i)
+		}
+		switch strings.ToLower(strings.TrimSpace(rule.Transport)) {
+		case "http", "any":
+		default:
+			return fmt.Errorf("gateway.openai_ws.model_transports[%d].transport must be one of http|any", i)
+		}
+	}
+	if policy := strings.ToLower(strings.TrimSpace(c.Gateway.OpenAIWS.ModelTransportPolicy)); policy != "" {
+		switch policy {
+		case "downgrade", "reject":
+		default:
+			return fmt.Errorf("gateway.openai_ws.model_transport_policy must be one of downgrade|reject")
+		}
+	}
 	if mode := strings.ToLower(strings.TrimSpace(c.Gateway.OpenAIWS.StoreDisabledConnMode)); mode != "" {
 		switch mode {
 		case "strict", "adaptive", "off":
@@ -2082,17 +2557,124 @@ func (c *Config) Validate() error {
 	if c.Gateway.OpenAIWS.StickySessionTTLSeconds <= 0 {
 		return fmt.Errorf("gateway.openai_ws.sticky_session_ttl_seconds must be positive")
 	}
+	if c.Gateway.OpenAIWS.StickySessionsPerAccountMax < 0 {
+		return fmt.Errorf("gateway.openai_ws.sticky_sessions_per_account_max must be non-negative")
+	}
+	if c.Gateway.OpenAIWS.StickyTTLSkewSampleRate < 0 || c.Gateway.OpenAIWS.StickyTTLSkewSampleRate > 1 {
+		return fmt.Errorf("gateway.openai_ws.sticky_ttl_skew_sample_rate must be within [0,1]")
+	}
+	if c.Gateway.OpenAIWS.StickyTTLSkewAlertRatio < 0 {
+		return fmt.Errorf("gateway.openai_ws.sticky_ttl_skew_alert_ratio must be non-negative")
+	}
+	if c.Gateway.OpenAIWS.APIKeyStickyWindowSeconds < 0 {
+		return fmt.Errorf("gateway.openai_ws.api_key_sticky_window_seconds must be non-negative")
+	}
 	if c.Gateway.OpenAIWS.StickyResponseIDTTLSeconds <= 0 {
 		return fmt.Errorf("gateway.openai_ws.sticky_response_id_ttl_seconds must be positive")
 	}
 	if c.Gateway.OpenAIWS.StickyPreviousResponseTTLSeconds < 0 {
 		return fmt.Errorf("gateway.openai_ws.sticky_previous_response_ttl_seconds must be non-negative")
 	}
+	if c.Gateway.OpenAIWS.SessionResponseMaxAgeSeconds < 0 {
+		return fmt.Errorf("gateway.openai_ws.session_response_max_age_seconds must be non-negative")
+	}
+	if mode := strings.ToLower(strings.TrimSpace(c.Gateway.OpenAIWS.StateStoreFailureMode)); mode != "" {
+		switch mode {
+		case "open", "closed":
+		default:
+			return fmt.Errorf("gateway.openai_ws.state_store_failure_mode must be one of open|closed")
+		}
+	}
+	if c.Gateway.OpenAIWS.MaxFullCreateReplaysPerSession < 0 {
+		return fmt.Errorf("gateway.openai_ws.max_full_create_replays_per_session must be non-negative")
+	}
+	if c.Gateway.OpenAIWS.MaxReplayInputBytes < 0 {
+		return fmt.Errorf("gateway.openai_ws.max_replay_input_bytes must be non-negative")
+	}
+	if c.Gateway.OpenAIWS.MaxConcurrentRecoveryReconnects < 0 {
+		return fmt.Errorf("gateway.openai_ws.max_concurrent_recovery_reconnects must be non-negative")
+	}
+	if header := strings.TrimSpace(c.Gateway.OpenAIWS.IngressRequiredHeader); header != "" {
+		if !isValidHTTPHeaderName(header) {
+			return fmt.Errorf("gateway.openai_ws.ingress_required_header must be a valid header name")
+		}
+	} else if strings.TrimSpace(c.Gateway.OpenAIWS.IngressRequiredHeaderValue) != "" {
+		return fmt.Errorf("gateway.openai_ws.ingress_required_header must be set when ingress_required_header_value is set")
+	}
+	if c.Gateway.OpenAIWS.IngressSessionCreatePerMinute < 0 {
+		return fmt.Errorf("gateway.openai_ws.ingress_session_create_per_minute must be non-negative")
+	}
+	if c.Gateway.OpenAIWS.IngressSessionCreateBurst < 0 {
+		return fmt.Errorf("gateway.openai_ws.ingress_session_create_burst must be non-negative")
+	}
+	if c.Gateway.OpenAIWS.FirstMessageTimeoutSeconds <= 0 {
+		return fmt.Errorf("gateway.openai_ws.first_message_timeout_seconds must be positive")
+	}
+	if c.Gateway.OpenAIWS.IngressCompressionThresholdBytes <= 0 {
+		return fmt.Errorf("gateway.openai_ws.ingress_compression_threshold_bytes must be positive")
+	}
+	if err := validateOpenAIWSForwardClientHeaders(c.Gateway.OpenAIWS.ForwardClientHeaders); err != nil {
+		return err
+	}
+	if err := validateOpenAIWSAccountRequestRewrites(c.Gateway.OpenAIWS.AccountRequestRewrites); err != nil {
+		return err
+	}
+	if err := validateOpenAIWSModelDefaultParams(c.Gateway.OpenAIWS.ModelDefaultParams); err != nil {
+		return err
+	}
+	if c.Gateway.OpenAIWS.ShadowAccountID < 0 {
+		return fmt.Errorf("gateway.openai_ws.shadow_account_id must be non-negative")
+	}
+	if c.Gateway.OpenAIWS.ShadowSampleRatio < 0 || c.Gateway.OpenAIWS.ShadowSampleRatio > 1 {
+		return fmt.Errorf("gateway.openai_ws.shadow_sample_ratio must be within [0,1]")
+	}
+	if c.Gateway.OpenAIWS.ShadowSampleRatio > 0 && c.Gateway.OpenAIWS.ShadowAccountID == 0 {
+		return fmt.Errorf("gateway.openai_ws.shadow_account_id is required when shadow_sample_ratio > 0")
+	}
+	for _, accountID := range c.Gateway.OpenAIWS.CanaryAccountIDs {
+		if accountID <= 0 {
+			return fmt.Errorf("gateway.openai_ws.canary_account_ids must contain positive account ids")
+		}
+	}
+	if c.Gateway.OpenAIWS.CanaryTrafficRatio < 0 || c.Gateway.OpenAIWS.CanaryTrafficRatio > 1 {
+		return fmt.Errorf("gateway.openai_ws.canary_traffic_ratio must be within [0,1]")
+	}
+	if c.Gateway.OpenAIWS.CanaryTrafficRatio > 0 && len(c.Gateway.OpenAIWS.CanaryAccountIDs) == 0 {
+		return fmt.Errorf("gateway.openai_ws.canary_account_ids is required when canary_traffic_ratio > 0")
+	}
+	if c.Gateway.OpenAIWS.CanaryErrorRateThreshold <= 0 || c.Gateway.OpenAIWS.CanaryErrorRateThreshold > 1 {
+		return fmt.Errorf("gateway.openai_ws.canary_error_rate_threshold must be within (0,1]")
+	}
+	if c.Gateway.OpenAIWS.CanaryWindowSeconds <= 0 {
+		return fmt.Errorf("gateway.openai_ws.canary_window_seconds must be positive")
+	}
+	if c.Gateway.OpenAIWS.CanaryMinRequests <= 0 {
+		return fmt.Errorf("gateway.openai_ws.canary_min_requests must be positive")
+	}
+	if c.Gateway.OpenAIWS.IngressSessionCaptureRecentMax < 0 {
+		return fmt.Errorf("gateway.openai_ws.ingress_session_capture_recent_max must be non-negative")
+	}
+	if c.Gateway.OpenAIWS.IngressStreamHeartbeatIntervalMS < 0 {
+		return fmt.Errorf("gateway.openai_ws.ingress_stream_heartbeat_interval_ms must be non-negative")
+	}
+	if c.Gateway.OpenAIWS.IngressDownstreamBufferSize < 0 {
+		return fmt.Errorf("gateway.openai_ws.ingress_downstream_buffer_size must be non-negative")
+	}
+	switch strings.TrimSpace(c.Gateway.OpenAIWS.IngressSlowClientPolicy) {
+	case "", "disconnect", "drop_deltas":
+	default:
+		return fmt.Errorf("gateway.openai_ws.ingress_slow_client_policy must be one of disconnect/drop_deltas")
+	}
+	if c.Gateway.OpenAIWS.ClientDisconnectDrainMaxConcurrency < 0 {
+		return fmt.Errorf("gateway.openai_ws.client_disconnect_drain_max_concurrency must be non-negative")
+	}
 	if c.Gateway.OpenAIWS.SchedulerScoreWeights.Priority < 0 ||
 		c.Gateway.OpenAIWS.SchedulerScoreWeights.Load < 0 ||
 		c.Gateway.OpenAIWS.SchedulerScoreWeights.Queue < 0 ||
 		c.Gateway.OpenAIWS.SchedulerScoreWeights.ErrorRate < 0 ||
-		c.Gateway.OpenAIWS.SchedulerScoreWeights.TTFT < 0 {
+		c.Gateway.OpenAIWS.SchedulerScoreWeights.TTFT < 0 ||
+		c.Gateway.OpenAIWS.SchedulerScoreWeights.PrevNotFound < 0 ||
+		c.Gateway.OpenAIWS.SchedulerScoreWeights.Region < 0 {
 		return fmt.Errorf("gateway.openai_ws.scheduler_score_weights.* must be non-negative")
 	}
 	weightSum := c.Gateway.OpenAIWS.SchedulerScoreWeights.Priority +
@@ -2103,6 +2685,132 @@ func (c *Config) Validate() error {
 	if weightSum <= 0 {
 		return fmt.Errorf("gateway.openai_ws.scheduler_score_weights must not all be zero")
 	}
+	if c.Gateway.OpenAIWS.SchedulerCircuitBreakerEnabled {
+		if c.Gateway.OpenAIWS.SchedulerCircuitBreakerFailThreshold <= 0 {
+			return fmt.Errorf("gateway.openai_ws.scheduler_circuit_breaker_fail_threshold must be positive")
+		}
+		if c.Gateway.OpenAIWS.SchedulerCircuitBreakerCooldownSeconds <= 0 {
+			return fmt.Errorf("gateway.openai_ws.scheduler_circuit_breaker_cooldown_seconds must be positive")
+		}
+		if c.Gateway.OpenAIWS.SchedulerCircuitBreakerHalfOpenMax <= 0 {
+			return fmt.Errorf("gateway.openai_ws.scheduler_circuit_breaker_half_open_max must be positive")
+		}
+	}
+	if c.Gateway.OpenAIWS.SchedulerCircuitBreakerWarmupSeconds < 0 {
+		return fmt.Errorf("gateway.openai_ws.scheduler_circuit_breaker_warmup_seconds must be non-negative")
+	}
+	if c.Gateway.OpenAIWS.SchedulerCircuitBreakerAutoDisableTrips < 0 {
+		return fmt.Errorf("gateway.openai_ws.scheduler_circuit_breaker_auto_disable_trips must be non-negative")
+	}
+	if c.Gateway.OpenAIWS.SchedulerCircuitBreakerAutoDisableTrips > 0 && c.Gateway.OpenAIWS.SchedulerCircuitBreakerAutoDisableWindowSeconds <= 0 {
+		return fmt.Errorf("gateway.openai_ws.scheduler_circuit_breaker_auto_disable_window_seconds must be positive when auto_disable_trips is enabled")
+	}
+	if err := validateOpenAIWSCircuitBreakerGroupOverrides(c.Gateway.OpenAIWS.SchedulerCircuitBreakerGroupOverrides); err != nil {
+		return err
+	}
+	switch strings.TrimSpace(c.Gateway.OpenAIWS.SchedulerHalfOpenProbeStrategy) {
+	case "", "all", "closest_recovery", "best_score":
+	default:
+		return fmt.Errorf("gateway.openai_ws.scheduler_half_open_probe_strategy must be one of all|closest_recovery|best_score")
+	}
+	switch strings.TrimSpace(c.Gateway.OpenAIWS.SchedulerZeroConcurrencyMode) {
+	case "", "unbounded":
+	case "assumed":
+		if c.Gateway.OpenAIWS.SchedulerAssumedConcurrency <= 0 {
+			return fmt.Errorf("gateway.openai_ws.scheduler_assumed_concurrency must be positive when scheduler_zero_concurrency_mode=assumed")
+		}
+	default:
+		return fmt.Errorf("gateway.openai_ws.scheduler_zero_concurrency_mode must be one of unbounded/assumed")
+	}
+	if c.Gateway.OpenAIWS.SchedulerMaxConsecutiveStickyTurns < 0 {
+		return fmt.Errorf("gateway.openai_ws.scheduler_max_consecutive_sticky_turns must be non-negative")
+	}
+	if c.Gateway.OpenAIWS.SchedulerMaxStickyLifetimeSeconds < 0 {
+		return fmt.Errorf("gateway.openai_ws.scheduler_max_sticky_lifetime_seconds must be non-negative")
+	}
+	if c.Gateway.OpenAIWS.SchedulerCandidatePrefilterThreshold < 0 {
+		return fmt.Errorf("gateway.openai_ws.scheduler_candidate_prefilter_threshold must be non-negative")
+	}
+	if c.Gateway.OpenAIWS.SchedulerCandidatePrefilterThreshold > 0 && c.Gateway.OpenAIWS.SchedulerCandidatePrefilterSize <= 0 {
+		return fmt.Errorf("gateway.openai_ws.scheduler_candidate_prefilter_size must be positive when scheduler_candidate_prefilter_threshold is enabled")
+	}
+	if c.Gateway.OpenAIWS.SchedulerRuntimeStatsReplicaIntervalMS < 0 {
+		return fmt.Errorf("gateway.openai_ws.scheduler_runtime_stats_replica_interval_ms must be non-negative")
+	}
+	if c.Gateway.OpenAIWS.SchedulerMinScoreThreshold < 0 {
+		return fmt.Errorf("gateway.openai_ws.scheduler_min_score_threshold must be non-negative")
+	}
+	if alpha := c.Gateway.OpenAIWS.SchedulerErrorRateEWMAAlpha; alpha <= 0 || alpha >= 1 {
+		return fmt.Errorf("gateway.openai_ws.scheduler_error_rate_ewma_alpha must be within (0,1)")
+	}
+	if alpha := c.Gateway.OpenAIWS.SchedulerTTFTEWMAAlpha; alpha <= 0 || alpha >= 1 {
+		return fmt.Errorf("gateway.openai_ws.scheduler_ttft_ewma_alpha must be within (0,1)")
+	}
+	for _, groupID := range c.Gateway.OpenAIWS.SchedulerTransportFallbackGroupIDs {
+		if groupID <= 0 {
+			return fmt.Errorf("gateway.openai_ws.scheduler_transport_fallback_group_ids must contain positive group ids")
+		}
+	}
+	if c.Gateway.OpenAIWS.SchedulerDecisionEventBufferSize <= 0 {
+		return fmt.Errorf("gateway.openai_ws.scheduler_decision_event_buffer_size must be positive")
+	}
+	if c.Gateway.OpenAIWS.SchedulerDecisionEventSampleRate < 0 || c.Gateway.OpenAIWS.SchedulerDecisionEventSampleRate > 1 {
+		return fmt.Errorf("gateway.openai_ws.scheduler_decision_event_sample_rate must be within [0,1]")
+	}
+	if c.Gateway.OpenAIWS.SchedulerStateDumpIntervalSeconds < 0 {
+		return fmt.Errorf("gateway.openai_ws.scheduler_state_dump_interval_seconds must be non-negative")
+	}
+	if c.Gateway.OpenAIWS.SessionHandoffMaxAgeSeconds <= 0 {
+		return fmt.Errorf("gateway.openai_ws.session_handoff_max_age_seconds must be positive")
+	}
+	if addr := strings.TrimSpace(c.Gateway.OpenAIWS.MetricsListenAddr); addr != "" {
+		if _, port, err := net.SplitHostPort(addr); err != nil || port == "" {
+			return fmt.Errorf("gateway.openai_ws.metrics_listen_addr must be host:port")
+		}
+	}
+	if c.Gateway.OpenAIWS.MetricsMaxAccounts <= 0 {
+		return fmt.Errorf("gateway.openai_ws.metrics_max_accounts must be positive")
+	}
+	switch strings.TrimSpace(c.Gateway.OpenAIWS.IngressStaleFunctionCallOutputPolicy) {
+	case "", "off", "drop", "full_create":
+	default:
+		return fmt.Errorf("gateway.openai_ws.ingress_stale_function_call_output_policy must be one of off/drop/full_create")
+	}
+	switch strings.TrimSpace(c.Gateway.OpenAIWS.IngressStoreDisabledFullInputPolicy) {
+	case "", "auto", "incremental", "full_create":
+	default:
+		return fmt.Errorf("gateway.openai_ws.ingress_store_disabled_full_input_policy must be one of auto/incremental/full_create")
+	}
+	switch strings.TrimSpace(c.Gateway.OpenAIWS.IngressMidTurnReconnectMode) {
+	case "", "off", "resume", "reset":
+	default:
+		return fmt.Errorf("gateway.openai_ws.ingress_mid_turn_reconnect_mode must be one of off/resume/reset")
+	}
+	switch strings.TrimSpace(c.Gateway.OpenAIWS.IngressStreamConsistencyPolicy) {
+	case "", "off", "reject", "coerce":
+	default:
+		return fmt.Errorf("gateway.openai_ws.ingress_stream_consistency_policy must be one of off/reject/coerce")
+	}
+	switch strings.TrimSpace(c.Gateway.OpenAIWS.IngressDuplicateKeyPolicy) {
+	case "", "off", "reject", "last_wins":
+	default:
+		return fmt.Errorf("gateway.openai_ws.ingress_duplicate_key_policy must be one of off/reject/last_wins")
+	}
+	switch strings.TrimSpace(c.Gateway.OpenAIWS.MalformedUpstreamEventPolicy) {
+	case "", "drop", "terminate":
+	default:
+		return fmt.Errorf("gateway.openai_ws.malformed_upstream_event_policy must be one of drop/terminate")
+	}
+	switch strings.TrimSpace(c.Gateway.OpenAIWS.ReplayInputFunctionCallOutputMerge) {
+	case "", "append", "replace":
+	default:
+		return fmt.Errorf("gateway.openai_ws.replay_input_function_call_output_merge must be one of append/replace")
+	}
+	switch strings.TrimSpace(c.Gateway.OpenAIWS.UsageMissingPolicy) {
+	case "", "unbilled", "zero", "estimate":
+	default:
+		return fmt.Errorf("gateway.openai_ws.usage_missing_policy must be one of unbilled/zero/estimate")
+	}
 	if c.Gateway.MaxLineSize < 0 {
 		return fmt.Errorf("gateway.max_line_size must be non-negative")
 	}
@@ -2382,3 +3090,239 @@ func warnIfInsecureURL(field, raw string) {
 		slog.Warn("url uses http scheme; use https in production to avoid token leakage", "field", field)
 	}
 }
+
+func validateBillingTokenMultipliers(rules []BillingTokenMultiplierConfig) error {
+	seen := make(map[string]struct{}, len(rules))
+	for i, rule := range rules {
+		model := strings.ToLower(strings.TrimSpace(rule.Model))
+		if model == "" {
+			return fmt.Errorf("billing.token_multipliers[%d].model is required", i)
+		}
+		if _, exists := seen[model]; exists {
+			return fmt.Errorf("billing.token_multipliers[%d].model %q is duplicated", i, rule.Model)
+		}
+		seen[model] = struct{}{}
+		fields := []struct {
+			name  string
+			value *float64
+		}{
+			{"input", rule.Input},
+			{"output", rule.Output},
+			{"cache_creation", rule.CacheCreation},
+			{"cache_read", rule.CacheRead},
+		}
+		for _, field := range fields {
+			if field.value == nil {
+				continue
+			}
+			if v := *field.value; v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Errorf("billing.token_multipliers[%d].%s must be a non-negative finite number", i, field.name)
+			}
+		}
+	}
+	return nil
+}
+
+// openAIWSForwardHeaderProtected 为不允许通过 forward_client_headers 写入的上游握手头。
+var openAIWSForwardHeaderProtected = map[string]struct{}{
+	"authorization":       {},
+	"proxy-authorization": {},
+	"chatgpt-account-id":  {},
+	"cookie":              {},
+	"host":                {},
+	"connection":          {},
+	"upgrade":             {},
+	"keep-alive":          {},
+	"te":                  {},
+	"trailer":             {},
+	"transfer-encoding":   {},
+	"content-length":      {},
+}
+
+func validateOpenAIWSForwardClientHeaders(headers map[string]string) error {
+	for source, target := range headers {
+		source = strings.TrimSpace(source)
+		target = strings.TrimSpace(target)
+		if !isValidHTTPHeaderName(source) {
+			return fmt.Errorf("gateway.openai_ws.forward_client_headers has invalid header name %q", source)
+		}
+		if target == "" {
+			target = source
+		}
+		if !isValidHTTPHeaderName(target) {
+			return fmt.Errorf("gateway.openai_ws.forward_client_headers has invalid header name %q", target)
+		}
+		lower := strings.ToLower(target)
+		if _, protected := openAIWSForwardHeaderProtected[lower]; protected || strings.HasPrefix(lower, "sec-websocket-") {
+			return fmt.Errorf("gateway.openai_ws.forward_client_headers cannot forward to protected header %q", target)
+		}
+	}
+	return nil
+}
+
+// OpenAIWSRequestRewriteProtectedFields 为 account_request_rewrites 不允许改写的顶层字段：
+// 这些字段参与协议路由、模型映射、续链或会话一致性校验，改写会破坏缓存命中与恢复逻辑。
+var OpenAIWSRequestRewriteProtectedFields = map[string]struct{}{
+	"type":                 {},
+	"model":                {},
+	"input":                {},
+	"previous_response_id": {},
+	"prompt_cache_key":     {},
+	"stream":               {},
+}
+
+func validateOpenAIWSIngressModeGroupDefaults(defaults []GatewayOpenAIWSIngressModeGroupDefault) error {
+	seen := make(map[int64]struct{}, len(defaults))
+	for i, groupDefault := range defaults {
+		field := fmt.Sprintf("gateway.openai_ws.ingress_mode_group_defaults[%d]", i)
+		if groupDefault.GroupID <= 0 {
+			return fmt.Errorf("%s.group_id must be positive", field)
+		}
+		if _, exists := seen[groupDefault.GroupID]; exists {
+			return fmt.Errorf("%s.group_id %d is duplicated", field, groupDefault.GroupID)
+		}
+		seen[groupDefault.GroupID] = struct{}{}
+		switch strings.ToLower(strings.TrimSpace(groupDefault.Mode)) {
+		case "off", "ctx_pool", "passthrough":
+		default:
+			return fmt.Errorf("%s.mode must be one of off|ctx_pool|passthrough", field)
+		}
+	}
+	return nil
+}
+
+func validateOpenAIWSCircuitBreakerGroupOverrides(overrides []GatewayOpenAIWSCircuitBreakerGroupOverride) error {
+	seen := make(map[int64]struct{}, len(overrides))
+	for i, override := range overrides {
+		field := fmt.Sprintf("gateway.openai_ws.scheduler_circuit_breaker_group_overrides[%d]", i)
+		if override.GroupID <= 0 {
+			return fmt.Errorf("%s.group_id must be positive", field)
+		}
+		if _, exists := seen[override.GroupID]; exists {
+			return fmt.Errorf("%s.group_id %d is duplicated", field, override.GroupID)
+		}
+		seen[override.GroupID] = struct{}{}
+		if override.FailThreshold < 0 {
+			return fmt.Errorf("%s.fail_threshold must be non-negative", field)
+		}
+		if override.CooldownSeconds < 0 {
+			return fmt.Errorf("%s.cooldown_seconds must be non-negative", field)
+		}
+		if override.HalfOpenMax < 0 {
+			return fmt.Errorf("%s.half_open_max must be non-negative", field)
+		}
+	}
+	return nil
+}
+
+func validateOpenAIWSAccountRequestRewrites(rewrites []GatewayOpenAIWSAccountRequestRewrite) error {
+	seen := make(map[int64]struct{}, len(rewrites))
+	for i, rewrite := range rewrites {
+		if rewrite.AccountID <= 0 {
+			return fmt.Errorf("gateway.openai_ws.account_request_rewrites[%d].account_id must be positive", i)
+		}
+		if _, exists := seen[rewrite.AccountID]; exists {
+			return fmt.Errorf("gateway.openai_ws.account_request_rewrites[%d].account_id %d is duplicated", i, rewrite.AccountID)
+		}
+		seen[rewrite.AccountID] = struct{}{}
+		for j, rule := range rewrite.Rules {
+			field := fmt.Sprintf("gateway.openai_ws.account_request_rewrites[%d].rules[%d]", i, j)
+			segments, ok := SplitOpenAIWSRequestRewritePath(rule.Path)
+			if !ok {
+				return fmt.Errorf("%s.path must be dot-separated field names of [A-Za-z0-9_-]", field)
+			}
+			if _, protected := OpenAIWSRequestRewriteProtectedFields[segments[0]]; protected {
+				return fmt.Errorf("%s.path cannot rewrite protected field %q", field, segments[0])
+			}
+			switch strings.ToLower(strings.TrimSpace(rule.Op)) {
+			case "set":
+				if rule.Value == nil {
+					return fmt.Errorf("%s.value is required for set", field)
+				}
+				if _, err := json.Marshal(rule.Value); err != nil {
+					return fmt.Errorf("%s.value must be JSON-encodable: %v", field, err)
+				}
+			case "remove":
+			default:
+				return fmt.Errorf("%s.op must be one of set|remove", field)
+			}
+		}
+	}
+	return nil
+}
+
+func validateOpenAIWSModelDefaultParams(defaults []GatewayOpenAIWSModelDefaultParams) error {
+	seen := make(map[string]struct{}, len(defaults))
+	for i, modelDefault := range defaults {
+		field := fmt.Sprintf("gateway.openai_ws.model_default_params[%d]", i)
+		model := strings.ToLower(strings.TrimSpace(modelDefault.Model))
+		if model == "" || model == "*" {
+			return fmt.Errorf("%s.model must not be empty", field)
+		}
+		if _, exists := seen[model]; exists {
+			return fmt.Errorf("%s.model %q is duplicated", field, modelDefault.Model)
+		}
+		seen[model] = struct{}{}
+		paths := make(map[string]struct{}, len(modelDefault.Params))
+		for j, param := range modelDefault.Params {
+			paramField := fmt.Sprintf("%s.params[%d]", field, j)
+			segments, ok := SplitOpenAIWSRequestRewritePath(param.Path)
+			if !ok {
+				return fmt.Errorf("%s.path must be dot-separated field names of [A-Za-z0-9_-]", paramField)
+			}
+			if _, protected := OpenAIWSRequestRewriteProtectedFields[segments[0]]; protected {
+				return fmt.Errorf("%s.path cannot set protected field %q", paramField, segments[0])
+			}
+			path := strings.Join(segments, ".")
+			if _, exists := paths[path]; exists {
+				return fmt.Errorf("%s.path %q is duplicated", paramField, path)
+			}
+			paths[path] = struct{}{}
+			if param.Value == nil {
+				return fmt.Errorf("%s.value is required", paramField)
+			}
+			if _, err := json.Marshal(param.Value); err != nil {
+				return fmt.Errorf("%s.value must be JSON-encodable: %v", paramField, err)
+			}
+		}
+	}
+	return nil
+}
+
+// SplitOpenAIWSRequestRewritePath 按 . 拆分改写路径；任一段为空或包含非 [A-Za-z0-9_-] 字符时返回 false。
+func SplitOpenAIWSRequestRewritePath(path string) ([]string, bool) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, false
+	}
+	segments := strings.Split(path, ".")
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, false
+		}
+		for _, r := range segment {
+			isAlnum := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+			if !isAlnum && r != '_' && r != '-' {
+				return nil, false
+			}
+		}
+	}
+	return segments, true
+}
+
+// isValidHTTPHeaderName 校验 RFC 7230 token 字符集。
+func isValidHTTPHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		ch := name[i]
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", ch) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -105,6 +105,24 @@ func TestLoadDefaultOpenAIWSConfig(t *testing.T) {
 	if cfg.Gateway.OpenAIWS.StickySessionTTLSeconds != 3600 {
 		t.Fatalf("Gateway.OpenAIWS.StickySessionTTLSeconds = %d, want 3600", cfg.Gateway.OpenAIWS.StickySessionTTLSeconds)
 	}
+	if cfg.Gateway.OpenAIWS.StickySessionsPerAccountMax != 0 {
+		t.Fatalf("Gateway.OpenAIWS.StickySessionsPerAccountMax = %d, want 0", cfg.Gateway.OpenAIWS.StickySessionsPerAccountMax)
+	}
+	if cfg.Gateway.OpenAIWS.StickyTTLSkewSampleRate != 0.01 || cfg.Gateway.OpenAIWS.StickyTTLSkewAlertRatio != 0 {
+		t.Fatalf("Gateway.OpenAIWS sticky TTL skew = (%v,%v), want (0.01,0)", cfg.Gateway.OpenAIWS.StickyTTLSkewSampleRate, cfg.Gateway.OpenAIWS.StickyTTLSkewAlertRatio)
+	}
+	if cfg.Gateway.OpenAIWS.PromptCacheKeyFingerprintEnabled {
+		t.Fatalf("Gateway.OpenAIWS.PromptCacheKeyFingerprintEnabled = true, want false")
+	}
+	if cfg.Gateway.OpenAIWS.SchedulerMaxConsecutiveStickyTurns != 0 {
+		t.Fatalf("Gateway.OpenAIWS.SchedulerMaxConsecutiveStickyTurns = %d, want 0", cfg.Gateway.OpenAIWS.SchedulerMaxConsecutiveStickyTurns)
+	}
+	if cfg.Gateway.OpenAIWS.SchedulerMaxStickyLifetimeSeconds != 0 {
+		t.Fatalf("Gateway.OpenAIWS.SchedulerMaxStickyLifetimeSeconds = %d, want 0", cfg.Gateway.OpenAIWS.SchedulerMaxStickyLifetimeSeconds)
+	}
+	if cfg.Gateway.OpenAIWS.APIKeyStickyWindowSeconds != 0 {
+		t.Fatalf("Gateway.OpenAIWS.APIKeyStickyWindowSeconds = %d, want 0", cfg.Gateway.OpenAIWS.APIKeyStickyWindowSeconds)
+	}
 	if !cfg.Gateway.OpenAIWS.SessionHashReadOldFallback {
 		t.Fatalf("Gateway.OpenAIWS.SessionHashReadOldFallback = false, want true")
 	}
@@ -117,6 +135,198 @@ func TestLoadDefaultOpenAIWSConfig(t *testing.T) {
 	if cfg.Gateway.OpenAIWS.StickyResponseIDTTLSeconds != 3600 {
 		t.Fatalf("Gateway.OpenAIWS.StickyResponseIDTTLSeconds = %d, want 3600", cfg.Gateway.OpenAIWS.StickyResponseIDTTLSeconds)
 	}
+	if cfg.Gateway.OpenAIWS.SessionResponseMaxAgeSeconds != 0 {
+		t.Fatalf("Gateway.OpenAIWS.SessionResponseMaxAgeSeconds = %d, want 0", cfg.Gateway.OpenAIWS.SessionResponseMaxAgeSeconds)
+	}
+	if cfg.Gateway.OpenAIWS.StateStoreFailureMode != "open" {
+		t.Fatalf("Gateway.OpenAIWS.StateStoreFailureMode = %q, want %q", cfg.Gateway.OpenAIWS.StateStoreFailureMode, "open")
+	}
+	if cfg.Gateway.OpenAIWS.IngressClientPingEnabled {
+		t.Fatalf("Gateway.OpenAIWS.IngressClientPingEnabled = true, want false")
+	}
+	if cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerEnabled {
+		t.Fatalf("Gateway.OpenAIWS.SchedulerCircuitBreakerEnabled = true, want false")
+	}
+	if cfg.Gateway.OpenAIWS.ForceDedicatedAll {
+		t.Fatalf("Gateway.OpenAIWS.ForceDedicatedAll = true, want false")
+	}
+	if cfg.Gateway.OpenAIWS.MalformedUpstreamEventPolicy != "drop" {
+		t.Fatalf("Gateway.OpenAIWS.MalformedUpstreamEventPolicy = %q, want drop", cfg.Gateway.OpenAIWS.MalformedUpstreamEventPolicy)
+	}
+	if cfg.Gateway.OpenAIWS.UsageMissingPolicy != "unbilled" {
+		t.Fatalf("Gateway.OpenAIWS.UsageMissingPolicy = %q, want unbilled", cfg.Gateway.OpenAIWS.UsageMissingPolicy)
+	}
+	if cfg.Gateway.OpenAIWS.ClientCloseErrorEventEnabled {
+		t.Fatalf("Gateway.OpenAIWS.ClientCloseErrorEventEnabled = true, want false")
+	}
+	if cfg.Gateway.OpenAIWS.IngressCapabilitiesEventEnabled {
+		t.Fatalf("Gateway.OpenAIWS.IngressCapabilitiesEventEnabled = true, want false")
+	}
+	if cfg.Gateway.OpenAIWS.IngressRequiredHeader != "" || cfg.Gateway.OpenAIWS.IngressRequiredHeaderValue != "" {
+		t.Fatalf("Gateway.OpenAIWS.IngressRequiredHeader = %q/%q, want empty", cfg.Gateway.OpenAIWS.IngressRequiredHeader, cfg.Gateway.OpenAIWS.IngressRequiredHeaderValue)
+	}
+	if cfg.Gateway.OpenAIWS.IngressSessionCreatePerMinute != 0 || cfg.Gateway.OpenAIWS.IngressSessionCreateBurst != 0 {
+		t.Fatalf("Gateway.OpenAIWS.IngressSessionCreate* = %d/%d, want 0/0", cfg.Gateway.OpenAIWS.IngressSessionCreatePerMinute, cfg.Gateway.OpenAIWS.IngressSessionCreateBurst)
+	}
+	if cfg.Gateway.OpenAIWS.FirstMessageTimeoutSeconds != 30 {
+		t.Fatalf("Gateway.OpenAIWS.FirstMessageTimeoutSeconds = %d, want 30", cfg.Gateway.OpenAIWS.FirstMessageTimeoutSeconds)
+	}
+	if cfg.Gateway.OpenAIWS.IngressCompressionThresholdBytes != 512 {
+		t.Fatalf("Gateway.OpenAIWS.IngressCompressionThresholdBytes = %d, want 512", cfg.Gateway.OpenAIWS.IngressCompressionThresholdBytes)
+	}
+	if len(cfg.Gateway.OpenAIWS.ForwardClientHeaders) != 0 {
+		t.Fatalf("Gateway.OpenAIWS.ForwardClientHeaders = %v, want empty", cfg.Gateway.OpenAIWS.ForwardClientHeaders)
+	}
+	if len(cfg.Gateway.OpenAIWS.AccountRequestRewrites) != 0 {
+		t.Fatalf("Gateway.OpenAIWS.AccountRequestRewrites = %v, want empty", cfg.Gateway.OpenAIWS.AccountRequestRewrites)
+	}
+	if len(cfg.Gateway.OpenAIWS.ModelDefaultParams) != 0 {
+		t.Fatalf("Gateway.OpenAIWS.ModelDefaultParams = %v, want empty", cfg.Gateway.OpenAIWS.ModelDefaultParams)
+	}
+	if len(cfg.Gateway.OpenAIWS.IngressModeGroupDefaults) != 0 {
+		t.Fatalf("Gateway.OpenAIWS.IngressModeGroupDefaults = %v, want empty", cfg.Gateway.OpenAIWS.IngressModeGroupDefaults)
+	}
+	if len(cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerGroupOverrides) != 0 {
+		t.Fatalf("Gateway.OpenAIWS.SchedulerCircuitBreakerGroupOverrides = %v, want empty", cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerGroupOverrides)
+	}
+	if cfg.Gateway.OpenAIWS.IngressStaleFunctionCallOutputPolicy != "off" {
+		t.Fatalf("Gateway.OpenAIWS.IngressStaleFunctionCallOutputPolicy = %q, want off", cfg.Gateway.OpenAIWS.IngressStaleFunctionCallOutputPolicy)
+	}
+	if cfg.Gateway.OpenAIWS.IngressStoreDisabledFullInputPolicy != "auto" {
+		t.Fatalf("Gateway.OpenAIWS.IngressStoreDisabledFullInputPolicy = %q, want auto", cfg.Gateway.OpenAIWS.IngressStoreDisabledFullInputPolicy)
+	}
+	if cfg.Gateway.OpenAIWS.IngressMidTurnReconnectMode != "off" {
+		t.Fatalf("Gateway.OpenAIWS.IngressMidTurnReconnectMode = %q, want off", cfg.Gateway.OpenAIWS.IngressMidTurnReconnectMode)
+	}
+	if cfg.Gateway.OpenAIWS.ReselectAccountOnContinuityBreak {
+		t.Fatalf("Gateway.OpenAIWS.ReselectAccountOnContinuityBreak = true, want false")
+	}
+	if cfg.Gateway.OpenAIWS.ModelChangeForcesReselect {
+		t.Fatalf("Gateway.OpenAIWS.ModelChangeForcesReselect = true, want false")
+	}
+	if cfg.Gateway.OpenAIWS.IngressStreamConsistencyPolicy != "off" {
+		t.Fatalf("Gateway.OpenAIWS.IngressStreamConsistencyPolicy = %q, want off", cfg.Gateway.OpenAIWS.IngressStreamConsistencyPolicy)
+	}
+	if cfg.Gateway.OpenAIWS.IngressDuplicateKeyPolicy != "off" {
+		t.Fatalf("Gateway.OpenAIWS.IngressDuplicateKeyPolicy = %q, want off", cfg.Gateway.OpenAIWS.IngressDuplicateKeyPolicy)
+	}
+	if cfg.Gateway.OpenAIWS.IngressRequireSessionID {
+		t.Fatalf("Gateway.OpenAIWS.IngressRequireSessionID = true, want false")
+	}
+	if cfg.Gateway.OpenAIWS.ShadowAccountID != 0 {
+		t.Fatalf("Gateway.OpenAIWS.ShadowAccountID = %d, want 0", cfg.Gateway.OpenAIWS.ShadowAccountID)
+	}
+	if cfg.Gateway.OpenAIWS.ShadowSampleRatio != 0 {
+		t.Fatalf("Gateway.OpenAIWS.ShadowSampleRatio = %v, want 0", cfg.Gateway.OpenAIWS.ShadowSampleRatio)
+	}
+	if len(cfg.Gateway.OpenAIWS.CanaryAccountIDs) != 0 || cfg.Gateway.OpenAIWS.CanaryTrafficRatio != 0 {
+		t.Fatalf("Gateway.OpenAIWS canary = %v/%v, want disabled", cfg.Gateway.OpenAIWS.CanaryAccountIDs, cfg.Gateway.OpenAIWS.CanaryTrafficRatio)
+	}
+	if cfg.Gateway.OpenAIWS.CanaryErrorRateThreshold != 0.2 || cfg.Gateway.OpenAIWS.CanaryWindowSeconds != 300 || cfg.Gateway.OpenAIWS.CanaryMinRequests != 20 {
+		t.Fatalf("Gateway.OpenAIWS canary rollback = %v/%d/%d, want 0.2/300/20", cfg.Gateway.OpenAIWS.CanaryErrorRateThreshold, cfg.Gateway.OpenAIWS.CanaryWindowSeconds, cfg.Gateway.OpenAIWS.CanaryMinRequests)
+	}
+	if cfg.Gateway.OpenAIWS.ConnIdleTimeoutSeconds != 0 {
+		t.Fatalf("Gateway.OpenAIWS.ConnIdleTimeoutSeconds = %d, want 0", cfg.Gateway.OpenAIWS.ConnIdleTimeoutSeconds)
+	}
+	if cfg.Gateway.OpenAIWS.LeaseLeakThresholdSeconds != 0 {
+		t.Fatalf("Gateway.OpenAIWS.LeaseLeakThresholdSeconds = %d, want 0", cfg.Gateway.OpenAIWS.LeaseLeakThresholdSeconds)
+	}
+	if cfg.Gateway.OpenAIWS.SchedulerZeroConcurrencyMode != "unbounded" || cfg.Gateway.OpenAIWS.SchedulerAssumedConcurrency != 4 {
+		t.Fatalf("Gateway.OpenAIWS zero concurrency = (%q,%d), want (unbounded,4)", cfg.Gateway.OpenAIWS.SchedulerZeroConcurrencyMode, cfg.Gateway.OpenAIWS.SchedulerAssumedConcurrency)
+	}
+	if cfg.Gateway.OpenAIWS.SchedulerCandidatePrefilterThreshold != 0 || cfg.Gateway.OpenAIWS.SchedulerCandidatePrefilterSize != 32 {
+		t.Fatalf("Gateway.OpenAIWS candidate prefilter = (%d,%d), want (0,32)", cfg.Gateway.OpenAIWS.SchedulerCandidatePrefilterThreshold, cfg.Gateway.OpenAIWS.SchedulerCandidatePrefilterSize)
+	}
+	if cfg.Gateway.OpenAIWS.SchedulerRuntimeStatsReplicaIntervalMS != 0 {
+		t.Fatalf("Gateway.OpenAIWS.SchedulerRuntimeStatsReplicaIntervalMS = %d, want 0", cfg.Gateway.OpenAIWS.SchedulerRuntimeStatsReplicaIntervalMS)
+	}
+	if cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerWarmupSeconds != 0 {
+		t.Fatalf("Gateway.OpenAIWS.SchedulerCircuitBreakerWarmupSeconds = %d, want 0", cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerWarmupSeconds)
+	}
+	if cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerAutoDisableTrips != 0 {
+		t.Fatalf("Gateway.OpenAIWS.SchedulerCircuitBreakerAutoDisableTrips = %d, want 0", cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerAutoDisableTrips)
+	}
+	if cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerAutoDisableWindowSeconds != 3600 {
+		t.Fatalf("Gateway.OpenAIWS.SchedulerCircuitBreakerAutoDisableWindowSeconds = %d, want 3600", cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerAutoDisableWindowSeconds)
+	}
+	if cfg.Gateway.OpenAIWS.SchedulerHalfOpenProbeStrategy != "all" {
+		t.Fatalf("Gateway.OpenAIWS.SchedulerHalfOpenProbeStrategy = %q, want all", cfg.Gateway.OpenAIWS.SchedulerHalfOpenProbeStrategy)
+	}
+	if cfg.Gateway.OpenAIWS.SchedulerMinScoreThreshold != 0 {
+		t.Fatalf("Gateway.OpenAIWS.SchedulerMinScoreThreshold = %v, want 0", cfg.Gateway.OpenAIWS.SchedulerMinScoreThreshold)
+	}
+	if cfg.Gateway.OpenAIWS.SchedulerErrorRateEWMAAlpha != 0.2 || cfg.Gateway.OpenAIWS.SchedulerTTFTEWMAAlpha != 0.2 {
+		t.Fatalf("Gateway.OpenAIWS EWMA alphas = %v/%v, want 0.2/0.2", cfg.Gateway.OpenAIWS.SchedulerErrorRateEWMAAlpha, cfg.Gateway.OpenAIWS.SchedulerTTFTEWMAAlpha)
+	}
+	if len(cfg.Gateway.OpenAIWS.SchedulerTransportFallbackGroupIDs) != 0 {
+		t.Fatalf("Gateway.OpenAIWS.SchedulerTransportFallbackGroupIDs = %v, want empty", cfg.Gateway.OpenAIWS.SchedulerTransportFallbackGroupIDs)
+	}
+	if cfg.Gateway.OpenAIWS.SchedulerDecisionEventBufferSize != 1024 || cfg.Gateway.OpenAIWS.SchedulerDecisionEventSampleRate != 1.0 {
+		t.Fatalf("Gateway.OpenAIWS decision event = (%d,%v), want (1024,1)", cfg.Gateway.OpenAIWS.SchedulerDecisionEventBufferSize, cfg.Gateway.OpenAIWS.SchedulerDecisionEventSampleRate)
+	}
+	if cfg.Gateway.OpenAIWS.SchedulerStateDumpPath != "" || cfg.Gateway.OpenAIWS.SchedulerStateDumpIntervalSeconds != 0 {
+		t.Fatalf("Gateway.OpenAIWS state dump = (%q,%d), want (\"\",0)", cfg.Gateway.OpenAIWS.SchedulerStateDumpPath, cfg.Gateway.OpenAIWS.SchedulerStateDumpIntervalSeconds)
+	}
+	if cfg.Gateway.OpenAIWS.MetricsListenAddr != "" || cfg.Gateway.OpenAIWS.MetricsMaxAccounts != 100 {
+		t.Fatalf("Gateway.OpenAIWS metrics = (%q,%d), want (\"\",100)", cfg.Gateway.OpenAIWS.MetricsListenAddr, cfg.Gateway.OpenAIWS.MetricsMaxAccounts)
+	}
+	if cfg.Gateway.OpenAIWS.SessionHandoffPath != "" || cfg.Gateway.OpenAIWS.SessionHandoffMaxAgeSeconds != 120 {
+		t.Fatalf("Gateway.OpenAIWS session handoff = (%q,%d), want (\"\",120)", cfg.Gateway.OpenAIWS.SessionHandoffPath, cfg.Gateway.OpenAIWS.SessionHandoffMaxAgeSeconds)
+	}
+	if cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerFailThreshold != 5 {
+		t.Fatalf("Gateway.OpenAIWS.SchedulerCircuitBreakerFailThreshold = %d, want 5", cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerFailThreshold)
+	}
+	if cfg.Gateway.OpenAIWS.IngressStreamHeartbeatIntervalMS != 0 {
+		t.Fatalf("Gateway.OpenAIWS.IngressStreamHeartbeatIntervalMS = %d, want 0", cfg.Gateway.OpenAIWS.IngressStreamHeartbeatIntervalMS)
+	}
+	if cfg.Gateway.OpenAIWS.IngressDownstreamBufferSize != 0 {
+		t.Fatalf("Gateway.OpenAIWS.IngressDownstreamBufferSize = %d, want 0", cfg.Gateway.OpenAIWS.IngressDownstreamBufferSize)
+	}
+	if cfg.Gateway.OpenAIWS.IngressSlowClientPolicy != "disconnect" {
+		t.Fatalf("Gateway.OpenAIWS.IngressSlowClientPolicy = %q, want disconnect", cfg.Gateway.OpenAIWS.IngressSlowClientPolicy)
+	}
+	if cfg.Gateway.OpenAIWS.ClientDisconnectDrainMaxConcurrency != 256 {
+		t.Fatalf("Gateway.OpenAIWS.ClientDisconnectDrainMaxConcurrency = %d, want 256", cfg.Gateway.OpenAIWS.ClientDisconnectDrainMaxConcurrency)
+	}
+	if cfg.Gateway.OpenAIWS.InjectGatewayTurnID {
+		t.Fatalf("Gateway.OpenAIWS.InjectGatewayTurnID = true, want false")
+	}
+	if cfg.Gateway.OpenAIWS.SchedulerScoreWeights.PrevNotFound != 0.6 {
+		t.Fatalf("Gateway.OpenAIWS.SchedulerScoreWeights.PrevNotFound = %v, want 0.6", cfg.Gateway.OpenAIWS.SchedulerScoreWeights.PrevNotFound)
+	}
+	if cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Region != 1.0 {
+		t.Fatalf("Gateway.OpenAIWS.SchedulerScoreWeights.Region = %v, want 1.0", cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Region)
+	}
+	if cfg.Gateway.OpenAIWS.SchedulerRegionAffinityEnabled {
+		t.Fatalf("Gateway.OpenAIWS.SchedulerRegionAffinityEnabled = true, want false")
+	}
+	if cfg.Gateway.OpenAIWS.SchedulerRegionHeader != "X-Client-Region" {
+		t.Fatalf("Gateway.OpenAIWS.SchedulerRegionHeader = %q, want X-Client-Region", cfg.Gateway.OpenAIWS.SchedulerRegionHeader)
+	}
+	if cfg.Gateway.OpenAIWS.RequestTimeoutOverrideMinSeconds != 1 || cfg.Gateway.OpenAIWS.RequestTimeoutOverrideMaxSeconds != 1800 {
+		t.Fatalf("Gateway.OpenAIWS.RequestTimeoutOverride bounds = [%d,%d], want [1,1800]", cfg.Gateway.OpenAIWS.RequestTimeoutOverrideMinSeconds, cfg.Gateway.OpenAIWS.RequestTimeoutOverrideMaxSeconds)
+	}
+	if cfg.Gateway.OpenAIWS.IngressSessionCaptureDir != "" {
+		t.Fatalf("Gateway.OpenAIWS.IngressSessionCaptureDir = %q, want empty", cfg.Gateway.OpenAIWS.IngressSessionCaptureDir)
+	}
+	if cfg.Gateway.OpenAIWS.IngressSessionCaptureRecentMax != 0 {
+		t.Fatalf("Gateway.OpenAIWS.IngressSessionCaptureRecentMax = %d, want 0", cfg.Gateway.OpenAIWS.IngressSessionCaptureRecentMax)
+	}
+	if cfg.Gateway.OpenAIWS.MaxFullCreateReplaysPerSession != 8 {
+		t.Fatalf("Gateway.OpenAIWS.MaxFullCreateReplaysPerSession = %d, want 8", cfg.Gateway.OpenAIWS.MaxFullCreateReplaysPerSession)
+	}
+	if cfg.Gateway.OpenAIWS.ReplayInputDedupeConsecutive {
+		t.Fatalf("Gateway.OpenAIWS.ReplayInputDedupeConsecutive = true, want false")
+	}
+	if cfg.Gateway.OpenAIWS.ReplayInputFunctionCallOutputMerge != "append" {
+		t.Fatalf("Gateway.OpenAIWS.ReplayInputFunctionCallOutputMerge = %q, want %q", cfg.Gateway.OpenAIWS.ReplayInputFunctionCallOutputMerge, "append")
+	}
+	if cfg.Gateway.OpenAIWS.MaxReplayInputBytes != 32*1024*1024 {
+		t.Fatalf("Gateway.OpenAIWS.MaxReplayInputBytes = %d, want %d", cfg.Gateway.OpenAIWS.MaxReplayInputBytes, 32*1024*1024)
+	}
+	if cfg.Gateway.OpenAIWS.MaxConcurrentRecoveryReconnects != 0 {
+		t.Fatalf("Gateway.OpenAIWS.MaxConcurrentRecoveryReconnects = %d, want 0", cfg.Gateway.OpenAIWS.MaxConcurrentRecoveryReconnects)
+	}
 	if cfg.Gateway.OpenAIWS.FallbackCooldownSeconds != 30 {
 		t.Fatalf("Gateway.OpenAIWS.FallbackCooldownSeconds = %d, want 30", cfg.Gateway.OpenAIWS.FallbackCooldownSeconds)
 	}
@@ -156,6 +366,12 @@ func TestLoadDefaultOpenAIWSConfig(t *testing.T) {
 	if cfg.Gateway.OpenAIWS.IngressModeDefault != "ctx_pool" {
 		t.Fatalf("Gateway.OpenAIWS.IngressModeDefault = %q, want %q", cfg.Gateway.OpenAIWS.IngressModeDefault, "ctx_pool")
 	}
+	if cfg.Gateway.OpenAIWS.ModelTransportPolicy != "downgrade" {
+		t.Fatalf("Gateway.OpenAIWS.ModelTransportPolicy = %q, want %q", cfg.Gateway.OpenAIWS.ModelTransportPolicy, "downgrade")
+	}
+	if len(cfg.Gateway.OpenAIWS.ModelTransports) != 0 {
+		t.Fatalf("Gateway.OpenAIWS.ModelTransports = %v, want empty", cfg.Gateway.OpenAIWS.ModelTransports)
+	}
 }
 
 func TestLoadOpenAIWSStickyTTLCompatibility(t *testing.T) {
@@ -1357,6 +1573,16 @@ func TestValidateConfig_OpenAIWSRules(t *testing.T) {
 			},
 			wantErr: "gateway.openai_ws.max_idle_per_account must be <= max_conns_per_account",
 		},
+		{
+			name:    "conn_idle_timeout_seconds 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.ConnIdleTimeoutSeconds = -1 },
+			wantErr: "gateway.openai_ws.conn_idle_timeout_seconds must be non-negative",
+		},
+		{
+			name:    "lease_leak_threshold_seconds 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.LeaseLeakThresholdSeconds = -1 },
+			wantErr: "gateway.openai_ws.lease_leak_threshold_seconds must be non-negative",
+		},
 		{
 			name:    "dial_timeout_seconds 必须为正数",
 			mutate:  func(c *Config) { c.Gateway.OpenAIWS.DialTimeoutSeconds = 0 },
@@ -1397,6 +1623,25 @@ func TestValidateConfig_OpenAIWSRules(t *testing.T) {
 			mutate:  func(c *Config) { c.Gateway.OpenAIWS.IngressModeDefault = "invalid" },
 			wantErr: "gateway.openai_ws.ingress_mode_default",
 		},
+		{
+			name: "model_transports 模型名不能为空",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.ModelTransports = []GatewayOpenAIWSModelTransport{{Model: " ", Transport: "http"}}
+			},
+			wantErr: "gateway.openai_ws.model_transports[0].model must not be empty",
+		},
+		{
+			name: "model_transports 传输协议必须为 http|any",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.ModelTransports = []GatewayOpenAIWSModelTransport{{Model: "gpt-image-*", Transport: "ws"}}
+			},
+			wantErr: "gateway.openai_ws.model_transports[0].transport must be one of http|any",
+		},
+		{
+			name:    "model_transport_policy 必须为 downgrade|reject",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.ModelTransportPolicy = "drop" },
+			wantErr: "gateway.openai_ws.model_transport_policy must be one of downgrade|reject",
+		},
 		{
 			name:    "payload_log_sample_rate 必须在 [0,1] 范围内",
 			mutate:  func(c *Config) { c.Gateway.OpenAIWS.PayloadLogSampleRate = 1.2 },
@@ -1417,6 +1662,325 @@ func TestValidateConfig_OpenAIWSRules(t *testing.T) {
 			mutate:  func(c *Config) { c.Gateway.OpenAIWS.StickySessionTTLSeconds = 0 },
 			wantErr: "gateway.openai_ws.sticky_session_ttl_seconds",
 		},
+		{
+			name:    "sticky_sessions_per_account_max 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.StickySessionsPerAccountMax = -1 },
+			wantErr: "gateway.openai_ws.sticky_sessions_per_account_max must be non-negative",
+		},
+		{
+			name:    "sticky_ttl_skew_sample_rate 必须在 [0,1]",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.StickyTTLSkewSampleRate = 1.5 },
+			wantErr: "gateway.openai_ws.sticky_ttl_skew_sample_rate must be within [0,1]",
+		},
+		{
+			name:    "sticky_ttl_skew_alert_ratio 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.StickyTTLSkewAlertRatio = -0.1 },
+			wantErr: "gateway.openai_ws.sticky_ttl_skew_alert_ratio must be non-negative",
+		},
+		{
+			name:    "api_key_sticky_window_seconds 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.APIKeyStickyWindowSeconds = -1 },
+			wantErr: "gateway.openai_ws.api_key_sticky_window_seconds",
+		},
+		{
+			name:    "max_full_create_replays_per_session 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.MaxFullCreateReplaysPerSession = -1 },
+			wantErr: "gateway.openai_ws.max_full_create_replays_per_session",
+		},
+		{
+			name:    "max_replay_input_bytes 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.MaxReplayInputBytes = -1 },
+			wantErr: "gateway.openai_ws.max_replay_input_bytes must be non-negative",
+		},
+		{
+			name:    "replay_input_function_call_output_merge 必须为 append/replace",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.ReplayInputFunctionCallOutputMerge = "dedupe" },
+			wantErr: "gateway.openai_ws.replay_input_function_call_output_merge must be one of append/replace",
+		},
+		{
+			name:    "max_concurrent_recovery_reconnects 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.MaxConcurrentRecoveryReconnects = -1 },
+			wantErr: "gateway.openai_ws.max_concurrent_recovery_reconnects must be non-negative",
+		},
+		{
+			name: "forward_client_headers 头名非法",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.ForwardClientHeaders = map[string]string{"bad header": ""}
+			},
+			wantErr: "gateway.openai_ws.forward_client_headers has invalid header name",
+		},
+		{
+			name: "forward_client_headers 不能写入鉴权头",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.ForwardClientHeaders = map[string]string{"x-client-auth": "Authorization"}
+			},
+			wantErr: "gateway.openai_ws.forward_client_headers cannot forward to protected header",
+		},
+		{
+			name: "forward_client_headers 不能写入握手头",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.ForwardClientHeaders = map[string]string{"sec-websocket-protocol": ""}
+			},
+			wantErr: "gateway.openai_ws.forward_client_headers cannot forward to protected header",
+		},
+		{
+			name: "ingress_mode_group_defaults group_id 必须为正数",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.IngressModeGroupDefaults = []GatewayOpenAIWSIngressModeGroupDefault{{GroupID: 0, Mode: "off"}}
+			},
+			wantErr: "gateway.openai_ws.ingress_mode_group_defaults[0].group_id must be positive",
+		},
+		{
+			name: "ingress_mode_group_defaults group_id 不能重复",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.IngressModeGroupDefaults = []GatewayOpenAIWSIngressModeGroupDefault{{GroupID: 3, Mode: "off"}, {GroupID: 3, Mode: "passthrough"}}
+			},
+			wantErr: "gateway.openai_ws.ingress_mode_group_defaults[1].group_id 3 is duplicated",
+		},
+		{
+			name: "ingress_mode_group_defaults mode 必须为 off|ctx_pool|passthrough",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.IngressModeGroupDefaults = []GatewayOpenAIWSIngressModeGroupDefault{{GroupID: 3, Mode: "dedicated"}}
+			},
+			wantErr: "gateway.openai_ws.ingress_mode_group_defaults[0].mode must be one of off|ctx_pool|passthrough",
+		},
+		{
+			name:    "ingress_required_header 必须为合法请求头名",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.IngressRequiredHeader = "x internal token" },
+			wantErr: "gateway.openai_ws.ingress_required_header must be a valid header name",
+		},
+		{
+			name:    "ingress_required_header_value 需要配合 ingress_required_header",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.IngressRequiredHeaderValue = "secret" },
+			wantErr: "gateway.openai_ws.ingress_required_header must be set when ingress_required_header_value is set",
+		},
+		{
+			name:    "ingress_session_create_per_minute 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.IngressSessionCreatePerMinute = -1 },
+			wantErr: "gateway.openai_ws.ingress_session_create_per_minute must be non-negative",
+		},
+		{
+			name:    "ingress_session_create_burst 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.IngressSessionCreateBurst = -1 },
+			wantErr: "gateway.openai_ws.ingress_session_create_burst must be non-negative",
+		},
+		{
+			name:    "first_message_timeout_seconds 必须为正数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.FirstMessageTimeoutSeconds = 0 },
+			wantErr: "gateway.openai_ws.first_message_timeout_seconds must be positive",
+		},
+		{
+			name:    "ingress_compression_threshold_bytes 必须为正数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.IngressCompressionThresholdBytes = 0 },
+			wantErr: "gateway.openai_ws.ingress_compression_threshold_bytes must be positive",
+		},
+		{
+			name: "scheduler_circuit_breaker_group_overrides group_id 必须为正数",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.SchedulerCircuitBreakerGroupOverrides = []GatewayOpenAIWSCircuitBreakerGroupOverride{{GroupID: 0, FailThreshold: 2}}
+			},
+			wantErr: "gateway.openai_ws.scheduler_circuit_breaker_group_overrides[0].group_id must be positive",
+		},
+		{
+			name: "scheduler_circuit_breaker_group_overrides group_id 不能重复",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.SchedulerCircuitBreakerGroupOverrides = []GatewayOpenAIWSCircuitBreakerGroupOverride{{GroupID: 3}, {GroupID: 3}}
+			},
+			wantErr: "gateway.openai_ws.scheduler_circuit_breaker_group_overrides[1].group_id 3 is duplicated",
+		},
+		{
+			name: "scheduler_circuit_breaker_group_overrides fail_threshold 不能为负数",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.SchedulerCircuitBreakerGroupOverrides = []GatewayOpenAIWSCircuitBreakerGroupOverride{{GroupID: 3, FailThreshold: -1}}
+			},
+			wantErr: "gateway.openai_ws.scheduler_circuit_breaker_group_overrides[0].fail_threshold must be non-negative",
+		},
+		{
+			name: "account_request_rewrites account_id 必须为正数",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.AccountRequestRewrites = []GatewayOpenAIWSAccountRequestRewrite{{AccountID: 0}}
+			},
+			wantErr: "gateway.openai_ws.account_request_rewrites[0].account_id must be positive",
+		},
+		{
+			name: "account_request_rewrites account_id 不能重复",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.AccountRequestRewrites = []GatewayOpenAIWSAccountRequestRewrite{{AccountID: 7}, {AccountID: 7}}
+			},
+			wantErr: "gateway.openai_ws.account_request_rewrites[1].account_id 7 is duplicated",
+		},
+		{
+			name: "account_request_rewrites 路径非法",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.AccountRequestRewrites = []GatewayOpenAIWSAccountRequestRewrite{{
+					AccountID: 7,
+					Rules:     []GatewayOpenAIWSRequestRewriteRule{{Op: "remove", Path: "tools.#.name"}},
+				}}
+			},
+			wantErr: "gateway.openai_ws.account_request_rewrites[0].rules[0].path must be dot-separated field names",
+		},
+		{
+			name: "account_request_rewrites 不能改写受保护字段",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.AccountRequestRewrites = []GatewayOpenAIWSAccountRequestRewrite{{
+					AccountID: 7,
+					Rules:     []GatewayOpenAIWSRequestRewriteRule{{Op: "set", Path: "model", Value: "gpt-5.1"}},
+				}}
+			},
+			wantErr: "gateway.openai_ws.account_request_rewrites[0].rules[0].path cannot rewrite protected field \"model\"",
+		},
+		{
+			name: "account_request_rewrites set 必须提供 value",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.AccountRequestRewrites = []GatewayOpenAIWSAccountRequestRewrite{{
+					AccountID: 7,
+					Rules:     []GatewayOpenAIWSRequestRewriteRule{{Op: "set", Path: "service_tier"}},
+				}}
+			},
+			wantErr: "gateway.openai_ws.account_request_rewrites[0].rules[0].value is required for set",
+		},
+		{
+			name: "account_request_rewrites op 非法",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.AccountRequestRewrites = []GatewayOpenAIWSAccountRequestRewrite{{
+					AccountID: 7,
+					Rules:     []GatewayOpenAIWSRequestRewriteRule{{Op: "append", Path: "service_tier"}},
+				}}
+			},
+			wantErr: "gateway.openai_ws.account_request_rewrites[0].rules[0].op must be one of set|remove",
+		},
+		{
+			name: "model_default_params model 不能为空",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.ModelDefaultParams = []GatewayOpenAIWSModelDefaultParams{{Model: " "}}
+			},
+			wantErr: "gateway.openai_ws.model_default_params[0].model must not be empty",
+		},
+		{
+			name: "model_default_params model 不能重复",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.ModelDefaultParams = []GatewayOpenAIWSModelDefaultParams{{Model: "gpt-5*"}, {Model: "GPT-5*"}}
+			},
+			wantErr: "gateway.openai_ws.model_default_params[1].model \"GPT-5*\" is duplicated",
+		},
+		{
+			name: "model_default_params 不能设置受保护字段",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.ModelDefaultParams = []GatewayOpenAIWSModelDefaultParams{{
+					Model:  "gpt-5.1",
+					Params: []GatewayOpenAIWSModelDefaultParam{{Path: "stream", Value: false}},
+				}}
+			},
+			wantErr: "gateway.openai_ws.model_default_params[0].params[0].path cannot set protected field \"stream\"",
+		},
+		{
+			name: "model_default_params 路径不能重复",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.ModelDefaultParams = []GatewayOpenAIWSModelDefaultParams{{
+					Model: "gpt-5.1",
+					Params: []GatewayOpenAIWSModelDefaultParam{
+						{Path: "reasoning.effort", Value: "medium"},
+						{Path: " reasoning.effort ", Value: "high"},
+					},
+				}}
+			},
+			wantErr: "gateway.openai_ws.model_default_params[0].params[1].path \"reasoning.effort\" is duplicated",
+		},
+		{
+			name: "model_default_params 必须提供 value",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.ModelDefaultParams = []GatewayOpenAIWSModelDefaultParams{{
+					Model:  "gpt-5.1",
+					Params: []GatewayOpenAIWSModelDefaultParam{{Path: "reasoning.effort"}},
+				}}
+			},
+			wantErr: "gateway.openai_ws.model_default_params[0].params[0].value is required",
+		},
+		{
+			name:    "ingress_stale_function_call_output_policy 非法",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.IngressStaleFunctionCallOutputPolicy = "retry" },
+			wantErr: "gateway.openai_ws.ingress_stale_function_call_output_policy must be one of off/drop/full_create",
+		},
+		{
+			name:    "ingress_store_disabled_full_input_policy 非法",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.IngressStoreDisabledFullInputPolicy = "merge" },
+			wantErr: "gateway.openai_ws.ingress_store_disabled_full_input_policy must be one of auto/incremental/full_create",
+		},
+		{
+			name:    "ingress_mid_turn_reconnect_mode 非法",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.IngressMidTurnReconnectMode = "restart" },
+			wantErr: "gateway.openai_ws.ingress_mid_turn_reconnect_mode must be one of off/resume/reset",
+		},
+		{
+			name:    "ingress_stream_consistency_policy 非法",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.IngressStreamConsistencyPolicy = "strict" },
+			wantErr: "gateway.openai_ws.ingress_stream_consistency_policy must be one of off/reject/coerce",
+		},
+		{
+			name:    "ingress_duplicate_key_policy 非法",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.IngressDuplicateKeyPolicy = "first_wins" },
+			wantErr: "gateway.openai_ws.ingress_duplicate_key_policy must be one of off/reject/last_wins",
+		},
+		{
+			name:    "shadow_account_id 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.ShadowAccountID = -1 },
+			wantErr: "gateway.openai_ws.shadow_account_id must be non-negative",
+		},
+		{
+			name:    "shadow_sample_ratio 超出范围",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.ShadowSampleRatio = 1.5 },
+			wantErr: "gateway.openai_ws.shadow_sample_ratio must be within [0,1]",
+		},
+		{
+			name:    "shadow_sample_ratio 开启时必须配置 shadow_account_id",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.ShadowSampleRatio = 0.1 },
+			wantErr: "gateway.openai_ws.shadow_account_id is required when shadow_sample_ratio > 0",
+		},
+		{
+			name:    "canary_account_ids 必须为正数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.CanaryAccountIDs = []int64{0} },
+			wantErr: "gateway.openai_ws.canary_account_ids must contain positive account ids",
+		},
+		{
+			name:    "canary_traffic_ratio 开启时必须配置 canary_account_ids",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.CanaryTrafficRatio = 0.05 },
+			wantErr: "gateway.openai_ws.canary_account_ids is required when canary_traffic_ratio > 0",
+		},
+		{
+			name:    "canary_error_rate_threshold 必须在 (0,1] 内",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.CanaryErrorRateThreshold = 0 },
+			wantErr: "gateway.openai_ws.canary_error_rate_threshold must be within (0,1]",
+		},
+		{
+			name:    "canary_window_seconds 必须为正数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.CanaryWindowSeconds = 0 },
+			wantErr: "gateway.openai_ws.canary_window_seconds must be positive",
+		},
+		{
+			name:    "ingress_session_capture_recent_max 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.IngressSessionCaptureRecentMax = -1 },
+			wantErr: "gateway.openai_ws.ingress_session_capture_recent_max must be non-negative",
+		},
+		{
+			name:    "ingress_stream_heartbeat_interval_ms 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.IngressStreamHeartbeatIntervalMS = -1 },
+			wantErr: "gateway.openai_ws.ingress_stream_heartbeat_interval_ms",
+		},
+		{
+			name:    "ingress_downstream_buffer_size 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.IngressDownstreamBufferSize = -1 },
+			wantErr: "gateway.openai_ws.ingress_downstream_buffer_size must be non-negative",
+		},
+		{
+			name:    "ingress_slow_client_policy 非法",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.IngressSlowClientPolicy = "block" },
+			wantErr: "gateway.openai_ws.ingress_slow_client_policy must be one of disconnect/drop_deltas",
+		},
+		{
+			name:    "client_disconnect_drain_max_concurrency 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.ClientDisconnectDrainMaxConcurrency = -1 },
+			wantErr: "gateway.openai_ws.client_disconnect_drain_max_concurrency must be non-negative",
+		},
 		{
 			name: "sticky_response_id_ttl_seconds 必须为正数",
 			mutate: func(c *Config) {
@@ -1425,6 +1989,16 @@ func TestValidateConfig_OpenAIWSRules(t *testing.T) {
 			},
 			wantErr: "gateway.openai_ws.sticky_response_id_ttl_seconds",
 		},
+		{
+			name:    "session_response_max_age_seconds 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.SessionResponseMaxAgeSeconds = -1 },
+			wantErr: "gateway.openai_ws.session_response_max_age_seconds must be non-negative",
+		},
+		{
+			name:    "state_store_failure_mode 必须为 open|closed",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.StateStoreFailureMode = "retry" },
+			wantErr: "gateway.openai_ws.state_store_failure_mode must be one of open|closed",
+		},
 		{
 			name:    "sticky_previous_response_ttl_seconds 不能为负数",
 			mutate:  func(c *Config) { c.Gateway.OpenAIWS.StickyPreviousResponseTTLSeconds = -1 },
@@ -1435,6 +2009,29 @@ func TestValidateConfig_OpenAIWSRules(t *testing.T) {
 			mutate:  func(c *Config) { c.Gateway.OpenAIWS.SchedulerScoreWeights.Queue = -0.1 },
 			wantErr: "gateway.openai_ws.scheduler_score_weights.* must be non-negative",
 		},
+		{
+			name:    "request_timeout_override_min_seconds 必须为正数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.RequestTimeoutOverrideMinSeconds = 0 },
+			wantErr: "gateway.openai_ws.request_timeout_override_min_seconds must be positive",
+		},
+		{
+			name: "request_timeout_override_max_seconds 不能小于 min",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.RequestTimeoutOverrideMinSeconds = 60
+				c.Gateway.OpenAIWS.RequestTimeoutOverrideMaxSeconds = 30
+			},
+			wantErr: "gateway.openai_ws.request_timeout_override_max_seconds must be >= request_timeout_override_min_seconds",
+		},
+		{
+			name:    "scheduler_score_weights.prev_not_found 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.SchedulerScoreWeights.PrevNotFound = -0.1 },
+			wantErr: "gateway.openai_ws.scheduler_score_weights.* must be non-negative",
+		},
+		{
+			name:    "scheduler_score_weights.region 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.SchedulerScoreWeights.Region = -1 },
+			wantErr: "gateway.openai_ws.scheduler_score_weights.* must be non-negative",
+		},
 		{
 			name: "scheduler_score_weights 不能全为 0",
 			mutate: func(c *Config) {
@@ -1446,6 +2043,176 @@ func TestValidateConfig_OpenAIWSRules(t *testing.T) {
 			},
 			wantErr: "gateway.openai_ws.scheduler_score_weights must not all be zero",
 		},
+		{
+			name: "scheduler_circuit_breaker_fail_threshold 启用时必须为正数",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.SchedulerCircuitBreakerEnabled = true
+				c.Gateway.OpenAIWS.SchedulerCircuitBreakerFailThreshold = 0
+			},
+			wantErr: "gateway.openai_ws.scheduler_circuit_breaker_fail_threshold",
+		},
+		{
+			name: "scheduler_circuit_breaker_cooldown_seconds 启用时必须为正数",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.SchedulerCircuitBreakerEnabled = true
+				c.Gateway.OpenAIWS.SchedulerCircuitBreakerCooldownSeconds = 0
+			},
+			wantErr: "gateway.openai_ws.scheduler_circuit_breaker_cooldown_seconds",
+		},
+		{
+			name: "scheduler_circuit_breaker_half_open_max 启用时必须为正数",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.SchedulerCircuitBreakerEnabled = true
+				c.Gateway.OpenAIWS.SchedulerCircuitBreakerHalfOpenMax = 0
+			},
+			wantErr: "gateway.openai_ws.scheduler_circuit_breaker_half_open_max",
+		},
+		{
+			name:    "scheduler_circuit_breaker_warmup_seconds 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.SchedulerCircuitBreakerWarmupSeconds = -1 },
+			wantErr: "gateway.openai_ws.scheduler_circuit_breaker_warmup_seconds must be non-negative",
+		},
+		{
+			name:    "scheduler_circuit_breaker_auto_disable_trips 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.SchedulerCircuitBreakerAutoDisableTrips = -1 },
+			wantErr: "gateway.openai_ws.scheduler_circuit_breaker_auto_disable_trips must be non-negative",
+		},
+		{
+			name: "开启自动禁用时 scheduler_circuit_breaker_auto_disable_window_seconds 必须为正数",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.SchedulerCircuitBreakerAutoDisableTrips = 3
+				c.Gateway.OpenAIWS.SchedulerCircuitBreakerAutoDisableWindowSeconds = 0
+			},
+			wantErr: "gateway.openai_ws.scheduler_circuit_breaker_auto_disable_window_seconds must be positive",
+		},
+		{
+			name:    "scheduler_half_open_probe_strategy 必须为合法值",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.SchedulerHalfOpenProbeStrategy = "random" },
+			wantErr: "gateway.openai_ws.scheduler_half_open_probe_strategy",
+		},
+		{
+			name: "billing.token_multipliers 倍率不能为负数",
+			mutate: func(c *Config) {
+				negative := -0.5
+				c.Billing.TokenMultipliers = []BillingTokenMultiplierConfig{{Model: "gpt-5.1", CacheRead: &negative}}
+			},
+			wantErr: "billing.token_multipliers[0].cache_read must be a non-negative finite number",
+		},
+		{
+			name: "billing.token_multipliers 模型不能重复",
+			mutate: func(c *Config) {
+				c.Billing.TokenMultipliers = []BillingTokenMultiplierConfig{{Model: "gpt-5.1"}, {Model: "GPT-5.1"}}
+			},
+			wantErr: "billing.token_multipliers[1].model",
+		},
+		{
+			name: "billing.token_multipliers 模型不能为空",
+			mutate: func(c *Config) {
+				c.Billing.TokenMultipliers = []BillingTokenMultiplierConfig{{Model: " "}}
+			},
+			wantErr: "billing.token_multipliers[0].model is required",
+		},
+		{
+			name:    "malformed_upstream_event_policy 必须为合法值",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.MalformedUpstreamEventPolicy = "ignore" },
+			wantErr: "gateway.openai_ws.malformed_upstream_event_policy must be one of drop/terminate",
+		},
+		{
+			name:    "usage_missing_policy 必须为合法值",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.UsageMissingPolicy = "free" },
+			wantErr: "gateway.openai_ws.usage_missing_policy must be one of unbilled/zero/estimate",
+		},
+		{
+			name:    "scheduler_max_consecutive_sticky_turns 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.SchedulerMaxConsecutiveStickyTurns = -1 },
+			wantErr: "gateway.openai_ws.scheduler_max_consecutive_sticky_turns must be non-negative",
+		},
+		{
+			name:    "scheduler_max_sticky_lifetime_seconds 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.SchedulerMaxStickyLifetimeSeconds = -1 },
+			wantErr: "gateway.openai_ws.scheduler_max_sticky_lifetime_seconds must be non-negative",
+		},
+		{
+			name:    "scheduler_candidate_prefilter_threshold 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.SchedulerCandidatePrefilterThreshold = -1 },
+			wantErr: "gateway.openai_ws.scheduler_candidate_prefilter_threshold must be non-negative",
+		},
+		{
+			name: "scheduler_candidate_prefilter_size 在开启预筛时必须为正数",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.SchedulerCandidatePrefilterThreshold = 100
+				c.Gateway.OpenAIWS.SchedulerCandidatePrefilterSize = 0
+			},
+			wantErr: "gateway.openai_ws.scheduler_candidate_prefilter_size must be positive when scheduler_candidate_prefilter_threshold is enabled",
+		},
+		{
+			name:    "scheduler_runtime_stats_replica_interval_ms 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.SchedulerRuntimeStatsReplicaIntervalMS = -1 },
+			wantErr: "gateway.openai_ws.scheduler_runtime_stats_replica_interval_ms must be non-negative",
+		},
+		{
+			name:    "scheduler_min_score_threshold 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.SchedulerMinScoreThreshold = -0.1 },
+			wantErr: "gateway.openai_ws.scheduler_min_score_threshold must be non-negative",
+		},
+		{
+			name:    "scheduler_error_rate_ewma_alpha 必须在 (0,1) 内",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.SchedulerErrorRateEWMAAlpha = 1 },
+			wantErr: "gateway.openai_ws.scheduler_error_rate_ewma_alpha must be within (0,1)",
+		},
+		{
+			name:    "scheduler_ttft_ewma_alpha 必须在 (0,1) 内",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.SchedulerTTFTEWMAAlpha = 0 },
+			wantErr: "gateway.openai_ws.scheduler_ttft_ewma_alpha must be within (0,1)",
+		},
+		{
+			name:    "scheduler_transport_fallback_group_ids 必须为正数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.SchedulerTransportFallbackGroupIDs = []int64{3, 0} },
+			wantErr: "gateway.openai_ws.scheduler_transport_fallback_group_ids must contain positive group ids",
+		},
+		{
+			name:    "scheduler_decision_event_buffer_size 必须为正数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.SchedulerDecisionEventBufferSize = 0 },
+			wantErr: "gateway.openai_ws.scheduler_decision_event_buffer_size must be positive",
+		},
+		{
+			name:    "scheduler_decision_event_sample_rate 必须在 [0,1] 范围内",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.SchedulerDecisionEventSampleRate = 1.5 },
+			wantErr: "gateway.openai_ws.scheduler_decision_event_sample_rate must be within [0,1]",
+		},
+		{
+			name:    "scheduler_state_dump_interval_seconds 不能为负数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.SchedulerStateDumpIntervalSeconds = -1 },
+			wantErr: "gateway.openai_ws.scheduler_state_dump_interval_seconds must be non-negative",
+		},
+		{
+			name:    "session_handoff_max_age_seconds 必须为正数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.SessionHandoffMaxAgeSeconds = 0 },
+			wantErr: "gateway.openai_ws.session_handoff_max_age_seconds must be positive",
+		},
+		{
+			name:    "metrics_listen_addr 必须为 host:port",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.MetricsListenAddr = "127.0.0.1" },
+			wantErr: "gateway.openai_ws.metrics_listen_addr must be host:port",
+		},
+		{
+			name:    "metrics_max_accounts 必须为正数",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.MetricsMaxAccounts = 0 },
+			wantErr: "gateway.openai_ws.metrics_max_accounts must be positive",
+		},
+		{
+			name:    "scheduler_zero_concurrency_mode 必须为合法值",
+			mutate:  func(c *Config) { c.Gateway.OpenAIWS.SchedulerZeroConcurrencyMode = "guess" },
+			wantErr: "gateway.openai_ws.scheduler_zero_concurrency_mode must be one of unbounded/assumed",
+		},
+		{
+			name: "scheduler_assumed_concurrency 在 assumed 模式下必须为正数",
+			mutate: func(c *Config) {
+				c.Gateway.OpenAIWS.SchedulerZeroConcurrencyMode = "assumed"
+				c.Gateway.OpenAIWS.SchedulerAssumedConcurrency = 0
+			},
+			wantErr: "gateway.openai_ws.scheduler_assumed_concurrency must be positive",
+		},
 	}
 
 	for _, tc := range cases {
@@ -58,6 +58,31 @@ func (h *BackupHandler) TestS3Connection(c *gin.Context) {
 	response.Success(c, gin.H{"ok": true, "message": "connection successful"})
 }
 
+// ─── 存储模式 ───
+
+func (h *BackupHandler) GetStorageConfig(c *gin.Context) {
+	cfg, err := h.backupService.GetStorageConfig(c.Request.Context())
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, cfg)
+}
+
+func (h *BackupHandler) UpdateStorageConfig(c *gin.Context) {
+	var req service.BackupStorageConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+	cfg, err := h.backupService.UpdateStorageConfig(c.Request.Context(), req)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, cfg)
+}
+
 // ─── 定时备份 ───
 
 func (h *BackupHandler) GetSchedule(c *gin.Context) {
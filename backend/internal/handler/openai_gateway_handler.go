@@ -2,6 +2,7 @@ package handler
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/Wei-Shaw/sub2api/internal/config"
@@ -25,6 +27,17 @@ import (
 	"go.uber.org/zap"
 )
 
+const (
+	// openAIClientWSErrorEventWriteTimeout 关闭前下发 error 事件的写超时，避免慢客户端拖住关闭流程。
+	openAIClientWSErrorEventWriteTimeout = time.Second
+	// openAIWSIngressCapabilitiesWriteTimeout 握手后下发 gateway.capabilities 事件的写超时。
+	openAIWSIngressCapabilitiesWriteTimeout = time.Second
+	// openAIWSIngressReadLimitBytes ingress 单条客户端消息的读取上限。
+	openAIWSIngressReadLimitBytes = 16 * 1024 * 1024
+	// openAIWSIngressFirstMessageTimeout 握手后等待首条 response.create 的默认超时（未配置 first_message_timeout_seconds 时）。
+	openAIWSIngressFirstMessageTimeout = 30 * time.Second
+)
+
 // OpenAIGatewayHandler handles OpenAI API gateway requests
 type OpenAIGatewayHandler struct {
 	gatewayService          *service.OpenAIGatewayService
@@ -85,6 +98,10 @@ func (h *OpenAIGatewayHandler) Responses(c *gin.Context) {
 		h.errorResponse(c, http.StatusUnauthorized, "authentication_error", "Invalid API key")
 		return
 	}
+	c.Request = c.Request.WithContext(service.WithAPIKeyID(c.Request.Context(), apiKey.ID))
+	c.Request = c.Request.WithContext(service.WithClientRegion(c.Request.Context(), h.gatewayService.ResolveOpenAIClientRegion(c)))
+	upstreamDialTimeout, upstreamReadTimeout := h.gatewayService.ResolveOpenAIUpstreamTimeoutOverride(c)
+	c.Request = c.Request.WithContext(service.WithUpstreamTimeoutOverride(c.Request.Context(), upstreamDialTimeout, upstreamReadTimeout))
 
 	subject, ok := middleware2.GetAuthSubjectFromContext(c)
 	if !ok {
@@ -140,6 +157,11 @@ func (h *OpenAIGatewayHandler) Responses(c *gin.Context) {
 		return
 	}
 
+	if injected, defaultModel, ok := service.ApplyOpenAIGroupDefaultModel(body, apiKey.Group); ok {
+		body = injected
+		reqLog.Info("openai.default_model_injected", zap.String("default_model", defaultModel))
+	}
+
 	// 使用 gjson 只读提取字段做校验，避免完整 Unmarshal
 	modelResult := gjson.GetBytes(body, "model")
 	if !modelResult.Exists() || modelResult.Type != gjson.String || modelResult.String() == "" {
@@ -233,6 +255,14 @@ func (h *OpenAIGatewayHandler) Responses(c *gin.Context) {
 				zap.Error(err),
 				zap.Int("excluded_account_count", len(failedAccountIDs)),
 			)
+			if service.IsOpenAIGroupPausedError(err) {
+				h.handleStreamingAwareError(c, http.StatusServiceUnavailable, "api_error", "Group is paused for maintenance, please retry later", streamStarted)
+				return
+			}
+			if service.IsOpenAIWSStateStoreUnavailableError(err) {
+				h.handleStreamingAwareError(c, http.StatusServiceUnavailable, "api_error", "Session state is temporarily unavailable, please retry later", streamStarted)
+				return
+			}
 			if len(failedAccountIDs) == 0 {
 				h.handleStreamingAwareError(c, http.StatusServiceUnavailable, "api_error", "Service temporarily unavailable", streamStarted)
 				return
@@ -256,6 +286,7 @@ func (h *OpenAIGatewayHandler) Responses(c *gin.Context) {
 			zap.Bool("sticky_previous_hit", scheduleDecision.StickyPreviousHit),
 			zap.Bool("sticky_session_hit", scheduleDecision.StickySessionHit),
 			zap.Int("candidate_count", scheduleDecision.CandidateCount),
+			zap.Int("total_eligible", scheduleDecision.TotalEligible),
 			zap.Int("top_k", scheduleDecision.TopK),
 			zap.Int64("latency_ms", scheduleDecision.LatencyMs),
 			zap.Float64("load_skew", scheduleDecision.LoadSkew),
@@ -291,6 +322,7 @@ func (h *OpenAIGatewayHandler) Responses(c *gin.Context) {
 			var failoverErr *service.UpstreamFailoverError
 			if errors.As(err, &failoverErr) {
 				h.gatewayService.ReportOpenAIAccountScheduleResult(account.ID, false, nil)
+				h.gatewayService.RecordOpenAIAccountError(account.ID, err)
 				// 池模式：同账号重试
 				if failoverErr.RetryableOnSameAccount {
 					retryLimit := account.GetPoolModeRetryCount()
@@ -327,6 +359,7 @@ func (h *OpenAIGatewayHandler) Responses(c *gin.Context) {
 				continue
 			}
 			h.gatewayService.ReportOpenAIAccountScheduleResult(account.ID, false, nil)
+			h.gatewayService.RecordOpenAIAccountError(account.ID, err)
 			wroteFallback := h.ensureForwardErrorResponse(c, streamStarted)
 			fields := []zap.Field{
 				zap.Int64("account_id", account.ID),
@@ -344,7 +377,7 @@ func (h *OpenAIGatewayHandler) Responses(c *gin.Context) {
 			if account.Type == service.AccountTypeOAuth {
 				h.gatewayService.UpdateCodexUsageSnapshotFromHeaders(c.Request.Context(), account.ID, result.ResponseHeaders)
 			}
-			h.gatewayService.ReportOpenAIAccountScheduleResult(account.ID, true, result.FirstTokenMs)
+			h.gatewayService.ReportOpenAIAccountScheduleResultForModel(account.ID, reqModel, true, result.FirstTokenMs)
 		} else {
 			h.gatewayService.ReportOpenAIAccountScheduleResult(account.ID, true, nil)
 		}
@@ -478,6 +511,10 @@ func (h *OpenAIGatewayHandler) Messages(c *gin.Context) {
 		h.anthropicErrorResponse(c, http.StatusUnauthorized, "authentication_error", "Invalid API key")
 		return
 	}
+	c.Request = c.Request.WithContext(service.WithAPIKeyID(c.Request.Context(), apiKey.ID))
+	c.Request = c.Request.WithContext(service.WithClientRegion(c.Request.Context(), h.gatewayService.ResolveOpenAIClientRegion(c)))
+	upstreamDialTimeout, upstreamReadTimeout := h.gatewayService.ResolveOpenAIUpstreamTimeoutOverride(c)
+	c.Request = c.Request.WithContext(service.WithUpstreamTimeoutOverride(c.Request.Context(), upstreamDialTimeout, upstreamReadTimeout))
 
 	subject, ok := middleware2.GetAuthSubjectFromContext(c)
 	if !ok {
@@ -677,6 +714,7 @@ func (h *OpenAIGatewayHandler) Messages(c *gin.Context) {
 			var failoverErr *service.UpstreamFailoverError
 			if errors.As(err, &failoverErr) {
 				h.gatewayService.ReportOpenAIAccountScheduleResult(account.ID, false, nil)
+				h.gatewayService.RecordOpenAIAccountError(account.ID, err)
 				// 池模式：同账号重试
 				if failoverErr.RetryableOnSameAccount {
 					retryLimit := account.GetPoolModeRetryCount()
@@ -713,6 +751,7 @@ func (h *OpenAIGatewayHandler) Messages(c *gin.Context) {
 				continue
 			}
 			h.gatewayService.ReportOpenAIAccountScheduleResult(account.ID, false, nil)
+			h.gatewayService.RecordOpenAIAccountError(account.ID, err)
 			wroteFallback := h.ensureAnthropicErrorResponse(c, streamStarted)
 			reqLog.Warn("openai_messages.forward_failed",
 				zap.Int64("account_id", account.ID),
@@ -722,7 +761,7 @@ func (h *OpenAIGatewayHandler) Messages(c *gin.Context) {
 			return
 		}
 		if result != nil {
-			h.gatewayService.ReportOpenAIAccountScheduleResult(account.ID, true, result.FirstTokenMs)
+			h.gatewayService.ReportOpenAIAccountScheduleResultForModel(account.ID, reqModel, true, result.FirstTokenMs)
 		} else {
 			h.gatewayService.ReportOpenAIAccountScheduleResult(account.ID, true, nil)
 		}
@@ -998,6 +1037,10 @@ func (h *OpenAIGatewayHandler) ResponsesWebSocket(c *gin.Context) {
 		h.errorResponse(c, http.StatusUnauthorized, "authentication_error", "Invalid API key")
 		return
 	}
+	c.Request = c.Request.WithContext(service.WithAPIKeyID(c.Request.Context(), apiKey.ID))
+	c.Request = c.Request.WithContext(service.WithClientRegion(c.Request.Context(), h.gatewayService.ResolveOpenAIClientRegion(c)))
+	upstreamDialTimeout, upstreamReadTimeout := h.gatewayService.ResolveOpenAIUpstreamTimeoutOverride(c)
+	c.Request = c.Request.WithContext(service.WithUpstreamTimeoutOverride(c.Request.Context(), upstreamDialTimeout, upstreamReadTimeout))
 	subject, ok := middleware2.GetAuthSubjectFromContext(c)
 	if !ok {
 		h.errorResponse(c, http.StatusInternalServerError, "api_error", "User context not found")
@@ -1012,6 +1055,9 @@ func (h *OpenAIGatewayHandler) ResponsesWebSocket(c *gin.Context) {
 		zap.Any("group_id", apiKey.GroupID),
 		zap.Bool("openai_ws_mode", true),
 	)
+	if !h.checkOpenAIWSIngressRequiredHeader(c, reqLog) {
+		return
+	}
 	if !h.ensureResponsesDependencies(c, reqLog) {
 		return
 	}
@@ -1019,9 +1065,7 @@ func (h *OpenAIGatewayHandler) ResponsesWebSocket(c *gin.Context) {
 	clientIP := ip.GetClientIP(c)
 	userAgent := strings.TrimSpace(c.GetHeader("User-Agent"))
 
-	wsConn, err := coderws.Accept(c.Writer, c.Request, &coderws.AcceptOptions{
-		CompressionMode: coderws.CompressionContextTakeover,
-	})
+	wsConn, err := coderws.Accept(c.Writer, c.Request, h.openAIWSIngressAcceptOptions())
 	if err != nil {
 		reqLog.Warn("openai.websocket_accept_failed",
 			zap.Error(err),
@@ -1037,12 +1081,52 @@ func (h *OpenAIGatewayHandler) ResponsesWebSocket(c *gin.Context) {
 	defer func() {
 		_ = wsConn.CloseNow()
 	}()
-	wsConn.SetReadLimit(16 * 1024 * 1024)
+	wsConn.SetReadLimit(openAIWSIngressReadLimitBytes)
+	// 新建会话按 API Key 限速：在能力事件与首条消息之前拒绝，避免频繁开关会话冲击建连与状态存储。
+	if !h.gatewayService.AllowOpenAIWSIngressSession(apiKey.ID) {
+		reqLog.Info("openai.websocket_session_rate_limited", zap.String("client_ip", clientIP))
+		h.closeOpenAIClientWSWithErrorEvent(wsConn, coderws.StatusTryAgainLater, "too many new sessions, please retry later", "session_rate_limited")
+		return
+	}
 
 	ctx := c.Request.Context()
-	readCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	msgType, firstMessage, err := wsConn.Read(readCtx)
-	cancel()
+	h.writeOpenAIWSIngressCapabilities(ctx, wsConn, reqLog)
+	// 首条消息超时不通过 Read 的 ctx 实现：ctx 到期时底层连接会被直接断开，客户端收不到 close 原因。
+	// 改由定时器发送带说明的 close 帧，Read 随之返回。定时器回调与 Read 返回通过 firstMessageSettled 争用，
+	// 只有先占到的一方生效，避免首条消息已读到后仍被关闭。
+	firstMessageTimeout := h.openAIWSIngressFirstMessageTimeout()
+	var firstMessageSettled atomic.Bool
+	firstMessageTimer := time.AfterFunc(firstMessageTimeout, func() {
+		if !firstMessageSettled.CompareAndSwap(false, true) {
+			return
+		}
+		h.closeOpenAIClientWSWithErrorEvent(
+			wsConn,
+			coderws.StatusPolicyViolation,
+			fmt.Sprintf("no message received within %s after connect; closing idle connection", firstMessageTimeout),
+			"first_message_timeout",
+		)
+	})
+	// 首条消息之前的 ping 由 Read 自动回复 pong 并继续等待；客户端直接发送 close 视为正常放弃会话。
+	msgType, firstMessage, err := wsConn.Read(ctx)
+	// Stop 返回 true 表示回调未触发；否则回调已在执行，由争用结果决定是否按超时处理。
+	if !firstMessageTimer.Stop() && !firstMessageSettled.CompareAndSwap(false, true) {
+		reqLog.Info("openai.websocket_first_message_timeout",
+			zap.String("client_ip", clientIP),
+			zap.String("request_user_agent", userAgent),
+			zap.Duration("first_message_timeout", firstMessageTimeout),
+		)
+		return
+	}
+	if err != nil && coderws.CloseStatus(err) != -1 {
+		closeStatus, closeReason := summarizeWSCloseErrorForLog(err)
+		reqLog.Info("openai.websocket_client_closed_before_first_message",
+			zap.String("client_ip", clientIP),
+			zap.String("close_status", closeStatus),
+			zap.String("close_reason", closeReason),
+		)
+		return
+	}
 	if err != nil {
 		closeStatus, closeReason := summarizeWSCloseErrorForLog(err)
 		reqLog.Warn("openai.websocket_read_first_message_failed",
@@ -1050,29 +1134,65 @@ func (h *OpenAIGatewayHandler) ResponsesWebSocket(c *gin.Context) {
 			zap.String("client_ip", clientIP),
 			zap.String("close_status", closeStatus),
 			zap.String("close_reason", closeReason),
-			zap.Duration("read_timeout", 30*time.Second),
+			zap.Duration("read_timeout", firstMessageTimeout),
 		)
-		closeOpenAIClientWS(wsConn, coderws.StatusPolicyViolation, "missing first response.create message")
+		h.closeOpenAIClientWSWithErrorEvent(wsConn, coderws.StatusPolicyViolation, "missing first response.create message", "")
 		return
 	}
 	if msgType != coderws.MessageText && msgType != coderws.MessageBinary {
-		closeOpenAIClientWS(wsConn, coderws.StatusPolicyViolation, "unsupported websocket message type")
+		h.closeOpenAIClientWSWithErrorEvent(wsConn, coderws.StatusPolicyViolation, "unsupported websocket message type", "unsupported_message_type")
+		return
+	}
+	canonicalFirstMessage, dupErr := h.gatewayService.ApplyOpenAIWSIngressDuplicateKeyPolicy(firstMessage)
+	if dupErr != nil {
+		closeStatus, closeReason, closeCode := coderws.StatusPolicyViolation, "duplicate top-level keys in first message", ""
+		var closeErr *service.OpenAIWSClientCloseError
+		if errors.As(dupErr, &closeErr) {
+			closeStatus, closeReason, closeCode = closeErr.StatusCode(), closeErr.Reason(), closeErr.ErrorCode()
+		}
+		reqLog.Warn("openai.websocket_first_message_duplicate_keys",
+			zap.String("client_ip", clientIP),
+			zap.String("close_reason", closeReason),
+		)
+		h.closeOpenAIClientWSWithErrorEvent(wsConn, closeStatus, closeReason, closeCode)
 		return
 	}
-	if !gjson.ValidBytes(firstMessage) {
-		closeOpenAIClientWS(wsConn, coderws.StatusPolicyViolation, "invalid JSON payload")
+	firstMessage = canonicalFirstMessage
+	if injected, defaultModel, ok := service.ApplyOpenAIGroupDefaultModel(firstMessage, apiKey.Group); ok {
+		firstMessage = injected
+		reqLog.Info("openai.websocket_default_model_injected", zap.String("default_model", defaultModel))
+	}
+	if validateErr := service.ValidateOpenAIWSIngressFirstClientMessage(firstMessage); validateErr != nil {
+		closeStatus, closeReason, closeCode := coderws.StatusPolicyViolation, "invalid first response.create message", ""
+		var closeErr *service.OpenAIWSClientCloseError
+		if errors.As(validateErr, &closeErr) {
+			closeStatus, closeReason, closeCode = closeErr.StatusCode(), closeErr.Reason(), closeErr.ErrorCode()
+		}
+		reqLog.Warn("openai.websocket_first_message_invalid",
+			zap.String("client_ip", clientIP),
+			zap.Int("first_message_len", len(firstMessage)),
+			zap.String("close_reason", closeReason),
+		)
+		h.closeOpenAIClientWSWithErrorEvent(wsConn, closeStatus, closeReason, closeCode)
 		return
 	}
 
-	reqModel := strings.TrimSpace(gjson.GetBytes(firstMessage, "model").String())
-	if reqModel == "" {
-		closeOpenAIClientWS(wsConn, coderws.StatusPolicyViolation, "model is required in first response.create payload")
+	if sessionErr := h.gatewayService.ValidateOpenAIWSIngressSessionIdentity(c, firstMessage); sessionErr != nil {
+		closeStatus, closeReason, closeCode := coderws.StatusPolicyViolation, "session identifier required", "session_id_required"
+		var closeErr *service.OpenAIWSClientCloseError
+		if errors.As(sessionErr, &closeErr) {
+			closeStatus, closeReason, closeCode = closeErr.StatusCode(), closeErr.Reason(), closeErr.ErrorCode()
+		}
+		reqLog.Info("openai.websocket_session_id_missing", zap.String("client_ip", clientIP))
+		h.closeOpenAIClientWSWithErrorEvent(wsConn, closeStatus, closeReason, closeCode)
 		return
 	}
+
+	reqModel := strings.TrimSpace(gjson.GetBytes(firstMessage, "model").String())
 	previousResponseID := strings.TrimSpace(gjson.GetBytes(firstMessage, "previous_response_id").String())
 	previousResponseIDKind := service.ClassifyOpenAIPreviousResponseIDKind(previousResponseID)
 	if previousResponseID != "" && previousResponseIDKind == service.OpenAIPreviousResponseIDKindMessageID {
-		closeOpenAIClientWS(wsConn, coderws.StatusPolicyViolation, "previous_response_id must be a response.id (resp_*), not a message id")
+		h.closeOpenAIClientWSWithErrorEvent(wsConn, coderws.StatusPolicyViolation, "previous_response_id must be a response.id (resp_*), not a message id", "invalid_previous_response_id")
 		return
 	}
 	reqLog = reqLog.With(
@@ -1101,11 +1221,11 @@ func (h *OpenAIGatewayHandler) ResponsesWebSocket(c *gin.Context) {
 	userReleaseFunc, userAcquired, err := h.concurrencyHelper.TryAcquireUserSlot(ctx, subject.UserID, subject.Concurrency)
 	if err != nil {
 		reqLog.Warn("openai.websocket_user_slot_acquire_failed", zap.Error(err))
-		closeOpenAIClientWS(wsConn, coderws.StatusInternalError, "failed to acquire user concurrency slot")
+		h.closeOpenAIClientWSWithErrorEvent(wsConn, coderws.StatusInternalError, "failed to acquire user concurrency slot", "")
 		return
 	}
 	if !userAcquired {
-		closeOpenAIClientWS(wsConn, coderws.StatusTryAgainLater, "too many concurrent requests, please retry later")
+		h.closeOpenAIClientWSWithErrorEvent(wsConn, coderws.StatusTryAgainLater, "too many concurrent requests, please retry later", "concurrency_limit_exceeded")
 		return
 	}
 	currentUserRelease = wrapReleaseOnDone(ctx, userReleaseFunc)
@@ -1113,7 +1233,7 @@ func (h *OpenAIGatewayHandler) ResponsesWebSocket(c *gin.Context) {
 	subscription, _ := middleware2.GetSubscriptionFromContext(c)
 	if err := h.billingCacheService.CheckBillingEligibility(ctx, apiKey.User, apiKey, apiKey.Group, subscription); err != nil {
 		reqLog.Info("openai.websocket_billing_eligibility_check_failed", zap.Error(err))
-		closeOpenAIClientWS(wsConn, coderws.StatusPolicyViolation, "billing check failed")
+		h.closeOpenAIClientWSWithErrorEvent(wsConn, coderws.StatusPolicyViolation, "billing check failed", "billing_check_failed")
 		return
 	}
 
@@ -1133,11 +1253,28 @@ func (h *OpenAIGatewayHandler) ResponsesWebSocket(c *gin.Context) {
 	)
 	if err != nil {
 		reqLog.Warn("openai.websocket_account_select_failed", zap.Error(err))
-		closeOpenAIClientWS(wsConn, coderws.StatusTryAgainLater, "no available account")
+		if service.IsOpenAIGroupPausedError(err) {
+			h.closeOpenAIClientWSWithErrorEvent(wsConn, coderws.StatusTryAgainLater, "group is paused for maintenance, please retry later", "group_paused")
+			return
+		}
+		if service.IsOpenAIWSStateStoreUnavailableError(err) {
+			h.closeOpenAIClientWSWithErrorEvent(wsConn, coderws.StatusTryAgainLater, "session state is temporarily unavailable, please retry later", "state_store_unavailable")
+			return
+		}
+		h.closeOpenAIClientWSWithErrorEvent(wsConn, coderws.StatusTryAgainLater, "no available account", "no_available_account")
 		return
 	}
 	if selection == nil || selection.Account == nil {
-		closeOpenAIClientWS(wsConn, coderws.StatusTryAgainLater, "no available account")
+		h.closeOpenAIClientWSWithErrorEvent(wsConn, coderws.StatusTryAgainLater, "no available account", "no_available_account")
+		return
+	}
+	if scheduleDecision.TransportFallback {
+		// 分组允许传输降级时选到的是 HTTP 账号，WS 入站无法承载；提示客户端改走 HTTP 重试。
+		if selection.ReleaseFunc != nil {
+			selection.ReleaseFunc()
+		}
+		reqLog.Info("openai.websocket_transport_fallback_http", zap.Int64("account_id", selection.Account.ID))
+		h.closeOpenAIClientWSWithErrorEvent(wsConn, coderws.StatusTryAgainLater, "no websocket account available, retry over http", "transport_fallback_http")
 		return
 	}
 
@@ -1149,7 +1286,7 @@ func (h *OpenAIGatewayHandler) ResponsesWebSocket(c *gin.Context) {
 	accountReleaseFunc := selection.ReleaseFunc
 	if !selection.Acquired {
 		if selection.WaitPlan == nil {
-			closeOpenAIClientWS(wsConn, coderws.StatusTryAgainLater, "account is busy, please retry later")
+			h.closeOpenAIClientWSWithErrorEvent(wsConn, coderws.StatusTryAgainLater, "account is busy, please retry later", "account_busy")
 			return
 		}
 		fastReleaseFunc, fastAcquired, err := h.concurrencyHelper.TryAcquireAccountSlot(
@@ -1159,11 +1296,11 @@ func (h *OpenAIGatewayHandler) ResponsesWebSocket(c *gin.Context) {
 		)
 		if err != nil {
 			reqLog.Warn("openai.websocket_account_slot_acquire_failed", zap.Int64("account_id", account.ID), zap.Error(err))
-			closeOpenAIClientWS(wsConn, coderws.StatusInternalError, "failed to acquire account concurrency slot")
+			h.closeOpenAIClientWSWithErrorEvent(wsConn, coderws.StatusInternalError, "failed to acquire account concurrency slot", "")
 			return
 		}
 		if !fastAcquired {
-			closeOpenAIClientWS(wsConn, coderws.StatusTryAgainLater, "account is busy, please retry later")
+			h.closeOpenAIClientWSWithErrorEvent(wsConn, coderws.StatusTryAgainLater, "account is busy, please retry later", "account_busy")
 			return
 		}
 		accountReleaseFunc = fastReleaseFunc
@@ -1176,7 +1313,7 @@ func (h *OpenAIGatewayHandler) ResponsesWebSocket(c *gin.Context) {
 	token, _, err := h.gatewayService.GetAccessToken(ctx, account)
 	if err != nil {
 		reqLog.Warn("openai.websocket_get_access_token_failed", zap.Int64("account_id", account.ID), zap.Error(err))
-		closeOpenAIClientWS(wsConn, coderws.StatusInternalError, "failed to get access token")
+		h.closeOpenAIClientWSWithErrorEvent(wsConn, coderws.StatusInternalError, "failed to get access token", "")
 		return
 	}
 
@@ -1185,6 +1322,7 @@ func (h *OpenAIGatewayHandler) ResponsesWebSocket(c *gin.Context) {
 		zap.String("account_name", account.Name),
 		zap.String("schedule_layer", scheduleDecision.Layer),
 		zap.Int("candidate_count", scheduleDecision.CandidateCount),
+		zap.Int("total_eligible", scheduleDecision.TotalEligible),
 	)
 
 	hooks := &service.OpenAIWSIngressHooks{
@@ -1200,7 +1338,7 @@ func (h *OpenAIGatewayHandler) ResponsesWebSocket(c *gin.Context) {
 				return service.NewOpenAIWSClientCloseError(coderws.StatusInternalError, "failed to acquire user concurrency slot", err)
 			}
 			if !userAcquired {
-				return service.NewOpenAIWSClientCloseError(coderws.StatusTryAgainLater, "too many concurrent requests, please retry later", nil)
+				return service.NewOpenAIWSClientCloseErrorWithCode(coderws.StatusTryAgainLater, "too many concurrent requests, please retry later", "concurrency_limit_exceeded", nil)
 			}
 			accountReleaseFunc, accountAcquired, err := h.concurrencyHelper.TryAcquireAccountSlot(ctx, account.ID, accountMaxConcurrency)
 			if err != nil {
@@ -1213,21 +1351,93 @@ func (h *OpenAIGatewayHandler) ResponsesWebSocket(c *gin.Context) {
 				if userReleaseFunc != nil {
 					userReleaseFunc()
 				}
-				return service.NewOpenAIWSClientCloseError(coderws.StatusTryAgainLater, "account is busy, please retry later", nil)
+				return service.NewOpenAIWSClientCloseErrorWithCode(coderws.StatusTryAgainLater, "account is busy, please retry later", "account_busy", nil)
 			}
 			currentUserRelease = wrapReleaseOnDone(ctx, userReleaseFunc)
 			currentAccountRelease = wrapReleaseOnDone(ctx, accountReleaseFunc)
 			return nil
 		},
+		ReselectAccount: func(turn int, current *service.Account, requestedModel string) (*service.Account, string, error) {
+			previousAccountID := account.ID
+			if current != nil {
+				previousAccountID = current.ID
+			}
+			excluded := map[int64]struct{}{previousAccountID: {}}
+			nextSelection, _, err := h.gatewayService.SelectAccountWithScheduler(
+				ctx,
+				apiKey.GroupID,
+				"",
+				sessionHash,
+				requestedModel,
+				excluded,
+				service.OpenAIUpstreamTransportResponsesWebsocketV2,
+			)
+			if err != nil {
+				return nil, "", err
+			}
+			if nextSelection == nil || nextSelection.Account == nil {
+				return nil, "", nil
+			}
+			nextAccount := nextSelection.Account
+			nextMaxConcurrency := nextAccount.Concurrency
+			if nextSelection.WaitPlan != nil && nextSelection.WaitPlan.MaxConcurrency > 0 {
+				nextMaxConcurrency = nextSelection.WaitPlan.MaxConcurrency
+			}
+			nextReleaseFunc := nextSelection.ReleaseFunc
+			if !nextSelection.Acquired {
+				// 重放不排队等待：新账号无空闲槽位时保持原账号。
+				fastReleaseFunc, fastAcquired, err := h.concurrencyHelper.TryAcquireAccountSlot(ctx, nextAccount.ID, nextMaxConcurrency)
+				if err != nil || !fastAcquired {
+					return nil, "", err
+				}
+				nextReleaseFunc = fastReleaseFunc
+			}
+			nextToken, _, err := h.gatewayService.GetAccessToken(ctx, nextAccount)
+			if err != nil {
+				if nextReleaseFunc != nil {
+					nextReleaseFunc()
+				}
+				return nil, "", err
+			}
+			if currentAccountRelease != nil {
+				currentAccountRelease()
+			}
+			currentAccountRelease = wrapReleaseOnDone(ctx, nextReleaseFunc)
+			account = nextAccount
+			accountMaxConcurrency = nextMaxConcurrency
+			if err := h.gatewayService.BindStickySession(ctx, apiKey.GroupID, sessionHash, account.ID); err != nil {
+				reqLog.Warn("openai.websocket_bind_sticky_session_failed", zap.Int64("account_id", account.ID), zap.Error(err))
+			}
+			reqLog.Info("openai.websocket_account_reselected",
+				zap.Int("turn", turn),
+				zap.Int64("account_id", account.ID),
+				zap.Int64("previous_account_id", previousAccountID),
+			)
+			return account, nextToken, nil
+		},
 		AfterTurn: func(turn int, result *service.OpenAIForwardResult, turnErr error) {
 			releaseTurnSlots()
-			if turnErr != nil || result == nil {
+			if result == nil {
 				return
 			}
-			if account.Type == service.AccountTypeOAuth {
-				h.gatewayService.UpdateCodexUsageSnapshotFromHeaders(ctx, account.ID, result.ResponseHeaders)
+			if turnErr != nil {
+				// 失败 turn 仅在携带部分 usage 时计费，不视为调度成功。
+				if !result.PartialUsage {
+					return
+				}
+				reqLog.Info("openai.websocket_partial_usage_recorded",
+					zap.Int64("account_id", account.ID),
+					zap.Int("turn", turn),
+					zap.String("request_id", result.RequestID),
+					zap.Int("input_tokens", result.Usage.InputTokens),
+					zap.Int("output_tokens", result.Usage.OutputTokens),
+				)
+			} else {
+				if account.Type == service.AccountTypeOAuth {
+					h.gatewayService.UpdateCodexUsageSnapshotFromHeaders(ctx, account.ID, result.ResponseHeaders)
+				}
+				h.gatewayService.ReportOpenAIAccountScheduleResultForModel(account.ID, result.Model, true, result.FirstTokenMs)
 			}
-			h.gatewayService.ReportOpenAIAccountScheduleResult(account.ID, true, result.FirstTokenMs)
 			h.submitUsageRecordTask(func(taskCtx context.Context) {
 				if err := h.gatewayService.RecordUsage(taskCtx, &service.OpenAIRecordUsageInput{
 					Result:             result,
@@ -1252,6 +1462,7 @@ func (h *OpenAIGatewayHandler) ResponsesWebSocket(c *gin.Context) {
 
 	if err := h.gatewayService.ProxyResponsesWebSocketFromClient(ctx, c, wsConn, account, token, firstMessage, hooks); err != nil {
 		h.gatewayService.ReportOpenAIAccountScheduleResult(account.ID, false, nil)
+		h.gatewayService.RecordOpenAIAccountError(account.ID, err)
 		closeStatus, closeReason := summarizeWSCloseErrorForLog(err)
 		reqLog.Warn("openai.websocket_proxy_failed",
 			zap.Int64("account_id", account.ID),
@@ -1261,10 +1472,10 @@ func (h *OpenAIGatewayHandler) ResponsesWebSocket(c *gin.Context) {
 		)
 		var closeErr *service.OpenAIWSClientCloseError
 		if errors.As(err, &closeErr) {
-			closeOpenAIClientWS(wsConn, closeErr.StatusCode(), closeErr.Reason())
+			h.closeOpenAIClientWSWithErrorEvent(wsConn, closeErr.StatusCode(), closeErr.Reason(), closeErr.ErrorCode())
 			return
 		}
-		closeOpenAIClientWS(wsConn, coderws.StatusInternalError, "upstream websocket proxy failed")
+		h.closeOpenAIClientWSWithErrorEvent(wsConn, coderws.StatusInternalError, "upstream websocket proxy failed", "upstream_error")
 		return
 	}
 	reqLog.Info("openai.websocket_ingress_closed", zap.Int64("account_id", account.ID))
@@ -1540,6 +1751,89 @@ func isOpenAIWSUpgradeRequest(r *http.Request) bool {
 	return strings.Contains(strings.ToLower(strings.TrimSpace(r.Header.Get("Connection"))), "upgrade")
 }
 
+// closeOpenAIClientWSWithErrorEvent 按配置先下发结构化 error 事件，再以指定 close code 关闭客户端连接。
+// code 为空时由 close code 推导；事件写入失败不影响后续关闭。
+func (h *OpenAIGatewayHandler) closeOpenAIClientWSWithErrorEvent(conn *coderws.Conn, status coderws.StatusCode, reason string, code string) {
+	if conn == nil {
+		return
+	}
+	if h != nil && h.cfg != nil && h.cfg.Gateway.OpenAIWS.ClientCloseErrorEventEnabled {
+		if payload := service.BuildOpenAIWSClientCloseErrorEvent(status, reason, code); len(payload) > 0 {
+			writeCtx, cancel := context.WithTimeout(context.Background(), openAIClientWSErrorEventWriteTimeout)
+			_ = conn.Write(writeCtx, coderws.MessageText, payload)
+			cancel()
+		}
+	}
+	closeOpenAIClientWS(conn, status, reason)
+}
+
+// checkOpenAIWSIngressRequiredHeader 在 Accept 之前校验配置要求的升级请求头：缺失返回 401，值不一致返回 403。
+// 返回 false 时已写入错误响应。
+func (h *OpenAIGatewayHandler) checkOpenAIWSIngressRequiredHeader(c *gin.Context, reqLog *zap.Logger) bool {
+	if h == nil || h.cfg == nil {
+		return true
+	}
+	header := strings.TrimSpace(h.cfg.Gateway.OpenAIWS.IngressRequiredHeader)
+	if header == "" {
+		return true
+	}
+	value := strings.TrimSpace(c.GetHeader(header))
+	if value == "" {
+		reqLog.Warn("openai.websocket_required_header_missing", zap.String("header", header))
+		h.errorResponse(c, http.StatusUnauthorized, "authentication_error", "Missing required header: "+header)
+		return false
+	}
+	expected := strings.TrimSpace(h.cfg.Gateway.OpenAIWS.IngressRequiredHeaderValue)
+	if expected != "" && subtle.ConstantTimeCompare([]byte(value), []byte(expected)) != 1 {
+		reqLog.Warn("openai.websocket_required_header_mismatch", zap.String("header", header))
+		h.errorResponse(c, http.StatusForbidden, "permission_error", "Invalid value for required header: "+header)
+		return false
+	}
+	return true
+}
+
+// openAIWSIngressAcceptOptions 返回 ingress 握手参数：客户端协商 permessage-deflate 时启用上下文接管压缩，
+// 仅对达到 ingress_compression_threshold_bytes 的下发消息压缩，细碎 delta 直接透传。
+func (h *OpenAIGatewayHandler) openAIWSIngressAcceptOptions() *coderws.AcceptOptions {
+	opts := &coderws.AcceptOptions{
+		Subprotocols:    []string{service.OpenAIWSIngressCapabilitiesSubprotocol},
+		CompressionMode: coderws.CompressionContextTakeover,
+	}
+	if h != nil && h.cfg != nil && h.cfg.Gateway.OpenAIWS.IngressCompressionThresholdBytes > 0 {
+		opts.CompressionThreshold = h.cfg.Gateway.OpenAIWS.IngressCompressionThresholdBytes
+	}
+	return opts
+}
+
+// openAIWSIngressFirstMessageTimeout 返回握手后等待首条消息的超时，优先使用 first_message_timeout_seconds。
+func (h *OpenAIGatewayHandler) openAIWSIngressFirstMessageTimeout() time.Duration {
+	if h != nil && h.cfg != nil && h.cfg.Gateway.OpenAIWS.FirstMessageTimeoutSeconds > 0 {
+		return time.Duration(h.cfg.Gateway.OpenAIWS.FirstMessageTimeoutSeconds) * time.Second
+	}
+	return openAIWSIngressFirstMessageTimeout
+}
+
+// writeOpenAIWSIngressCapabilities 在读取首条客户端消息前下发 gateway.capabilities 事件；
+// 仅在开启配置或客户端协商了能力子协议时发送，写失败不影响后续流程。
+func (h *OpenAIGatewayHandler) writeOpenAIWSIngressCapabilities(ctx context.Context, conn *coderws.Conn, reqLog *zap.Logger) {
+	if conn == nil || h == nil {
+		return
+	}
+	enabled := h.cfg != nil && h.cfg.Gateway.OpenAIWS.IngressCapabilitiesEventEnabled
+	if !enabled && conn.Subprotocol() != service.OpenAIWSIngressCapabilitiesSubprotocol {
+		return
+	}
+	payload := h.gatewayService.BuildOpenAIWSIngressCapabilitiesEvent(openAIWSIngressReadLimitBytes, h.openAIWSIngressFirstMessageTimeout())
+	if len(payload) == 0 {
+		return
+	}
+	writeCtx, cancel := context.WithTimeout(ctx, openAIWSIngressCapabilitiesWriteTimeout)
+	defer cancel()
+	if err := conn.Write(writeCtx, coderws.MessageText, payload); err != nil && reqLog != nil {
+		reqLog.Debug("openai.websocket_capabilities_write_failed", zap.Error(err))
+	}
+}
+
 func closeOpenAIClientWS(conn *coderws.Conn, status coderws.StatusCode, reason string) {
 	if conn == nil {
 		return
@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Wei-Shaw/sub2api/internal/config"
 	pkghttputil "github.com/Wei-Shaw/sub2api/internal/pkg/httputil"
 	"github.com/Wei-Shaw/sub2api/internal/server/middleware"
 	"github.com/Wei-Shaw/sub2api/internal/service"
@@ -403,6 +404,47 @@ func TestOpenAIResponses_SetsClientTransportHTTP(t *testing.T) {
 	require.Equal(t, service.OpenAIClientTransportHTTP, service.GetOpenAIClientTransport(c))
 }
 
+func TestOpenAIResponses_AttachesClampedUpstreamTimeoutOverride(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.RequestTimeoutOverrideMinSeconds = 2
+	cfg.Gateway.OpenAIWS.RequestTimeoutOverrideMaxSeconds = 60
+	h := &OpenAIGatewayHandler{
+		gatewayService: service.NewOpenAIGatewayService(nil, nil, nil, nil, nil, nil, nil, cfg, nil, nil, nil, nil, nil, nil, nil, nil),
+	}
+	run := func(dialHeader, readHeader string) context.Context {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/openai/v1/responses", strings.NewReader(`{"model":"gpt-5"}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		if dialHeader != "" {
+			c.Request.Header.Set(service.OpenAIUpstreamDialTimeoutHeader, dialHeader)
+		}
+		if readHeader != "" {
+			c.Request.Header.Set(service.OpenAIUpstreamReadTimeoutHeader, readHeader)
+		}
+		c.Set(string(middleware.ContextKeyAPIKey), &service.APIKey{ID: 101})
+		// 未设置 AuthSubject：handler 在写入上下文后即返回，便于检查转发前挂载的覆盖值。
+		h.Responses(c)
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+		return c.Request.Context()
+	}
+
+	dial, read, ok := service.UpstreamTimeoutOverrideFromContext(run("1.5", "7200"))
+	require.True(t, ok)
+	require.Equal(t, 2*time.Second, dial, "低于下限的覆盖值钳制到 request_timeout_override_min_seconds")
+	require.Equal(t, 60*time.Second, read, "超过上限的覆盖值钳制到 request_timeout_override_max_seconds")
+
+	dial, read, ok = service.UpstreamTimeoutOverrideFromContext(run("", "30"))
+	require.True(t, ok)
+	require.Zero(t, dial)
+	require.Equal(t, 30*time.Second, read)
+
+	_, _, ok = service.UpstreamTimeoutOverrideFromContext(run("abc", "-5"))
+	require.False(t, ok, "非法覆盖值应被忽略，沿用配置默认值")
+}
+
 func TestOpenAIResponses_RejectsMessageIDAsPreviousResponseID(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -493,6 +535,160 @@ func TestOpenAIResponsesWebSocket_RejectsMessageIDAsPreviousResponseID(t *testin
 	require.Contains(t, strings.ToLower(closeErr.Reason), "previous_response_id")
 }
 
+func TestOpenAIResponsesWebSocket_RejectsMalformedFirstMessage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name       string
+		payload    []byte
+		wantReason string
+	}{
+		{name: "empty_object", payload: []byte(`{}`), wantReason: "model is required"},
+		{name: "garbage_bytes", payload: []byte{0x01, 0xfe, 'n', 'o', 't', '-', 'j', 's', 'o', 'n'}, wantReason: "not valid json"},
+		{name: "whitespace_only", payload: []byte("   "), wantReason: "empty first message"},
+		{name: "json_array", payload: []byte(`[{"type":"response.create"}]`), wantReason: "json object"},
+		{name: "unsupported_type", payload: []byte(`{"type":"ping"}`), wantReason: "must be response.create"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := newOpenAIHandlerForPreviousResponseIDValidation(t, nil)
+			wsServer := newOpenAIWSHandlerTestServer(t, h, middleware.AuthSubject{UserID: 1, Concurrency: 1})
+			defer wsServer.Close()
+
+			dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+			clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http")+"/openai/v1/responses", nil)
+			cancelDial()
+			require.NoError(t, err)
+			defer func() {
+				_ = clientConn.CloseNow()
+			}()
+
+			writeCtx, cancelWrite := context.WithTimeout(context.Background(), 3*time.Second)
+			err = clientConn.Write(writeCtx, coderws.MessageBinary, tc.payload)
+			cancelWrite()
+			require.NoError(t, err)
+
+			readCtx, cancelRead := context.WithTimeout(context.Background(), 3*time.Second)
+			_, _, err = clientConn.Read(readCtx)
+			cancelRead()
+			require.Error(t, err)
+			var closeErr coderws.CloseError
+			require.ErrorAs(t, err, &closeErr)
+			require.Equal(t, coderws.StatusPolicyViolation, closeErr.Code)
+			require.Contains(t, strings.ToLower(closeErr.Reason), tc.wantReason)
+		})
+	}
+}
+
+func TestOpenAIResponsesWebSocket_FirstFrameCloseExitsCleanly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logSink, restore := captureHandlerStructuredLog(t)
+	defer restore()
+
+	h := newOpenAIHandlerForPreviousResponseIDValidation(t, nil)
+	wsServer := newOpenAIWSHandlerTestServer(t, h, middleware.AuthSubject{UserID: 1, Concurrency: 1})
+	defer wsServer.Close()
+
+	dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+	clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http")+"/openai/v1/responses", nil)
+	cancelDial()
+	require.NoError(t, err)
+	defer func() {
+		_ = clientConn.CloseNow()
+	}()
+
+	// 服务端应完成关闭握手并直接退出，而不是回写错误事件或以 policy violation 关闭。
+	require.NoError(t, clientConn.Close(coderws.StatusNormalClosure, "bye"))
+	require.Eventually(t, func() bool {
+		return logSink.ContainsMessageAtLevel("openai.websocket_client_closed_before_first_message", "info")
+	}, 3*time.Second, 10*time.Millisecond)
+	require.False(t, logSink.ContainsMessageAtLevel("openai.websocket_read_first_message_failed", "warn"))
+}
+
+func TestOpenAIResponsesWebSocket_RequiredHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name       string
+		header     http.Header
+		wantStatus int
+	}{
+		{name: "absent", header: nil, wantStatus: http.StatusUnauthorized},
+		{name: "mismatch", header: http.Header{"X-Internal-Token": []string{"wrong"}}, wantStatus: http.StatusForbidden},
+		{name: "present", header: http.Header{"X-Internal-Token": []string{"secret"}}, wantStatus: http.StatusSwitchingProtocols},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := newOpenAIHandlerForPreviousResponseIDValidation(t, nil)
+			h.cfg = &config.Config{}
+			h.cfg.Gateway.OpenAIWS.IngressRequiredHeader = "X-Internal-Token"
+			h.cfg.Gateway.OpenAIWS.IngressRequiredHeaderValue = "secret"
+			wsServer := newOpenAIWSHandlerTestServer(t, h, middleware.AuthSubject{UserID: 1, Concurrency: 1})
+			defer wsServer.Close()
+
+			dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+			clientConn, resp, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http")+"/openai/v1/responses", &coderws.DialOptions{
+				HTTPHeader: tc.header,
+			})
+			cancelDial()
+			require.NotNil(t, resp)
+			require.Equal(t, tc.wantStatus, resp.StatusCode)
+			if tc.wantStatus != http.StatusSwitchingProtocols {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			_ = clientConn.Close(coderws.StatusNormalClosure, "done")
+		})
+	}
+}
+
+func TestOpenAIResponsesWebSocket_FirstFramePingKeepsWaitingForFirstMessage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cache := &concurrencyCacheMock{
+		acquireUserSlotFn: func(ctx context.Context, userID int64, maxConcurrency int, requestID string) (bool, error) {
+			return false, errors.New("user slot unavailable")
+		},
+	}
+	h := newOpenAIHandlerForPreviousResponseIDValidation(t, cache)
+	wsServer := newOpenAIWSHandlerTestServer(t, h, middleware.AuthSubject{UserID: 1, Concurrency: 1})
+	defer wsServer.Close()
+
+	dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+	clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http")+"/openai/v1/responses", nil)
+	cancelDial()
+	require.NoError(t, err)
+	defer func() {
+		_ = clientConn.CloseNow()
+	}()
+
+	// 客户端需要并发读取才能收到 pong。
+	readErrCh := make(chan error, 1)
+	go func() {
+		readCtx, cancelRead := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelRead()
+		_, _, readErr := clientConn.Read(readCtx)
+		readErrCh <- readErr
+	}()
+
+	pingCtx, cancelPing := context.WithTimeout(context.Background(), 3*time.Second)
+	require.NoError(t, clientConn.Ping(pingCtx), "首帧 ping 应收到 pong")
+	cancelPing()
+
+	writeCtx, cancelWrite := context.WithTimeout(context.Background(), 3*time.Second)
+	err = clientConn.Write(writeCtx, coderws.MessageText, []byte(`{"type":"response.create","model":"gpt-5.1","stream":false}`))
+	cancelWrite()
+	require.NoError(t, err)
+
+	// ping 之后仍按首条消息处理：此处因用户槽位获取失败而关闭。
+	readErr := <-readErrCh
+	var closeErr coderws.CloseError
+	require.ErrorAs(t, readErr, &closeErr)
+	require.Equal(t, coderws.StatusInternalError, closeErr.Code)
+}
+
 func TestOpenAIResponsesWebSocket_PreviousResponseIDKindLoggedBeforeAcquireFailure(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -530,6 +726,225 @@ func TestOpenAIResponsesWebSocket_PreviousResponseIDKindLoggedBeforeAcquireFailu
 	require.Contains(t, strings.ToLower(closeErr.Reason), "failed to acquire user concurrency slot")
 }
 
+func TestOpenAIResponsesWebSocket_IdleClientClosedAfterFirstMessageTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logSink, restore := captureHandlerStructuredLog(t)
+	defer restore()
+
+	h := newOpenAIHandlerForPreviousResponseIDValidation(t, nil)
+	h.cfg = &config.Config{}
+	h.cfg.Gateway.OpenAIWS.FirstMessageTimeoutSeconds = 1
+	h.cfg.Gateway.OpenAIWS.ClientCloseErrorEventEnabled = true
+	wsServer := newOpenAIWSHandlerTestServer(t, h, middleware.AuthSubject{UserID: 1, Concurrency: 1})
+	defer wsServer.Close()
+
+	dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+	clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http")+"/openai/v1/responses", nil)
+	cancelDial()
+	require.NoError(t, err)
+	defer func() {
+		_ = clientConn.CloseNow()
+	}()
+
+	// 客户端连上后从不发送消息：超时后先收到 error 事件，再收到带说明的 1008 关闭，而不是连接被直接断开。
+	startedAt := time.Now()
+	readCtx, cancelRead := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelRead()
+	msgType, event, err := clientConn.Read(readCtx)
+	require.NoError(t, err)
+	require.Equal(t, coderws.MessageText, msgType)
+	require.Equal(t, "first_message_timeout", gjson.GetBytes(event, "error.code").String())
+	require.GreaterOrEqual(t, time.Since(startedAt), 900*time.Millisecond)
+
+	_, _, err = clientConn.Read(readCtx)
+	var closeErr coderws.CloseError
+	require.ErrorAs(t, err, &closeErr)
+	require.Equal(t, coderws.StatusPolicyViolation, closeErr.Code)
+	require.Contains(t, closeErr.Reason, "no message received within 1s")
+	require.Eventually(t, func() bool {
+		return logSink.ContainsMessageAtLevel("openai.websocket_first_message_timeout", "info")
+	}, 3*time.Second, 10*time.Millisecond)
+	require.False(t, logSink.ContainsMessageAtLevel("openai.websocket_read_first_message_failed", "warn"))
+}
+
+func TestOpenAIResponsesWebSocket_SendsStructuredErrorEventBeforeClose(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name          string
+		cache         *concurrencyCacheMock
+		payload       string
+		wantStatus    coderws.StatusCode
+		wantCode      string
+		wantRetryable bool
+	}{
+		{
+			name:       "policy_violation",
+			payload:    `{"type":"response.create","stream":false}`,
+			wantStatus: coderws.StatusPolicyViolation,
+			wantCode:   "invalid_request",
+		},
+		{
+			name: "user_concurrency_limit",
+			cache: &concurrencyCacheMock{
+				acquireUserSlotFn: func(ctx context.Context, userID int64, maxConcurrency int, requestID string) (bool, error) {
+					return false, nil
+				},
+			},
+			payload:       `{"type":"response.create","model":"gpt-5.1","stream":false}`,
+			wantStatus:    coderws.StatusTryAgainLater,
+			wantCode:      "concurrency_limit_exceeded",
+			wantRetryable: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := newOpenAIHandlerForPreviousResponseIDValidation(t, tc.cache)
+			h.cfg = &config.Config{}
+			h.cfg.Gateway.OpenAIWS.ClientCloseErrorEventEnabled = true
+			wsServer := newOpenAIWSHandlerTestServer(t, h, middleware.AuthSubject{UserID: 1, Concurrency: 1})
+			defer wsServer.Close()
+
+			dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+			clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http")+"/openai/v1/responses", nil)
+			cancelDial()
+			require.NoError(t, err)
+			defer func() {
+				_ = clientConn.CloseNow()
+			}()
+
+			writeCtx, cancelWrite := context.WithTimeout(context.Background(), 3*time.Second)
+			err = clientConn.Write(writeCtx, coderws.MessageText, []byte(tc.payload))
+			cancelWrite()
+			require.NoError(t, err)
+
+			readCtx, cancelRead := context.WithTimeout(context.Background(), 3*time.Second)
+			msgType, event, err := clientConn.Read(readCtx)
+			cancelRead()
+			require.NoError(t, err)
+			require.Equal(t, coderws.MessageText, msgType)
+			require.Equal(t, "error", gjson.GetBytes(event, "type").String())
+			require.Equal(t, tc.wantCode, gjson.GetBytes(event, "error.code").String())
+			require.Equal(t, tc.wantRetryable, gjson.GetBytes(event, "error.retryable").Bool())
+			require.NotEmpty(t, gjson.GetBytes(event, "error.message").String())
+
+			readCtx, cancelRead = context.WithTimeout(context.Background(), 3*time.Second)
+			_, _, err = clientConn.Read(readCtx)
+			cancelRead()
+			require.Error(t, err)
+			var closeErr coderws.CloseError
+			require.ErrorAs(t, err, &closeErr)
+			require.Equal(t, tc.wantStatus, closeErr.Code)
+		})
+	}
+}
+
+func TestOpenAIResponsesWebSocket_CapabilitiesEventBeforeFirstMessage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name         string
+		enabled      bool
+		subprotocols []string
+		wantEvent    bool
+	}{
+		{name: "disabled_without_subprotocol", wantEvent: false},
+		{name: "enabled_by_config", enabled: true, wantEvent: true},
+		{name: "negotiated_subprotocol", subprotocols: []string{service.OpenAIWSIngressCapabilitiesSubprotocol}, wantEvent: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cache := &concurrencyCacheMock{
+				acquireUserSlotFn: func(ctx context.Context, userID int64, maxConcurrency int, requestID string) (bool, error) {
+					return false, errors.New("user slot unavailable")
+				},
+			}
+			h := newOpenAIHandlerForPreviousResponseIDValidation(t, cache)
+			h.cfg = &config.Config{}
+			h.cfg.Gateway.OpenAIWS.IngressCapabilitiesEventEnabled = tc.enabled
+			wsServer := newOpenAIWSHandlerTestServer(t, h, middleware.AuthSubject{UserID: 1, Concurrency: 1})
+			defer wsServer.Close()
+
+			dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+			clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http")+"/openai/v1/responses", &coderws.DialOptions{
+				Subprotocols: tc.subprotocols,
+			})
+			cancelDial()
+			require.NoError(t, err)
+			defer func() {
+				_ = clientConn.CloseNow()
+			}()
+
+			if tc.wantEvent {
+				// 能力事件应在客户端发送首条消息之前到达。
+				readCtx, cancelRead := context.WithTimeout(context.Background(), 3*time.Second)
+				msgType, event, readErr := clientConn.Read(readCtx)
+				cancelRead()
+				require.NoError(t, readErr)
+				require.Equal(t, coderws.MessageText, msgType)
+				require.Equal(t, "gateway.capabilities", gjson.GetBytes(event, "type").String())
+				require.True(t, gjson.GetBytes(event, "features.binary_messages").Bool())
+				require.False(t, gjson.GetBytes(event, "features.cancel").Bool())
+				require.False(t, gjson.GetBytes(event, "features.multiplexing").Bool())
+				require.Equal(t, int64(openAIWSIngressReadLimitBytes), gjson.GetBytes(event, "limits.max_message_bytes").Int())
+				require.Equal(t, openAIWSIngressFirstMessageTimeout.Milliseconds(), gjson.GetBytes(event, "limits.first_message_timeout_ms").Int())
+			}
+
+			writeCtx, cancelWrite := context.WithTimeout(context.Background(), 3*time.Second)
+			err = clientConn.Write(writeCtx, coderws.MessageText, []byte(`{"type":"response.create","model":"gpt-5.1","stream":false}`))
+			cancelWrite()
+			require.NoError(t, err)
+
+			// 首轮之后的流程不受能力事件影响：此处因用户槽位获取失败而关闭。
+			readCtx, cancelRead := context.WithTimeout(context.Background(), 3*time.Second)
+			_, _, err = clientConn.Read(readCtx)
+			cancelRead()
+			require.Error(t, err)
+			var closeErr coderws.CloseError
+			require.ErrorAs(t, err, &closeErr)
+			require.Equal(t, coderws.StatusInternalError, closeErr.Code)
+		})
+	}
+}
+
+func TestOpenAIResponsesWebSocket_InjectsGroupDefaultModelWhenMissing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cache := &concurrencyCacheMock{
+		acquireUserSlotFn: func(ctx context.Context, userID int64, maxConcurrency int, requestID string) (bool, error) {
+			return false, nil
+		},
+	}
+	h := newOpenAIHandlerForPreviousResponseIDValidation(t, cache)
+	group := &service.Group{ID: 2, Platform: service.PlatformOpenAI, DefaultMappedModel: "gpt-5.1"}
+	wsServer := newOpenAIWSHandlerTestServerWithGroup(t, h, middleware.AuthSubject{UserID: 1, Concurrency: 1}, group)
+	defer wsServer.Close()
+
+	dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+	clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http")+"/openai/v1/responses", nil)
+	cancelDial()
+	require.NoError(t, err)
+	defer func() {
+		_ = clientConn.CloseNow()
+	}()
+
+	writeCtx, cancelWrite := context.WithTimeout(context.Background(), 3*time.Second)
+	err = clientConn.Write(writeCtx, coderws.MessageText, []byte(`{"type":"response.create","stream":false}`))
+	cancelWrite()
+	require.NoError(t, err)
+
+	// 注入默认模型后首包通过校验，进入并发槽位获取阶段（而非因缺少 model 被 1008 拒绝）。
+	readCtx, cancelRead := context.WithTimeout(context.Background(), 3*time.Second)
+	_, _, err = clientConn.Read(readCtx)
+	cancelRead()
+	require.Error(t, err)
+	var closeErr coderws.CloseError
+	require.ErrorAs(t, err, &closeErr)
+	require.Equal(t, coderws.StatusTryAgainLater, closeErr.Code)
+}
+
 func TestSetOpenAIClientTransportHTTP(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -659,11 +1074,17 @@ func newOpenAIHandlerForPreviousResponseIDValidation(t *testing.T, cache *concur
 }
 
 func newOpenAIWSHandlerTestServer(t *testing.T, h *OpenAIGatewayHandler, subject middleware.AuthSubject) *httptest.Server {
+	t.Helper()
+	return newOpenAIWSHandlerTestServerWithGroup(t, h, subject, nil)
+}
+
+func newOpenAIWSHandlerTestServerWithGroup(t *testing.T, h *OpenAIGatewayHandler, subject middleware.AuthSubject, group *service.Group) *httptest.Server {
 	t.Helper()
 	groupID := int64(2)
 	apiKey := &service.APIKey{
 		ID:      101,
 		GroupID: &groupID,
+		Group:   group,
 		User:    &service.User{ID: subject.UserID},
 	}
 	router := gin.New()
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	coderws "github.com/coder/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// openAIWSWireCountingListener 统计服务端写入底层连接的字节数（即实际下发到网络的帧大小）。
+type openAIWSWireCountingListener struct {
+	net.Listener
+	written *atomic.Int64
+}
+
+func (l openAIWSWireCountingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &openAIWSWireCountingConn{Conn: conn, written: l.written}, nil
+}
+
+type openAIWSWireCountingConn struct {
+	net.Conn
+	written *atomic.Int64
+}
+
+func (c *openAIWSWireCountingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.written.Add(int64(n))
+	return n, err
+}
+
+// startOpenAIWSCompressionTestServer 启动一个使用 ingress 握手参数的 WS 服务端，连接建立后依次下发 messages rounds 轮。
+// 返回的计数器只统计握手之后的下发字节。
+func startOpenAIWSCompressionTestServer(tb testing.TB, h *OpenAIGatewayHandler, messages [][]byte, rounds int) (*httptest.Server, *atomic.Int64) {
+	tb.Helper()
+	written := &atomic.Int64{}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := coderws.Accept(w, r, h.openAIWSIngressAcceptOptions())
+		if err != nil {
+			return
+		}
+		defer func() {
+			_ = conn.CloseNow()
+		}()
+		written.Store(0)
+		for i := 0; i < rounds; i++ {
+			for _, message := range messages {
+				if err := conn.Write(r.Context(), coderws.MessageText, message); err != nil {
+					return
+				}
+			}
+		}
+		_ = conn.Close(coderws.StatusNormalClosure, "")
+	}))
+	server.Listener = openAIWSWireCountingListener{Listener: server.Listener, written: written}
+	server.Start()
+	tb.Cleanup(server.Close)
+	return server, written
+}
+
+func readOpenAIWSUntilClose(tb testing.TB, server *httptest.Server, mode coderws.CompressionMode) int {
+	tb.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	conn, _, err := coderws.Dial(ctx, "ws"+strings.TrimPrefix(server.URL, "http"), &coderws.DialOptions{CompressionMode: mode})
+	require.NoError(tb, err)
+	defer func() {
+		_ = conn.CloseNow()
+	}()
+	conn.SetReadLimit(-1)
+	received := 0
+	for {
+		if _, _, err := conn.Read(ctx); err != nil {
+			require.Equal(tb, coderws.StatusNormalClosure, coderws.CloseStatus(err))
+			return received
+		}
+		received++
+	}
+}
+
+// buildOpenAIWSReasoningOutputEvent 构造一条包含整段推理输出的 response.output_item.done 事件，
+// 文本由常见句式随机拼接，压缩率接近真实推理输出。
+func buildOpenAIWSReasoningOutputEvent(size int) []byte {
+	sentences := []string{
+		"First, I need to check how the scheduler picks an account when the sticky binding is stale.",
+		"The load factor is computed from the concurrency limit, so a higher limit lowers the score.",
+		"Let me reconsider the edge case where the previous response id points to an expired session.",
+		"If the upstream returns a rate limit error, we should fall back to another account in the group.",
+		"This means the retry path must preserve the original payload and drop the previous response id.",
+		"I should verify that the tool call outputs are replayed in the same order as the function calls.",
+		"Next, compare the latency of the pooled connection with a freshly dialed websocket connection.",
+		"The test expects the terminal event to be forwarded before the connection lease is released.",
+	}
+	rng := rand.New(rand.NewPCG(1, 2))
+	var text strings.Builder
+	for text.Len() < size {
+		text.WriteString(sentences[rng.IntN(len(sentences))])
+		text.WriteByte(' ')
+	}
+	return []byte(fmt.Sprintf(`{"type":"response.output_item.done","output_index":0,"item":{"id":"rs_1","type":"reasoning","summary":[{"type":"summary_text","text":%q}]}}`, text.String()))
+}
+
+func newOpenAIWSCompressionTestHandler(threshold int) *OpenAIGatewayHandler {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.IngressCompressionThresholdBytes = threshold
+	return &OpenAIGatewayHandler{cfg: cfg}
+}
+
+func TestOpenAIWSIngressCompression_ThresholdSkipsTinyFrames(t *testing.T) {
+	h := newOpenAIWSCompressionTestHandler(512)
+	require.Equal(t, 512, h.openAIWSIngressAcceptOptions().CompressionThreshold)
+	require.Equal(t, coderws.CompressionContextTakeover, h.openAIWSIngressAcceptOptions().CompressionMode)
+
+	// 小于阈值的 delta 原样透传：负载与未协商压缩时一致，仅多一个 2 字节的空结束帧（websocket 库在压缩模式下分帧写出）。
+	delta := []byte(`{"type":"response.output_text.delta","delta":"Hello"}`)
+	server, written := startOpenAIWSCompressionTestServer(t, h, [][]byte{delta}, 1)
+	require.Equal(t, 1, readOpenAIWSUntilClose(t, server, coderws.CompressionContextTakeover))
+	plainServer, plainWritten := startOpenAIWSCompressionTestServer(t, h, [][]byte{delta}, 1)
+	require.Equal(t, 1, readOpenAIWSUntilClose(t, plainServer, coderws.CompressionDisabled))
+	require.Equal(t, plainWritten.Load()+2, written.Load())
+
+	// 超过阈值的大事件按协商的压缩下发。
+	large := buildOpenAIWSReasoningOutputEvent(16 * 1024)
+	server, written = startOpenAIWSCompressionTestServer(t, h, [][]byte{large}, 1)
+	require.Equal(t, 1, readOpenAIWSUntilClose(t, server, coderws.CompressionContextTakeover))
+	require.Less(t, written.Load(), int64(len(large)/2))
+}
+
+// BenchmarkOpenAIWSIngressDownstreamCompression 对比大段推理输出在协商压缩与未压缩时的下发带宽（wire_B/op 对比 raw_B/op）。
+func BenchmarkOpenAIWSIngressDownstreamCompression(b *testing.B) {
+	messages := [][]byte{
+		[]byte(`{"type":"response.reasoning_summary_text.delta","delta":"Let"}`),
+		buildOpenAIWSReasoningOutputEvent(8 * 1024),
+		buildOpenAIWSReasoningOutputEvent(32 * 1024),
+	}
+	raw := 0
+	for _, message := range messages {
+		raw += len(message)
+	}
+	for _, tc := range []struct {
+		name string
+		mode coderws.CompressionMode
+	}{
+		{name: "compressed", mode: coderws.CompressionContextTakeover},
+		{name: "uncompressed", mode: coderws.CompressionDisabled},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			server, written := startOpenAIWSCompressionTestServer(b, newOpenAIWSCompressionTestHandler(512), messages, b.N)
+			b.SetBytes(int64(raw))
+			b.ResetTimer()
+			readOpenAIWSUntilClose(b, server, tc.mode)
+			b.StopTimer()
+			b.ReportMetric(float64(raw), "raw_B/op")
+			b.ReportMetric(float64(written.Load())/float64(b.N), "wire_B/op")
+		})
+	}
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"time"
@@ -12,6 +13,7 @@ import (
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 
 	"github.com/Wei-Shaw/sub2api/internal/service"
 )
@@ -22,6 +24,9 @@ type S3BackupStore struct {
 	bucket string
 }
 
+// 本地备份按分片上传，支持中断后续传
+var _ service.BackupMultipartObjectStore = (*S3BackupStore)(nil)
+
 // NewS3BackupStoreFactory returns a BackupObjectStoreFactory that creates S3-backed stores
 func NewS3BackupStoreFactory() service.BackupObjectStoreFactory {
 	return func(ctx context.Context, cfg *service.BackupS3Config) (service.BackupObjectStore, error) {
@@ -74,6 +79,74 @@ func (s *S3BackupStore) Upload(ctx context.Context, key string, body io.Reader,
 	return int64(len(data)), nil
 }
 
+func (s *S3BackupStore) CreateMultipartUpload(ctx context.Context, key string, contentType string) (string, error) {
+	result, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      &s.bucket,
+		Key:         &key,
+		ContentType: &contentType,
+	})
+	if err != nil {
+		return "", fmt.Errorf("S3 CreateMultipartUpload: %w", err)
+	}
+	return aws.ToString(result.UploadId), nil
+}
+
+func (s *S3BackupStore) UploadPart(ctx context.Context, key, uploadID string, partNumber int32, body io.Reader, size int64) (string, error) {
+	result, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        &s.bucket,
+		Key:           &key,
+		UploadId:      &uploadID,
+		PartNumber:    &partNumber,
+		Body:          body,
+		ContentLength: &size,
+	})
+	if err != nil {
+		return "", wrapS3MultipartError("S3 UploadPart", err)
+	}
+	return aws.ToString(result.ETag), nil
+}
+
+func (s *S3BackupStore) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []service.BackupUploadPart) error {
+	completed := make([]s3types.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, s3types.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int32(part.PartNumber),
+		})
+	}
+	_, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &s.bucket,
+		Key:             &key,
+		UploadId:        &uploadID,
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return wrapS3MultipartError("S3 CompleteMultipartUpload", err)
+	}
+	return nil
+}
+
+func (s *S3BackupStore) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   &s.bucket,
+		Key:      &key,
+		UploadId: &uploadID,
+	})
+	if err != nil {
+		return wrapS3MultipartError("S3 AbortMultipartUpload", err)
+	}
+	return nil
+}
+
+// wrapS3MultipartError 将分片上传已失效（被中止或过期）映射为 service 层可识别的错误
+func wrapS3MultipartError(op string, err error) error {
+	var noSuchUpload *s3types.NoSuchUpload
+	if errors.As(err, &noSuchUpload) {
+		return fmt.Errorf("%s: %w", op, service.ErrBackupMultipartUploadNotFound)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
 func (s *S3BackupStore) Download(ctx context.Context, key string) (io.ReadCloser, error) {
 	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: &s.bucket,
@@ -9,6 +9,7 @@ import (
 
 	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
 	"github.com/Wei-Shaw/sub2api/internal/pkg/response"
+	"github.com/Wei-Shaw/sub2api/internal/service"
 	"github.com/gin-gonic/gin"
 )
 
@@ -44,6 +45,23 @@ func Recovery() gin.HandlerFunc {
 	})
 }
 
+// SchedulerStateDumpOnPanic 在 handler panic 时先写出调度状态快照（需启用 --dump-state-on-panic），
+// 再原样重新 panic 交由外层 Recovery 转换为错误响应，因此必须注册在 Recovery 之后。
+// http.ErrAbortHandler 是主动中断请求的约定信号，不视为崩溃。
+func SchedulerStateDumpOnPanic() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				if r != http.ErrAbortHandler {
+					service.DumpOpenAISchedulerStateOnPanic()
+				}
+				panic(r)
+			}
+		}()
+		c.Next()
+	}
+}
+
 func isBrokenPipe(err error) bool {
 	if err == nil {
 		return false
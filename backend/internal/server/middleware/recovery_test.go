@@ -5,12 +5,17 @@ package middleware
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/Wei-Shaw/sub2api/internal/config"
 	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
 	"github.com/Wei-Shaw/sub2api/internal/pkg/response"
+	"github.com/Wei-Shaw/sub2api/internal/service"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/require"
 )
@@ -108,3 +113,48 @@ func TestRecovery(t *testing.T) {
 		})
 	}
 }
+
+func TestSchedulerStateDumpOnPanic_DumpsStateThenDefersToRecovery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	originalWriter := gin.DefaultErrorWriter
+	gin.DefaultErrorWriter = io.Discard
+	t.Cleanup(func() {
+		gin.DefaultErrorWriter = originalWriter
+	})
+
+	path := filepath.Join(t.TempDir(), "scheduler.json")
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.SchedulerStateDumpPath = path
+	gateway := service.NewOpenAIGatewayService(nil, nil, nil, nil, nil, nil, nil, cfg, nil, nil, nil, nil, nil, nil, nil, nil)
+	t.Cleanup(gateway.EnableOpenAISchedulerStateDumpOnPanic())
+
+	r := gin.New()
+	r.Use(Recovery())
+	r.Use(SchedulerStateDumpOnPanic())
+	r.GET("/ok", func(c *gin.Context) {
+		response.Success(c, gin.H{"ok": true})
+	})
+	r.GET("/abort", func(c *gin.Context) {
+		panic(http.ErrAbortHandler)
+	})
+	r.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	for _, target := range []string{"/ok", "/abort"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		_, err := os.Stat(path)
+		require.True(t, os.IsNotExist(err), "%s 不应写调度状态快照", target)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	require.Equal(t, http.StatusInternalServerError, w.Code, "重新 panic 后应由 Recovery 转换为 500")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var dump service.OpenAISchedulerStateDump
+	require.NoError(t, json.Unmarshal(data, &dump))
+	require.Equal(t, "panic", dump.Reason)
+}
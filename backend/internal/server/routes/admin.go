@@ -451,6 +451,10 @@ func registerBackupRoutes(admin *gin.RouterGroup, h *handler.Handlers) {
 		backup.PUT("/s3-config", h.Admin.Backup.UpdateS3Config)
 		backup.POST("/s3-config/test", h.Admin.Backup.TestS3Connection)
 
+		// 备份产物存储模式（remote/local/local_remote）
+		backup.GET("/storage-config", h.Admin.Backup.GetStorageConfig)
+		backup.PUT("/storage-config", h.Admin.Backup.UpdateStorageConfig)
+
 		// 定时备份配置
 		backup.GET("/schedule", h.Admin.Backup.GetSchedule)
 		backup.PUT("/schedule", h.Admin.Backup.UpdateSchedule)
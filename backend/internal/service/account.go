@@ -6,6 +6,7 @@ import (
 	"errors"
 	"hash/fnv"
 	"reflect"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -1085,6 +1086,110 @@ func (a *Account) IsOpenAIWSAllowStoreRecoveryEnabled() bool {
 	return ok && enabled
 }
 
+// GetOpenAIMaxConsecutiveStickyTurns 返回账号级会话连续粘连轮数上限。
+// 字段：accounts.extra.openai_max_consecutive_sticky_turns；未配置或非正数时返回 0（沿用全局配置）。
+func (a *Account) GetOpenAIMaxConsecutiveStickyTurns() int {
+	if a == nil || !a.IsOpenAI() || a.Extra == nil {
+		return 0
+	}
+	if v, ok := a.Extra["openai_max_consecutive_sticky_turns"]; ok {
+		if val := parseExtraInt(v); val > 0 {
+			return val
+		}
+	}
+	return 0
+}
+
+// GetOpenAIMaxStickyLifetimeSeconds 返回账号级会话粘连最长持续秒数。
+// 字段：accounts.extra.openai_max_sticky_lifetime_seconds；未配置或非正数时返回 0（沿用全局配置）。
+func (a *Account) GetOpenAIMaxStickyLifetimeSeconds() int {
+	if a == nil || !a.IsOpenAI() || a.Extra == nil {
+		return 0
+	}
+	if v, ok := a.Extra["openai_max_sticky_lifetime_seconds"]; ok {
+		if val := parseExtraInt(v); val > 0 {
+			return val
+		}
+	}
+	return 0
+}
+
+// GetOpenAIWSMaxIdlePerAccount 返回账号级 WS 连接池空闲连接数上限。
+// 字段：accounts.extra.openai_ws_max_idle_per_account；0 表示不保留空闲连接，未配置或负数时返回 false（沿用全局配置）。
+func (a *Account) GetOpenAIWSMaxIdlePerAccount() (int, bool) {
+	if a == nil || !a.IsOpenAI() || a.Extra == nil {
+		return 0, false
+	}
+	v, ok := a.Extra["openai_ws_max_idle_per_account"]
+	if !ok || v == nil {
+		return 0, false
+	}
+	if str, isString := v.(string); isString && strings.TrimSpace(str) == "" {
+		return 0, false
+	}
+	if val := parseExtraInt(v); val >= 0 {
+		return val, true
+	}
+	return 0, false
+}
+
+// GetOpenAIWSConnIdleTimeoutSeconds 返回账号级 WS 连接空闲回收秒数。
+// 字段：accounts.extra.openai_ws_conn_idle_timeout_seconds；未配置或非正数时返回 0（沿用全局配置）。
+func (a *Account) GetOpenAIWSConnIdleTimeoutSeconds() int {
+	if a == nil || !a.IsOpenAI() || a.Extra == nil {
+		return 0
+	}
+	if v, ok := a.Extra["openai_ws_conn_idle_timeout_seconds"]; ok {
+		if val := parseExtraInt(v); val > 0 {
+			return val
+		}
+	}
+	return 0
+}
+
+// GetOpenAIWSConnMaxLifetimeSeconds 返回账号级 WS 连接最大存活秒数。
+// 字段：accounts.extra.openai_ws_conn_max_lifetime_seconds；未配置或非正数时返回 0（沿用全局 60 分钟）。
+func (a *Account) GetOpenAIWSConnMaxLifetimeSeconds() int {
+	if a == nil || !a.IsOpenAI() || a.Extra == nil {
+		return 0
+	}
+	if v, ok := a.Extra["openai_ws_conn_max_lifetime_seconds"]; ok {
+		if val := parseExtraInt(v); val > 0 {
+			return val
+		}
+	}
+	return 0
+}
+
+// GetOpenAIRegions 返回账号上游所在地域标记（已转小写、去重）。
+// 字段：accounts.extra.openai_regions，支持逗号分隔字符串或字符串数组；未配置时返回 nil。
+func (a *Account) GetOpenAIRegions() []string {
+	if a == nil || !a.IsOpenAI() || a.Extra == nil {
+		return nil
+	}
+	var raw []string
+	switch v := a.Extra["openai_regions"].(type) {
+	case string:
+		raw = strings.Split(v, ",")
+	case []string:
+		raw = v
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				raw = append(raw, s)
+			}
+		}
+	}
+	var regions []string
+	for _, item := range raw {
+		region := normalizeOpenAIRegion(item)
+		if region != "" && !slices.Contains(regions, region) {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
 // IsOpenAIOAuthPassthroughEnabled 兼容旧接口，等价于 OAuth 账号的 IsOpenAIPassthroughEnabled。
 func (a *Account) IsOpenAIOAuthPassthroughEnabled() bool {
 	return a != nil && a.IsOpenAIOAuth() && a.IsOpenAIPassthroughEnabled()
@@ -439,6 +439,12 @@ type adminServiceImpl struct {
 	defaultSubAssigner   DefaultSubscriptionAssigner
 	userSubRepo          UserSubscriptionRepository
 	privacyClientFactory PrivacyClientFactory
+	openAIWSRetirer      OpenAIWSAccountRetirer
+}
+
+// OpenAIWSAccountRetirer 下线账号的 OpenAI 上游 WS 连接（进行中的 turn 完成后关闭）。
+type OpenAIWSAccountRetirer interface {
+	RetireOpenAIWSAccount(accountID int64)
 }
 
 type userGroupRateBatchReader interface {
@@ -490,6 +496,18 @@ func NewAdminService(
 	}
 }
 
+// SetOpenAIWSAccountRetirer 设置账号删除/停用时的 WS 连接下线器（可选依赖）
+func (s *adminServiceImpl) SetOpenAIWSAccountRetirer(retirer OpenAIWSAccountRetirer) {
+	s.openAIWSRetirer = retirer
+}
+
+// retireOpenAIWSAccount 账号被删除或停用后下线其上游 WS 连接。
+func (s *adminServiceImpl) retireOpenAIWSAccount(accountID int64) {
+	if s.openAIWSRetirer != nil {
+		s.openAIWSRetirer.RetireOpenAIWSAccount(accountID)
+	}
+}
+
 // User management implementations
 func (s *adminServiceImpl) ListUsers(ctx context.Context, page, pageSize int, filters UserListFilters) ([]User, int64, error) {
 	params := pagination.PaginationParams{Page: page, PageSize: pageSize}
@@ -1637,6 +1655,9 @@ func (s *adminServiceImpl) UpdateAccount(ctx context.Context, id int64, input *U
 	if err != nil {
 		return nil, err
 	}
+	if !updated.IsActive() || !updated.Schedulable {
+		s.retireOpenAIWSAccount(updated.ID)
+	}
 	return updated, nil
 }
 
@@ -1733,6 +1754,11 @@ func (s *adminServiceImpl) BulkUpdateAccounts(ctx context.Context, input *BulkUp
 	if _, err := s.accountRepo.BulkUpdate(ctx, input.AccountIDs, repoUpdates); err != nil {
 		return nil, err
 	}
+	if (input.Status != "" && input.Status != StatusActive) || (input.Schedulable != nil && !*input.Schedulable) {
+		for _, accountID := range input.AccountIDs {
+			s.retireOpenAIWSAccount(accountID)
+		}
+	}
 
 	// Handle group bindings per account (requires individual operations).
 	for _, accountID := range input.AccountIDs {
@@ -1762,6 +1788,7 @@ func (s *adminServiceImpl) DeleteAccount(ctx context.Context, id int64) error {
 	if err := s.accountRepo.Delete(ctx, id); err != nil {
 		return err
 	}
+	s.retireOpenAIWSAccount(id)
 	return nil
 }
 
@@ -1782,13 +1809,20 @@ func (s *adminServiceImpl) ClearAccountError(ctx context.Context, id int64) (*Ac
 }
 
 func (s *adminServiceImpl) SetAccountError(ctx context.Context, id int64, errorMsg string) error {
-	return s.accountRepo.SetError(ctx, id, errorMsg)
+	if err := s.accountRepo.SetError(ctx, id, errorMsg); err != nil {
+		return err
+	}
+	s.retireOpenAIWSAccount(id)
+	return nil
 }
 
 func (s *adminServiceImpl) SetAccountSchedulable(ctx context.Context, id int64, schedulable bool) (*Account, error) {
 	if err := s.accountRepo.SetSchedulable(ctx, id, schedulable); err != nil {
 		return nil, err
 	}
+	if !schedulable {
+		s.retireOpenAIWSAccount(id)
+	}
 	updated, err := s.accountRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+)
+
+// backupMultipartPartSize 分片上传的分片大小；本地备份文件不超过一个分片时直接整体上传。
+// S3 要求除最后一片外每片不小于 5MiB。
+var backupMultipartPartSize int64 = 16 << 20
+
+// ErrBackupMultipartUploadNotFound 对象存储上的分片上传已不存在（被中止或过期），需要重新开始上传
+var ErrBackupMultipartUploadNotFound = infraerrors.NotFound("BACKUP_MULTIPART_UPLOAD_NOT_FOUND", "multipart upload no longer exists")
+
+// BackupMultipartObjectStore 支持分片上传的对象存储。
+// BackupObjectStore 实现该接口时，本地备份按分片上传并可从最后完成的分片继续。
+type BackupMultipartObjectStore interface {
+	CreateMultipartUpload(ctx context.Context, key string, contentType string) (uploadID string, err error)
+	UploadPart(ctx context.Context, key, uploadID string, partNumber int32, body io.Reader, size int64) (etag string, err error)
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []BackupUploadPart) error
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+}
+
+// BackupUploadState 进行中的分片上传进度，随备份记录持久化，用于失败或进程重启后续传
+type BackupUploadState struct {
+	UploadID string             `json:"upload_id"`
+	PartSize int64              `json:"part_size"`
+	Parts    []BackupUploadPart `json:"parts"` // 已完成的分片，按分片号递增
+}
+
+// BackupUploadPart 已完成上传的分片
+type BackupUploadPart struct {
+	PartNumber int32  `json:"part_number"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size"`
+}
+
+func (st *BackupUploadState) uploadedBytes() int64 {
+	var total int64
+	for _, part := range st.Parts {
+		total += part.Size
+	}
+	return total
+}
+
+// tryBeginUpload 标记备份正在上传，避免首次上传与定时重试并发上传同一份备份
+func (s *BackupService) tryBeginUpload(backupID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, busy := s.uploading[backupID]; busy {
+		return false
+	}
+	if s.uploading == nil {
+		s.uploading = make(map[string]struct{})
+	}
+	s.uploading[backupID] = struct{}{}
+	return true
+}
+
+func (s *BackupService) endUpload(backupID string) {
+	s.mu.Lock()
+	delete(s.uploading, backupID)
+	s.mu.Unlock()
+}
+
+// uploadLocalBackup 将本地备份文件上传到对象存储。
+// 对象存储支持分片上传且文件超过一个分片时按分片上传，每完成一个分片即写回备份记录，
+// 上传中断（失败或进程崩溃）后再次调用会从最后完成的分片继续，而不是从头重传。
+func (s *BackupService) uploadLocalBackup(ctx context.Context, objectStore BackupObjectStore, record *BackupRecord) error {
+	file, err := os.Open(record.LocalPath)
+	if err != nil {
+		return fmt.Errorf("open local backup: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	multipart, ok := objectStore.(BackupMultipartObjectStore)
+	if !ok {
+		_, err := objectStore.Upload(ctx, record.S3Key, file, "application/gzip")
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat local backup: %w", err)
+	}
+	if record.UploadState == nil && info.Size() <= backupMultipartPartSize {
+		_, err := objectStore.Upload(ctx, record.S3Key, file, "application/gzip")
+		return err
+	}
+
+	err = s.uploadLocalBackupParts(ctx, multipart, record, file, info.Size())
+	if errors.Is(err, ErrBackupMultipartUploadNotFound) {
+		// 分片上传在对象存储侧已失效，清除进度后从头开始
+		logger.LegacyPrintf("service.backup", "[Backup] 分片上传已失效，重新开始上传: id=%s", record.ID)
+		if err := s.saveUploadState(ctx, record, nil); err != nil {
+			return err
+		}
+		err = s.uploadLocalBackupParts(ctx, multipart, record, file, info.Size())
+	}
+	return err
+}
+
+func (s *BackupService) uploadLocalBackupParts(ctx context.Context, store BackupMultipartObjectStore, record *BackupRecord, file *os.File, size int64) error {
+	state := record.UploadState
+	if state == nil {
+		uploadID, err := store.CreateMultipartUpload(ctx, record.S3Key, "application/gzip")
+		if err != nil {
+			return fmt.Errorf("create multipart upload: %w", err)
+		}
+		state = &BackupUploadState{UploadID: uploadID, PartSize: backupMultipartPartSize}
+		if err := s.saveUploadState(ctx, record, state); err != nil {
+			return err
+		}
+	}
+
+	offset := state.uploadedBytes()
+	for offset < size {
+		partSize := min(state.PartSize, size-offset)
+		partNumber := int32(len(state.Parts) + 1)
+		etag, err := store.UploadPart(ctx, record.S3Key, state.UploadID, partNumber, io.NewSectionReader(file, offset, partSize), partSize)
+		if err != nil {
+			return fmt.Errorf("upload part %d: %w", partNumber, err)
+		}
+		next := &BackupUploadState{
+			UploadID: state.UploadID,
+			PartSize: state.PartSize,
+			Parts:    append(append([]BackupUploadPart(nil), state.Parts...), BackupUploadPart{PartNumber: partNumber, ETag: etag, Size: partSize}),
+		}
+		if err := s.saveUploadState(ctx, record, next); err != nil {
+			return err
+		}
+		state = next
+		offset += partSize
+	}
+
+	if err := store.CompleteMultipartUpload(ctx, record.S3Key, state.UploadID, state.Parts); err != nil {
+		return fmt.Errorf("complete multipart upload: %w", err)
+	}
+	return s.saveUploadState(ctx, record, nil)
+}
+
+// saveUploadState 更新内存记录并写回持久化记录中的分片上传进度；记录已被删除时返回错误以中止上传
+func (s *BackupService) saveUploadState(ctx context.Context, record *BackupRecord, state *BackupUploadState) error {
+	record.UploadState = state
+	found, err := s.updateRecord(ctx, record.ID, func(stored *BackupRecord) {
+		stored.UploadState = state
+	})
+	if err != nil {
+		return fmt.Errorf("save upload state: %w", err)
+	}
+	if !found {
+		return ErrBackupNotFound
+	}
+	return nil
+}
+
+// abortBackupMultipartUpload 中止未完成的分片上传，释放对象存储上已上传的分片
+func abortBackupMultipartUpload(ctx context.Context, objectStore BackupObjectStore, record *BackupRecord) {
+	if record.UploadState == nil {
+		return
+	}
+	multipart, ok := objectStore.(BackupMultipartObjectStore)
+	if !ok {
+		return
+	}
+	if err := multipart.AbortMultipartUpload(ctx, record.S3Key, record.UploadState.UploadID); err != nil {
+		logger.LegacyPrintf("service.backup", "[Backup] 中止分片上传失败: id=%s err=%v", record.ID, err)
+	}
+}
@@ -85,7 +85,7 @@ type BackupScheduleConfig struct {
 // BackupRecord 备份记录
 type BackupRecord struct {
 	ID          string `json:"id"`
-	Status      string `json:"status"`      // pending, running, completed, failed
+	Status      string `json:"status"`      // pending, running, completed, partial, failed
 	BackupType  string `json:"backup_type"` // postgres
 	FileName    string `json:"file_name"`
 	S3Key       string `json:"s3_key"`
@@ -95,6 +95,17 @@ type BackupRecord struct {
 	StartedAt   string `json:"started_at"`
 	FinishedAt  string `json:"finished_at,omitempty"`
 	ExpiresAt   string `json:"expires_at,omitempty"` // 过期时间
+
+	StorageMode    string `json:"storage_mode,omitempty"`    // remote, local, local_remote
+	LocalPath      string `json:"local_path,omitempty"`      // 本地副本路径
+	UploadStatus   string `json:"upload_status,omitempty"`   // uploaded, pending, failed
+	UploadAttempts int    `json:"upload_attempts,omitempty"` // 上传尝试次数（含自动重试）
+	UploadError    string `json:"upload_error,omitempty"`
+
+	ChecksumSHA256 string              `json:"checksum_sha256,omitempty"` // 压缩产物的 SHA-256
+	Timings        *BackupPhaseTimings `json:"timings,omitempty"`         // 各阶段耗时，仅成功（含 partial）的备份记录
+
+	UploadState *BackupUploadState `json:"upload_state,omitempty"` // 未完成的分片上传进度，上传完成或放弃后清空
 }
 
 // BackupService 数据库备份恢复服务
@@ -110,6 +121,10 @@ type BackupService struct {
 	s3Cfg     *BackupS3Config
 	backingUp bool
 	restoring bool
+	// retryingUploads 防止上传重试任务重叠执行
+	retryingUploads bool
+	// uploading 正在上传到对象存储的本地备份 ID，避免首次上传与重试任务并发上传同一份备份
+	uploading map[string]struct{}
 
 	recordsMu sync.Mutex // 保护 records 的 load/save 操作
 
@@ -139,6 +154,11 @@ func (s *BackupService) Start() {
 	s.cronSched = cron.New()
 	s.cronSched.Start()
 
+	// 部分成功（本地已写入、上传失败）的备份定期重试上传
+	if _, err := s.cronSched.AddFunc(backupUploadRetrySpec, s.runUploadRetry); err != nil {
+		logger.LegacyPrintf("service.backup", "[Backup] 注册上传重试任务失败: %v", err)
+	}
+
 	// 加载已有的定时配置
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -343,7 +363,8 @@ func (s *BackupService) runScheduledBackup() {
 
 // ─── 备份/恢复核心 ───
 
-// CreateBackup 创建全量数据库备份并上传到 S3（流式处理）
+// CreateBackup 创建全量数据库备份，按存储模式写入本地磁盘和/或上传到 S3
+// remote 模式流式上传；local_remote 模式先落盘再上传，上传失败时记录为 partial 并由定时任务重试
 // expireDays: 备份过期天数，0=永不过期，默认14天
 func (s *BackupService) CreateBackup(ctx context.Context, triggeredBy string, expireDays int) (*BackupRecord, error) {
 	s.mu.Lock()
@@ -359,23 +380,34 @@ func (s *BackupService) CreateBackup(ctx context.Context, triggeredBy string, ex
 		s.mu.Unlock()
 	}()
 
-	s3Cfg, err := s.loadS3Config(ctx)
+	storageCfg, err := s.loadStorageConfig(ctx)
 	if err != nil {
 		return nil, err
 	}
-	if s3Cfg == nil || !s3Cfg.IsConfigured() {
-		return nil, ErrBackupS3NotConfigured
-	}
 
-	objectStore, err := s.getOrCreateStore(ctx, s3Cfg)
-	if err != nil {
-		return nil, fmt.Errorf("init object store: %w", err)
+	var objectStore BackupObjectStore
+	var s3Cfg *BackupS3Config
+	if storageCfg.Mode != BackupStorageModeLocal {
+		s3Cfg, err = s.loadS3Config(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if s3Cfg == nil || !s3Cfg.IsConfigured() {
+			return nil, ErrBackupS3NotConfigured
+		}
+		objectStore, err = s.getOrCreateStore(ctx, s3Cfg)
+		if err != nil {
+			return nil, fmt.Errorf("init object store: %w", err)
+		}
 	}
 
 	now := time.Now()
 	backupID := uuid.New().String()[:8]
 	fileName := fmt.Sprintf("%s_%s.sql.gz", s.dbCfg.DBName, now.Format("20060102_150405"))
-	s3Key := s.buildS3Key(s3Cfg, fileName)
+	var s3Key string
+	if s3Cfg != nil {
+		s3Key = s.buildS3Key(s3Cfg, fileName)
+	}
 
 	var expiresAt string
 	if expireDays > 0 {
@@ -391,10 +423,14 @@ func (s *BackupService) CreateBackup(ctx context.Context, triggeredBy string, ex
 		TriggeredBy: triggeredBy,
 		StartedAt:   now.Format(time.RFC3339),
 		ExpiresAt:   expiresAt,
+		StorageMode: storageCfg.Mode,
 	}
 
 	// 流式执行: pg_dump -> gzip -> S3 upload
+	timer := newBackupPhaseTimer()
+	dumpBegin := time.Now()
 	dumpReader, err := s.dumper.Dump(ctx)
+	addBackupPhase(&timer.read, dumpBegin)
 	if err != nil {
 		record.Status = "failed"
 		record.ErrorMsg = fmt.Sprintf("pg_dump failed: %v", err)
@@ -403,18 +439,23 @@ func (s *BackupService) CreateBackup(ctx context.Context, triggeredBy string, ex
 		return record, fmt.Errorf("pg_dump: %w", err)
 	}
 
+	if storageCfg.Mode != BackupStorageModeRemote {
+		return s.createLocalBackup(ctx, record, storageCfg, objectStore, dumpReader, timer)
+	}
+
 	// 使用 io.Pipe 将 gzip 压缩数据流式传递给 S3 上传
 	pr, pw := io.Pipe()
 	var gzipErr error
+	var checksum string
+	var streamEnd time.Time
+	streamDone := make(chan struct{})
 	go func() {
-		gzWriter := gzip.NewWriter(pw)
-		_, gzipErr = io.Copy(gzWriter, dumpReader)
-		if closeErr := gzWriter.Close(); closeErr != nil && gzipErr == nil {
-			gzipErr = closeErr
-		}
+		defer close(streamDone)
+		checksum, gzipErr = compressBackupStream(pw, &timer.upload, dumpReader, timer)
 		if closeErr := dumpReader.Close(); closeErr != nil && gzipErr == nil {
 			gzipErr = closeErr
 		}
+		streamEnd = time.Now()
 		if gzipErr != nil {
 			_ = pw.CloseWithError(gzipErr)
 		} else {
@@ -436,8 +477,15 @@ func (s *BackupService) CreateBackup(ctx context.Context, triggeredBy string, ex
 		return record, fmt.Errorf("backup upload: %w", err)
 	}
 
+	// 上传成功意味着管道已读到 EOF，压缩 goroutine 已结束；管道关闭后上传端的收尾耗时计入 upload
+	<-streamDone
+	addBackupPhase(&timer.upload, streamEnd)
 	record.SizeBytes = sizeBytes
 	record.Status = "completed"
+	record.UploadStatus = BackupUploadStatusUploaded
+	record.UploadAttempts = 1
+	record.ChecksumSHA256 = checksum
+	record.Timings = timer.snapshot()
 	record.FinishedAt = time.Now().Format(time.RFC3339)
 	if err := s.saveRecord(ctx, record); err != nil {
 		logger.LegacyPrintf("service.backup", "[Backup] 保存备份记录失败: %v", err)
@@ -446,7 +494,58 @@ func (s *BackupService) CreateBackup(ctx context.Context, triggeredBy string, ex
 	return record, nil
 }
 
-// RestoreBackup 从 S3 下载备份并流式恢复到数据库
+// createLocalBackup 处理 local / local_remote 模式：先落盘，local_remote 再上传本地文件
+func (s *BackupService) createLocalBackup(ctx context.Context, record *BackupRecord, storageCfg *BackupStorageConfig, objectStore BackupObjectStore, dumpReader io.ReadCloser, timer *backupPhaseTimer) (*BackupRecord, error) {
+	localPath, sizeBytes, checksum, err := writeLocalBackup(storageCfg.resolvedLocalDir(), record.FileName, dumpReader, timer)
+	if closeErr := dumpReader.Close(); closeErr != nil && err == nil {
+		err = closeErr
+		removeLocalBackup(localPath)
+	}
+	if err != nil {
+		record.Status = "failed"
+		record.ErrorMsg = fmt.Sprintf("local write failed: %v", err)
+		record.FinishedAt = time.Now().Format(time.RFC3339)
+		_ = s.saveRecord(ctx, record)
+		return record, fmt.Errorf("backup local write: %w", err)
+	}
+	record.LocalPath = localPath
+	record.SizeBytes = sizeBytes
+	record.ChecksumSHA256 = checksum
+	record.Status = "completed"
+
+	if storageCfg.Mode == BackupStorageModeLocalRemote {
+		record.UploadAttempts = 1
+		// 上传前先以 partial/pending 落库：上传期间进程崩溃时由重试任务接手，分片上传进度随记录续传
+		record.Status = backupStatusPartial
+		record.UploadStatus = BackupUploadStatusPending
+		if err := s.saveRecord(ctx, record); err != nil {
+			logger.LegacyPrintf("service.backup", "[Backup] 保存备份记录失败: %v", err)
+		}
+		record.Status = "completed"
+		s.tryBeginUpload(record.ID)
+		uploadBegin := time.Now()
+		err := s.uploadLocalBackup(ctx, objectStore, record)
+		addBackupPhase(&timer.upload, uploadBegin)
+		s.endUpload(record.ID)
+		if err != nil {
+			record.Status = backupStatusPartial
+			record.UploadStatus = BackupUploadStatusPending
+			record.UploadError = err.Error()
+			logger.LegacyPrintf("service.backup", "[Backup] 备份已写入本地但上传失败，稍后重试: id=%s err=%v", record.ID, err)
+		} else {
+			record.UploadStatus = BackupUploadStatusUploaded
+		}
+	}
+
+	record.Timings = timer.snapshot()
+	record.FinishedAt = time.Now().Format(time.RFC3339)
+	if err := s.saveRecord(ctx, record); err != nil {
+		logger.LegacyPrintf("service.backup", "[Backup] 保存备份记录失败: %v", err)
+	}
+	return record, nil
+}
+
+// RestoreBackup 读取备份（优先本地副本，否则从 S3 下载）并流式恢复到数据库
 func (s *BackupService) RestoreBackup(ctx context.Context, backupID string) error {
 	s.mu.Lock()
 	if s.restoring {
@@ -465,24 +564,14 @@ func (s *BackupService) RestoreBackup(ctx context.Context, backupID string) erro
 	if err != nil {
 		return err
 	}
-	if record.Status != "completed" {
+	if !record.isRestorable() {
 		return infraerrors.BadRequest("BACKUP_NOT_COMPLETED", "can only restore from a completed backup")
 	}
 
-	s3Cfg, err := s.loadS3Config(ctx)
+	body, err := s.openBackupArtifact(ctx, record)
 	if err != nil {
 		return err
 	}
-	objectStore, err := s.getOrCreateStore(ctx, s3Cfg)
-	if err != nil {
-		return fmt.Errorf("init object store: %w", err)
-	}
-
-	// 从 S3 流式下载
-	body, err := objectStore.Download(ctx, record.S3Key)
-	if err != nil {
-		return fmt.Errorf("S3 download failed: %w", err)
-	}
 	defer func() { _ = body.Close() }()
 
 	// 流式解压 gzip -> psql（不将全部数据加载到内存）
@@ -549,13 +638,18 @@ func (s *BackupService) DeleteBackup(ctx context.Context, backupID string) error
 		return ErrBackupNotFound
 	}
 
-	// 从 S3 删除
-	if found.S3Key != "" && found.Status == "completed" {
+	removeLocalBackup(found.LocalPath)
+
+	// 从 S3 删除；未完成的分片上传一并中止，避免残留分片占用存储
+	if (found.hasRemoteCopy() && found.Status == "completed") || found.UploadState != nil {
 		s3Cfg, err := s.loadS3Config(ctx)
 		if err == nil && s3Cfg != nil && s3Cfg.IsConfigured() {
 			objectStore, err := s.getOrCreateStore(ctx, s3Cfg)
 			if err == nil {
-				_ = objectStore.Delete(ctx, found.S3Key)
+				abortBackupMultipartUpload(ctx, objectStore, found)
+				if found.hasRemoteCopy() && found.Status == "completed" {
+					_ = objectStore.Delete(ctx, found.S3Key)
+				}
 			}
 		}
 	}
@@ -572,6 +666,9 @@ func (s *BackupService) GetBackupDownloadURL(ctx context.Context, backupID strin
 	if record.Status != "completed" {
 		return "", infraerrors.BadRequest("BACKUP_NOT_COMPLETED", "backup is not completed")
 	}
+	if !record.hasRemoteCopy() {
+		return "", infraerrors.BadRequest("BACKUP_NOT_REMOTE", "backup has no remote copy to download")
+	}
 
 	s3Cfg, err := s.loadS3Config(ctx)
 	if err != nil {
@@ -699,6 +796,24 @@ func (s *BackupService) saveRecord(ctx context.Context, record *BackupRecord) er
 	return s.saveRecordsLocked(ctx, records)
 }
 
+// updateRecord 在锁内修改已有记录，记录不存在时返回 false 且不写回
+func (s *BackupService) updateRecord(ctx context.Context, backupID string, mutate func(*BackupRecord)) (bool, error) {
+	s.recordsMu.Lock()
+	defer s.recordsMu.Unlock()
+
+	records, err := s.loadRecordsLocked(ctx)
+	if err != nil {
+		return false, err
+	}
+	for i := range records {
+		if records[i].ID == backupID {
+			mutate(&records[i])
+			return true, s.saveRecordsLocked(ctx, records)
+		}
+	}
+	return false, nil
+}
+
 func (s *BackupService) cleanupOldBackups(ctx context.Context, schedule *BackupScheduleConfig) error {
 	if schedule == nil {
 		return nil
@@ -736,16 +851,17 @@ func (s *BackupService) cleanupOldBackups(ctx context.Context, schedule *BackupS
 			}
 		}
 
-		if shouldDelete && r.Status == "completed" {
+		if shouldDelete && r.isRestorable() {
 			toDelete = append(toDelete, r)
 		} else {
 			toKeep = append(toKeep, r)
 		}
 	}
 
-	// 删除 S3 上的文件
+	// 删除本地与 S3 上的文件
 	for _, r := range toDelete {
-		if r.S3Key != "" {
+		removeLocalBackup(r.LocalPath)
+		if r.hasRemoteCopy() {
 			_ = s.deleteS3Object(ctx, r.S3Key)
 		}
 	}
@@ -5,9 +5,14 @@ package service
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
@@ -113,15 +118,33 @@ type mockDumper struct {
 	dumpErr  error
 	restored []byte
 	restErr  error
+	// readDelay 每次读取 dump 输出前的等待，模拟慢速 pg_dump
+	readDelay time.Duration
 }
 
 func (m *mockDumper) Dump(_ context.Context) (io.ReadCloser, error) {
 	if m.dumpErr != nil {
 		return nil, m.dumpErr
 	}
+	if m.readDelay > 0 {
+		return io.NopCloser(&slowReader{r: bytes.NewReader(m.dumpData), delay: m.readDelay}), nil
+	}
 	return io.NopCloser(bytes.NewReader(m.dumpData)), nil
 }
 
+type slowReader struct {
+	r     io.Reader
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	if len(p) > 4096 {
+		p = p[:4096]
+	}
+	return r.r.Read(p)
+}
+
 func (m *mockDumper) Restore(_ context.Context, data io.Reader) error {
 	if m.restErr != nil {
 		return m.restErr
@@ -135,8 +158,9 @@ func (m *mockDumper) Restore(_ context.Context, data io.Reader) error {
 }
 
 type mockObjectStore struct {
-	objects map[string][]byte
-	mu      sync.Mutex
+	objects   map[string][]byte
+	uploadErr error
+	mu        sync.Mutex
 }
 
 func newMockObjectStore() *mockObjectStore {
@@ -144,6 +168,12 @@ func newMockObjectStore() *mockObjectStore {
 }
 
 func (m *mockObjectStore) Upload(_ context.Context, key string, body io.Reader, _ string) (int64, error) {
+	m.mu.Lock()
+	uploadErr := m.uploadErr
+	m.mu.Unlock()
+	if uploadErr != nil {
+		return 0, uploadErr
+	}
 	data, err := io.ReadAll(body)
 	if err != nil {
 		return 0, err
@@ -179,7 +209,88 @@ func (m *mockObjectStore) HeadBucket(_ context.Context) error {
 	return nil
 }
 
+// mockMultipartObjectStore 在 mockObjectStore 基础上支持分片上传，failPart 指定的分片首次上传失败
+type mockMultipartObjectStore struct {
+	*mockObjectStore
+	uploads    map[string]map[int32][]byte
+	partCalls  map[int32]int
+	failPart   int32
+	nextID     int
+	abortedIDs []string
+}
+
+func newMockMultipartObjectStore() *mockMultipartObjectStore {
+	return &mockMultipartObjectStore{
+		mockObjectStore: newMockObjectStore(),
+		uploads:         make(map[string]map[int32][]byte),
+		partCalls:       make(map[int32]int),
+	}
+}
+
+func (m *mockMultipartObjectStore) CreateMultipartUpload(_ context.Context, _ string, _ string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	uploadID := fmt.Sprintf("upload-%d", m.nextID)
+	m.uploads[uploadID] = make(map[int32][]byte)
+	return uploadID, nil
+}
+
+func (m *mockMultipartObjectStore) UploadPart(_ context.Context, _ string, uploadID string, partNumber int32, body io.Reader, size int64) (string, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.partCalls[partNumber]++
+	if partNumber == m.failPart {
+		m.failPart = 0
+		return "", fmt.Errorf("connection reset")
+	}
+	parts, ok := m.uploads[uploadID]
+	if !ok {
+		return "", ErrBackupMultipartUploadNotFound
+	}
+	if int64(len(data)) != size {
+		return "", fmt.Errorf("part size mismatch: %d != %d", len(data), size)
+	}
+	parts[partNumber] = data
+	return fmt.Sprintf("etag-%d", partNumber), nil
+}
+
+func (m *mockMultipartObjectStore) CompleteMultipartUpload(_ context.Context, key, uploadID string, parts []BackupUploadPart) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	uploaded, ok := m.uploads[uploadID]
+	if !ok {
+		return ErrBackupMultipartUploadNotFound
+	}
+	var buf bytes.Buffer
+	for i, part := range parts {
+		if part.PartNumber != int32(i+1) || part.ETag != fmt.Sprintf("etag-%d", part.PartNumber) {
+			return fmt.Errorf("unexpected part %+v", part)
+		}
+		buf.Write(uploaded[part.PartNumber])
+	}
+	m.objects[key] = buf.Bytes()
+	delete(m.uploads, uploadID)
+	return nil
+}
+
+func (m *mockMultipartObjectStore) AbortMultipartUpload(_ context.Context, _ string, uploadID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.uploads, uploadID)
+	m.abortedIDs = append(m.abortedIDs, uploadID)
+	return nil
+}
+
 func newTestBackupService(repo *mockSettingRepo, dumper *mockDumper, store *mockObjectStore) *BackupService {
+	return newTestBackupServiceWithStore(repo, dumper, store)
+}
+
+func newTestBackupServiceWithStore(repo *mockSettingRepo, dumper *mockDumper, store BackupObjectStore) *BackupService {
 	cfg := &config.Config{
 		Database: config.DatabaseConfig{
 			Host:   "localhost",
@@ -526,3 +637,289 @@ func TestBackupService_LoadS3Config_Corrupted(t *testing.T) {
 	require.Error(t, err)
 	require.Nil(t, cfg)
 }
+
+func seedStorageConfig(t *testing.T, repo *mockSettingRepo, mode, dir string) {
+	t.Helper()
+	data, _ := json.Marshal(BackupStorageConfig{Mode: mode, LocalDir: dir})
+	require.NoError(t, repo.Set(context.Background(), settingKeyBackupStorageConfig, string(data)))
+}
+
+func TestBackupService_UpdateStorageConfig_Validation(t *testing.T) {
+	repo := newMockSettingRepo()
+	svc := newTestBackupService(repo, &mockDumper{}, newMockObjectStore())
+
+	_, err := svc.UpdateStorageConfig(context.Background(), BackupStorageConfig{Mode: "ftp"})
+	require.ErrorIs(t, err, ErrInvalidBackupStorageMode)
+
+	cfg, err := svc.GetStorageConfig(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, BackupStorageModeRemote, cfg.Mode, "未配置时默认 remote")
+
+	saved, err := svc.UpdateStorageConfig(context.Background(), BackupStorageConfig{Mode: " local_remote ", LocalDir: " /data/backups "})
+	require.NoError(t, err)
+	require.Equal(t, BackupStorageModeLocalRemote, saved.Mode)
+	require.Equal(t, "/data/backups", saved.LocalDir)
+}
+
+func TestBackupService_CreateBackup_LocalOnly(t *testing.T) {
+	repo := newMockSettingRepo()
+	dir := t.TempDir()
+	seedStorageConfig(t, repo, BackupStorageModeLocal, dir)
+
+	dumpContent := "-- PostgreSQL dump\nCREATE TABLE test (id int);\n"
+	dumper := &mockDumper{dumpData: []byte(dumpContent)}
+	store := newMockObjectStore()
+	svc := newTestBackupService(repo, dumper, store)
+
+	// local 模式不要求 S3 配置
+	record, err := svc.CreateBackup(context.Background(), "manual", 14)
+	require.NoError(t, err)
+	require.Equal(t, "completed", record.Status)
+	require.Empty(t, record.S3Key)
+	require.Equal(t, filepath.Join(dir, record.FileName), record.LocalPath)
+	info, err := os.Stat(record.LocalPath)
+	require.NoError(t, err)
+	require.Equal(t, info.Size(), record.SizeBytes)
+	store.mu.Lock()
+	require.Empty(t, store.objects)
+	store.mu.Unlock()
+
+	_, err = svc.GetBackupDownloadURL(context.Background(), record.ID)
+	require.Error(t, err, "仅本地备份无法生成下载链接")
+
+	require.NoError(t, svc.RestoreBackup(context.Background(), record.ID))
+	require.Equal(t, dumpContent, string(dumper.restored))
+
+	require.NoError(t, svc.DeleteBackup(context.Background(), record.ID))
+	_, err = os.Stat(record.LocalPath)
+	require.True(t, os.IsNotExist(err), "删除备份应同时删除本地文件")
+}
+
+func TestBackupService_CreateBackup_LocalRemote_PartialThenRetry(t *testing.T) {
+	repo := newMockSettingRepo()
+	seedS3Config(t, repo)
+	seedStorageConfig(t, repo, BackupStorageModeLocalRemote, t.TempDir())
+
+	dumpContent := "-- PostgreSQL dump\n"
+	dumper := &mockDumper{dumpData: []byte(dumpContent)}
+	store := newMockObjectStore()
+	store.uploadErr = fmt.Errorf("bucket unreachable")
+	svc := newTestBackupService(repo, dumper, store)
+
+	record, err := svc.CreateBackup(context.Background(), "manual", 14)
+	require.NoError(t, err, "本地已写入时上传失败不应视为整体失败")
+	require.Equal(t, backupStatusPartial, record.Status)
+	require.Equal(t, BackupUploadStatusPending, record.UploadStatus)
+	require.Equal(t, 1, record.UploadAttempts)
+	require.Contains(t, record.UploadError, "bucket unreachable")
+	require.NotEmpty(t, record.S3Key)
+
+	// 部分成功的备份可直接从本地恢复
+	require.NoError(t, svc.RestoreBackup(context.Background(), record.ID))
+	require.Equal(t, dumpContent, string(dumper.restored))
+
+	// 上传仍失败时累计尝试次数
+	uploaded, err := svc.RetryPendingUploads(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, uploaded)
+	stored, err := svc.GetBackupRecord(context.Background(), record.ID)
+	require.NoError(t, err)
+	require.Equal(t, 2, stored.UploadAttempts)
+	require.Equal(t, BackupUploadStatusPending, stored.UploadStatus)
+
+	store.mu.Lock()
+	store.uploadErr = nil
+	store.mu.Unlock()
+	uploaded, err = svc.RetryPendingUploads(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, uploaded)
+
+	stored, err = svc.GetBackupRecord(context.Background(), record.ID)
+	require.NoError(t, err)
+	require.Equal(t, "completed", stored.Status)
+	require.Equal(t, BackupUploadStatusUploaded, stored.UploadStatus)
+	require.Empty(t, stored.UploadError)
+	store.mu.Lock()
+	require.Contains(t, store.objects, stored.S3Key)
+	store.mu.Unlock()
+}
+
+func TestBackupService_RetryPendingUploads_GivesUpAfterMaxAttempts(t *testing.T) {
+	repo := newMockSettingRepo()
+	seedS3Config(t, repo)
+	seedStorageConfig(t, repo, BackupStorageModeLocalRemote, t.TempDir())
+
+	store := newMockObjectStore()
+	store.uploadErr = fmt.Errorf("bucket unreachable")
+	svc := newTestBackupService(repo, &mockDumper{dumpData: []byte("data")}, store)
+
+	record, err := svc.CreateBackup(context.Background(), "manual", 14)
+	require.NoError(t, err)
+	for i := 1; i < maxBackupUploadAttempts; i++ {
+		_, err := svc.RetryPendingUploads(context.Background())
+		require.NoError(t, err)
+	}
+
+	stored, err := svc.GetBackupRecord(context.Background(), record.ID)
+	require.NoError(t, err)
+	require.Equal(t, maxBackupUploadAttempts, stored.UploadAttempts)
+	require.Equal(t, BackupUploadStatusFailed, stored.UploadStatus)
+	require.Equal(t, backupStatusPartial, stored.Status, "重试用尽后仍保留本地副本")
+
+	_, err = svc.RetryPendingUploads(context.Background())
+	require.NoError(t, err)
+	stored, err = svc.GetBackupRecord(context.Background(), record.ID)
+	require.NoError(t, err)
+	require.Equal(t, maxBackupUploadAttempts, stored.UploadAttempts, "failed 状态不再重试")
+}
+
+func TestBackupService_CreateBackup_PhaseTimings(t *testing.T) {
+	for _, mode := range []string{BackupStorageModeRemote, BackupStorageModeLocalRemote} {
+		t.Run(mode, func(t *testing.T) {
+			repo := newMockSettingRepo()
+			seedS3Config(t, repo)
+			seedStorageConfig(t, repo, mode, t.TempDir())
+
+			// 10 次读取，每次 10ms
+			dumper := &mockDumper{dumpData: bytes.Repeat([]byte("INSERT INTO t VALUES (1);\n"), 1500), readDelay: 10 * time.Millisecond}
+			store := newMockObjectStore()
+			svc := newTestBackupService(repo, dumper, store)
+
+			record, err := svc.CreateBackup(context.Background(), "manual", 14)
+			require.NoError(t, err)
+			require.Equal(t, "completed", record.Status)
+			require.NotNil(t, record.Timings)
+
+			timings := record.Timings
+			require.GreaterOrEqual(t, timings.ReadMs, int64(90), "慢速 dump 读取应计入 read 阶段")
+			sum := timings.ReadMs + timings.CompressMs + timings.ChecksumMs + timings.WriteMs + timings.UploadMs
+			require.InDelta(t, timings.TotalMs, sum, 20, "各阶段之和应约等于总耗时: %+v", *timings)
+			if mode == BackupStorageModeRemote {
+				require.Zero(t, timings.WriteMs, "remote 模式不写本地文件")
+			}
+
+			store.mu.Lock()
+			uploaded := store.objects[record.S3Key]
+			store.mu.Unlock()
+			sum256 := sha256.Sum256(uploaded)
+			require.Equal(t, hex.EncodeToString(sum256[:]), record.ChecksumSHA256)
+
+			records, err := svc.ListBackups(context.Background())
+			require.NoError(t, err)
+			require.Len(t, records, 1)
+			require.Equal(t, timings, records[0].Timings, "ListBackups 应返回阶段耗时")
+		})
+	}
+}
+
+func TestBackupService_LocalRemote_MultipartUploadResumesAfterFailure(t *testing.T) {
+	oldPartSize := backupMultipartPartSize
+	backupMultipartPartSize = 1024
+	t.Cleanup(func() { backupMultipartPartSize = oldPartSize })
+
+	repo := newMockSettingRepo()
+	seedS3Config(t, repo)
+	seedStorageConfig(t, repo, BackupStorageModeLocalRemote, t.TempDir())
+
+	// 随机内容压缩后仍大于 4 个分片
+	dumpData := make([]byte, 5000)
+	_, _ = rand.New(rand.NewSource(1)).Read(dumpData)
+	store := newMockMultipartObjectStore()
+	store.failPart = 3
+	svc := newTestBackupServiceWithStore(repo, &mockDumper{dumpData: dumpData}, store)
+
+	record, err := svc.CreateBackup(context.Background(), "manual", 14)
+	require.NoError(t, err)
+	require.Equal(t, backupStatusPartial, record.Status)
+	require.Equal(t, BackupUploadStatusPending, record.UploadStatus)
+	require.Contains(t, record.UploadError, "upload part 3")
+
+	stored, err := svc.GetBackupRecord(context.Background(), record.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored.UploadState, "分片上传进度应随记录持久化")
+	require.Len(t, stored.UploadState.Parts, 2)
+
+	// 模拟进程重启：新的服务实例从持久化进度继续上传
+	restarted := newTestBackupServiceWithStore(repo, &mockDumper{dumpData: dumpData}, store)
+	uploaded, err := restarted.RetryPendingUploads(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, uploaded)
+
+	stored, err = restarted.GetBackupRecord(context.Background(), record.ID)
+	require.NoError(t, err)
+	require.Equal(t, "completed", stored.Status)
+	require.Equal(t, BackupUploadStatusUploaded, stored.UploadStatus)
+	require.Nil(t, stored.UploadState)
+
+	local, err := os.ReadFile(record.LocalPath)
+	require.NoError(t, err)
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	require.Equal(t, local, store.objects[record.S3Key])
+	require.Equal(t, 1, store.partCalls[1], "已完成的分片不应重传")
+	require.Equal(t, 1, store.partCalls[2], "已完成的分片不应重传")
+	require.Equal(t, 2, store.partCalls[3], "失败的分片续传时重试一次")
+	require.Equal(t, 1, store.nextID, "续传应复用原分片上传")
+}
+
+func TestBackupService_LocalRemote_MultipartUploadRestartsWhenExpired(t *testing.T) {
+	oldPartSize := backupMultipartPartSize
+	backupMultipartPartSize = 1024
+	t.Cleanup(func() { backupMultipartPartSize = oldPartSize })
+
+	repo := newMockSettingRepo()
+	seedS3Config(t, repo)
+	seedStorageConfig(t, repo, BackupStorageModeLocalRemote, t.TempDir())
+
+	dumpData := make([]byte, 3000)
+	_, _ = rand.New(rand.NewSource(2)).Read(dumpData)
+	store := newMockMultipartObjectStore()
+	store.failPart = 2
+	svc := newTestBackupServiceWithStore(repo, &mockDumper{dumpData: dumpData}, store)
+
+	record, err := svc.CreateBackup(context.Background(), "manual", 14)
+	require.NoError(t, err)
+	require.Equal(t, BackupUploadStatusPending, record.UploadStatus)
+
+	// 对象存储侧分片上传已过期
+	store.mu.Lock()
+	store.uploads = make(map[string]map[int32][]byte)
+	store.mu.Unlock()
+
+	uploaded, err := svc.RetryPendingUploads(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, uploaded)
+
+	local, err := os.ReadFile(record.LocalPath)
+	require.NoError(t, err)
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	require.Equal(t, local, store.objects[record.S3Key])
+	require.Equal(t, 2, store.nextID, "分片上传失效后应重新创建")
+}
+
+func TestBackupService_DeleteBackup_AbortsPendingMultipartUpload(t *testing.T) {
+	oldPartSize := backupMultipartPartSize
+	backupMultipartPartSize = 1024
+	t.Cleanup(func() { backupMultipartPartSize = oldPartSize })
+
+	repo := newMockSettingRepo()
+	seedS3Config(t, repo)
+	seedStorageConfig(t, repo, BackupStorageModeLocalRemote, t.TempDir())
+
+	dumpData := make([]byte, 3000)
+	_, _ = rand.New(rand.NewSource(3)).Read(dumpData)
+	store := newMockMultipartObjectStore()
+	store.failPart = 2
+	svc := newTestBackupServiceWithStore(repo, &mockDumper{dumpData: dumpData}, store)
+
+	record, err := svc.CreateBackup(context.Background(), "manual", 14)
+	require.NoError(t, err)
+	require.NotNil(t, record.UploadState)
+
+	require.NoError(t, svc.DeleteBackup(context.Background(), record.ID))
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	require.Equal(t, []string{record.UploadState.UploadID}, store.abortedIDs)
+	require.Empty(t, store.uploads)
+}
@@ -0,0 +1,291 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+)
+
+const (
+	settingKeyBackupStorageConfig = "backup_storage_config"
+
+	// 备份产物存储模式
+	BackupStorageModeRemote      = "remote"       // 仅上传对象存储（默认，兼容旧行为）
+	BackupStorageModeLocal       = "local"        // 仅写本地磁盘
+	BackupStorageModeLocalRemote = "local_remote" // 先写本地，再上传对象存储
+
+	// 上传状态（local_remote 模式下记录远端副本是否就绪）
+	BackupUploadStatusUploaded = "uploaded"
+	BackupUploadStatusPending  = "pending" // 上传失败，等待自动重试
+	BackupUploadStatusFailed   = "failed"  // 重试次数用尽，仅保留本地副本
+
+	// backupStatusPartial 本地写入成功但上传对象存储失败的部分成功状态
+	backupStatusPartial = "partial"
+
+	maxBackupUploadAttempts = 5
+	backupUploadRetrySpec   = "@every 10m"
+)
+
+var ErrInvalidBackupStorageMode = infraerrors.BadRequest("INVALID_BACKUP_STORAGE_MODE", "storage mode must be one of remote/local/local_remote")
+
+// BackupStorageConfig 备份产物存储配置
+type BackupStorageConfig struct {
+	Mode     string `json:"mode"`      // remote/local/local_remote，空值按 remote 处理
+	LocalDir string `json:"local_dir"` // 本地备份目录，空值使用 $DATA_DIR/backups（未设置 DATA_DIR 时为 ./backups）
+}
+
+func normalizeBackupStorageMode(mode string) (string, bool) {
+	switch strings.TrimSpace(mode) {
+	case "", BackupStorageModeRemote:
+		return BackupStorageModeRemote, true
+	case BackupStorageModeLocal:
+		return BackupStorageModeLocal, true
+	case BackupStorageModeLocalRemote:
+		return BackupStorageModeLocalRemote, true
+	default:
+		return "", false
+	}
+}
+
+func (c *BackupStorageConfig) resolvedLocalDir() string {
+	if dir := strings.TrimSpace(c.LocalDir); dir != "" {
+		return dir
+	}
+	if dataDir := strings.TrimSpace(os.Getenv("DATA_DIR")); dataDir != "" {
+		return filepath.Join(dataDir, "backups")
+	}
+	return "backups"
+}
+
+func (s *BackupService) GetStorageConfig(ctx context.Context) (*BackupStorageConfig, error) {
+	return s.loadStorageConfig(ctx)
+}
+
+func (s *BackupService) UpdateStorageConfig(ctx context.Context, cfg BackupStorageConfig) (*BackupStorageConfig, error) {
+	mode, ok := normalizeBackupStorageMode(cfg.Mode)
+	if !ok {
+		return nil, ErrInvalidBackupStorageMode
+	}
+	cfg.Mode = mode
+	cfg.LocalDir = strings.TrimSpace(cfg.LocalDir)
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("marshal storage config: %w", err)
+	}
+	if err := s.settingRepo.Set(ctx, settingKeyBackupStorageConfig, string(data)); err != nil {
+		return nil, fmt.Errorf("save storage config: %w", err)
+	}
+	return &cfg, nil
+}
+
+func (s *BackupService) loadStorageConfig(ctx context.Context) (*BackupStorageConfig, error) {
+	cfg := &BackupStorageConfig{Mode: BackupStorageModeRemote}
+	raw, err := s.settingRepo.GetValue(ctx, settingKeyBackupStorageConfig)
+	if err != nil || raw == "" {
+		return cfg, nil
+	}
+	if err := json.Unmarshal([]byte(raw), cfg); err != nil {
+		return nil, infraerrors.InternalServer("BACKUP_STORAGE_CONFIG_CORRUPT", "backup storage config data is corrupted")
+	}
+	if mode, ok := normalizeBackupStorageMode(cfg.Mode); ok {
+		cfg.Mode = mode
+	} else {
+		cfg.Mode = BackupStorageModeRemote
+	}
+	return cfg, nil
+}
+
+// writeLocalBackup 将 dump 流 gzip 压缩后写入本地目录（先写临时文件再 rename，避免残留半成品）
+// 返回文件路径、大小与压缩产物的 SHA-256；文件创建、写入与落盘耗时计入 timer.write
+func writeLocalBackup(dir, fileName string, dump io.Reader, timer *backupPhaseTimer) (string, int64, string, error) {
+	begin := time.Now()
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", 0, "", fmt.Errorf("create backup dir: %w", err)
+	}
+	finalPath := filepath.Join(dir, fileName)
+	tmpPath := finalPath + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	addBackupPhase(&timer.write, begin)
+	if err != nil {
+		return "", 0, "", fmt.Errorf("create backup file: %w", err)
+	}
+	checksum, copyErr := compressBackupStream(file, &timer.write, dump, timer)
+	begin = time.Now()
+	defer addBackupPhase(&timer.write, begin)
+	if closeErr := file.Close(); closeErr != nil && copyErr == nil {
+		copyErr = closeErr
+	}
+	if copyErr != nil {
+		_ = os.Remove(tmpPath)
+		return "", 0, "", copyErr
+	}
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return "", 0, "", fmt.Errorf("finalize backup file: %w", err)
+	}
+	info, err := os.Stat(finalPath)
+	if err != nil {
+		return "", 0, "", fmt.Errorf("stat backup file: %w", err)
+	}
+	return finalPath, info.Size(), checksum, nil
+}
+
+// hasRemoteCopy 判断备份在对象存储上是否有可用副本（兼容未记录上传状态的旧记录）
+func (r *BackupRecord) hasRemoteCopy() bool {
+	if r.S3Key == "" {
+		return false
+	}
+	return r.UploadStatus == "" || r.UploadStatus == BackupUploadStatusUploaded
+}
+
+// isRestorable 已完成或部分成功（仅本地副本可用）的备份均可用于恢复
+func (r *BackupRecord) isRestorable() bool {
+	return r.Status == "completed" || r.Status == backupStatusPartial
+}
+
+// openBackupArtifact 优先读取本地副本，本地不可用时回退到对象存储
+func (s *BackupService) openBackupArtifact(ctx context.Context, record *BackupRecord) (io.ReadCloser, error) {
+	var localErr error
+	if record.LocalPath != "" {
+		file, err := os.Open(record.LocalPath)
+		if err == nil {
+			return file, nil
+		}
+		localErr = err
+	}
+	if !record.hasRemoteCopy() {
+		if localErr != nil {
+			return nil, fmt.Errorf("open local backup: %w", localErr)
+		}
+		return nil, infraerrors.BadRequest("BACKUP_ARTIFACT_MISSING", "backup has no available artifact")
+	}
+
+	s3Cfg, err := s.loadS3Config(ctx)
+	if err != nil {
+		return nil, err
+	}
+	objectStore, err := s.getOrCreateStore(ctx, s3Cfg)
+	if err != nil {
+		return nil, fmt.Errorf("init object store: %w", err)
+	}
+	body, err := objectStore.Download(ctx, record.S3Key)
+	if err != nil {
+		return nil, fmt.Errorf("S3 download failed: %w", err)
+	}
+	return body, nil
+}
+
+// removeLocalBackup 删除本地备份文件，文件不存在视为成功
+func removeLocalBackup(path string) {
+	if path == "" {
+		return
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.LegacyPrintf("service.backup", "[Backup] 删除本地备份文件失败: path=%s err=%v", path, err)
+	}
+}
+
+// RetryPendingUploads 重试上传处于 pending 状态的本地备份，返回本次上传成功的数量。
+// 每条记录最多尝试 maxBackupUploadAttempts 次，用尽后标记为 failed 并保留本地副本。
+func (s *BackupService) RetryPendingUploads(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	if s.retryingUploads {
+		s.mu.Unlock()
+		return 0, nil
+	}
+	s.retryingUploads = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.retryingUploads = false
+		s.mu.Unlock()
+	}()
+
+	records, err := s.loadRecords(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var pending []BackupRecord
+	for _, record := range records {
+		if record.Status == backupStatusPartial && record.UploadStatus == BackupUploadStatusPending && record.LocalPath != "" {
+			pending = append(pending, record)
+		}
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	s3Cfg, err := s.loadS3Config(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if s3Cfg == nil || !s3Cfg.IsConfigured() {
+		return 0, ErrBackupS3NotConfigured
+	}
+	objectStore, err := s.getOrCreateStore(ctx, s3Cfg)
+	if err != nil {
+		return 0, fmt.Errorf("init object store: %w", err)
+	}
+
+	uploaded := 0
+	for i := range pending {
+		if !s.tryBeginUpload(pending[i].ID) {
+			// 首次上传仍在进行中
+			continue
+		}
+		uploadErr := s.uploadLocalBackup(ctx, objectStore, &pending[i])
+		s.endUpload(pending[i].ID)
+		if errors.Is(uploadErr, ErrBackupNotFound) {
+			continue
+		}
+		if uploadErr == nil {
+			uploaded++
+		}
+		// 上传期间记录可能已被删除，此时不再写回
+		_, err := s.updateRecord(ctx, pending[i].ID, func(record *BackupRecord) {
+			record.UploadAttempts++
+			if uploadErr == nil {
+				record.Status = "completed"
+				record.UploadStatus = BackupUploadStatusUploaded
+				record.UploadError = ""
+				return
+			}
+			record.UploadError = uploadErr.Error()
+			if record.UploadAttempts >= maxBackupUploadAttempts {
+				record.UploadStatus = BackupUploadStatusFailed
+				abortBackupMultipartUpload(ctx, objectStore, record)
+				record.UploadState = nil
+			}
+		})
+		if err != nil {
+			return uploaded, err
+		}
+		if uploadErr != nil {
+			logger.LegacyPrintf("service.backup", "[Backup] 重试上传备份失败: id=%s err=%v", pending[i].ID, uploadErr)
+		}
+	}
+	return uploaded, nil
+}
+
+func (s *BackupService) runUploadRetry() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	uploaded, err := s.RetryPendingUploads(ctx)
+	if err != nil {
+		logger.LegacyPrintf("service.backup", "[Backup] 重试上传备份失败: %v", err)
+		return
+	}
+	if uploaded > 0 {
+		logger.LegacyPrintf("service.backup", "[Backup] 重试上传完成 %d 个备份", uploaded)
+	}
+}
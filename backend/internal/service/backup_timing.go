@@ -0,0 +1,124 @@
+package service
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// BackupPhaseTimings 单次备份各阶段耗时（毫秒），用于判断瓶颈在压缩还是 I/O。
+// 各阶段在流式管道中交替执行、分别累计，之和约等于 TotalMs。
+type BackupPhaseTimings struct {
+	ReadMs     int64 `json:"read_ms"`     // 启动 dump 并读取 dump 输出
+	CompressMs int64 `json:"compress_ms"` // gzip 压缩
+	ChecksumMs int64 `json:"checksum_ms"` // 计算压缩产物的 SHA-256
+	WriteMs    int64 `json:"write_ms"`    // 写本地文件（local / local_remote 模式）
+	UploadMs   int64 `json:"upload_ms"`   // 上传对象存储；remote 模式含等待上传端消费管道数据的时间
+	TotalMs    int64 `json:"total_ms"`
+}
+
+// backupPhaseTimer 累计一次备份执行中各阶段的耗时（纳秒）。
+// remote 模式下压缩在独立 goroutine 中执行，计数器使用原子操作。
+type backupPhaseTimer struct {
+	start    time.Time
+	read     atomic.Int64
+	compress atomic.Int64
+	checksum atomic.Int64
+	write    atomic.Int64
+	upload   atomic.Int64
+}
+
+func newBackupPhaseTimer() *backupPhaseTimer {
+	return &backupPhaseTimer{start: time.Now()}
+}
+
+func (t *backupPhaseTimer) snapshot() *BackupPhaseTimings {
+	return &BackupPhaseTimings{
+		ReadMs:     time.Duration(t.read.Load()).Milliseconds(),
+		CompressMs: time.Duration(t.compress.Load()).Milliseconds(),
+		ChecksumMs: time.Duration(t.checksum.Load()).Milliseconds(),
+		WriteMs:    time.Duration(t.write.Load()).Milliseconds(),
+		UploadMs:   time.Duration(t.upload.Load()).Milliseconds(),
+		TotalMs:    time.Since(t.start).Milliseconds(),
+	}
+}
+
+func addBackupPhase(counter *atomic.Int64, begin time.Time) time.Duration {
+	elapsed := time.Since(begin)
+	counter.Add(int64(elapsed))
+	return elapsed
+}
+
+type backupTimedReader struct {
+	r     io.Reader
+	timer *backupPhaseTimer
+}
+
+func (r *backupTimedReader) Read(p []byte) (int, error) {
+	begin := time.Now()
+	n, err := r.r.Read(p)
+	addBackupPhase(&r.timer.read, begin)
+	return n, err
+}
+
+// backupChecksumSink 接收 gzip 输出：先计算 SHA-256，再写入下游（本地文件或上传管道）。
+// nested 记录本 sink 内的耗时，用于从 gzip 调用耗时中扣除，得到纯压缩耗时。
+type backupChecksumSink struct {
+	hash       hash.Hash
+	dst        io.Writer
+	dstCounter *atomic.Int64
+	timer      *backupPhaseTimer
+	nested     time.Duration
+}
+
+func (s *backupChecksumSink) Write(p []byte) (int, error) {
+	begin := time.Now()
+	_, _ = s.hash.Write(p)
+	s.nested += addBackupPhase(&s.timer.checksum, begin)
+	begin = time.Now()
+	n, err := s.dst.Write(p)
+	s.nested += addBackupPhase(s.dstCounter, begin)
+	return n, err
+}
+
+// compressBackupStream 将 src gzip 压缩后写入 dst，返回压缩产物的 SHA-256（hex）。
+// 写入 dst 的耗时计入 dstCounter（本地文件为 write，上传管道为 upload）。
+func compressBackupStream(dst io.Writer, dstCounter *atomic.Int64, src io.Reader, timer *backupPhaseTimer) (string, error) {
+	sink := &backupChecksumSink{hash: sha256.New(), dst: dst, dstCounter: dstCounter, timer: timer}
+	gzWriter := gzip.NewWriter(sink)
+	timedCompress := func(fn func() error) error {
+		nestedBefore := sink.nested
+		begin := time.Now()
+		err := fn()
+		timer.compress.Add(int64(time.Since(begin) - (sink.nested - nestedBefore)))
+		return err
+	}
+
+	reader := &backupTimedReader{r: src, timer: timer}
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := reader.Read(buf)
+		if n > 0 {
+			if err := timedCompress(func() error {
+				_, err := gzWriter.Write(buf[:n])
+				return err
+			}); err != nil {
+				return "", err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return "", readErr
+		}
+	}
+	if err := timedCompress(gzWriter.Close); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sink.hash.Sum(nil)), nil
+}
@@ -419,6 +419,14 @@ func (s *BillingService) CalculateCostWithServiceTier(model string, tokens Usage
 		breakdown.CacheReadCost *= tierMultiplier
 	}
 
+	// 部署自定义的 token 类型倍率（billing.token_multipliers），只作用于费用，不改变 token 数量
+	if multipliers, ok := s.tokenMultipliersForModel(model); ok {
+		breakdown.InputCost *= multipliers.Input
+		breakdown.OutputCost *= multipliers.Output
+		breakdown.CacheCreationCost *= multipliers.CacheCreation
+		breakdown.CacheReadCost *= multipliers.CacheRead
+	}
+
 	// 计算总费用
 	breakdown.TotalCost = breakdown.InputCost + breakdown.OutputCost +
 		breakdown.CacheCreationCost + breakdown.CacheReadCost
@@ -432,6 +440,52 @@ func (s *BillingService) CalculateCostWithServiceTier(model string, tokens Usage
 	return breakdown, nil
 }
 
+// billingTokenMultipliers 各 token 类型的计费倍率
+type billingTokenMultipliers struct {
+	Input         float64
+	Output        float64
+	CacheCreation float64
+	CacheRead     float64
+}
+
+// tokenMultipliersForModel 查找模型的 token 类型倍率：先精确匹配模型名（不区分大小写），再回退到 "*" 规则。
+func (s *BillingService) tokenMultipliersForModel(model string) (billingTokenMultipliers, bool) {
+	if s == nil || s.cfg == nil || len(s.cfg.Billing.TokenMultipliers) == 0 {
+		return billingTokenMultipliers{}, false
+	}
+	model = strings.ToLower(strings.TrimSpace(model))
+	var fallback *config.BillingTokenMultiplierConfig
+	for i := range s.cfg.Billing.TokenMultipliers {
+		rule := &s.cfg.Billing.TokenMultipliers[i]
+		ruleModel := strings.ToLower(strings.TrimSpace(rule.Model))
+		if ruleModel == model {
+			return resolveBillingTokenMultipliers(rule), true
+		}
+		if ruleModel == "*" && fallback == nil {
+			fallback = rule
+		}
+	}
+	if fallback != nil {
+		return resolveBillingTokenMultipliers(fallback), true
+	}
+	return billingTokenMultipliers{}, false
+}
+
+func resolveBillingTokenMultipliers(rule *config.BillingTokenMultiplierConfig) billingTokenMultipliers {
+	pick := func(value *float64) float64 {
+		if value == nil {
+			return 1.0
+		}
+		return *value
+	}
+	return billingTokenMultipliers{
+		Input:         pick(rule.Input),
+		Output:        pick(rule.Output),
+		CacheCreation: pick(rule.CacheCreation),
+		CacheRead:     pick(rule.CacheRead),
+	}
+}
+
 func (s *BillingService) applyModelSpecificPricingPolicy(model string, pricing *ModelPricing) *ModelPricing {
 	if pricing == nil {
 		return nil
@@ -708,3 +708,39 @@ func TestGetModelPricing_MapsDynamicPriorityFieldsIntoBillingPricing(t *testing.
 	require.InDelta(t, 1.5, pricing.LongContextInputMultiplier, 1e-12)
 	require.InDelta(t, 1.25, pricing.LongContextOutputMultiplier, 1e-12)
 }
+
+func TestCalculateCost_TokenMultipliersFromConfig(t *testing.T) {
+	half := 0.5
+	double := 2.0
+	zero := 0.0
+	cfg := &config.Config{}
+	cfg.Billing.TokenMultipliers = []config.BillingTokenMultiplierConfig{
+		{Model: "claude-sonnet-4", Input: &half, Output: &double, CacheRead: &zero},
+		{Model: "*", Output: &half},
+	}
+	svc := NewBillingService(cfg, nil)
+	base := newTestBillingService()
+
+	tokens := UsageTokens{InputTokens: 1000, OutputTokens: 500, CacheCreationTokens: 300, CacheReadTokens: 2000}
+	raw, err := base.CalculateCost("claude-sonnet-4", tokens, 1.0)
+	require.NoError(t, err)
+	cost, err := svc.CalculateCost("Claude-Sonnet-4", tokens, 2.0)
+	require.NoError(t, err)
+
+	require.InDelta(t, raw.InputCost*0.5, cost.InputCost, 1e-10)
+	require.InDelta(t, raw.OutputCost*2, cost.OutputCost, 1e-10)
+	require.InDelta(t, raw.CacheCreationCost, cost.CacheCreationCost, 1e-10, "未配置的 token 类型倍率默认为 1")
+	require.Zero(t, cost.CacheReadCost)
+	expectedTotal := raw.InputCost*0.5 + raw.OutputCost*2 + raw.CacheCreationCost
+	require.InDelta(t, expectedTotal, cost.TotalCost, 1e-10)
+	require.InDelta(t, expectedTotal*2, cost.ActualCost, 1e-10)
+	require.Equal(t, 1000, tokens.InputTokens, "原始 token 数量不应被倍率修改")
+
+	// 未精确匹配的模型使用 "*" 默认规则
+	rawHaiku, err := base.CalculateCost("claude-3-5-haiku", tokens, 1.0)
+	require.NoError(t, err)
+	haiku, err := svc.CalculateCost("claude-3-5-haiku", tokens, 1.0)
+	require.NoError(t, err)
+	require.InDelta(t, rawHaiku.InputCost, haiku.InputCost, 1e-10)
+	require.InDelta(t, rawHaiku.OutputCost*0.5, haiku.OutputCost, 1e-10)
+}
@@ -58,6 +58,7 @@ type Group struct {
 	SortOrder int
 
 	// OpenAI Messages 调度配置（仅 openai 平台使用）
+	// DefaultMappedModel 同时作为分组默认模型：Responses 请求（含 WS response.create）缺省 model 时注入
 	AllowMessagesDispatch bool
 	DefaultMappedModel    string
 
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OpenAICanaryAccountHealth 金丝雀账号健康快照，与常规账号的运行时统计分开展示。
+type OpenAICanaryAccountHealth struct {
+	AccountID int64 `json:"account_id"`
+	// Active 账号仍在金丝雀池中；自动回滚后为 false，不再接收金丝雀分流。
+	Active bool `json:"active"`
+	// RoutedTotal 本进程内经金丝雀分流选中该账号的次数。
+	RoutedTotal     int64   `json:"routed_total"`
+	WindowRequests  int     `json:"window_requests"`
+	WindowErrors    int     `json:"window_errors"`
+	WindowErrorRate float64 `json:"window_error_rate"`
+	// RolledBackAt/RollbackErrorRate 自动回滚的时间与触发时的窗口错误率。
+	RolledBackAt      *time.Time `json:"rolled_back_at,omitempty"`
+	RollbackErrorRate float64    `json:"rollback_error_rate,omitempty"`
+}
+
+type openAICanaryParams struct {
+	accountIDs         []int64
+	ratio              float64
+	errorRateThreshold float64
+	window             time.Duration
+	minRequests        int
+}
+
+func (p openAICanaryParams) contains(accountID int64) bool {
+	return slices.Contains(p.accountIDs, accountID)
+}
+
+type openAIAccountCanaryState struct {
+	windowStart       time.Time
+	requests          int
+	errors            int
+	routedTotal       int64
+	rolledBack        bool
+	rolledBackAt      time.Time
+	rollbackErrorRate float64
+}
+
+// openAIAccountCanaryPool 维护金丝雀账号的窗口错误率与回滚状态，仅进程内有效：
+// 窗口内结果数达到 minRequests 且错误率超过阈值时自动移出金丝雀池，直至进程重启或手动恢复。
+type openAIAccountCanaryPool struct {
+	mu            sync.Mutex
+	states        map[int64]*openAIAccountCanaryState
+	selectTotal   atomic.Int64
+	rollbackTotal atomic.Int64
+}
+
+func newOpenAIAccountCanaryPool() *openAIAccountCanaryPool {
+	return &openAIAccountCanaryPool{states: make(map[int64]*openAIAccountCanaryState)}
+}
+
+func (p *openAIAccountCanaryPool) stateLocked(accountID int64) *openAIAccountCanaryState {
+	state := p.states[accountID]
+	if state == nil {
+		state = &openAIAccountCanaryState{}
+		p.states[accountID] = state
+	}
+	return state
+}
+
+func (p *openAIAccountCanaryPool) isRolledBack(accountID int64) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state := p.states[accountID]
+	return state != nil && state.rolledBack
+}
+
+func (p *openAIAccountCanaryPool) recordRouted(accountID int64) {
+	if p == nil {
+		return
+	}
+	p.selectTotal.Add(1)
+	p.mu.Lock()
+	p.stateLocked(accountID).routedTotal++
+	p.mu.Unlock()
+}
+
+// record 上报金丝雀账号一次结果，返回本次是否触发自动回滚及触发时的窗口错误率。
+func (p *openAIAccountCanaryPool) record(accountID int64, success bool, params openAICanaryParams, now time.Time) (rolledBack bool, errorRate float64) {
+	if p == nil || accountID <= 0 || !params.contains(accountID) {
+		return false, 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state := p.stateLocked(accountID)
+	if state.windowStart.IsZero() || now.Sub(state.windowStart) >= params.window {
+		state.windowStart = now
+		state.requests = 0
+		state.errors = 0
+	}
+	state.requests++
+	if !success {
+		state.errors++
+	}
+	if state.rolledBack || state.requests < params.minRequests {
+		return false, 0
+	}
+	errorRate = float64(state.errors) / float64(state.requests)
+	if errorRate <= params.errorRateThreshold {
+		return false, 0
+	}
+	state.rolledBack = true
+	state.rolledBackAt = now
+	state.rollbackErrorRate = errorRate
+	p.rollbackTotal.Add(1)
+	return true, errorRate
+}
+
+// reset 将已回滚的金丝雀账号重新放回金丝雀池并清空窗口统计。
+func (p *openAIAccountCanaryPool) reset(accountID int64) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state := p.states[accountID]
+	if state == nil || !state.rolledBack {
+		return false
+	}
+	p.states[accountID] = &openAIAccountCanaryState{routedTotal: state.routedTotal}
+	return true
+}
+
+func (p *openAIAccountCanaryPool) list(params openAICanaryParams, now time.Time) []OpenAICanaryAccountHealth {
+	if p == nil || len(params.accountIDs) == 0 {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]OpenAICanaryAccountHealth, 0, len(params.accountIDs))
+	for _, accountID := range params.accountIDs {
+		info := OpenAICanaryAccountHealth{AccountID: accountID, Active: true}
+		if state := p.states[accountID]; state != nil {
+			info.Active = !state.rolledBack
+			info.RoutedTotal = state.routedTotal
+			if !state.windowStart.IsZero() && now.Sub(state.windowStart) < params.window {
+				info.WindowRequests = state.requests
+				info.WindowErrors = state.errors
+				if state.requests > 0 {
+					info.WindowErrorRate = float64(state.errors) / float64(state.requests)
+				}
+			}
+			if state.rolledBack {
+				rolledBackAt := state.rolledBackAt
+				info.RolledBackAt = &rolledBackAt
+				info.RollbackErrorRate = state.rollbackErrorRate
+			}
+		}
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].AccountID < out[j].AccountID })
+	return out
+}
+
+// openAICanaryParams 返回金丝雀放量参数；未配置金丝雀账号或分流比例为 0 时返回 false。
+func (s *OpenAIGatewayService) openAICanaryParams() (openAICanaryParams, bool) {
+	if s == nil || s.cfg == nil {
+		return openAICanaryParams{}, false
+	}
+	wsCfg := s.openAIWSConfig()
+	if len(wsCfg.CanaryAccountIDs) == 0 || wsCfg.CanaryTrafficRatio <= 0 {
+		return openAICanaryParams{}, false
+	}
+	params := openAICanaryParams{
+		accountIDs:         wsCfg.CanaryAccountIDs,
+		ratio:              wsCfg.CanaryTrafficRatio,
+		errorRateThreshold: wsCfg.CanaryErrorRateThreshold,
+		window:             time.Duration(wsCfg.CanaryWindowSeconds) * time.Second,
+		minRequests:        wsCfg.CanaryMinRequests,
+	}
+	if params.errorRateThreshold <= 0 || params.errorRateThreshold > 1 {
+		params.errorRateThreshold = 0.2
+	}
+	if params.window <= 0 {
+		params.window = 5 * time.Minute
+	}
+	if params.minRequests <= 0 {
+		params.minRequests = 20
+	}
+	return params, true
+}
+
+// excludeRolledBackCanaries 把已回滚的金丝雀账号并入请求排除集合（复制后修改，不影响调用方），
+// 使其在粘连与负载均衡各层都不再被选中。
+func (s *defaultOpenAIAccountScheduler) excludeRolledBackCanaries(req OpenAIAccountScheduleRequest, params openAICanaryParams) OpenAIAccountScheduleRequest {
+	var excluded map[int64]struct{}
+	for _, accountID := range params.accountIDs {
+		if !s.canaries.isRolledBack(accountID) {
+			continue
+		}
+		if excluded == nil {
+			excluded = make(map[int64]struct{}, len(req.ExcludedIDs)+1)
+			for id := range req.ExcludedIDs {
+				excluded[id] = struct{}{}
+			}
+		}
+		excluded[accountID] = struct{}{}
+	}
+	if excluded != nil {
+		req.ExcludedIDs = excluded
+	}
+	return req
+}
+
+// selectCanary 按 canary_traffic_ratio 采样，命中时从仍在池中的金丝雀账号里随机选取一个并尝试占用槽位；
+// 金丝雀账号不可用或槽位已满时返回 nil，由后续负载均衡正常选号（不排队等待金丝雀账号）。
+func (s *defaultOpenAIAccountScheduler) selectCanary(ctx context.Context, req OpenAIAccountScheduleRequest, params openAICanaryParams) *AccountSelectionResult {
+	if params.ratio < 1 && rand.Float64() >= params.ratio {
+		return nil
+	}
+	accounts, err := s.service.listSchedulableAccounts(ctx, req.GroupID)
+	if err != nil {
+		return nil
+	}
+	candidates := make([]*Account, 0, len(params.accountIDs))
+	for i := range accounts {
+		account := &accounts[i]
+		if !params.contains(account.ID) || s.canaries.isRolledBack(account.ID) {
+			continue
+		}
+		if _, excluded := req.ExcludedIDs[account.ID]; excluded {
+			continue
+		}
+		if !account.IsSchedulable() || !account.IsOpenAI() {
+			continue
+		}
+		if req.RequestedModel != "" && !account.IsModelSupported(req.RequestedModel) {
+			continue
+		}
+		if !s.isAccountTransportCompatible(account, req.RequiredTransport) {
+			continue
+		}
+		candidates = append(candidates, account)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	start := rand.IntN(len(candidates))
+	for i := range candidates {
+		candidate := candidates[(start+i)%len(candidates)]
+		if !s.canAttemptByCircuitBreaker(candidate.ID, req.GroupID) {
+			continue
+		}
+		fresh := s.service.resolveFreshSchedulableOpenAIAccount(ctx, candidate, req.RequestedModel)
+		if fresh == nil || !s.isAccountTransportCompatible(fresh, req.RequiredTransport) {
+			continue
+		}
+		result, acquireErr := s.service.tryAcquireAccountSlot(ctx, fresh.ID, s.service.openAIWSSchedulerAccountConcurrency(fresh))
+		if acquireErr != nil || result == nil || !result.Acquired {
+			continue
+		}
+		if !s.reserveByCircuitBreaker(fresh.ID, req.GroupID, result.ReleaseFunc) {
+			continue
+		}
+		if req.SessionHash != "" {
+			_ = s.service.BindStickySession(ctx, req.GroupID, req.SessionHash, fresh.ID)
+		}
+		s.canaries.recordRouted(fresh.ID)
+		return &AccountSelectionResult{
+			Account:     fresh,
+			Acquired:    true,
+			ReleaseFunc: result.ReleaseFunc,
+		}
+	}
+	return nil
+}
+
+// recordCanaryResult 统计金丝雀账号结果，窗口错误率超限时自动回滚并记录日志。
+func (s *defaultOpenAIAccountScheduler) recordCanaryResult(accountID int64, success bool, now time.Time) {
+	params, enabled := s.service.openAICanaryParams()
+	if !enabled {
+		return
+	}
+	if rolledBack, errorRate := s.canaries.record(accountID, success, params, now); rolledBack {
+		logOpenAIWSModeInfo(
+			"canary_rolled_back account_id=%d window_error_rate=%.3f threshold=%.3f window_seconds=%d",
+			accountID,
+			errorRate,
+			params.errorRateThreshold,
+			int(params.window.Seconds()),
+		)
+	}
+}
+
+func (s *defaultOpenAIAccountScheduler) ListCanaryAccounts() []OpenAICanaryAccountHealth {
+	if s == nil {
+		return nil
+	}
+	params, enabled := s.service.openAICanaryParams()
+	if !enabled {
+		return nil
+	}
+	return s.canaries.list(params, time.Now())
+}
+
+func (s *defaultOpenAIAccountScheduler) ResetCanary(accountID int64) bool {
+	if s == nil {
+		return false
+	}
+	return s.canaries.reset(accountID)
+}
+
+// ListOpenAICanaryAccounts 返回已配置金丝雀账号的健康状态（是否仍在池中、窗口错误率、回滚信息）；未开启金丝雀时为空。
+func (s *OpenAIGatewayService) ListOpenAICanaryAccounts() []OpenAICanaryAccountHealth {
+	scheduler := s.getOpenAIAccountScheduler()
+	if scheduler == nil {
+		return nil
+	}
+	return scheduler.ListCanaryAccounts()
+}
+
+// ResetOpenAICanary 将自动回滚的金丝雀账号重新放回金丝雀池，用于问题修复后重新放量。
+func (s *OpenAIGatewayService) ResetOpenAICanary(accountID int64) bool {
+	scheduler := s.getOpenAIAccountScheduler()
+	if scheduler == nil {
+		return false
+	}
+	return scheduler.ResetCanary(accountID)
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func newOpenAICanaryTestService(accounts []Account) *OpenAIGatewayService {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.CanaryAccountIDs = []int64{7002}
+	cfg.Gateway.OpenAIWS.CanaryTrafficRatio = 1
+	cfg.Gateway.OpenAIWS.CanaryErrorRateThreshold = 0.5
+	cfg.Gateway.OpenAIWS.CanaryWindowSeconds = 300
+	cfg.Gateway.OpenAIWS.CanaryMinRequests = 4
+	return &OpenAIGatewayService{
+		accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+		cache:              &stubGatewayCache{},
+		cfg:                cfg,
+		concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+	}
+}
+
+func TestOpenAIAccountCanary_AutoRollback(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(70)
+	regular := Account{ID: 7001, Platform: PlatformOpenAI, Type: AccountTypeOAuth, Status: StatusActive, Schedulable: true, Concurrency: 5}
+	canary := Account{ID: 7002, Platform: PlatformOpenAI, Type: AccountTypeOAuth, Status: StatusActive, Schedulable: true, Concurrency: 5, Priority: -10}
+	svc := newOpenAICanaryTestService([]Account{regular, canary})
+
+	selection, decision, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+	require.NoError(t, err)
+	require.Equal(t, canary.ID, selection.Account.ID)
+	require.Equal(t, openAIAccountScheduleLayerCanary, decision.Layer)
+
+	// 未达到最小样本数前不回滚。
+	for i := 0; i < 3; i++ {
+		svc.ReportOpenAIAccountScheduleResult(canary.ID, false, nil)
+	}
+	health := svc.ListOpenAICanaryAccounts()
+	require.Len(t, health, 1)
+	require.True(t, health[0].Active)
+	require.Equal(t, 3, health[0].WindowErrors)
+
+	svc.ReportOpenAIAccountScheduleResult(canary.ID, false, nil)
+	health = svc.ListOpenAICanaryAccounts()
+	require.False(t, health[0].Active)
+	require.NotNil(t, health[0].RolledBackAt)
+	require.InDelta(t, 1.0, health[0].RollbackErrorRate, 1e-9)
+	require.Equal(t, int64(1), health[0].RoutedTotal)
+
+	// 回滚后金丝雀账号不再被选中，也不进入常规负载均衡。
+	for i := 0; i < 5; i++ {
+		selection, decision, err = svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.Equal(t, regular.ID, selection.Account.ID)
+		require.Equal(t, openAIAccountScheduleLayerLoadBalance, decision.Layer)
+	}
+	metrics := svc.SnapshotOpenAIAccountSchedulerMetrics()
+	require.Equal(t, int64(1), metrics.CanarySelectTotal)
+	require.Equal(t, int64(1), metrics.CanaryRollbackTotal)
+
+	require.True(t, svc.ResetOpenAICanary(canary.ID))
+	selection, decision, err = svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+	require.NoError(t, err)
+	require.Equal(t, canary.ID, selection.Account.ID)
+	require.Equal(t, openAIAccountScheduleLayerCanary, decision.Layer)
+}
+
+func TestOpenAIAccountCanary_ExcludedFromLoadBalanceAndBelowThresholdKept(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(71)
+	regular := Account{ID: 7001, Platform: PlatformOpenAI, Type: AccountTypeOAuth, Status: StatusActive, Schedulable: true, Concurrency: 5}
+	canary := Account{ID: 7002, Platform: PlatformOpenAI, Type: AccountTypeOAuth, Status: StatusActive, Schedulable: true, Concurrency: 5, Priority: -10}
+	svc := newOpenAICanaryTestService([]Account{regular, canary})
+	svc.cfg.Gateway.OpenAIWS.CanaryTrafficRatio = 0.000001
+
+	for i := 0; i < 20; i++ {
+		selection, _, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.Equal(t, regular.ID, selection.Account.ID)
+	}
+
+	// 错误率未超过阈值时保留在金丝雀池中。
+	for i := 0; i < 4; i++ {
+		svc.ReportOpenAIAccountScheduleResult(canary.ID, i%2 == 0, nil)
+	}
+	health := svc.ListOpenAICanaryAccounts()
+	require.Len(t, health, 1)
+	require.True(t, health[0].Active)
+	require.InDelta(t, 0.5, health[0].WindowErrorRate, 1e-9)
+}
@@ -0,0 +1,365 @@
+package service
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	openAICircuitBreakerStateClosed   = "closed"
+	openAICircuitBreakerStateOpen     = "open"
+	openAICircuitBreakerStateHalfOpen = "half_open"
+)
+
+// CircuitBreakerInfo 账号级调度熔断器的只读快照。
+type CircuitBreakerInfo struct {
+	AccountID int64 `json:"account_id"`
+	// GroupID 非 0 表示该熔断器属于配置了参数覆盖的分组，0 为全局熔断器。
+	GroupID          int64      `json:"group_id,omitempty"`
+	State            string     `json:"state"`
+	ConsecutiveFails int        `json:"consecutive_fails"`
+	HalfOpenInFlight int        `json:"half_open_in_flight"`
+	OpenedAt         *time.Time `json:"opened_at,omitempty"`
+}
+
+type openAICircuitBreakerParams struct {
+	failThreshold int
+	cooldown      time.Duration
+	halfOpenMax   int
+	// warmupWindow 账号创建后该时长内的失败不计入连续失败；0 表示关闭。
+	warmupWindow time.Duration
+	// groupID 参数所属的熔断作用域：0 为全局，>0 为覆盖了熔断参数的分组，各作用域独立计数。
+	groupID int64
+}
+
+// openAICircuitBreakerKey 熔断器按（作用域分组, 账号）区分，groupID=0 为全局作用域。
+type openAICircuitBreakerKey struct {
+	groupID   int64
+	accountID int64
+}
+
+type openAIAccountCircuitBreaker struct {
+	mu               sync.Mutex
+	state            string
+	consecutiveFails int
+	halfOpenInFlight int
+	openedAt         time.Time
+	halfOpenAt       time.Time
+}
+
+// openAIAccountCircuitBreakers 维护账号级熔断器：
+// closed 连续失败达到阈值后进入 open；open 冷却结束后进入 half_open 放行有限探测；
+// 探测成功回到 closed，探测失败重新 open。
+// 熔断状态只在调度选择账号时生效，不会中断已获得连接租约的进行中 turn 或 ingress 会话。
+type openAIAccountCircuitBreakers struct {
+	breakers          sync.Map // openAICircuitBreakerKey -> *openAIAccountCircuitBreaker
+	tripTotal         atomic.Int64
+	manualResetTotal  atomic.Int64
+	warmupExemptTotal atomic.Int64
+	// accountCreatedAt 调度选中过的预热期内账号的创建时间（accountID -> time.Time），用于判断失败是否处于预热期；
+	// 未记录的账号按已过预热期处理。
+	accountCreatedAt sync.Map
+}
+
+func newOpenAIAccountCircuitBreakers() *openAIAccountCircuitBreakers {
+	return &openAIAccountCircuitBreakers{}
+}
+
+func (b *openAIAccountCircuitBreakers) loadOrCreate(key openAICircuitBreakerKey) *openAIAccountCircuitBreaker {
+	if value, ok := b.breakers.Load(key); ok {
+		if breaker, typed := value.(*openAIAccountCircuitBreaker); typed {
+			return breaker
+		}
+	}
+	value, _ := b.breakers.LoadOrStore(key, &openAIAccountCircuitBreaker{state: openAICircuitBreakerStateClosed})
+	breaker, _ := value.(*openAIAccountCircuitBreaker)
+	return breaker
+}
+
+func (b *openAIAccountCircuitBreakers) load(key openAICircuitBreakerKey) *openAIAccountCircuitBreaker {
+	value, ok := b.breakers.Load(key)
+	if !ok {
+		return nil
+	}
+	breaker, _ := value.(*openAIAccountCircuitBreaker)
+	return breaker
+}
+
+// canAttempt 判断账号在 params 所属作用域内当前是否可被尝试，不修改熔断器状态，供候选过滤使用；
+// 结果为 true 时随后调用 allow 仍可能因并发请求占满探测名额而失败。
+func (b *openAIAccountCircuitBreakers) canAttempt(accountID int64, params openAICircuitBreakerParams, now time.Time) bool {
+	if b == nil || accountID <= 0 {
+		return true
+	}
+	breaker := b.load(openAICircuitBreakerKey{groupID: params.groupID, accountID: accountID})
+	if breaker == nil {
+		return true
+	}
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	switch breaker.state {
+	case openAICircuitBreakerStateOpen:
+		return now.Sub(breaker.openedAt) >= params.cooldown
+	case openAICircuitBreakerStateHalfOpen:
+		return breaker.halfOpenInFlight < params.halfOpenMax || now.Sub(breaker.halfOpenAt) >= params.cooldown
+	default:
+		return true
+	}
+}
+
+// allow 判断账号在 params 所属作用域内是否可参与新的调度；half_open 状态下会占用一个探测名额，
+// 因此只应对最终选中的账号调用。
+func (b *openAIAccountCircuitBreakers) allow(accountID int64, params openAICircuitBreakerParams, now time.Time) bool {
+	if b == nil || accountID <= 0 {
+		return true
+	}
+	breaker := b.load(openAICircuitBreakerKey{groupID: params.groupID, accountID: accountID})
+	if breaker == nil {
+		return true
+	}
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	switch breaker.state {
+	case openAICircuitBreakerStateOpen:
+		if now.Sub(breaker.openedAt) < params.cooldown {
+			return false
+		}
+		breaker.state = openAICircuitBreakerStateHalfOpen
+		breaker.halfOpenAt = now
+		breaker.halfOpenInFlight = 1
+		return true
+	case openAICircuitBreakerStateHalfOpen:
+		if breaker.halfOpenInFlight < params.halfOpenMax {
+			breaker.halfOpenInFlight++
+			return true
+		}
+		// 探测名额长时间未回报结果（候选未被最终选中或请求中途丢失）时重新放行，避免 half_open 卡死。
+		if now.Sub(breaker.halfOpenAt) >= params.cooldown {
+			breaker.halfOpenAt = now
+			breaker.halfOpenInFlight = 1
+			return true
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// noteAccount 记录预热期内账号的创建时间；已过预热期或未知创建时间的账号不记录并清除旧记录。
+func (b *openAIAccountCircuitBreakers) noteAccount(account *Account, params openAICircuitBreakerParams, now time.Time) {
+	if b == nil || account == nil || account.ID <= 0 || params.warmupWindow <= 0 {
+		return
+	}
+	if account.CreatedAt.IsZero() || now.Sub(account.CreatedAt) >= params.warmupWindow {
+		b.accountCreatedAt.Delete(account.ID)
+		return
+	}
+	b.accountCreatedAt.Store(account.ID, account.CreatedAt)
+}
+
+// inWarmup 判断账号此刻是否处于按创建时间计算的预热期内。
+func (b *openAIAccountCircuitBreakers) inWarmup(accountID int64, params openAICircuitBreakerParams, now time.Time) bool {
+	if params.warmupWindow <= 0 {
+		return false
+	}
+	value, ok := b.accountCreatedAt.Load(accountID)
+	if !ok {
+		return false
+	}
+	createdAt, _ := value.(time.Time)
+	if now.Sub(createdAt) >= params.warmupWindow {
+		b.accountCreatedAt.Delete(accountID)
+		return false
+	}
+	return true
+}
+
+// record 上报一次结果，返回本次失败是否使熔断器进入 open（熔断）。
+func (b *openAIAccountCircuitBreakers) record(accountID int64, success bool, params openAICircuitBreakerParams, now time.Time) (tripped bool) {
+	if b == nil || accountID <= 0 {
+		return false
+	}
+	key := openAICircuitBreakerKey{groupID: params.groupID, accountID: accountID}
+	if success {
+		breaker := b.load(key)
+		if breaker == nil {
+			return false
+		}
+		breaker.mu.Lock()
+		breaker.state = openAICircuitBreakerStateClosed
+		breaker.consecutiveFails = 0
+		breaker.halfOpenInFlight = 0
+		breaker.mu.Unlock()
+		return false
+	}
+
+	breaker := b.loadOrCreate(key)
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	if breaker.state == openAICircuitBreakerStateClosed && b.inWarmup(accountID, params, now) {
+		b.warmupExemptTotal.Add(1)
+		return false
+	}
+	breaker.consecutiveFails++
+	switch breaker.state {
+	case openAICircuitBreakerStateHalfOpen:
+		breaker.state = openAICircuitBreakerStateOpen
+		breaker.openedAt = now
+		breaker.halfOpenInFlight = 0
+		b.tripTotal.Add(1)
+		return true
+	case openAICircuitBreakerStateClosed:
+		if breaker.consecutiveFails >= params.failThreshold {
+			breaker.state = openAICircuitBreakerStateOpen
+			breaker.openedAt = now
+			b.tripTotal.Add(1)
+			return true
+		}
+	}
+	return false
+}
+
+// halfOpenProbe 返回账号在 params 作用域内被选中时是否需要占用半开探测名额（half_open，或 open 且冷却已结束），
+// 以及探测排序依据；其余情况 ok=false。不修改熔断器状态。
+func (b *openAIAccountCircuitBreakers) halfOpenProbe(accountID int64, params openAICircuitBreakerParams, now time.Time) (consecutiveFails int, openedAt time.Time, ok bool) {
+	if b == nil || accountID <= 0 {
+		return 0, time.Time{}, false
+	}
+	breaker := b.load(openAICircuitBreakerKey{groupID: params.groupID, accountID: accountID})
+	if breaker == nil {
+		return 0, time.Time{}, false
+	}
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	switch breaker.state {
+	case openAICircuitBreakerStateHalfOpen:
+	case openAICircuitBreakerStateOpen:
+		if now.Sub(breaker.openedAt) < params.cooldown {
+			return 0, time.Time{}, false
+		}
+	default:
+		return 0, time.Time{}, false
+	}
+	return breaker.consecutiveFails, breaker.openedAt, true
+}
+
+// reset 将账号在全部作用域（全局及各覆盖分组）的熔断器强制恢复为 closed 并清空连续失败计数，
+// 返回账号此前是否存在熔断记录。
+func (b *openAIAccountCircuitBreakers) reset(accountID int64) bool {
+	if b == nil || accountID <= 0 {
+		return false
+	}
+	found := false
+	b.breakers.Range(func(key, value any) bool {
+		breakerKey, ok := key.(openAICircuitBreakerKey)
+		breaker, typed := value.(*openAIAccountCircuitBreaker)
+		if !ok || !typed || breakerKey.accountID != accountID {
+			return true
+		}
+		breaker.mu.Lock()
+		breaker.state = openAICircuitBreakerStateClosed
+		breaker.consecutiveFails = 0
+		breaker.halfOpenInFlight = 0
+		breaker.openedAt = time.Time{}
+		breaker.halfOpenAt = time.Time{}
+		breaker.mu.Unlock()
+		found = true
+		return true
+	})
+	if !found {
+		return false
+	}
+	b.manualResetTotal.Add(1)
+	return true
+}
+
+func (b *openAIAccountCircuitBreakers) list() []CircuitBreakerInfo {
+	if b == nil {
+		return nil
+	}
+	out := make([]CircuitBreakerInfo, 0)
+	b.breakers.Range(func(key, value any) bool {
+		breakerKey, ok := key.(openAICircuitBreakerKey)
+		breaker, typed := value.(*openAIAccountCircuitBreaker)
+		if !ok || !typed {
+			return true
+		}
+		breaker.mu.Lock()
+		info := CircuitBreakerInfo{
+			AccountID:        breakerKey.accountID,
+			GroupID:          breakerKey.groupID,
+			State:            breaker.state,
+			ConsecutiveFails: breaker.consecutiveFails,
+			HalfOpenInFlight: breaker.halfOpenInFlight,
+		}
+		if !breaker.openedAt.IsZero() && breaker.state != openAICircuitBreakerStateClosed {
+			openedAt := breaker.openedAt
+			info.OpenedAt = &openedAt
+		}
+		breaker.mu.Unlock()
+		out = append(out, info)
+		return true
+	})
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].AccountID != out[j].AccountID {
+			return out[i].AccountID < out[j].AccountID
+		}
+		return out[i].GroupID < out[j].GroupID
+	})
+	return out
+}
+
+const (
+	openAIHalfOpenProbeStrategyAll             = "all"
+	openAIHalfOpenProbeStrategyClosestRecovery = "closest_recovery"
+	openAIHalfOpenProbeStrategyBestScore       = "best_score"
+)
+
+// openAIHalfOpenProbe 单次调度中需要占用探测名额的半开候选账号及其排序依据。
+type openAIHalfOpenProbe struct {
+	account          *Account
+	consecutiveFails int
+	openedAt         time.Time
+	errorRate        float64
+	ttft             float64
+	hasTTFT          bool
+}
+
+// pickOpenAIHalfOpenProbe 按策略从多个半开探测账号中选出保留的一个：
+// closest_recovery 优先连续失败次数最少、其次熔断时间最早（冷却最久）；
+// best_score 优先历史错误率最低、其次 TTFT 最低（无样本视为最差）。
+// 排序依据完全相同时保留账号 ID 较小者，保证结果稳定。
+func pickOpenAIHalfOpenProbe(probes []openAIHalfOpenProbe, strategy string) openAIHalfOpenProbe {
+	best := probes[0]
+	for _, probe := range probes[1:] {
+		if openAIHalfOpenProbeBetter(probe, best, strategy) {
+			best = probe
+		}
+	}
+	return best
+}
+
+func openAIHalfOpenProbeBetter(a, b openAIHalfOpenProbe, strategy string) bool {
+	switch strategy {
+	case openAIHalfOpenProbeStrategyBestScore:
+		if a.errorRate != b.errorRate {
+			return a.errorRate < b.errorRate
+		}
+		if a.hasTTFT != b.hasTTFT {
+			return a.hasTTFT
+		}
+		if a.hasTTFT && a.ttft != b.ttft {
+			return a.ttft < b.ttft
+		}
+	default:
+		if a.consecutiveFails != b.consecutiveFails {
+			return a.consecutiveFails < b.consecutiveFails
+		}
+		if !a.openedAt.Equal(b.openedAt) {
+			return a.openedAt.Before(b.openedAt)
+		}
+	}
+	return a.account.ID < b.account.ID
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+)
+
+// openAIAccountAutoDisableTimeout 自动禁用写库的超时；在上报路径之外异步执行，不阻塞调度。
+const openAIAccountAutoDisableTimeout = 5 * time.Second
+
+// OpenAIAccountAutoDisableEvent 账号因窗口内反复熔断被自动禁用时的告警事件。
+type OpenAIAccountAutoDisableEvent struct {
+	AccountID int64
+	// Trips 触发禁用时窗口内的熔断次数。
+	Trips  int
+	Window time.Duration
+	// Reason 写入账号 error_message 的原因，管理员清除错误后账号恢复调度。
+	Reason string
+	At     time.Time
+}
+
+// openAIAccountBreakerEscalation 记录账号全局熔断器的近期熔断时间。
+// 熔断器冷却后会自动半开探测并可能恢复，对 key 已吊销等持续故障的账号会无休止地 open/half_open 往复；
+// 窗口内熔断次数达到阈值时升级为持久禁用，由管理员确认后手动恢复。
+type openAIAccountBreakerEscalation struct {
+	trips            sync.Map // accountID -> *openAIAccountBreakerTripHistory
+	autoDisableTotal atomic.Int64
+	hook             atomic.Pointer[func(OpenAIAccountAutoDisableEvent)]
+}
+
+type openAIAccountBreakerTripHistory struct {
+	mu    sync.Mutex
+	times []time.Time
+}
+
+// noteTrip 记录一次熔断，返回窗口内熔断次数是否达到阈值；达到阈值时清空历史，保证同一轮只升级一次。
+func (e *openAIAccountBreakerEscalation) noteTrip(accountID int64, now time.Time, threshold int, window time.Duration) (int, bool) {
+	value, _ := e.trips.LoadOrStore(accountID, &openAIAccountBreakerTripHistory{})
+	history, _ := value.(*openAIAccountBreakerTripHistory)
+	if history == nil {
+		return 0, false
+	}
+	history.mu.Lock()
+	defer history.mu.Unlock()
+	kept := history.times[:0]
+	for _, at := range history.times {
+		if now.Sub(at) < window {
+			kept = append(kept, at)
+		}
+	}
+	kept = append(kept, now)
+	if len(kept) > threshold {
+		kept = kept[len(kept)-threshold:]
+	}
+	history.times = kept
+	if len(kept) < threshold {
+		return len(kept), false
+	}
+	history.times = nil
+	return threshold, true
+}
+
+// SetOnOpenAIAccountAutoDisabled 设置账号被自动禁用时的告警回调；回调在独立 goroutine 中执行，nil 表示取消。
+func (s *OpenAIGatewayService) SetOnOpenAIAccountAutoDisabled(callback func(OpenAIAccountAutoDisableEvent)) {
+	if s == nil {
+		return
+	}
+	if callback == nil {
+		s.openaiBreakerEscalation.hook.Store(nil)
+		return
+	}
+	s.openaiBreakerEscalation.hook.Store(&callback)
+}
+
+// escalateOpenAICircuitBreakerTrip 在账号全局熔断器熔断时调用；窗口内熔断次数达到
+// scheduler_circuit_breaker_auto_disable_trips 时将账号置为 error 状态停止调度。
+func (s *OpenAIGatewayService) escalateOpenAICircuitBreakerTrip(accountID int64, now time.Time) {
+	if s == nil || s.cfg == nil || accountID <= 0 {
+		return
+	}
+	wsCfg := s.openAIWSConfig()
+	threshold := wsCfg.SchedulerCircuitBreakerAutoDisableTrips
+	window := time.Duration(wsCfg.SchedulerCircuitBreakerAutoDisableWindowSeconds) * time.Second
+	if threshold <= 0 || window <= 0 {
+		return
+	}
+	trips, escalate := s.openaiBreakerEscalation.noteTrip(accountID, now, threshold, window)
+	if !escalate {
+		return
+	}
+	event := OpenAIAccountAutoDisableEvent{
+		AccountID: accountID,
+		Trips:     trips,
+		Window:    window,
+		Reason:    fmt.Sprintf("circuit breaker tripped %d times within %s; auto-disabled, clear the error to re-enable", trips, window),
+		At:        now,
+	}
+	go s.autoDisableOpenAIAccount(event)
+}
+
+func (s *OpenAIGatewayService) autoDisableOpenAIAccount(event OpenAIAccountAutoDisableEvent) {
+	if s.accountRepo == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), openAIAccountAutoDisableTimeout)
+	defer cancel()
+	if err := s.accountRepo.SetError(ctx, event.AccountID, event.Reason); err != nil {
+		logger.LegacyPrintf("service.openai_scheduler", "[CircuitBreaker] 自动禁用账号失败: account=%d err=%v", event.AccountID, err)
+		return
+	}
+	s.openaiBreakerEscalation.autoDisableTotal.Add(1)
+	logger.LegacyPrintf("service.openai_scheduler", "[CircuitBreaker] 账号在 %s 内熔断 %d 次，已自动禁用: account=%d", event.Window, event.Trips, event.AccountID)
+	if hook := s.openaiBreakerEscalation.hook.Load(); hook != nil {
+		(*hook)(event)
+	}
+}
@@ -0,0 +1,758 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIAccountCircuitBreakers_StateTransitions(t *testing.T) {
+	breakers := newOpenAIAccountCircuitBreakers()
+	params := openAICircuitBreakerParams{failThreshold: 2, cooldown: time.Minute, halfOpenMax: 1}
+	now := time.Now()
+
+	require.True(t, breakers.allow(1, params, now), "无记录账号应放行")
+	breakers.record(1, false, params, now)
+	require.True(t, breakers.allow(1, params, now), "未达阈值前保持 closed")
+	breakers.record(1, false, params, now)
+	require.False(t, breakers.allow(1, params, now.Add(time.Second)), "达到阈值后应 open")
+	require.Equal(t, int64(1), breakers.tripTotal.Load())
+
+	halfOpenAt := now.Add(time.Minute)
+	require.True(t, breakers.allow(1, params, halfOpenAt), "冷却结束后放行首个探测")
+	require.False(t, breakers.allow(1, params, halfOpenAt), "half_open 探测名额用尽")
+
+	breakers.record(1, false, params, halfOpenAt)
+	require.False(t, breakers.allow(1, params, halfOpenAt.Add(time.Second)), "探测失败应重新 open")
+	require.Equal(t, int64(2), breakers.tripTotal.Load())
+
+	recoverAt := halfOpenAt.Add(time.Minute)
+	require.True(t, breakers.allow(1, params, recoverAt))
+	breakers.record(1, true, params, recoverAt)
+	infos := breakers.list()
+	require.Len(t, infos, 1)
+	require.Equal(t, openAICircuitBreakerStateClosed, infos[0].State)
+	require.Zero(t, infos[0].ConsecutiveFails)
+	require.Nil(t, infos[0].OpenedAt)
+}
+
+func TestOpenAIAccountCircuitBreakers_ResetReopensAdmission(t *testing.T) {
+	breakers := newOpenAIAccountCircuitBreakers()
+	params := openAICircuitBreakerParams{failThreshold: 1, cooldown: time.Hour, halfOpenMax: 1}
+	now := time.Now()
+
+	require.False(t, breakers.reset(7), "无记录账号 reset 应返回 false")
+	breakers.record(7, false, params, now)
+	infos := breakers.list()
+	require.Len(t, infos, 1)
+	require.Equal(t, openAICircuitBreakerStateOpen, infos[0].State)
+	require.NotNil(t, infos[0].OpenedAt)
+	require.False(t, breakers.allow(7, params, now))
+
+	require.True(t, breakers.reset(7))
+	require.True(t, breakers.allow(7, params, now), "手动 reset 后应立即放行")
+	infos = breakers.list()
+	require.Equal(t, openAICircuitBreakerStateClosed, infos[0].State)
+	require.Zero(t, infos[0].ConsecutiveFails)
+	require.Equal(t, int64(1), breakers.manualResetTotal.Load())
+}
+
+func TestOpenAIAccountCircuitBreakers_WarmupFailuresDoNotTrip(t *testing.T) {
+	breakers := newOpenAIAccountCircuitBreakers()
+	params := openAICircuitBreakerParams{failThreshold: 2, cooldown: time.Minute, halfOpenMax: 1, warmupWindow: 10 * time.Minute}
+	now := time.Now()
+	account := &Account{ID: 1, CreatedAt: now.Add(-time.Minute)}
+	breakers.noteAccount(account, params, now)
+
+	// 账号创建后的预热期内连续失败不应熔断。
+	for i := 0; i < 5; i++ {
+		breakers.record(1, false, params, now)
+	}
+	require.True(t, breakers.allow(1, params, now), "预热期失败不应打开熔断器")
+	infos := breakers.list()
+	require.Len(t, infos, 1)
+	require.Equal(t, openAICircuitBreakerStateClosed, infos[0].State)
+	require.Zero(t, infos[0].ConsecutiveFails)
+	require.Equal(t, int64(5), breakers.warmupExemptTotal.Load())
+
+	// 预热期按创建时间结束后按正常阈值计数。
+	afterWarmup := account.CreatedAt.Add(params.warmupWindow)
+	breakers.record(1, false, params, afterWarmup)
+	require.True(t, breakers.allow(1, params, afterWarmup))
+	breakers.record(1, false, params, afterWarmup)
+	require.False(t, breakers.allow(1, params, afterWarmup), "预热期后达到阈值应熔断")
+	require.Equal(t, int64(1), breakers.tripTotal.Load())
+
+	// 成功结果不为没有熔断记录的账号建立记录。
+	breakers.record(3, true, openAICircuitBreakerParams{failThreshold: 2, cooldown: time.Minute, halfOpenMax: 1}, now)
+	require.Nil(t, breakers.load(openAICircuitBreakerKey{accountID: 3}))
+}
+
+func TestOpenAIAccountCircuitBreakers_WarmupSkipsOldAccountsInFreshBreaker(t *testing.T) {
+	// 模拟进程重启：新建的熔断器中，早已创建的账号不应获得预热豁免。
+	breakers := newOpenAIAccountCircuitBreakers()
+	params := openAICircuitBreakerParams{failThreshold: 2, cooldown: time.Minute, halfOpenMax: 1, warmupWindow: 10 * time.Minute}
+	now := time.Now()
+	breakers.noteAccount(&Account{ID: 2, CreatedAt: now.Add(-24 * time.Hour)}, params, now)
+
+	breakers.record(2, false, params, now)
+	breakers.record(2, false, params, now)
+	require.False(t, breakers.allow(2, params, now), "老账号不应享有预热期")
+	require.Zero(t, breakers.warmupExemptTotal.Load())
+
+	// 未经调度选中记录创建时间的账号同样不豁免。
+	breakers.record(4, false, params, now)
+	breakers.record(4, false, params, now)
+	require.False(t, breakers.allow(4, params, now))
+	require.Zero(t, breakers.warmupExemptTotal.Load())
+}
+
+func TestOpenAIAccountCircuitBreakers_ResetConcurrentWithAllowAndRecord(t *testing.T) {
+	breakers := newOpenAIAccountCircuitBreakers()
+	params := openAICircuitBreakerParams{failThreshold: 3, cooldown: time.Millisecond, halfOpenMax: 2}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				now := time.Now()
+				switch (worker + i) % 4 {
+				case 0:
+					breakers.record(9, false, params, now)
+				case 1:
+					breakers.record(9, true, params, now)
+				case 2:
+					_ = breakers.allow(9, params, now)
+				default:
+					_ = breakers.reset(9)
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	require.True(t, breakers.reset(9))
+	infos := breakers.list()
+	require.Len(t, infos, 1)
+	require.Equal(t, openAICircuitBreakerStateClosed, infos[0].State)
+	require.Zero(t, infos[0].ConsecutiveFails)
+	require.Zero(t, infos[0].HalfOpenInFlight)
+}
+
+func TestOpenAIGatewayService_SelectAccountWithScheduler_CircuitBreakerSkipsAndManualReset(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(17)
+	accounts := []Account{
+		{ID: 5301, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3, Priority: 0},
+		{ID: 5302, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3, Priority: 5},
+	}
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.LBTopK = 1
+	cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Priority = 1
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerEnabled = true
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerFailThreshold = 2
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerCooldownSeconds = 3600
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerHalfOpenMax = 1
+
+	svc := &OpenAIGatewayService{
+		accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+		cache:              &stubGatewayCache{},
+		cfg:                cfg,
+		concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+	}
+	selectOnce := func() int64 {
+		selection, _, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.NotNil(t, selection)
+		require.NotNil(t, selection.Account)
+		if selection.ReleaseFunc != nil {
+			selection.ReleaseFunc()
+		}
+		return selection.Account.ID
+	}
+
+	require.Equal(t, int64(5301), selectOnce())
+	svc.ReportOpenAIAccountScheduleResult(5301, false, nil)
+	svc.ReportOpenAIAccountScheduleResult(5301, false, nil)
+	require.Equal(t, int64(5302), selectOnce(), "熔断账号不应参与新的调度")
+
+	infos := svc.ListCircuitBreakers()
+	require.Len(t, infos, 1)
+	require.Equal(t, int64(5301), infos[0].AccountID)
+	require.Equal(t, openAICircuitBreakerStateOpen, infos[0].State)
+	require.Equal(t, 2, infos[0].ConsecutiveFails)
+
+	require.True(t, svc.ResetCircuitBreaker(5301))
+	require.False(t, svc.ResetCircuitBreaker(5399))
+	require.Equal(t, int64(5301), selectOnce(), "手动 reset 后账号应立即重新参与调度")
+
+	metrics := svc.SnapshotOpenAIAccountSchedulerMetrics()
+	require.Equal(t, int64(1), metrics.CircuitBreakerTripTotal)
+	require.Equal(t, int64(1), metrics.CircuitBreakerManualResetTotal)
+}
+
+func TestOpenAIGatewayService_SelectAccountWithScheduler_CircuitBreakerWarmupByAccountAge(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(18)
+	now := time.Now()
+	accounts := []Account{
+		{ID: 5311, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3, Priority: 0, CreatedAt: now.Add(-time.Minute)},
+		{ID: 5312, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3, Priority: 5, CreatedAt: now.Add(-30 * 24 * time.Hour)},
+	}
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.LBTopK = 1
+	cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Priority = 1
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerEnabled = true
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerFailThreshold = 2
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerCooldownSeconds = 3600
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerHalfOpenMax = 1
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerWarmupSeconds = 600
+
+	svc := &OpenAIGatewayService{
+		accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+		cache:              &stubGatewayCache{},
+		cfg:                cfg,
+		concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+	}
+	selectOnce := func() int64 {
+		selection, _, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.NotNil(t, selection)
+		require.NotNil(t, selection.Account)
+		if selection.ReleaseFunc != nil {
+			selection.ReleaseFunc()
+		}
+		return selection.Account.ID
+	}
+
+	// 新建账号处于预热期，连续失败不熔断。
+	require.Equal(t, int64(5311), selectOnce())
+	for i := 0; i < 3; i++ {
+		svc.ReportOpenAIAccountScheduleResult(5311, false, nil)
+	}
+	require.Equal(t, int64(5311), selectOnce(), "预热期内的新账号不应被熔断")
+
+	// 早已创建的账号在新进程中同样没有预热期，失败按正常阈值计数。
+	svc.ReportOpenAIAccountScheduleResult(5312, false, nil)
+	svc.ReportOpenAIAccountScheduleResult(5312, false, nil)
+	infos := svc.ListCircuitBreakers()
+	var oldAccountState string
+	for _, info := range infos {
+		if info.AccountID == 5312 {
+			oldAccountState = info.State
+		}
+	}
+	require.Equal(t, openAICircuitBreakerStateOpen, oldAccountState)
+	metrics := svc.SnapshotOpenAIAccountSchedulerMetrics()
+	require.Equal(t, int64(3), metrics.CircuitBreakerWarmupExemptTotal)
+	require.Equal(t, int64(1), metrics.CircuitBreakerTripTotal)
+}
+
+func TestOpenAIGatewayService_SelectAccountWithScheduler_CircuitBreakerAllOpenFallsBack(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(18)
+	accounts := []Account{
+		{ID: 5311, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 1},
+	}
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerEnabled = true
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerFailThreshold = 1
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerCooldownSeconds = 3600
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerHalfOpenMax = 1
+
+	svc := &OpenAIGatewayService{
+		accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+		cache:              &stubGatewayCache{},
+		cfg:                cfg,
+		concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+	}
+	svc.ReportOpenAIAccountScheduleResult(5311, false, nil)
+
+	selection, _, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+	require.NoError(t, err)
+	require.NotNil(t, selection)
+	require.Equal(t, int64(5311), selection.Account.ID, "全部候选熔断时应忽略熔断兜底")
+	if selection.ReleaseFunc != nil {
+		selection.ReleaseFunc()
+	}
+}
+
+func TestOpenAIGatewayService_SelectAccountWithScheduler_CircuitBreakerGroupOverrides(t *testing.T) {
+	ctx := context.Background()
+	strictGroupID := int64(21)
+	lenientGroupID := int64(22)
+	accounts := []Account{
+		{ID: 5321, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3, Priority: 0},
+		{ID: 5322, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3, Priority: 5},
+	}
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.LBTopK = 1
+	cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Priority = 1
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerEnabled = true
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerFailThreshold = 3
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerCooldownSeconds = 3600
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerHalfOpenMax = 1
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerGroupOverrides = []config.GatewayOpenAIWSCircuitBreakerGroupOverride{
+		{GroupID: strictGroupID, FailThreshold: 2},
+		{GroupID: lenientGroupID, FailThreshold: 5},
+	}
+
+	svc := &OpenAIGatewayService{
+		accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+		cache:              &stubGatewayCache{},
+		cfg:                cfg,
+		concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+	}
+	selectOnce := func(groupID *int64) int64 {
+		selection, _, err := svc.SelectAccountWithScheduler(ctx, groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.NotNil(t, selection)
+		require.NotNil(t, selection.Account)
+		if selection.ReleaseFunc != nil {
+			selection.ReleaseFunc()
+		}
+		return selection.Account.ID
+	}
+
+	svc.ReportOpenAIAccountScheduleResult(5321, false, nil)
+	svc.ReportOpenAIAccountScheduleResult(5321, false, nil)
+	require.Equal(t, int64(5322), selectOnce(&strictGroupID), "严格分组 2 次失败即熔断")
+	require.Equal(t, int64(5321), selectOnce(&lenientGroupID), "宽松分组未达阈值仍可调度")
+	require.Equal(t, int64(5321), selectOnce(nil), "全局阈值未达到")
+
+	svc.ReportOpenAIAccountScheduleResult(5321, false, nil)
+	require.Equal(t, int64(5322), selectOnce(nil), "全局 3 次失败后熔断")
+	require.Equal(t, int64(5321), selectOnce(&lenientGroupID), "宽松分组熔断状态独立于全局")
+
+	svc.ReportOpenAIAccountScheduleResult(5321, false, nil)
+	svc.ReportOpenAIAccountScheduleResult(5321, false, nil)
+	require.Equal(t, int64(5322), selectOnce(&lenientGroupID), "宽松分组 5 次失败后熔断")
+
+	infos := svc.ListCircuitBreakers()
+	require.Len(t, infos, 3)
+	require.Equal(t, int64(0), infos[0].GroupID)
+	require.Equal(t, strictGroupID, infos[1].GroupID)
+	require.Equal(t, lenientGroupID, infos[2].GroupID)
+	for _, info := range infos {
+		require.Equal(t, int64(5321), info.AccountID)
+		require.Equal(t, openAICircuitBreakerStateOpen, info.State)
+	}
+
+	require.True(t, svc.ResetCircuitBreaker(5321))
+	require.Equal(t, int64(5321), selectOnce(&strictGroupID), "手动 reset 应清除全部作用域")
+	require.Equal(t, int64(5321), selectOnce(&lenientGroupID))
+}
+
+func TestOpenAIAccountCircuitBreakers_CanAttemptAndHalfOpenProbe(t *testing.T) {
+	breakers := newOpenAIAccountCircuitBreakers()
+	params := openAICircuitBreakerParams{failThreshold: 1, cooldown: time.Minute, halfOpenMax: 2}
+	now := time.Now()
+
+	_, _, ok := breakers.halfOpenProbe(3, params, now)
+	require.False(t, ok, "无记录账号不是半开探测")
+	require.True(t, breakers.canAttempt(3, params, now))
+
+	breakers.record(3, false, params, now)
+	_, _, ok = breakers.halfOpenProbe(3, params, now)
+	require.False(t, ok, "冷却中的 open 状态不是半开探测")
+	require.False(t, breakers.canAttempt(3, params, now))
+
+	// 冷却结束：canAttempt 与 halfOpenProbe 反复调用都不改变状态，也不占用探测名额。
+	halfOpenAt := now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		require.True(t, breakers.canAttempt(3, params, halfOpenAt))
+		fails, openedAt, ok := breakers.halfOpenProbe(3, params, halfOpenAt)
+		require.True(t, ok)
+		require.Equal(t, 1, fails)
+		require.True(t, openedAt.Equal(now))
+	}
+	infos := breakers.list()
+	require.Len(t, infos, 1)
+	require.Equal(t, openAICircuitBreakerStateOpen, infos[0].State)
+	require.Zero(t, infos[0].HalfOpenInFlight)
+
+	require.True(t, breakers.allow(3, params, halfOpenAt))
+	require.True(t, breakers.canAttempt(3, params, halfOpenAt))
+	require.True(t, breakers.allow(3, params, halfOpenAt))
+	require.False(t, breakers.canAttempt(3, params, halfOpenAt), "探测名额用尽")
+	require.False(t, breakers.allow(3, params, halfOpenAt))
+	_, _, ok = breakers.halfOpenProbe(3, params, halfOpenAt)
+	require.True(t, ok)
+	require.Equal(t, 2, breakers.list()[0].HalfOpenInFlight)
+}
+
+func TestPickOpenAIHalfOpenProbe(t *testing.T) {
+	now := time.Now()
+	probes := []openAIHalfOpenProbe{
+		{account: &Account{ID: 1}, consecutiveFails: 5, openedAt: now.Add(-time.Hour), errorRate: 0.1, ttft: 900, hasTTFT: true},
+		{account: &Account{ID: 2}, consecutiveFails: 2, openedAt: now, errorRate: 0.4, ttft: 300, hasTTFT: true},
+		{account: &Account{ID: 3}, consecutiveFails: 2, openedAt: now.Add(-time.Minute), errorRate: 0.1, ttft: 500, hasTTFT: true},
+		{account: &Account{ID: 4}, consecutiveFails: 9, openedAt: now, errorRate: 0.1},
+	}
+
+	require.Equal(t, int64(3), pickOpenAIHalfOpenProbe(probes, openAIHalfOpenProbeStrategyClosestRecovery).account.ID,
+		"closest_recovery 优先连续失败最少，其次熔断最久")
+	require.Equal(t, int64(3), pickOpenAIHalfOpenProbe(probes, openAIHalfOpenProbeStrategyBestScore).account.ID,
+		"best_score 优先错误率最低，其次 TTFT 最低，无 TTFT 样本视为最差")
+
+	tied := []openAIHalfOpenProbe{
+		{account: &Account{ID: 8}, openedAt: now},
+		{account: &Account{ID: 7}, openedAt: now},
+	}
+	require.Equal(t, int64(7), pickOpenAIHalfOpenProbe(tied, openAIHalfOpenProbeStrategyClosestRecovery).account.ID, "完全相同时保留 ID 较小者")
+	require.Equal(t, int64(7), pickOpenAIHalfOpenProbe(tied, openAIHalfOpenProbeStrategyBestScore).account.ID)
+}
+
+func TestOpenAIGatewayService_SelectAccountWithScheduler_HalfOpenProbeStrategy(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(19)
+	accounts := []Account{
+		{ID: 5321, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3},
+		{ID: 5322, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3},
+		{ID: 5323, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3},
+	}
+	newSvc := func(strategy string) (*OpenAIGatewayService, *defaultOpenAIAccountScheduler) {
+		cfg := &config.Config{}
+		cfg.Gateway.OpenAIWS.LBTopK = 3
+		cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Priority = 1
+		cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerEnabled = true
+		cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerFailThreshold = 1
+		cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerCooldownSeconds = 3600
+		cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerHalfOpenMax = 1
+		cfg.Gateway.OpenAIWS.SchedulerHalfOpenProbeStrategy = strategy
+		svc := &OpenAIGatewayService{
+			accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+			cache:              &stubGatewayCache{},
+			cfg:                cfg,
+			concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+		}
+		scheduler, ok := svc.getOpenAIAccountScheduler().(*defaultOpenAIAccountScheduler)
+		require.True(t, ok)
+		// 5321 连续失败 3 次、5322 连续失败 1 次，且二者冷却均已结束；5323 保持 closed。
+		for i := 0; i < 3; i++ {
+			svc.ReportOpenAIAccountScheduleResult(5321, false, nil)
+		}
+		svc.ReportOpenAIAccountScheduleResult(5322, false, nil)
+		for _, id := range []int64{5321, 5322} {
+			breaker := scheduler.breakers.load(openAICircuitBreakerKey{accountID: id})
+			require.NotNil(t, breaker)
+			breaker.mu.Lock()
+			breaker.openedAt = time.Now().Add(-2 * time.Hour)
+			breaker.mu.Unlock()
+		}
+		return svc, scheduler
+	}
+	halfOpenInFlight := func(svc *OpenAIGatewayService) map[int64]int {
+		out := make(map[int64]int)
+		for _, info := range svc.ListCircuitBreakers() {
+			out[info.AccountID] = info.HalfOpenInFlight
+		}
+		return out
+	}
+	// 只有最终选中的半开账号占用探测名额，其余候选的熔断器状态不变。
+	expectedInFlight := func(selectedID int64) map[int64]int {
+		out := map[int64]int{5321: 0, 5322: 0}
+		if _, ok := out[selectedID]; ok {
+			out[selectedID] = 1
+		}
+		return out
+	}
+
+	t.Run("all_keeps_every_probe", func(t *testing.T) {
+		svc, _ := newSvc("")
+		selection, decision, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.NotNil(t, selection)
+		if selection.ReleaseFunc != nil {
+			selection.ReleaseFunc()
+		}
+		require.Equal(t, 3, decision.CandidateCount)
+		require.Equal(t, expectedInFlight(selection.Account.ID), halfOpenInFlight(svc))
+		require.Zero(t, svc.SnapshotOpenAIAccountSchedulerMetrics().HalfOpenProbeReleasedTotal)
+	})
+
+	t.Run("closest_recovery", func(t *testing.T) {
+		svc, _ := newSvc(openAIHalfOpenProbeStrategyClosestRecovery)
+		selection, decision, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.NotNil(t, selection)
+		if selection.ReleaseFunc != nil {
+			selection.ReleaseFunc()
+		}
+		require.Equal(t, 2, decision.CandidateCount, "仅保留一个半开探测账号")
+		require.NotEqual(t, int64(5321), selection.Account.ID)
+		require.Equal(t, expectedInFlight(selection.Account.ID), halfOpenInFlight(svc), "未保留的半开账号不应占用探测名额")
+		require.Equal(t, int64(1), svc.SnapshotOpenAIAccountSchedulerMetrics().HalfOpenProbeReleasedTotal)
+	})
+
+	t.Run("best_score", func(t *testing.T) {
+		svc, scheduler := newSvc(openAIHalfOpenProbeStrategyBestScore)
+		// 5321 历史表现更好：多次成功后错误率低于 5322（仅统计运行时指标，不影响熔断状态）。
+		for i := 0; i < 5; i++ {
+			scheduler.stats.report(5321, true, nil)
+		}
+		for i := 0; i < 5; i++ {
+			scheduler.stats.report(5322, false, nil)
+		}
+		selection, decision, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.NotNil(t, selection)
+		if selection.ReleaseFunc != nil {
+			selection.ReleaseFunc()
+		}
+		require.Equal(t, 2, decision.CandidateCount)
+		require.NotEqual(t, int64(5322), selection.Account.ID)
+		require.Equal(t, expectedInFlight(selection.Account.ID), halfOpenInFlight(svc))
+	})
+}
+
+func TestOpenAIGatewayService_SelectAccountWithScheduler_HalfOpenCandidatesReserveOnlySelected(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(23)
+	accounts := []Account{
+		{ID: 5331, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3},
+		{ID: 5332, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3},
+		{ID: 5333, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3},
+	}
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.LBTopK = 3
+	cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Priority = 1
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerEnabled = true
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerFailThreshold = 1
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerCooldownSeconds = 3600
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerHalfOpenMax = 1
+	cfg.Gateway.OpenAIWS.SchedulerHalfOpenProbeStrategy = openAIHalfOpenProbeStrategyAll
+	svc := &OpenAIGatewayService{
+		accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+		cache:              &stubGatewayCache{},
+		cfg:                cfg,
+		concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+	}
+	scheduler, ok := svc.getOpenAIAccountScheduler().(*defaultOpenAIAccountScheduler)
+	require.True(t, ok)
+	// 三个账号均熔断且冷却已结束：都是半开候选。
+	for _, account := range accounts {
+		svc.ReportOpenAIAccountScheduleResult(account.ID, false, nil)
+		breaker := scheduler.breakers.load(openAICircuitBreakerKey{accountID: account.ID})
+		require.NotNil(t, breaker)
+		breaker.mu.Lock()
+		breaker.openedAt = time.Now().Add(-2 * time.Hour)
+		breaker.mu.Unlock()
+	}
+
+	// 每次调度只为选中的账号占用探测名额；名额用尽的账号被过滤，后续调度依次选中其余半开账号。
+	selected := make(map[int64]struct{})
+	for i := 0; i < len(accounts); i++ {
+		selection, decision, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.NotNil(t, selection)
+		require.NotNil(t, selection.Account)
+		if selection.ReleaseFunc != nil {
+			selection.ReleaseFunc()
+		}
+		require.Equal(t, len(accounts)-i, decision.CandidateCount)
+		_, dup := selected[selection.Account.ID]
+		require.False(t, dup, "探测名额已占满的账号不应再次被选中")
+		selected[selection.Account.ID] = struct{}{}
+
+		for _, info := range svc.ListCircuitBreakers() {
+			if _, ok := selected[info.AccountID]; ok {
+				require.Equal(t, openAICircuitBreakerStateHalfOpen, info.State)
+				require.Equal(t, 1, info.HalfOpenInFlight)
+				continue
+			}
+			require.Equal(t, openAICircuitBreakerStateOpen, info.State, "未被选中的候选不应被推进到 half_open")
+			require.Zero(t, info.HalfOpenInFlight)
+		}
+	}
+}
+
+// openAIWSTripOnReadConn 在首次读取上游事件时触发一次回调，用于模拟 turn 进行中账号被熔断。
+type openAIWSTripOnReadConn struct {
+	*openAIWSCaptureConn
+	tripOnce sync.Once
+	trip     func()
+}
+
+func (c *openAIWSTripOnReadConn) ReadMessage(ctx context.Context) ([]byte, error) {
+	c.tripOnce.Do(c.trip)
+	return c.openAIWSCaptureConn.ReadMessage(ctx)
+}
+
+func TestOpenAIGatewayService_CircuitBreakerTripDoesNotAbortInFlightTurn(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(19)
+	accounts := []Account{
+		{ID: 5321, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3, Priority: 0,
+			Credentials: map[string]any{"api_key": "sk-breaker-inflight"}, Extra: map[string]any{"responses_websockets_v2_enabled": true}},
+		{ID: 5322, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3, Priority: 5},
+	}
+	cfg := newOpenAIWSIngressCaptureTestConfig()
+	cfg.Gateway.OpenAIWS.LBTopK = 1
+	cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Priority = 1
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerEnabled = true
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerFailThreshold = 1
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerCooldownSeconds = 3600
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerHalfOpenMax = 1
+
+	pool := newOpenAIWSConnPool(cfg)
+	svc := &OpenAIGatewayService{
+		accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+		cfg:                cfg,
+		httpUpstream:       &httpUpstreamRecorder{},
+		cache:              &stubGatewayCache{},
+		concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+		openaiWSResolver:   NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:      NewCodexToolCorrector(),
+		openaiWSPool:       pool,
+	}
+	upstream := &openAIWSTripOnReadConn{
+		openAIWSCaptureConn: &openAIWSCaptureConn{
+			events: [][]byte{
+				[]byte(`{"type":"response.completed","response":{"id":"resp_breaker_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+				[]byte(`{"type":"response.completed","response":{"id":"resp_breaker_2","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+			},
+		},
+		// 上游已收到请求、turn 尚未结束时，其他请求的失败使该账号熔断。
+		trip: func() { svc.ReportOpenAIAccountScheduleResult(5321, false, nil) },
+	}
+	pool.setClientDialerForTest(&openAIWSQueueDialer{conns: []openAIWSClientConn{upstream}})
+
+	var resultsMu sync.Mutex
+	var turnErrs []error
+	hooks := &OpenAIWSIngressHooks{
+		AfterTurn: func(_ int, _ *OpenAIForwardResult, turnErr error) {
+			resultsMu.Lock()
+			turnErrs = append(turnErrs, turnErr)
+			resultsMu.Unlock()
+		},
+	}
+	clientMessages := [][]byte{
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false}`),
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"previous_response_id":"resp_breaker_1"}`),
+	}
+	received := runOpenAIWSIngressSessionWithServiceForTest(t, svc, &accounts[0], "sk-breaker-inflight", clientMessages, hooks)
+
+	infos := svc.ListCircuitBreakers()
+	require.Len(t, infos, 1)
+	require.Equal(t, openAICircuitBreakerStateOpen, infos[0].State, "turn 进行中账号应已熔断")
+
+	resultsMu.Lock()
+	require.Equal(t, []error{nil, nil}, turnErrs, "熔断不应中断已持有连接的进行中 turn 及会话")
+	resultsMu.Unlock()
+	require.Len(t, received, 2)
+	require.Contains(t, string(received[0]), "resp_breaker_1")
+	require.Contains(t, string(received[1]), "resp_breaker_2")
+
+	selection, _, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+	require.NoError(t, err)
+	require.NotNil(t, selection)
+	require.Equal(t, int64(5322), selection.Account.ID, "新的调度应跳过已熔断账号")
+	if selection.ReleaseFunc != nil {
+		selection.ReleaseFunc()
+	}
+}
+
+type openAIAutoDisableAccountRepo struct {
+	stubOpenAIAccountRepo
+	mu       sync.Mutex
+	disabled map[int64]string
+}
+
+func (r *openAIAutoDisableAccountRepo) SetError(_ context.Context, id int64, errorMsg string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.disabled == nil {
+		r.disabled = make(map[int64]string)
+	}
+	r.disabled[id] = errorMsg
+	return nil
+}
+
+func (r *openAIAutoDisableAccountRepo) disabledReason(id int64) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reason, ok := r.disabled[id]
+	return reason, ok
+}
+
+func TestOpenAIAccountBreakerEscalation_NoteTripWindow(t *testing.T) {
+	var escalation openAIAccountBreakerEscalation
+	now := time.Now()
+	window := 10 * time.Minute
+
+	_, escalate := escalation.noteTrip(1, now, 3, window)
+	require.False(t, escalate)
+	_, escalate = escalation.noteTrip(1, now.Add(time.Minute), 3, window)
+	require.False(t, escalate)
+	trips, escalate := escalation.noteTrip(1, now.Add(10*time.Minute+30*time.Second), 3, window)
+	require.False(t, escalate, "窗口外的熔断不计数")
+	require.Equal(t, 2, trips)
+
+	trips, escalate = escalation.noteTrip(1, now.Add(10*time.Minute+45*time.Second), 3, window)
+	require.True(t, escalate)
+	require.Equal(t, 3, trips)
+	_, escalate = escalation.noteTrip(1, now.Add(11*time.Minute), 3, window)
+	require.False(t, escalate, "升级后重新计数")
+
+	_, escalate = escalation.noteTrip(2, now, 3, window)
+	require.False(t, escalate, "不同账号独立计数")
+}
+
+func TestOpenAIGatewayService_CircuitBreakerFlappingAutoDisablesAccount(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerEnabled = true
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerFailThreshold = 2
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerCooldownSeconds = 60
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerHalfOpenMax = 1
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerAutoDisableTrips = 3
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerAutoDisableWindowSeconds = 3600
+
+	repo := &openAIAutoDisableAccountRepo{}
+	svc := &OpenAIGatewayService{
+		accountRepo: repo,
+		cache:       &stubGatewayCache{},
+		cfg:         cfg,
+	}
+	events := make(chan OpenAIAccountAutoDisableEvent, 1)
+	svc.SetOnOpenAIAccountAutoDisabled(func(event OpenAIAccountAutoDisableEvent) {
+		events <- event
+	})
+
+	// 模拟反复熔断/恢复：每轮连续失败 2 次熔断，随后一次成功恢复为 closed。
+	flap := func(accountID int64) {
+		svc.ReportOpenAIAccountScheduleResult(accountID, false, nil)
+		svc.ReportOpenAIAccountScheduleResult(accountID, false, nil)
+		svc.ReportOpenAIAccountScheduleResult(accountID, true, nil)
+	}
+	flap(5401)
+	flap(5401)
+	flap(5402)
+	_, disabled := repo.disabledReason(5401)
+	require.False(t, disabled, "熔断次数未达阈值时不应禁用")
+
+	flap(5401)
+	select {
+	case event := <-events:
+		require.Equal(t, int64(5401), event.AccountID)
+		require.Equal(t, 3, event.Trips)
+		require.Equal(t, time.Hour, event.Window)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected auto-disable alert hook to fire")
+	}
+	reason, disabled := repo.disabledReason(5401)
+	require.True(t, disabled)
+	require.Contains(t, reason, "circuit breaker tripped 3 times")
+	_, disabled = repo.disabledReason(5402)
+	require.False(t, disabled)
+
+	metrics := svc.SnapshotOpenAIAccountSchedulerMetrics()
+	require.Equal(t, int64(4), metrics.CircuitBreakerTripTotal)
+	require.Equal(t, int64(1), metrics.CircuitBreakerAutoDisableTotal)
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+// 账号健康分（AccountHealthScore，0–100）计算公式：
+//
+//	score = 100
+//	      - 60 × errorRate                                   （错误率 EWMA，0–1）
+//	      - 20 × clamp01((ttftMs - 1000) / 9000)             （TTFT EWMA ≤1s 不扣分，≥10s 扣满）
+//	      - 30（熔断器处于 half_open）
+//	      - 50（账号处于限流 / 过载 / 临时不可调度冷却期）
+//
+// 结果截断到 [0, 100] 并取整；熔断器处于 open 时直接为 0。
+// 建议看板阈值：≥80 绿色，50–79 黄色，<50 红色。
+const (
+	openAIAccountHealthErrorPenalty    = 60.0
+	openAIAccountHealthTTFTPenalty     = 20.0
+	openAIAccountHealthTTFTFloorMs     = 1000.0
+	openAIAccountHealthTTFTCeilMs      = 10000.0
+	openAIAccountHealthHalfOpenPenalty = 30.0
+	openAIAccountHealthCooldownPenalty = 50.0
+	openAIAccountHealthScoreMax        = 100
+	openAIAccountHealthScoreMin        = 0
+)
+
+// OpenAIAccountRuntimeStatsSnapshot 单账号运行时统计快照：保留原始分量，并附带综合健康分。
+type OpenAIAccountRuntimeStatsSnapshot struct {
+	AccountID        int64   `json:"account_id"`
+	ErrorRate        float64 `json:"error_rate"`
+	TTFTMs           float64 `json:"ttft_ms"`
+	HasTTFT          bool    `json:"has_ttft"`
+	PrevNotFoundRate float64 `json:"prev_not_found_rate"`
+	// CircuitState 熔断器状态（closed/open/half_open）；账号没有熔断记录时为 closed。
+	CircuitState string `json:"circuit_state"`
+	// QuotaCooldown 账号当前是否处于限流、过载或临时不可调度冷却期。
+	QuotaCooldown      bool       `json:"quota_cooldown"`
+	CooldownUntil      *time.Time `json:"cooldown_until,omitempty"`
+	AccountHealthScore int        `json:"account_health_score"`
+	// ModelUsage 账号近期已完成 turn 的模型分布；尚无已完成 turn 时为空。
+	ModelUsage *OpenAIAccountModelUsageSnapshot `json:"model_usage,omitempty"`
+	// RecentErrors 账号最近的失败原因（新到旧，最多 5 条）；尚无失败时为空。
+	RecentErrors []OpenAIAccountErrorRecord `json:"recent_errors,omitempty"`
+	// StickySessions 本进程内当前绑定到该账号的粘连会话数。
+	StickySessions int `json:"sticky_sessions"`
+}
+
+// computeOpenAIAccountHealthScore 按文件头部公式计算健康分。
+func computeOpenAIAccountHealthScore(snapshot OpenAIAccountRuntimeStatsSnapshot) int {
+	if snapshot.CircuitState == openAICircuitBreakerStateOpen {
+		return openAIAccountHealthScoreMin
+	}
+	score := float64(openAIAccountHealthScoreMax)
+	score -= openAIAccountHealthErrorPenalty * clamp01(snapshot.ErrorRate)
+	if snapshot.HasTTFT {
+		ttftRatio := (snapshot.TTFTMs - openAIAccountHealthTTFTFloorMs) / (openAIAccountHealthTTFTCeilMs - openAIAccountHealthTTFTFloorMs)
+		score -= openAIAccountHealthTTFTPenalty * clamp01(ttftRatio)
+	}
+	if snapshot.CircuitState == openAICircuitBreakerStateHalfOpen {
+		score -= openAIAccountHealthHalfOpenPenalty
+	}
+	if snapshot.QuotaCooldown {
+		score -= openAIAccountHealthCooldownPenalty
+	}
+	score = math.Round(score)
+	if score < openAIAccountHealthScoreMin {
+		return openAIAccountHealthScoreMin
+	}
+	if score > openAIAccountHealthScoreMax {
+		return openAIAccountHealthScoreMax
+	}
+	return int(score)
+}
+
+// openAIAccountCooldownUntil 返回账号当前生效的冷却截止时间（取限流、过载、临时不可调度中最晚的一个）。
+func openAIAccountCooldownUntil(account *Account, now time.Time) *time.Time {
+	if account == nil {
+		return nil
+	}
+	var until *time.Time
+	for _, candidate := range []*time.Time{account.RateLimitResetAt, account.OverloadUntil, account.TempUnschedulableUntil} {
+		if candidate == nil || !now.Before(*candidate) {
+			continue
+		}
+		if until == nil || candidate.After(*until) {
+			value := *candidate
+			until = &value
+		}
+	}
+	return until
+}
+
+// list 返回所有已有运行时统计的账号快照（不含冷却信息与健康分），按账号 ID 升序。
+func (s *openAIAccountRuntimeStats) list() []OpenAIAccountRuntimeStatsSnapshot {
+	if s == nil {
+		return nil
+	}
+	out := make([]OpenAIAccountRuntimeStatsSnapshot, 0, s.size())
+	s.accounts.Range(func(key, _ any) bool {
+		accountID, ok := key.(int64)
+		if !ok {
+			return true
+		}
+		errorRate, ttft, hasTTFT := s.snapshot(accountID)
+		out = append(out, OpenAIAccountRuntimeStatsSnapshot{
+			AccountID:        accountID,
+			ErrorRate:        errorRate,
+			TTFTMs:           ttft,
+			HasTTFT:          hasTTFT,
+			PrevNotFoundRate: s.prevNotFoundRate(accountID),
+			CircuitState:     openAICircuitBreakerStateClosed,
+			ModelUsage:       s.modelUsageSnapshot(accountID),
+			RecentErrors:     s.recentErrorsSnapshot(accountID),
+		})
+		return true
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].AccountID < out[j].AccountID })
+	return out
+}
+
+// SnapshotRuntimeStats 返回各账号运行时统计；开启 scheduler_runtime_stats_replica_interval_ms 时读取只读副本。
+func (s *defaultOpenAIAccountScheduler) SnapshotRuntimeStats() []OpenAIAccountRuntimeStatsSnapshot {
+	if s == nil {
+		return nil
+	}
+	if interval := s.service.openAIRuntimeStatsReplicaInterval(); interval > 0 {
+		return s.statsReplica.load(time.Now(), interval, s.buildRuntimeStats)
+	}
+	return s.buildRuntimeStats()
+}
+
+func (s *defaultOpenAIAccountScheduler) buildRuntimeStats() []OpenAIAccountRuntimeStatsSnapshot {
+	out := s.stats.list()
+	if s.breakers == nil {
+		return out
+	}
+	for i := range out {
+		breaker := s.breakers.load(openAICircuitBreakerKey{accountID: out[i].AccountID})
+		if breaker == nil {
+			continue
+		}
+		breaker.mu.Lock()
+		out[i].CircuitState = breaker.state
+		breaker.mu.Unlock()
+	}
+	return out
+}
+
+// SnapshotOpenAIAccountRuntimeStats 返回各账号的运行时统计与健康分，供外部看板按红/黄/绿展示。
+// 健康分在每次读取时基于最新上报的 EWMA、熔断状态与账号冷却时间实时计算。
+// 账号冷却信息读取失败时按无冷却处理，不影响其余分量。
+func (s *OpenAIGatewayService) SnapshotOpenAIAccountRuntimeStats(ctx context.Context) []OpenAIAccountRuntimeStatsSnapshot {
+	scheduler := s.getOpenAIAccountScheduler()
+	if scheduler == nil {
+		return nil
+	}
+	out := scheduler.SnapshotRuntimeStats()
+	if len(out) == 0 {
+		return out
+	}
+	accountsByID := make(map[int64]*Account, len(out))
+	if s.accountRepo != nil {
+		ids := make([]int64, 0, len(out))
+		for _, item := range out {
+			ids = append(ids, item.AccountID)
+		}
+		if accounts, err := s.accountRepo.GetByIDs(ctx, ids); err == nil {
+			for _, account := range accounts {
+				if account != nil {
+					accountsByID[account.ID] = account
+				}
+			}
+		}
+	}
+	now := time.Now()
+	stickySessions := s.openaiStickyAccountSessions.snapshot(now)
+	for i := range out {
+		out[i].StickySessions = stickySessions[out[i].AccountID]
+		if until := openAIAccountCooldownUntil(accountsByID[out[i].AccountID], now); until != nil {
+			out[i].QuotaCooldown = true
+			out[i].CooldownUntil = until
+		}
+		out[i].AccountHealthScore = computeOpenAIAccountHealthScore(out[i])
+	}
+	return out
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeOpenAIAccountHealthScore(t *testing.T) {
+	cases := []struct {
+		name     string
+		snapshot OpenAIAccountRuntimeStatsSnapshot
+		want     int
+	}{
+		{name: "healthy", snapshot: OpenAIAccountRuntimeStatsSnapshot{CircuitState: openAICircuitBreakerStateClosed, HasTTFT: true, TTFTMs: 800}, want: 100},
+		{name: "error_rate", snapshot: OpenAIAccountRuntimeStatsSnapshot{ErrorRate: 0.5}, want: 70},
+		{name: "slow_ttft", snapshot: OpenAIAccountRuntimeStatsSnapshot{HasTTFT: true, TTFTMs: 5500}, want: 90},
+		{name: "ttft_capped", snapshot: OpenAIAccountRuntimeStatsSnapshot{HasTTFT: true, TTFTMs: 60000}, want: 80},
+		{name: "half_open", snapshot: OpenAIAccountRuntimeStatsSnapshot{CircuitState: openAICircuitBreakerStateHalfOpen}, want: 70},
+		{name: "cooldown", snapshot: OpenAIAccountRuntimeStatsSnapshot{QuotaCooldown: true}, want: 50},
+		{name: "open_circuit", snapshot: OpenAIAccountRuntimeStatsSnapshot{CircuitState: openAICircuitBreakerStateOpen}, want: 0},
+		{name: "floor_at_zero", snapshot: OpenAIAccountRuntimeStatsSnapshot{ErrorRate: 1, QuotaCooldown: true}, want: 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, computeOpenAIAccountHealthScore(tc.snapshot))
+		})
+	}
+}
+
+func TestOpenAIGatewayService_SnapshotOpenAIAccountRuntimeStats(t *testing.T) {
+	rateLimitedUntil := time.Now().Add(time.Hour)
+	expired := time.Now().Add(-time.Hour)
+	accounts := []Account{
+		{ID: 6101, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true},
+		{ID: 6102, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, RateLimitResetAt: &rateLimitedUntil, OverloadUntil: &expired},
+		{ID: 6103, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true},
+	}
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerEnabled = true
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerFailThreshold = 2
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerCooldownSeconds = 3600
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerHalfOpenMax = 1
+	svc := &OpenAIGatewayService{
+		accountRepo: stubOpenAIAccountRepo{accounts: accounts},
+		cache:       &stubGatewayCache{},
+		cfg:         cfg,
+	}
+
+	ttft := 700
+	svc.ReportOpenAIAccountScheduleResult(6101, true, &ttft)
+	svc.ReportOpenAIAccountScheduleResult(6102, true, &ttft)
+	svc.ReportOpenAIAccountScheduleResult(6103, false, nil)
+	svc.ReportOpenAIAccountScheduleResult(6103, false, nil)
+
+	stats := svc.SnapshotOpenAIAccountRuntimeStats(context.Background())
+	require.Len(t, stats, 3)
+
+	require.Equal(t, int64(6101), stats[0].AccountID)
+	require.True(t, stats[0].HasTTFT)
+	require.InDelta(t, 700, stats[0].TTFTMs, 0.001)
+	require.Equal(t, openAICircuitBreakerStateClosed, stats[0].CircuitState)
+	require.False(t, stats[0].QuotaCooldown)
+	require.Equal(t, 100, stats[0].AccountHealthScore)
+
+	require.True(t, stats[1].QuotaCooldown, "限流未结束应视为冷却中")
+	require.NotNil(t, stats[1].CooldownUntil)
+	require.True(t, stats[1].CooldownUntil.Equal(rateLimitedUntil), "已过期的过载时间不应参与冷却")
+	require.Equal(t, 50, stats[1].AccountHealthScore)
+
+	require.Equal(t, openAICircuitBreakerStateOpen, stats[2].CircuitState)
+	require.Greater(t, stats[2].ErrorRate, 0.0)
+	require.Equal(t, 0, stats[2].AccountHealthScore)
+
+	// 健康分随上报实时更新：熔断 reset 并恢复成功后不再为 0。
+	require.True(t, svc.ResetCircuitBreaker(6103))
+	svc.ReportOpenAIAccountScheduleResult(6103, true, &ttft)
+	stats = svc.SnapshotOpenAIAccountRuntimeStats(context.Background())
+	require.Equal(t, openAICircuitBreakerStateClosed, stats[2].CircuitState)
+	require.Greater(t, stats[2].AccountHealthScore, 0)
+	require.Less(t, stats[2].AccountHealthScore, 100)
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"sort"
+	"sync"
+)
+
+const (
+	// openAIAccountModelUsageTopK 单账号最多单独记录的模型数；超出时淘汰计数最小的模型，其计数并入 other。
+	openAIAccountModelUsageTopK = 8
+	// openAIAccountModelUsageWindow 计数总和达到该值时整体减半，使分布偏向近期流量（滚动窗口的近似）。
+	openAIAccountModelUsageWindow = 1024
+)
+
+// openAIAccountModelUsage 记录单账号已完成 turn 的模型分布，用于容量规划与 allowed-models 配置决策。
+// 计数为近似值：只保留 top-K 模型并周期性减半，更新成本为 O(K)。
+type openAIAccountModelUsage struct {
+	mu     sync.Mutex
+	counts map[string]float64
+	other  float64
+	total  float64
+}
+
+// OpenAIAccountModelUsage 单账号单模型的使用占比；Share 为该模型计数占账号总计数（含 other）的比例。
+type OpenAIAccountModelUsage struct {
+	Model string  `json:"model"`
+	Count float64 `json:"count"`
+	Share float64 `json:"share"`
+}
+
+// OpenAIAccountModelUsageSnapshot 单账号模型分布快照，Models 按计数降序。
+type OpenAIAccountModelUsageSnapshot struct {
+	Models []OpenAIAccountModelUsage `json:"models"`
+	// OtherCount 被挤出 top-K 的模型累计计数。
+	OtherCount float64 `json:"other_count"`
+	Total      float64 `json:"total"`
+}
+
+func (u *openAIAccountModelUsage) observe(model string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.counts == nil {
+		u.counts = make(map[string]float64, openAIAccountModelUsageTopK)
+	}
+	if _, ok := u.counts[model]; !ok && len(u.counts) >= openAIAccountModelUsageTopK {
+		evicted, minCount := "", 0.0
+		for name, count := range u.counts {
+			if evicted == "" || count < minCount || (count == minCount && name < evicted) {
+				evicted, minCount = name, count
+			}
+		}
+		delete(u.counts, evicted)
+		u.other += minCount
+	}
+	u.counts[model]++
+	u.total++
+	if u.total >= openAIAccountModelUsageWindow {
+		for name := range u.counts {
+			u.counts[name] /= 2
+		}
+		u.other /= 2
+		u.total /= 2
+	}
+}
+
+func (u *openAIAccountModelUsage) snapshot() (OpenAIAccountModelUsageSnapshot, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.total <= 0 {
+		return OpenAIAccountModelUsageSnapshot{}, false
+	}
+	out := OpenAIAccountModelUsageSnapshot{
+		Models:     make([]OpenAIAccountModelUsage, 0, len(u.counts)),
+		OtherCount: u.other,
+		Total:      u.total,
+	}
+	for name, count := range u.counts {
+		out.Models = append(out.Models, OpenAIAccountModelUsage{Model: name, Count: count, Share: count / u.total})
+	}
+	sort.Slice(out.Models, func(i, j int) bool {
+		if out.Models[i].Count != out.Models[j].Count {
+			return out.Models[i].Count > out.Models[j].Count
+		}
+		return out.Models[i].Model < out.Models[j].Model
+	})
+	return out, true
+}
+
+// reportModelUsage 记录账号在已完成 turn 上实际服务的模型。
+func (s *openAIAccountRuntimeStats) reportModelUsage(accountID int64, model string) {
+	if s == nil || accountID <= 0 {
+		return
+	}
+	model = normalizeOpenAIAccountStatsModel(model)
+	if model == "" {
+		return
+	}
+	s.loadOrCreate(accountID).modelUsage.observe(model)
+}
+
+// modelUsageSnapshot 返回账号模型分布；账号尚无已完成 turn 时返回 nil。
+func (s *openAIAccountRuntimeStats) modelUsageSnapshot(accountID int64) *OpenAIAccountModelUsageSnapshot {
+	if s == nil || accountID <= 0 {
+		return nil
+	}
+	value, ok := s.accounts.Load(accountID)
+	if !ok {
+		return nil
+	}
+	stat, _ := value.(*openAIAccountRuntimeStat)
+	if stat == nil {
+		return nil
+	}
+	snapshot, ok := stat.modelUsage.snapshot()
+	if !ok {
+		return nil
+	}
+	return &snapshot
+}
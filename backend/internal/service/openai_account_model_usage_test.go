@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIAccountModelUsage_TopKAndShares(t *testing.T) {
+	var usage openAIAccountModelUsage
+	_, ok := usage.snapshot()
+	require.False(t, ok)
+
+	for i := 0; i < 6; i++ {
+		usage.observe("gpt-5.1")
+	}
+	for i := 0; i < 3; i++ {
+		usage.observe("gpt-5.1-codex")
+	}
+	for i := 0; i < openAIAccountModelUsageTopK; i++ {
+		usage.observe(fmt.Sprintf("rare-%d", i))
+	}
+
+	snapshot, ok := usage.snapshot()
+	require.True(t, ok)
+	require.Len(t, snapshot.Models, openAIAccountModelUsageTopK, "超出 top-K 的模型应被淘汰")
+	require.Equal(t, "gpt-5.1", snapshot.Models[0].Model)
+	require.Equal(t, float64(6), snapshot.Models[0].Count)
+	require.Equal(t, "gpt-5.1-codex", snapshot.Models[1].Model)
+	require.Equal(t, float64(2), snapshot.OtherCount, "被淘汰模型的计数应并入 other")
+	require.Equal(t, float64(6+3+openAIAccountModelUsageTopK), snapshot.Total)
+	require.InDelta(t, 6.0/snapshot.Total, snapshot.Models[0].Share, 1e-9)
+}
+
+func TestOpenAIAccountModelUsage_DecaysTowardRecentTraffic(t *testing.T) {
+	var usage openAIAccountModelUsage
+	for i := 0; i < openAIAccountModelUsageWindow-1; i++ {
+		usage.observe("gpt-4o")
+	}
+	for i := 0; i < openAIAccountModelUsageWindow; i++ {
+		usage.observe("gpt-5.1")
+	}
+
+	snapshot, ok := usage.snapshot()
+	require.True(t, ok)
+	require.Less(t, snapshot.Total, float64(openAIAccountModelUsageWindow))
+	require.Equal(t, "gpt-5.1", snapshot.Models[0].Model, "近期流量应占主导")
+	require.Greater(t, snapshot.Models[0].Share, 0.5)
+}
+
+func TestOpenAIGatewayService_SnapshotOpenAIAccountRuntimeStats_ModelUsage(t *testing.T) {
+	svc := &OpenAIGatewayService{cfg: &config.Config{}, cache: &stubGatewayCache{}}
+	ttft := 500
+	svc.ReportOpenAIAccountScheduleResultForModel(7101, "GPT-5.1", true, &ttft)
+	svc.ReportOpenAIAccountScheduleResultForModel(7101, "gpt-5.1", true, nil)
+	svc.ReportOpenAIAccountScheduleResultForModel(7101, "gpt-5.1-codex", true, &ttft)
+	svc.ReportOpenAIAccountScheduleResultForModel(7101, "gpt-4o", false, nil)
+	svc.ReportOpenAIAccountScheduleResult(7102, true, &ttft)
+
+	stats := svc.SnapshotOpenAIAccountRuntimeStats(context.Background())
+	require.Len(t, stats, 2)
+	require.Equal(t, int64(7101), stats[0].AccountID)
+	require.NotNil(t, stats[0].ModelUsage)
+	require.Equal(t, []OpenAIAccountModelUsage{
+		{Model: "gpt-5.1", Count: 2, Share: 2.0 / 3},
+		{Model: "gpt-5.1-codex", Count: 1, Share: 1.0 / 3},
+	}, stats[0].ModelUsage.Models, "失败的 turn 不计入模型分布")
+	require.Nil(t, stats[1].ModelUsage)
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/util/logredact"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// openAIAccountRecentErrorsMax 单账号保留的最近错误条数，超出时覆盖最旧的一条。
+	openAIAccountRecentErrorsMax = 5
+	// openAIAccountRecentErrorMessageMaxLen 单条错误原文保留的最大字节数。
+	openAIAccountRecentErrorMessageMaxLen = 256
+)
+
+// openAIAccountSecretPattern 匹配错误原文中可能回显的 API Key / Bearer token。
+var openAIAccountSecretPattern = regexp.MustCompile(`(?i)\b(?:sk-[A-Za-z0-9_-]{8,}|bearer\s+[A-Za-z0-9._~+/=-]{8,})`)
+
+// OpenAIAccountErrorRecord 账号最近一次失败的结构化记录，供运维排查账号为何被降权或熔断。
+type OpenAIAccountErrorRecord struct {
+	// Reason 归类后的错误原因（如 insufficient_quota、rate_limit_exceeded、http_502、timeout）。
+	Reason string `json:"reason"`
+	// Message 脱敏并截断后的错误原文。
+	Message string    `json:"message,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// openAIAccountRecentErrors 固定容量的环形缓冲，记录单账号最近的失败原因；写入为 O(1)。
+type openAIAccountRecentErrors struct {
+	mu      sync.Mutex
+	records [openAIAccountRecentErrorsMax]OpenAIAccountErrorRecord
+	next    int
+	count   int
+}
+
+func (r *openAIAccountRecentErrors) observe(record OpenAIAccountErrorRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records[r.next] = record
+	r.next = (r.next + 1) % openAIAccountRecentErrorsMax
+	if r.count < openAIAccountRecentErrorsMax {
+		r.count++
+	}
+}
+
+// snapshot 返回最近的错误记录，按时间从新到旧。
+func (r *openAIAccountRecentErrors) snapshot() []OpenAIAccountErrorRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.count == 0 {
+		return nil
+	}
+	out := make([]OpenAIAccountErrorRecord, 0, r.count)
+	for i := 1; i <= r.count; i++ {
+		idx := (r.next - i + openAIAccountRecentErrorsMax) % openAIAccountRecentErrorsMax
+		out = append(out, r.records[idx])
+	}
+	return out
+}
+
+// reportError 记录账号的一次失败原因；message 在写入前脱敏并截断。
+func (s *openAIAccountRuntimeStats) reportError(accountID int64, reason, message string) {
+	if s == nil || accountID <= 0 {
+		return
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		reason = "unknown"
+	}
+	s.loadOrCreate(accountID).recentErrors.observe(OpenAIAccountErrorRecord{
+		Reason:  reason,
+		Message: redactOpenAIAccountErrorMessage(message),
+		At:      time.Now(),
+	})
+}
+
+// recentErrorsSnapshot 返回账号最近的错误记录；账号尚无失败记录时返回 nil。
+func (s *openAIAccountRuntimeStats) recentErrorsSnapshot(accountID int64) []OpenAIAccountErrorRecord {
+	if s == nil || accountID <= 0 {
+		return nil
+	}
+	value, ok := s.accounts.Load(accountID)
+	if !ok {
+		return nil
+	}
+	stat, _ := value.(*openAIAccountRuntimeStat)
+	if stat == nil {
+		return nil
+	}
+	return stat.recentErrors.snapshot()
+}
+
+func redactOpenAIAccountErrorMessage(message string) string {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return ""
+	}
+	message = logredact.RedactText(message)
+	message = sanitizeUpstreamErrorMessage(message)
+	message = openAIAccountSecretPattern.ReplaceAllString(message, "***")
+	return truncateString(message, openAIAccountRecentErrorMessageMaxLen)
+}
+
+// classifyOpenAIAccountError 将转发错误归类为稳定的原因标识，并给出用于排查的错误原文。
+func classifyOpenAIAccountError(err error) (reason, message string) {
+	if err == nil {
+		return "", ""
+	}
+	message = err.Error()
+
+	var failoverErr *UpstreamFailoverError
+	if errors.As(err, &failoverErr) {
+		reason = strings.TrimSpace(gjson.GetBytes(failoverErr.ResponseBody, "error.code").String())
+		if reason == "" {
+			reason = strings.TrimSpace(gjson.GetBytes(failoverErr.ResponseBody, "error.type").String())
+		}
+		if reason == "" {
+			reason = fmt.Sprintf("http_%d", failoverErr.StatusCode)
+		}
+		if upstreamMsg := strings.TrimSpace(extractUpstreamErrorMessage(failoverErr.ResponseBody)); upstreamMsg != "" {
+			message = fmt.Sprintf("%s: %s", message, upstreamMsg)
+		}
+		return reason, message
+	}
+	var closeErr *OpenAIWSClientCloseError
+	if errors.As(err, &closeErr) {
+		return closeErr.ErrorCode(), message
+	}
+	var fallbackErr *openAIWSFallbackError
+	if errors.As(err, &fallbackErr) && strings.TrimSpace(fallbackErr.Reason) != "" {
+		return fallbackErr.Reason, message
+	}
+	var turnErr *openAIWSIngressTurnError
+	if errors.As(err, &turnErr) && strings.TrimSpace(turnErr.stage) != "" {
+		return turnErr.stage, message
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout", message
+	case errors.Is(err, context.Canceled):
+		return "canceled", message
+	}
+	return "unknown", message
+}
+
+// RecordOpenAIAccountError 记录账号一次转发失败的原因，在账号运行时统计中保留最近若干条供排查。
+func (s *OpenAIGatewayService) RecordOpenAIAccountError(accountID int64, err error) {
+	if err == nil {
+		return
+	}
+	scheduler := s.getOpenAIAccountScheduler()
+	if scheduler == nil {
+		return
+	}
+	reason, message := classifyOpenAIAccountError(err)
+	scheduler.ReportError(accountID, reason, message)
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIAccountRecentErrors_BoundedNewestFirst(t *testing.T) {
+	var recent openAIAccountRecentErrors
+	require.Nil(t, recent.snapshot())
+
+	for i := 0; i < openAIAccountRecentErrorsMax+2; i++ {
+		recent.observe(OpenAIAccountErrorRecord{Reason: fmt.Sprintf("reason_%d", i)})
+	}
+	snapshot := recent.snapshot()
+	require.Len(t, snapshot, openAIAccountRecentErrorsMax)
+	require.Equal(t, fmt.Sprintf("reason_%d", openAIAccountRecentErrorsMax+1), snapshot[0].Reason)
+	require.Equal(t, "reason_2", snapshot[len(snapshot)-1].Reason, "最旧的记录应被覆盖")
+}
+
+func TestClassifyOpenAIAccountError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		reason string
+	}{
+		{
+			name:   "upstream_error_code",
+			err:    &UpstreamFailoverError{StatusCode: http.StatusTooManyRequests, ResponseBody: []byte(`{"error":{"code":"insufficient_quota","message":"quota exceeded"}}`)},
+			reason: "insufficient_quota",
+		},
+		{
+			name:   "upstream_error_type",
+			err:    &UpstreamFailoverError{StatusCode: http.StatusTooManyRequests, ResponseBody: []byte(`{"error":{"type":"rate_limit_error"}}`)},
+			reason: "rate_limit_error",
+		},
+		{
+			name:   "upstream_status_only",
+			err:    &UpstreamFailoverError{StatusCode: http.StatusBadGateway},
+			reason: "http_502",
+		},
+		{
+			name:   "ws_fallback",
+			err:    &openAIWSFallbackError{Reason: "upgrade_required"},
+			reason: "upgrade_required",
+		},
+		{
+			name:   "timeout",
+			err:    fmt.Errorf("read upstream: %w", context.DeadlineExceeded),
+			reason: "timeout",
+		},
+		{
+			name:   "unknown",
+			err:    fmt.Errorf("boom"),
+			reason: "unknown",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, _ := classifyOpenAIAccountError(tt.err)
+			require.Equal(t, tt.reason, reason)
+		})
+	}
+}
+
+func TestOpenAIGatewayService_SnapshotOpenAIAccountRuntimeStats_RecentErrors(t *testing.T) {
+	svc := &OpenAIGatewayService{cfg: &config.Config{}, cache: &stubGatewayCache{}}
+	quotaErr := &UpstreamFailoverError{
+		StatusCode:   http.StatusTooManyRequests,
+		ResponseBody: []byte(`{"error":{"code":"insufficient_quota","message":"You exceeded your quota for key sk-proj-abcdef1234567890"}}`),
+	}
+	for i := 0; i < 3; i++ {
+		svc.RecordOpenAIAccountError(7201, quotaErr)
+	}
+	svc.RecordOpenAIAccountError(7201, &UpstreamFailoverError{StatusCode: http.StatusBadGateway})
+	svc.RecordOpenAIAccountError(7201, nil)
+	svc.ReportOpenAIAccountScheduleResult(7202, true, nil)
+
+	stats := svc.SnapshotOpenAIAccountRuntimeStats(context.Background())
+	require.Len(t, stats, 2)
+	recent := stats[0].RecentErrors
+	require.Len(t, recent, 4, "nil 错误不应记录")
+	require.Equal(t, "http_502", recent[0].Reason, "最近的错误排在最前")
+	for _, record := range recent[1:] {
+		require.Equal(t, "insufficient_quota", record.Reason)
+		require.Contains(t, record.Message, "You exceeded your quota")
+		require.NotContains(t, record.Message, "sk-proj-abcdef1234567890", "错误原文中的 API Key 应被脱敏")
+		require.False(t, record.At.IsZero())
+	}
+	require.Nil(t, stats[1].RecentErrors)
+
+	svc.RecordOpenAIAccountError(7201, fmt.Errorf("%s", strings.Repeat("x", 4*openAIAccountRecentErrorMessageMaxLen)))
+	stats = svc.SnapshotOpenAIAccountRuntimeStats(context.Background())
+	require.Len(t, stats[0].RecentErrors, openAIAccountRecentErrorsMax)
+	require.Len(t, stats[0].RecentErrors[0].Message, openAIAccountRecentErrorMessageMaxLen)
+}
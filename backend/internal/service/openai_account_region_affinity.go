@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/ip"
+	"github.com/gin-gonic/gin"
+)
+
+// ClientRegionResolver 根据客户端 IP 解析地域（如 IP 地理库），返回值需与 accounts.extra.openai_regions 使用同一套命名。
+// 请求头未携带地域时调用；无法解析时返回空串。实现需并发安全且足够快，调用发生在每次请求的调度前。
+type ClientRegionResolver interface {
+	ResolveClientRegion(ctx context.Context, clientIP string) string
+}
+
+// ClientRegionResolverFunc 函数适配器。
+type ClientRegionResolverFunc func(ctx context.Context, clientIP string) string
+
+func (f ClientRegionResolverFunc) ResolveClientRegion(ctx context.Context, clientIP string) string {
+	return f(ctx, clientIP)
+}
+
+type openAIClientRegionResolverHolder struct {
+	resolver ClientRegionResolver
+}
+
+// SetClientRegionResolver 注册客户端地域解析器；传入 nil 表示仅使用请求头。
+func (s *OpenAIGatewayService) SetClientRegionResolver(resolver ClientRegionResolver) {
+	if s == nil {
+		return
+	}
+	if resolver == nil {
+		s.openaiClientRegionResolver.Store(nil)
+		return
+	}
+	s.openaiClientRegionResolver.Store(&openAIClientRegionResolverHolder{resolver: resolver})
+}
+
+// ResolveOpenAIClientRegion 返回请求的客户端地域（已规范化）；未开启地域亲和或无法确定时返回空串。
+// 优先读取 scheduler_region_header 请求头，缺失时交由注册的 ClientRegionResolver 按客户端 IP 解析。
+func (s *OpenAIGatewayService) ResolveOpenAIClientRegion(c *gin.Context) string {
+	if s == nil || s.cfg == nil || c == nil || c.Request == nil || !s.openAIWSConfig().SchedulerRegionAffinityEnabled {
+		return ""
+	}
+	if header := strings.TrimSpace(s.openAIWSConfig().SchedulerRegionHeader); header != "" {
+		if region := normalizeOpenAIRegion(c.GetHeader(header)); region != "" {
+			return region
+		}
+	}
+	if holder := s.openaiClientRegionResolver.Load(); holder != nil && holder.resolver != nil {
+		return normalizeOpenAIRegion(holder.resolver.ResolveClientRegion(c.Request.Context(), ip.GetClientIP(c)))
+	}
+	return ""
+}
+
+// openAIWSSchedulerRegionAffinityEnabled 返回调度打分是否考虑地域亲和。
+func (s *OpenAIGatewayService) openAIWSSchedulerRegionAffinityEnabled() bool {
+	return s != nil && s.cfg != nil && s.openAIWSConfig().SchedulerRegionAffinityEnabled
+}
+
+func normalizeOpenAIRegion(region string) string {
+	return strings.ToLower(strings.TrimSpace(region))
+}
+
+// openAIAccountMatchesRegion 判断账号是否标记了给定地域；region 需已规范化。
+func openAIAccountMatchesRegion(account *Account, region string) bool {
+	if region == "" {
+		return false
+	}
+	return slices.Contains(account.GetOpenAIRegions(), region)
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccount_GetOpenAIRegions(t *testing.T) {
+	require.Nil(t, (&Account{}).GetOpenAIRegions())
+	require.Equal(t, []string{"us-west", "eu"}, (&Account{Platform: PlatformOpenAI, Extra: map[string]any{"openai_regions": " US-West, eu,,us-west "}}).GetOpenAIRegions())
+	require.Equal(t, []string{"ap"}, (&Account{Platform: PlatformOpenAI, Extra: map[string]any{"openai_regions": []any{"AP", 1, ""}}}).GetOpenAIRegions())
+	require.Equal(t, []string{"eu"}, (&Account{Platform: PlatformOpenAI, Extra: map[string]any{"openai_regions": []string{"eu"}}}).GetOpenAIRegions())
+}
+
+func TestOpenAIGatewayService_ResolveOpenAIClientRegion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.SchedulerRegionHeader = "X-Client-Region"
+	svc := &OpenAIGatewayService{cfg: cfg}
+	newCtx := func(region string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/v1/responses", nil)
+		if region != "" {
+			c.Request.Header.Set("X-Client-Region", region)
+		}
+		return c
+	}
+
+	require.Empty(t, svc.ResolveOpenAIClientRegion(newCtx("eu")), "未开启地域亲和时不应解析地域")
+
+	cfg.Gateway.OpenAIWS.SchedulerRegionAffinityEnabled = true
+	require.Equal(t, "eu", svc.ResolveOpenAIClientRegion(newCtx(" EU ")))
+	require.Empty(t, svc.ResolveOpenAIClientRegion(newCtx("")))
+
+	var resolvedIP string
+	svc.SetClientRegionResolver(ClientRegionResolverFunc(func(_ context.Context, clientIP string) string {
+		resolvedIP = clientIP
+		return "US-West"
+	}))
+	require.Equal(t, "eu", svc.ResolveOpenAIClientRegion(newCtx("eu")), "请求头优先于按 IP 解析")
+	require.Equal(t, "us-west", svc.ResolveOpenAIClientRegion(newCtx("")))
+	require.NotEmpty(t, resolvedIP)
+
+	svc.SetClientRegionResolver(nil)
+	require.Empty(t, svc.ResolveOpenAIClientRegion(newCtx("")))
+}
+
+func TestOpenAIGatewayService_SelectAccountWithScheduler_RegionAffinity(t *testing.T) {
+	groupID := int64(27)
+	accounts := []Account{
+		{ID: 6301, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 1, Extra: map[string]any{"openai_regions": "us-west"}},
+		{ID: 6302, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 1, Extra: map[string]any{"openai_regions": "eu,ap"}},
+		{ID: 6303, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 1},
+	}
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.LBTopK = 1
+	cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Priority = 1
+	cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Region = 1
+	cfg.Gateway.OpenAIWS.SchedulerRegionAffinityEnabled = true
+	svc := &OpenAIGatewayService{
+		accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+		cache:              &stubGatewayCache{},
+		cfg:                cfg,
+		concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+	}
+	selectFor := func(region string, i int) int64 {
+		ctx := WithClientRegion(context.Background(), region)
+		selection, _, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", fmt.Sprintf("region_%s_%d", region, i), "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.NotNil(t, selection)
+		require.NotNil(t, selection.Account)
+		if selection.ReleaseFunc != nil {
+			selection.ReleaseFunc()
+		}
+		return selection.Account.ID
+	}
+
+	for i := 0; i < 5; i++ {
+		require.Equal(t, int64(6302), selectFor("eu", i), "同地域账号应优先被选中")
+		require.Equal(t, int64(6301), selectFor("us-west", i))
+	}
+
+	// 没有同地域账号时退化为常规打分，仍能选出账号。
+	require.NotZero(t, selectFor("sa-east", 0))
+
+	// 关闭地域亲和后地域提示不再影响得分。
+	cfg.Gateway.OpenAIWS.SchedulerRegionAffinityEnabled = false
+	seen := make(map[int64]struct{})
+	for i := 0; i < 30; i++ {
+		seen[selectFor("eu", i)] = struct{}{}
+	}
+	require.Greater(t, len(seen), 1, "关闭后不应固定选择同地域账号")
+}
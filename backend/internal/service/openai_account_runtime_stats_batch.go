@@ -0,0 +1,168 @@
+package service
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// openAIAccountScheduleResultBatchMaxPending 单个批次累计的结果数达到该值时立即刷新。
+	openAIAccountScheduleResultBatchMaxPending = 64
+	// openAIAccountScheduleResultBatchMaxAge 批次中最早的结果等待超过该时长时，下一次 Add 触发刷新。
+	openAIAccountScheduleResultBatchMaxAge = 100 * time.Millisecond
+)
+
+// OpenAIAccountScheduleResult 一次调度结果，字段含义与 ReportResult 参数一致；FirstTokenMs<=0 表示无 TTFT 样本。
+type OpenAIAccountScheduleResult struct {
+	AccountID    int64
+	Success      bool
+	FirstTokenMs int
+}
+
+// OpenAIAccountScheduleResultBatch 在单个 goroutine 内累积调度结果，按条数或时长批量刷新到运行时统计，
+// 同一账号的多条结果合并为一次 EWMA 更新，降低高吞吐下统计的争用。非并发安全，调用方退出前需 Flush。
+type OpenAIAccountScheduleResultBatch struct {
+	service *OpenAIGatewayService
+	pending []OpenAIAccountScheduleResult
+	firstAt time.Time
+	maxSize int
+	maxAge  time.Duration
+	nowFunc func() time.Time
+}
+
+// NewOpenAIAccountScheduleResultBatch 创建一个调度结果批次。
+func (s *OpenAIGatewayService) NewOpenAIAccountScheduleResultBatch() *OpenAIAccountScheduleResultBatch {
+	return &OpenAIAccountScheduleResultBatch{
+		service: s,
+		maxSize: openAIAccountScheduleResultBatchMaxPending,
+		maxAge:  openAIAccountScheduleResultBatchMaxAge,
+		nowFunc: time.Now,
+	}
+}
+
+// Add 追加一条调度结果；达到条数上限或最早结果超过最大等待时长时自动刷新。
+func (b *OpenAIAccountScheduleResultBatch) Add(accountID int64, success bool, firstTokenMs *int) {
+	if b == nil || accountID <= 0 {
+		return
+	}
+	result := OpenAIAccountScheduleResult{AccountID: accountID, Success: success}
+	if firstTokenMs != nil {
+		result.FirstTokenMs = *firstTokenMs
+	}
+	now := b.nowFunc()
+	if len(b.pending) == 0 {
+		b.firstAt = now
+	}
+	b.pending = append(b.pending, result)
+	if len(b.pending) >= b.maxSize || now.Sub(b.firstAt) >= b.maxAge {
+		b.Flush()
+	}
+}
+
+// Flush 将累积的结果一次性提交给调度器；批次可继续复用。
+func (b *OpenAIAccountScheduleResultBatch) Flush() {
+	if b == nil || len(b.pending) == 0 {
+		return
+	}
+	if scheduler := b.service.getOpenAIAccountScheduler(); scheduler != nil {
+		scheduler.ReportResults(b.pending)
+	}
+	b.pending = b.pending[:0]
+}
+
+// Pending 返回尚未刷新的结果数。
+func (b *OpenAIAccountScheduleResultBatch) Pending() int {
+	if b == nil {
+		return 0
+	}
+	return len(b.pending)
+}
+
+// ReportOpenAIAccountScheduleResults 批量上报调度结果，等价于按顺序逐条调用 ReportOpenAIAccountScheduleResult。
+func (s *OpenAIGatewayService) ReportOpenAIAccountScheduleResults(results []OpenAIAccountScheduleResult) {
+	if len(results) == 0 {
+		return
+	}
+	scheduler := s.getOpenAIAccountScheduler()
+	if scheduler == nil {
+		return
+	}
+	scheduler.ReportResults(results)
+}
+
+// reportBatch 按账号合并结果：每个账号的 EWMA 只做一次 CAS 提交，同一账号内保持上报顺序。
+// 批次通常只涉及少量账号，按账号线性扫描即可，避免分组带来的分配。
+func (s *openAIAccountRuntimeStats) reportBatch(results []OpenAIAccountScheduleResult) {
+	if s == nil {
+		return
+	}
+	errorRateAlpha, ttftAlpha := s.ewmaAlphas()
+	for i, result := range results {
+		if result.AccountID <= 0 || openAIScheduleResultsContainAccount(results[:i], result.AccountID) {
+			continue
+		}
+		stat := s.loadOrCreate(result.AccountID)
+		foldEWMAAtomic(&stat.errorRateEWMABits, results[i:], result.AccountID, errorRateAlpha, foldOpenAIErrorRateEWMA)
+		foldEWMAAtomic(&stat.ttftEWMABits, results[i:], result.AccountID, ttftAlpha, foldOpenAITTFTEWMA)
+	}
+}
+
+func openAIScheduleResultsContainAccount(results []OpenAIAccountScheduleResult, accountID int64) bool {
+	for _, result := range results {
+		if result.AccountID == accountID {
+			return true
+		}
+	}
+	return false
+}
+
+// openAIAccountRuntimeStatsAlpha 为错误率与 TTFT EWMA 的默认平滑系数。
+const openAIAccountRuntimeStatsAlpha = 0.2
+
+func foldOpenAIErrorRateEWMA(value float64, results []OpenAIAccountScheduleResult, accountID int64, alpha float64) float64 {
+	for _, result := range results {
+		if result.AccountID != accountID {
+			continue
+		}
+		sample := 1.0
+		if result.Success {
+			sample = 0.0
+		}
+		value = alpha*sample + (1-alpha)*value
+	}
+	return value
+}
+
+// foldOpenAITTFTEWMA 与 report 一致：TTFT 尚无样本（NaN）时以首个样本作为初值。
+func foldOpenAITTFTEWMA(value float64, results []OpenAIAccountScheduleResult, accountID int64, alpha float64) float64 {
+	for _, result := range results {
+		if result.AccountID != accountID || result.FirstTokenMs <= 0 {
+			continue
+		}
+		ttft := float64(result.FirstTokenMs)
+		if math.IsNaN(value) {
+			value = ttft
+			continue
+		}
+		value = alpha*ttft + (1-alpha)*value
+	}
+	return value
+}
+
+// foldEWMAAtomic 以一次 CAS 提交 fold 对当前值的整体更新；CAS 失败时基于新值重算。
+func foldEWMAAtomic(
+	target *atomic.Uint64,
+	results []OpenAIAccountScheduleResult,
+	accountID int64,
+	alpha float64,
+	fold func(value float64, results []OpenAIAccountScheduleResult, accountID int64, alpha float64) float64,
+) {
+	for {
+		oldBits := target.Load()
+		newBits := math.Float64bits(fold(math.Float64frombits(oldBits), results, accountID, alpha))
+		if newBits == oldBits || target.CompareAndSwap(oldBits, newBits) {
+			return
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIAccountRuntimeStats_ReportBatchMatchesSequential(t *testing.T) {
+	results := []OpenAIAccountScheduleResult{
+		{AccountID: 1, Success: true, FirstTokenMs: 300},
+		{AccountID: 2, Success: false},
+		{AccountID: 1, Success: false},
+		{AccountID: 1, Success: true, FirstTokenMs: 900},
+		{AccountID: 2, Success: true, FirstTokenMs: 120},
+		{AccountID: 0, Success: false},
+		{AccountID: 1, Success: true, FirstTokenMs: 150},
+	}
+
+	sequential := newOpenAIAccountRuntimeStats()
+	for _, result := range results {
+		ttft := result.FirstTokenMs
+		sequential.report(result.AccountID, result.Success, &ttft)
+	}
+	batched := newOpenAIAccountRuntimeStats()
+	batched.reportBatch(results[:3])
+	batched.reportBatch(results[3:])
+
+	require.Equal(t, 2, batched.size())
+	for _, accountID := range []int64{1, 2} {
+		wantErr, wantTTFT, wantHas := sequential.snapshot(accountID)
+		gotErr, gotTTFT, gotHas := batched.snapshot(accountID)
+		require.InDelta(t, wantErr, gotErr, 1e-12, "account %d", accountID)
+		require.InDelta(t, wantTTFT, gotTTFT, 1e-9, "account %d 的 TTFT 应与逐条上报一致（顺序敏感）", accountID)
+		require.Equal(t, wantHas, gotHas)
+	}
+}
+
+func TestOpenAIAccountScheduleResultBatch_FlushBySizeAndAge(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerEnabled = true
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerFailThreshold = 2
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerCooldownSeconds = 60
+	svc := &OpenAIGatewayService{cfg: cfg, cache: &stubGatewayCache{}}
+
+	now := time.Unix(1_700_000_000, 0)
+	batch := svc.NewOpenAIAccountScheduleResultBatch()
+	batch.maxSize = 3
+	batch.nowFunc = func() time.Time { return now }
+
+	batch.Add(8101, false, nil)
+	batch.Add(8101, false, nil)
+	require.Equal(t, 2, batch.Pending())
+	require.Empty(t, svc.SnapshotOpenAIAccountRuntimeStats(t.Context()), "刷新前不应写入统计")
+
+	batch.Add(8102, true, nil)
+	require.Zero(t, batch.Pending(), "达到条数上限应自动刷新")
+	stats := svc.SnapshotOpenAIAccountRuntimeStats(t.Context())
+	require.Len(t, stats, 2)
+	require.Len(t, svc.ListCircuitBreakers(), 1, "批量上报同样驱动熔断器")
+
+	batch.Add(8102, true, nil)
+	now = now.Add(openAIAccountScheduleResultBatchMaxAge)
+	batch.Add(8102, true, nil)
+	require.Zero(t, batch.Pending(), "最早结果超时后应自动刷新")
+
+	batch.Add(8103, true, nil)
+	batch.Flush()
+	batch.Flush()
+	require.Zero(t, batch.Pending())
+	require.Len(t, svc.SnapshotOpenAIAccountRuntimeStats(t.Context()), 3)
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// openAIAccountRuntimeStatsReplica 运行时统计的只读副本（copy-on-snapshot）。
+// 构建快照需要逐账号获取熔断器、模型分布、最近错误等锁，与上报热路径争用；
+// 开启后每个刷新间隔最多由一个读取方重建一次副本，其余读取方直接复制已发布的副本，
+// 高频抓取指标时上报路径的锁争用不再随抓取频率增长。副本整体原子发布，读取方看到的是同一时刻构建的完整数据。
+type openAIAccountRuntimeStatsReplica struct {
+	current      atomic.Pointer[openAIAccountRuntimeStatsReplicaSnapshot]
+	building     atomic.Bool
+	rebuildTotal atomic.Int64
+	hitTotal     atomic.Int64
+}
+
+type openAIAccountRuntimeStatsReplicaSnapshot struct {
+	builtAt time.Time
+	// stats 发布后只读；读取方拿到的是切片副本，嵌套的 ModelUsage/RecentErrors 与副本共享，不得修改。
+	stats []OpenAIAccountRuntimeStatsSnapshot
+}
+
+// load 返回副本中的统计；副本过期时由抢到重建权的读取方调用 build 重建，
+// 其余并发读取方在重建期间继续使用旧副本，尚无副本时直接实时构建。
+func (r *openAIAccountRuntimeStatsReplica) load(now time.Time, interval time.Duration, build func() []OpenAIAccountRuntimeStatsSnapshot) []OpenAIAccountRuntimeStatsSnapshot {
+	current := r.current.Load()
+	if current != nil && now.Sub(current.builtAt) < interval {
+		r.hitTotal.Add(1)
+		return cloneOpenAIAccountRuntimeStats(current.stats)
+	}
+	if !r.building.CompareAndSwap(false, true) {
+		if current != nil {
+			r.hitTotal.Add(1)
+			return cloneOpenAIAccountRuntimeStats(current.stats)
+		}
+		return build()
+	}
+	defer r.building.Store(false)
+	stats := build()
+	r.current.Store(&openAIAccountRuntimeStatsReplicaSnapshot{builtAt: now, stats: stats})
+	r.rebuildTotal.Add(1)
+	return cloneOpenAIAccountRuntimeStats(stats)
+}
+
+func cloneOpenAIAccountRuntimeStats(stats []OpenAIAccountRuntimeStatsSnapshot) []OpenAIAccountRuntimeStatsSnapshot {
+	if stats == nil {
+		return nil
+	}
+	out := make([]OpenAIAccountRuntimeStatsSnapshot, len(stats))
+	copy(out, stats)
+	return out
+}
+
+func (s *OpenAIGatewayService) openAIRuntimeStatsReplicaInterval() time.Duration {
+	if s == nil || s.cfg == nil {
+		return 0
+	}
+	ms := s.openAIWSConfig().SchedulerRuntimeStatsReplicaIntervalMS
+	if ms <= 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
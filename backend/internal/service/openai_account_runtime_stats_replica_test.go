@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIGatewayService_SnapshotOpenAIAccountRuntimeStats_ReplicaReused(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.SchedulerRuntimeStatsReplicaIntervalMS = 3600 * 1000
+	svc := &OpenAIGatewayService{cfg: cfg, cache: &stubGatewayCache{}}
+	ttft := 300
+	svc.ReportOpenAIAccountScheduleResultForModel(7301, "gpt-5.1", true, &ttft)
+
+	first := svc.SnapshotOpenAIAccountRuntimeStats(context.Background())
+	require.Len(t, first, 1)
+	first[0].AccountHealthScore = -1
+
+	svc.ReportOpenAIAccountScheduleResultForModel(7302, "gpt-5.1", true, &ttft)
+	second := svc.SnapshotOpenAIAccountRuntimeStats(context.Background())
+	require.Len(t, second, 1, "刷新间隔内应复用已发布的副本")
+	require.NotEqual(t, -1, second[0].AccountHealthScore, "读取方修改返回值不应影响副本")
+
+	metrics := svc.SnapshotOpenAIAccountSchedulerMetrics()
+	require.Equal(t, int64(1), metrics.RuntimeStatsReplicaRebuildTotal)
+	require.Equal(t, int64(1), metrics.RuntimeStatsReplicaHitTotal)
+
+	cfg.Gateway.OpenAIWS.SchedulerRuntimeStatsReplicaIntervalMS = 0
+	require.Len(t, svc.SnapshotOpenAIAccountRuntimeStats(context.Background()), 2, "关闭副本后实时构建")
+}
+
+func TestOpenAIGatewayService_SnapshotOpenAIAccountRuntimeStats_ReplicaConsistentUnderConcurrentReports(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.SchedulerRuntimeStatsReplicaIntervalMS = 1
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerEnabled = true
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerFailThreshold = 3
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerCooldownSeconds = 60
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerHalfOpenMax = 1
+	svc := &OpenAIGatewayService{cfg: cfg, cache: &stubGatewayCache{}}
+
+	const (
+		reporters         = 4
+		accounts          = 8
+		reportsPerAccount = 100
+		readers           = 4
+	)
+	// 先发布首个副本：尚无副本时并发读取方会实时构建，之后读取方只会看到按构建顺序发布的副本。
+	require.Empty(t, svc.SnapshotOpenAIAccountRuntimeStats(context.Background()))
+
+	done := make(chan struct{})
+	var reportWG sync.WaitGroup
+	for r := 0; r < reporters; r++ {
+		reportWG.Add(1)
+		go func(r int) {
+			defer reportWG.Done()
+			ttft := 100 + r
+			for i := 0; i < reportsPerAccount; i++ {
+				for a := 0; a < accounts; a++ {
+					accountID := int64(7400 + a)
+					success := (i+r)%5 != 0
+					svc.ReportOpenAIAccountScheduleResultForModel(accountID, fmt.Sprintf("gpt-5.%d", i%3), success, &ttft)
+					if !success {
+						svc.RecordOpenAIAccountError(accountID, errors.New("upstream failed"))
+					}
+				}
+			}
+		}(r)
+	}
+
+	errCh := make(chan error, readers)
+	var readWG sync.WaitGroup
+	for r := 0; r < readers; r++ {
+		readWG.Add(1)
+		go func() {
+			defer readWG.Done()
+			lastTotals := make(map[int64]float64)
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				stats := svc.SnapshotOpenAIAccountRuntimeStats(context.Background())
+				if !sort.SliceIsSorted(stats, func(i, j int) bool { return stats[i].AccountID < stats[j].AccountID }) {
+					errCh <- errors.New("runtime stats not sorted by account id")
+					return
+				}
+				for i, item := range stats {
+					if i > 0 && stats[i-1].AccountID == item.AccountID {
+						errCh <- fmt.Errorf("duplicate account %d in snapshot", item.AccountID)
+						return
+					}
+					if len(item.RecentErrors) > openAIAccountRecentErrorsMax {
+						errCh <- fmt.Errorf("account %d has %d recent errors", item.AccountID, len(item.RecentErrors))
+						return
+					}
+					if item.ModelUsage == nil {
+						continue
+					}
+					sum := item.ModelUsage.OtherCount
+					for _, usage := range item.ModelUsage.Models {
+						sum += usage.Count
+					}
+					if sum != item.ModelUsage.Total {
+						errCh <- fmt.Errorf("account %d model usage total %v != sum %v", item.AccountID, item.ModelUsage.Total, sum)
+						return
+					}
+					if item.ModelUsage.Total < lastTotals[item.AccountID] {
+						errCh <- fmt.Errorf("account %d model usage went backwards: %v -> %v", item.AccountID, lastTotals[item.AccountID], item.ModelUsage.Total)
+						return
+					}
+					lastTotals[item.AccountID] = item.ModelUsage.Total
+				}
+			}
+		}()
+	}
+
+	reportWG.Wait()
+	close(done)
+	readWG.Wait()
+	close(errCh)
+	for err := range errCh {
+		require.NoError(t, err)
+	}
+
+	metrics := svc.SnapshotOpenAIAccountSchedulerMetrics()
+	require.Positive(t, metrics.RuntimeStatsReplicaRebuildTotal)
+}
@@ -4,6 +4,7 @@ import (
 	"container/heap"
 	"context"
 	"errors"
+	"fmt"
 	"hash/fnv"
 	"math"
 	"sort"
@@ -12,12 +13,17 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
 )
 
 const (
 	openAIAccountScheduleLayerPreviousResponse = "previous_response_id"
 	openAIAccountScheduleLayerSessionSticky    = "session_hash"
 	openAIAccountScheduleLayerLoadBalance      = "load_balance"
+	openAIAccountScheduleLayerAPIKeySticky     = "api_key_sticky"
+	openAIAccountScheduleLayerCanary           = "canary"
 )
 
 type OpenAIAccountScheduleRequest struct {
@@ -28,18 +34,27 @@ type OpenAIAccountScheduleRequest struct {
 	RequestedModel     string
 	RequiredTransport  OpenAIUpstreamTransport
 	ExcludedIDs        map[int64]struct{}
+	// APIKeyID 用于无会话粘连时的 API Key 短窗口粘连；0 表示不参与。
+	APIKeyID int64
+	// ClientRegion 客户端地域（已规范化），开启地域亲和时为标记了该地域的账号加分；空表示不参与。
+	ClientRegion string
 }
 
 type OpenAIAccountScheduleDecision struct {
 	Layer               string
 	StickyPreviousHit   bool
 	StickySessionHit    bool
+	StickyReevaluated   bool
 	CandidateCount      int
+	TotalEligible       int // 预筛前通过可调度/模型/传输/熔断筛选的账号数，与 CandidateCount 对比可区分“候选被预筛截断”与“可用账号本身就少”
 	TopK                int
 	LatencyMs           int64
 	LoadSkew            float64
+	SelectedScore       float64
 	SelectedAccountID   int64
 	SelectedAccountType string
+	// TransportFallback 要求的传输协议没有可用候选，按分组配置降级为任意传输后选出的账号。
+	TransportFallback bool
 }
 
 type OpenAIAccountSchedulerMetricsSnapshot struct {
@@ -54,13 +69,59 @@ type OpenAIAccountSchedulerMetricsSnapshot struct {
 	AccountSwitchRate        float64
 	LoadSkewAvg              float64
 	RuntimeStatsAccountCount int
+
+	CircuitBreakerTripTotal        int64
+	CircuitBreakerManualResetTotal int64
+	// CircuitBreakerWarmupExemptTotal 预热期内未计入连续失败的失败次数。
+	CircuitBreakerWarmupExemptTotal int64
+	// CircuitBreakerAutoDisableTotal 因窗口内反复熔断被自动置为 error 状态的账号次数。
+	CircuitBreakerAutoDisableTotal int64
+	// RuntimeStatsReplicaRebuildTotal/RuntimeStatsReplicaHitTotal 运行时统计只读副本的重建次数与命中次数。
+	RuntimeStatsReplicaRebuildTotal int64
+	RuntimeStatsReplicaHitTotal     int64
+
+	// 负载均衡打分耗时（含负载批量查询），按是否经过候选预筛分别统计，便于对比预筛收益。
+	ScoringFullTotal               int64
+	ScoringFullLatencyUsAvg        float64
+	ScoringPrefilteredTotal        int64
+	ScoringPrefilteredLatencyUsAvg float64
+	PrefilterDroppedCandidateTotal int64
+	// MinScoreExcludedCandidateTotal 因低于 scheduler_min_score_threshold 被排除的候选累计数。
+	MinScoreExcludedCandidateTotal int64
+	// HalfOpenProbeReleasedTotal 按 scheduler_half_open_probe_strategy 未被保留而移出候选的半开账号累计数。
+	HalfOpenProbeReleasedTotal int64
+
+	// GroupPausedRejectTotal 因分组暂停调度而拒绝的选择请求数。
+	GroupPausedRejectTotal int64
+	// TransportFallbackTotal 因要求的传输协议无候选而降级为任意传输的选择次数。
+	TransportFallbackTotal int64
+	// StickySessionCapOverflowTotal 因账号粘连会话数达到 sticky_sessions_per_account_max 而未写入的粘连绑定次数。
+	StickySessionCapOverflowTotal int64
+	// StickyTTLSkew 会话粘连绑定实际寿命与配置 TTL 的偏差采样统计（sticky_ttl_skew_sample_rate）。
+	StickyTTLSkew OpenAIStickyTTLSkewSnapshot
+
+	// CanarySelectTotal 经金丝雀分流选中金丝雀账号的次数；CanaryRollbackTotal 金丝雀账号自动回滚次数。
+	CanarySelectTotal   int64
+	CanaryRollbackTotal int64
 }
 
 type OpenAIAccountScheduler interface {
 	Select(ctx context.Context, req OpenAIAccountScheduleRequest) (*AccountSelectionResult, OpenAIAccountScheduleDecision, error)
 	ReportResult(accountID int64, success bool, firstTokenMs *int)
+	// ReportResults 批量上报，等价于按顺序逐条 ReportResult，但同一账号的统计只提交一次。
+	ReportResults(results []OpenAIAccountScheduleResult)
+	ReportModelTTFT(accountID int64, model string, firstTokenMs *int)
+	ReportModelUsage(accountID int64, model string)
+	// ReportError 记录账号一次失败的归类原因与错误原文，供运行时统计展示最近错误。
+	ReportError(accountID int64, reason, message string)
+	ReportPreviousResponseOutcome(accountID int64, notFound bool)
 	ReportSwitch()
 	SnapshotMetrics() OpenAIAccountSchedulerMetricsSnapshot
+	ListCircuitBreakers() []CircuitBreakerInfo
+	ResetCircuitBreaker(accountID int64) bool
+	ListCanaryAccounts() []OpenAICanaryAccountHealth
+	ResetCanary(accountID int64) bool
+	SnapshotRuntimeStats() []OpenAIAccountRuntimeStatsSnapshot
 }
 
 type openAIAccountSchedulerMetrics struct {
@@ -71,6 +132,14 @@ type openAIAccountSchedulerMetrics struct {
 	accountSwitchTotal     atomic.Int64
 	latencyMsTotal         atomic.Int64
 	loadSkewMilliTotal     atomic.Int64
+
+	scoringFullTotal                 atomic.Int64
+	scoringFullLatencyUsTotal        atomic.Int64
+	scoringPrefilteredTotal          atomic.Int64
+	scoringPrefilteredLatencyUsTotal atomic.Int64
+	prefilterDroppedTotal            atomic.Int64
+	halfOpenProbeReleasedTotal       atomic.Int64
+	minScoreExcludedTotal            atomic.Int64
 }
 
 func (m *openAIAccountSchedulerMetrics) recordSelect(decision OpenAIAccountScheduleDecision) {
@@ -91,6 +160,20 @@ func (m *openAIAccountSchedulerMetrics) recordSelect(decision OpenAIAccountSched
 	}
 }
 
+func (m *openAIAccountSchedulerMetrics) recordScoring(elapsed time.Duration, dropped int) {
+	if m == nil {
+		return
+	}
+	if dropped > 0 {
+		m.scoringPrefilteredTotal.Add(1)
+		m.scoringPrefilteredLatencyUsTotal.Add(elapsed.Microseconds())
+		m.prefilterDroppedTotal.Add(int64(dropped))
+		return
+	}
+	m.scoringFullTotal.Add(1)
+	m.scoringFullLatencyUsTotal.Add(elapsed.Microseconds())
+}
+
 func (m *openAIAccountSchedulerMetrics) recordSwitch() {
 	if m == nil {
 		return
@@ -101,13 +184,29 @@ func (m *openAIAccountSchedulerMetrics) recordSwitch() {
 type openAIAccountRuntimeStats struct {
 	accounts     sync.Map
 	accountCount atomic.Int64
+	// errorRateAlphaBits/ttftAlphaBits: 错误率与 TTFT EWMA 的平滑系数（float64 bits），
+	// 由调度器按配置同步；未设置（0）时使用 openAIAccountRuntimeStatsAlpha。
+	errorRateAlphaBits atomic.Uint64
+	ttftAlphaBits      atomic.Uint64
 }
 
 type openAIAccountRuntimeStat struct {
 	errorRateEWMABits atomic.Uint64
 	ttftEWMABits      atomic.Uint64
+	// prevNotFoundEWMABits: 携带 previous_response_id 的请求中上游返回 previous_response_not_found 的比例 EWMA。
+	prevNotFoundEWMABits atomic.Uint64
+	// modelTTFT: model -> *atomic.Uint64（TTFT EWMA），用于快慢模型混跑时按模型比较 TTFT。
+	modelTTFT      sync.Map
+	modelTTFTCount atomic.Int64
+	// modelUsage: 已完成 turn 的模型分布（top-K，滚动计数），供容量规划查看账号实际服务的模型占比。
+	modelUsage openAIAccountModelUsage
+	// recentErrors: 最近若干次失败的归类原因与脱敏原文，供运维排查。
+	recentErrors openAIAccountRecentErrors
 }
 
+// openAIAccountModelTTFTMaxModels 限制单账号按模型记录 TTFT 的模型数量，避免异常模型名导致内存膨胀。
+const openAIAccountModelTTFTMaxModels = 32
+
 func newOpenAIAccountRuntimeStats() *openAIAccountRuntimeStats {
 	return &openAIAccountRuntimeStats{}
 }
@@ -134,6 +233,33 @@ func (s *openAIAccountRuntimeStats) loadOrCreate(accountID int64) *openAIAccount
 	return stat
 }
 
+// setEWMAAlphas 更新错误率与 TTFT EWMA 的平滑系数，不在 (0,1) 内的值回退默认系数。
+func (s *openAIAccountRuntimeStats) setEWMAAlphas(errorRateAlpha, ttftAlpha float64) {
+	if s == nil {
+		return
+	}
+	s.errorRateAlphaBits.Store(math.Float64bits(normalizeOpenAIAccountEWMAAlpha(errorRateAlpha)))
+	s.ttftAlphaBits.Store(math.Float64bits(normalizeOpenAIAccountEWMAAlpha(ttftAlpha)))
+}
+
+func (s *openAIAccountRuntimeStats) ewmaAlphas() (errorRateAlpha, ttftAlpha float64) {
+	errorRateAlpha, ttftAlpha = openAIAccountRuntimeStatsAlpha, openAIAccountRuntimeStatsAlpha
+	if bits := s.errorRateAlphaBits.Load(); bits != 0 {
+		errorRateAlpha = math.Float64frombits(bits)
+	}
+	if bits := s.ttftAlphaBits.Load(); bits != 0 {
+		ttftAlpha = math.Float64frombits(bits)
+	}
+	return errorRateAlpha, ttftAlpha
+}
+
+func normalizeOpenAIAccountEWMAAlpha(alpha float64) float64 {
+	if alpha <= 0 || alpha >= 1 || math.IsNaN(alpha) {
+		return openAIAccountRuntimeStatsAlpha
+	}
+	return alpha
+}
+
 func updateEWMAAtomic(target *atomic.Uint64, sample float64, alpha float64) {
 	for {
 		oldBits := target.Load()
@@ -149,14 +275,14 @@ func (s *openAIAccountRuntimeStats) report(accountID int64, success bool, firstT
 	if s == nil || accountID <= 0 {
 		return
 	}
-	const alpha = 0.2
+	errorRateAlpha, ttftAlpha := s.ewmaAlphas()
 	stat := s.loadOrCreate(accountID)
 
 	errorSample := 1.0
 	if success {
 		errorSample = 0.0
 	}
-	updateEWMAAtomic(&stat.errorRateEWMABits, errorSample, alpha)
+	updateEWMAAtomic(&stat.errorRateEWMABits, errorSample, errorRateAlpha)
 
 	if firstTokenMs != nil && *firstTokenMs > 0 {
 		ttft := float64(*firstTokenMs)
@@ -170,7 +296,7 @@ func (s *openAIAccountRuntimeStats) report(accountID int64, success bool, firstT
 				}
 				continue
 			}
-			newValue := alpha*ttft + (1-alpha)*oldValue
+			newValue := ttftAlpha*ttft + (1-ttftAlpha)*oldValue
 			if stat.ttftEWMABits.CompareAndSwap(oldBits, math.Float64bits(newValue)) {
 				break
 			}
@@ -178,6 +304,72 @@ func (s *openAIAccountRuntimeStats) report(accountID int64, success bool, firstT
 	}
 }
 
+// reportModelTTFT 按 (账号, 模型) 维度更新 TTFT EWMA；与账号级 TTFT 相互独立。
+func (s *openAIAccountRuntimeStats) reportModelTTFT(accountID int64, model string, firstTokenMs *int) {
+	if s == nil || accountID <= 0 || firstTokenMs == nil || *firstTokenMs <= 0 {
+		return
+	}
+	model = normalizeOpenAIAccountStatsModel(model)
+	if model == "" {
+		return
+	}
+	_, alpha := s.ewmaAlphas()
+	stat := s.loadOrCreate(accountID)
+	ttft := float64(*firstTokenMs)
+
+	var target *atomic.Uint64
+	if value, ok := stat.modelTTFT.Load(model); ok {
+		target, _ = value.(*atomic.Uint64)
+	}
+	if target == nil {
+		if stat.modelTTFTCount.Load() >= openAIAccountModelTTFTMaxModels {
+			return
+		}
+		created := &atomic.Uint64{}
+		created.Store(math.Float64bits(ttft))
+		actual, loaded := stat.modelTTFT.LoadOrStore(model, created)
+		if !loaded {
+			stat.modelTTFTCount.Add(1)
+			return
+		}
+		target, _ = actual.(*atomic.Uint64)
+		if target == nil {
+			return
+		}
+	}
+	updateEWMAAtomic(target, ttft, alpha)
+}
+
+// snapshotForModel 与 snapshot 相同，但指定模型时只返回该模型维度的 TTFT：模型无样本时 hasTTFT=false，
+// 由调用方按中性值处理，避免账号级 TTFT 与其他账号的模型级 TTFT 混在一起归一化。
+func (s *openAIAccountRuntimeStats) snapshotForModel(accountID int64, model string) (errorRate float64, ttft float64, hasTTFT bool) {
+	errorRate, ttft, hasTTFT = s.snapshot(accountID)
+	model = normalizeOpenAIAccountStatsModel(model)
+	if model == "" || s == nil || accountID <= 0 {
+		return errorRate, ttft, hasTTFT
+	}
+	value, ok := s.accounts.Load(accountID)
+	if !ok {
+		return errorRate, 0, false
+	}
+	stat, _ := value.(*openAIAccountRuntimeStat)
+	if stat == nil {
+		return errorRate, 0, false
+	}
+	if modelValue, ok := stat.modelTTFT.Load(model); ok {
+		if target, _ := modelValue.(*atomic.Uint64); target != nil {
+			if modelTTFT := math.Float64frombits(target.Load()); !math.IsNaN(modelTTFT) && modelTTFT > 0 {
+				return errorRate, modelTTFT, true
+			}
+		}
+	}
+	return errorRate, 0, false
+}
+
+func normalizeOpenAIAccountStatsModel(model string) string {
+	return strings.ToLower(strings.TrimSpace(model))
+}
+
 func (s *openAIAccountRuntimeStats) snapshot(accountID int64) (errorRate float64, ttft float64, hasTTFT bool) {
 	if s == nil || accountID <= 0 {
 		return 0, 0, false
@@ -198,6 +390,34 @@ func (s *openAIAccountRuntimeStats) snapshot(accountID int64) (errorRate float64
 	return errorRate, ttftValue, true
 }
 
+// reportPreviousResponseOutcome 记录一次续链请求的结果：notFound 表示上游丢失了 previous_response_id 对应的响应。
+func (s *openAIAccountRuntimeStats) reportPreviousResponseOutcome(accountID int64, notFound bool) {
+	if s == nil || accountID <= 0 {
+		return
+	}
+	const alpha = 0.2
+	sample := 0.0
+	if notFound {
+		sample = 1.0
+	}
+	updateEWMAAtomic(&s.loadOrCreate(accountID).prevNotFoundEWMABits, sample, alpha)
+}
+
+func (s *openAIAccountRuntimeStats) prevNotFoundRate(accountID int64) float64 {
+	if s == nil || accountID <= 0 {
+		return 0
+	}
+	value, ok := s.accounts.Load(accountID)
+	if !ok {
+		return 0
+	}
+	stat, _ := value.(*openAIAccountRuntimeStat)
+	if stat == nil {
+		return 0
+	}
+	return clamp01(math.Float64frombits(stat.prevNotFoundEWMABits.Load()))
+}
+
 func (s *openAIAccountRuntimeStats) size() int {
 	if s == nil {
 		return 0
@@ -209,6 +429,46 @@ type defaultOpenAIAccountScheduler struct {
 	service *OpenAIGatewayService
 	metrics openAIAccountSchedulerMetrics
 	stats   *openAIAccountRuntimeStats
+	// breakers: 账号级调度熔断器，仅在 scheduler_circuit_breaker_enabled 开启时参与过滤。
+	breakers *openAIAccountCircuitBreakers
+	// canaries: 金丝雀账号的窗口错误率与自动回滚状态，仅在 canary_traffic_ratio > 0 时参与调度。
+	canaries *openAIAccountCanaryPool
+	// statsReplica: 运行时统计只读副本，仅在 scheduler_runtime_stats_replica_interval_ms > 0 时使用。
+	statsReplica openAIAccountRuntimeStatsReplica
+	// apiKeyAffinity: (api_key_id, group_id) -> 最近一次负载均衡选中的账号，仅进程内有效；
+	// 窗口过期后周期清理，条目数超过上限时淘汰任意条目。
+	apiKeyAffinity *openAITTLMap[openAIAPIKeyAffinityKey, openAIAPIKeyAffinityEntry]
+	// stickyTurns: (group_id, session_hash) -> 连续命中会话粘连的轮数与粘连起始时间，仅进程内有效；
+	// 随会话粘连 TTL 过期清理，条目数超过上限时淘汰任意条目。
+	stickyTurns *openAITTLMap[openAIStickyTurnKey, openAIStickyTurnEntry]
+}
+
+const (
+	// openAIStickyTurnsMaxEntries 进程内连续粘连轮数记录的条目上限。
+	openAIStickyTurnsMaxEntries = 100000
+	// openAIAPIKeyAffinityMaxEntries 进程内 API Key 短窗口粘连记录的条目上限。
+	openAIAPIKeyAffinityMaxEntries = 100000
+)
+
+type openAIStickyTurnKey struct {
+	groupID     int64
+	sessionHash string
+}
+
+type openAIStickyTurnEntry struct {
+	accountID int64
+	turns     int
+	// boundAt: 本轮粘连开始的时间；负载均衡重新评估后重新计时。
+	boundAt time.Time
+}
+
+type openAIAPIKeyAffinityKey struct {
+	apiKeyID int64
+	groupID  int64
+}
+
+type openAIAPIKeyAffinityEntry struct {
+	accountID int64
 }
 
 func newDefaultOpenAIAccountScheduler(service *OpenAIGatewayService, stats *openAIAccountRuntimeStats) OpenAIAccountScheduler {
@@ -216,28 +476,44 @@ func newDefaultOpenAIAccountScheduler(service *OpenAIGatewayService, stats *open
 		stats = newOpenAIAccountRuntimeStats()
 	}
 	return &defaultOpenAIAccountScheduler{
-		service: service,
-		stats:   stats,
+		service:        service,
+		stats:          stats,
+		breakers:       newOpenAIAccountCircuitBreakers(),
+		canaries:       newOpenAIAccountCanaryPool(),
+		stickyTurns:    newOpenAITTLMap[openAIStickyTurnKey, openAIStickyTurnEntry](openAIStickyTurnsMaxEntries),
+		apiKeyAffinity: newOpenAITTLMap[openAIAPIKeyAffinityKey, openAIAPIKeyAffinityEntry](openAIAPIKeyAffinityMaxEntries),
 	}
 }
 
 func (s *defaultOpenAIAccountScheduler) Select(
 	ctx context.Context,
 	req OpenAIAccountScheduleRequest,
-) (*AccountSelectionResult, OpenAIAccountScheduleDecision, error) {
-	decision := OpenAIAccountScheduleDecision{}
+) (result *AccountSelectionResult, decision OpenAIAccountScheduleDecision, err error) {
 	start := time.Now()
 	defer func() {
 		decision.LatencyMs = time.Since(start).Milliseconds()
 		s.metrics.recordSelect(decision)
+		s.service.emitOpenAIAccountScheduleEvent(req, decision, err)
+		if err == nil && result != nil && result.Account != nil {
+			// 熔断预热期按账号创建时间判断，选中时记录，供随后上报的失败结果查询。
+			if params, enabled := s.service.openAICircuitBreakerParams(); enabled {
+				s.breakers.noteAccount(result.Account, params, time.Now())
+			}
+		}
 	}()
 
+	canaryParams, canaryEnabled := s.service.openAICanaryParams()
+	if canaryEnabled {
+		req = s.excludeRolledBackCanaries(req, canaryParams)
+	}
+
 	previousResponseID := strings.TrimSpace(req.PreviousResponseID)
 	if previousResponseID != "" {
-		selection, err := s.service.SelectAccountByPreviousResponseID(
+		selection, err := s.service.selectAccountByPreviousResponseID(
 			ctx,
 			req.GroupID,
 			previousResponseID,
+			req.SessionHash,
 			req.RequestedModel,
 			req.ExcludedIDs,
 		)
@@ -261,7 +537,7 @@ func (s *defaultOpenAIAccountScheduler) Select(
 		}
 	}
 
-	selection, err := s.selectBySessionHash(ctx, req)
+	selection, reevaluate, err := s.selectBySessionHash(ctx, req)
 	if err != nil {
 		return nil, decision, err
 	}
@@ -270,100 +546,293 @@ func (s *defaultOpenAIAccountScheduler) Select(
 		decision.StickySessionHit = true
 		decision.SelectedAccountID = selection.Account.ID
 		decision.SelectedAccountType = selection.Account.Type
+		s.recordStickyTurn(req, selection.Account.ID)
 		return selection, decision, nil
 	}
+	decision.StickyReevaluated = reevaluate
 
-	selection, candidateCount, topK, loadSkew, err := s.selectByLoadBalance(ctx, req)
+	if canaryEnabled {
+		if selection := s.selectCanary(ctx, req, canaryParams); selection != nil {
+			decision.Layer = openAIAccountScheduleLayerCanary
+			decision.SelectedAccountID = selection.Account.ID
+			decision.SelectedAccountType = selection.Account.Type
+			s.resetStickyTurns(req)
+			return selection, decision, nil
+		}
+	}
+
+	if s.isAPIKeyStickyEligible(req) {
+		if selection := s.selectByAPIKeyAffinity(ctx, req); selection != nil && selection.Account != nil {
+			decision.Layer = openAIAccountScheduleLayerAPIKeySticky
+			decision.SelectedAccountID = selection.Account.ID
+			decision.SelectedAccountType = selection.Account.Type
+			s.rememberAPIKeyAffinity(req, selection.Account.ID)
+			return selection, decision, nil
+		}
+	}
+
+	selection, candidateCount, totalEligible, topK, loadSkew, selectedScore, err := s.selectByLoadBalance(ctx, req)
 	decision.Layer = openAIAccountScheduleLayerLoadBalance
 	decision.CandidateCount = candidateCount
+	decision.TotalEligible = totalEligible
 	decision.TopK = topK
 	decision.LoadSkew = loadSkew
+	decision.SelectedScore = selectedScore
 	if err != nil {
 		return nil, decision, err
 	}
 	if selection != nil && selection.Account != nil {
 		decision.SelectedAccountID = selection.Account.ID
 		decision.SelectedAccountType = selection.Account.Type
+		if selection.Acquired && s.isAPIKeyStickyEligible(req) {
+			s.rememberAPIKeyAffinity(req, selection.Account.ID)
+		}
+		// 负载均衡选出账号后重新开始计数与计时（无论是否选回原粘连账号）。
+		s.resetStickyTurns(req)
 	}
 	return selection, decision, nil
 }
 
+func openAIStickyTurnKeyFor(req OpenAIAccountScheduleRequest) openAIStickyTurnKey {
+	key := openAIStickyTurnKey{sessionHash: strings.TrimSpace(req.SessionHash)}
+	if req.GroupID != nil {
+		key.groupID = *req.GroupID
+	}
+	return key
+}
+
+// maxConsecutiveStickyTurns 返回账号的会话连续粘连上限：账号级配置优先，其次全局配置；0 表示不限制。
+func (s *defaultOpenAIAccountScheduler) maxConsecutiveStickyTurns(account *Account) int {
+	if limit := account.GetOpenAIMaxConsecutiveStickyTurns(); limit > 0 {
+		return limit
+	}
+	if s.service != nil && s.service.cfg != nil && s.service.openAIWSConfig().SchedulerMaxConsecutiveStickyTurns > 0 {
+		return s.service.openAIWSConfig().SchedulerMaxConsecutiveStickyTurns
+	}
+	return 0
+}
+
+// maxStickyLifetime 返回账号的会话粘连最长持续时间：账号级配置优先，其次全局配置；0 表示不限制。
+func (s *defaultOpenAIAccountScheduler) maxStickyLifetime(account *Account) time.Duration {
+	if seconds := account.GetOpenAIMaxStickyLifetimeSeconds(); seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if s.service != nil && s.service.cfg != nil && s.service.openAIWSConfig().SchedulerMaxStickyLifetimeSeconds > 0 {
+		return time.Duration(s.service.openAIWSConfig().SchedulerMaxStickyLifetimeSeconds) * time.Second
+	}
+	return 0
+}
+
+// stickyBindingNeedsReevaluation 判断会话在该账号上的连续粘连轮数或粘连持续时间是否已达上限。
+// 粘连记录与会话粘连 TTL 同步过期并由 stickyTurns 周期清理，过期或被淘汰后视为新一轮粘连重新计数、计时。
+func (s *defaultOpenAIAccountScheduler) stickyBindingNeedsReevaluation(req OpenAIAccountScheduleRequest, account *Account) bool {
+	turnLimit := s.maxConsecutiveStickyTurns(account)
+	lifetime := s.maxStickyLifetime(account)
+	if turnLimit <= 0 && lifetime <= 0 {
+		return false
+	}
+	now := time.Now()
+	entry, ok := s.stickyTurns.load(openAIStickyTurnKeyFor(req), now)
+	if !ok || entry.accountID != account.ID {
+		return false
+	}
+	if turnLimit > 0 && entry.turns >= turnLimit {
+		return true
+	}
+	return lifetime > 0 && now.Sub(entry.boundAt) >= lifetime
+}
+
+func (s *defaultOpenAIAccountScheduler) recordStickyTurn(req OpenAIAccountScheduleRequest, accountID int64) {
+	if accountID <= 0 || strings.TrimSpace(req.SessionHash) == "" {
+		return
+	}
+	key := openAIStickyTurnKeyFor(req)
+	now := time.Now()
+	turns := 1
+	boundAt := now
+	if entry, ok := s.stickyTurns.load(key, now); ok && entry.accountID == accountID {
+		turns = entry.turns + 1
+		boundAt = entry.boundAt
+	}
+	s.stickyTurns.store(key, openAIStickyTurnEntry{
+		accountID: accountID,
+		turns:     turns,
+		boundAt:   boundAt,
+	}, now.Add(s.service.openAIWSSessionStickyTTL()), now)
+}
+
+func (s *defaultOpenAIAccountScheduler) resetStickyTurns(req OpenAIAccountScheduleRequest) {
+	if strings.TrimSpace(req.SessionHash) == "" {
+		return
+	}
+	s.stickyTurns.delete(openAIStickyTurnKeyFor(req))
+}
+
+// isAPIKeyStickyEligible 仅在窗口开启且请求不携带显式会话粘连时启用 API Key 短窗口粘连。
+func (s *defaultOpenAIAccountScheduler) isAPIKeyStickyEligible(req OpenAIAccountScheduleRequest) bool {
+	if s == nil || s.service == nil || req.APIKeyID <= 0 {
+		return false
+	}
+	if strings.TrimSpace(req.SessionHash) != "" || strings.TrimSpace(req.PreviousResponseID) != "" {
+		return false
+	}
+	return s.service.openAIAPIKeyStickyWindow() > 0
+}
+
+func openAIAPIKeyAffinityKeyFor(req OpenAIAccountScheduleRequest) openAIAPIKeyAffinityKey {
+	key := openAIAPIKeyAffinityKey{apiKeyID: req.APIKeyID}
+	if req.GroupID != nil {
+		key.groupID = *req.GroupID
+	}
+	return key
+}
+
+func (s *defaultOpenAIAccountScheduler) rememberAPIKeyAffinity(req OpenAIAccountScheduleRequest, accountID int64) {
+	if accountID <= 0 {
+		return
+	}
+	now := time.Now()
+	s.apiKeyAffinity.store(openAIAPIKeyAffinityKeyFor(req), openAIAPIKeyAffinityEntry{accountID: accountID}, now.Add(s.service.openAIAPIKeyStickyWindow()), now)
+}
+
+// selectByAPIKeyAffinity 尝试复用窗口期内同一 API Key 上次选中的账号。
+// 账号不可用或已满载时直接回退负载均衡，不生成等待计划，避免粘连放大热点。
+func (s *defaultOpenAIAccountScheduler) selectByAPIKeyAffinity(
+	ctx context.Context,
+	req OpenAIAccountScheduleRequest,
+) *AccountSelectionResult {
+	key := openAIAPIKeyAffinityKeyFor(req)
+	entry, ok := s.apiKeyAffinity.load(key, time.Now())
+	if !ok || entry.accountID <= 0 {
+		return nil
+	}
+	if req.ExcludedIDs != nil {
+		if _, excluded := req.ExcludedIDs[entry.accountID]; excluded {
+			return nil
+		}
+	}
+
+	account, err := s.service.getSchedulableAccount(ctx, entry.accountID)
+	if err != nil || account == nil {
+		s.apiKeyAffinity.delete(key)
+		return nil
+	}
+	if shouldClearStickySession(account, req.RequestedModel) || !account.IsOpenAI() || !account.IsSchedulable() {
+		s.apiKeyAffinity.delete(key)
+		return nil
+	}
+	if req.RequestedModel != "" && !account.IsModelSupported(req.RequestedModel) {
+		return nil
+	}
+	if !s.isAccountTransportCompatible(account, req.RequiredTransport) {
+		return nil
+	}
+	if !s.canAttemptByCircuitBreaker(account.ID, req.GroupID) {
+		return nil
+	}
+
+	result, acquireErr := s.service.tryAcquireAccountSlot(ctx, account.ID, s.service.openAIWSSchedulerAccountConcurrency(account))
+	if acquireErr != nil || result == nil || !result.Acquired {
+		return nil
+	}
+	if !s.reserveByCircuitBreaker(account.ID, req.GroupID, result.ReleaseFunc) {
+		return nil
+	}
+	return &AccountSelectionResult{
+		Account:     account,
+		Acquired:    true,
+		ReleaseFunc: result.ReleaseFunc,
+	}
+}
+
+// selectBySessionHash 返回的 reevaluate 表示粘连账号可用但连续粘连轮数已达上限，需交由负载均衡重新评估。
 func (s *defaultOpenAIAccountScheduler) selectBySessionHash(
 	ctx context.Context,
 	req OpenAIAccountScheduleRequest,
-) (*AccountSelectionResult, error) {
+) (selection *AccountSelectionResult, reevaluate bool, err error) {
 	sessionHash := strings.TrimSpace(req.SessionHash)
 	if sessionHash == "" || s == nil || s.service == nil || s.service.cache == nil {
-		return nil, nil
+		return nil, false, nil
 	}
 
 	accountID := req.StickyAccountID
 	if accountID <= 0 {
-		var err error
 		accountID, err = s.service.getStickySessionAccountID(ctx, req.GroupID, sessionHash)
 		if err != nil || accountID <= 0 {
-			return nil, nil
+			return nil, false, nil
 		}
 	}
 	if accountID <= 0 {
-		return nil, nil
+		return nil, false, nil
 	}
 	if req.ExcludedIDs != nil {
 		if _, excluded := req.ExcludedIDs[accountID]; excluded {
-			return nil, nil
+			return nil, false, nil
 		}
 	}
 
 	account, err := s.service.getSchedulableAccount(ctx, accountID)
 	if err != nil || account == nil {
 		_ = s.service.deleteStickySessionAccountID(ctx, req.GroupID, sessionHash)
-		return nil, nil
+		return nil, false, nil
 	}
 	if shouldClearStickySession(account, req.RequestedModel) || !account.IsOpenAI() || !account.IsSchedulable() {
 		_ = s.service.deleteStickySessionAccountID(ctx, req.GroupID, sessionHash)
-		return nil, nil
+		return nil, false, nil
 	}
 	if req.RequestedModel != "" && !account.IsModelSupported(req.RequestedModel) {
-		return nil, nil
+		return nil, false, nil
 	}
 	if !s.isAccountTransportCompatible(account, req.RequiredTransport) {
 		_ = s.service.deleteStickySessionAccountID(ctx, req.GroupID, sessionHash)
-		return nil, nil
+		return nil, false, nil
+	}
+	if !s.canAttemptByCircuitBreaker(accountID, req.GroupID) {
+		// 熔断期间保留粘连绑定，交由负载均衡临时分流，熔断恢复后继续命中原账号。
+		return nil, false, nil
+	}
+	if s.stickyBindingNeedsReevaluation(req, account) {
+		// 保留粘连绑定：负载均衡选回原账号时连接上下文不受影响，选中新账号时由负载均衡改写绑定。
+		return nil, true, nil
 	}
 
-	result, acquireErr := s.service.tryAcquireAccountSlot(ctx, accountID, account.Concurrency)
+	result, acquireErr := s.service.tryAcquireAccountSlot(ctx, accountID, s.service.openAIWSSchedulerAccountConcurrency(account))
 	if acquireErr == nil && result.Acquired {
+		if !s.reserveByCircuitBreaker(accountID, req.GroupID, result.ReleaseFunc) {
+			return nil, false, nil
+		}
 		_ = s.service.refreshStickySessionTTL(ctx, req.GroupID, sessionHash, s.service.openAIWSSessionStickyTTL())
 		return &AccountSelectionResult{
 			Account:     account,
 			Acquired:    true,
 			ReleaseFunc: result.ReleaseFunc,
-		}, nil
+		}, false, nil
 	}
 
 	cfg := s.service.schedulingConfig()
 	// WaitPlan.MaxConcurrency 使用 Concurrency（非 EffectiveLoadFactor），因为 WaitPlan 控制的是 Redis 实际并发槽位等待。
-	if s.service.concurrencyService != nil {
+	if s.service.concurrencyService != nil && s.allowByCircuitBreaker(accountID, req.GroupID) {
 		return &AccountSelectionResult{
 			Account: account,
 			WaitPlan: &AccountWaitPlan{
 				AccountID:      accountID,
-				MaxConcurrency: account.Concurrency,
+				MaxConcurrency: s.service.openAIWSSchedulerAccountConcurrency(account),
 				Timeout:        cfg.StickySessionWaitTimeout,
 				MaxWaiting:     cfg.StickySessionMaxWaiting,
 			},
-		}, nil
+		}, false, nil
 	}
-	return nil, nil
+	return nil, false, nil
 }
 
 type openAIAccountCandidateScore struct {
-	account   *Account
-	loadInfo  *AccountLoadInfo
-	score     float64
-	errorRate float64
-	ttft      float64
-	hasTTFT   bool
+	account      *Account
+	loadInfo     *AccountLoadInfo
+	score        float64
+	errorRate    float64
+	prevNotFound float64
+	ttft         float64
+	hasTTFT      bool
 }
 
 type openAIAccountCandidateHeap []openAIAccountCandidateScore
@@ -558,20 +1027,67 @@ func buildOpenAIWeightedSelectionOrder(
 	return order
 }
 
+// prefilterOpenAICandidateAccounts 在候选过多时缩减参与完整打分的账号集合：
+// 按优先级从高到低整层保留，放不下的那一层内随机抽样补满；keepAccountID（粘连账号）始终保留。
+func prefilterOpenAICandidateAccounts(accounts []*Account, size int, keepAccountID int64, rng *openAISelectionRNG) []*Account {
+	if size <= 0 || len(accounts) <= size {
+		return accounts
+	}
+	sorted := append([]*Account(nil), accounts...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+
+	shortlist := make([]*Account, 0, size)
+	if keepAccountID > 0 {
+		for i, account := range sorted {
+			if account.ID == keepAccountID {
+				shortlist = append(shortlist, account)
+				sorted = append(sorted[:i:i], sorted[i+1:]...)
+				break
+			}
+		}
+	}
+	for start := 0; start < len(sorted) && len(shortlist) < size; {
+		end := start + 1
+		for end < len(sorted) && sorted[end].Priority == sorted[start].Priority {
+			end++
+		}
+		tier := sorted[start:end]
+		remaining := size - len(shortlist)
+		if len(tier) <= remaining {
+			shortlist = append(shortlist, tier...)
+		} else {
+			// 部分 Fisher-Yates：只打乱前 remaining 个位置。
+			for i := 0; i < remaining; i++ {
+				j := i + int(rng.nextUint64()%uint64(len(tier)-i))
+				tier[i], tier[j] = tier[j], tier[i]
+			}
+			shortlist = append(shortlist, tier[:remaining]...)
+		}
+		start = end
+	}
+	return shortlist
+}
+
 func (s *defaultOpenAIAccountScheduler) selectByLoadBalance(
 	ctx context.Context,
 	req OpenAIAccountScheduleRequest,
-) (*AccountSelectionResult, int, int, float64, error) {
+) (*AccountSelectionResult, int, int, int, float64, float64, error) {
 	accounts, err := s.service.listSchedulableAccounts(ctx, req.GroupID)
 	if err != nil {
-		return nil, 0, 0, 0, err
+		return nil, 0, 0, 0, 0, 0, err
 	}
 	if len(accounts) == 0 {
-		return nil, 0, 0, 0, errors.New("no available OpenAI accounts")
+		return nil, 0, 0, 0, 0, 0, errors.New("no available OpenAI accounts")
 	}
 
 	filtered := make([]*Account, 0, len(accounts))
-	loadReq := make([]AccountWithConcurrency, 0, len(accounts))
+	breakerBlocked := make([]*Account, 0)
+	var halfOpenProbes []openAIHalfOpenProbe
+	breakerParams, breakerEnabled := s.service.openAICircuitBreakerParamsForGroup(req.GroupID)
+	now := time.Now()
+	canaryParams, canaryEnabled := s.service.openAICanaryParams()
 	for i := range accounts {
 		account := &accounts[i]
 		if req.ExcludedIDs != nil {
@@ -579,6 +1095,10 @@ func (s *defaultOpenAIAccountScheduler) selectByLoadBalance(
 				continue
 			}
 		}
+		// 金丝雀账号只承接金丝雀分流，不参与常规负载均衡。
+		if canaryEnabled && canaryParams.contains(account.ID) {
+			continue
+		}
 		if !account.IsSchedulable() || !account.IsOpenAI() {
 			continue
 		}
@@ -588,15 +1108,44 @@ func (s *defaultOpenAIAccountScheduler) selectByLoadBalance(
 		if !s.isAccountTransportCompatible(account, req.RequiredTransport) {
 			continue
 		}
+		// 过滤阶段只做无副作用的判断，探测名额留到最终选中账号时再占用。
+		if !s.canAttemptByCircuitBreaker(account.ID, req.GroupID) {
+			breakerBlocked = append(breakerBlocked, account)
+			continue
+		}
+		if breakerEnabled {
+			if fails, openedAt, ok := s.breakers.halfOpenProbe(account.ID, breakerParams, now); ok {
+				halfOpenProbes = append(halfOpenProbes, openAIHalfOpenProbe{account: account, consecutiveFails: fails, openedAt: openedAt})
+			}
+		}
 		filtered = append(filtered, account)
+	}
+	filtered = s.limitHalfOpenProbes(filtered, halfOpenProbes)
+	breakerBypassed := false
+	if len(filtered) == 0 {
+		// 全部候选均处于熔断时退化为忽略熔断，避免熔断器把整个分组打成不可用。
+		filtered = breakerBlocked
+		breakerBypassed = true
+	}
+	if len(filtered) == 0 {
+		return nil, 0, 0, 0, 0, 0, errors.New("no available OpenAI accounts")
+	}
+	totalEligible := len(filtered)
+	scoringStart := time.Now()
+	prefilterDropped := 0
+	if threshold, size := s.service.openAIWSSchedulerCandidatePrefilter(); threshold > 0 && len(filtered) > threshold {
+		rng := newOpenAISelectionRNG(deriveOpenAISelectionSeed(req))
+		shortlist := prefilterOpenAICandidateAccounts(filtered, size, req.StickyAccountID, &rng)
+		prefilterDropped = len(filtered) - len(shortlist)
+		filtered = shortlist
+	}
+	loadReq := make([]AccountWithConcurrency, 0, len(filtered))
+	for _, account := range filtered {
 		loadReq = append(loadReq, AccountWithConcurrency{
 			ID:             account.ID,
-			MaxConcurrency: account.EffectiveLoadFactor(),
+			MaxConcurrency: s.service.openAIWSSchedulerLoadFactor(account),
 		})
 	}
-	if len(filtered) == 0 {
-		return nil, 0, 0, 0, errors.New("no available OpenAI accounts")
-	}
 
 	loadMap := map[int64]*AccountLoadInfo{}
 	if s.service.concurrencyService != nil {
@@ -611,6 +1160,7 @@ func (s *defaultOpenAIAccountScheduler) selectByLoadBalance(
 	loadRateSumSquares := 0.0
 	minTTFT, maxTTFT := 0.0, 0.0
 	hasTTFTSample := false
+	hasContinuation := strings.TrimSpace(req.PreviousResponseID) != ""
 	candidates := make([]openAIAccountCandidateScore, 0, len(filtered))
 	for _, account := range filtered {
 		loadInfo := loadMap[account.ID]
@@ -626,7 +1176,7 @@ func (s *defaultOpenAIAccountScheduler) selectByLoadBalance(
 		if loadInfo.WaitingCount > maxWaiting {
 			maxWaiting = loadInfo.WaitingCount
 		}
-		errorRate, ttft, hasTTFT := s.stats.snapshot(account.ID)
+		errorRate, ttft, hasTTFT := s.stats.snapshotForModel(account.ID, req.RequestedModel)
 		if hasTTFT && ttft > 0 {
 			if !hasTTFTSample {
 				minTTFT, maxTTFT = ttft, ttft
@@ -643,17 +1193,23 @@ func (s *defaultOpenAIAccountScheduler) selectByLoadBalance(
 		loadRate := float64(loadInfo.LoadRate)
 		loadRateSum += loadRate
 		loadRateSumSquares += loadRate * loadRate
+		prevNotFound := 0.0
+		if hasContinuation {
+			prevNotFound = s.stats.prevNotFoundRate(account.ID)
+		}
 		candidates = append(candidates, openAIAccountCandidateScore{
-			account:   account,
-			loadInfo:  loadInfo,
-			errorRate: errorRate,
-			ttft:      ttft,
-			hasTTFT:   hasTTFT,
+			account:      account,
+			loadInfo:     loadInfo,
+			errorRate:    errorRate,
+			prevNotFound: prevNotFound,
+			ttft:         ttft,
+			hasTTFT:      hasTTFT,
 		})
 	}
 	loadSkew := calcLoadSkewByMoments(loadRateSum, loadRateSumSquares, len(candidates))
 
 	weights := s.service.openAIWSSchedulerWeights()
+	regionAffinity := req.ClientRegion != "" && s.service.openAIWSSchedulerRegionAffinityEnabled()
 	for i := range candidates {
 		item := &candidates[i]
 		priorityFactor := 1.0
@@ -673,6 +1229,20 @@ func (s *defaultOpenAIAccountScheduler) selectByLoadBalance(
 			weights.Queue*queueFactor +
 			weights.ErrorRate*errorFactor +
 			weights.TTFT*ttftFactor
+		// 仅续链请求考虑响应存储可靠性；非续链请求不受该因子影响。
+		if hasContinuation {
+			item.score += weights.PrevNotFound * (1 - item.prevNotFound)
+		}
+		// 地域亲和仅作为加分项：同地域账号优先，其他地域账号仍可被选中。
+		if regionAffinity && openAIAccountMatchesRegion(item.account, req.ClientRegion) {
+			item.score += weights.Region
+		}
+	}
+
+	if threshold := s.service.openAIWSSchedulerMinScoreThreshold(); threshold > 0 {
+		var excluded int
+		candidates, excluded = filterOpenAICandidatesByMinScore(candidates, threshold)
+		s.metrics.minScoreExcludedTotal.Add(int64(excluded))
 	}
 
 	topK := s.service.openAIWSLBTopK()
@@ -683,6 +1253,7 @@ func (s *defaultOpenAIAccountScheduler) selectByLoadBalance(
 		topK = 1
 	}
 	rankedCandidates := selectTopKOpenAICandidates(candidates, topK)
+	s.metrics.recordScoring(time.Since(scoringStart), prefilterDropped)
 	selectionOrder := buildOpenAIWeightedSelectionOrder(rankedCandidates, req)
 
 	for i := 0; i < len(selectionOrder); i++ {
@@ -691,11 +1262,14 @@ func (s *defaultOpenAIAccountScheduler) selectByLoadBalance(
 		if fresh == nil || !s.isAccountTransportCompatible(fresh, req.RequiredTransport) {
 			continue
 		}
-		result, acquireErr := s.service.tryAcquireAccountSlot(ctx, fresh.ID, fresh.Concurrency)
+		result, acquireErr := s.service.tryAcquireAccountSlot(ctx, fresh.ID, s.service.openAIWSSchedulerAccountConcurrency(fresh))
 		if acquireErr != nil {
-			return nil, len(candidates), topK, loadSkew, acquireErr
+			return nil, len(candidates), totalEligible, topK, loadSkew, 0, acquireErr
 		}
 		if result != nil && result.Acquired {
+			if !breakerBypassed && !s.reserveByCircuitBreaker(fresh.ID, req.GroupID, result.ReleaseFunc) {
+				continue
+			}
 			if req.SessionHash != "" {
 				_ = s.service.BindStickySession(ctx, req.GroupID, req.SessionHash, fresh.ID)
 			}
@@ -703,7 +1277,7 @@ func (s *defaultOpenAIAccountScheduler) selectByLoadBalance(
 				Account:     fresh,
 				Acquired:    true,
 				ReleaseFunc: result.ReleaseFunc,
-			}, len(candidates), topK, loadSkew, nil
+			}, len(candidates), totalEligible, topK, loadSkew, candidate.score, nil
 		}
 	}
 
@@ -714,18 +1288,21 @@ func (s *defaultOpenAIAccountScheduler) selectByLoadBalance(
 		if fresh == nil || !s.isAccountTransportCompatible(fresh, req.RequiredTransport) {
 			continue
 		}
+		if !breakerBypassed && !s.allowByCircuitBreaker(fresh.ID, req.GroupID) {
+			continue
+		}
 		return &AccountSelectionResult{
 			Account: fresh,
 			WaitPlan: &AccountWaitPlan{
 				AccountID:      fresh.ID,
-				MaxConcurrency: fresh.Concurrency,
+				MaxConcurrency: s.service.openAIWSSchedulerAccountConcurrency(fresh),
 				Timeout:        cfg.FallbackWaitTimeout,
 				MaxWaiting:     cfg.FallbackMaxWaiting,
 			},
-		}, len(candidates), topK, loadSkew, nil
+		}, len(candidates), totalEligible, topK, loadSkew, candidate.score, nil
 	}
 
-	return nil, len(candidates), topK, loadSkew, errors.New("no available accounts")
+	return nil, len(candidates), totalEligible, topK, loadSkew, 0, errors.New("no available accounts")
 }
 
 func (s *defaultOpenAIAccountScheduler) isAccountTransportCompatible(account *Account, requiredTransport OpenAIUpstreamTransport) bool {
@@ -739,11 +1316,159 @@ func (s *defaultOpenAIAccountScheduler) isAccountTransportCompatible(account *Ac
 	return s.service.getOpenAIWSProtocolResolver().Resolve(account).Transport == requiredTransport
 }
 
+// syncStatsEWMAAlphas 在上报前按当前配置（支持热加载）同步 EWMA 平滑系数。
+func (s *defaultOpenAIAccountScheduler) syncStatsEWMAAlphas() {
+	if s.service == nil || s.service.cfg == nil {
+		return
+	}
+	wsCfg := s.service.openAIWSConfig()
+	s.stats.setEWMAAlphas(wsCfg.SchedulerErrorRateEWMAAlpha, wsCfg.SchedulerTTFTEWMAAlpha)
+}
+
 func (s *defaultOpenAIAccountScheduler) ReportResult(accountID int64, success bool, firstTokenMs *int) {
 	if s == nil || s.stats == nil {
 		return
 	}
+	s.syncStatsEWMAAlphas()
 	s.stats.report(accountID, success, firstTokenMs)
+	now := time.Now()
+	s.recordCanaryResult(accountID, success, now)
+	for _, params := range s.service.openAICircuitBreakerRecordParams() {
+		if s.breakers.record(accountID, success, params, now) && params.groupID == 0 {
+			s.service.escalateOpenAICircuitBreakerTrip(accountID, now)
+		}
+	}
+}
+
+func (s *defaultOpenAIAccountScheduler) ReportResults(results []OpenAIAccountScheduleResult) {
+	if s == nil || s.stats == nil {
+		return
+	}
+	s.syncStatsEWMAAlphas()
+	s.stats.reportBatch(results)
+	now := time.Now()
+	for _, result := range results {
+		s.recordCanaryResult(result.AccountID, result.Success, now)
+	}
+	for _, params := range s.service.openAICircuitBreakerRecordParams() {
+		for _, result := range results {
+			if s.breakers.record(result.AccountID, result.Success, params, now) && params.groupID == 0 {
+				s.service.escalateOpenAICircuitBreakerTrip(result.AccountID, now)
+			}
+		}
+	}
+}
+
+func (s *defaultOpenAIAccountScheduler) ReportModelTTFT(accountID int64, model string, firstTokenMs *int) {
+	if s == nil || s.stats == nil {
+		return
+	}
+	s.syncStatsEWMAAlphas()
+	s.stats.reportModelTTFT(accountID, model, firstTokenMs)
+}
+
+func (s *defaultOpenAIAccountScheduler) ReportModelUsage(accountID int64, model string) {
+	if s == nil || s.stats == nil {
+		return
+	}
+	s.stats.reportModelUsage(accountID, model)
+}
+
+func (s *defaultOpenAIAccountScheduler) ReportError(accountID int64, reason, message string) {
+	if s == nil || s.stats == nil {
+		return
+	}
+	s.stats.reportError(accountID, reason, message)
+}
+
+func (s *defaultOpenAIAccountScheduler) ReportPreviousResponseOutcome(accountID int64, notFound bool) {
+	if s == nil || s.stats == nil {
+		return
+	}
+	s.stats.reportPreviousResponseOutcome(accountID, notFound)
+}
+
+// allowByCircuitBreaker 按请求分组选择熔断作用域：分组配置了参数覆盖时使用分组熔断器，否则使用全局熔断器。
+// half_open 时会占用探测名额，只应对最终选中的账号调用；候选过滤使用 canAttemptByCircuitBreaker。
+func (s *defaultOpenAIAccountScheduler) allowByCircuitBreaker(accountID int64, groupID *int64) bool {
+	if s == nil || s.breakers == nil {
+		return true
+	}
+	params, enabled := s.service.openAICircuitBreakerParamsForGroup(groupID)
+	if !enabled {
+		return true
+	}
+	return s.breakers.allow(accountID, params, time.Now())
+}
+
+// canAttemptByCircuitBreaker 与 allowByCircuitBreaker 使用相同的熔断作用域，但不修改熔断器状态。
+func (s *defaultOpenAIAccountScheduler) canAttemptByCircuitBreaker(accountID int64, groupID *int64) bool {
+	if s == nil || s.breakers == nil {
+		return true
+	}
+	params, enabled := s.service.openAICircuitBreakerParamsForGroup(groupID)
+	if !enabled {
+		return true
+	}
+	return s.breakers.canAttempt(accountID, params, time.Now())
+}
+
+// reserveByCircuitBreaker 在已获取并发槽位的账号上占用熔断放行；探测名额已被并发请求占满时归还槽位并返回 false。
+func (s *defaultOpenAIAccountScheduler) reserveByCircuitBreaker(accountID int64, groupID *int64, releaseSlot func()) bool {
+	if s.allowByCircuitBreaker(accountID, groupID) {
+		return true
+	}
+	if releaseSlot != nil {
+		releaseSlot()
+	}
+	return false
+}
+
+// limitHalfOpenProbes 按 scheduler_half_open_probe_strategy 在多个需要占用探测名额的半开候选中仅保留一个，
+// 其余账号从候选中移除；strategy=all 或半开候选不超过 1 个时原样返回。
+func (s *defaultOpenAIAccountScheduler) limitHalfOpenProbes(filtered []*Account, probes []openAIHalfOpenProbe) []*Account {
+	if len(probes) <= 1 {
+		return filtered
+	}
+	strategy := s.service.openAIWSSchedulerHalfOpenProbeStrategy()
+	if strategy == openAIHalfOpenProbeStrategyAll {
+		return filtered
+	}
+	if strategy == openAIHalfOpenProbeStrategyBestScore {
+		for i := range probes {
+			probes[i].errorRate, probes[i].ttft, probes[i].hasTTFT = s.stats.snapshot(probes[i].account.ID)
+		}
+	}
+	keep := pickOpenAIHalfOpenProbe(probes, strategy)
+	released := make(map[int64]struct{}, len(probes)-1)
+	for _, probe := range probes {
+		if probe.account.ID == keep.account.ID {
+			continue
+		}
+		s.metrics.halfOpenProbeReleasedTotal.Add(1)
+		released[probe.account.ID] = struct{}{}
+	}
+	kept := filtered[:0:0]
+	for _, account := range filtered {
+		if _, drop := released[account.ID]; !drop {
+			kept = append(kept, account)
+		}
+	}
+	return kept
+}
+
+func (s *defaultOpenAIAccountScheduler) ListCircuitBreakers() []CircuitBreakerInfo {
+	if s == nil {
+		return nil
+	}
+	return s.breakers.list()
+}
+
+func (s *defaultOpenAIAccountScheduler) ResetCircuitBreaker(accountID int64) bool {
+	if s == nil {
+		return false
+	}
+	return s.breakers.reset(accountID)
 }
 
 func (s *defaultOpenAIAccountScheduler) ReportSwitch() {
@@ -774,6 +1499,31 @@ func (s *defaultOpenAIAccountScheduler) SnapshotMetrics() OpenAIAccountScheduler
 		SchedulerLatencyMsTotal:  latencyTotal,
 		RuntimeStatsAccountCount: s.stats.size(),
 	}
+	snapshot.ScoringFullTotal = s.metrics.scoringFullTotal.Load()
+	if snapshot.ScoringFullTotal > 0 {
+		snapshot.ScoringFullLatencyUsAvg = float64(s.metrics.scoringFullLatencyUsTotal.Load()) / float64(snapshot.ScoringFullTotal)
+	}
+	snapshot.ScoringPrefilteredTotal = s.metrics.scoringPrefilteredTotal.Load()
+	if snapshot.ScoringPrefilteredTotal > 0 {
+		snapshot.ScoringPrefilteredLatencyUsAvg = float64(s.metrics.scoringPrefilteredLatencyUsTotal.Load()) / float64(snapshot.ScoringPrefilteredTotal)
+	}
+	snapshot.PrefilterDroppedCandidateTotal = s.metrics.prefilterDroppedTotal.Load()
+	snapshot.MinScoreExcludedCandidateTotal = s.metrics.minScoreExcludedTotal.Load()
+	snapshot.HalfOpenProbeReleasedTotal = s.metrics.halfOpenProbeReleasedTotal.Load()
+	if s.breakers != nil {
+		snapshot.CircuitBreakerTripTotal = s.breakers.tripTotal.Load()
+		snapshot.CircuitBreakerManualResetTotal = s.breakers.manualResetTotal.Load()
+		snapshot.CircuitBreakerWarmupExemptTotal = s.breakers.warmupExemptTotal.Load()
+	}
+	if s.canaries != nil {
+		snapshot.CanarySelectTotal = s.canaries.selectTotal.Load()
+		snapshot.CanaryRollbackTotal = s.canaries.rollbackTotal.Load()
+	}
+	if s.service != nil {
+		snapshot.CircuitBreakerAutoDisableTotal = s.service.openaiBreakerEscalation.autoDisableTotal.Load()
+	}
+	snapshot.RuntimeStatsReplicaRebuildTotal = s.statsReplica.rebuildTotal.Load()
+	snapshot.RuntimeStatsReplicaHitTotal = s.statsReplica.hitTotal.Load()
 	if selectTotal > 0 {
 		snapshot.SchedulerLatencyMsAvg = float64(latencyTotal) / float64(selectTotal)
 		snapshot.StickyHitRatio = float64(prevHit+sessionHit) / float64(selectTotal)
@@ -808,6 +1558,10 @@ func (s *OpenAIGatewayService) SelectAccountWithScheduler(
 	requiredTransport OpenAIUpstreamTransport,
 ) (*AccountSelectionResult, OpenAIAccountScheduleDecision, error) {
 	decision := OpenAIAccountScheduleDecision{}
+	if groupID != nil && s.IsGroupPaused(*groupID) {
+		s.openaiGroupPausedTotal.Add(1)
+		return nil, decision, &OpenAIGroupPausedError{GroupID: *groupID}
+	}
 	scheduler := s.getOpenAIAccountScheduler()
 	if scheduler == nil {
 		selection, err := s.SelectAccountWithLoadAwareness(ctx, groupID, sessionHash, requestedModel, excludedIDs)
@@ -815,6 +1569,9 @@ func (s *OpenAIGatewayService) SelectAccountWithScheduler(
 		return selection, decision, err
 	}
 
+	apiKeyID, _ := APIKeyIDFromContext(ctx)
+	clientRegion := ClientRegionFromContext(ctx)
+
 	var stickyAccountID int64
 	if sessionHash != "" && s.cache != nil {
 		if accountID, err := s.getStickySessionAccountID(ctx, groupID, sessionHash); err == nil && accountID > 0 {
@@ -822,7 +1579,7 @@ func (s *OpenAIGatewayService) SelectAccountWithScheduler(
 		}
 	}
 
-	return scheduler.Select(ctx, OpenAIAccountScheduleRequest{
+	req := OpenAIAccountScheduleRequest{
 		GroupID:            groupID,
 		SessionHash:        sessionHash,
 		StickyAccountID:    stickyAccountID,
@@ -830,7 +1587,92 @@ func (s *OpenAIGatewayService) SelectAccountWithScheduler(
 		RequestedModel:     requestedModel,
 		RequiredTransport:  requiredTransport,
 		ExcludedIDs:        excludedIDs,
-	})
+		APIKeyID:           apiKeyID,
+		ClientRegion:       clientRegion,
+	}
+	selection, decision, err := scheduler.Select(ctx, req)
+	if err == nil || ctx.Err() != nil || !s.openAITransportFallbackAllowed(groupID, requiredTransport) {
+		return selection, decision, err
+	}
+
+	// 严格传输无候选：按分组配置降级为任意传输重新选择，并在决策中记录降级。
+	req.RequiredTransport = OpenAIUpstreamTransportAny
+	fallbackSelection, fallbackDecision, fallbackErr := scheduler.Select(ctx, req)
+	if fallbackErr != nil {
+		return fallbackSelection, fallbackDecision, fallbackErr
+	}
+	fallbackDecision.TransportFallback = true
+	s.openaiTransportFallbackTotal.Add(1)
+	if fallbackSelection != nil && fallbackSelection.Account != nil {
+		logger.LegacyPrintf(
+			"service.openai_scheduler",
+			"[OpenAIScheduler] transport fallback: group_id=%d required=%s account_id=%d strict_err=%v",
+			derefGroupID(groupID),
+			requiredTransport,
+			fallbackSelection.Account.ID,
+			err,
+		)
+	}
+	return fallbackSelection, fallbackDecision, nil
+}
+
+// openAITransportFallbackAllowed 判断分组是否允许在要求的传输协议无候选时降级为任意传输。
+func (s *OpenAIGatewayService) openAITransportFallbackAllowed(groupID *int64, requiredTransport OpenAIUpstreamTransport) bool {
+	if s == nil || s.cfg == nil || groupID == nil {
+		return false
+	}
+	if requiredTransport == OpenAIUpstreamTransportAny || requiredTransport == OpenAIUpstreamTransportHTTPSSE {
+		return false
+	}
+	for _, id := range s.openAIWSConfig().SchedulerTransportFallbackGroupIDs {
+		if id == *groupID {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenAIGroupPausedError 分组处于维护暂停期间拒绝新的调度请求；调用方应按可重试错误处理。
+type OpenAIGroupPausedError struct {
+	GroupID int64
+}
+
+func (e *OpenAIGroupPausedError) Error() string {
+	if e == nil {
+		return ""
+	}
+	return fmt.Sprintf("openai group %d scheduling is paused", e.GroupID)
+}
+
+// IsOpenAIGroupPausedError 判断错误是否为分组暂停调度。
+func IsOpenAIGroupPausedError(err error) bool {
+	var pausedErr *OpenAIGroupPausedError
+	return errors.As(err, &pausedErr)
+}
+
+// PauseGroup 暂停分组的新调度（用于整组账号维护），不修改任何账号级状态；进行中的 turn 不受影响。
+func (s *OpenAIGatewayService) PauseGroup(groupID int64) {
+	if s == nil {
+		return
+	}
+	s.openaiPausedGroups.Store(groupID, time.Now())
+}
+
+// ResumeGroup 恢复分组调度。
+func (s *OpenAIGatewayService) ResumeGroup(groupID int64) {
+	if s == nil {
+		return
+	}
+	s.openaiPausedGroups.Delete(groupID)
+}
+
+// IsGroupPaused 返回分组当前是否处于暂停调度状态。
+func (s *OpenAIGatewayService) IsGroupPaused(groupID int64) bool {
+	if s == nil {
+		return false
+	}
+	_, paused := s.openaiPausedGroups.Load(groupID)
+	return paused
 }
 
 func (s *OpenAIGatewayService) ReportOpenAIAccountScheduleResult(accountID int64, success bool, firstTokenMs *int) {
@@ -841,6 +1683,30 @@ func (s *OpenAIGatewayService) ReportOpenAIAccountScheduleResult(accountID int64
 	scheduler.ReportResult(accountID, success, firstTokenMs)
 }
 
+// ReportOpenAIAccountScheduleResultForModel 在账号级统计之外按 (账号, 模型) 记录 TTFT，
+// 避免慢模型（如推理模型）的样本拉低账号在快模型请求上的评分。
+func (s *OpenAIGatewayService) ReportOpenAIAccountScheduleResultForModel(accountID int64, model string, success bool, firstTokenMs *int) {
+	scheduler := s.getOpenAIAccountScheduler()
+	if scheduler == nil {
+		return
+	}
+	scheduler.ReportResult(accountID, success, firstTokenMs)
+	if success {
+		scheduler.ReportModelTTFT(accountID, model, firstTokenMs)
+		scheduler.ReportModelUsage(accountID, model)
+	}
+}
+
+// reportOpenAIAccountPreviousResponseOutcome 记录携带 previous_response_id 的请求在账号上的续链结果，
+// 供调度为续链请求优先选择响应存储可靠的账号。
+func (s *OpenAIGatewayService) reportOpenAIAccountPreviousResponseOutcome(accountID int64, notFound bool) {
+	scheduler := s.getOpenAIAccountScheduler()
+	if scheduler == nil {
+		return
+	}
+	scheduler.ReportPreviousResponseOutcome(accountID, notFound)
+}
+
 func (s *OpenAIGatewayService) RecordOpenAIAccountSwitch() {
 	scheduler := s.getOpenAIAccountScheduler()
 	if scheduler == nil {
@@ -849,53 +1715,259 @@ func (s *OpenAIGatewayService) RecordOpenAIAccountSwitch() {
 	scheduler.ReportSwitch()
 }
 
-func (s *OpenAIGatewayService) SnapshotOpenAIAccountSchedulerMetrics() OpenAIAccountSchedulerMetricsSnapshot {
+// ListCircuitBreakers 返回当前存在熔断记录的账号及其状态，供运维排障。
+func (s *OpenAIGatewayService) ListCircuitBreakers() []CircuitBreakerInfo {
 	scheduler := s.getOpenAIAccountScheduler()
 	if scheduler == nil {
-		return OpenAIAccountSchedulerMetricsSnapshot{}
+		return nil
+	}
+	return scheduler.ListCircuitBreakers()
+}
+
+// ResetCircuitBreaker 将账号熔断器强制恢复为 closed，用于故障解除后立即重新放量。
+func (s *OpenAIGatewayService) ResetCircuitBreaker(accountID int64) bool {
+	scheduler := s.getOpenAIAccountScheduler()
+	if scheduler == nil {
+		return false
 	}
-	return scheduler.SnapshotMetrics()
+	return scheduler.ResetCircuitBreaker(accountID)
+}
+
+func (s *OpenAIGatewayService) SnapshotOpenAIAccountSchedulerMetrics() OpenAIAccountSchedulerMetricsSnapshot {
+	var snapshot OpenAIAccountSchedulerMetricsSnapshot
+	if scheduler := s.getOpenAIAccountScheduler(); scheduler != nil {
+		snapshot = scheduler.SnapshotMetrics()
+	}
+	if s != nil {
+		snapshot.GroupPausedRejectTotal = s.openaiGroupPausedTotal.Load()
+		snapshot.TransportFallbackTotal = s.openaiTransportFallbackTotal.Load()
+		snapshot.StickySessionCapOverflowTotal = s.openaiStickyAccountSessions.overflowTotal.Load()
+		snapshot.StickyTTLSkew = s.openaiStickyTTLSkew.snapshot()
+	}
+	return snapshot
 }
 
 func (s *OpenAIGatewayService) openAIWSSessionStickyTTL() time.Duration {
-	if s != nil && s.cfg != nil && s.cfg.Gateway.OpenAIWS.StickySessionTTLSeconds > 0 {
-		return time.Duration(s.cfg.Gateway.OpenAIWS.StickySessionTTLSeconds) * time.Second
+	if s != nil && s.cfg != nil && s.openAIWSConfig().StickySessionTTLSeconds > 0 {
+		return time.Duration(s.openAIWSConfig().StickySessionTTLSeconds) * time.Second
 	}
 	return openaiStickySessionTTL
 }
 
+func (s *OpenAIGatewayService) openAIAPIKeyStickyWindow() time.Duration {
+	if s != nil && s.cfg != nil && s.openAIWSConfig().APIKeyStickyWindowSeconds > 0 {
+		return time.Duration(s.openAIWSConfig().APIKeyStickyWindowSeconds) * time.Second
+	}
+	return 0
+}
+
+func (s *OpenAIGatewayService) openAICircuitBreakerParams() (openAICircuitBreakerParams, bool) {
+	if s == nil || s.cfg == nil || !s.openAIWSConfig().SchedulerCircuitBreakerEnabled {
+		return openAICircuitBreakerParams{}, false
+	}
+	wsCfg := s.openAIWSConfig()
+	params := openAICircuitBreakerParams{
+		failThreshold: 5,
+		cooldown:      30 * time.Second,
+		halfOpenMax:   2,
+	}
+	if wsCfg.SchedulerCircuitBreakerFailThreshold > 0 {
+		params.failThreshold = wsCfg.SchedulerCircuitBreakerFailThreshold
+	}
+	if wsCfg.SchedulerCircuitBreakerCooldownSeconds > 0 {
+		params.cooldown = time.Duration(wsCfg.SchedulerCircuitBreakerCooldownSeconds) * time.Second
+	}
+	if wsCfg.SchedulerCircuitBreakerHalfOpenMax > 0 {
+		params.halfOpenMax = wsCfg.SchedulerCircuitBreakerHalfOpenMax
+	}
+	if wsCfg.SchedulerCircuitBreakerWarmupSeconds > 0 {
+		params.warmupWindow = time.Duration(wsCfg.SchedulerCircuitBreakerWarmupSeconds) * time.Second
+	}
+	return params, true
+}
+
+// applyOpenAICircuitBreakerGroupOverride 在全局参数上叠加分组覆盖，未配置（0）的字段沿用全局值。
+func applyOpenAICircuitBreakerGroupOverride(params openAICircuitBreakerParams, override config.GatewayOpenAIWSCircuitBreakerGroupOverride) openAICircuitBreakerParams {
+	params.groupID = override.GroupID
+	if override.FailThreshold > 0 {
+		params.failThreshold = override.FailThreshold
+	}
+	if override.CooldownSeconds > 0 {
+		params.cooldown = time.Duration(override.CooldownSeconds) * time.Second
+	}
+	if override.HalfOpenMax > 0 {
+		params.halfOpenMax = override.HalfOpenMax
+	}
+	return params
+}
+
+// openAICircuitBreakerParamsForGroup 返回调度限定在 groupID 时生效的熔断参数：
+// 分组配置了覆盖时返回分组作用域参数，否则返回全局参数。
+func (s *OpenAIGatewayService) openAICircuitBreakerParamsForGroup(groupID *int64) (openAICircuitBreakerParams, bool) {
+	params, enabled := s.openAICircuitBreakerParams()
+	if !enabled || groupID == nil || *groupID <= 0 {
+		return params, enabled
+	}
+	for _, override := range s.openAIWSConfig().SchedulerCircuitBreakerGroupOverrides {
+		if override.GroupID == *groupID {
+			return applyOpenAICircuitBreakerGroupOverride(params, override), true
+		}
+	}
+	return params, true
+}
+
+// openAICircuitBreakerRecordParams 返回账号结果需要写入的全部熔断作用域：全局及每个覆盖分组。
+// 结果上报不携带分组，同一账号的结果会按各作用域的阈值独立计数。
+func (s *OpenAIGatewayService) openAICircuitBreakerRecordParams() []openAICircuitBreakerParams {
+	params, enabled := s.openAICircuitBreakerParams()
+	if !enabled {
+		return nil
+	}
+	overrides := s.openAIWSConfig().SchedulerCircuitBreakerGroupOverrides
+	out := make([]openAICircuitBreakerParams, 0, 1+len(overrides))
+	out = append(out, params)
+	for _, override := range overrides {
+		if override.GroupID > 0 {
+			out = append(out, applyOpenAICircuitBreakerGroupOverride(params, override))
+		}
+	}
+	return out
+}
+
+func (s *OpenAIGatewayService) openAIWSSchedulerHalfOpenProbeStrategy() string {
+	if s == nil || s.cfg == nil {
+		return openAIHalfOpenProbeStrategyAll
+	}
+	switch strings.TrimSpace(s.openAIWSConfig().SchedulerHalfOpenProbeStrategy) {
+	case openAIHalfOpenProbeStrategyClosestRecovery:
+		return openAIHalfOpenProbeStrategyClosestRecovery
+	case openAIHalfOpenProbeStrategyBestScore:
+		return openAIHalfOpenProbeStrategyBestScore
+	default:
+		return openAIHalfOpenProbeStrategyAll
+	}
+}
+
 func (s *OpenAIGatewayService) openAIWSLBTopK() int {
-	if s != nil && s.cfg != nil && s.cfg.Gateway.OpenAIWS.LBTopK > 0 {
-		return s.cfg.Gateway.OpenAIWS.LBTopK
+	if s != nil && s.cfg != nil && s.openAIWSConfig().LBTopK > 0 {
+		return s.openAIWSConfig().LBTopK
 	}
 	return 7
 }
 
+// openAIWSSchedulerCandidatePrefilter 返回候选预筛的触发阈值与保留数量；threshold=0 表示关闭。
+func (s *OpenAIGatewayService) openAIWSSchedulerCandidatePrefilter() (threshold int, size int) {
+	if s == nil || s.cfg == nil || s.openAIWSConfig().SchedulerCandidatePrefilterThreshold <= 0 {
+		return 0, 0
+	}
+	size = s.openAIWSConfig().SchedulerCandidatePrefilterSize
+	if size <= 0 {
+		return 0, 0
+	}
+	return s.openAIWSConfig().SchedulerCandidatePrefilterThreshold, size
+}
+
+func (s *OpenAIGatewayService) openAIWSSchedulerMinScoreThreshold() float64 {
+	if s == nil || s.cfg == nil || s.openAIWSConfig().SchedulerMinScoreThreshold <= 0 {
+		return 0
+	}
+	return s.openAIWSConfig().SchedulerMinScoreThreshold
+}
+
+// filterOpenAICandidatesByMinScore 排除得分低于阈值的候选；全部低于阈值时仅保留得分最高者，保证不会返回空候选。
+func filterOpenAICandidatesByMinScore(candidates []openAIAccountCandidateScore, threshold float64) ([]openAIAccountCandidateScore, int) {
+	if len(candidates) == 0 {
+		return candidates, 0
+	}
+	kept := candidates[:0:0]
+	best := 0
+	for i := range candidates {
+		if candidates[i].score >= threshold {
+			kept = append(kept, candidates[i])
+		}
+		if candidates[i].score > candidates[best].score {
+			best = i
+		}
+	}
+	if len(kept) == 0 {
+		kept = append(kept, candidates[best])
+	}
+	return kept, len(candidates) - len(kept)
+}
+
 func (s *OpenAIGatewayService) openAIWSSchedulerWeights() GatewayOpenAIWSSchedulerScoreWeightsView {
 	if s != nil && s.cfg != nil {
+		weights := s.openAIWSConfig().SchedulerScoreWeights
 		return GatewayOpenAIWSSchedulerScoreWeightsView{
-			Priority:  s.cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Priority,
-			Load:      s.cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Load,
-			Queue:     s.cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Queue,
-			ErrorRate: s.cfg.Gateway.OpenAIWS.SchedulerScoreWeights.ErrorRate,
-			TTFT:      s.cfg.Gateway.OpenAIWS.SchedulerScoreWeights.TTFT,
+			Priority:     weights.Priority,
+			Load:         weights.Load,
+			Queue:        weights.Queue,
+			ErrorRate:    weights.ErrorRate,
+			TTFT:         weights.TTFT,
+			PrevNotFound: weights.PrevNotFound,
+			Region:       weights.Region,
 		}
 	}
 	return GatewayOpenAIWSSchedulerScoreWeightsView{
-		Priority:  1.0,
-		Load:      1.0,
-		Queue:     0.7,
-		ErrorRate: 0.8,
-		TTFT:      0.5,
+		Priority:     1.0,
+		Load:         1.0,
+		Queue:        0.7,
+		ErrorRate:    0.8,
+		TTFT:         0.5,
+		PrevNotFound: 0.6,
+		Region:       1.0,
+	}
+}
+
+const (
+	openAIWSSchedulerZeroConcurrencyUnbounded = "unbounded"
+	openAIWSSchedulerZeroConcurrencyAssumed   = "assumed"
+)
+
+// openAIWSSchedulerAssumedConcurrency 返回未配置并发（Concurrency<=0）账号的假定并发；0 表示按不限并发处理。
+func (s *OpenAIGatewayService) openAIWSSchedulerAssumedConcurrency() int {
+	if s == nil || s.cfg == nil {
+		return 0
+	}
+	if strings.TrimSpace(s.openAIWSConfig().SchedulerZeroConcurrencyMode) != openAIWSSchedulerZeroConcurrencyAssumed {
+		return 0
+	}
+	if s.openAIWSConfig().SchedulerAssumedConcurrency > 0 {
+		return s.openAIWSConfig().SchedulerAssumedConcurrency
+	}
+	return 0
+}
+
+// openAIWSSchedulerAccountConcurrency 返回调度用于槽位获取/等待计划的并发上限。
+// assumed 模式下未配置并发的账号按假定并发占用槽位，否则负载不可观测、打分退化为容量无感。
+func (s *OpenAIGatewayService) openAIWSSchedulerAccountConcurrency(account *Account) int {
+	if account == nil {
+		return 0
+	}
+	if account.Concurrency > 0 {
+		return account.Concurrency
+	}
+	return s.openAIWSSchedulerAssumedConcurrency()
+}
+
+// openAIWSSchedulerLoadFactor 返回负载率计算使用的容量，优先级：LoadFactor > Concurrency > 假定并发 > 1。
+func (s *OpenAIGatewayService) openAIWSSchedulerLoadFactor(account *Account) int {
+	if account != nil && (account.LoadFactor == nil || *account.LoadFactor <= 0) && account.Concurrency <= 0 {
+		if assumed := s.openAIWSSchedulerAssumedConcurrency(); assumed > 0 {
+			return assumed
+		}
 	}
+	return account.EffectiveLoadFactor()
 }
 
 type GatewayOpenAIWSSchedulerScoreWeightsView struct {
-	Priority  float64
-	Load      float64
-	Queue     float64
-	ErrorRate float64
-	TTFT      float64
+	Priority     float64
+	Load         float64
+	Queue        float64
+	ErrorRate    float64
+	TTFT         float64
+	PrevNotFound float64
+	Region       float64
 }
 
 func clamp01(value float64) float64 {
@@ -1,8 +1,11 @@
 package service
 
 import (
+	"context"
 	"sort"
 	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
 )
 
 func buildOpenAISchedulerBenchmarkCandidates(size int) []openAIAccountCandidateScore {
@@ -81,3 +84,86 @@ func BenchmarkOpenAIAccountSchedulerSelectTopK(b *testing.B) {
 		})
 	}
 }
+
+func BenchmarkOpenAIAccountSchedulerSelectByLoadBalancePrefilter(b *testing.B) {
+	accounts := make([]Account, 0, 512)
+	for i := 0; i < 512; i++ {
+		accounts = append(accounts, Account{
+			ID:          int64(20_000 + i),
+			Platform:    PlatformOpenAI,
+			Type:        AccountTypeAPIKey,
+			Status:      StatusActive,
+			Schedulable: true,
+			Concurrency: 4,
+			Priority:    i % 4,
+		})
+	}
+	groupID := int64(1)
+	cases := []struct {
+		name      string
+		threshold int
+	}{
+		{name: "n_512/full", threshold: 0},
+		{name: "n_512/prefilter_32", threshold: 64},
+	}
+	for _, tc := range cases {
+		cfg := &config.Config{}
+		cfg.Gateway.OpenAIWS.LBTopK = 7
+		cfg.Gateway.OpenAIWS.SchedulerCandidatePrefilterThreshold = tc.threshold
+		cfg.Gateway.OpenAIWS.SchedulerCandidatePrefilterSize = 32
+		svc := &OpenAIGatewayService{
+			accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+			cache:              &stubGatewayCache{},
+			cfg:                cfg,
+			concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+		}
+		scheduler := newDefaultOpenAIAccountScheduler(svc, nil).(*defaultOpenAIAccountScheduler)
+		req := OpenAIAccountScheduleRequest{GroupID: &groupID, RequestedModel: "gpt-5.1"}
+		b.Run(tc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				selection, _, _, _, _, _, err := scheduler.selectByLoadBalance(context.Background(), req)
+				if err != nil || selection == nil {
+					b.Fatal("unexpected empty selection")
+				}
+				if selection.ReleaseFunc != nil {
+					selection.ReleaseFunc()
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkOpenAIAccountRuntimeStatsReport 对比高并发下逐条上报与批量上报在少量热点账号上的争用。
+func BenchmarkOpenAIAccountRuntimeStatsReport(b *testing.B) {
+	const hotAccounts = 4
+	b.Run("per_result", func(b *testing.B) {
+		stats := newOpenAIAccountRuntimeStats()
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			ttft := 120
+			i := 0
+			for pb.Next() {
+				stats.report(int64(1+i%hotAccounts), i%10 != 0, &ttft)
+				i++
+			}
+		})
+	})
+	b.Run("batched", func(b *testing.B) {
+		stats := newOpenAIAccountRuntimeStats()
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			pending := make([]OpenAIAccountScheduleResult, 0, openAIAccountScheduleResultBatchMaxPending)
+			i := 0
+			for pb.Next() {
+				pending = append(pending, OpenAIAccountScheduleResult{AccountID: int64(1 + i%hotAccounts), Success: i%10 != 0, FirstTokenMs: 120})
+				if len(pending) == cap(pending) {
+					stats.reportBatch(pending)
+					pending = pending[:0]
+				}
+				i++
+			}
+			stats.reportBatch(pending)
+		})
+	})
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+)
+
+const (
+	openAIAccountScheduleEventBufferDefault = 1024
+	openAIAccountScheduleEventDropLogEvery  = 5 * time.Second
+)
+
+// OpenAIAccountScheduleEvent 单次调度决策的原始记录，供离线分析路由质量。
+// SessionHashDigest 为 session hash 的摘要，不输出原值；Score 仅负载均衡层有值。
+type OpenAIAccountScheduleEvent struct {
+	Timestamp         time.Time `json:"timestamp"`
+	GroupID           int64     `json:"group_id"`
+	SessionHashDigest string    `json:"session_hash_digest,omitempty"`
+	AccountID         int64     `json:"account_id"`
+	AccountType       string    `json:"account_type,omitempty"`
+	Layer             string    `json:"layer"`
+	CandidateCount    int       `json:"candidate_count"`
+	TotalEligible     int       `json:"total_eligible"`
+	TopK              int       `json:"top_k"`
+	Score             float64   `json:"score"`
+	LatencyMs         int64     `json:"latency_ms"`
+	Error             string    `json:"error,omitempty"`
+}
+
+// OpenAIAccountScheduleEventSink 接收调度决策事件。
+// 由单个后台 goroutine 串行调用，实现无需考虑并发，但不应长时间阻塞（阻塞期间新事件会因缓冲满被丢弃）。
+type OpenAIAccountScheduleEventSink interface {
+	HandleOpenAIAccountScheduleEvent(event OpenAIAccountScheduleEvent)
+}
+
+// OpenAIAccountScheduleEventSinkFunc 函数适配器。
+type OpenAIAccountScheduleEventSinkFunc func(event OpenAIAccountScheduleEvent)
+
+func (f OpenAIAccountScheduleEventSinkFunc) HandleOpenAIAccountScheduleEvent(event OpenAIAccountScheduleEvent) {
+	f(event)
+}
+
+// OpenAIAccountScheduleEventStats 调度决策事件投递统计。
+type OpenAIAccountScheduleEventStats struct {
+	EnqueuedTotal   int64 `json:"enqueued_total"`
+	DeliveredTotal  int64 `json:"delivered_total"`
+	DroppedTotal    int64 `json:"dropped_total"`
+	SampledOutTotal int64 `json:"sampled_out_total"`
+}
+
+// openAIAccountScheduleEventDispatcher 以有界缓冲异步投递调度事件：
+// 入队永不阻塞调度路径，缓冲满时直接丢弃并计数。
+type openAIAccountScheduleEventDispatcher struct {
+	sink       OpenAIAccountScheduleEventSink
+	sampleRate float64
+	ch         chan OpenAIAccountScheduleEvent
+	done       chan struct{}
+	stopOnce   sync.Once
+	stopped    atomic.Bool
+	mu         sync.RWMutex
+
+	enqueued   atomic.Int64
+	delivered  atomic.Int64
+	dropped    atomic.Int64
+	sampledOut atomic.Int64
+	lastDropAt atomic.Int64
+}
+
+func newOpenAIAccountScheduleEventDispatcher(sink OpenAIAccountScheduleEventSink, bufferSize int, sampleRate float64) *openAIAccountScheduleEventDispatcher {
+	if bufferSize <= 0 {
+		bufferSize = openAIAccountScheduleEventBufferDefault
+	}
+	d := &openAIAccountScheduleEventDispatcher{
+		sink:       sink,
+		sampleRate: clamp01(sampleRate),
+		ch:         make(chan OpenAIAccountScheduleEvent, bufferSize),
+		done:       make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+func (d *openAIAccountScheduleEventDispatcher) run() {
+	defer close(d.done)
+	for event := range d.ch {
+		d.deliver(event)
+	}
+}
+
+func (d *openAIAccountScheduleEventDispatcher) deliver(event OpenAIAccountScheduleEvent) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			logger.LegacyPrintf("service.openai_scheduler", "[OpenAIScheduler] decision event sink panic: %v", recovered)
+		}
+	}()
+	d.sink.HandleOpenAIAccountScheduleEvent(event)
+	d.delivered.Add(1)
+}
+
+func (d *openAIAccountScheduleEventDispatcher) emit(event OpenAIAccountScheduleEvent) {
+	if d == nil {
+		return
+	}
+	if d.sampleRate < 1 && (d.sampleRate <= 0 || rand.Float64() >= d.sampleRate) {
+		d.sampledOut.Add(1)
+		return
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.stopped.Load() {
+		return
+	}
+	select {
+	case d.ch <- event:
+		d.enqueued.Add(1)
+	default:
+		d.recordDrop()
+	}
+}
+
+// recordDrop 计数丢弃事件，并节流输出告警日志。
+func (d *openAIAccountScheduleEventDispatcher) recordDrop() {
+	dropped := d.dropped.Add(1)
+	now := time.Now().UnixNano()
+	last := d.lastDropAt.Load()
+	if now-last < int64(openAIAccountScheduleEventDropLogEvery) || !d.lastDropAt.CompareAndSwap(last, now) {
+		return
+	}
+	logger.LegacyPrintf("service.openai_scheduler", "[OpenAIScheduler] decision event buffer full, dropped_total=%d", dropped)
+}
+
+// stop 关闭缓冲并等待已入队事件投递完成。
+func (d *openAIAccountScheduleEventDispatcher) stop() {
+	if d == nil {
+		return
+	}
+	d.stopOnce.Do(func() {
+		d.mu.Lock()
+		d.stopped.Store(true)
+		close(d.ch)
+		d.mu.Unlock()
+		<-d.done
+	})
+}
+
+func (d *openAIAccountScheduleEventDispatcher) stats() OpenAIAccountScheduleEventStats {
+	if d == nil {
+		return OpenAIAccountScheduleEventStats{}
+	}
+	return OpenAIAccountScheduleEventStats{
+		EnqueuedTotal:   d.enqueued.Load(),
+		DeliveredTotal:  d.delivered.Load(),
+		DroppedTotal:    d.dropped.Load(),
+		SampledOutTotal: d.sampledOut.Load(),
+	}
+}
+
+// SetOpenAIAccountScheduleEventSink 注册调度决策事件 sink；传入 nil 关闭事件流。
+// 替换或关闭时会等待旧 sink 处理完已入队事件，应用退出前应传入 nil 以完成投递。
+func (s *OpenAIGatewayService) SetOpenAIAccountScheduleEventSink(sink OpenAIAccountScheduleEventSink) {
+	if s == nil {
+		return
+	}
+	var next *openAIAccountScheduleEventDispatcher
+	if sink != nil {
+		bufferSize := openAIAccountScheduleEventBufferDefault
+		sampleRate := 1.0
+		if s.cfg != nil {
+			bufferSize = s.cfg.Gateway.OpenAIWS.SchedulerDecisionEventBufferSize
+			sampleRate = s.cfg.Gateway.OpenAIWS.SchedulerDecisionEventSampleRate
+		}
+		next = newOpenAIAccountScheduleEventDispatcher(sink, bufferSize, sampleRate)
+	}
+	if prev := s.openaiScheduleEvents.Swap(next); prev != nil {
+		prev.stop()
+	}
+}
+
+// SnapshotOpenAIAccountScheduleEventStats 返回当前 sink 的投递统计；未注册 sink 时为零值。
+func (s *OpenAIGatewayService) SnapshotOpenAIAccountScheduleEventStats() OpenAIAccountScheduleEventStats {
+	if s == nil {
+		return OpenAIAccountScheduleEventStats{}
+	}
+	return s.openaiScheduleEvents.Load().stats()
+}
+
+func (s *OpenAIGatewayService) emitOpenAIAccountScheduleEvent(req OpenAIAccountScheduleRequest, decision OpenAIAccountScheduleDecision, selectErr error) {
+	if s == nil {
+		return
+	}
+	dispatcher := s.openaiScheduleEvents.Load()
+	if dispatcher == nil {
+		return
+	}
+	event := OpenAIAccountScheduleEvent{
+		Timestamp:         time.Now(),
+		SessionHashDigest: hashSensitiveValueForLog(req.SessionHash),
+		AccountID:         decision.SelectedAccountID,
+		AccountType:       decision.SelectedAccountType,
+		Layer:             decision.Layer,
+		CandidateCount:    decision.CandidateCount,
+		TotalEligible:     decision.TotalEligible,
+		TopK:              decision.TopK,
+		Score:             decision.SelectedScore,
+		LatencyMs:         decision.LatencyMs,
+	}
+	if req.GroupID != nil {
+		event.GroupID = *req.GroupID
+	}
+	if selectErr != nil {
+		event.Error = selectErr.Error()
+	}
+	dispatcher.emit(event)
+}
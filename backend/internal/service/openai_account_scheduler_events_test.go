@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIGatewayService_ScheduleEventSinkReceivesDecisions(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(23)
+	accounts := []Account{
+		{ID: 5901, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 1, Priority: 0},
+		{ID: 5902, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 1, Priority: 1},
+	}
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.LBTopK = 1
+	cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Priority = 1
+	cfg.Gateway.OpenAIWS.SchedulerDecisionEventBufferSize = 8
+	cfg.Gateway.OpenAIWS.SchedulerDecisionEventSampleRate = 1
+	svc := &OpenAIGatewayService{
+		accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+		cache:              &stubGatewayCache{},
+		cfg:                cfg,
+		concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+	}
+	events := make(chan OpenAIAccountScheduleEvent, 4)
+	svc.SetOpenAIAccountScheduleEventSink(OpenAIAccountScheduleEventSinkFunc(func(event OpenAIAccountScheduleEvent) {
+		events <- event
+	}))
+	defer svc.SetOpenAIAccountScheduleEventSink(nil)
+
+	selection, _, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "session_hash_events", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+	require.NoError(t, err)
+	require.NotNil(t, selection)
+	if selection.ReleaseFunc != nil {
+		selection.ReleaseFunc()
+	}
+
+	select {
+	case event := <-events:
+		require.Equal(t, int64(23), event.GroupID)
+		require.Equal(t, int64(5901), event.AccountID)
+		require.Equal(t, openAIAccountScheduleLayerLoadBalance, event.Layer)
+		require.Equal(t, 2, event.CandidateCount)
+		require.Greater(t, event.Score, 0.0)
+		require.NotEmpty(t, event.SessionHashDigest)
+		require.NotContains(t, event.SessionHashDigest, "session_hash_events", "session hash 只能以摘要形式输出")
+		require.False(t, event.Timestamp.IsZero())
+	case <-time.After(2 * time.Second):
+		t.Fatal("未收到调度决策事件")
+	}
+	require.Eventually(t, func() bool {
+		return svc.SnapshotOpenAIAccountScheduleEventStats().DeliveredTotal == 1
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestOpenAIAccountScheduleEventDispatcher_DropsOnOverflowAndSamples(t *testing.T) {
+	received := make(chan struct{}, 4)
+	release := make(chan struct{})
+	dispatcher := newOpenAIAccountScheduleEventDispatcher(OpenAIAccountScheduleEventSinkFunc(func(OpenAIAccountScheduleEvent) {
+		received <- struct{}{}
+		<-release
+	}), 1, 1)
+
+	dispatcher.emit(OpenAIAccountScheduleEvent{AccountID: 1})
+	select {
+	case <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("sink 未收到首个事件")
+	}
+	// sink 阻塞期间：第二个事件进入缓冲，第三个因缓冲满被丢弃，emit 不应阻塞。
+	dispatcher.emit(OpenAIAccountScheduleEvent{AccountID: 2})
+	dispatcher.emit(OpenAIAccountScheduleEvent{AccountID: 3})
+	stats := dispatcher.stats()
+	require.Equal(t, int64(2), stats.EnqueuedTotal)
+	require.Equal(t, int64(1), stats.DroppedTotal)
+
+	close(release)
+	dispatcher.stop()
+	require.Equal(t, int64(2), dispatcher.stats().DeliveredTotal)
+	dispatcher.emit(OpenAIAccountScheduleEvent{AccountID: 4})
+	require.Equal(t, int64(2), dispatcher.stats().EnqueuedTotal, "停止后不再接收事件")
+
+	sampled := newOpenAIAccountScheduleEventDispatcher(OpenAIAccountScheduleEventSinkFunc(func(OpenAIAccountScheduleEvent) {}), 4, 0)
+	defer sampled.stop()
+	sampled.emit(OpenAIAccountScheduleEvent{AccountID: 5})
+	require.Equal(t, int64(1), sampled.stats().SampledOutTotal)
+	require.Zero(t, sampled.stats().EnqueuedTotal)
+}
@@ -138,6 +138,60 @@ func TestOpenAIGatewayService_SelectAccountWithScheduler_PreviousResponseSticky(
 	}
 }
 
+func TestOpenAIGatewayService_SelectAccountWithScheduler_BranchFollowUpResolvesSessionAnchor(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(21)
+	wsExtra := map[string]any{"openai_apikey_responses_websockets_v2_enabled": true}
+	accounts := []Account{
+		{ID: 5601, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 2, Extra: wsExtra},
+		{ID: 5602, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 2, Extra: wsExtra},
+	}
+	cache := &stubGatewayCache{}
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.Enabled = true
+	cfg.Gateway.OpenAIWS.OAuthEnabled = true
+	cfg.Gateway.OpenAIWS.APIKeyEnabled = true
+	cfg.Gateway.OpenAIWS.ResponsesWebsocketsV2 = true
+	cfg.Gateway.OpenAIWS.StickySessionTTLSeconds = 1800
+	cfg.Gateway.OpenAIWS.StickyResponseIDTTLSeconds = 3600
+
+	svc := &OpenAIGatewayService{
+		accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+		cache:              cache,
+		cfg:                cfg,
+		concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+	}
+
+	// 会话先在 5601 上产生 parent，随后切到 5602 产生后续 response；会话粘连指向 5602。
+	store := svc.getOpenAIWSStateStore()
+	store.BindSessionResponseAnchor(groupID, "session_branch", "resp_parent", 5601, time.Hour)
+	store.BindSessionResponseAnchor(groupID, "session_branch", "resp_latest", 5602, time.Hour)
+	require.NoError(t, store.BindResponseAccount(ctx, groupID, "resp_latest", 5602, time.Hour))
+	require.NoError(t, svc.BindStickySession(ctx, &groupID, "session_branch", 5602))
+
+	selectFor := func(previousResponseID string) (int64, OpenAIAccountScheduleDecision) {
+		selection, decision, err := svc.SelectAccountWithScheduler(ctx, &groupID, previousResponseID, "session_branch", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.NotNil(t, selection)
+		require.NotNil(t, selection.Account)
+		if selection.ReleaseFunc != nil {
+			selection.ReleaseFunc()
+		}
+		return selection.Account.ID, decision
+	}
+
+	// 分支一：从较早的 parent 分叉，全局 response 绑定已失效，仍应经会话锚点命中 5601。
+	accountID, decision := selectFor("resp_parent")
+	require.Equal(t, int64(5601), accountID, "分支续链应路由到产生 parent 的账号，避免跨账号 previous_response_not_found")
+	require.Equal(t, openAIAccountScheduleLayerPreviousResponse, decision.Layer)
+	require.True(t, decision.StickyPreviousHit)
+
+	// 分支二：基于最新 response 继续，命中 5602。
+	accountID, decision = selectFor("resp_latest")
+	require.Equal(t, int64(5602), accountID)
+	require.Equal(t, openAIAccountScheduleLayerPreviousResponse, decision.Layer)
+}
+
 func TestOpenAIGatewayService_SelectAccountWithScheduler_SessionSticky(t *testing.T) {
 	ctx := context.Background()
 	groupID := int64(10)
@@ -182,6 +236,193 @@ func TestOpenAIGatewayService_SelectAccountWithScheduler_SessionSticky(t *testin
 	}
 }
 
+func TestOpenAIGatewayService_SelectAccountWithScheduler_SessionStickyMaxConsecutiveTurns(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(24)
+	accounts := []Account{
+		{ID: 6001, Platform: PlatformOpenAI, Type: AccountTypeOAuth, Status: StatusActive, Schedulable: true, Concurrency: 4},
+		{
+			ID: 6002, Platform: PlatformOpenAI, Type: AccountTypeOAuth, Status: StatusActive, Schedulable: true, Concurrency: 4,
+			Extra: map[string]any{"openai_max_consecutive_sticky_turns": 1},
+		},
+	}
+	cache := &stubGatewayCache{
+		sessionBindings: map[string]int64{
+			"openai:session_hash_sticky_cap": 6001,
+		},
+	}
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.LBTopK = 1
+	cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Load = 1.0
+	cfg.Gateway.OpenAIWS.SchedulerMaxConsecutiveStickyTurns = 2
+	concurrencyCache := stubConcurrencyCache{
+		loadMap: map[int64]*AccountLoadInfo{
+			6001: {AccountID: 6001, LoadRate: 90},
+			6002: {AccountID: 6002, LoadRate: 0},
+		},
+	}
+	svc := &OpenAIGatewayService{
+		accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+		cache:              cache,
+		cfg:                cfg,
+		concurrencyService: NewConcurrencyService(concurrencyCache),
+	}
+
+	selectOnce := func() (int64, OpenAIAccountScheduleDecision) {
+		selection, decision, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "session_hash_sticky_cap", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.NotNil(t, selection)
+		require.NotNil(t, selection.Account)
+		if selection.ReleaseFunc != nil {
+			selection.ReleaseFunc()
+		}
+		return selection.Account.ID, decision
+	}
+
+	// 全局上限 2：前两轮命中粘连，第三轮强制重新评估并切到低负载账号。
+	for i := 0; i < 2; i++ {
+		accountID, decision := selectOnce()
+		require.Equal(t, int64(6001), accountID)
+		require.Equal(t, openAIAccountScheduleLayerSessionSticky, decision.Layer)
+		require.False(t, decision.StickyReevaluated)
+	}
+	accountID, decision := selectOnce()
+	require.Equal(t, int64(6002), accountID)
+	require.Equal(t, openAIAccountScheduleLayerLoadBalance, decision.Layer)
+	require.True(t, decision.StickyReevaluated)
+	require.Equal(t, int64(6002), cache.sessionBindings["openai:session_hash_sticky_cap"])
+
+	// 账号级覆盖为 1：每命中一轮粘连即重新评估一次。
+	accountID, decision = selectOnce()
+	require.Equal(t, int64(6002), accountID)
+	require.Equal(t, openAIAccountScheduleLayerSessionSticky, decision.Layer)
+	accountID, decision = selectOnce()
+	require.Equal(t, int64(6002), accountID)
+	require.Equal(t, openAIAccountScheduleLayerLoadBalance, decision.Layer)
+	require.True(t, decision.StickyReevaluated)
+}
+
+func TestDefaultOpenAIAccountScheduler_StickyTurnsEvictExpiredSessions(t *testing.T) {
+	svc := &OpenAIGatewayService{cfg: &config.Config{}}
+	scheduler, ok := newDefaultOpenAIAccountScheduler(svc, nil).(*defaultOpenAIAccountScheduler)
+	require.True(t, ok)
+	groupID := int64(25)
+	for i := 0; i < 50; i++ {
+		scheduler.recordStickyTurn(OpenAIAccountScheduleRequest{GroupID: &groupID, SessionHash: fmt.Sprintf("gone_session_%d", i)}, 6011)
+	}
+	require.Equal(t, 50, scheduler.stickyTurns.len())
+
+	// 会话消失后不会再被查询或 reset；粘连 TTL 过后的下一次写入应清理掉全部过期记录。
+	later := time.Now().Add(svc.openAIWSSessionStickyTTL() + openAITTLMapSweepInterval)
+	scheduler.stickyTurns.store(openAIStickyTurnKey{groupID: groupID, sessionHash: "live_session"}, openAIStickyTurnEntry{accountID: 6011, turns: 1, boundAt: later}, later.Add(time.Minute), later)
+	require.Equal(t, 1, scheduler.stickyTurns.len())
+}
+
+func TestOpenAIGatewayService_SelectAccountWithScheduler_SessionStickyMaxLifetime(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(25)
+	accounts := []Account{
+		{ID: 6101, Platform: PlatformOpenAI, Type: AccountTypeOAuth, Status: StatusActive, Schedulable: true, Concurrency: 4},
+		{ID: 6102, Platform: PlatformOpenAI, Type: AccountTypeOAuth, Status: StatusActive, Schedulable: true, Concurrency: 4},
+	}
+	cache := &stubGatewayCache{
+		sessionBindings: map[string]int64{
+			"openai:session_hash_sticky_lifetime": 6101,
+		},
+	}
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.LBTopK = 1
+	cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Load = 1.0
+	cfg.Gateway.OpenAIWS.SchedulerMaxStickyLifetimeSeconds = 60
+	concurrencyCache := stubConcurrencyCache{
+		loadMap: map[int64]*AccountLoadInfo{
+			6101: {AccountID: 6101, LoadRate: 10},
+			6102: {AccountID: 6102, LoadRate: 50},
+		},
+	}
+	svc := &OpenAIGatewayService{
+		accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+		cache:              cache,
+		cfg:                cfg,
+		concurrencyService: NewConcurrencyService(concurrencyCache),
+	}
+	scheduler, ok := svc.getOpenAIAccountScheduler().(*defaultOpenAIAccountScheduler)
+	require.True(t, ok)
+	stickyKey := openAIStickyTurnKey{groupID: groupID, sessionHash: "session_hash_sticky_lifetime"}
+	expireLifetime := func() {
+		now := time.Now()
+		entry, ok := scheduler.stickyTurns.load(stickyKey, now)
+		require.True(t, ok)
+		entry.boundAt = now.Add(-2 * time.Minute)
+		scheduler.stickyTurns.store(stickyKey, entry, now.Add(time.Hour), now)
+	}
+
+	selectOnce := func() (int64, OpenAIAccountScheduleDecision) {
+		selection, decision, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "session_hash_sticky_lifetime", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.NotNil(t, selection)
+		require.NotNil(t, selection.Account)
+		if selection.ReleaseFunc != nil {
+			selection.ReleaseFunc()
+		}
+		return selection.Account.ID, decision
+	}
+
+	// 未超时：连续命中粘连。
+	for i := 0; i < 3; i++ {
+		accountID, decision := selectOnce()
+		require.Equal(t, int64(6101), accountID)
+		require.Equal(t, openAIAccountScheduleLayerSessionSticky, decision.Layer)
+	}
+
+	// 超时后重新评估：负载均衡仍选回原账号，保留绑定并重新计时。
+	expireLifetime()
+	accountID, decision := selectOnce()
+	require.Equal(t, int64(6101), accountID)
+	require.Equal(t, openAIAccountScheduleLayerLoadBalance, decision.Layer)
+	require.True(t, decision.StickyReevaluated)
+	require.Equal(t, int64(6101), cache.sessionBindings["openai:session_hash_sticky_lifetime"])
+	accountID, decision = selectOnce()
+	require.Equal(t, int64(6101), accountID)
+	require.Equal(t, openAIAccountScheduleLayerSessionSticky, decision.Layer)
+
+	// 负载反转后再次超时：切换到低负载账号并改写绑定。
+	concurrencyCache.loadMap[6101].LoadRate = 90
+	expireLifetime()
+	accountID, decision = selectOnce()
+	require.Equal(t, int64(6102), accountID)
+	require.Equal(t, openAIAccountScheduleLayerLoadBalance, decision.Layer)
+	require.True(t, decision.StickyReevaluated)
+	require.Equal(t, int64(6102), cache.sessionBindings["openai:session_hash_sticky_lifetime"])
+
+	// 账号级覆盖优先于全局配置。
+	accounts[1].Extra = map[string]any{"openai_max_sticky_lifetime_seconds": 3600}
+	require.Equal(t, time.Hour, scheduler.maxStickyLifetime(&accounts[1]))
+	require.Equal(t, time.Minute, scheduler.maxStickyLifetime(&accounts[0]))
+}
+
+func TestDefaultOpenAIAccountScheduler_StickyLifetimeRecordSweptWithSessionTTL(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.SchedulerMaxStickyLifetimeSeconds = 60
+	svc := &OpenAIGatewayService{cfg: cfg}
+	scheduler, ok := newDefaultOpenAIAccountScheduler(svc, nil).(*defaultOpenAIAccountScheduler)
+	require.True(t, ok)
+	groupID := int64(26)
+	account := &Account{ID: 6111, Platform: PlatformOpenAI}
+	req := OpenAIAccountScheduleRequest{GroupID: &groupID, SessionHash: "session_hash_lifetime_swept"}
+	key := openAIStickyTurnKeyFor(req)
+
+	now := time.Now()
+	scheduler.stickyTurns.store(key, openAIStickyTurnEntry{accountID: account.ID, turns: 3, boundAt: now.Add(-2 * time.Minute)}, now.Add(svc.openAIWSSessionStickyTTL()), now)
+	require.True(t, scheduler.stickyBindingNeedsReevaluation(req, account))
+
+	// 会话空闲超过粘连 TTL 后，记录由其他会话的写入触发的周期清理删除，而不是等同一会话再次读取。
+	later := now.Add(svc.openAIWSSessionStickyTTL() + openAITTLMapSweepInterval)
+	scheduler.stickyTurns.store(openAIStickyTurnKey{groupID: groupID, sessionHash: "other_session"}, openAIStickyTurnEntry{accountID: account.ID, turns: 1, boundAt: later}, later.Add(time.Minute), later)
+	require.Equal(t, 1, scheduler.stickyTurns.len())
+	require.False(t, scheduler.stickyBindingNeedsReevaluation(req, account), "记录清理后粘连持续时间应重新计时")
+}
+
 func TestOpenAIGatewayService_SelectAccountWithScheduler_SessionStickyBusyKeepsSticky(t *testing.T) {
 	ctx := context.Background()
 	groupID := int64(10100)
@@ -550,6 +791,44 @@ func TestOpenAIAccountRuntimeStats_ReportAndSnapshot(t *testing.T) {
 	require.Equal(t, 1, stats.size())
 }
 
+func TestDefaultOpenAIAccountScheduler_ReportResult_CustomEWMAAlphas(t *testing.T) {
+	// 连续失败后恢复：alpha 越大，错误率回落越快，TTFT 越快贴近新样本。
+	converge := func(errorRateAlpha, ttftAlpha float64) (float64, float64) {
+		cfg := &config.Config{}
+		cfg.Gateway.OpenAIWS.SchedulerErrorRateEWMAAlpha = errorRateAlpha
+		cfg.Gateway.OpenAIWS.SchedulerTTFTEWMAAlpha = ttftAlpha
+		stats := newOpenAIAccountRuntimeStats()
+		scheduler := newDefaultOpenAIAccountScheduler(&OpenAIGatewayService{cfg: cfg}, stats)
+		slow := 1000
+		for i := 0; i < 5; i++ {
+			scheduler.ReportResult(1001, false, &slow)
+		}
+		fast := 100
+		for i := 0; i < 3; i++ {
+			scheduler.ReportResult(1001, true, &fast)
+		}
+		errorRate, ttft, hasTTFT := stats.snapshot(1001)
+		require.True(t, hasTTFT)
+		return errorRate, ttft
+	}
+
+	defaultErrorRate, defaultTTFT := converge(0.2, 0.2)
+	require.InDelta(t, (1-math.Pow(0.8, 5))*math.Pow(0.8, 3), defaultErrorRate, 1e-9)
+	responsiveErrorRate, responsiveTTFT := converge(0.6, 0.6)
+	require.InDelta(t, (1-math.Pow(0.4, 5))*math.Pow(0.4, 3), responsiveErrorRate, 1e-9)
+	require.InDelta(t, 100+900*math.Pow(0.4, 3), responsiveTTFT, 1e-9)
+	require.Less(t, responsiveErrorRate, defaultErrorRate)
+	require.Less(t, responsiveTTFT, defaultTTFT)
+
+	// 错误率与 TTFT 系数相互独立；非法值回退默认系数。
+	errorRate, ttft := converge(0.6, 0.2)
+	require.InDelta(t, responsiveErrorRate, errorRate, 1e-9)
+	require.InDelta(t, defaultTTFT, ttft, 1e-9)
+	errorRate, ttft = converge(0, 1.5)
+	require.InDelta(t, defaultErrorRate, errorRate, 1e-9)
+	require.InDelta(t, defaultTTFT, ttft, 1e-9)
+}
+
 func TestOpenAIAccountRuntimeStats_ReportConcurrent(t *testing.T) {
 	stats := newOpenAIAccountRuntimeStats()
 
@@ -584,6 +863,103 @@ func TestOpenAIAccountRuntimeStats_ReportConcurrent(t *testing.T) {
 	}
 }
 
+func TestOpenAIGatewayService_SelectAccountWithScheduler_SlowModelBurstDoesNotPenalizeFastModelTTFT(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(19)
+	accounts := []Account{
+		{ID: 5401, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3},
+		{ID: 5402, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3},
+	}
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.LBTopK = 1
+	cfg.Gateway.OpenAIWS.SchedulerScoreWeights.TTFT = 1
+
+	svc := &OpenAIGatewayService{
+		accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+		cache:              &stubGatewayCache{},
+		cfg:                cfg,
+		concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+	}
+
+	fastTTFT := 100
+	otherFastTTFT := 150
+	slowTTFT := 6000
+	svc.ReportOpenAIAccountScheduleResultForModel(5401, "gpt-4.1-mini", true, &fastTTFT)
+	svc.ReportOpenAIAccountScheduleResultForModel(5402, "gpt-4.1-mini", true, &otherFastTTFT)
+	for i := 0; i < 20; i++ {
+		svc.ReportOpenAIAccountScheduleResultForModel(5401, "gpt-5.1", true, &slowTTFT)
+	}
+
+	_, aggregateTTFT, hasTTFT := svc.openaiAccountStats.snapshot(5401)
+	require.True(t, hasTTFT)
+	require.Greater(t, aggregateTTFT, float64(otherFastTTFT), "账号级 TTFT 已被慢模型样本拉高")
+
+	selection, _, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-4.1-mini", nil, OpenAIUpstreamTransportAny)
+	require.NoError(t, err)
+	require.NotNil(t, selection)
+	require.Equal(t, int64(5401), selection.Account.ID, "快模型请求应按该模型的 TTFT 比较账号")
+	if selection.ReleaseFunc != nil {
+		selection.ReleaseFunc()
+	}
+
+	// 无该模型样本时不回退账号级 TTFT，按无样本处理。
+	_, _, hasTTFT = svc.openaiAccountStats.snapshotForModel(5402, "gpt-5.1")
+	require.False(t, hasTTFT)
+}
+
+func TestOpenAIGatewayService_SelectAccountWithScheduler_ModelTTFTNormalizesLikeWithLike(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(19)
+	accounts := []Account{
+		{ID: 5411, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3},
+		{ID: 5412, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3},
+		{ID: 5413, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3},
+	}
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.LBTopK = 1
+	cfg.Gateway.OpenAIWS.SchedulerScoreWeights.TTFT = 1
+
+	svc := &OpenAIGatewayService{
+		accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+		cache:              &stubGatewayCache{},
+		cfg:                cfg,
+		concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+	}
+
+	// 5411、5413 有 gpt-5.1 样本（5411 更快）；5412 只有快模型样本，账号级 TTFT 远低于二者。
+	fastModelTTFT := 50
+	modelTTFT := 400
+	slowerModelTTFT := 800
+	svc.ReportOpenAIAccountScheduleResultForModel(5411, "gpt-5.1", true, &modelTTFT)
+	svc.ReportOpenAIAccountScheduleResultForModel(5412, "gpt-4.1-mini", true, &fastModelTTFT)
+	svc.ReportOpenAIAccountScheduleResultForModel(5413, "gpt-5.1", true, &slowerModelTTFT)
+
+	selection, _, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+	require.NoError(t, err)
+	require.NotNil(t, selection)
+	if selection.ReleaseFunc != nil {
+		selection.ReleaseFunc()
+	}
+	// 5412 无 gpt-5.1 样本，取中性值而不是拿账号级 50ms 与其他账号的模型级 TTFT 比较。
+	require.Equal(t, int64(5411), selection.Account.ID)
+}
+
+func TestOpenAIAccountRuntimeStats_ModelTTFTBounded(t *testing.T) {
+	stats := newOpenAIAccountRuntimeStats()
+	ttft := 200
+	for i := 0; i < openAIAccountModelTTFTMaxModels+8; i++ {
+		stats.reportModelTTFT(1, fmt.Sprintf("model-%d", i), &ttft)
+	}
+	stat := stats.loadOrCreate(1)
+	require.Equal(t, int64(openAIAccountModelTTFTMaxModels), stat.modelTTFTCount.Load())
+
+	stats.reportModelTTFT(1, "", &ttft)
+	stats.reportModelTTFT(1, "model-0", nil)
+	_, modelTTFT, hasTTFT := stats.snapshotForModel(1, " MODEL-0 ")
+	require.True(t, hasTTFT)
+	require.Equal(t, float64(ttft), modelTTFT)
+}
+
 func TestSelectTopKOpenAICandidates(t *testing.T) {
 	candidates := []openAIAccountCandidateScore{
 		{
@@ -734,6 +1110,108 @@ func TestOpenAIGatewayService_SelectAccountWithScheduler_LoadBalanceDistributesA
 	require.GreaterOrEqual(t, len(selected), 2)
 }
 
+func TestOpenAIGatewayService_SelectAccountWithScheduler_APIKeyStickyWindowReducesFlapping(t *testing.T) {
+	groupID := int64(16)
+	accounts := []Account{
+		{ID: 5201, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3},
+		{ID: 5202, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3},
+		{ID: 5203, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3},
+	}
+	newService := func(windowSeconds int) *OpenAIGatewayService {
+		cfg := &config.Config{}
+		cfg.Gateway.OpenAIWS.LBTopK = 3
+		cfg.Gateway.OpenAIWS.APIKeyStickyWindowSeconds = windowSeconds
+		cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Priority = 1
+		cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Load = 1
+		cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Queue = 1
+		cfg.Gateway.OpenAIWS.SchedulerScoreWeights.ErrorRate = 1
+		cfg.Gateway.OpenAIWS.SchedulerScoreWeights.TTFT = 1
+		return &OpenAIGatewayService{
+			accountRepo: stubOpenAIAccountRepo{accounts: accounts},
+			cache:       &stubGatewayCache{sessionBindings: map[string]int64{}},
+			cfg:         cfg,
+			concurrencyService: NewConcurrencyService(stubConcurrencyCache{
+				loadMap: map[int64]*AccountLoadInfo{
+					5201: {AccountID: 5201, LoadRate: 20},
+					5202: {AccountID: 5202, LoadRate: 20},
+					5203: {AccountID: 5203, LoadRate: 20},
+				},
+			}),
+		}
+	}
+	countSwitches := func(svc *OpenAIGatewayService, ctx context.Context) (int, []string) {
+		switches := 0
+		layers := make([]string, 0, 30)
+		var lastAccountID int64
+		for i := 0; i < 30; i++ {
+			selection, decision, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+			require.NoError(t, err)
+			require.NotNil(t, selection)
+			require.NotNil(t, selection.Account)
+			if lastAccountID != 0 && selection.Account.ID != lastAccountID {
+				switches++
+			}
+			lastAccountID = selection.Account.ID
+			layers = append(layers, decision.Layer)
+			if selection.ReleaseFunc != nil {
+				selection.ReleaseFunc()
+			}
+		}
+		return switches, layers
+	}
+
+	ctx := WithAPIKeyID(context.Background(), 9001)
+
+	// 关闭窗口时，无会话粘连的请求在等分账号间随机打散。
+	switchesWithout, _ := countSwitches(newService(0), ctx)
+	require.Greater(t, switchesWithout, 0)
+
+	svc := newService(60)
+	switchesWith, layers := countSwitches(svc, ctx)
+	require.Equal(t, 0, switchesWith, "窗口期内同一 API Key 不应在账号间抖动")
+	require.Equal(t, openAIAccountScheduleLayerLoadBalance, layers[0])
+	for _, layer := range layers[1:] {
+		require.Equal(t, openAIAccountScheduleLayerAPIKeySticky, layer)
+	}
+
+	// 显式会话粘连优先，不走 API Key 窗口。
+	_, decision, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "session_hash_api_key_window", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+	require.NoError(t, err)
+	require.Equal(t, openAIAccountScheduleLayerLoadBalance, decision.Layer)
+
+	// 粘连账号被排除时回退负载均衡。
+	selection, decision, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+	require.NoError(t, err)
+	stickyAccountID := selection.Account.ID
+	selection, decision, err = svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", map[int64]struct{}{stickyAccountID: {}}, OpenAIUpstreamTransportAny)
+	require.NoError(t, err)
+	require.NotEqual(t, stickyAccountID, selection.Account.ID)
+	require.Equal(t, openAIAccountScheduleLayerLoadBalance, decision.Layer)
+
+	// 未携带 API Key 的请求不参与窗口粘连。
+	_, decision, err = svc.SelectAccountWithScheduler(context.Background(), &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+	require.NoError(t, err)
+	require.Equal(t, openAIAccountScheduleLayerLoadBalance, decision.Layer)
+}
+
+func TestDefaultOpenAIAccountScheduler_APIKeyAffinitySweepsIdleKeys(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.APIKeyStickyWindowSeconds = 30
+	svc := &OpenAIGatewayService{cfg: cfg}
+	scheduler, ok := newDefaultOpenAIAccountScheduler(svc, nil).(*defaultOpenAIAccountScheduler)
+	require.True(t, ok)
+	groupID := int64(27)
+	for apiKeyID := int64(1); apiKeyID <= 50; apiKeyID++ {
+		scheduler.rememberAPIKeyAffinity(OpenAIAccountScheduleRequest{GroupID: &groupID, APIKeyID: apiKeyID}, 6201)
+	}
+	require.Equal(t, 50, scheduler.apiKeyAffinity.len())
+
+	// 已删除或空闲的 API Key 不会再被查询；窗口过期后的下一次写入应清理掉全部过期记录。
+	later := time.Now().Add(svc.openAIAPIKeyStickyWindow() + openAITTLMapSweepInterval)
+	scheduler.apiKeyAffinity.store(openAIAPIKeyAffinityKey{apiKeyID: 51, groupID: groupID}, openAIAPIKeyAffinityEntry{accountID: 6201}, later.Add(time.Minute), later)
+	require.Equal(t, 1, scheduler.apiKeyAffinity.len())
+}
+
 func TestDeriveOpenAISelectionSeed_NoAffinityAddsEntropy(t *testing.T) {
 	req := OpenAIAccountScheduleRequest{
 		RequestedModel: "gpt-5.1",
@@ -865,6 +1343,7 @@ func TestOpenAIGatewayService_SchedulerWrappersAndDefaults(t *testing.T) {
 	require.Equal(t, 0.7, defaultWeights.Queue)
 	require.Equal(t, 0.8, defaultWeights.ErrorRate)
 	require.Equal(t, 0.5, defaultWeights.TTFT)
+	require.Equal(t, 0.6, defaultWeights.PrevNotFound)
 
 	cfg := &config.Config{}
 	cfg.Gateway.OpenAIWS.LBTopK = 9
@@ -886,6 +1365,45 @@ func TestOpenAIGatewayService_SchedulerWrappersAndDefaults(t *testing.T) {
 	require.Equal(t, 0.6, customWeights.TTFT)
 }
 
+func TestOpenAIGatewayService_SelectAccountWithScheduler_PrevNotFoundPenaltyOnlyForContinuation(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(19)
+	accounts := []Account{
+		{ID: 5401, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3, Priority: 0},
+		{ID: 5402, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 3, Priority: 1},
+	}
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.LBTopK = 1
+	cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Priority = 0.5
+	cfg.Gateway.OpenAIWS.SchedulerScoreWeights.PrevNotFound = 1
+
+	svc := &OpenAIGatewayService{
+		accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+		cache:              &stubGatewayCache{},
+		cfg:                cfg,
+		concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+	}
+	selectOnce := func(previousResponseID string) int64 {
+		selection, decision, err := svc.SelectAccountWithScheduler(ctx, &groupID, previousResponseID, "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.NotNil(t, selection)
+		require.NotNil(t, selection.Account)
+		require.Equal(t, openAIAccountScheduleLayerLoadBalance, decision.Layer)
+		if selection.ReleaseFunc != nil {
+			selection.ReleaseFunc()
+		}
+		return selection.Account.ID
+	}
+
+	for i := 0; i < 6; i++ {
+		svc.reportOpenAIAccountPreviousResponseOutcome(5401, true)
+		svc.reportOpenAIAccountPreviousResponseOutcome(5402, false)
+	}
+
+	require.Equal(t, int64(5402), selectOnce("resp_prev_penalty"), "续链请求应避开频繁丢失响应存储的账号")
+	require.Equal(t, int64(5401), selectOnce(""), "非续链请求不应受 prev_not_found 惩罚影响")
+}
+
 func TestDefaultOpenAIAccountScheduler_IsAccountTransportCompatible_Branches(t *testing.T) {
 	scheduler := &defaultOpenAIAccountScheduler{}
 	require.True(t, scheduler.isAccountTransportCompatible(nil, OpenAIUpstreamTransportAny))
@@ -911,3 +1429,401 @@ func TestDefaultOpenAIAccountScheduler_IsAccountTransportCompatible_Branches(t *
 func int64PtrForTest(v int64) *int64 {
 	return &v
 }
+
+type openAIZeroConcurrencyRecordingCache struct {
+	stubConcurrencyCache
+	mu          sync.Mutex
+	acquireMax  map[int64]int
+	loadBatchMx map[int64]int
+}
+
+func (c *openAIZeroConcurrencyRecordingCache) AcquireAccountSlot(ctx context.Context, accountID int64, maxConcurrency int, requestID string) (bool, error) {
+	c.mu.Lock()
+	c.acquireMax[accountID] = maxConcurrency
+	c.mu.Unlock()
+	return c.stubConcurrencyCache.AcquireAccountSlot(ctx, accountID, maxConcurrency, requestID)
+}
+
+func (c *openAIZeroConcurrencyRecordingCache) GetAccountsLoadBatch(ctx context.Context, accounts []AccountWithConcurrency) (map[int64]*AccountLoadInfo, error) {
+	c.mu.Lock()
+	for _, acc := range accounts {
+		c.loadBatchMx[acc.ID] = acc.MaxConcurrency
+	}
+	c.mu.Unlock()
+	return c.stubConcurrencyCache.GetAccountsLoadBatch(ctx, accounts)
+}
+
+func TestOpenAIGatewayService_SelectAccountWithScheduler_ZeroConcurrencyMode(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(20)
+	accounts := []Account{
+		{ID: 5501, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 0, Priority: 0},
+		{ID: 5502, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 0, Priority: 0},
+	}
+	newSvc := func(mode string) (*OpenAIGatewayService, *openAIZeroConcurrencyRecordingCache) {
+		cfg := &config.Config{}
+		cfg.Gateway.OpenAIWS.LBTopK = 1
+		cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Load = 1
+		cfg.Gateway.OpenAIWS.SchedulerZeroConcurrencyMode = mode
+		cfg.Gateway.OpenAIWS.SchedulerAssumedConcurrency = 4
+		cache := &openAIZeroConcurrencyRecordingCache{
+			stubConcurrencyCache: stubConcurrencyCache{
+				loadMap: map[int64]*AccountLoadInfo{
+					5501: {AccountID: 5501, LoadRate: 75},
+					5502: {AccountID: 5502, LoadRate: 25},
+				},
+			},
+			acquireMax:  map[int64]int{},
+			loadBatchMx: map[int64]int{},
+		}
+		return &OpenAIGatewayService{
+			accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+			cache:              &stubGatewayCache{},
+			cfg:                cfg,
+			concurrencyService: NewConcurrencyService(cache),
+		}, cache
+	}
+
+	t.Run("assumed", func(t *testing.T) {
+		svc, cache := newSvc(openAIWSSchedulerZeroConcurrencyAssumed)
+		selection, decision, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.NotNil(t, selection)
+		require.NotNil(t, selection.Account)
+		require.Equal(t, openAIAccountScheduleLayerLoadBalance, decision.Layer)
+		require.Equal(t, int64(5502), selection.Account.ID, "assumed 模式下应按负载率避开更繁忙的账号")
+		require.True(t, selection.Acquired)
+		if selection.ReleaseFunc != nil {
+			selection.ReleaseFunc()
+		}
+		require.Equal(t, 4, cache.loadBatchMx[5501])
+		require.Equal(t, 4, cache.acquireMax[5502], "assumed 模式下应按假定并发占用槽位")
+	})
+
+	t.Run("unbounded", func(t *testing.T) {
+		svc, cache := newSvc(openAIWSSchedulerZeroConcurrencyUnbounded)
+		selection, _, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.NotNil(t, selection)
+		require.True(t, selection.Acquired)
+		if selection.ReleaseFunc != nil {
+			selection.ReleaseFunc()
+		}
+		require.Empty(t, cache.acquireMax, "unbounded 模式下不应占用槽位")
+		require.Equal(t, 1, cache.loadBatchMx[5501])
+	})
+}
+
+func TestPrefilterOpenAICandidateAccounts_PriorityTiersThenSample(t *testing.T) {
+	accounts := make([]*Account, 0, 12)
+	for i := 0; i < 12; i++ {
+		priority := 2
+		switch {
+		case i < 3:
+			priority = 0
+		case i < 8:
+			priority = 1
+		}
+		accounts = append(accounts, &Account{ID: int64(5700 + i), Priority: priority})
+	}
+
+	rng := newOpenAISelectionRNG(42)
+	shortlist := prefilterOpenAICandidateAccounts(accounts, 5, 0, &rng)
+	require.Len(t, shortlist, 5)
+	tierCount := map[int]int{}
+	for _, account := range shortlist {
+		tierCount[account.Priority]++
+	}
+	require.Equal(t, map[int]int{0: 3, 1: 2}, tierCount, "应整层保留高优先级，溢出层内抽样补满")
+
+	rng = newOpenAISelectionRNG(42)
+	shortlist = prefilterOpenAICandidateAccounts(accounts, 5, 5711, &rng)
+	require.Len(t, shortlist, 5)
+	require.Equal(t, int64(5711), shortlist[0].ID, "粘连账号即使优先级最低也应保留")
+
+	rng = newOpenAISelectionRNG(42)
+	require.Len(t, prefilterOpenAICandidateAccounts(accounts, 12, 0, &rng), 12)
+}
+
+func TestOpenAIGatewayService_SelectAccountWithScheduler_CandidatePrefilter(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(22)
+	accounts := make([]Account, 0, 6)
+	for i := 0; i < 6; i++ {
+		priority := 1
+		if i < 2 {
+			priority = 0
+		}
+		accounts = append(accounts, Account{
+			ID:          int64(5801 + i),
+			Platform:    PlatformOpenAI,
+			Type:        AccountTypeAPIKey,
+			Status:      StatusActive,
+			Schedulable: true,
+			Concurrency: 1,
+			Priority:    priority,
+		})
+	}
+	newSvc := func(threshold int) *OpenAIGatewayService {
+		cfg := &config.Config{}
+		cfg.Gateway.OpenAIWS.LBTopK = 3
+		cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Priority = 1
+		cfg.Gateway.OpenAIWS.SchedulerCandidatePrefilterThreshold = threshold
+		cfg.Gateway.OpenAIWS.SchedulerCandidatePrefilterSize = 2
+		return &OpenAIGatewayService{
+			accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+			cache:              &stubGatewayCache{},
+			cfg:                cfg,
+			concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+		}
+	}
+
+	t.Run("above_threshold", func(t *testing.T) {
+		svc := newSvc(4)
+		selection, decision, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.NotNil(t, selection)
+		require.NotNil(t, selection.Account)
+		if selection.ReleaseFunc != nil {
+			selection.ReleaseFunc()
+		}
+		require.Equal(t, 2, decision.CandidateCount, "超过阈值时应仅对预筛后的候选打分")
+		require.Equal(t, 6, decision.TotalEligible, "TotalEligible 为预筛前的可用账号数")
+		require.Equal(t, 0, selection.Account.Priority, "预筛应保留最高优先级层")
+
+		snapshot := svc.SnapshotOpenAIAccountSchedulerMetrics()
+		require.Equal(t, int64(1), snapshot.ScoringPrefilteredTotal)
+		require.Equal(t, int64(4), snapshot.PrefilterDroppedCandidateTotal)
+		require.Zero(t, snapshot.ScoringFullTotal)
+	})
+
+	t.Run("below_threshold", func(t *testing.T) {
+		svc := newSvc(6)
+		selection, decision, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.NotNil(t, selection)
+		if selection.ReleaseFunc != nil {
+			selection.ReleaseFunc()
+		}
+		require.Equal(t, 6, decision.CandidateCount, "未超过阈值时保持全量打分")
+		require.Equal(t, 6, decision.TotalEligible)
+
+		snapshot := svc.SnapshotOpenAIAccountSchedulerMetrics()
+		require.Equal(t, int64(1), snapshot.ScoringFullTotal)
+		require.Zero(t, snapshot.ScoringPrefilteredTotal)
+	})
+}
+
+func TestOpenAIGatewayService_SelectAccountWithScheduler_TotalEligibleDistinguishesCapFromScarcity(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(23)
+	accounts := make([]Account, 0, 8)
+	for i := 0; i < 8; i++ {
+		accounts = append(accounts, Account{
+			ID:          int64(5901 + i),
+			Platform:    PlatformOpenAI,
+			Type:        AccountTypeAPIKey,
+			Status:      StatusActive,
+			Schedulable: true,
+			Concurrency: 1,
+		})
+	}
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.LBTopK = 2
+	cfg.Gateway.OpenAIWS.SchedulerCandidatePrefilterThreshold = 4
+	cfg.Gateway.OpenAIWS.SchedulerCandidatePrefilterSize = 3
+	svc := &OpenAIGatewayService{
+		accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+		cache:              &stubGatewayCache{},
+		cfg:                cfg,
+		concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+	}
+	selectOnce := func(excluded map[int64]struct{}) OpenAIAccountScheduleDecision {
+		selection, decision, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", excluded, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.NotNil(t, selection)
+		if selection.ReleaseFunc != nil {
+			selection.ReleaseFunc()
+		}
+		return decision
+	}
+
+	decision := selectOnce(nil)
+	require.Equal(t, 3, decision.CandidateCount, "候选被预筛上限截断")
+	require.Equal(t, 8, decision.TotalEligible)
+
+	excluded := map[int64]struct{}{5901: {}, 5902: {}, 5903: {}, 5904: {}, 5905: {}}
+	decision = selectOnce(excluded)
+	require.Equal(t, 3, decision.CandidateCount, "可用账号本身只有 3 个")
+	require.Equal(t, 3, decision.TotalEligible)
+
+	cfg.Gateway.OpenAIWS.SchedulerCandidatePrefilterSize = 5
+	decision = selectOnce(nil)
+	require.Equal(t, 5, decision.CandidateCount, "调整预筛上限后按新上限截断")
+	require.Equal(t, 8, decision.TotalEligible)
+}
+
+func TestFilterOpenAICandidatesByMinScore(t *testing.T) {
+	candidates := []openAIAccountCandidateScore{
+		{account: &Account{ID: 1}, score: 0.9},
+		{account: &Account{ID: 2}, score: 0.2},
+		{account: &Account{ID: 3}, score: 0.6},
+	}
+
+	kept, excluded := filterOpenAICandidatesByMinScore(candidates, 0.5)
+	require.Equal(t, 1, excluded)
+	require.Len(t, kept, 2)
+	require.Equal(t, int64(1), kept[0].account.ID)
+	require.Equal(t, int64(3), kept[1].account.ID)
+
+	kept, excluded = filterOpenAICandidatesByMinScore(candidates, 5)
+	require.Equal(t, 2, excluded)
+	require.Len(t, kept, 1, "全部低于阈值时应保留得分最高者")
+	require.Equal(t, int64(1), kept[0].account.ID)
+	require.Len(t, candidates, 3, "不应修改原候选切片")
+
+	kept, excluded = filterOpenAICandidatesByMinScore(nil, 0.5)
+	require.Empty(t, kept)
+	require.Zero(t, excluded)
+}
+
+func TestOpenAIGatewayService_SelectAccountWithScheduler_MinScoreThreshold(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(23)
+	accounts := make([]Account, 0, 4)
+	for i := 0; i < 4; i++ {
+		accounts = append(accounts, Account{
+			ID:          int64(5901 + i),
+			Platform:    PlatformOpenAI,
+			Type:        AccountTypeAPIKey,
+			Status:      StatusActive,
+			Schedulable: true,
+			Concurrency: 1,
+			Priority:    i,
+		})
+	}
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.LBTopK = 4
+	cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Priority = 1
+	cfg.Gateway.OpenAIWS.SchedulerMinScoreThreshold = 0.9
+	svc := &OpenAIGatewayService{
+		accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+		cache:              &stubGatewayCache{},
+		cfg:                cfg,
+		concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+	}
+
+	for i := 0; i < 5; i++ {
+		selection, decision, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", fmt.Sprintf("min_score_%d", i), "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.NotNil(t, selection)
+		require.NotNil(t, selection.Account)
+		if selection.ReleaseFunc != nil {
+			selection.ReleaseFunc()
+		}
+		require.Equal(t, int64(5901), selection.Account.ID, "低于阈值的候选不应被选中")
+		require.Equal(t, 1, decision.TopK)
+	}
+
+	snapshot := svc.SnapshotOpenAIAccountSchedulerMetrics()
+	require.Equal(t, int64(15), snapshot.MinScoreExcludedCandidateTotal)
+
+	// 阈值高于所有得分时仍保留最高分候选。
+	cfg.Gateway.OpenAIWS.SchedulerMinScoreThreshold = 10
+	selection, _, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "min_score_all_below", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+	require.NoError(t, err)
+	require.NotNil(t, selection)
+	require.NotNil(t, selection.Account)
+	if selection.ReleaseFunc != nil {
+		selection.ReleaseFunc()
+	}
+	require.Equal(t, int64(5901), selection.Account.ID)
+}
+
+func TestOpenAIGatewayService_SelectAccountWithScheduler_PausedGroup(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(25)
+	account := Account{ID: 6101, Platform: PlatformOpenAI, Type: AccountTypeOAuth, Status: StatusActive, Schedulable: true, Concurrency: 1}
+	svc := &OpenAIGatewayService{
+		accountRepo:        stubOpenAIAccountRepo{accounts: []Account{account}},
+		cache:              &stubGatewayCache{},
+		cfg:                &config.Config{},
+		concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+	}
+
+	svc.PauseGroup(groupID)
+	require.True(t, svc.IsGroupPaused(groupID))
+	selection, _, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+	require.Nil(t, selection)
+	require.True(t, IsOpenAIGroupPausedError(err))
+	var pausedErr *OpenAIGroupPausedError
+	require.ErrorAs(t, err, &pausedErr)
+	require.Equal(t, groupID, pausedErr.GroupID)
+	require.Equal(t, int64(1), svc.SnapshotOpenAIAccountSchedulerMetrics().GroupPausedRejectTotal)
+
+	otherGroupID := int64(26)
+	selection, _, err = svc.SelectAccountWithScheduler(ctx, &otherGroupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+	require.NoError(t, err, "其他分组不受影响")
+	require.NotNil(t, selection)
+	if selection.ReleaseFunc != nil {
+		selection.ReleaseFunc()
+	}
+
+	svc.ResumeGroup(groupID)
+	require.False(t, svc.IsGroupPaused(groupID))
+	selection, _, err = svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+	require.NoError(t, err)
+	require.NotNil(t, selection)
+	require.Equal(t, account.ID, selection.Account.ID)
+	if selection.ReleaseFunc != nil {
+		selection.ReleaseFunc()
+	}
+	require.Equal(t, int64(1), svc.SnapshotOpenAIAccountSchedulerMetrics().GroupPausedRejectTotal)
+}
+
+func TestOpenAIGatewayService_SelectAccountWithScheduler_TransportFallback(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(31)
+	accounts := []Account{
+		{ID: 8901, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 2},
+	}
+	newService := func(fallbackGroupIDs []int64) *OpenAIGatewayService {
+		cfg := newOpenAIWSV2TestConfig()
+		cfg.Gateway.OpenAIWS.SchedulerTransportFallbackGroupIDs = fallbackGroupIDs
+		return &OpenAIGatewayService{
+			accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+			cache:              &stubGatewayCache{},
+			cfg:                cfg,
+			concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+		}
+	}
+
+	strict := newService(nil)
+	_, decision, err := strict.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportResponsesWebsocketV2)
+	require.Error(t, err, "默认严格失败")
+	require.False(t, decision.TransportFallback)
+
+	otherGroup := newService([]int64{99})
+	_, _, err = otherGroup.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportResponsesWebsocketV2)
+	require.Error(t, err, "未列入降级配置的分组仍严格失败")
+
+	degrade := newService([]int64{groupID})
+	selection, decision, err := degrade.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportResponsesWebsocketV2)
+	require.NoError(t, err)
+	require.NotNil(t, selection)
+	require.NotNil(t, selection.Account)
+	require.Equal(t, int64(8901), selection.Account.ID)
+	require.True(t, decision.TransportFallback)
+	if selection.ReleaseFunc != nil {
+		selection.ReleaseFunc()
+	}
+	require.Equal(t, int64(1), degrade.SnapshotOpenAIAccountSchedulerMetrics().TransportFallbackTotal)
+
+	// 严格传输本身可满足时不记录降级
+	selection, decision, err = degrade.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+	require.NoError(t, err)
+	require.False(t, decision.TransportFallback)
+	if selection.ReleaseFunc != nil {
+		selection.ReleaseFunc()
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/Wei-Shaw/sub2api/internal/pkg/openai"
 	"github.com/Wei-Shaw/sub2api/internal/util/responseheaders"
 	"github.com/Wei-Shaw/sub2api/internal/util/urlvalidator"
+	"github.com/cespare/xxhash/v2"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/tidwall/gjson"
@@ -223,9 +224,52 @@ type OpenAIForwardResult struct {
 	ReasoningEffort *string
 	Stream          bool
 	OpenAIWSMode    bool
-	ResponseHeaders http.Header
-	Duration        time.Duration
-	FirstTokenMs    *int
+	// OpenAIWSConnMode records how the upstream WS connection was obtained
+	// (ctx_pool/shared/dedicated/passthrough). Empty for HTTP and pooled HTTP-WS turns.
+	OpenAIWSConnMode string
+	ResponseHeaders  http.Header
+	Duration         time.Duration
+	FirstTokenMs     *int
+	// PartialUsage marks Usage as a best-effort figure recovered from a turn that
+	// failed after output had already been streamed to the client. It is only
+	// populated from usage fragments the upstream actually sent (e.g. on
+	// response.incomplete / response.failed) and may undercount the real usage.
+	PartialUsage bool
+	// RecoveryMitigations lists, in order, the recovery layers attempted for this
+	// ingress WS turn (e.g. preflight_reconnect, prev_id_drop). Empty when the
+	// turn went through without any recovery.
+	RecoveryMitigations []string
+	// RecoverySucceededBy is the layer that finally made the turn succeed; empty
+	// when no recovery ran or the turn still failed.
+	RecoverySucceededBy string
+	// StickyConnReused reports whether this WS turn ran on the upstream
+	// connection it was sticky to (the previous turn's connection, or the one
+	// bound to previous_response_id / the session).
+	StickyConnReused bool
+	// StickyConnMissReason explains why the sticky connection was not reused
+	// (e.g. preferred_conn_missing, preflight_ping_failed). Both sticky fields
+	// stay zero when the turn had no sticky connection to reuse.
+	StickyConnMissReason string
+	// UsageMissing marks a WS turn whose response.completed carried no usage at all.
+	// How Usage is then filled follows gateway.openai_ws.usage_missing_policy.
+	UsageMissing bool
+	// UsageEstimated marks Usage as estimated from request/response text
+	// (usage_missing_policy=estimate) rather than reported by the upstream.
+	UsageEstimated bool
+	// UsageUnbilled marks the turn as intentionally not billed
+	// (usage_missing_policy=unbilled); RecordUsage skips it.
+	UsageUnbilled bool
+	// StoreDisabledFullInputMode records how a store=false ingress WS turn that
+	// carried both previous_response_id and the full conversation input was
+	// interpreted: "incremental" (kept previous_response_id, trimmed the input
+	// already on the chain) or "full_create" (dropped previous_response_id).
+	// Empty when the turn did not carry both.
+	StoreDisabledFullInputMode string
+	// StoreDisabledFullInputReason explains StoreDisabledFullInputMode: "policy"
+	// when ingress_store_disabled_full_input_policy decided it, "auto" when the
+	// strict continuation check did, or the contradiction that forced full_create
+	// (previous_response_id_mismatch / no_new_input).
+	StoreDisabledFullInputReason string
 }
 
 type OpenAIWSRetryMetricsSnapshot struct {
@@ -233,6 +277,22 @@ type OpenAIWSRetryMetricsSnapshot struct {
 	RetryBackoffMsTotal           int64 `json:"retry_backoff_ms_total"`
 	RetryExhaustedTotal           int64 `json:"retry_exhausted_total"`
 	NonRetryableFastFallbackTotal int64 `json:"non_retryable_fast_fallback_total"`
+	FullCreateReplayTotal         int64 `json:"full_create_replay_total"`
+	FullCreateReplayCappedTotal   int64 `json:"full_create_replay_capped_total"`
+	AccountReselectTotal          int64 `json:"account_reselect_total"`
+}
+
+type OpenAIWSRelayMetricsSnapshot struct {
+	MalformedUpstreamEventTotal int64 `json:"malformed_upstream_event_total"`
+	UsageMissingTurnTotal       int64 `json:"usage_missing_turn_total"`
+	// SlowClientDisconnectTotal ingress 下发缓冲写满、按 disconnect 策略断开客户端的次数。
+	SlowClientDisconnectTotal int64 `json:"slow_client_disconnect_total"`
+	// SlowClientDroppedDeltaTotal ingress 下发缓冲写满、按 drop_deltas 策略丢弃的增量事件数。
+	SlowClientDroppedDeltaTotal int64 `json:"slow_client_dropped_delta_total"`
+	// DisconnectDrainActive 客户端断连后仍在读取上游的 turn 数。
+	DisconnectDrainActive int64 `json:"disconnect_drain_active"`
+	// DisconnectDrainAbortedTotal drain 并发已满、客户端断连后直接中止上游的 turn 数。
+	DisconnectDrainAbortedTotal int64 `json:"disconnect_drain_aborted_total"`
 }
 
 type OpenAICompatibilityFallbackMetricsSnapshot struct {
@@ -255,6 +315,16 @@ type openAIWSRetryMetrics struct {
 	retryBackoffMs           atomic.Int64
 	retryExhausted           atomic.Int64
 	nonRetryableFastFallback atomic.Int64
+	fullCreateReplay         atomic.Int64
+	fullCreateReplayCapped   atomic.Int64
+	accountReselect          atomic.Int64
+}
+
+type openAIWSRelayMetrics struct {
+	malformedUpstreamEvent atomic.Int64
+	usageMissingTurn       atomic.Int64
+	slowClientDisconnect   atomic.Int64
+	slowClientDroppedDelta atomic.Int64
 }
 
 type accountWriteThrottle struct {
@@ -326,13 +396,46 @@ type OpenAIGatewayService struct {
 	openaiWSPool                  *openAIWSConnPool
 	openaiWSStateStore            OpenAIWSStateStore
 	openaiScheduler               OpenAIAccountScheduler
+	openaiScheduleEvents          atomic.Pointer[openAIAccountScheduleEventDispatcher]
+	usageReporter                 atomic.Pointer[usageReportDispatcher]
+	openaiWSReloadedConfig        atomic.Pointer[config.GatewayOpenAIWSConfig]
+	openaiClientRegionResolver    atomic.Pointer[openAIClientRegionResolverHolder]
 	openaiWSPassthroughDialer     openAIWSClientDialer
 	openaiAccountStats            *openAIAccountRuntimeStats
 
-	openaiWSFallbackUntil sync.Map // key: int64(accountID), value: time.Time
-	openaiWSRetryMetrics  openAIWSRetryMetrics
-	responseHeaderFilter  *responseheaders.CompiledHeaderFilter
-	codexSnapshotThrottle *accountWriteThrottle
+	openaiWSFallbackUntil  sync.Map // key: int64(accountID), value: time.Time
+	openaiPausedGroups     sync.Map // key: int64(groupID), value: time.Time（暂停时间）
+	openaiGroupPausedTotal atomic.Int64
+	// openaiTransportFallbackTotal 因要求的传输协议无候选而降级为任意传输的调度次数
+	openaiTransportFallbackTotal atomic.Int64
+	openaiWSRetryMetrics         openAIWSRetryMetrics
+	openaiWSRecoveryMetrics      openAIWSRecoveryMetrics
+	openaiWSStickyReuseMetrics   openAIWSStickyReuseMetrics
+	openaiWSRecoveryReconnects   openAIWSRecoveryReconnectLimiter
+	openaiWSRelayMetrics         openAIWSRelayMetrics
+	openaiWSDisconnectDrains     openAIWSDisconnectDrainLimiter
+	openaiWSRecentCaptures       openAIWSIngressCaptureRing
+	openaiWSShadowMetrics        openAIWSShadowMetrics
+	// openaiWSSessionCreates 按 API Key 的新建 ingress 会话限流与速率统计。
+	openaiWSSessionCreates openAIWSSessionCreateLimiter
+	// openaiStickyAccountSessions 本进程内各账号绑定的粘连会话，用于统计与 sticky_sessions_per_account_max 限制。
+	openaiStickyAccountSessions openAIStickyAccountSessions
+	// openaiStickyTTLSkew 会话粘连绑定寿命与配置 TTL 的偏差采样。
+	openaiStickyTTLSkew openAIStickyTTLSkewSampler
+	// openaiWSHandoffSessions 在线 ingress 会话的进度，停机时写入会话交接文件。
+	openaiWSHandoffSessions sync.Map // key: openAIStickyAccountSessionKey, value: *openAIWSHandoffSessionTracker
+	// openaiWSHandoffResumed 启动时从交接文件回灌、尚未被重连认领的会话进度。
+	openaiWSHandoffResumed      sync.Map // key: openAIStickyAccountSessionKey, value: openAIWSHandoffResumedSession
+	openaiWSSessionMetrics      *openAIWSIngressSessionMetrics
+	openaiWSSessionMetricsOnce  sync.Once
+	openaiWSRequestRewrites     map[int64][]openAIWSRequestRewriteRule
+	openaiWSRequestRewritesOnce sync.Once
+	openaiWSModelDefaults       []openAIWSModelDefaultParams
+	openaiWSModelDefaultsOnce   sync.Once
+	responseHeaderFilter        *responseheaders.CompiledHeaderFilter
+	codexSnapshotThrottle       *accountWriteThrottle
+	// openaiBreakerEscalation 统计账号全局熔断次数，窗口内反复熔断时升级为自动禁用。
+	openaiBreakerEscalation openAIAccountBreakerEscalation
 }
 
 // NewOpenAIGatewayService creates a new OpenAIGatewayService
@@ -383,6 +486,8 @@ func NewOpenAIGatewayService(
 		responseHeaderFilter:  compileResponseHeaderFilter(cfg),
 		codexSnapshotThrottle: newAccountWriteThrottle(openAICodexSnapshotPersistMinInterval),
 	}
+	// 账号被删除或停用时下线其上游 WS 连接（进行中的 turn 完成后关闭）。
+	schedulerSnapshot.OnAccountRemoved(svc.RetireOpenAIWSAccount)
 	svc.logOpenAIWSModeBootstrap()
 	return svc
 }
@@ -730,6 +835,20 @@ func (s *OpenAIGatewayService) recordOpenAIWSNonRetryableFastFallback() {
 	s.openaiWSRetryMetrics.nonRetryableFastFallback.Add(1)
 }
 
+func (s *OpenAIGatewayService) recordOpenAIWSFullCreateReplay() {
+	if s == nil {
+		return
+	}
+	s.openaiWSRetryMetrics.fullCreateReplay.Add(1)
+}
+
+func (s *OpenAIGatewayService) recordOpenAIWSFullCreateReplayCapped() {
+	if s == nil {
+		return
+	}
+	s.openaiWSRetryMetrics.fullCreateReplayCapped.Add(1)
+}
+
 func (s *OpenAIGatewayService) SnapshotOpenAIWSRetryMetrics() OpenAIWSRetryMetricsSnapshot {
 	if s == nil {
 		return OpenAIWSRetryMetricsSnapshot{}
@@ -739,6 +858,23 @@ func (s *OpenAIGatewayService) SnapshotOpenAIWSRetryMetrics() OpenAIWSRetryMetri
 		RetryBackoffMsTotal:           s.openaiWSRetryMetrics.retryBackoffMs.Load(),
 		RetryExhaustedTotal:           s.openaiWSRetryMetrics.retryExhausted.Load(),
 		NonRetryableFastFallbackTotal: s.openaiWSRetryMetrics.nonRetryableFastFallback.Load(),
+		FullCreateReplayTotal:         s.openaiWSRetryMetrics.fullCreateReplay.Load(),
+		FullCreateReplayCappedTotal:   s.openaiWSRetryMetrics.fullCreateReplayCapped.Load(),
+		AccountReselectTotal:          s.openaiWSRetryMetrics.accountReselect.Load(),
+	}
+}
+
+func (s *OpenAIGatewayService) SnapshotOpenAIWSRelayMetrics() OpenAIWSRelayMetricsSnapshot {
+	if s == nil {
+		return OpenAIWSRelayMetricsSnapshot{}
+	}
+	return OpenAIWSRelayMetricsSnapshot{
+		MalformedUpstreamEventTotal: s.openaiWSRelayMetrics.malformedUpstreamEvent.Load(),
+		UsageMissingTurnTotal:       s.openaiWSRelayMetrics.usageMissingTurn.Load(),
+		SlowClientDisconnectTotal:   s.openaiWSRelayMetrics.slowClientDisconnect.Load(),
+		SlowClientDroppedDeltaTotal: s.openaiWSRelayMetrics.slowClientDroppedDelta.Load(),
+		DisconnectDrainActive:       s.openaiWSDisconnectDrains.active.Load(),
+		DisconnectDrainAbortedTotal: s.openaiWSDisconnectDrains.aborted.Load(),
 	}
 }
 
@@ -1020,12 +1156,38 @@ func (s *OpenAIGatewayService) ExtractSessionID(c *gin.Context, body []byte) str
 	return sessionID
 }
 
+// ApplyOpenAIGroupDefaultModel 请求体缺省 model（字段不存在或为空字符串）时注入分组默认模型
+// （group.default_mapped_model），返回注入后的请求体与注入的模型；显式指定的 model 始终优先。
+// 需在会话哈希与账号筛选之前调用，保证调度按实际模型进行。
+func ApplyOpenAIGroupDefaultModel(body []byte, group *Group) ([]byte, string, bool) {
+	if group == nil || len(body) == 0 {
+		return body, "", false
+	}
+	defaultModel := strings.TrimSpace(group.DefaultMappedModel)
+	if defaultModel == "" {
+		return body, "", false
+	}
+	trimmed := bytes.TrimSpace(body)
+	if !gjson.ValidBytes(trimmed) || !gjson.ParseBytes(trimmed).IsObject() {
+		return body, "", false
+	}
+	model := gjson.GetBytes(trimmed, "model")
+	if model.Exists() && (model.Type != gjson.String || strings.TrimSpace(model.String()) != "") {
+		return body, "", false
+	}
+	next, err := sjson.SetBytes(trimmed, "model", defaultModel)
+	if err != nil {
+		return body, "", false
+	}
+	return next, defaultModel, true
+}
+
 // GenerateSessionHash generates a sticky-session hash for OpenAI requests.
 //
 // Priority:
 //  1. Header: session_id
 //  2. Header: conversation_id
-//  3. Body:   prompt_cache_key (opencode)
+//  3. Body:   prompt_cache_key (opencode)，开启 prompt_cache_key_fingerprint_enabled 时混入首条 input 指纹
 func (s *OpenAIGatewayService) GenerateSessionHash(c *gin.Context, body []byte) string {
 	if c == nil {
 		return ""
@@ -1036,7 +1198,11 @@ func (s *OpenAIGatewayService) GenerateSessionHash(c *gin.Context, body []byte)
 		sessionID = strings.TrimSpace(c.GetHeader("conversation_id"))
 	}
 	if sessionID == "" && len(body) > 0 {
-		sessionID = strings.TrimSpace(gjson.GetBytes(body, "prompt_cache_key").String())
+		values := gjson.GetManyBytes(body, "prompt_cache_key", "input")
+		sessionID = strings.TrimSpace(values[0].String())
+		if sessionID != "" && s.openAIPromptCacheKeyFingerprintEnabled() {
+			sessionID = promptCacheKeySessionIDWithFingerprint(sessionID, values[1].Value())
+		}
 	}
 	if sessionID == "" {
 		return ""
@@ -1047,6 +1213,36 @@ func (s *OpenAIGatewayService) GenerateSessionHash(c *gin.Context, body []byte)
 	return currentHash
 }
 
+func (s *OpenAIGatewayService) openAIPromptCacheKeyFingerprintEnabled() bool {
+	return s != nil && s.cfg != nil && s.cfg.Gateway.OpenAIWS.PromptCacheKeyFingerprintEnabled
+}
+
+// promptCacheKeySessionIDWithFingerprint 将首条 input 消息指纹拼入 prompt_cache_key，作为会话标识的二级区分。
+// 指纹基于解码后重新序列化的 JSON（键有序），原始 body 与解码后的 payload 得到一致结果；
+// 全量历史重发时首条消息不变，同一会话多轮的会话标识保持稳定。无 input 时退化为仅用 prompt_cache_key。
+func promptCacheKeySessionIDWithFingerprint(promptCacheKey string, input any) string {
+	var first any
+	switch v := input.(type) {
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return promptCacheKey
+		}
+		first = v
+	case []any:
+		if len(v) == 0 {
+			return promptCacheKey
+		}
+		first = v[0]
+	default:
+		return promptCacheKey
+	}
+	raw, err := json.Marshal(first)
+	if err != nil {
+		return promptCacheKey
+	}
+	return promptCacheKey + "|first_input:" + strconv.FormatUint(xxhash.Sum64(raw), 16)
+}
+
 // GenerateSessionHashWithFallback 先按常规信号生成会话哈希；
 // 当未携带 session_id/conversation_id/prompt_cache_key 时，使用 fallbackSeed 生成稳定哈希。
 // 该方法用于 WS ingress，避免会话信号缺失时发生跨账号漂移。
@@ -1084,8 +1280,8 @@ func (s *OpenAIGatewayService) BindStickySession(ctx context.Context, groupID *i
 		return nil
 	}
 	ttl := openaiStickySessionTTL
-	if s != nil && s.cfg != nil && s.cfg.Gateway.OpenAIWS.StickySessionTTLSeconds > 0 {
-		ttl = time.Duration(s.cfg.Gateway.OpenAIWS.StickySessionTTLSeconds) * time.Second
+	if s != nil && s.cfg != nil && s.openAIWSConfig().StickySessionTTLSeconds > 0 {
+		ttl = time.Duration(s.openAIWSConfig().StickySessionTTLSeconds) * time.Second
 	}
 	return s.setStickySessionAccountID(ctx, groupID, sessionHash, accountID, ttl)
 }
@@ -1645,8 +1841,21 @@ func (s *OpenAIGatewayService) Forward(ctx context.Context, c *gin.Context, acco
 	originalModel := reqModel
 
 	isCodexCLI := openai.IsCodexOfficialClientByHeaders(c.GetHeader("User-Agent"), c.GetHeader("originator")) || (s.cfg != nil && s.cfg.Gateway.ForceCodexCLI)
-	wsDecision := s.getOpenAIWSProtocolResolver().Resolve(account)
+	wsDecision := s.getOpenAIWSProtocolResolver().ResolveForModel(account, reqModel)
 	clientTransport := GetOpenAIClientTransport(c)
+	// 仅 HTTP 模型在非 HTTP 入站请求上按 model_transport_policy 处理：reject 直接拒绝，downgrade 沿用 HTTP 决策。
+	if wsDecision.Reason == openAIWSModelHTTPOnlyReason && clientTransport != OpenAIClientTransportHTTP &&
+		s.openAIWSModelTransportPolicy() == openAIWSModelTransportPolicyReject {
+		if c != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"type":    "invalid_request_error",
+					"message": fmt.Sprintf("Model %s is only available over HTTP.", reqModel),
+				},
+			})
+		}
+		return nil, fmt.Errorf("model %s requires http transport", reqModel)
+	}
 	// 仅允许 WS 入站请求走 WS 上游，避免出现 HTTP -> WS 协议混用。
 	wsDecision = resolveOpenAIWSDecisionByClientTransport(wsDecision, clientTransport)
 	if c != nil {
@@ -3432,7 +3641,7 @@ func (s *OpenAIGatewayService) handleStreamingResponse(ctx context.Context, resp
 	}
 	var lastReadAt int64
 	atomic.StoreInt64(&lastReadAt, time.Now().UnixNano())
-	go func(scanBuf *sseScannerBuf64K) {
+	GoWithPanicStateDump(func() {
 		defer putSSEScannerBuf64K(scanBuf)
 		defer close(events)
 		for scanner.Scan() {
@@ -3444,7 +3653,7 @@ func (s *OpenAIGatewayService) handleStreamingResponse(ctx context.Context, resp
 		if err := scanner.Err(); err != nil {
 			_ = sendEvent(scanEvent{err: err})
 		}
-	}(scanBuf)
+	})
 	defer close(done)
 
 	for {
@@ -4038,11 +4247,17 @@ type OpenAIRecordUsageInput struct {
 func (s *OpenAIGatewayService) RecordUsage(ctx context.Context, input *OpenAIRecordUsageInput) error {
 	result := input.Result
 
+	// 按 usage_missing_policy=unbilled 标记为未计费的 turn 不写入用量记录
+	if result.UsageUnbilled {
+		return nil
+	}
 	// 跳过所有 token 均为零的用量记录——上游未返回 usage 时不应写入数据库
-	if result.Usage.InputTokens == 0 && result.Usage.OutputTokens == 0 &&
+	// （usage_missing_policy=zero 显式要求保留缺失 usage 的零值记录）
+	if !result.UsageMissing && result.Usage.InputTokens == 0 && result.Usage.OutputTokens == 0 &&
 		result.Usage.CacheCreationInputTokens == 0 && result.Usage.CacheReadInputTokens == 0 {
 		return nil
 	}
+	s.emitUsageReport(input, time.Now())
 
 	apiKey := input.APIKey
 	user := input.User
@@ -4413,7 +4628,7 @@ func (s *OpenAIGatewayService) updateCodexUsageSnapshot(ctx context.Context, acc
 		return
 	}
 
-	go func() {
+	GoWithPanicStateDump(func() {
 		updateCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		if shouldPersistUpdates {
@@ -4422,7 +4637,7 @@ func (s *OpenAIGatewayService) updateCodexUsageSnapshot(ctx context.Context, acc
 		if resetAt != nil {
 			_ = s.accountRepo.SetRateLimited(updateCtx, accountID, *resetAt)
 		}
-	}()
+	})
 }
 
 func (s *OpenAIGatewayService) UpdateCodexUsageSnapshotFromHeaders(ctx context.Context, accountID int64, headers http.Header) {
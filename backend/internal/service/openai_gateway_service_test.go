@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -18,6 +19,7 @@ import (
 	"github.com/cespare/xxhash/v2"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
 )
 
 // 编译期接口断言
@@ -54,6 +56,18 @@ func (r stubOpenAIAccountRepo) GetByID(ctx context.Context, id int64) (*Account,
 	return nil, errors.New("account not found")
 }
 
+func (r stubOpenAIAccountRepo) GetByIDs(ctx context.Context, ids []int64) ([]*Account, error) {
+	var result []*Account
+	for _, id := range ids {
+		for i := range r.accounts {
+			if r.accounts[i].ID == id {
+				result = append(result, &r.accounts[i])
+			}
+		}
+	}
+	return result, nil
+}
+
 func (r stubOpenAIAccountRepo) ListSchedulableByGroupIDAndPlatform(ctx context.Context, groupID int64, platform string) ([]Account, error) {
 	var result []Account
 	for _, acc := range r.accounts {
@@ -237,6 +251,67 @@ func TestOpenAIGatewayService_GenerateSessionHashWithFallback(t *testing.T) {
 	require.Equal(t, "", empty)
 }
 
+func TestApplyOpenAIGroupDefaultModel(t *testing.T) {
+	group := &Group{ID: 1, Platform: PlatformOpenAI, DefaultMappedModel: "gpt-5.1"}
+
+	body, model, ok := ApplyOpenAIGroupDefaultModel([]byte(`{"type":"response.create","input":"hi"}`), group)
+	require.True(t, ok)
+	require.Equal(t, "gpt-5.1", model)
+	require.Equal(t, "gpt-5.1", gjson.GetBytes(body, "model").String())
+	require.Equal(t, "hi", gjson.GetBytes(body, "input").String())
+
+	body, _, ok = ApplyOpenAIGroupDefaultModel([]byte(`{"model":"  ","input":"hi"}`), group)
+	require.True(t, ok, "空字符串 model 视为缺省")
+	require.Equal(t, "gpt-5.1", gjson.GetBytes(body, "model").String())
+
+	explicit := []byte(`{"model":"gpt-5.1-codex","input":"hi"}`)
+	body, _, ok = ApplyOpenAIGroupDefaultModel(explicit, group)
+	require.False(t, ok, "显式 model 优先")
+	require.Equal(t, explicit, body)
+
+	for _, raw := range []string{`{"model":123}`, `[{"type":"response.create"}]`, `not-json`} {
+		_, _, ok = ApplyOpenAIGroupDefaultModel([]byte(raw), group)
+		require.False(t, ok, raw)
+	}
+	_, _, ok = ApplyOpenAIGroupDefaultModel([]byte(`{"input":"hi"}`), &Group{ID: 2})
+	require.False(t, ok, "分组未配置默认模型时不注入")
+	_, _, ok = ApplyOpenAIGroupDefaultModel([]byte(`{"input":"hi"}`), nil)
+	require.False(t, ok)
+}
+
+func TestOpenAIGatewayService_GenerateSessionHash_PromptCacheKeyFingerprint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/openai/v1/responses", nil)
+
+	convA := []byte(`{"prompt_cache_key":"shared_key","input":[{"role":"user","content":"write a poem"}]}`)
+	convATurn2 := []byte(`{"prompt_cache_key":"shared_key","input":[{"role":"user","content":"write a poem"},{"role":"assistant","content":"..."},{"role":"user","content":"shorter"}]}`)
+	convB := []byte(`{"prompt_cache_key":"shared_key","input":[{"role":"user","content":"fix my sql"}]}`)
+
+	disabled := &OpenAIGatewayService{cfg: &config.Config{}}
+	require.Equal(t, disabled.GenerateSessionHash(c, convA), disabled.GenerateSessionHash(c, convB), "关闭时保持仅按 prompt_cache_key 派生")
+
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.PromptCacheKeyFingerprintEnabled = true
+	svc := &OpenAIGatewayService{cfg: cfg}
+	hashA := svc.GenerateSessionHash(c, convA)
+	hashB := svc.GenerateSessionHash(c, convB)
+	require.NotEmpty(t, hashA)
+	require.NotEqual(t, hashA, hashB, "共用 prompt_cache_key 但首条消息不同的会话不应共享会话哈希")
+	require.Equal(t, hashA, svc.GenerateSessionHash(c, convATurn2), "同一会话后续轮次应保持会话哈希稳定")
+
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal(convA, &payload))
+	fromPayload, _ := openAIWSSessionHashesFromID(promptCacheKeySessionIDWithFingerprint("shared_key", payload["input"]))
+	require.Equal(t, hashA, fromPayload, "WS 转发按解码后 payload 派生的会话哈希应与原始 body 一致")
+
+	require.Equal(t, disabled.GenerateSessionHash(c, []byte(`{"prompt_cache_key":"shared_key"}`)), svc.GenerateSessionHash(c, []byte(`{"prompt_cache_key":"shared_key"}`)), "无 input 时退化为仅用 prompt_cache_key")
+
+	c.Request.Header.Set("session_id", "sess-explicit")
+	require.Equal(t, svc.GenerateSessionHash(c, convA), svc.GenerateSessionHash(c, convB), "显式 session_id 不受指纹影响")
+}
+
 func (c stubConcurrencyCache) GetAccountWaitingCount(ctx context.Context, accountID int64) (int, error) {
 	if c.waitCounts != nil {
 		if count, ok := c.waitCounts[accountID]; ok {
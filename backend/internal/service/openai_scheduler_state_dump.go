@@ -0,0 +1,174 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// openAISchedulerStateDumpFallbackName 未配置 scheduler_state_dump_path 时 panic 快照写入系统临时目录下的文件名。
+const openAISchedulerStateDumpFallbackName = "sub2api-scheduler-state.json"
+
+// OpenAISchedulerStateDump 调度状态诊断快照：进程被杀或崩溃后用于排查路由异常，仅供参考，不会在启动时回灌。
+type OpenAISchedulerStateDump struct {
+	GeneratedAt      time.Time                             `json:"generated_at"`
+	Reason           string                                `json:"reason"`
+	RuntimeStats     []OpenAIAccountRuntimeStatsSnapshot   `json:"runtime_stats"`
+	CircuitBreakers  []CircuitBreakerInfo                  `json:"circuit_breakers"`
+	Canaries         []OpenAICanaryAccountHealth           `json:"canaries,omitempty"`
+	SchedulerMetrics OpenAIAccountSchedulerMetricsSnapshot `json:"scheduler_metrics"`
+	// ResponseBindingsByAccount 各账号当前未过期的进程内 response_id 绑定数量（不含 response_id 本身）。
+	ResponseBindingsByAccount map[int64]int `json:"response_bindings_by_account"`
+}
+
+// openAISchedulerPanicDumpTarget 启用 --dump-state-on-panic 后登记的网关服务，未启用时为 nil。
+var openAISchedulerPanicDumpTarget atomic.Pointer[OpenAIGatewayService]
+
+// EnableOpenAISchedulerStateDumpOnPanic 启用 panic 时写出调度状态快照，返回的 disable 用于取消登记。
+func (s *OpenAIGatewayService) EnableOpenAISchedulerStateDumpOnPanic() (disable func()) {
+	if s == nil {
+		return func() {}
+	}
+	openAISchedulerPanicDumpTarget.Store(s)
+	return func() {
+		openAISchedulerPanicDumpTarget.CompareAndSwap(s, nil)
+	}
+}
+
+// DumpOpenAISchedulerStateOnPanic 在 recover 到 panic、重新抛出之前调用：已启用时写出 reason=panic 的快照，否则为空操作。
+func DumpOpenAISchedulerStateOnPanic() {
+	s := openAISchedulerPanicDumpTarget.Load()
+	if s == nil {
+		return
+	}
+	path := s.OpenAISchedulerStateDumpPath()
+	if err := s.DumpOpenAISchedulerState(path, "panic"); err != nil {
+		logOpenAIWSModeInfo("scheduler_state_dump_failed path=%s reason=panic err=%v", path, err)
+		return
+	}
+	logOpenAIWSModeInfo("scheduler_state_dumped path=%s reason=panic", path)
+}
+
+// GoWithPanicStateDump 启动 goroutine 执行 fn；fn panic 时先写调度状态快照再原样重新 panic，进程照常崩溃。
+// recover 只能捕获本 goroutine 的 panic，因此需要快照覆盖的后台 goroutine 都应经由此函数启动。
+func GoWithPanicStateDump(fn func()) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				DumpOpenAISchedulerStateOnPanic()
+				panic(r)
+			}
+		}()
+		fn()
+	}()
+}
+
+// SnapshotOpenAISchedulerState 汇总当前进程内的调度状态；不读取数据库或 Redis，可在 panic 处理中调用。
+func (s *OpenAIGatewayService) SnapshotOpenAISchedulerState(reason string) OpenAISchedulerStateDump {
+	dump := OpenAISchedulerStateDump{
+		GeneratedAt: time.Now(),
+		Reason:      reason,
+	}
+	if s == nil {
+		return dump
+	}
+	if scheduler := s.getOpenAIAccountScheduler(); scheduler != nil {
+		dump.RuntimeStats = scheduler.SnapshotRuntimeStats()
+		dump.CircuitBreakers = scheduler.ListCircuitBreakers()
+		dump.Canaries = scheduler.ListCanaryAccounts()
+		dump.SchedulerMetrics = scheduler.SnapshotMetrics()
+	}
+	if store, ok := s.getOpenAIWSStateStore().(*defaultOpenAIWSStateStore); ok {
+		dump.ResponseBindingsByAccount = store.responseBindingCountsByAccount(dump.GeneratedAt)
+	}
+	return dump
+}
+
+// DumpOpenAISchedulerState 将调度状态快照写入 path（先写临时文件再改名，避免留下半截文件）。
+func (s *OpenAIGatewayService) DumpOpenAISchedulerState(path, reason string) error {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return errors.New("scheduler state dump path is empty")
+	}
+	data, err := json.MarshalIndent(s.SnapshotOpenAISchedulerState(reason), "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal scheduler state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create scheduler state dump dir: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write scheduler state dump: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("rename scheduler state dump: %w", err)
+	}
+	return nil
+}
+
+// OpenAISchedulerStateDumpPath 返回快照写入路径：优先使用配置，未配置时回退到系统临时目录。
+func (s *OpenAIGatewayService) OpenAISchedulerStateDumpPath() string {
+	if s != nil && s.cfg != nil {
+		if path := strings.TrimSpace(s.cfg.Gateway.OpenAIWS.SchedulerStateDumpPath); path != "" {
+			return path
+		}
+	}
+	return filepath.Join(os.TempDir(), openAISchedulerStateDumpFallbackName)
+}
+
+// StartOpenAISchedulerStateDumper 按配置周期写入调度状态快照，返回的 stop 会停止写入并补写一次最终快照。
+// 启动时若已存在旧快照（通常来自上次崩溃），先改名为 <path>.prev 保留。未配置路径或间隔时为空操作。
+func (s *OpenAIGatewayService) StartOpenAISchedulerStateDumper() (stop func()) {
+	if s == nil || s.cfg == nil {
+		return func() {}
+	}
+	path := strings.TrimSpace(s.cfg.Gateway.OpenAIWS.SchedulerStateDumpPath)
+	seconds := s.cfg.Gateway.OpenAIWS.SchedulerStateDumpIntervalSeconds
+	if path == "" || seconds <= 0 {
+		return func() {}
+	}
+	if info, err := os.Stat(path); err == nil {
+		prev := path + ".prev"
+		if err := os.Rename(path, prev); err != nil {
+			logOpenAIWSModeInfo("scheduler_state_dump_preserve_failed path=%s err=%v", path, err)
+		} else {
+			logOpenAIWSModeInfo("scheduler_state_dump_previous_found path=%s modified_at=%s", prev, info.ModTime().Format(time.RFC3339))
+		}
+	}
+
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	GoWithPanicStateDump(func() {
+		defer close(doneCh)
+		ticker := time.NewTicker(time.Duration(seconds) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.DumpOpenAISchedulerState(path, "periodic"); err != nil {
+					logOpenAIWSModeInfo("scheduler_state_dump_failed path=%s err=%v", path, err)
+				}
+			case <-stopCh:
+				if err := s.DumpOpenAISchedulerState(path, "shutdown"); err != nil {
+					logOpenAIWSModeInfo("scheduler_state_dump_failed path=%s err=%v", path, err)
+				}
+				return
+			}
+		}
+	})
+	var stopOnce sync.Once
+	return func() {
+		stopOnce.Do(func() {
+			close(stopCh)
+			<-doneCh
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func newOpenAISchedulerStateDumpTestService(path string, intervalSeconds int) *OpenAIGatewayService {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerEnabled = true
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerFailThreshold = 1
+	cfg.Gateway.OpenAIWS.SchedulerStateDumpPath = path
+	cfg.Gateway.OpenAIWS.SchedulerStateDumpIntervalSeconds = intervalSeconds
+	return &OpenAIGatewayService{cfg: cfg, cache: &stubGatewayCache{}}
+}
+
+func readOpenAISchedulerStateDumpForTest(t *testing.T, path string) OpenAISchedulerStateDump {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var dump OpenAISchedulerStateDump
+	require.NoError(t, json.Unmarshal(data, &dump))
+	return dump
+}
+
+func TestOpenAIGatewayService_DumpOpenAISchedulerState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "scheduler.json")
+	svc := newOpenAISchedulerStateDumpTestService(path, 0)
+
+	ttft := 120
+	svc.ReportOpenAIAccountScheduleResult(1, true, &ttft)
+	svc.ReportOpenAIAccountScheduleResult(2, false, nil)
+	store := svc.getOpenAIWSStateStore()
+	require.NoError(t, store.BindResponseAccount(context.Background(), 0, "resp_dump_1", 1, time.Minute))
+	require.NoError(t, store.BindResponseAccount(context.Background(), 0, "resp_dump_2", 1, time.Minute))
+
+	require.NoError(t, svc.DumpOpenAISchedulerState(path, "test"))
+
+	dump := readOpenAISchedulerStateDumpForTest(t, path)
+	require.Equal(t, "test", dump.Reason)
+	require.False(t, dump.GeneratedAt.IsZero())
+	require.Len(t, dump.RuntimeStats, 2)
+	require.Equal(t, int64(1), dump.RuntimeStats[0].AccountID)
+	require.True(t, dump.RuntimeStats[0].HasTTFT)
+	require.Equal(t, openAICircuitBreakerStateOpen, dump.RuntimeStats[1].CircuitState)
+	require.Len(t, dump.CircuitBreakers, 1)
+	require.Equal(t, int64(2), dump.CircuitBreakers[0].AccountID)
+	require.Equal(t, map[int64]int{1: 2}, dump.ResponseBindingsByAccount)
+	_, err := os.Stat(path + ".tmp")
+	require.True(t, os.IsNotExist(err), "写入完成后不应残留临时文件")
+
+	require.Error(t, svc.DumpOpenAISchedulerState(" ", "test"))
+}
+
+func TestOpenAIGatewayService_StartOpenAISchedulerStateDumper(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scheduler.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"reason":"panic"}`), 0o600))
+
+	svc := newOpenAISchedulerStateDumpTestService(path, 1)
+	stop := svc.StartOpenAISchedulerStateDumper()
+
+	previous := readOpenAISchedulerStateDumpForTest(t, path+".prev")
+	require.Equal(t, "panic", previous.Reason, "启动时应保留上次的快照")
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}, 3*time.Second, 20*time.Millisecond)
+	require.Equal(t, "periodic", readOpenAISchedulerStateDumpForTest(t, path).Reason)
+
+	stop()
+	stop()
+	require.Equal(t, "shutdown", readOpenAISchedulerStateDumpForTest(t, path).Reason)
+
+	disabled := newOpenAISchedulerStateDumpTestService("", 1)
+	disabled.StartOpenAISchedulerStateDumper()()
+	require.Equal(t, filepath.Join(os.TempDir(), openAISchedulerStateDumpFallbackName), disabled.OpenAISchedulerStateDumpPath())
+	require.Equal(t, path, svc.OpenAISchedulerStateDumpPath())
+}
+
+// openAISchedulerPanicDumpChildEnv 子进程模式标记：值为快照路径，子进程在后台 goroutine 中 panic 导致进程崩溃。
+const openAISchedulerPanicDumpChildEnv = "SUB2API_TEST_SCHEDULER_PANIC_DUMP_PATH"
+
+func TestGoWithPanicStateDump_DumpsStateBeforeCrash(t *testing.T) {
+	if path := os.Getenv(openAISchedulerPanicDumpChildEnv); path != "" {
+		svc := newOpenAISchedulerStateDumpTestService(path, 0)
+		svc.ReportOpenAIAccountScheduleResult(7, false, nil)
+		svc.EnableOpenAISchedulerStateDumpOnPanic()
+		GoWithPanicStateDump(func() {
+			panic("scheduler panic dump test")
+		})
+		time.Sleep(10 * time.Second)
+		return
+	}
+
+	path := filepath.Join(t.TempDir(), "scheduler.json")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestGoWithPanicStateDump_DumpsStateBeforeCrash$")
+	cmd.Env = append(os.Environ(), openAISchedulerPanicDumpChildEnv+"="+path)
+	output, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr, "后台 goroutine panic 后子进程应崩溃退出")
+	require.Contains(t, string(output), "scheduler panic dump test")
+
+	dump := readOpenAISchedulerStateDumpForTest(t, path)
+	require.Equal(t, "panic", dump.Reason)
+	require.Len(t, dump.RuntimeStats, 1)
+	require.Equal(t, int64(7), dump.RuntimeStats[0].AccountID)
+}
+
+func TestDumpOpenAISchedulerStateOnPanic_NoopUnlessEnabled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scheduler.json")
+	svc := newOpenAISchedulerStateDumpTestService(path, 0)
+
+	DumpOpenAISchedulerStateOnPanic()
+	_, err := os.Stat(path)
+	require.True(t, os.IsNotExist(err), "未启用时不应写快照")
+
+	disable := svc.EnableOpenAISchedulerStateDumpOnPanic()
+	DumpOpenAISchedulerStateOnPanic()
+	require.Equal(t, "panic", readOpenAISchedulerStateDumpForTest(t, path).Reason)
+	require.NoError(t, os.Remove(path))
+
+	disable()
+	DumpOpenAISchedulerStateOnPanic()
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err), "取消登记后不应再写快照")
+}
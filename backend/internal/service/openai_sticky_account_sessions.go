@@ -0,0 +1,151 @@
+package service
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// openAIStickyAccountSessionsSweepInterval 清理已过期粘连记录的最小间隔；两次清理之间的计数可能包含刚过期的会话。
+const openAIStickyAccountSessionsSweepInterval = 10 * time.Second
+
+type openAIStickyAccountSessionKey struct {
+	groupID     int64
+	sessionHash string
+}
+
+type openAIStickyAccountSessionBinding struct {
+	accountID int64
+	expiresAt time.Time
+}
+
+// openAIStickyAccountSessions 在进程内跟踪 (group_id, session_hash) -> 账号的粘连绑定，
+// 用于统计各账号当前绑定的会话数并按 sticky_sessions_per_account_max 限制新的绑定。
+// 绑定本身仍写入 GatewayCache；这里只是本进程写入/续期/删除的镜像，不反映其他实例的绑定。
+type openAIStickyAccountSessions struct {
+	mu        sync.Mutex
+	bindings  map[openAIStickyAccountSessionKey]openAIStickyAccountSessionBinding
+	counts    map[int64]int
+	lastSweep time.Time
+
+	overflowTotal atomic.Int64
+}
+
+func (t *openAIStickyAccountSessions) sweepLocked(now time.Time) {
+	if now.Sub(t.lastSweep) < openAIStickyAccountSessionsSweepInterval {
+		return
+	}
+	t.lastSweep = now
+	for key, binding := range t.bindings {
+		if now.Before(binding.expiresAt) {
+			continue
+		}
+		delete(t.bindings, key)
+		t.decrementLocked(binding.accountID)
+	}
+}
+
+func (t *openAIStickyAccountSessions) decrementLocked(accountID int64) {
+	if t.counts[accountID] <= 1 {
+		delete(t.counts, accountID)
+		return
+	}
+	t.counts[accountID]--
+}
+
+// tryBind 记录一次粘连绑定；会话未绑定到该账号且账号已达上限（maxPerAccount > 0）时拒绝并返回 false。
+// 已绑定到同一账号的会话只续期，不受上限影响。
+func (t *openAIStickyAccountSessions) tryBind(groupID int64, sessionHash string, accountID int64, ttl time.Duration, maxPerAccount int, now time.Time) bool {
+	if t == nil {
+		return true
+	}
+	key := openAIStickyAccountSessionKey{groupID: groupID, sessionHash: strings.TrimSpace(sessionHash)}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.bindings == nil {
+		t.bindings = make(map[openAIStickyAccountSessionKey]openAIStickyAccountSessionBinding)
+		t.counts = make(map[int64]int)
+	}
+	t.sweepLocked(now)
+	previous, exists := t.bindings[key]
+	if exists && !now.Before(previous.expiresAt) {
+		delete(t.bindings, key)
+		t.decrementLocked(previous.accountID)
+		exists = false
+	}
+	if exists && previous.accountID == accountID {
+		t.bindings[key] = openAIStickyAccountSessionBinding{accountID: accountID, expiresAt: now.Add(ttl)}
+		return true
+	}
+	if maxPerAccount > 0 && t.counts[accountID] >= maxPerAccount {
+		t.overflowTotal.Add(1)
+		return false
+	}
+	if exists {
+		t.decrementLocked(previous.accountID)
+	}
+	t.bindings[key] = openAIStickyAccountSessionBinding{accountID: accountID, expiresAt: now.Add(ttl)}
+	t.counts[accountID]++
+	return true
+}
+
+func (t *openAIStickyAccountSessions) refresh(groupID int64, sessionHash string, ttl time.Duration, now time.Time) {
+	if t == nil {
+		return
+	}
+	key := openAIStickyAccountSessionKey{groupID: groupID, sessionHash: strings.TrimSpace(sessionHash)}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if binding, ok := t.bindings[key]; ok && now.Before(binding.expiresAt) {
+		binding.expiresAt = now.Add(ttl)
+		t.bindings[key] = binding
+	}
+}
+
+func (t *openAIStickyAccountSessions) remove(groupID int64, sessionHash string) {
+	if t == nil {
+		return
+	}
+	key := openAIStickyAccountSessionKey{groupID: groupID, sessionHash: strings.TrimSpace(sessionHash)}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if binding, ok := t.bindings[key]; ok {
+		delete(t.bindings, key)
+		t.decrementLocked(binding.accountID)
+	}
+}
+
+// snapshot 返回各账号当前绑定的粘连会话数（仅含计数大于 0 的账号）。
+func (t *openAIStickyAccountSessions) snapshot(now time.Time) map[int64]int {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweepLocked(now)
+	out := make(map[int64]int, len(t.counts))
+	for accountID, count := range t.counts {
+		out[accountID] = count
+	}
+	return out
+}
+
+// openAIStickySessionsPerAccountMax 返回单账号粘连会话数上限；0 表示不限制。
+func (s *OpenAIGatewayService) openAIStickySessionsPerAccountMax() int {
+	if s == nil || s.cfg == nil {
+		return 0
+	}
+	if limit := s.openAIWSConfig().StickySessionsPerAccountMax; limit > 0 {
+		return limit
+	}
+	return 0
+}
+
+// SnapshotOpenAIStickySessionsByAccount 返回本进程内各账号当前绑定的粘连会话数，用于发现粘连会话向单个账号倾斜。
+func (s *OpenAIGatewayService) SnapshotOpenAIStickySessionsByAccount() map[int64]int {
+	if s == nil {
+		return nil
+	}
+	return s.openaiStickyAccountSessions.snapshot(time.Now())
+}
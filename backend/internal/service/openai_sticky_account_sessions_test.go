@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIStickyAccountSessions_CapOverflowFallsThroughToLoadBalance(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(80)
+	magnet := Account{ID: 8001, Platform: PlatformOpenAI, Type: AccountTypeOAuth, Status: StatusActive, Schedulable: true, Concurrency: 5}
+	other := Account{ID: 8002, Platform: PlatformOpenAI, Type: AccountTypeOAuth, Status: StatusActive, Schedulable: true, Concurrency: 5}
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.StickySessionsPerAccountMax = 1
+	cache := &stubGatewayCache{}
+	svc := &OpenAIGatewayService{
+		accountRepo:        stubOpenAIAccountRepo{accounts: []Account{magnet, other}},
+		cache:              cache,
+		cfg:                cfg,
+		concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+	}
+
+	require.NoError(t, svc.BindStickySession(ctx, &groupID, "session_a", magnet.ID))
+	require.Equal(t, map[int64]int{magnet.ID: 1}, svc.SnapshotOpenAIStickySessionsByAccount())
+	// 同一会话重复绑定同一账号只续期，不受上限影响。
+	require.NoError(t, svc.BindStickySession(ctx, &groupID, "session_a", magnet.ID))
+
+	// 超出上限：新会话的粘连不写入，后续请求不命中会话粘连而改走负载均衡。
+	require.NoError(t, svc.BindStickySession(ctx, &groupID, "session_b", magnet.ID))
+	require.NotContains(t, cache.sessionBindings, "openai:session_b")
+	require.Equal(t, map[int64]int{magnet.ID: 1}, svc.SnapshotOpenAIStickySessionsByAccount())
+	require.Equal(t, int64(1), svc.SnapshotOpenAIAccountSchedulerMetrics().StickySessionCapOverflowTotal)
+
+	selection, decision, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "session_b", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+	require.NoError(t, err)
+	require.NotNil(t, selection)
+	require.Equal(t, openAIAccountScheduleLayerLoadBalance, decision.Layer)
+	require.False(t, decision.StickySessionHit)
+
+	// 会话 A 解绑后名额释放，新的绑定可以写入。
+	require.NoError(t, svc.deleteStickySessionAccountID(ctx, &groupID, "session_a"))
+	require.NoError(t, svc.BindStickySession(ctx, &groupID, "session_c", magnet.ID))
+	require.Equal(t, magnet.ID, cache.sessionBindings["openai:session_c"])
+}
+
+func TestOpenAIStickyAccountSessions_RebindAndExpiry(t *testing.T) {
+	var tracker openAIStickyAccountSessions
+	now := time.Now()
+
+	require.True(t, tracker.tryBind(1, "s1", 100, time.Minute, 0, now))
+	require.True(t, tracker.tryBind(1, "s2", 100, time.Minute, 0, now))
+	// 会话改绑到其他账号时，原账号计数同步减少。
+	require.True(t, tracker.tryBind(1, "s2", 200, time.Minute, 0, now))
+	require.Equal(t, map[int64]int{100: 1, 200: 1}, tracker.snapshot(now))
+
+	// 续期后的会话在原 TTL 到期后仍计数；未续期的会话过期后不再计数，也不占用上限。
+	tracker.refresh(1, "s1", 2*time.Minute, now)
+	later := now.Add(time.Minute + openAIStickyAccountSessionsSweepInterval)
+	require.Equal(t, map[int64]int{100: 1}, tracker.snapshot(later))
+	require.True(t, tracker.tryBind(1, "s3", 200, time.Minute, 1, later))
+	require.False(t, tracker.tryBind(1, "s4", 200, time.Minute, 1, later))
+}
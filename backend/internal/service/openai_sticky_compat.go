@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"strings"
 	"sync/atomic"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/cespare/xxhash/v2"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 )
 
 type openAILegacySessionHashContextKey struct{}
@@ -131,8 +133,13 @@ func (s *OpenAIGatewayService) getStickySessionAccountID(ctx context.Context, gr
 
 	accountID, err := s.cache.GetSessionAccountID(ctx, derefGroupID(groupID), primaryKey)
 	if err == nil && accountID > 0 {
+		s.recordOpenAIStickyTTLSkewLookup(derefGroupID(groupID), sessionHash, true)
 		return accountID, nil
 	}
+	if err == nil || errors.Is(err, redis.Nil) {
+		// 只有确认未命中才参与比对，后端故障不代表绑定已过期。
+		s.recordOpenAIStickyTTLSkewLookup(derefGroupID(groupID), sessionHash, false)
+	}
 	if !s.openAISessionHashReadOldFallbackEnabled() {
 		return accountID, err
 	}
@@ -160,9 +167,16 @@ func (s *OpenAIGatewayService) setStickySessionAccountID(ctx context.Context, gr
 		return nil
 	}
 
+	// 账号粘连会话数已达上限：不写入新绑定并清掉旧绑定，该会话后续请求改走负载均衡。
+	if !s.openaiStickyAccountSessions.tryBind(derefGroupID(groupID), sessionHash, accountID, ttl, s.openAIStickySessionsPerAccountMax(), time.Now()) {
+		logOpenAIWSModeInfo("sticky_session_cap_overflow account_id=%d group_id=%d max=%d", accountID, derefGroupID(groupID), s.openAIStickySessionsPerAccountMax())
+		return s.deleteStickySessionAccountID(ctx, groupID, sessionHash)
+	}
 	if err := s.cache.SetSessionAccountID(ctx, derefGroupID(groupID), primaryKey, accountID, ttl); err != nil {
+		s.openaiStickyAccountSessions.remove(derefGroupID(groupID), sessionHash)
 		return err
 	}
+	s.openaiStickyTTLSkew.observeBind(derefGroupID(groupID), sessionHash, ttl, s.openAIStickyTTLSkewSampleRate())
 
 	if !s.openAISessionHashDualWriteOldEnabled() {
 		return nil
@@ -188,6 +202,10 @@ func (s *OpenAIGatewayService) refreshStickySessionTTL(ctx context.Context, grou
 	}
 
 	err := s.cache.RefreshSessionTTL(ctx, derefGroupID(groupID), primaryKey, ttl)
+	if err == nil {
+		s.openaiStickyAccountSessions.refresh(derefGroupID(groupID), sessionHash, ttl, time.Now())
+		s.openaiStickyTTLSkew.observeRefresh(derefGroupID(groupID), sessionHash, ttl)
+	}
 	if !s.openAISessionHashReadOldFallbackEnabled() && !s.openAISessionHashDualWriteOldEnabled() {
 		return err
 	}
@@ -209,6 +227,8 @@ func (s *OpenAIGatewayService) deleteStickySessionAccountID(ctx context.Context,
 	}
 
 	err := s.cache.DeleteSessionAccountID(ctx, derefGroupID(groupID), primaryKey)
+	s.openaiStickyAccountSessions.remove(derefGroupID(groupID), sessionHash)
+	s.openaiStickyTTLSkew.observeDelete(derefGroupID(groupID), sessionHash)
 	if !s.openAISessionHashReadOldFallbackEnabled() && !s.openAISessionHashDualWriteOldEnabled() {
 		return err
 	}
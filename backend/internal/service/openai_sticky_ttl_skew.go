@@ -0,0 +1,206 @@
+package service
+
+import (
+	"math"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// openAIStickyTTLSkewMaxSamples 同时跟踪的采样绑定数上限，达到后不再采样新绑定。
+	openAIStickyTTLSkewMaxSamples = 4096
+	// openAIStickyTTLSkewMinGrace 判定提前/超期的最小容差，吸收缓存往返与调度延迟。
+	openAIStickyTTLSkewMinGrace = time.Second
+	// openAIStickyTTLSkewAlertEvery 告警日志的最小间隔。
+	openAIStickyTTLSkewAlertEvery = time.Minute
+)
+
+type openAIStickyTTLSkewSample struct {
+	boundAt time.Time
+	ttl     time.Duration
+}
+
+// openAIStickyTTLSkewSampler 按比例采样会话粘连绑定，记录写入/续期时间与配置 TTL，
+// 在后续查询缓存时比对实际是否过期：未到期却查不到计为提前过期，已过期仍能查到计为超期存活。
+// 偏差为观测到的绑定寿命与 TTL 之差：提前过期时为负数（寿命上界），超期存活时为正数（寿命下界）。
+type openAIStickyTTLSkewSampler struct {
+	// now 为可注入时钟，nil 时使用 time.Now。
+	now func() time.Time
+
+	mu          sync.Mutex
+	samples     map[openAIStickyAccountSessionKey]openAIStickyTTLSkewSample
+	maxAbsRatio float64
+	lastSkewMs  int64
+	lastAlertAt time.Time
+
+	sampledTotal  atomic.Int64
+	resolvedTotal atomic.Int64
+	earlyTotal    atomic.Int64
+	lateTotal     atomic.Int64
+	alertTotal    atomic.Int64
+}
+
+// OpenAIStickyTTLSkewSnapshot 粘连 TTL 偏差采样统计。
+type OpenAIStickyTTLSkewSnapshot struct {
+	// SampledTotal 采样的绑定数；ResolvedTotal 已得出结论（正常过期或出现偏差）的采样数。
+	SampledTotal  int64
+	ResolvedTotal int64
+	// EarlyExpiryTotal 未到配置 TTL 即查不到的次数；LateExpiryTotal 超过配置 TTL 仍能查到的次数。
+	EarlyExpiryTotal int64
+	LateExpiryTotal  int64
+	// LastSkewMs 最近一次偏差（毫秒，负数为提前过期）；MaxAbsSkewRatio 偏差绝对值占 TTL 比例的最大值。
+	LastSkewMs      int64
+	MaxAbsSkewRatio float64
+	// AlertTotal 偏差比例超过 sticky_ttl_skew_alert_ratio 的次数。
+	AlertTotal int64
+}
+
+func (t *openAIStickyTTLSkewSampler) clock() time.Time {
+	if t.now != nil {
+		return t.now()
+	}
+	return time.Now()
+}
+
+// observeBind 绑定写入后调用：已采样的绑定重新计时，未采样的绑定按 sampleRate 决定是否采样。
+func (t *openAIStickyTTLSkewSampler) observeBind(groupID int64, sessionHash string, ttl time.Duration, sampleRate float64) {
+	if t == nil || ttl <= 0 {
+		return
+	}
+	key := openAIStickyAccountSessionKey{groupID: groupID, sessionHash: strings.TrimSpace(sessionHash)}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, sampled := t.samples[key]; !sampled {
+		if sampleRate <= 0 || (sampleRate < 1 && rand.Float64() >= sampleRate) {
+			return
+		}
+		if t.samples == nil {
+			t.samples = make(map[openAIStickyAccountSessionKey]openAIStickyTTLSkewSample)
+		}
+		if len(t.samples) >= openAIStickyTTLSkewMaxSamples {
+			return
+		}
+		t.sampledTotal.Add(1)
+	}
+	t.samples[key] = openAIStickyTTLSkewSample{boundAt: t.clock(), ttl: ttl}
+}
+
+// observeRefresh 续期成功后调用，采样绑定从续期时刻重新计时。
+func (t *openAIStickyTTLSkewSampler) observeRefresh(groupID int64, sessionHash string, ttl time.Duration) {
+	if t == nil || ttl <= 0 {
+		return
+	}
+	key := openAIStickyAccountSessionKey{groupID: groupID, sessionHash: strings.TrimSpace(sessionHash)}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, sampled := t.samples[key]; sampled {
+		t.samples[key] = openAIStickyTTLSkewSample{boundAt: t.clock(), ttl: ttl}
+	}
+}
+
+// observeDelete 主动删除绑定时调用，删除不属于过期，不参与比对。
+func (t *openAIStickyTTLSkewSampler) observeDelete(groupID int64, sessionHash string) {
+	if t == nil {
+		return
+	}
+	key := openAIStickyAccountSessionKey{groupID: groupID, sessionHash: strings.TrimSpace(sessionHash)}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.samples, key)
+}
+
+// observeLookup 查询缓存后调用（hit 表示查到绑定），返回本次观测到的偏差、采样时的 TTL 与是否需要记录告警日志。
+// 未采样或结果与配置 TTL 一致时 alert 为 false、skew 为 0。
+func (t *openAIStickyTTLSkewSampler) observeLookup(groupID int64, sessionHash string, hit bool, alertRatio float64) (skew time.Duration, ttl time.Duration, alert bool) {
+	if t == nil {
+		return 0, 0, false
+	}
+	key := openAIStickyAccountSessionKey{groupID: groupID, sessionHash: strings.TrimSpace(sessionHash)}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sample, sampled := t.samples[key]
+	if !sampled {
+		return 0, 0, false
+	}
+	now := t.clock()
+	lifetime := now.Sub(sample.boundAt)
+	grace := sample.ttl / 100
+	if grace < openAIStickyTTLSkewMinGrace {
+		grace = openAIStickyTTLSkewMinGrace
+	}
+	switch {
+	case hit && lifetime <= sample.ttl+grace:
+		// 未到期且查得到：继续观测。
+		return 0, 0, false
+	case !hit && lifetime >= sample.ttl-grace:
+		// 按期过期。
+		delete(t.samples, key)
+		t.resolvedTotal.Add(1)
+		return 0, 0, false
+	}
+	delete(t.samples, key)
+	t.resolvedTotal.Add(1)
+	skew = lifetime - sample.ttl
+	if hit {
+		t.lateTotal.Add(1)
+	} else {
+		t.earlyTotal.Add(1)
+	}
+	ratio := math.Abs(float64(skew)) / float64(sample.ttl)
+	t.lastSkewMs = skew.Milliseconds()
+	if ratio > t.maxAbsRatio {
+		t.maxAbsRatio = ratio
+	}
+	if alertRatio > 0 && ratio > alertRatio {
+		t.alertTotal.Add(1)
+		if t.lastAlertAt.IsZero() || now.Sub(t.lastAlertAt) >= openAIStickyTTLSkewAlertEvery {
+			t.lastAlertAt = now
+			alert = true
+		}
+	}
+	return skew, sample.ttl, alert
+}
+
+func (t *openAIStickyTTLSkewSampler) snapshot() OpenAIStickyTTLSkewSnapshot {
+	if t == nil {
+		return OpenAIStickyTTLSkewSnapshot{}
+	}
+	t.mu.Lock()
+	lastSkewMs, maxAbsRatio := t.lastSkewMs, t.maxAbsRatio
+	t.mu.Unlock()
+	return OpenAIStickyTTLSkewSnapshot{
+		SampledTotal:     t.sampledTotal.Load(),
+		ResolvedTotal:    t.resolvedTotal.Load(),
+		EarlyExpiryTotal: t.earlyTotal.Load(),
+		LateExpiryTotal:  t.lateTotal.Load(),
+		LastSkewMs:       lastSkewMs,
+		MaxAbsSkewRatio:  maxAbsRatio,
+		AlertTotal:       t.alertTotal.Load(),
+	}
+}
+
+// recordOpenAIStickyTTLSkewLookup 将一次粘连查询结果交给偏差采样器，偏差超过阈值时按频率限制记录告警日志。
+func (s *OpenAIGatewayService) recordOpenAIStickyTTLSkewLookup(groupID int64, sessionHash string, hit bool) {
+	if s == nil || s.cfg == nil {
+		return
+	}
+	skew, ttl, alert := s.openaiStickyTTLSkew.observeLookup(groupID, sessionHash, hit, s.openAIWSConfig().StickyTTLSkewAlertRatio)
+	if alert {
+		logOpenAIWSModeInfo(
+			"sticky_ttl_skew_alert group_id=%d skew_ms=%d ttl_ms=%d hint=check_ttl_config_or_clock_sync",
+			groupID,
+			skew.Milliseconds(),
+			ttl.Milliseconds(),
+		)
+	}
+}
+
+func (s *OpenAIGatewayService) openAIStickyTTLSkewSampleRate() float64 {
+	if s == nil || s.cfg == nil {
+		return 0
+	}
+	return s.openAIWSConfig().StickyTTLSkewSampleRate
+}
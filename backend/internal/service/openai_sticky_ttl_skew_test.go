@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+// openAIStickyTTLSkewTestCache 按注入时钟执行过期的粘连缓存；ttlScale 模拟缓存侧实际生效的 TTL 与配置不一致。
+type openAIStickyTTLSkewTestCache struct {
+	stubGatewayCache
+	now       func() time.Time
+	ttlScale  float64
+	expiresAt map[string]time.Time
+}
+
+func (c *openAIStickyTTLSkewTestCache) SetSessionAccountID(ctx context.Context, groupID int64, sessionHash string, accountID int64, ttl time.Duration) error {
+	if c.expiresAt == nil {
+		c.expiresAt = make(map[string]time.Time)
+	}
+	c.expiresAt[sessionHash] = c.now().Add(time.Duration(float64(ttl) * c.ttlScale))
+	return c.stubGatewayCache.SetSessionAccountID(ctx, groupID, sessionHash, accountID, ttl)
+}
+
+func (c *openAIStickyTTLSkewTestCache) RefreshSessionTTL(ctx context.Context, groupID int64, sessionHash string, ttl time.Duration) error {
+	if _, ok := c.expiresAt[sessionHash]; ok {
+		c.expiresAt[sessionHash] = c.now().Add(time.Duration(float64(ttl) * c.ttlScale))
+	}
+	return nil
+}
+
+func (c *openAIStickyTTLSkewTestCache) GetSessionAccountID(ctx context.Context, groupID int64, sessionHash string) (int64, error) {
+	if expiresAt, ok := c.expiresAt[sessionHash]; !ok || !c.now().Before(expiresAt) {
+		return 0, redis.Nil
+	}
+	return c.stubGatewayCache.GetSessionAccountID(ctx, groupID, sessionHash)
+}
+
+func newOpenAIStickyTTLSkewTestService(ttlScale float64) (*OpenAIGatewayService, *time.Time) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.StickyTTLSkewSampleRate = 1
+	cfg.Gateway.OpenAIWS.StickyTTLSkewAlertRatio = 0.2
+	svc := &OpenAIGatewayService{
+		cache: &openAIStickyTTLSkewTestCache{now: clock, ttlScale: ttlScale},
+		cfg:   cfg,
+	}
+	svc.openaiStickyTTLSkew.now = clock
+	return svc, &now
+}
+
+func TestOpenAIStickyTTLSkew_DetectsEarlyAndLateExpiry(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(7)
+	ttl := 10 * time.Minute
+
+	// 缓存侧 TTL 只有配置的一半：6 分钟后绑定已消失，偏差约 -4 分钟并触发告警。
+	svc, now := newOpenAIStickyTTLSkewTestService(0.5)
+	require.NoError(t, svc.setStickySessionAccountID(ctx, &groupID, "early", 11, ttl))
+	*now = now.Add(6 * time.Minute)
+	accountID, _ := svc.getStickySessionAccountID(ctx, &groupID, "early")
+	require.Zero(t, accountID)
+	skew := svc.SnapshotOpenAIAccountSchedulerMetrics().StickyTTLSkew
+	require.Equal(t, int64(1), skew.SampledTotal)
+	require.Equal(t, int64(1), skew.EarlyExpiryTotal)
+	require.Equal(t, (-4 * time.Minute).Milliseconds(), skew.LastSkewMs)
+	require.InDelta(t, 0.4, skew.MaxAbsSkewRatio, 1e-9)
+	require.Equal(t, int64(1), skew.AlertTotal)
+
+	// 缓存侧 TTL 为配置的两倍：15 分钟后仍能查到，偏差约 +5 分钟。
+	svc, now = newOpenAIStickyTTLSkewTestService(2)
+	require.NoError(t, svc.setStickySessionAccountID(ctx, &groupID, "late", 12, ttl))
+	*now = now.Add(15 * time.Minute)
+	accountID, err := svc.getStickySessionAccountID(ctx, &groupID, "late")
+	require.NoError(t, err)
+	require.Equal(t, int64(12), accountID)
+	skew = svc.SnapshotOpenAIAccountSchedulerMetrics().StickyTTLSkew
+	require.Equal(t, int64(1), skew.LateExpiryTotal)
+	require.Equal(t, (5 * time.Minute).Milliseconds(), skew.LastSkewMs)
+}
+
+func TestOpenAIStickyTTLSkew_MatchingTTLReportsNoSkew(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(7)
+	ttl := 10 * time.Minute
+	svc, now := newOpenAIStickyTTLSkewTestService(1)
+
+	require.NoError(t, svc.setStickySessionAccountID(ctx, &groupID, "normal", 11, ttl))
+	*now = now.Add(8 * time.Minute)
+	accountID, err := svc.getStickySessionAccountID(ctx, &groupID, "normal")
+	require.NoError(t, err)
+	require.Equal(t, int64(11), accountID)
+	// 续期后从续期时刻重新计时，按期过期不计偏差。
+	require.NoError(t, svc.refreshStickySessionTTL(ctx, &groupID, "normal", ttl))
+	*now = now.Add(10 * time.Minute)
+	accountID, _ = svc.getStickySessionAccountID(ctx, &groupID, "normal")
+	require.Zero(t, accountID)
+
+	// 主动删除的绑定不参与比对。
+	require.NoError(t, svc.setStickySessionAccountID(ctx, &groupID, "deleted", 11, ttl))
+	require.NoError(t, svc.deleteStickySessionAccountID(ctx, &groupID, "deleted"))
+	_, _ = svc.getStickySessionAccountID(ctx, &groupID, "deleted")
+
+	skew := svc.SnapshotOpenAIAccountSchedulerMetrics().StickyTTLSkew
+	require.Equal(t, int64(2), skew.SampledTotal)
+	require.Equal(t, int64(1), skew.ResolvedTotal)
+	require.Zero(t, skew.EarlyExpiryTotal)
+	require.Zero(t, skew.LateExpiryTotal)
+	require.Zero(t, skew.AlertTotal)
+}
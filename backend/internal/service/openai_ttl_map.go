@@ -0,0 +1,101 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// openAITTLMapSweepInterval 清理过期条目的最小间隔；两次清理之间已过期的条目由读取方视为不存在。
+const openAITTLMapSweepInterval = 10 * time.Second
+
+type openAITTLMapEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// openAITTLMap 进程内带过期时间的键值表：写入时按间隔清理过期条目，条目数达到 maxEntries 时淘汰任意条目腾出空间，
+// 避免以会话、API Key 等高基数维度为键的调度状态随进程运行无限增长。零值可用，maxEntries<=0 表示不限制条目数。
+type openAITTLMap[K comparable, V any] struct {
+	maxEntries int
+
+	mu        sync.Mutex
+	entries   map[K]openAITTLMapEntry[V]
+	lastSweep time.Time
+}
+
+func newOpenAITTLMap[K comparable, V any](maxEntries int) *openAITTLMap[K, V] {
+	return &openAITTLMap[K, V]{maxEntries: maxEntries}
+}
+
+// load 返回未过期的条目；已过期的条目顺带删除。
+func (m *openAITTLMap[K, V]) load(key K, now time.Time) (V, bool) {
+	var zero V
+	if m == nil {
+		return zero, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[key]
+	if !ok {
+		return zero, false
+	}
+	if !now.Before(entry.expiresAt) {
+		delete(m.entries, key)
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// store 写入条目并设置过期时间。
+func (m *openAITTLMap[K, V]) store(key K, value V, expiresAt time.Time, now time.Time) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.entries == nil {
+		m.entries = make(map[K]openAITTLMapEntry[V])
+	}
+	m.sweepLocked(now)
+	if _, exists := m.entries[key]; !exists && m.maxEntries > 0 {
+		// map 遍历顺序随机，超限时淘汰的条目近似随机选取，开销与淘汰数量成正比。
+		for evictKey := range m.entries {
+			if len(m.entries) < m.maxEntries {
+				break
+			}
+			delete(m.entries, evictKey)
+		}
+	}
+	m.entries[key] = openAITTLMapEntry[V]{value: value, expiresAt: expiresAt}
+}
+
+func (m *openAITTLMap[K, V]) delete(key K) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	delete(m.entries, key)
+	m.mu.Unlock()
+}
+
+// len 返回当前条目数（可能包含尚未清理的过期条目）。
+func (m *openAITTLMap[K, V]) len() int {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
+
+func (m *openAITTLMap[K, V]) sweepLocked(now time.Time) {
+	if now.Sub(m.lastSweep) < openAITTLMapSweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, entry := range m.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(m.entries, key)
+		}
+	}
+}
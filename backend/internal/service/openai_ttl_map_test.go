@@ -0,0 +1,55 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAITTLMap_LoadTreatsExpiredAsMissing(t *testing.T) {
+	m := newOpenAITTLMap[string, int](0)
+	now := time.Now()
+	m.store("a", 1, now.Add(time.Second), now)
+
+	value, ok := m.load("a", now)
+	require.True(t, ok)
+	require.Equal(t, 1, value)
+
+	_, ok = m.load("a", now.Add(time.Second))
+	require.False(t, ok)
+	require.Zero(t, m.len(), "读取到过期条目时应顺带删除")
+}
+
+func TestOpenAITTLMap_SweepEvictsExpiredEntriesWithoutReads(t *testing.T) {
+	m := newOpenAITTLMap[int, int](0)
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		m.store(i, i, now.Add(time.Minute), now)
+	}
+	require.Equal(t, 100, m.len())
+
+	// 未到清理间隔时不扫描，已过期条目暂时保留。
+	later := now.Add(time.Minute)
+	m.store(1000, 0, later.Add(time.Minute), now.Add(openAITTLMapSweepInterval/2))
+	require.Equal(t, 101, m.len())
+
+	m.store(1001, 0, later.Add(time.Minute), later)
+	require.Equal(t, 2, m.len(), "过期条目应在写入时被周期清理，而不依赖再次读取同一个键")
+}
+
+func TestOpenAITTLMap_MaxEntriesCapsGrowth(t *testing.T) {
+	m := newOpenAITTLMap[int, int](10)
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		m.store(i, i, now.Add(time.Hour), now)
+		require.LessOrEqual(t, m.len(), 10)
+	}
+	value, ok := m.load(99, now)
+	require.True(t, ok, "最新写入的条目不应被淘汰")
+	require.Equal(t, 99, value)
+
+	// 覆盖已有键不触发淘汰。
+	m.store(99, 100, now.Add(time.Hour), now)
+	require.Equal(t, 10, m.len())
+}
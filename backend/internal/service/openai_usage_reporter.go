@@ -0,0 +1,287 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+)
+
+const (
+	usageReporterBufferDefault  = 4096
+	usageReporterDropLogEvery   = 5 * time.Second
+	usageReporterDeliverTimeout = 10 * time.Second
+)
+
+// UsageReport 单个已完成响应的用量事件，供外部计费系统（消息队列、HTTP 等）消费。
+type UsageReport struct {
+	RequestID   string      `json:"request_id,omitempty"`
+	AccountID   int64       `json:"account_id"`
+	AccountType string      `json:"account_type,omitempty"`
+	GroupID     int64       `json:"group_id,omitempty"`
+	UserID      int64       `json:"user_id,omitempty"`
+	APIKeyID    int64       `json:"api_key_id,omitempty"`
+	Model       string      `json:"model"`
+	Usage       OpenAIUsage `json:"usage"`
+	Stream      bool        `json:"stream"`
+	WSMode      bool        `json:"ws_mode"`
+	// PartialUsage/UsageEstimated 与 OpenAIForwardResult 同名字段含义一致，消费方可据此区分非精确用量。
+	PartialUsage   bool      `json:"partial_usage,omitempty"`
+	UsageEstimated bool      `json:"usage_estimated,omitempty"`
+	FirstTokenMs   *int      `json:"first_token_ms,omitempty"`
+	DurationMs     int64     `json:"duration_ms"`
+	StartedAt      time.Time `json:"started_at"`
+	CompletedAt    time.Time `json:"completed_at"`
+}
+
+// UsageReporter 接收已完成响应的用量事件。
+// 由单个后台 goroutine 串行调用，实现无需考虑并发；返回错误仅计数，不会重试。
+type UsageReporter interface {
+	ReportUsage(ctx context.Context, report UsageReport) error
+}
+
+// UsageReporterFunc 函数适配器。
+type UsageReporterFunc func(ctx context.Context, report UsageReport) error
+
+func (f UsageReporterFunc) ReportUsage(ctx context.Context, report UsageReport) error {
+	return f(ctx, report)
+}
+
+// NoopUsageReporter 丢弃所有用量事件。
+type NoopUsageReporter struct{}
+
+func (NoopUsageReporter) ReportUsage(context.Context, UsageReport) error { return nil }
+
+// HTTPUsageReporter 将每条用量事件以 JSON POST 到指定地址，非 2xx 视为失败。
+type HTTPUsageReporter struct {
+	endpoint string
+	headers  http.Header
+	client   *http.Client
+}
+
+// NewHTTPUsageReporter 创建 HTTP 用量上报器；client 为 nil 时使用带超时的默认客户端，headers 会附加到每个请求（如鉴权头）。
+func NewHTTPUsageReporter(endpoint string, headers http.Header, client *http.Client) *HTTPUsageReporter {
+	if client == nil {
+		client = &http.Client{Timeout: usageReporterDeliverTimeout}
+	}
+	return &HTTPUsageReporter{
+		endpoint: endpoint,
+		headers:  headers.Clone(),
+		client:   client,
+	}
+}
+
+func (r *HTTPUsageReporter) ReportUsage(ctx context.Context, report UsageReport) error {
+	if r == nil || r.endpoint == "" {
+		return errors.New("usage reporter endpoint is empty")
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("marshal usage report: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build usage report request: %w", err)
+	}
+	for key, values := range r.headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post usage report: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("post usage report: unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// UsageReporterStats 用量事件投递统计。
+type UsageReporterStats struct {
+	EnqueuedTotal  int64 `json:"enqueued_total"`
+	DeliveredTotal int64 `json:"delivered_total"`
+	FailedTotal    int64 `json:"failed_total"`
+	DroppedTotal   int64 `json:"dropped_total"`
+}
+
+// usageReportDispatcher 以有界缓冲异步投递用量事件：入队永不阻塞请求路径，缓冲满时直接丢弃并计数。
+type usageReportDispatcher struct {
+	reporter UsageReporter
+	ch       chan UsageReport
+	done     chan struct{}
+	stopOnce sync.Once
+	stopped  atomic.Bool
+	mu       sync.RWMutex
+
+	enqueued   atomic.Int64
+	delivered  atomic.Int64
+	failed     atomic.Int64
+	dropped    atomic.Int64
+	lastDropAt atomic.Int64
+}
+
+func newUsageReportDispatcher(reporter UsageReporter, bufferSize int) *usageReportDispatcher {
+	if bufferSize <= 0 {
+		bufferSize = usageReporterBufferDefault
+	}
+	d := &usageReportDispatcher{
+		reporter: reporter,
+		ch:       make(chan UsageReport, bufferSize),
+		done:     make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+func (d *usageReportDispatcher) run() {
+	defer close(d.done)
+	for report := range d.ch {
+		d.deliver(report)
+	}
+}
+
+func (d *usageReportDispatcher) deliver(report UsageReport) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			d.failed.Add(1)
+			logger.LegacyPrintf("service.usage_reporter", "[UsageReporter] reporter panic: %v", recovered)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), usageReporterDeliverTimeout)
+	defer cancel()
+	if err := d.reporter.ReportUsage(ctx, report); err != nil {
+		d.failed.Add(1)
+		logger.LegacyPrintf("service.usage_reporter", "[UsageReporter] report failed: request_id=%s account_id=%d err=%v", report.RequestID, report.AccountID, err)
+		return
+	}
+	d.delivered.Add(1)
+}
+
+func (d *usageReportDispatcher) emit(report UsageReport) {
+	if d == nil {
+		return
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.stopped.Load() {
+		return
+	}
+	select {
+	case d.ch <- report:
+		d.enqueued.Add(1)
+	default:
+		d.recordDrop()
+	}
+}
+
+// recordDrop 计数丢弃事件，并节流输出告警日志。
+func (d *usageReportDispatcher) recordDrop() {
+	dropped := d.dropped.Add(1)
+	now := time.Now().UnixNano()
+	last := d.lastDropAt.Load()
+	if now-last < int64(usageReporterDropLogEvery) || !d.lastDropAt.CompareAndSwap(last, now) {
+		return
+	}
+	logger.LegacyPrintf("service.usage_reporter", "[UsageReporter] buffer full, dropped_total=%d", dropped)
+}
+
+// stop 关闭缓冲并等待已入队事件投递完成。
+func (d *usageReportDispatcher) stop() {
+	if d == nil {
+		return
+	}
+	d.stopOnce.Do(func() {
+		d.mu.Lock()
+		d.stopped.Store(true)
+		close(d.ch)
+		d.mu.Unlock()
+		<-d.done
+	})
+}
+
+func (d *usageReportDispatcher) stats() UsageReporterStats {
+	if d == nil {
+		return UsageReporterStats{}
+	}
+	return UsageReporterStats{
+		EnqueuedTotal:  d.enqueued.Load(),
+		DeliveredTotal: d.delivered.Load(),
+		FailedTotal:    d.failed.Load(),
+		DroppedTotal:   d.dropped.Load(),
+	}
+}
+
+// SetUsageReporter 注册用量上报器，每个写入用量记录的已完成响应触发一次；传入 nil 关闭上报。
+// bufferSize<=0 时使用默认缓冲。替换或关闭时会等待旧上报器处理完已入队事件，应用退出前应传入 nil 以完成投递。
+func (s *OpenAIGatewayService) SetUsageReporter(reporter UsageReporter, bufferSize int) {
+	if s == nil {
+		return
+	}
+	var next *usageReportDispatcher
+	if reporter != nil {
+		next = newUsageReportDispatcher(reporter, bufferSize)
+	}
+	if prev := s.usageReporter.Swap(next); prev != nil {
+		prev.stop()
+	}
+}
+
+// SnapshotUsageReporterStats 返回当前上报器的投递统计；未注册时为零值。
+func (s *OpenAIGatewayService) SnapshotUsageReporterStats() UsageReporterStats {
+	if s == nil {
+		return UsageReporterStats{}
+	}
+	return s.usageReporter.Load().stats()
+}
+
+func (s *OpenAIGatewayService) emitUsageReport(input *OpenAIRecordUsageInput, completedAt time.Time) {
+	if s == nil || input == nil || input.Result == nil {
+		return
+	}
+	dispatcher := s.usageReporter.Load()
+	if dispatcher == nil {
+		return
+	}
+	result := input.Result
+	report := UsageReport{
+		RequestID:      result.RequestID,
+		Model:          result.Model,
+		Usage:          result.Usage,
+		Stream:         result.Stream,
+		WSMode:         result.OpenAIWSMode,
+		PartialUsage:   result.PartialUsage,
+		UsageEstimated: result.UsageEstimated,
+		FirstTokenMs:   result.FirstTokenMs,
+		DurationMs:     result.Duration.Milliseconds(),
+		StartedAt:      completedAt.Add(-result.Duration),
+		CompletedAt:    completedAt,
+	}
+	if result.BillingModel != "" {
+		report.Model = result.BillingModel
+	}
+	if input.Account != nil {
+		report.AccountID = input.Account.ID
+		report.AccountType = input.Account.Type
+	}
+	if input.APIKey != nil {
+		report.APIKeyID = input.APIKey.ID
+		report.GroupID = derefGroupID(input.APIKey.GroupID)
+	}
+	if input.User != nil {
+		report.UserID = input.User.ID
+	}
+	dispatcher.emit(report)
+}
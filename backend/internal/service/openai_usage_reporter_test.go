@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIGatewayServiceRecordUsage_EmitsUsageReport(t *testing.T) {
+	groupID := int64(21)
+	usageRepo := &openAIRecordUsageLogRepoStub{inserted: true}
+	svc := newOpenAIRecordUsageServiceForTest(usageRepo, &openAIRecordUsageUserRepoStub{}, &openAIRecordUsageSubRepoStub{}, &openAIUserGroupRateRepoStub{})
+
+	reports := make(chan UsageReport, 4)
+	svc.SetUsageReporter(UsageReporterFunc(func(_ context.Context, report UsageReport) error {
+		reports <- report
+		return nil
+	}), 0)
+	defer svc.SetUsageReporter(nil, 0)
+
+	firstTokenMs := 120
+	input := &OpenAIRecordUsageInput{
+		Result: &OpenAIForwardResult{
+			RequestID:    "resp_usage_report",
+			Usage:        OpenAIUsage{InputTokens: 10, OutputTokens: 5, CacheReadInputTokens: 2},
+			Model:        "gpt-5.1",
+			Stream:       true,
+			OpenAIWSMode: true,
+			FirstTokenMs: &firstTokenMs,
+			Duration:     2 * time.Second,
+		},
+		APIKey:  &APIKey{ID: 1101, GroupID: i64p(groupID), Group: &Group{ID: groupID, RateMultiplier: 1}},
+		User:    &User{ID: 2101},
+		Account: &Account{ID: 3101, Type: AccountTypeOAuth},
+	}
+	require.NoError(t, svc.RecordUsage(context.Background(), input))
+
+	var report UsageReport
+	select {
+	case report = <-reports:
+	case <-time.After(time.Second):
+		t.Fatal("usage report was not delivered")
+	}
+	require.Equal(t, "resp_usage_report", report.RequestID)
+	require.Equal(t, int64(3101), report.AccountID)
+	require.Equal(t, AccountTypeOAuth, report.AccountType)
+	require.Equal(t, groupID, report.GroupID)
+	require.Equal(t, int64(2101), report.UserID)
+	require.Equal(t, int64(1101), report.APIKeyID)
+	require.Equal(t, "gpt-5.1", report.Model)
+	require.Equal(t, input.Result.Usage, report.Usage)
+	require.True(t, report.Stream)
+	require.True(t, report.WSMode)
+	require.Equal(t, &firstTokenMs, report.FirstTokenMs)
+	require.Equal(t, int64(2000), report.DurationMs)
+	require.Equal(t, 2*time.Second, report.CompletedAt.Sub(report.StartedAt))
+
+	// 全零用量不写入用量记录，也不上报。
+	require.NoError(t, svc.RecordUsage(context.Background(), &OpenAIRecordUsageInput{
+		Result:  &OpenAIForwardResult{RequestID: "resp_zero_usage", Model: "gpt-5.1"},
+		APIKey:  input.APIKey,
+		User:    input.User,
+		Account: input.Account,
+	}))
+	svc.SetUsageReporter(nil, 0)
+	require.Empty(t, reports)
+}
+
+func TestUsageReportDispatcher_DropsOnOverflow(t *testing.T) {
+	block := make(chan struct{})
+	started := make(chan struct{}, 1)
+	d := newUsageReportDispatcher(UsageReporterFunc(func(context.Context, UsageReport) error {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-block
+		return nil
+	}), 1)
+
+	d.emit(UsageReport{RequestID: "r1"})
+	<-started // r1 已被取出并阻塞在 reporter 中
+	d.emit(UsageReport{RequestID: "r2"})
+	d.emit(UsageReport{RequestID: "r3"})
+	require.Equal(t, int64(1), d.stats().DroppedTotal, "缓冲满时应丢弃而不是阻塞")
+
+	close(block)
+	d.stop()
+	stats := d.stats()
+	require.Equal(t, int64(2), stats.EnqueuedTotal)
+	require.Equal(t, int64(2), stats.DeliveredTotal)
+	require.Zero(t, stats.FailedTotal)
+
+	d.emit(UsageReport{RequestID: "after_stop"})
+	require.Equal(t, int64(2), d.stats().EnqueuedTotal)
+}
+
+func TestHTTPUsageReporter_ReportUsage(t *testing.T) {
+	var (
+		gotReport UsageReport
+		gotAuth   string
+		status    = http.StatusNoContent
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		gotAuth = r.Header.Get("Authorization")
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&gotReport))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	reporter := NewHTTPUsageReporter(server.URL, http.Header{"Authorization": []string{"Bearer sink-token"}}, nil)
+	report := UsageReport{RequestID: "resp_http", AccountID: 7, Model: "gpt-5.1", Usage: OpenAIUsage{InputTokens: 3, OutputTokens: 1}}
+	require.NoError(t, reporter.ReportUsage(context.Background(), report))
+	require.Equal(t, "Bearer sink-token", gotAuth)
+	require.Equal(t, report.RequestID, gotReport.RequestID)
+	require.Equal(t, report.Usage, gotReport.Usage)
+
+	status = http.StatusInternalServerError
+	require.ErrorContains(t, reporter.ReportUsage(context.Background(), report), "unexpected status 500")
+
+	require.NoError(t, NoopUsageReporter{}.ReportUsage(context.Background(), report))
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+type openAIWSRetireAccountRepo struct {
+	stubOpenAIAccountRepo
+	deleted map[int64]bool
+}
+
+func (r *openAIWSRetireAccountRepo) GetByID(ctx context.Context, id int64) (*Account, error) {
+	if r.deleted[id] {
+		return nil, ErrAccountNotFound
+	}
+	for i := range r.accounts {
+		if r.accounts[i].ID == id {
+			return &r.accounts[i], nil
+		}
+	}
+	return nil, ErrAccountNotFound
+}
+
+func (r *openAIWSRetireAccountRepo) Delete(ctx context.Context, id int64) error {
+	r.deleted[id] = true
+	return nil
+}
+
+func (r *openAIWSRetireAccountRepo) SetSchedulable(ctx context.Context, id int64, schedulable bool) error {
+	for i := range r.accounts {
+		if r.accounts[i].ID == id {
+			r.accounts[i].Schedulable = schedulable
+		}
+	}
+	return nil
+}
+
+// openAIWSRetireSchedulerCache 仅接受单账号快照写入，分桶锁始终抢占失败以跳过重建。
+type openAIWSRetireSchedulerCache struct {
+	SchedulerCache
+}
+
+func (c *openAIWSRetireSchedulerCache) SetAccount(ctx context.Context, account *Account) error {
+	return nil
+}
+
+func (c *openAIWSRetireSchedulerCache) DeleteAccount(ctx context.Context, accountID int64) error {
+	return nil
+}
+
+func (c *openAIWSRetireSchedulerCache) TryLockBucket(ctx context.Context, bucket SchedulerBucket, ttl time.Duration) (bool, error) {
+	return false, nil
+}
+
+// newOpenAIWSRetireTestGateway 构造带调度快照的网关，并为账号预置一条空闲上游连接。
+func newOpenAIWSRetireTestGateway(t *testing.T, account *Account) (*OpenAIGatewayService, *SchedulerSnapshotService, *openAIWSRetireAccountRepo, *openAIWSConn) {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.MaxConnsPerAccount = 2
+	cfg.Gateway.OpenAIWS.MaxIdlePerAccount = 2
+	repo := &openAIWSRetireAccountRepo{
+		stubOpenAIAccountRepo: stubOpenAIAccountRepo{accounts: []Account{*account}},
+		deleted:               map[int64]bool{},
+	}
+	snapshot := NewSchedulerSnapshotService(&openAIWSRetireSchedulerCache{}, nil, repo, nil, cfg)
+	svc := NewOpenAIGatewayService(repo, nil, nil, nil, nil, nil, nil, cfg, snapshot, nil, nil, nil, nil, nil, nil, nil)
+	pool := svc.getOpenAIWSConnPool()
+	pool.setClientDialerForTest(&openAIWSFakeDialer{})
+	t.Cleanup(pool.Close)
+
+	lease, err := pool.Acquire(context.Background(), openAIWSAcquireRequest{Account: account, WSURL: "wss://example.com/v1/responses"})
+	require.NoError(t, err)
+	conn := lease.conn
+	lease.Release()
+	_, ok := pool.getAccountPool(account.ID)
+	require.True(t, ok)
+	return svc, snapshot, repo, conn
+}
+
+func requireOpenAIWSAccountRetired(t *testing.T, svc *OpenAIGatewayService, accountID int64, conn *openAIWSConn) {
+	t.Helper()
+	_, ok := svc.getOpenAIWSConnPool().getAccountPool(accountID)
+	require.False(t, ok, "账号删除/停用后账户池应被移除")
+	select {
+	case <-conn.closedCh:
+	default:
+		t.Fatal("账号删除/停用后空闲连接应被关闭")
+	}
+}
+
+func TestAdminService_DeleteAccount_RetiresOpenAIWSConnections(t *testing.T) {
+	account := &Account{ID: 5201, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 2}
+	gateway, _, repo, conn := newOpenAIWSRetireTestGateway(t, account)
+	admin := &adminServiceImpl{accountRepo: repo}
+	admin.SetOpenAIWSAccountRetirer(gateway)
+
+	require.NoError(t, admin.DeleteAccount(context.Background(), account.ID))
+	requireOpenAIWSAccountRetired(t, gateway, account.ID, conn)
+}
+
+func TestAdminService_SetAccountSchedulable_RetiresOpenAIWSConnectionsOnDisable(t *testing.T) {
+	account := &Account{ID: 5202, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 2}
+	gateway, _, repo, conn := newOpenAIWSRetireTestGateway(t, account)
+	admin := &adminServiceImpl{accountRepo: repo}
+	admin.SetOpenAIWSAccountRetirer(gateway)
+
+	_, err := admin.SetAccountSchedulable(context.Background(), account.ID, true)
+	require.NoError(t, err)
+	_, ok := gateway.getOpenAIWSConnPool().getAccountPool(account.ID)
+	require.True(t, ok, "恢复调度不应下线连接")
+
+	_, err = admin.SetAccountSchedulable(context.Background(), account.ID, false)
+	require.NoError(t, err)
+	requireOpenAIWSAccountRetired(t, gateway, account.ID, conn)
+}
+
+func TestSchedulerSnapshotService_AccountEvent_RetiresOpenAIWSConnections(t *testing.T) {
+	t.Run("account_deleted", func(t *testing.T) {
+		account := &Account{ID: 5203, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 2}
+		gateway, snapshot, repo, conn := newOpenAIWSRetireTestGateway(t, account)
+		repo.deleted[account.ID] = true
+
+		accountID := account.ID
+		require.NoError(t, snapshot.handleAccountEvent(context.Background(), &accountID, nil))
+		requireOpenAIWSAccountRetired(t, gateway, account.ID, conn)
+	})
+
+	t.Run("account_disabled", func(t *testing.T) {
+		account := &Account{ID: 5204, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 2}
+		gateway, snapshot, repo, conn := newOpenAIWSRetireTestGateway(t, account)
+		repo.accounts[0].Status = StatusDisabled
+
+		accountID := account.ID
+		require.NoError(t, snapshot.handleAccountEvent(context.Background(), &accountID, nil))
+		requireOpenAIWSAccountRetired(t, gateway, account.ID, conn)
+	})
+
+	t.Run("account_still_active", func(t *testing.T) {
+		account := &Account{ID: 5205, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 2}
+		gateway, snapshot, _, conn := newOpenAIWSRetireTestGateway(t, account)
+
+		accountID := account.ID
+		require.NoError(t, snapshot.handleAccountEvent(context.Background(), &accountID, nil))
+		_, ok := gateway.getOpenAIWSConnPool().getAccountPool(account.ID)
+		require.True(t, ok)
+		select {
+		case <-conn.closedCh:
+			t.Fatal("正常账号变更不应关闭连接")
+		default:
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	openAIWSStaleCallOutputPolicyOff        = "off"
+	openAIWSStaleCallOutputPolicyDrop       = "drop"
+	openAIWSStaleCallOutputPolicyFullCreate = "full_create"
+)
+
+// openAIWSIngressStaleCallOutputPolicy 返回 function_call_output 的 call_id 与上一轮不匹配时的处理策略。
+func (s *OpenAIGatewayService) openAIWSIngressStaleCallOutputPolicy() string {
+	if s == nil || s.cfg == nil {
+		return openAIWSStaleCallOutputPolicyOff
+	}
+	switch strings.TrimSpace(s.cfg.Gateway.OpenAIWS.IngressStaleFunctionCallOutputPolicy) {
+	case openAIWSStaleCallOutputPolicyDrop:
+		return openAIWSStaleCallOutputPolicyDrop
+	case openAIWSStaleCallOutputPolicyFullCreate:
+		return openAIWSStaleCallOutputPolicyFullCreate
+	default:
+		return openAIWSStaleCallOutputPolicyOff
+	}
+}
+
+// collectOpenAIWSEventCallIDs 从上游事件中收集工具调用的 call_id（output_item 事件的 item.call_id，
+// 以及 completed/done 事件 response.output[].call_id）。
+func collectOpenAIWSEventCallIDs(message []byte, eventType string, into map[string]struct{}) {
+	if into == nil || len(message) == 0 || !bytes.Contains(message, []byte(`"call_id"`)) {
+		return
+	}
+	switch strings.TrimSpace(eventType) {
+	case "response.output_item.added", "response.output_item.done":
+		if callID := strings.TrimSpace(gjson.GetBytes(message, "item.call_id").String()); callID != "" {
+			into[callID] = struct{}{}
+		}
+	case "response.completed", "response.done":
+		for _, callID := range gjson.GetBytes(message, "response.output.#.call_id").Array() {
+			if id := strings.TrimSpace(callID.String()); id != "" {
+				into[id] = struct{}{}
+			}
+		}
+	}
+}
+
+func isOpenAIWSToolCallOutputItemType(itemType string) bool {
+	switch itemType {
+	case "function_call_output", "custom_tool_call_output":
+		return true
+	default:
+		return false
+	}
+}
+
+// findOpenAIWSStaleFunctionCallOutputs 返回 payload 中 call_id 不在 pending 集合内的工具输出 call_id。
+// 同一 input 内自带对应调用项（如全量 create）的输出视为有效。
+func findOpenAIWSStaleFunctionCallOutputs(payload []byte, pending map[string]struct{}) []string {
+	input := gjson.GetBytes(payload, "input")
+	if !input.IsArray() {
+		return nil
+	}
+	inlineCalls := make(map[string]struct{})
+	input.ForEach(func(_, item gjson.Result) bool {
+		itemType := item.Get("type").String()
+		if !isOpenAIWSToolCallOutputItemType(itemType) {
+			if callID := strings.TrimSpace(item.Get("call_id").String()); callID != "" {
+				inlineCalls[callID] = struct{}{}
+			}
+		}
+		return true
+	})
+	var stale []string
+	input.ForEach(func(_, item gjson.Result) bool {
+		if !isOpenAIWSToolCallOutputItemType(item.Get("type").String()) {
+			return true
+		}
+		callID := strings.TrimSpace(item.Get("call_id").String())
+		if _, ok := pending[callID]; ok {
+			return true
+		}
+		if _, ok := inlineCalls[callID]; ok {
+			return true
+		}
+		stale = append(stale, callID)
+		return true
+	})
+	return stale
+}
+
+// dropOpenAIWSFunctionCallOutputsByCallID 从 input 中移除指定 call_id 的工具输出项，返回移除数量。
+func dropOpenAIWSFunctionCallOutputsByCallID(payload []byte, callIDs []string) ([]byte, int, error) {
+	if len(callIDs) == 0 {
+		return payload, 0, nil
+	}
+	drop := make(map[string]struct{}, len(callIDs))
+	for _, callID := range callIDs {
+		drop[callID] = struct{}{}
+	}
+	input := gjson.GetBytes(payload, "input")
+	if !input.IsArray() {
+		return payload, 0, nil
+	}
+	kept := make([]json.RawMessage, 0, len(input.Array()))
+	removed := 0
+	input.ForEach(func(_, item gjson.Result) bool {
+		if isOpenAIWSToolCallOutputItemType(item.Get("type").String()) {
+			if _, ok := drop[strings.TrimSpace(item.Get("call_id").String())]; ok {
+				removed++
+				return true
+			}
+		}
+		kept = append(kept, json.RawMessage(item.Raw))
+		return true
+	})
+	if removed == 0 {
+		return payload, 0, nil
+	}
+	keptRaw, err := json.Marshal(kept)
+	if err != nil {
+		return nil, 0, err
+	}
+	updated, err := sjson.SetRawBytes(payload, "input", keptRaw)
+	if err != nil {
+		return nil, 0, err
+	}
+	return updated, removed, nil
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestFindOpenAIWSStaleFunctionCallOutputs(t *testing.T) {
+	pending := map[string]struct{}{"call_ok": {}}
+	payload := []byte(`{"input":[` +
+		`{"type":"function_call_output","call_id":"call_ok","output":"1"},` +
+		`{"type":"function_call_output","call_id":"call_stale","output":"2"},` +
+		`{"type":"function_call","call_id":"call_inline","name":"f","arguments":"{}"},` +
+		`{"type":"function_call_output","call_id":"call_inline","output":"3"}]}`)
+	require.Equal(t, []string{"call_stale"}, findOpenAIWSStaleFunctionCallOutputs(payload, pending))
+
+	updated, removed, err := dropOpenAIWSFunctionCallOutputsByCallID(payload, []string{"call_stale"})
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	require.Equal(t, int64(3), gjson.GetBytes(updated, "input.#").Int())
+	require.False(t, gjson.GetBytes(updated, `input.#(call_id=="call_stale")`).Exists())
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_StaleFunctionCallOutput(t *testing.T) {
+	newUpstream := func() *openAIWSCaptureConn {
+		return &openAIWSCaptureConn{
+			events: [][]byte{
+				[]byte(`{"type":"response.output_item.done","item":{"type":"function_call","call_id":"call_ok","name":"shell","arguments":"{}"}}`),
+				[]byte(`{"type":"response.completed","response":{"id":"resp_call_guard_1","model":"gpt-5.1","output":[{"type":"function_call","call_id":"call_ok"}],"usage":{"input_tokens":1,"output_tokens":1}}}`),
+				[]byte(`{"type":"response.completed","response":{"id":"resp_call_guard_2","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+			},
+		}
+	}
+	account := &Account{
+		ID:          119,
+		Name:        "openai-ingress-call-id-guard",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{"api_key": "sk-test"},
+		Extra:       map[string]any{"responses_websockets_v2_enabled": true},
+	}
+	clientMessages := [][]byte{
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"input":[{"type":"input_text","text":"run"}]}`),
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"previous_response_id":"resp_call_guard_1","input":[` +
+			`{"type":"function_call_output","call_id":"call_ok","output":"done"},` +
+			`{"type":"function_call_output","call_id":"call_mismatch","output":"stale"}]}`),
+	}
+
+	cases := []struct {
+		policy string
+		check  func(t *testing.T, second map[string]any)
+	}{
+		{
+			policy: "off",
+			check: func(t *testing.T, second map[string]any) {
+				require.Equal(t, "resp_call_guard_1", second["previous_response_id"])
+				require.Len(t, second["input"], 2, "off 策略应原样转发")
+			},
+		},
+		{
+			policy: "drop",
+			check: func(t *testing.T, second map[string]any) {
+				require.Equal(t, "resp_call_guard_1", second["previous_response_id"])
+				input, ok := second["input"].([]any)
+				require.True(t, ok)
+				require.Len(t, input, 1, "drop 策略应移除不匹配的 function_call_output")
+				require.Equal(t, "call_ok", input[0].(map[string]any)["call_id"])
+			},
+		},
+		{
+			policy: "full_create",
+			check: func(t *testing.T, second map[string]any) {
+				_, hasPrev := second["previous_response_id"]
+				require.False(t, hasPrev, "full_create 策略应去掉 previous_response_id")
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.policy, func(t *testing.T) {
+			cfg := newOpenAIWSIngressCaptureTestConfig()
+			cfg.Gateway.OpenAIWS.IngressStaleFunctionCallOutputPolicy = tc.policy
+			upstream := newUpstream()
+			received := runOpenAIWSIngressSessionForTest(t, cfg, account, "sk-test", upstream, clientMessages)
+			require.NotEmpty(t, received)
+
+			upstream.mu.Lock()
+			writes := append([]map[string]any(nil), upstream.writes...)
+			upstream.mu.Unlock()
+			require.Len(t, writes, 2)
+			tc.check(t, writes[1])
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+)
+
+// openAIWSHotReloadKeys 列出可在运行时热更新的 gateway.openai_ws 配置键。
+// 这些键只通过 openAIWSConfig() 读取，替换快照后下一次调度/绑定即生效；
+// 其余键（连接池、超时、协议开关等）在组件初始化时或经由共享 cfg 读取，变更后需重启。
+var openAIWSHotReloadKeys = map[string]struct{}{
+	"lb_top_k":                                              {},
+	"sticky_session_ttl_seconds":                            {},
+	"sticky_sessions_per_account_max":                       {},
+	"sticky_ttl_skew_sample_rate":                           {},
+	"sticky_ttl_skew_alert_ratio":                           {},
+	"api_key_sticky_window_seconds":                         {},
+	"sticky_response_id_ttl_seconds":                        {},
+	"session_response_max_age_seconds":                      {},
+	"max_concurrent_recovery_reconnects":                    {},
+	"ingress_session_create_per_minute":                     {},
+	"ingress_session_create_burst":                          {},
+	"client_disconnect_drain_max_concurrency":               {},
+	"inject_gateway_turn_id":                                {},
+	"state_store_failure_mode":                              {},
+	"sticky_previous_response_ttl_seconds":                  {},
+	"scheduler_max_consecutive_sticky_turns":                {},
+	"scheduler_max_sticky_lifetime_seconds":                 {},
+	"scheduler_score_weights":                               {},
+	"scheduler_circuit_breaker_enabled":                     {},
+	"scheduler_circuit_breaker_fail_threshold":              {},
+	"scheduler_circuit_breaker_cooldown_seconds":            {},
+	"scheduler_circuit_breaker_half_open_max":               {},
+	"scheduler_circuit_breaker_warmup_seconds":              {},
+	"scheduler_circuit_breaker_auto_disable_trips":          {},
+	"scheduler_circuit_breaker_auto_disable_window_seconds": {},
+	"scheduler_circuit_breaker_group_overrides":             {},
+	"scheduler_half_open_probe_strategy":                    {},
+	"scheduler_zero_concurrency_mode":                       {},
+	"scheduler_assumed_concurrency":                         {},
+	"scheduler_candidate_prefilter_threshold":               {},
+	"scheduler_candidate_prefilter_size":                    {},
+	"scheduler_runtime_stats_replica_interval_ms":           {},
+	"scheduler_min_score_threshold":                         {},
+	"scheduler_error_rate_ewma_alpha":                       {},
+	"scheduler_ttft_ewma_alpha":                             {},
+	"scheduler_transport_fallback_group_ids":                {},
+	"scheduler_region_affinity_enabled":                     {},
+	"scheduler_region_header":                               {},
+}
+
+// openAIWSReloadReportedSections 为热加载时会比对并提示“需重启”的顶层配置段；
+// 其余段（如 jwt/totp 等可能在启动期被自动补齐的密钥）不参与比对，避免误报。
+var openAIWSReloadReportedSections = map[string]struct{}{
+	"server":  {},
+	"gateway": {},
+}
+
+// OpenAIWSConfigReloadResult 描述一次配置热加载的结果，键均为完整配置路径（如 gateway.openai_ws.lb_top_k）。
+type OpenAIWSConfigReloadResult struct {
+	// Applied 已在运行中生效的变更键。
+	Applied []string
+	// RestartRequired 已变更但需重启进程才能生效的键。
+	RestartRequired []string
+}
+
+// openAIWSConfig 返回当前生效的 gateway.openai_ws 配置；热加载后指向新快照。
+// 调用方需保证 s.cfg 非 nil。
+func (s *OpenAIGatewayService) openAIWSConfig() *config.GatewayOpenAIWSConfig {
+	if reloaded := s.openaiWSReloadedConfig.Load(); reloaded != nil {
+		return reloaded
+	}
+	return &s.cfg.Gateway.OpenAIWS
+}
+
+// ReloadOpenAIWSConfig 将 next 中可热更新的 gateway.openai_ws 字段应用到运行中的服务，不影响已建立的连接。
+// 合并后的配置先整体校验，校验失败时保持原配置不变；不可热更新的变更仅在结果中报告。
+func (s *OpenAIGatewayService) ReloadOpenAIWSConfig(next *config.Config) (OpenAIWSConfigReloadResult, error) {
+	var result OpenAIWSConfigReloadResult
+	if s == nil || s.cfg == nil {
+		return result, errors.New("openai gateway service not initialized")
+	}
+	if next == nil {
+		return result, errors.New("reload config is nil")
+	}
+
+	current := s.openAIWSConfig()
+	merged := *current
+	mergedValue := reflect.ValueOf(&merged).Elem()
+	currentValue := reflect.ValueOf(*current)
+	nextValue := reflect.ValueOf(next.Gateway.OpenAIWS)
+	wsType := mergedValue.Type()
+	for i := 0; i < wsType.NumField(); i++ {
+		if reflect.DeepEqual(currentValue.Field(i).Interface(), nextValue.Field(i).Interface()) {
+			continue
+		}
+		key := configFieldKey(wsType.Field(i))
+		if _, ok := openAIWSHotReloadKeys[key]; ok {
+			mergedValue.Field(i).Set(nextValue.Field(i))
+			result.Applied = append(result.Applied, "gateway.openai_ws."+key)
+			continue
+		}
+		result.RestartRequired = append(result.RestartRequired, "gateway.openai_ws."+key)
+	}
+	result.RestartRequired = append(result.RestartRequired, diffOpenAIWSReloadSections(s.cfg, next)...)
+
+	if len(result.Applied) == 0 {
+		return result, nil
+	}
+	candidate := *s.cfg
+	candidate.Gateway.OpenAIWS = merged
+	if err := candidate.Validate(); err != nil {
+		return OpenAIWSConfigReloadResult{}, fmt.Errorf("validate reloaded config: %w", err)
+	}
+	s.openaiWSReloadedConfig.Store(&merged)
+	return result, nil
+}
+
+// diffOpenAIWSReloadSections 比对 server 段与 gateway 段中 openai_ws 以外的字段，返回已变更的配置键。
+func diffOpenAIWSReloadSections(current, next *config.Config) []string {
+	var changed []string
+	currentValue := reflect.ValueOf(*current)
+	nextValue := reflect.ValueOf(*next)
+	cfgType := currentValue.Type()
+	for i := 0; i < cfgType.NumField(); i++ {
+		key := configFieldKey(cfgType.Field(i))
+		if _, ok := openAIWSReloadReportedSections[key]; !ok {
+			continue
+		}
+		if key != "gateway" {
+			if !reflect.DeepEqual(currentValue.Field(i).Interface(), nextValue.Field(i).Interface()) {
+				changed = append(changed, key)
+			}
+			continue
+		}
+		gatewayCurrent := currentValue.Field(i)
+		gatewayNext := nextValue.Field(i)
+		gatewayType := gatewayCurrent.Type()
+		for j := 0; j < gatewayType.NumField(); j++ {
+			subKey := configFieldKey(gatewayType.Field(j))
+			if subKey == "openai_ws" {
+				continue
+			}
+			if !reflect.DeepEqual(gatewayCurrent.Field(j).Interface(), gatewayNext.Field(j).Interface()) {
+				changed = append(changed, "gateway."+subKey)
+			}
+		}
+	}
+	return changed
+}
+
+// configFieldKey 返回字段的 mapstructure 键名，未声明时退化为字段名。
+func configFieldKey(field reflect.StructField) string {
+	if tag := field.Tag.Get("mapstructure"); tag != "" {
+		if name, _, _ := strings.Cut(tag, ","); name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
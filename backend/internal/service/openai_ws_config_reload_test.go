@@ -0,0 +1,65 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func newOpenAIWSConfigReloadTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg, err := config.LoadForBootstrap()
+	require.NoError(t, err)
+	// 运行中的配置已由数据库补齐 jwt.secret。
+	cfg.JWT.Secret = strings.Repeat("a", 32)
+	return cfg
+}
+
+func TestOpenAIGatewayService_ReloadOpenAIWSConfig_AppliesSchedulerWeights(t *testing.T) {
+	cfg := newOpenAIWSConfigReloadTestConfig(t)
+	svc := &OpenAIGatewayService{cfg: cfg}
+	require.Equal(t, 1.0, svc.openAIWSSchedulerWeights().Priority)
+
+	next := newOpenAIWSConfigReloadTestConfig(t)
+	next.Gateway.OpenAIWS.SchedulerScoreWeights.Priority = 0.2
+	next.Gateway.OpenAIWS.SchedulerScoreWeights.TTFT = 2.0
+	next.Gateway.OpenAIWS.LBTopK = 3
+	next.Gateway.OpenAIWS.MaxConnsPerAccount = cfg.Gateway.OpenAIWS.MaxConnsPerAccount + 1
+	next.Server.Port = cfg.Server.Port + 1
+
+	result, err := svc.ReloadOpenAIWSConfig(next)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"gateway.openai_ws.lb_top_k", "gateway.openai_ws.scheduler_score_weights"}, result.Applied)
+	require.ElementsMatch(t, []string{"gateway.openai_ws.max_conns_per_account", "server"}, result.RestartRequired)
+
+	weights := svc.openAIWSSchedulerWeights()
+	require.Equal(t, 0.2, weights.Priority)
+	require.Equal(t, 2.0, weights.TTFT)
+	require.Equal(t, cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Load, weights.Load)
+	require.Equal(t, 3, svc.openAIWSLBTopK())
+	require.Equal(t, cfg.Gateway.OpenAIWS.MaxConnsPerAccount, svc.openAIWSConfig().MaxConnsPerAccount, "不可热更新字段应保持原值")
+	require.Equal(t, 1.0, cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Priority, "共享 cfg 不应被就地修改")
+
+	// 再次加载相同配置不应产生变更。
+	result, err = svc.ReloadOpenAIWSConfig(next)
+	require.NoError(t, err)
+	require.Empty(t, result.Applied)
+}
+
+func TestOpenAIGatewayService_ReloadOpenAIWSConfig_RejectsInvalidConfig(t *testing.T) {
+	cfg := newOpenAIWSConfigReloadTestConfig(t)
+	svc := &OpenAIGatewayService{cfg: cfg}
+
+	next := newOpenAIWSConfigReloadTestConfig(t)
+	next.Gateway.OpenAIWS.SchedulerScoreWeights.Priority = 0.5
+	next.Gateway.OpenAIWS.SchedulerScoreWeights.Load = -1
+
+	_, err := svc.ReloadOpenAIWSConfig(next)
+	require.ErrorContains(t, err, "gateway.openai_ws.scheduler_score_weights.* must be non-negative")
+	require.Equal(t, 1.0, svc.openAIWSSchedulerWeights().Priority, "校验失败时应保留原配置")
+
+	_, err = svc.ReloadOpenAIWSConfig(nil)
+	require.Error(t, err)
+}
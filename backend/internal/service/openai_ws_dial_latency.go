@@ -0,0 +1,131 @@
+package service
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// openAIWSDialLatencyBucketsMs 为上游 WS 建连耗时直方图的桶上界（毫秒），最后一个桶为 +Inf。
+var openAIWSDialLatencyBucketsMs = [...]int64{50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// openAIWSDialLatencyHistogram 记录单账号成功建连（含 TLS 与 WS 握手）的耗时分布，
+// 与 TTFT（首事件延迟）互补，用于定位建连慢的账号。失败的建连不计入。
+type openAIWSDialLatencyHistogram struct {
+	counts [len(openAIWSDialLatencyBucketsMs) + 1]atomic.Int64
+	total  atomic.Int64
+	sumMs  atomic.Int64
+	maxMs  atomic.Int64
+}
+
+// OpenAIWSDialLatencyBucket 直方图单个桶；UpperMs=0 表示 +Inf 桶。Count 为落入该桶的次数（非累计）。
+type OpenAIWSDialLatencyBucket struct {
+	UpperMs int64
+	Count   int64
+}
+
+// OpenAIWSDialLatencySnapshot 单账号建连耗时分布快照；分位值取所在桶的上界，落入 +Inf 桶时取观测最大值。
+type OpenAIWSDialLatencySnapshot struct {
+	Count   int64
+	SumMs   int64
+	MaxMs   int64
+	P50Ms   int64
+	P95Ms   int64
+	P99Ms   int64
+	Buckets []OpenAIWSDialLatencyBucket
+}
+
+func (h *openAIWSDialLatencyHistogram) observe(latency time.Duration) {
+	ms := latency.Milliseconds()
+	if ms < 0 {
+		ms = 0
+	}
+	idx := len(openAIWSDialLatencyBucketsMs)
+	for i, upper := range openAIWSDialLatencyBucketsMs {
+		if ms <= upper {
+			idx = i
+			break
+		}
+	}
+	h.counts[idx].Add(1)
+	h.total.Add(1)
+	h.sumMs.Add(ms)
+	for {
+		current := h.maxMs.Load()
+		if ms <= current || h.maxMs.CompareAndSwap(current, ms) {
+			return
+		}
+	}
+}
+
+func (h *openAIWSDialLatencyHistogram) snapshot() OpenAIWSDialLatencySnapshot {
+	snapshot := OpenAIWSDialLatencySnapshot{
+		SumMs:   h.sumMs.Load(),
+		MaxMs:   h.maxMs.Load(),
+		Buckets: make([]OpenAIWSDialLatencyBucket, 0, len(h.counts)),
+	}
+	for i := range h.counts {
+		bucket := OpenAIWSDialLatencyBucket{Count: h.counts[i].Load()}
+		if i < len(openAIWSDialLatencyBucketsMs) {
+			bucket.UpperMs = openAIWSDialLatencyBucketsMs[i]
+		}
+		snapshot.Count += bucket.Count
+		snapshot.Buckets = append(snapshot.Buckets, bucket)
+	}
+	snapshot.P50Ms = snapshot.quantileMs(0.50)
+	snapshot.P95Ms = snapshot.quantileMs(0.95)
+	snapshot.P99Ms = snapshot.quantileMs(0.99)
+	return snapshot
+}
+
+// quantileMs 按桶估算分位值；无样本时返回 0。
+func (s OpenAIWSDialLatencySnapshot) quantileMs(q float64) int64 {
+	if s.Count <= 0 {
+		return 0
+	}
+	rank := int64(q * float64(s.Count))
+	if float64(rank) < q*float64(s.Count) {
+		rank++
+	}
+	if rank < 1 {
+		rank = 1
+	}
+	var cumulative int64
+	for _, bucket := range s.Buckets {
+		cumulative += bucket.Count
+		if cumulative >= rank {
+			if bucket.UpperMs == 0 || bucket.UpperMs > s.MaxMs {
+				return s.MaxMs
+			}
+			return bucket.UpperMs
+		}
+	}
+	return s.MaxMs
+}
+
+func (p *openAIWSConnPool) recordDialLatency(accountID int64, latency time.Duration) {
+	if p == nil || accountID <= 0 {
+		return
+	}
+	value, ok := p.dialLatency.Load(accountID)
+	if !ok {
+		value, _ = p.dialLatency.LoadOrStore(accountID, &openAIWSDialLatencyHistogram{})
+	}
+	value.(*openAIWSDialLatencyHistogram).observe(latency)
+}
+
+// SnapshotDialLatency 返回各账号建连耗时分布；尚未成功建连过的账号不出现在结果中。
+func (p *openAIWSConnPool) SnapshotDialLatency() map[int64]OpenAIWSDialLatencySnapshot {
+	if p == nil {
+		return nil
+	}
+	out := make(map[int64]OpenAIWSDialLatencySnapshot)
+	p.dialLatency.Range(func(key, value any) bool {
+		accountID, ok := key.(int64)
+		histogram, typed := value.(*openAIWSDialLatencyHistogram)
+		if ok && typed && histogram != nil {
+			out[accountID] = histogram.snapshot()
+		}
+		return true
+	})
+	return out
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+var errOpenAIWSDisconnectDrainSaturated = errors.New("client disconnected and disconnect drain concurrency is saturated")
+
+// openAIWSDisconnectDrainLimiter 限制客户端断连后仍继续读取上游（drain）直到 turn 结束的并发数。
+// drain 保证计费准确，但大量客户端同时断连时会占住等量的 goroutine 与上游连接；
+// 超出上限的 turn 直接中止上游，按已观测到的部分 usage 处理。
+type openAIWSDisconnectDrainLimiter struct {
+	active  atomic.Int64
+	aborted atomic.Int64
+}
+
+// tryAcquire 在 limit 以内占用一个 drain 名额；limit<=0 表示不限制（仍计入 active）。
+func (l *openAIWSDisconnectDrainLimiter) tryAcquire(limit int) bool {
+	for {
+		current := l.active.Load()
+		if limit > 0 && current >= int64(limit) {
+			l.aborted.Add(1)
+			return false
+		}
+		if l.active.CompareAndSwap(current, current+1) {
+			return true
+		}
+	}
+}
+
+func (l *openAIWSDisconnectDrainLimiter) release() {
+	l.active.Add(-1)
+}
+
+func (s *OpenAIGatewayService) openAIWSClientDisconnectDrainMaxConcurrency() int {
+	if s == nil || s.cfg == nil {
+		return 0
+	}
+	return s.openAIWSConfig().ClientDisconnectDrainMaxConcurrency
+}
+
+// beginOpenAIWSDisconnectDrain 客户端断连时申请 drain 名额；成功时返回的 release 必须在 turn 结束时调用，
+// 名额已满时返回 nil, false，调用方应中止上游而不是继续 drain。
+func (s *OpenAIGatewayService) beginOpenAIWSDisconnectDrain() (release func(), ok bool) {
+	if s == nil {
+		return func() {}, true
+	}
+	if !s.openaiWSDisconnectDrains.tryAcquire(s.openAIWSClientDisconnectDrainMaxConcurrency()) {
+		return nil, false
+	}
+	var released atomic.Bool
+	return func() {
+		if released.CompareAndSwap(false, true) {
+			s.openaiWSDisconnectDrains.release()
+		}
+	}, true
+}
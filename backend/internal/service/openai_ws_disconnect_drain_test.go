@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	coderws "github.com/coder/websocket"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIWSDisconnectDrainLimiter(t *testing.T) {
+	var limiter openAIWSDisconnectDrainLimiter
+	require.True(t, limiter.tryAcquire(2))
+	require.True(t, limiter.tryAcquire(2))
+	require.False(t, limiter.tryAcquire(2), "并发已满时应拒绝")
+	require.Equal(t, int64(2), limiter.active.Load())
+	require.Equal(t, int64(1), limiter.aborted.Load())
+
+	limiter.release()
+	require.True(t, limiter.tryAcquire(2), "归还名额后可再次占用")
+	require.True(t, limiter.tryAcquire(0), "limit=0 表示不限制")
+	require.Equal(t, int64(3), limiter.active.Load())
+}
+
+func TestOpenAIGatewayService_BeginOpenAIWSDisconnectDrain_ReleaseIsIdempotent(t *testing.T) {
+	cfg := newOpenAIWSIngressCaptureTestConfig()
+	cfg.Gateway.OpenAIWS.ClientDisconnectDrainMaxConcurrency = 1
+	svc := &OpenAIGatewayService{cfg: cfg}
+
+	release, ok := svc.beginOpenAIWSDisconnectDrain()
+	require.True(t, ok)
+	_, ok = svc.beginOpenAIWSDisconnectDrain()
+	require.False(t, ok)
+	release()
+	release()
+	require.Equal(t, int64(0), svc.SnapshotOpenAIWSRelayMetrics().DisconnectDrainActive)
+	require.Equal(t, int64(1), svc.SnapshotOpenAIWSRelayMetrics().DisconnectDrainAbortedTotal)
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_ClientDisconnectDrainSaturatedAbortsUpstream(t *testing.T) {
+	var heldRelease func()
+	svc, resultCh, serverErr := runOpenAIWSDisconnectDrainSessionForTest(t, func(svc *OpenAIGatewayService) {
+		svc.cfg.Gateway.OpenAIWS.ClientDisconnectDrainMaxConcurrency = 1
+		// 预先占满 drain 名额，模拟大量会话同时断连
+		release, ok := svc.beginOpenAIWSDisconnectDrain()
+		require.True(t, ok)
+		heldRelease = release
+	})
+	require.Error(t, serverErr)
+	require.ErrorIs(t, serverErr, errOpenAIWSDisconnectDrainSaturated)
+
+	select {
+	case result := <-resultCh:
+		t.Fatalf("drain 名额已满时不应继续读完 turn: %+v", result)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	metrics := svc.SnapshotOpenAIWSRelayMetrics()
+	require.Equal(t, int64(1), metrics.DisconnectDrainAbortedTotal)
+	require.Equal(t, int64(1), metrics.DisconnectDrainActive, "中止的 turn 不占用名额")
+	heldRelease()
+	require.Equal(t, int64(0), svc.SnapshotOpenAIWSRelayMetrics().DisconnectDrainActive)
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_ClientDisconnectDrainWithinLimitReleasesSlot(t *testing.T) {
+	svc, resultCh, serverErr := runOpenAIWSDisconnectDrainSessionForTest(t, func(svc *OpenAIGatewayService) {
+		svc.cfg.Gateway.OpenAIWS.ClientDisconnectDrainMaxConcurrency = 1
+	})
+	require.NoError(t, serverErr, "名额未满时断连后应继续 drain 上游")
+
+	select {
+	case result := <-resultCh:
+		require.Equal(t, "resp_ingress_disconnect", result.RequestID)
+	case <-time.After(2 * time.Second):
+		t.Fatal("未收到断连后的 turn 结果回调")
+	}
+
+	metrics := svc.SnapshotOpenAIWSRelayMetrics()
+	require.Equal(t, int64(0), metrics.DisconnectDrainActive, "drain 结束后应归还名额")
+	require.Equal(t, int64(0), metrics.DisconnectDrainAbortedTotal)
+}
+
+// runOpenAIWSDisconnectDrainSessionForTest 在客户端发送首个请求后立即断连，返回所用服务、
+// 成功 turn 的结果通道以及 ingress 会话的结束错误；prepare 可在会话开始前调整服务（如预占 drain 名额）。
+func runOpenAIWSDisconnectDrainSessionForTest(t *testing.T, prepare func(svc *OpenAIGatewayService)) (*OpenAIGatewayService, <-chan *OpenAIForwardResult, error) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{}
+	cfg.Security.URLAllowlist.Enabled = false
+	cfg.Security.URLAllowlist.AllowInsecureHTTP = true
+	cfg.Gateway.OpenAIWS.Enabled = true
+	cfg.Gateway.OpenAIWS.OAuthEnabled = true
+	cfg.Gateway.OpenAIWS.APIKeyEnabled = true
+	cfg.Gateway.OpenAIWS.ResponsesWebsocketsV2 = true
+	cfg.Gateway.OpenAIWS.MaxConnsPerAccount = 1
+	cfg.Gateway.OpenAIWS.MinIdlePerAccount = 0
+	cfg.Gateway.OpenAIWS.MaxIdlePerAccount = 1
+	cfg.Gateway.OpenAIWS.QueueLimitPerConn = 8
+	cfg.Gateway.OpenAIWS.DialTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.ReadTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.WriteTimeoutSeconds = 3
+
+	// 多个上游事件：前几个为非 terminal 事件，最后一个为 terminal。
+	// 第一个事件延迟 250ms 让客户端 RST 有时间传播，使 writeClientMessage 可靠失败。
+	captureConn := &openAIWSCaptureConn{
+		readDelays: []time.Duration{250 * time.Millisecond, 0, 0},
+		events: [][]byte{
+			[]byte(`{"type":"response.created","response":{"id":"resp_ingress_disconnect","model":"gpt-5.1"}}`),
+			[]byte(`{"type":"response.output_item.added","response":{"id":"resp_ingress_disconnect"}}`),
+			[]byte(`{"type":"response.completed","response":{"id":"resp_ingress_disconnect","model":"gpt-5.1","usage":{"input_tokens":2,"output_tokens":1}}}`),
+		},
+	}
+	captureDialer := &openAIWSCaptureDialer{conn: captureConn}
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(captureDialer)
+
+	svc := &OpenAIGatewayService{
+		cfg:              cfg,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     pool,
+	}
+	if prepare != nil {
+		prepare(svc)
+	}
+
+	account := &Account{
+		ID:          115,
+		Name:        "openai-ingress-client-disconnect",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{
+			"api_key": "sk-test",
+			"model_mapping": map[string]any{
+				"custom-original-model": "gpt-5.1",
+			},
+		},
+		Extra: map[string]any{
+			"responses_websockets_v2_enabled": true,
+		},
+	}
+
+	serverErrCh := make(chan error, 1)
+	resultCh := make(chan *OpenAIForwardResult, 1)
+	hooks := &OpenAIWSIngressHooks{
+		AfterTurn: func(_ int, result *OpenAIForwardResult, turnErr error) {
+			if turnErr == nil && result != nil {
+				resultCh <- result
+			}
+		},
+	}
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := coderws.Accept(w, r, &coderws.AcceptOptions{
+			CompressionMode: coderws.CompressionContextTakeover,
+		})
+		if err != nil {
+			serverErrCh <- err
+			return
+		}
+		defer func() {
+			_ = conn.CloseNow()
+		}()
+
+		rec := httptest.NewRecorder()
+		ginCtx, _ := gin.CreateTestContext(rec)
+		req := r.Clone(r.Context())
+		req.Header = req.Header.Clone()
+		req.Header.Set("User-Agent", "unit-test-agent/1.0")
+		ginCtx.Request = req
+
+		readCtx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		msgType, firstMessage, readErr := conn.Read(readCtx)
+		cancel()
+		if readErr != nil {
+			serverErrCh <- readErr
+			return
+		}
+		if msgType != coderws.MessageText && msgType != coderws.MessageBinary {
+			serverErrCh <- errors.New("unsupported websocket client message type")
+			return
+		}
+
+		serverErrCh <- svc.ProxyResponsesWebSocketFromClient(r.Context(), ginCtx, conn, account, "sk-test", firstMessage, hooks)
+	}))
+	defer wsServer.Close()
+
+	dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+	clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http"), nil)
+	cancelDial()
+	require.NoError(t, err)
+
+	writeCtx, cancelWrite := context.WithTimeout(context.Background(), 3*time.Second)
+	err = clientConn.Write(writeCtx, coderws.MessageText, []byte(`{"type":"response.create","model":"custom-original-model","stream":false,"service_tier":"flex"}`))
+	cancelWrite()
+	require.NoError(t, err)
+	// 立即关闭客户端，模拟客户端在 relay 期间断连。
+	require.NoError(t, clientConn.CloseNow(), "模拟 ingress 客户端提前断连")
+
+	select {
+	case serverErr := <-serverErrCh:
+		return svc, resultCh, serverErr
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待 ingress websocket 结束超时")
+	}
+	return svc, resultCh, nil
+}
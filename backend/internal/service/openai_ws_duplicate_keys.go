@@ -0,0 +1,121 @@
+package service
+
+import (
+	"bytes"
+	"strings"
+
+	coderws "github.com/coder/websocket"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	openAIWSDuplicateKeyPolicyOff      = "off"
+	openAIWSDuplicateKeyPolicyReject   = "reject"
+	openAIWSDuplicateKeyPolicyLastWins = "last_wins"
+)
+
+// openAIWSIngressDuplicateKeyPolicy 返回 ingress 客户端消息顶层出现重复键时的处理策略。
+func (s *OpenAIGatewayService) openAIWSIngressDuplicateKeyPolicy() string {
+	if s == nil || s.cfg == nil {
+		return openAIWSDuplicateKeyPolicyOff
+	}
+	switch strings.TrimSpace(s.cfg.Gateway.OpenAIWS.IngressDuplicateKeyPolicy) {
+	case openAIWSDuplicateKeyPolicyReject:
+		return openAIWSDuplicateKeyPolicyReject
+	case openAIWSDuplicateKeyPolicyLastWins:
+		return openAIWSDuplicateKeyPolicyLastWins
+	default:
+		return openAIWSDuplicateKeyPolicyOff
+	}
+}
+
+// findOpenAIWSDuplicateTopLevelKeys 返回 JSON 对象中重复出现的顶层键（按首次出现顺序，已解码转义）。
+// gjson 对重复键取首个值，而上游解析器通常取最后一个值，二者不一致会导致路由与实际请求不符。
+func findOpenAIWSDuplicateTopLevelKeys(payload []byte) []string {
+	root := gjson.ParseBytes(payload)
+	if !root.IsObject() {
+		return nil
+	}
+	seen := make(map[string]int)
+	var duplicates []string
+	root.ForEach(func(key, _ gjson.Result) bool {
+		name := key.String()
+		seen[name]++
+		if seen[name] == 2 {
+			duplicates = append(duplicates, name)
+		}
+		return true
+	})
+	return duplicates
+}
+
+// canonicalizeOpenAIWSDuplicateTopLevelKeys 重建 JSON 对象：每个顶层键只保留一次，位置取首次出现处，值取最后一次出现的值。
+// 键与值均原样复用原始字节，不改变嵌套内容的格式。非对象输入原样返回。
+func canonicalizeOpenAIWSDuplicateTopLevelKeys(payload []byte) []byte {
+	root := gjson.ParseBytes(payload)
+	if !root.IsObject() {
+		return payload
+	}
+	type member struct {
+		key   string
+		value string
+	}
+	index := make(map[string]int)
+	members := make([]member, 0, 16)
+	root.ForEach(func(key, value gjson.Result) bool {
+		name := key.String()
+		if i, ok := index[name]; ok {
+			members[i].value = value.Raw
+			return true
+		}
+		index[name] = len(members)
+		members = append(members, member{key: key.Raw, value: value.Raw})
+		return true
+	})
+
+	var buf bytes.Buffer
+	buf.Grow(len(payload))
+	buf.WriteByte('{')
+	for i, m := range members {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(m.key)
+		buf.WriteByte(':')
+		buf.WriteString(m.value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+// ApplyOpenAIWSIngressDuplicateKeyPolicy 按 ingress_duplicate_key_policy 处理客户端消息中的重复顶层键：
+// reject 时返回 StatusPolicyViolation 关闭错误；last_wins 时返回规范化后的消息；其余情况原样返回。
+// handler 在读取首包 model 用于调度前调用，保证调度依据与实际转发的请求一致。
+func (s *OpenAIGatewayService) ApplyOpenAIWSIngressDuplicateKeyPolicy(message []byte) ([]byte, error) {
+	policy := s.openAIWSIngressDuplicateKeyPolicy()
+	if policy == openAIWSDuplicateKeyPolicyOff {
+		return message, nil
+	}
+	trimmed := bytes.TrimSpace(message)
+	if !gjson.ValidBytes(trimmed) {
+		return message, nil
+	}
+	return applyOpenAIWSDuplicateKeyPolicy(trimmed, policy, 0)
+}
+
+func applyOpenAIWSDuplicateKeyPolicy(payload []byte, policy string, accountID int64) ([]byte, error) {
+	duplicates := findOpenAIWSDuplicateTopLevelKeys(payload)
+	if len(duplicates) == 0 {
+		return payload, nil
+	}
+	keys := truncateOpenAIWSLogValue(strings.Join(duplicates, ","), openAIWSLogValueMaxLen)
+	if policy == openAIWSDuplicateKeyPolicyReject {
+		return nil, NewOpenAIWSClientCloseError(
+			coderws.StatusPolicyViolation,
+			"duplicate top-level keys in websocket request payload: "+keys,
+			nil,
+		)
+	}
+	logOpenAIWSModeInfo("ingress_ws_duplicate_keys_canonicalized account_id=%d keys=%s", accountID, keys)
+	return canonicalizeOpenAIWSDuplicateTopLevelKeys(payload), nil
+}
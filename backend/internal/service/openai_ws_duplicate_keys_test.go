@@ -0,0 +1,123 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	coderws "github.com/coder/websocket"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestFindOpenAIWSDuplicateTopLevelKeys(t *testing.T) {
+	require.Empty(t, findOpenAIWSDuplicateTopLevelKeys([]byte(`{"model":"gpt-5.1","input":[{"model":"a"},{"model":"b"}]}`)), "嵌套对象内的同名键不算重复")
+	require.Empty(t, findOpenAIWSDuplicateTopLevelKeys([]byte(`[1,2]`)))
+	require.Equal(t,
+		[]string{"model", "previous_response_id"},
+		findOpenAIWSDuplicateTopLevelKeys([]byte(`{"model":"a","previous_response_id":"resp_1","mod\u0065l":"b","previous_response_id":"resp_2","model":"c"}`)),
+		"转义后相同的键也应视为重复，且每个键只报告一次",
+	)
+}
+
+func TestCanonicalizeOpenAIWSDuplicateTopLevelKeys(t *testing.T) {
+	raw := []byte(`{"type":"response.create", "model":"gpt-4o","input":[{"type":"input_text","text":"hi"}],"model":"gpt-5.1","stream":true}`)
+	canonical := canonicalizeOpenAIWSDuplicateTopLevelKeys(raw)
+	require.Equal(t, `{"type":"response.create","model":"gpt-5.1","input":[{"type":"input_text","text":"hi"}],"stream":true}`, string(canonical))
+	require.True(t, gjson.ValidBytes(canonical))
+	require.Empty(t, findOpenAIWSDuplicateTopLevelKeys(canonical))
+
+	notObject := []byte(`"model"`)
+	require.Equal(t, notObject, canonicalizeOpenAIWSDuplicateTopLevelKeys(notObject))
+}
+
+func TestOpenAIGatewayService_ApplyOpenAIWSIngressDuplicateKeyPolicy(t *testing.T) {
+	raw := []byte(`{"type":"response.create","model":"gpt-4o","model":"gpt-5.1"}`)
+	newService := func(policy string) *OpenAIGatewayService {
+		cfg := &config.Config{}
+		cfg.Gateway.OpenAIWS.IngressDuplicateKeyPolicy = policy
+		return &OpenAIGatewayService{cfg: cfg}
+	}
+
+	out, err := newService("off").ApplyOpenAIWSIngressDuplicateKeyPolicy(raw)
+	require.NoError(t, err)
+	require.Equal(t, raw, out)
+
+	out, err = newService("last_wins").ApplyOpenAIWSIngressDuplicateKeyPolicy(raw)
+	require.NoError(t, err)
+	require.Equal(t, "gpt-5.1", gjson.GetBytes(out, "model").String())
+
+	_, err = newService("reject").ApplyOpenAIWSIngressDuplicateKeyPolicy(raw)
+	var closeErr *OpenAIWSClientCloseError
+	require.True(t, errors.As(err, &closeErr))
+	require.Equal(t, coderws.StatusPolicyViolation, closeErr.StatusCode())
+	require.Contains(t, closeErr.Reason(), "duplicate top-level keys")
+	require.Contains(t, closeErr.Reason(), "model")
+
+	out, err = newService("reject").ApplyOpenAIWSIngressDuplicateKeyPolicy([]byte(`{"model":"gpt-5.1"}`))
+	require.NoError(t, err)
+	require.Equal(t, `{"model":"gpt-5.1"}`, string(out))
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_DuplicateModelKeysLastWins(t *testing.T) {
+	cfg := newOpenAIWSIngressCaptureTestConfig()
+	cfg.Gateway.OpenAIWS.IngressDuplicateKeyPolicy = "last_wins"
+
+	upstream := &openAIWSCaptureConn{
+		events: [][]byte{
+			[]byte(`{"type":"response.completed","response":{"id":"resp_dup_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+			[]byte(`{"type":"response.completed","response":{"id":"resp_dup_2","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+		},
+	}
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(&openAIWSQueueDialer{conns: []openAIWSClientConn{upstream}})
+	svc := &OpenAIGatewayService{
+		cfg:              cfg,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     pool,
+	}
+	account := &Account{
+		ID:          142,
+		Name:        "openai-ingress-duplicate-keys",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{"api_key": "sk-duplicate-keys"},
+		Extra:       map[string]any{"responses_websockets_v2_enabled": true},
+	}
+
+	clientMessages := [][]byte{
+		[]byte(`{"type":"response.create","model":"gpt-4o","stream":false,"model":"gpt-5.1","input":[{"type":"input_text","text":"hello"}]}`),
+		[]byte(`{"type":"response.create","model":"gpt-4o","stream":false,"previous_response_id":"resp_dup_1","model":"gpt-5.1","input":[{"type":"input_text","text":"again"}]}`),
+	}
+	var resultsMu sync.Mutex
+	var resultModels []string
+	hooks := &OpenAIWSIngressHooks{
+		AfterTurn: func(_ int, result *OpenAIForwardResult, _ error) {
+			if result != nil {
+				resultsMu.Lock()
+				resultModels = append(resultModels, result.Model)
+				resultsMu.Unlock()
+			}
+		},
+	}
+	runOpenAIWSIngressSessionWithServiceForTest(t, svc, account, "sk-duplicate-keys", clientMessages, hooks)
+
+	resultsMu.Lock()
+	require.Equal(t, []string{"gpt-5.1", "gpt-5.1"}, resultModels, "网关解析的模型应与转发给上游的一致")
+	resultsMu.Unlock()
+
+	upstream.mu.Lock()
+	defer upstream.mu.Unlock()
+	require.Len(t, upstream.writes, 2)
+	for _, write := range upstream.writes {
+		require.Equal(t, "gpt-5.1", write["model"], "重复键应按最后一个值转发")
+	}
+	require.Equal(t, "resp_dup_1", upstream.writes[1]["previous_response_id"])
+}
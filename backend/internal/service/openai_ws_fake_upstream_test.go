@@ -0,0 +1,350 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	coderws "github.com/coder/websocket"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+// openAIWSFakeUpstreamTurn fake 上游对一条 response.create 的响应脚本。
+type openAIWSFakeUpstreamTurn struct {
+	// delay 读到请求后、下发首个事件前的等待时间（模拟首 token 延迟）。
+	delay time.Duration
+	// eventInterval 相邻事件之间的间隔。
+	eventInterval time.Duration
+	// events 依次下发的事件；为空时自动下发一条 response.completed。
+	events [][]byte
+	// dropConn 事件下发完毕后直接断开底层 TCP 连接（不发送 close 帧），
+	// 后续在该连接上的 preflight ping 会因收不到 pong 在健康检查超时（openAIWSConnHealthCheckTO）后失败。
+	dropConn bool
+	// closeCode 非 0 时在事件下发完毕后以该 close code 关闭连接。
+	closeCode   coderws.StatusCode
+	closeReason string
+}
+
+// openAIWSFakeUpstream 基于 httptest 的 responses websocket 上游：按脚本逐 turn 回放事件，
+// 脚本跨连接全局消费，用尽后对每条请求自动返回 response.completed（response.id 为 resp_fake_<序号>）。
+// 与按接口手写的 stub 连接不同，它经过真实的拨号、握手与帧收发路径。
+type openAIWSFakeUpstream struct {
+	server *httptest.Server
+
+	mu sync.Mutex
+	// rejectStatus 非 0 时拒绝握手并返回该 HTTP 状态码。
+	rejectStatus    int
+	responseHeaders http.Header
+	turns           []openAIWSFakeUpstreamTurn
+	requests        [][]byte
+	handshakes      []http.Header
+	autoResponses   int
+}
+
+// newOpenAIWSFakeUpstream 启动 fake 上游，测试结束时自动关闭。
+func newOpenAIWSFakeUpstream(t *testing.T, turns ...openAIWSFakeUpstreamTurn) *openAIWSFakeUpstream {
+	t.Helper()
+	u := &openAIWSFakeUpstream{turns: turns}
+	u.server = httptest.NewServer(http.HandlerFunc(u.serveHTTP))
+	t.Cleanup(u.server.Close)
+	return u
+}
+
+func (u *openAIWSFakeUpstream) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	u.handshakes = append(u.handshakes, r.Header.Clone())
+	rejectStatus := u.rejectStatus
+	for key, values := range u.responseHeaders {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	u.mu.Unlock()
+	if rejectStatus != 0 {
+		http.Error(w, http.StatusText(rejectStatus), rejectStatus)
+		return
+	}
+
+	conn, err := coderws.Accept(w, r, &coderws.AcceptOptions{CompressionMode: coderws.CompressionContextTakeover})
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = conn.CloseNow()
+	}()
+	ctx := r.Context()
+	for {
+		_, request, readErr := conn.Read(ctx)
+		if readErr != nil {
+			return
+		}
+		turn := u.nextTurn(request)
+		if !sleepOpenAIWSFakeUpstream(ctx, turn.delay) {
+			return
+		}
+		for i, event := range turn.events {
+			if i > 0 && !sleepOpenAIWSFakeUpstream(ctx, turn.eventInterval) {
+				return
+			}
+			if writeErr := conn.Write(ctx, coderws.MessageText, event); writeErr != nil {
+				return
+			}
+		}
+		switch {
+		case turn.dropConn:
+			return
+		case turn.closeCode != 0:
+			_ = conn.Close(turn.closeCode, turn.closeReason)
+			return
+		}
+	}
+}
+
+// nextTurn 记录请求并取出下一段脚本；脚本用尽或未配置事件时生成 response.completed。
+func (u *openAIWSFakeUpstream) nextTurn(request []byte) openAIWSFakeUpstreamTurn {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.requests = append(u.requests, append([]byte(nil), request...))
+	var turn openAIWSFakeUpstreamTurn
+	if len(u.turns) > 0 {
+		turn = u.turns[0]
+		u.turns = u.turns[1:]
+	}
+	if len(turn.events) == 0 {
+		u.autoResponses++
+		model := gjson.GetBytes(request, "model").String()
+		turn.events = [][]byte{openAIWSFakeCompletedEvent(fmt.Sprintf("resp_fake_%d", u.autoResponses), model)}
+	}
+	return turn
+}
+
+func sleepOpenAIWSFakeUpstream(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// baseURL 返回可直接作为 API Key 账号 base_url 的地址。
+func (u *openAIWSFakeUpstream) baseURL() string {
+	return u.server.URL
+}
+
+// account 返回指向 fake 上游、已开启 WSv2 的 API Key 账号。
+func (u *openAIWSFakeUpstream) account(id int64) *Account {
+	return &Account{
+		ID:          id,
+		Name:        fmt.Sprintf("openai-fake-upstream-%d", id),
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{
+			"api_key":  "sk-test",
+			"base_url": u.baseURL(),
+		},
+		Extra: map[string]any{
+			"responses_websockets_v2_enabled": true,
+		},
+	}
+}
+
+// newService 返回使用真实拨号器连接 fake 上游的 service；cfg 为 nil 时使用 ingress 测试默认配置。
+func (u *openAIWSFakeUpstream) newService(cfg *config.Config) *OpenAIGatewayService {
+	if cfg == nil {
+		cfg = newOpenAIWSIngressCaptureTestConfig()
+	}
+	return &OpenAIGatewayService{
+		cfg:              cfg,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     newOpenAIWSConnPool(cfg),
+	}
+}
+
+// setRejectStatus 之后的握手均以该状态码拒绝；0 表示恢复正常握手。
+func (u *openAIWSFakeUpstream) setRejectStatus(status int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.rejectStatus = status
+}
+
+// enqueue 追加响应脚本。
+func (u *openAIWSFakeUpstream) enqueue(turns ...openAIWSFakeUpstreamTurn) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.turns = append(u.turns, turns...)
+}
+
+// requestsSnapshot 返回上游收到的全部请求（按到达顺序）。
+func (u *openAIWSFakeUpstream) requestsSnapshot() [][]byte {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	out := make([][]byte, len(u.requests))
+	copy(out, u.requests)
+	return out
+}
+
+// connCount 返回握手次数（含被拒绝的握手）。
+func (u *openAIWSFakeUpstream) connCount() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.handshakes)
+}
+
+// lastHandshake 返回最近一次握手的请求头。
+func (u *openAIWSFakeUpstream) lastHandshake() http.Header {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if len(u.handshakes) == 0 {
+		return nil
+	}
+	return u.handshakes[len(u.handshakes)-1].Clone()
+}
+
+func openAIWSFakeCompletedEvent(responseID, model string) []byte {
+	if model == "" {
+		model = "gpt-5.1"
+	}
+	return []byte(fmt.Sprintf(`{"type":"response.completed","response":{"id":%q,"model":%q,"usage":{"input_tokens":1,"output_tokens":1}}}`, responseID, model))
+}
+
+func openAIWSFakeDeltaEvent(delta string) []byte {
+	return []byte(fmt.Sprintf(`{"type":"response.output_text.delta","delta":%q}`, delta))
+}
+
+func openAIWSFakeErrorEvent(code, message string) []byte {
+	return []byte(fmt.Sprintf(`{"type":"error","error":{"type":"invalid_request_error","code":%q,"message":%q}}`, code, message))
+}
+
+func TestOpenAIWSFakeUpstream_IngressMultiTurn(t *testing.T) {
+	upstream := newOpenAIWSFakeUpstream(t, openAIWSFakeUpstreamTurn{
+		events: [][]byte{
+			openAIWSFakeDeltaEvent("hel"),
+			openAIWSFakeDeltaEvent("lo"),
+			openAIWSFakeCompletedEvent("resp_fake_stream", "gpt-5.1"),
+		},
+		delay:         10 * time.Millisecond,
+		eventInterval: 5 * time.Millisecond,
+	})
+	svc := upstream.newService(nil)
+
+	received := runOpenAIWSIngressSessionWithServiceForTest(t, svc, upstream.account(301), "sk-test", [][]byte{
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":true}`),
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":true,"previous_response_id":"resp_fake_stream"}`),
+	}, nil)
+
+	require.Len(t, received, 4)
+	require.Equal(t, "hel", gjson.GetBytes(received[0], "delta").String())
+	require.Equal(t, "resp_fake_stream", gjson.GetBytes(received[2], "response.id").String())
+	require.Equal(t, "resp_fake_1", gjson.GetBytes(received[3], "response.id").String(), "脚本用尽后自动返回 completed")
+
+	requests := upstream.requestsSnapshot()
+	require.Len(t, requests, 2)
+	require.Equal(t, "resp_fake_stream", gjson.GetBytes(requests[1], "previous_response_id").String())
+	require.Equal(t, 1, upstream.connCount(), "多轮 turn 应复用同一上游连接")
+	require.Equal(t, "Bearer sk-test", upstream.lastHandshake().Get("Authorization"))
+}
+
+func TestOpenAIWSFakeUpstream_IngressErrorEventRecovery(t *testing.T) {
+	upstream := newOpenAIWSFakeUpstream(t,
+		openAIWSFakeUpstreamTurn{},
+		openAIWSFakeUpstreamTurn{events: [][]byte{openAIWSFakeErrorEvent("previous_response_not_found", "")}},
+	)
+	cfg := newOpenAIWSIngressCaptureTestConfig()
+	cfg.Gateway.OpenAIWS.IngressPreviousResponseRecoveryEnabled = true
+	svc := upstream.newService(cfg)
+
+	received := runOpenAIWSIngressSessionWithServiceForTest(t, svc, upstream.account(302), "sk-test", [][]byte{
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false}`),
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"previous_response_id":"resp_fake_1"}`),
+	}, nil)
+
+	require.Len(t, received, 2)
+	require.Equal(t, "resp_fake_1", gjson.GetBytes(received[0], "response.id").String())
+	require.Equal(t, "resp_fake_2", gjson.GetBytes(received[1], "response.id").String(), "previous_response_not_found 应被恢复而不透传给客户端")
+
+	requests := upstream.requestsSnapshot()
+	require.Len(t, requests, 3)
+	require.Equal(t, "resp_fake_1", gjson.GetBytes(requests[1], "previous_response_id").String())
+	require.False(t, gjson.GetBytes(requests[2], "previous_response_id").Exists(), "恢复重试应去掉 previous_response_id")
+}
+
+func TestOpenAIWSFakeUpstream_IngressPreflightPingFailReconnects(t *testing.T) {
+	prevPreflightPingIdle := openAIWSIngressPreflightPingIdle
+	openAIWSIngressPreflightPingIdle = 0
+	defer func() {
+		openAIWSIngressPreflightPingIdle = prevPreflightPingIdle
+	}()
+
+	upstream := newOpenAIWSFakeUpstream(t, openAIWSFakeUpstreamTurn{
+		events:   [][]byte{openAIWSFakeCompletedEvent("resp_before_drop", "gpt-5.1")},
+		dropConn: true,
+	})
+	svc := upstream.newService(nil)
+
+	received := runOpenAIWSIngressSessionWithServiceForTest(t, svc, upstream.account(303), "sk-test", [][]byte{
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false}`),
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false}`),
+	}, nil)
+
+	require.Len(t, received, 2)
+	require.Equal(t, "resp_before_drop", gjson.GetBytes(received[0], "response.id").String())
+	require.Equal(t, "resp_fake_1", gjson.GetBytes(received[1], "response.id").String())
+	require.Equal(t, 2, upstream.connCount(), "旧连接断开后第二轮应换新连接")
+	require.Len(t, upstream.requestsSnapshot(), 2, "第二轮不应写入已断开的旧连接")
+}
+
+func TestOpenAIWSFakeUpstream_HandshakeRejectAndUpstreamClose(t *testing.T) {
+	upstream := newOpenAIWSFakeUpstream(t)
+	upstream.setRejectStatus(http.StatusServiceUnavailable)
+	upstream.responseHeaders = http.Header{"X-Request-Id": []string{"req_fake"}}
+	cfg := newOpenAIWSIngressCaptureTestConfig()
+	pool := newOpenAIWSConnPool(cfg)
+	account := upstream.account(304)
+	req := openAIWSAcquireRequest{
+		Account: account,
+		WSURL:   "ws" + strings.TrimPrefix(upstream.baseURL(), "http") + "/v1/responses",
+	}
+
+	_, err := pool.Acquire(context.Background(), req)
+	require.Error(t, err)
+	require.Equal(t, 1, upstream.connCount())
+	require.Empty(t, upstream.requestsSnapshot())
+
+	// 恢复握手后，脚本可在 turn 结束时以指定 close code 关闭连接。
+	upstream.setRejectStatus(0)
+	upstream.enqueue(openAIWSFakeUpstreamTurn{
+		events:      [][]byte{openAIWSFakeCompletedEvent("resp_before_close", "")},
+		closeCode:   coderws.StatusTryAgainLater,
+		closeReason: "upstream overloaded",
+	})
+	lease, err := pool.Acquire(context.Background(), req)
+	require.NoError(t, err)
+	defer lease.Release()
+	require.Equal(t, "req_fake", lease.HandshakeHeader("X-Request-Id"))
+
+	require.NoError(t, lease.WriteJSON(map[string]any{"type": "response.create", "model": "gpt-5.1"}, time.Second))
+	event, err := lease.ReadMessage(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, "resp_before_close", gjson.GetBytes(event, "response.id").String())
+	_, err = lease.ReadMessage(time.Second)
+	require.Equal(t, coderws.StatusTryAgainLater, coderws.CloseStatus(err))
+}
@@ -249,3 +249,145 @@ func TestShouldLogOpenAIWSPayloadSchema(t *testing.T) {
 	svc.cfg.Gateway.OpenAIWS.PayloadLogSampleRate = 1
 	require.True(t, svc.shouldLogOpenAIWSPayloadSchema(2))
 }
+
+// openAIWSDialHealthAccountRepo 把限流服务写入的健康标记同步回内存账号，便于观察对调度的影响。
+type openAIWSDialHealthAccountRepo struct {
+	stubOpenAIAccountRepo
+}
+
+func (r openAIWSDialHealthAccountRepo) find(id int64) *Account {
+	for i := range r.accounts {
+		if r.accounts[i].ID == id {
+			return &r.accounts[i]
+		}
+	}
+	return nil
+}
+
+func (r openAIWSDialHealthAccountRepo) SetError(ctx context.Context, id int64, errorMsg string) error {
+	if account := r.find(id); account != nil {
+		account.Status = StatusError
+		account.ErrorMessage = errorMsg
+	}
+	return nil
+}
+
+func (r openAIWSDialHealthAccountRepo) SetTempUnschedulable(ctx context.Context, id int64, until time.Time, reason string) error {
+	if account := r.find(id); account != nil {
+		account.TempUnschedulableUntil = &until
+	}
+	return nil
+}
+
+func (r openAIWSDialHealthAccountRepo) SetRateLimited(ctx context.Context, id int64, resetAt time.Time) error {
+	if account := r.find(id); account != nil {
+		account.RateLimitResetAt = &resetAt
+	}
+	return nil
+}
+
+func (r openAIWSDialHealthAccountRepo) Update(ctx context.Context, account *Account) error {
+	return nil
+}
+
+func TestOpenAIGatewayService_ReportOpenAIWSDialFailure_StatusClasses(t *testing.T) {
+	ctx := context.Background()
+	newService := func(accountType string) (*OpenAIGatewayService, []Account) {
+		accounts := []Account{
+			{ID: 7101, Platform: PlatformOpenAI, Type: accountType, Status: StatusActive, Schedulable: true, Concurrency: 4},
+			{ID: 7102, Platform: PlatformOpenAI, Type: accountType, Status: StatusActive, Schedulable: true, Concurrency: 4},
+		}
+		repo := openAIWSDialHealthAccountRepo{stubOpenAIAccountRepo{accounts: accounts}}
+		cfg := &config.Config{}
+		cfg.Gateway.OpenAIWS.LBTopK = 1
+		cfg.Gateway.OpenAIWS.SchedulerScoreWeights.ErrorRate = 1.0
+		svc := &OpenAIGatewayService{
+			accountRepo:        repo,
+			cache:              &stubGatewayCache{},
+			cfg:                cfg,
+			rateLimitService:   NewRateLimitService(repo, nil, cfg, nil, nil),
+			concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+		}
+		return svc, accounts
+	}
+	selectOnce := func(t *testing.T, svc *OpenAIGatewayService) int64 {
+		t.Helper()
+		groupID := int64(71)
+		selection, _, err := svc.SelectAccountWithScheduler(ctx, &groupID, "", "", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+		require.NoError(t, err)
+		require.NotNil(t, selection)
+		require.NotNil(t, selection.Account)
+		if selection.ReleaseFunc != nil {
+			selection.ReleaseFunc()
+		}
+		return selection.Account.ID
+	}
+	dialFailure := func(status int) error {
+		return &openAIWSDialError{StatusCode: status, Err: errors.New("handshake rejected")}
+	}
+	otherAccount := func(id int64) int64 {
+		if id == 7101 {
+			return 7102
+		}
+		return 7101
+	}
+
+	t.Run("oauth_401_marks_temp_unschedulable", func(t *testing.T) {
+		svc, accounts := newService(AccountTypeOAuth)
+		svc.reportOpenAIWSDialFailure(ctx, &accounts[0], dialFailure(http.StatusUnauthorized), true)
+		require.NotNil(t, accounts[0].TempUnschedulableUntil)
+		require.False(t, accounts[0].IsSchedulable())
+		for i := 0; i < 3; i++ {
+			require.Equal(t, int64(7102), selectOnce(t, svc))
+		}
+	})
+
+	t.Run("403_marks_credential_error", func(t *testing.T) {
+		svc, accounts := newService(AccountTypeAPIKey)
+		svc.reportOpenAIWSDialFailure(ctx, &accounts[1], dialFailure(http.StatusForbidden), true)
+		require.Equal(t, StatusError, accounts[1].Status)
+		for i := 0; i < 3; i++ {
+			require.Equal(t, int64(7101), selectOnce(t, svc))
+		}
+	})
+
+	t.Run("429_enters_quota_cooldown", func(t *testing.T) {
+		svc, accounts := newService(AccountTypeOAuth)
+		svc.reportOpenAIWSDialFailure(ctx, &accounts[0], dialFailure(http.StatusTooManyRequests), false)
+		require.NotNil(t, accounts[0].RateLimitResetAt)
+		require.True(t, accounts[0].RateLimitResetAt.After(time.Now()))
+		require.Equal(t, StatusActive, accounts[0].Status)
+		require.Equal(t, int64(7102), selectOnce(t, svc))
+	})
+
+	t.Run("5xx_is_transient", func(t *testing.T) {
+		svc, accounts := newService(AccountTypeOAuth)
+		first := selectOnce(t, svc)
+		var failed *Account
+		for i := range accounts {
+			if accounts[i].ID == first {
+				failed = &accounts[i]
+			}
+		}
+		require.NotNil(t, failed)
+
+		// 入站路径不重复计入错误率。
+		svc.reportOpenAIWSDialFailure(ctx, failed, dialFailure(http.StatusServiceUnavailable), false)
+		require.Equal(t, first, selectOnce(t, svc))
+
+		for i := 0; i < 5; i++ {
+			svc.reportOpenAIWSDialFailure(ctx, failed, dialFailure(http.StatusBadGateway), true)
+		}
+		require.True(t, failed.IsSchedulable())
+		require.Equal(t, StatusActive, failed.Status)
+		require.Equal(t, otherAccount(first), selectOnce(t, svc))
+	})
+
+	t.Run("network_error_without_status_is_ignored", func(t *testing.T) {
+		svc, accounts := newService(AccountTypeAPIKey)
+		svc.reportOpenAIWSDialFailure(ctx, &accounts[0], &openAIWSDialError{Err: errors.New("connection reset")}, true)
+		svc.reportOpenAIWSDialFailure(ctx, &accounts[0], errors.New("dial tcp: timeout"), true)
+		require.True(t, accounts[0].IsSchedulable())
+		require.Equal(t, StatusActive, accounts[0].Status)
+	})
+}
@@ -7,16 +7,19 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
 	"github.com/Wei-Shaw/sub2api/internal/pkg/openai"
+	openaiwsv2 "github.com/Wei-Shaw/sub2api/internal/service/openai_ws_v2"
 	"github.com/Wei-Shaw/sub2api/internal/util/responseheaders"
 	coderws "github.com/coder/websocket"
 	"github.com/gin-gonic/gin"
@@ -32,6 +35,8 @@ const (
 	openAIWSTurnStateHeader    = "x-codex-turn-state"
 	openAIWSTurnMetadataHeader = "x-codex-turn-metadata"
 
+	openAIWSClientCloseRetryAfterSeconds = 1
+
 	openAIWSLogValueMaxLen      = 160
 	openAIWSHeaderValueMaxLen   = 120
 	openAIWSIDValueMaxLen       = 64
@@ -68,6 +73,18 @@ var openAIWSLogValueReplacer = strings.NewReplacer(
 
 var openAIWSIngressPreflightPingIdle = 20 * time.Second
 
+// openAIWSIngressPreflightPingJitterRatio 预检 ping 空闲阈值的随机抖动比例：每条上游连接在
+// [idle*(1-ratio), idle*(1+ratio)) 内取一次阈值，避免大量会话在同一时间点集中 ping 上游。
+var openAIWSIngressPreflightPingJitterRatio = 0.2
+
+var errOpenAIWSMalformedUpstreamEvent = errors.New("upstream websocket sent malformed event")
+
+// errOpenAIWSReplayInputTooLarge 表示会话累计的全量 input 超过 max_replay_input_bytes，无法继续保留用于全量重放。
+var errOpenAIWSReplayInputTooLarge = errors.New("openai ws replay input exceeds max_replay_input_bytes")
+
+// errOpenAIWSIngressClientGone 表示客户端在 turn 等待上游连接（排队/建连）期间断开，本轮放弃获取连接。
+var errOpenAIWSIngressClientGone = errors.New("client websocket disconnected while acquiring upstream")
+
 // openAIWSFallbackError 表示可安全回退到 HTTP 的 WS 错误（尚未写下游）。
 type openAIWSFallbackError struct {
 	Reason string
@@ -99,6 +116,7 @@ func wrapOpenAIWSFallback(reason string, err error) error {
 type OpenAIWSClientCloseError struct {
 	statusCode coderws.StatusCode
 	reason     string
+	code       string
 	err        error
 }
 
@@ -186,6 +204,16 @@ func NewOpenAIWSClientCloseError(statusCode coderws.StatusCode, reason string, e
 	}
 }
 
+// NewOpenAIWSClientCloseErrorWithCode 创建携带业务错误码的客户端 WS 关闭错误。
+func NewOpenAIWSClientCloseErrorWithCode(statusCode coderws.StatusCode, reason string, code string, err error) error {
+	return &OpenAIWSClientCloseError{
+		statusCode: statusCode,
+		reason:     strings.TrimSpace(reason),
+		code:       strings.TrimSpace(code),
+		err:        err,
+	}
+}
+
 func (e *OpenAIWSClientCloseError) Error() string {
 	if e == nil {
 		return ""
@@ -217,10 +245,136 @@ func (e *OpenAIWSClientCloseError) Reason() string {
 	return strings.TrimSpace(e.reason)
 }
 
+// ErrorCode 返回随结构化 error 事件下发的业务错误码；未显式指定时按 close code 推导。
+func (e *OpenAIWSClientCloseError) ErrorCode() string {
+	if e == nil {
+		return defaultOpenAIWSClientCloseErrorCode(coderws.StatusInternalError)
+	}
+	if code := strings.TrimSpace(e.code); code != "" {
+		return code
+	}
+	return defaultOpenAIWSClientCloseErrorCode(e.statusCode)
+}
+
+func defaultOpenAIWSClientCloseErrorCode(statusCode coderws.StatusCode) string {
+	switch statusCode {
+	case coderws.StatusPolicyViolation:
+		return "invalid_request"
+	case coderws.StatusTryAgainLater:
+		return "try_again_later"
+	case coderws.StatusInternalError:
+		return "internal_error"
+	default:
+		return "connection_closed"
+	}
+}
+
+type openAIWSClientCloseErrorEvent struct {
+	Type  string                        `json:"type"`
+	Error openAIWSClientCloseErrorField `json:"error"`
+}
+
+type openAIWSClientCloseErrorField struct {
+	Type       string `json:"type"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	Retryable  bool   `json:"retryable"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+}
+
+// BuildOpenAIWSClientCloseErrorEvent 构造关闭客户端 WS 前下发的结构化 error 事件。
+// retryable/retry_after 由 close code 决定：1013 可稍后重试，1011 可立即重试，其余不可重试。
+func BuildOpenAIWSClientCloseErrorEvent(statusCode coderws.StatusCode, reason string, code string) []byte {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		code = defaultOpenAIWSClientCloseErrorCode(statusCode)
+	}
+	field := openAIWSClientCloseErrorField{
+		Type:    "server_error",
+		Code:    code,
+		Message: strings.TrimSpace(reason),
+	}
+	switch statusCode {
+	case coderws.StatusPolicyViolation:
+		field.Type = "invalid_request_error"
+	case coderws.StatusTryAgainLater:
+		field.Retryable = true
+		field.RetryAfter = openAIWSClientCloseRetryAfterSeconds
+	case coderws.StatusInternalError:
+		field.Retryable = true
+	}
+	payload, err := json.Marshal(openAIWSClientCloseErrorEvent{Type: "error", Error: field})
+	if err != nil {
+		return nil
+	}
+	return payload
+}
+
+// OpenAIWSIngressCapabilitiesSubprotocol 客户端在握手时携带该子协议即表示希望在首条消息前收到 gateway.capabilities 事件。
+const OpenAIWSIngressCapabilitiesSubprotocol = "sub2api.capabilities.v1"
+
+type openAIWSIngressCapabilitiesEvent struct {
+	Type     string                              `json:"type"`
+	Features openAIWSIngressCapabilitiesFeatures `json:"features"`
+	Limits   openAIWSIngressCapabilitiesLimits   `json:"limits"`
+}
+
+type openAIWSIngressCapabilitiesFeatures struct {
+	Cancel                  bool   `json:"cancel"`
+	BinaryMessages          bool   `json:"binary_messages"`
+	Multiplexing            bool   `json:"multiplexing"`
+	ClientPing              bool   `json:"client_ping"`
+	CloseErrorEvent         bool   `json:"close_error_event"`
+	StreamHeartbeat         bool   `json:"stream_heartbeat"`
+	StreamConsistencyPolicy string `json:"stream_consistency_policy"`
+}
+
+type openAIWSIngressCapabilitiesLimits struct {
+	MaxMessageBytes         int64 `json:"max_message_bytes"`
+	FirstMessageTimeoutMS   int64 `json:"first_message_timeout_ms"`
+	StreamHeartbeatInterval int64 `json:"stream_heartbeat_interval_ms,omitempty"`
+}
+
+// BuildOpenAIWSIngressCapabilitiesEvent 构造 ingress 握手后、读取首条客户端消息前下发的 gateway.capabilities 事件，
+// 描述网关当前支持的特性与限制。cancel/multiplexing 当前未实现，固定为 false。
+func (s *OpenAIGatewayService) BuildOpenAIWSIngressCapabilitiesEvent(maxMessageBytes int64, firstMessageTimeout time.Duration) []byte {
+	heartbeatInterval := s.openAIWSIngressStreamHeartbeatInterval()
+	event := openAIWSIngressCapabilitiesEvent{
+		Type: "gateway.capabilities",
+		Features: openAIWSIngressCapabilitiesFeatures{
+			BinaryMessages:          true,
+			ClientPing:              s.openAIWSIngressClientPingEnabled(),
+			CloseErrorEvent:         s != nil && s.cfg != nil && s.cfg.Gateway.OpenAIWS.ClientCloseErrorEventEnabled,
+			StreamHeartbeat:         heartbeatInterval > 0,
+			StreamConsistencyPolicy: s.openAIWSIngressStreamConsistencyPolicy(),
+		},
+		Limits: openAIWSIngressCapabilitiesLimits{
+			MaxMessageBytes:         maxMessageBytes,
+			FirstMessageTimeoutMS:   firstMessageTimeout.Milliseconds(),
+			StreamHeartbeatInterval: heartbeatInterval.Milliseconds(),
+		},
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil
+	}
+	return payload
+}
+
 // OpenAIWSIngressHooks 定义入站 WS 每个 turn 的生命周期回调。
+//
+// AfterTurn 在 turnErr 非 nil 时，result 通常为 nil；若该 turn 已向客户端输出内容且上游
+// 下发过 usage 片段，则 result 携带 best-effort 的部分 usage（result.PartialUsage=true），
+// 其数值可能低于实际消耗。
+//
+// ReselectAccount 在以下场景调用，由上层按 requestedModel 重新调度并完成并发槽位交接，
+// 返回新账号及其 token；返回 nil 账号表示保持当前账号：
+//   - 开启 reselect_account_on_continuity_break 且续链断裂降级为全量 create；
+//   - 后续 turn 切换模型，且当前账号不支持新模型或开启了 model_change_forces_reselect。
 type OpenAIWSIngressHooks struct {
-	BeforeTurn func(turn int) error
-	AfterTurn  func(turn int, result *OpenAIForwardResult, turnErr error)
+	BeforeTurn      func(turn int) error
+	AfterTurn       func(turn int, result *OpenAIForwardResult, turnErr error)
+	ReselectAccount func(turn int, current *Account, requestedModel string) (*Account, string, error)
 }
 
 func normalizeOpenAIWSLogValue(value string) string {
@@ -406,6 +560,32 @@ func parseOpenAIWSResponseUsageFromCompletedEvent(message []byte, usage *OpenAIU
 	usage.CacheReadInputTokens = int(values[2].Int())
 }
 
+// parseOpenAIWSPartialUsageFragment 从非 completed 事件中尽力提取 usage 片段
+// （如 response.incomplete / response.failed 携带的 response.usage，或顶层 usage）。
+// 片段按字段取最大值合并，避免后到的较小片段覆盖已观测到的累计值；返回是否读到了片段。
+func parseOpenAIWSPartialUsageFragment(message []byte, usage *OpenAIUsage) bool {
+	if usage == nil || len(message) == 0 || !bytes.Contains(message, []byte(`"usage"`)) {
+		return false
+	}
+	node := gjson.GetBytes(message, "response.usage")
+	if !node.IsObject() {
+		node = gjson.GetBytes(message, "usage")
+	}
+	if !node.IsObject() {
+		return false
+	}
+	if v := int(node.Get("input_tokens").Int()); v > usage.InputTokens {
+		usage.InputTokens = v
+	}
+	if v := int(node.Get("output_tokens").Int()); v > usage.OutputTokens {
+		usage.OutputTokens = v
+	}
+	if v := int(node.Get("input_tokens_details.cached_tokens").Int()); v > usage.CacheReadInputTokens {
+		usage.CacheReadInputTokens = v
+	}
+	return true
+}
+
 func parseOpenAIWSErrorEventFields(message []byte) (code string, errType string, errMessage string) {
 	if len(message) == 0 {
 		return "", "", ""
@@ -906,6 +1086,98 @@ func (s *OpenAIGatewayService) getOpenAIWSConnPool() *openAIWSConnPool {
 	return s.openaiWSPool
 }
 
+const (
+	openAIWSModelTransportPolicyDowngrade = "downgrade"
+	openAIWSModelTransportPolicyReject    = "reject"
+)
+
+// openAIWSModelTransportPolicy 返回仅 HTTP 模型在非 HTTP 入站请求上的处理策略，默认 downgrade。
+func (s *OpenAIGatewayService) openAIWSModelTransportPolicy() string {
+	if s != nil && s.cfg != nil && strings.EqualFold(strings.TrimSpace(s.cfg.Gateway.OpenAIWS.ModelTransportPolicy), openAIWSModelTransportPolicyReject) {
+		return openAIWSModelTransportPolicyReject
+	}
+	return openAIWSModelTransportPolicyDowngrade
+}
+
+// openAIWSModelRequiresHTTP 判断模型是否被 model_transports 限制为仅 HTTP。
+func (s *OpenAIGatewayService) openAIWSModelRequiresHTTP(account *Account, model string) bool {
+	if s == nil || s.cfg == nil {
+		return false
+	}
+	return openAIWSModelRequiresHTTP(s.cfg.Gateway.OpenAIWS.ModelTransports, account, model)
+}
+
+// openAIWSForceDedicatedAll 全局强制独占连接（调试用），开启后绕过连接复用。
+func (s *OpenAIGatewayService) openAIWSForceDedicatedAll() bool {
+	return s != nil && s.cfg != nil && s.cfg.Gateway.OpenAIWS.ForceDedicatedAll
+}
+
+// handleOpenAIWSMalformedUpstreamEvent 记录上游非法 JSON 帧（日志 + 指标），返回是否应终止当前 turn。
+// 日志仅记录帧长度，不输出内容，避免泄露上游原始数据。
+func (s *OpenAIGatewayService) handleOpenAIWSMalformedUpstreamEvent(accountID int64, connID, path string, message []byte) bool {
+	if s == nil {
+		return false
+	}
+	s.openaiWSRelayMetrics.malformedUpstreamEvent.Add(1)
+	policy := "drop"
+	if s.cfg != nil && strings.TrimSpace(s.cfg.Gateway.OpenAIWS.MalformedUpstreamEventPolicy) == "terminate" {
+		policy = "terminate"
+	}
+	logOpenAIWSModeInfo(
+		"malformed_upstream_event account_id=%d conn_id=%s path=%s bytes=%d policy=%s",
+		accountID,
+		truncateOpenAIWSLogValue(connID, openAIWSIDValueMaxLen),
+		normalizeOpenAIWSLogValue(path),
+		len(message),
+		policy,
+	)
+	return policy == "terminate"
+}
+
+// RetireOpenAIWSAccount 账号被删除或停用时调用（管理端账号操作、调度快照 outbox 事件）：
+// 进行中的 turn 在原连接上完成后再关闭连接，空闲连接立即回收。
+func (s *OpenAIGatewayService) RetireOpenAIWSAccount(accountID int64) {
+	if s == nil || accountID <= 0 {
+		return
+	}
+	s.getOpenAIWSConnPool().RetireAccount(accountID)
+}
+
+// RecycleAccountConnections 账号 api_key/token 轮换后调用：回收该账号的全部上游连接，
+// 进行中的 turn 在原连接上完成后关闭连接，之后的 turn 使用刷新后的凭证重新建连，避免旧凭证连接集中鉴权失败。
+// 返回回收的连接数。
+func (s *OpenAIGatewayService) RecycleAccountConnections(accountID int64) int {
+	if s == nil || accountID <= 0 {
+		return 0
+	}
+	return s.getOpenAIWSConnPool().RecycleAccount(accountID)
+}
+
+// reloadOpenAIWSAccountToken 重新读取账号并获取当前凭证，供会话连接被回收后用新凭证重新建连；读取失败时返回 false。
+func (s *OpenAIGatewayService) reloadOpenAIWSAccountToken(ctx context.Context, accountID int64) (string, bool) {
+	if s == nil || (s.schedulerSnapshot == nil && s.accountRepo == nil) {
+		return "", false
+	}
+	account, err := s.getSchedulableAccount(ctx, accountID)
+	if err != nil || account == nil {
+		return "", false
+	}
+	token, _, err := s.GetAccessToken(ctx, account)
+	if err != nil || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// EvictOpenAIWSConnsByTag 按连接标签（见 OpenAIWSConnTag）批量驱逐上游连接，如下线某个 endpoint 的全部连接；
+// 进行中的 turn 在原连接上完成后再关闭，其余连接不受影响。返回命中的连接数。
+func (s *OpenAIGatewayService) EvictOpenAIWSConnsByTag(tag string) int {
+	if s == nil {
+		return 0
+	}
+	return s.getOpenAIWSConnPool().EvictConnsByTag(tag)
+}
+
 func (s *OpenAIGatewayService) getOpenAIWSPassthroughDialer() openAIWSClientDialer {
 	if s == nil {
 		return nil
@@ -927,15 +1199,29 @@ func (s *OpenAIGatewayService) SnapshotOpenAIWSPoolMetrics() OpenAIWSPoolMetrics
 }
 
 type OpenAIWSPerformanceMetricsSnapshot struct {
-	Pool      OpenAIWSPoolMetricsSnapshot      `json:"pool"`
-	Retry     OpenAIWSRetryMetricsSnapshot     `json:"retry"`
-	Transport OpenAIWSTransportMetricsSnapshot `json:"transport"`
+	Pool        OpenAIWSPoolMetricsSnapshot           `json:"pool"`
+	Retry       OpenAIWSRetryMetricsSnapshot          `json:"retry"`
+	Recovery    OpenAIWSRecoveryMetricsSnapshot       `json:"recovery"`
+	Relay       OpenAIWSRelayMetricsSnapshot          `json:"relay"`
+	Shadow      OpenAIWSShadowMetricsSnapshot         `json:"shadow"`
+	Transport   OpenAIWSTransportMetricsSnapshot      `json:"transport"`
+	Passthrough openaiwsv2.MetricsSnapshot            `json:"passthrough"`
+	Sessions    OpenAIWSIngressSessionMetricsSnapshot `json:"sessions"`
+	StateStore  OpenAIWSStateStoreMetricsSnapshot     `json:"state_store"`
+	StickyReuse OpenAIWSStickyReuseMetricsSnapshot    `json:"sticky_reuse"`
 }
 
 func (s *OpenAIGatewayService) SnapshotOpenAIWSPerformanceMetrics() OpenAIWSPerformanceMetricsSnapshot {
 	pool := s.getOpenAIWSConnPool()
 	snapshot := OpenAIWSPerformanceMetricsSnapshot{
-		Retry: s.SnapshotOpenAIWSRetryMetrics(),
+		Retry:       s.SnapshotOpenAIWSRetryMetrics(),
+		Recovery:    s.SnapshotOpenAIWSRecoveryMetrics(),
+		Relay:       s.SnapshotOpenAIWSRelayMetrics(),
+		Shadow:      s.SnapshotOpenAIWSShadowMetrics(),
+		Passthrough: openaiwsv2.SnapshotMetrics(),
+		Sessions:    s.SnapshotOpenAIWSIngressSessionMetrics(),
+		StateStore:  s.SnapshotOpenAIWSStateStoreMetrics(),
+		StickyReuse: s.SnapshotOpenAIWSStickyReuseMetrics(),
 	}
 	if pool == nil {
 		return snapshot
@@ -953,13 +1239,49 @@ func (s *OpenAIGatewayService) getOpenAIWSStateStore() OpenAIWSStateStore {
 		if s.openaiWSStateStore == nil {
 			s.openaiWSStateStore = NewOpenAIWSStateStore(s.cache)
 		}
+		if store, ok := s.openaiWSStateStore.(*defaultOpenAIWSStateStore); ok {
+			if store.sessionAnchorsMaxAge == nil {
+				store.sessionAnchorsMaxAge = s.openAIWSSessionResponseMaxAge
+			}
+			if store.failClosed == nil {
+				store.failClosed = s.openAIWSStateStoreFailClosed
+			}
+		}
 	})
 	return s.openaiWSStateStore
 }
 
+// openAIWSStateStoreFailClosed 返回粘连状态存储后端故障时是否 fail-closed（state_store_failure_mode=closed）。
+func (s *OpenAIGatewayService) openAIWSStateStoreFailClosed() bool {
+	if s == nil || s.cfg == nil {
+		return false
+	}
+	return strings.EqualFold(strings.TrimSpace(s.openAIWSConfig().StateStoreFailureMode), "closed")
+}
+
+// SnapshotOpenAIWSStateStoreMetrics 返回粘连状态存储后端故障与降级计数；自定义存储实现时为零值。
+func (s *OpenAIGatewayService) SnapshotOpenAIWSStateStoreMetrics() OpenAIWSStateStoreMetricsSnapshot {
+	if s == nil {
+		return OpenAIWSStateStoreMetricsSnapshot{}
+	}
+	store, ok := s.getOpenAIWSStateStore().(*defaultOpenAIWSStateStore)
+	if !ok || store == nil {
+		return OpenAIWSStateStoreMetricsSnapshot{}
+	}
+	return store.snapshotMetrics()
+}
+
+// openAIWSSessionResponseMaxAge 返回会话续链的绝对最长存活时间；0 表示不限制。
+func (s *OpenAIGatewayService) openAIWSSessionResponseMaxAge() time.Duration {
+	if s == nil || s.cfg == nil || s.openAIWSConfig().SessionResponseMaxAgeSeconds <= 0 {
+		return 0
+	}
+	return time.Duration(s.openAIWSConfig().SessionResponseMaxAgeSeconds) * time.Second
+}
+
 func (s *OpenAIGatewayService) openAIWSResponseStickyTTL() time.Duration {
 	if s != nil && s.cfg != nil {
-		seconds := s.cfg.Gateway.OpenAIWS.StickyResponseIDTTLSeconds
+		seconds := s.openAIWSConfig().StickyResponseIDTTLSeconds
 		if seconds > 0 {
 			return time.Duration(seconds) * time.Second
 		}
@@ -974,6 +1296,133 @@ func (s *OpenAIGatewayService) openAIWSIngressPreviousResponseRecoveryEnabled()
 	return true
 }
 
+func (s *OpenAIGatewayService) openAIWSIngressStreamHeartbeatInterval() time.Duration {
+	if s != nil && s.cfg != nil && s.cfg.Gateway.OpenAIWS.IngressStreamHeartbeatIntervalMS > 0 {
+		return time.Duration(s.cfg.Gateway.OpenAIWS.IngressStreamHeartbeatIntervalMS) * time.Millisecond
+	}
+	return 0
+}
+
+// openAIWSMaxFullCreateReplaysPerSession 返回单个 ingress 会话的恢复重放上限，0 表示不限制。
+func (s *OpenAIGatewayService) openAIWSMaxFullCreateReplaysPerSession() int {
+	if s != nil && s.cfg != nil && s.cfg.Gateway.OpenAIWS.MaxFullCreateReplaysPerSession > 0 {
+		return s.cfg.Gateway.OpenAIWS.MaxFullCreateReplaysPerSession
+	}
+	return 0
+}
+
+func (s *OpenAIGatewayService) openAIWSMaxReplayInputBytes() int {
+	if s != nil && s.cfg != nil && s.cfg.Gateway.OpenAIWS.MaxReplayInputBytes > 0 {
+		return s.cfg.Gateway.OpenAIWS.MaxReplayInputBytes
+	}
+	return 0
+}
+
+func (s *OpenAIGatewayService) openAIWSIngressClientPingEnabled() bool {
+	return s != nil && s.cfg != nil && s.cfg.Gateway.OpenAIWS.IngressClientPingEnabled
+}
+
+func (s *OpenAIGatewayService) openAIWSReselectAccountOnContinuityBreak() bool {
+	return s != nil && s.cfg != nil && s.cfg.Gateway.OpenAIWS.ReselectAccountOnContinuityBreak
+}
+
+func (s *OpenAIGatewayService) openAIWSModelChangeForcesReselect() bool {
+	return s != nil && s.cfg != nil && s.cfg.Gateway.OpenAIWS.ModelChangeForcesReselect
+}
+
+const (
+	openAIWSStreamConsistencyPolicyOff    = "off"
+	openAIWSStreamConsistencyPolicyReject = "reject"
+	openAIWSStreamConsistencyPolicyCoerce = "coerce"
+)
+
+// openAIWSIngressStreamConsistencyPolicy 返回 ingress 会话内 turn 翻转 stream 模式时的处理策略。
+func (s *OpenAIGatewayService) openAIWSIngressStreamConsistencyPolicy() string {
+	if s == nil || s.cfg == nil {
+		return openAIWSStreamConsistencyPolicyOff
+	}
+	switch strings.TrimSpace(s.cfg.Gateway.OpenAIWS.IngressStreamConsistencyPolicy) {
+	case openAIWSStreamConsistencyPolicyReject:
+		return openAIWSStreamConsistencyPolicyReject
+	case openAIWSStreamConsistencyPolicyCoerce:
+		return openAIWSStreamConsistencyPolicyCoerce
+	default:
+		return openAIWSStreamConsistencyPolicyOff
+	}
+}
+
+// ValidateOpenAIWSIngressSessionIdentity 在开启 ingress_require_session_id 时校验会话首个 turn 携带显式会话标识
+// （session_id / conversation_id 请求头或 prompt_cache_key），缺失时返回 StatusPolicyViolation 关闭错误，
+// 避免路由落到 GenerateSessionHashWithFallback 的兜底哈希上。
+func (s *OpenAIGatewayService) ValidateOpenAIWSIngressSessionIdentity(c *gin.Context, firstMessage []byte) error {
+	if s == nil || s.cfg == nil || !s.cfg.Gateway.OpenAIWS.IngressRequireSessionID {
+		return nil
+	}
+	if c != nil && (strings.TrimSpace(c.GetHeader("session_id")) != "" || strings.TrimSpace(c.GetHeader("conversation_id")) != "") {
+		return nil
+	}
+	if strings.TrimSpace(gjson.GetBytes(firstMessage, "prompt_cache_key").String()) != "" {
+		return nil
+	}
+	return NewOpenAIWSClientCloseErrorWithCode(
+		coderws.StatusPolicyViolation,
+		"session identifier required: set session_id/conversation_id header or prompt_cache_key",
+		"session_id_required",
+		nil,
+	)
+}
+
+// ValidateOpenAIWSIngressFirstClientMessage 校验 ingress 首条客户端消息是否为合法的 response.create。
+// 不合法时返回带描述性原因的 StatusPolicyViolation 关闭错误，避免带着无效首包进入调度与建连。
+func ValidateOpenAIWSIngressFirstClientMessage(message []byte) error {
+	trimmed := bytes.TrimSpace(message)
+	if len(trimmed) == 0 {
+		return NewOpenAIWSClientCloseError(coderws.StatusPolicyViolation, "empty first message; expected response.create", nil)
+	}
+	if !gjson.ValidBytes(trimmed) {
+		return NewOpenAIWSClientCloseError(coderws.StatusPolicyViolation, "first message is not valid JSON; expected response.create", errors.New("invalid json"))
+	}
+	parsed := gjson.ParseBytes(trimmed)
+	if !parsed.IsObject() {
+		return NewOpenAIWSClientCloseError(coderws.StatusPolicyViolation, "first message must be a JSON object; expected response.create", nil)
+	}
+	switch eventType := strings.TrimSpace(parsed.Get("type").String()); eventType {
+	case "", "response.create":
+	case "response.append":
+		return NewOpenAIWSClientCloseError(
+			coderws.StatusPolicyViolation,
+			"response.append is not supported in ws v2; use response.create with previous_response_id",
+			nil,
+		)
+	default:
+		return NewOpenAIWSClientCloseError(
+			coderws.StatusPolicyViolation,
+			fmt.Sprintf("first message must be response.create, got type: %s", truncateOpenAIWSLogValue(eventType, 48)),
+			nil,
+		)
+	}
+	if strings.TrimSpace(parsed.Get("model").String()) == "" {
+		return NewOpenAIWSClientCloseError(coderws.StatusPolicyViolation, "model is required in first response.create payload", nil)
+	}
+	return nil
+}
+
+// isOpenAIWSIngressClientPingMessage 判断客户端消息是否为 {"type":"ping"} 控制消息。
+func isOpenAIWSIngressClientPingMessage(message []byte) bool {
+	trimmed := bytes.TrimSpace(message)
+	if len(trimmed) == 0 || !bytes.Contains(trimmed, []byte("ping")) || !gjson.ValidBytes(trimmed) {
+		return false
+	}
+	return strings.TrimSpace(gjson.GetBytes(trimmed, "type").String()) == "ping"
+}
+
+func buildOpenAIWSIngressPongMessage(upstreamHealthy bool) []byte {
+	if upstreamHealthy {
+		return []byte(`{"type":"pong","upstream_healthy":true}`)
+	}
+	return []byte(`{"type":"pong","upstream_healthy":false}`)
+}
+
 func (s *OpenAIGatewayService) openAIWSReadTimeout() time.Duration {
 	if s != nil && s.cfg != nil && s.cfg.Gateway.OpenAIWS.ReadTimeoutSeconds > 0 {
 		return time.Duration(s.cfg.Gateway.OpenAIWS.ReadTimeoutSeconds) * time.Second
@@ -1055,10 +1504,85 @@ func (s *OpenAIGatewayService) openAIWSDialTimeout() time.Duration {
 	return 10 * time.Second
 }
 
-func (s *OpenAIGatewayService) openAIWSAcquireTimeout() time.Duration {
+// openAIWSTimeoutOverrideBounds 返回请求级超时覆盖允许的 [min, max] 区间。
+func (s *OpenAIGatewayService) openAIWSTimeoutOverrideBounds() (time.Duration, time.Duration) {
+	minTimeout, maxTimeout := time.Second, 30*time.Minute
+	if s != nil && s.cfg != nil {
+		if s.cfg.Gateway.OpenAIWS.RequestTimeoutOverrideMinSeconds > 0 {
+			minTimeout = time.Duration(s.cfg.Gateway.OpenAIWS.RequestTimeoutOverrideMinSeconds) * time.Second
+		}
+		if s.cfg.Gateway.OpenAIWS.RequestTimeoutOverrideMaxSeconds > 0 {
+			maxTimeout = time.Duration(s.cfg.Gateway.OpenAIWS.RequestTimeoutOverrideMaxSeconds) * time.Second
+		}
+	}
+	if maxTimeout < minTimeout {
+		maxTimeout = minTimeout
+	}
+	return minTimeout, maxTimeout
+}
+
+func (s *OpenAIGatewayService) clampOpenAIWSTimeoutOverride(timeout time.Duration) time.Duration {
+	minTimeout, maxTimeout := s.openAIWSTimeoutOverrideBounds()
+	if timeout < minTimeout {
+		return minTimeout
+	}
+	if timeout > maxTimeout {
+		return maxTimeout
+	}
+	return timeout
+}
+
+const (
+	// OpenAIUpstreamDialTimeoutHeader 客户端请求级覆盖上游建连超时的请求头（秒，可为小数）。
+	OpenAIUpstreamDialTimeoutHeader = "X-Upstream-Dial-Timeout-Seconds"
+	// OpenAIUpstreamReadTimeoutHeader 客户端请求级覆盖上游单事件读超时的请求头（秒，可为小数）。
+	OpenAIUpstreamReadTimeoutHeader = "X-Upstream-Read-Timeout-Seconds"
+)
+
+// ResolveOpenAIUpstreamTimeoutOverride 解析请求头中的上游建连/读超时覆盖，并按
+// request_timeout_override_{min,max}_seconds 钳制；缺失或非法的项返回 0（不覆盖）。
+func (s *OpenAIGatewayService) ResolveOpenAIUpstreamTimeoutOverride(c *gin.Context) (dialTimeout, readTimeout time.Duration) {
+	if c == nil || c.Request == nil {
+		return 0, 0
+	}
+	parse := func(header string) time.Duration {
+		raw := strings.TrimSpace(c.GetHeader(header))
+		if raw == "" {
+			return 0
+		}
+		seconds, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(seconds) || seconds <= 0 {
+			return 0
+		}
+		// 先与上限比较再换算，避免超大值换算为 Duration 时溢出。
+		if _, maxTimeout := s.openAIWSTimeoutOverrideBounds(); seconds >= maxTimeout.Seconds() {
+			return maxTimeout
+		}
+		return s.clampOpenAIWSTimeoutOverride(time.Duration(seconds * float64(time.Second)))
+	}
+	return parse(OpenAIUpstreamDialTimeoutHeader), parse(OpenAIUpstreamReadTimeoutHeader)
+}
+
+// openAIWSDialTimeoutForRequest 优先使用请求上下文中的建连超时覆盖（按配置上下限钳制），否则回退配置默认值。
+func (s *OpenAIGatewayService) openAIWSDialTimeoutForRequest(ctx context.Context) time.Duration {
+	if dial, _, ok := UpstreamTimeoutOverrideFromContext(ctx); ok && dial > 0 {
+		return s.clampOpenAIWSTimeoutOverride(dial)
+	}
+	return s.openAIWSDialTimeout()
+}
+
+// openAIWSReadTimeoutForRequest 优先使用请求上下文中的单事件读超时覆盖（按配置上下限钳制），否则回退配置默认值。
+func (s *OpenAIGatewayService) openAIWSReadTimeoutForRequest(ctx context.Context) time.Duration {
+	if _, read, ok := UpstreamTimeoutOverrideFromContext(ctx); ok && read > 0 {
+		return s.clampOpenAIWSTimeoutOverride(read)
+	}
+	return s.openAIWSReadTimeout()
+}
+
+func (s *OpenAIGatewayService) openAIWSAcquireTimeout(ctx context.Context) time.Duration {
 	// Acquire 覆盖“连接复用命中/排队/新建连接”三个阶段。
 	// 这里不再叠加 write_timeout，避免高并发排队时把 TTFT 长尾拉到分钟级。
-	dial := s.openAIWSDialTimeout()
+	dial := s.openAIWSDialTimeoutForRequest(ctx)
 	if dial <= 0 {
 		dial = 10 * time.Second
 	}
@@ -1149,6 +1673,7 @@ func (s *OpenAIGatewayService) buildOpenAIWSHeaders(
 		betaValue = openAIWSBetaV1Value
 	}
 	headers.Set("OpenAI-Beta", betaValue)
+	s.applyOpenAIWSForwardClientHeaders(c, headers)
 
 	customUA := ""
 	if account != nil {
@@ -1171,6 +1696,29 @@ func (s *OpenAIGatewayService) buildOpenAIWSHeaders(
 	return headers, sessionResolution
 }
 
+// applyOpenAIWSForwardClientHeaders 按 forward_client_headers 白名单把客户端请求头复制到上游握手头；
+// 白名单外的客户端头不会出现在上游请求中。客户端未携带或值为空时保持内置默认值。
+func (s *OpenAIGatewayService) applyOpenAIWSForwardClientHeaders(c *gin.Context, headers http.Header) {
+	if s == nil || s.cfg == nil || c == nil || c.Request == nil || headers == nil {
+		return
+	}
+	for source, target := range s.cfg.Gateway.OpenAIWS.ForwardClientHeaders {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+		value := strings.TrimSpace(c.Request.Header.Get(source))
+		if value == "" {
+			continue
+		}
+		target = strings.TrimSpace(target)
+		if target == "" {
+			target = source
+		}
+		headers.Set(target, value)
+	}
+}
+
 func (s *OpenAIGatewayService) buildOpenAIWSCreatePayload(reqBody map[string]any, account *Account) map[string]any {
 	// OpenAI WS Mode 协议：response.create 字段与 HTTP /responses 基本一致。
 	// 保留 stream 字段（与 Codex CLI 一致），仅移除 background。
@@ -1189,6 +1737,8 @@ func (s *OpenAIGatewayService) buildOpenAIWSCreatePayload(reqBody map[string]any
 	if account != nil && account.Type == AccountTypeOAuth && !s.isOpenAIWSStoreRecoveryAllowed(account) {
 		payload["store"] = false
 	}
+	applyOpenAIWSModelDefaultParamsMap(payload, s.openAIWSModelDefaultParamRules(openAIWSPayloadString(payload, "model")))
+	applyOpenAIWSRequestRewriteMap(payload, s.openAIWSRequestRewriteRules(account))
 	return payload
 }
 
@@ -1526,32 +2076,61 @@ func openAIWSRawItemsHasPrefix(items []json.RawMessage, prefix []json.RawMessage
 	return true
 }
 
+// buildOpenAIWSReplayInputSequence 计算本轮的全量 input（供全量 create 重放）。
+// 续链 turn 的增量按 rules 并入上一轮缓冲（见 openAIWSReplayInputRules 的约束说明）。
+// maxBytes>0 时在复制前校验结果大小，超限返回 errOpenAIWSReplayInputTooLarge，避免超大会话在内存中反复复制。
 func buildOpenAIWSReplayInputSequence(
 	previousFullInput []json.RawMessage,
 	previousFullInputExists bool,
 	currentPayload []byte,
 	hasPreviousResponseID bool,
+	maxBytes int,
+	rules openAIWSReplayInputRules,
 ) ([]json.RawMessage, bool, error) {
 	currentItems, currentExists, currentErr := openAIWSExtractNormalizedInputSequence(currentPayload)
 	if currentErr != nil {
 		return nil, false, currentErr
 	}
-	if !hasPreviousResponseID {
-		return cloneOpenAIWSRawMessages(currentItems), currentExists, nil
-	}
-	if !previousFullInputExists {
+	if !hasPreviousResponseID || !previousFullInputExists {
+		if err := checkOpenAIWSReplayInputSize(maxBytes, currentItems); err != nil {
+			return nil, false, err
+		}
 		return cloneOpenAIWSRawMessages(currentItems), currentExists, nil
 	}
 	if !currentExists || len(currentItems) == 0 {
+		if err := checkOpenAIWSReplayInputSize(maxBytes, previousFullInput); err != nil {
+			return nil, false, err
+		}
 		return cloneOpenAIWSRawMessages(previousFullInput), true, nil
 	}
 	if openAIWSRawItemsHasPrefix(currentItems, previousFullInput) {
+		if err := checkOpenAIWSReplayInputSize(maxBytes, currentItems); err != nil {
+			return nil, false, err
+		}
 		return cloneOpenAIWSRawMessages(currentItems), true, nil
 	}
-	merged := make([]json.RawMessage, 0, len(previousFullInput)+len(currentItems))
-	merged = append(merged, cloneOpenAIWSRawMessages(previousFullInput)...)
-	merged = append(merged, cloneOpenAIWSRawMessages(currentItems)...)
-	return merged, true, nil
+	merged := mergeOpenAIWSReplayInputDelta(previousFullInput, currentItems, rules)
+	if err := checkOpenAIWSReplayInputSize(maxBytes, merged); err != nil {
+		return nil, false, err
+	}
+	return cloneOpenAIWSRawMessages(merged), true, nil
+}
+
+// checkOpenAIWSReplayInputSize 校验若干 input 片段的总字节数是否超过 maxBytes；maxBytes<=0 表示不限制。
+func checkOpenAIWSReplayInputSize(maxBytes int, parts ...[]json.RawMessage) error {
+	if maxBytes <= 0 {
+		return nil
+	}
+	total := 0
+	for _, items := range parts {
+		for _, item := range items {
+			total += len(item)
+			if total > maxBytes {
+				return errOpenAIWSReplayInputTooLarge
+			}
+		}
+	}
+	return nil
 }
 
 func setOpenAIWSPayloadInputSequence(
@@ -1758,7 +2337,11 @@ func (s *OpenAIGatewayService) forwardOpenAIWSV2(
 	sessionHash := s.GenerateSessionHash(c, nil)
 	if sessionHash == "" {
 		var legacySessionHash string
-		sessionHash, legacySessionHash = openAIWSSessionHashesFromID(promptCacheKey)
+		sessionID := promptCacheKey
+		if sessionID != "" && s.openAIPromptCacheKeyFingerprintEnabled() {
+			sessionID = promptCacheKeySessionIDWithFingerprint(sessionID, payload["input"])
+		}
+		sessionHash, legacySessionHash = openAIWSSessionHashesFromID(sessionID)
 		attachOpenAILegacySessionHashToGin(c, legacySessionHash)
 	}
 	if turnState == "" && stateStore != nil && sessionHash != "" {
@@ -1781,6 +2364,13 @@ func (s *OpenAIGatewayService) forwardOpenAIWSV2(
 	storeDisabledConnMode := s.openAIWSStoreDisabledConnMode()
 	forceNewConnByPolicy := shouldForceNewConnOnStoreDisabled(storeDisabledConnMode, lastFailureReason)
 	forceNewConn := forceNewConnByPolicy && storeDisabled && previousResponseID == "" && sessionHash != "" && preferredConnID == ""
+	// 全局强制独占：每轮新建连接，结束后标记损坏关闭，复用 dedicated 的隔离语义。
+	forceDedicated := s.openAIWSForceDedicatedAll()
+	connMode := ""
+	if forceDedicated {
+		forceNewConn = true
+		connMode = OpenAIWSIngressModeDedicated
+	}
 	wsHeaders, sessionResolution := s.buildOpenAIWSHeaders(c, account, token, decision, isCodexCLI, turnState, turnMetadata, promptCacheKey)
 	logOpenAIWSModeDebug(
 		"acquire_start account_id=%d account_type=%s transport=%s preferred_conn_id=%s has_previous_response_id=%v session_hash=%s has_turn_state=%v turn_state_len=%d has_turn_metadata=%v turn_metadata_len=%d store_disabled=%v store_disabled_conn_mode=%s retry_last_reason=%s force_new_conn=%v header_user_agent=%s header_openai_beta=%s header_originator=%s header_accept_language=%s header_session_id=%s header_conversation_id=%s session_id_source=%s conversation_id_source=%s has_prompt_cache_key=%v has_chatgpt_account_id=%v has_authorization=%v has_session_id=%v has_conversation_id=%v proxy_enabled=%v",
@@ -1814,7 +2404,7 @@ func (s *OpenAIGatewayService) forwardOpenAIWSV2(
 		account.ProxyID != nil && account.Proxy != nil,
 	)
 
-	acquireCtx, acquireCancel := context.WithTimeout(ctx, s.openAIWSAcquireTimeout())
+	acquireCtx, acquireCancel := context.WithTimeout(ctx, s.openAIWSAcquireTimeout(ctx))
 	defer acquireCancel()
 
 	lease, err := s.getOpenAIWSConnPool().Acquire(acquireCtx, openAIWSAcquireRequest{
@@ -1853,13 +2443,14 @@ func (s *OpenAIGatewayService) forwardOpenAIWSV2(
 			wsPath,
 			account.ProxyID != nil && account.Proxy != nil,
 		)
-		var dialErr *openAIWSDialError
-		if errors.As(err, &dialErr) && dialErr != nil && dialErr.StatusCode == http.StatusTooManyRequests {
-			s.persistOpenAIWSRateLimitSignal(ctx, account, dialErr.ResponseHeaders, nil, "rate_limit_exceeded", "rate_limit_error", strings.TrimSpace(err.Error()))
-		}
+		// 握手失败随后会回退 HTTP，handler 看不到这次失败，因此 5xx 需在此计入调度错误率。
+		s.reportOpenAIWSDialFailure(ctx, account, err, true)
 		return nil, wrapOpenAIWSFallback(classifyOpenAIWSAcquireError(err), err)
 	}
 	defer lease.Release()
+	if forceDedicated {
+		defer lease.MarkBroken()
+	}
 	connID := strings.TrimSpace(lease.ConnID())
 	logOpenAIWSModeDebug(
 		"connected account_id=%d account_type=%s transport=%s conn_id=%s conn_reused=%v conn_pick_ms=%d queue_wait_ms=%d has_previous_response_id=%v",
@@ -1956,6 +2547,8 @@ func (s *OpenAIGatewayService) forwardOpenAIWSV2(
 	}
 
 	usage := &OpenAIUsage{}
+	// usageMissingMessage 保存缺失 usage 的 response.completed 帧，用于按策略补全计费。
+	var usageMissingMessage []byte
 	var firstTokenMs *int
 	responseID := ""
 	var finalResponse []byte
@@ -1965,6 +2558,10 @@ func (s *OpenAIGatewayService) forwardOpenAIWSV2(
 	if needModelReplace && mappedModel != "" {
 		mappedModelBytes = []byte(mappedModel)
 	}
+	gatewayTurnID := ""
+	if s.openAIWSInjectGatewayTurnIDEnabled() {
+		gatewayTurnID = openAIWSGatewayTurnID(openAIWSGatewayTurnIDBase(ctx), 1)
+	}
 	bufferedStreamEvents := make([][]byte, 0, 4)
 	eventCount := 0
 	tokenEventCount := 0
@@ -1992,6 +2589,14 @@ func (s *OpenAIGatewayService) forwardOpenAIWSV2(
 	}
 
 	clientDisconnected := false
+	// disconnectDrainAborted 客户端断连时 drain 并发已满，停止读取上游。
+	disconnectDrainAborted := false
+	var releaseDisconnectDrain func()
+	defer func() {
+		if releaseDisconnectDrain != nil {
+			releaseDisconnectDrain()
+		}
+	}()
 	flushBatchSize := s.openAIWSEventFlushBatchSize()
 	flushInterval := s.openAIWSEventFlushInterval()
 	pendingFlushEvents := 0
@@ -2025,6 +2630,14 @@ func (s *OpenAIGatewayService) forwardOpenAIWSV2(
 			return
 		}
 		clientDisconnected = true
+		release, ok := s.beginOpenAIWSDisconnectDrain()
+		if !ok {
+			disconnectDrainAborted = true
+			lease.MarkBroken()
+			logger.LegacyPrintf("service.openai_gateway", "[OpenAI WS Mode] client disconnected, drain concurrency saturated, abort upstream: account=%d", account.ID)
+			return
+		}
+		releaseDisconnectDrain = release
 		logger.LegacyPrintf("service.openai_gateway", "[OpenAI WS Mode] client disconnected, continue draining upstream: account=%d", account.ID)
 	}
 	flushBufferedStreamEvents := func(reason string) {
@@ -2051,9 +2664,12 @@ func (s *OpenAIGatewayService) forwardOpenAIWSV2(
 		}
 	}
 
-	readTimeout := s.openAIWSReadTimeout()
+	readTimeout := s.openAIWSReadTimeoutForRequest(ctx)
 
 	for {
+		if disconnectDrainAborted {
+			break
+		}
 		message, readErr := lease.ReadMessageWithContextTimeout(ctx, readTimeout)
 		if readErr != nil {
 			lease.MarkBroken()
@@ -2084,8 +2700,30 @@ func (s *OpenAIGatewayService) forwardOpenAIWSV2(
 			return nil, fmt.Errorf("openai ws read event: %w", readErr)
 		}
 
+		if !gjson.ValidBytes(message) {
+			if s.handleOpenAIWSMalformedUpstreamEvent(account.ID, connID, "http", message) {
+				lease.MarkBroken()
+				if !wroteDownstream {
+					return nil, wrapOpenAIWSFallback("malformed_upstream_event", errOpenAIWSMalformedUpstreamEvent)
+				}
+				setOpsUpstreamError(c, 0, errOpenAIWSMalformedUpstreamEvent.Error(), "")
+				return nil, fmt.Errorf("openai ws read event: %w", errOpenAIWSMalformedUpstreamEvent)
+			}
+			continue
+		}
 		eventType, eventResponseID, responseField := parseOpenAIWSEventEnvelope(message)
 		if eventType == "" {
+			// 合法 JSON 但结构未知的帧原样透传，首 token 前同样进入缓冲，保持顺序与回退语义。
+			if reqStream && !clientDisconnected {
+				if firstTokenMs == nil {
+					buffered := make([]byte, len(message))
+					copy(buffered, message)
+					bufferedStreamEvents = append(bufferedStreamEvents, buffered)
+					bufferedEventCount++
+				} else {
+					emitStreamMessage(message, false)
+				}
+			}
 			continue
 		}
 		eventCount++
@@ -2128,6 +2766,9 @@ func (s *OpenAIGatewayService) forwardOpenAIWSV2(
 			if needModelReplace && len(mappedModelBytes) > 0 && openAIWSEventMayContainModel(eventType) && bytes.Contains(message, mappedModelBytes) {
 				message = replaceOpenAIWSMessageModel(message, mappedModel, originalModel)
 			}
+			if gatewayTurnID != "" {
+				message = injectOpenAIWSGatewayTurnID(message, eventType, gatewayTurnID)
+			}
 			if openAIWSEventMayContainToolCalls(eventType) && openAIWSMessageLikelyContainsToolCalls(message) {
 				if corrected, changed := s.toolCorrector.CorrectToolCallsInSSEBytes(message); changed {
 					message = corrected
@@ -2136,6 +2777,11 @@ func (s *OpenAIGatewayService) forwardOpenAIWSV2(
 		}
 		if openAIWSEventShouldParseUsage(eventType) {
 			parseOpenAIWSResponseUsageFromCompletedEvent(message, usage)
+			if openAIWSCompletedEventMissingUsage(message) {
+				usageMissingMessage = message
+			} else {
+				usageMissingMessage = nil
+			}
 		}
 
 		if eventType == "error" {
@@ -2159,6 +2805,9 @@ func (s *OpenAIGatewayService) forwardOpenAIWSV2(
 				errMessage,
 			)
 			if fallbackReason == "previous_response_not_found" {
+				if previousResponseID != "" {
+					s.reportOpenAIAccountPreviousResponseOutcome(account.ID, true)
+				}
 				logOpenAIWSModeInfo(
 					"previous_response_not_found_diag account_id=%d account_type=%s conn_id=%s previous_response_id=%s previous_response_id_kind=%s response_id=%s event_idx=%d req_stream=%v store_disabled=%v conn_reused=%v session_hash=%s header_session_id=%s header_conversation_id=%s session_id_source=%s conversation_id_source=%s has_turn_state=%v turn_state_len=%d has_prompt_cache_key=%v err_code=%s err_type=%s err_message=%s",
 					account.ID,
@@ -2276,6 +2925,7 @@ func (s *OpenAIGatewayService) forwardOpenAIWSV2(
 		ttl := s.openAIWSResponseStickyTTL()
 		logOpenAIWSBindResponseAccountWarn(groupID, account.ID, responseID, stateStore.BindResponseAccount(ctx, groupID, responseID, account.ID, ttl))
 		stateStore.BindResponseConn(responseID, lease.ConnID(), ttl)
+		stateStore.BindSessionResponseAnchor(groupID, sessionHash, responseID, account.ID, ttl)
 	}
 	if stateStore != nil && storeDisabled && sessionHash != "" {
 		stateStore.BindSessionConn(groupID, sessionHash, lease.ConnID(), s.openAIWSSessionStickyTTL())
@@ -2303,18 +2953,27 @@ func (s *OpenAIGatewayService) forwardOpenAIWSV2(
 		clientDisconnected,
 	)
 
-	return &OpenAIForwardResult{
-		RequestID:       responseID,
-		Usage:           *usage,
-		Model:           originalModel,
-		ServiceTier:     extractOpenAIServiceTier(reqBody),
-		ReasoningEffort: extractOpenAIReasoningEffort(reqBody, originalModel),
-		Stream:          reqStream,
-		OpenAIWSMode:    true,
-		ResponseHeaders: lease.HandshakeHeaders(),
-		Duration:        time.Since(startTime),
-		FirstTokenMs:    firstTokenMs,
-	}, nil
+	if previousResponseID != "" {
+		s.reportOpenAIAccountPreviousResponseOutcome(account.ID, false)
+	}
+	result := &OpenAIForwardResult{
+		RequestID:        responseID,
+		Usage:            *usage,
+		Model:            originalModel,
+		ServiceTier:      extractOpenAIServiceTier(reqBody),
+		ReasoningEffort:  extractOpenAIReasoningEffort(reqBody, originalModel),
+		Stream:           reqStream,
+		OpenAIWSMode:     true,
+		OpenAIWSConnMode: connMode,
+		ResponseHeaders:  lease.HandshakeHeaders(),
+		Duration:         time.Since(startTime),
+		FirstTokenMs:     firstTokenMs,
+	}
+	s.recordOpenAIWSStickyConnReuse(result, preferredConnID, connID, "")
+	if usageMissingMessage != nil {
+		s.applyOpenAIWSUsageMissingPolicy(result, payloadAsJSONBytes(payload), usageMissingMessage)
+	}
+	return result, nil
 }
 
 // ProxyResponsesWebSocketFromClient 处理客户端入站 WebSocket（OpenAI Responses WS Mode）并转发到上游。
@@ -2327,7 +2986,7 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 	token string,
 	firstClientMessage []byte,
 	hooks *OpenAIWSIngressHooks,
-) error {
+) (retErr error) {
 	if s == nil {
 		return errors.New("service is nil")
 	}
@@ -2346,9 +3005,9 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 
 	wsDecision := s.getOpenAIWSProtocolResolver().Resolve(account)
 	modeRouterV2Enabled := s != nil && s.cfg != nil && s.cfg.Gateway.OpenAIWS.ModeRouterV2Enabled
-	ingressMode := OpenAIWSIngressModeCtxPool
+	// force_dedicated_all 覆盖账号级 mode，走与 dedicated 相同的隔离路径。
+	ingressMode := s.resolveOpenAIWSIngressMode(getOpenAIGroupIDFromContext(c), account)
 	if modeRouterV2Enabled {
-		ingressMode = account.ResolveOpenAIResponsesWebSocketV2Mode(s.cfg.Gateway.OpenAIWS.IngressModeDefault)
 		if ingressMode == OpenAIWSIngressModeOff {
 			return NewOpenAIWSClientCloseError(
 				coderws.StatusPolicyViolation,
@@ -2384,7 +3043,17 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 	if wsDecision.Transport != OpenAIUpstreamTransportResponsesWebsocketV2 {
 		return fmt.Errorf("websocket ingress requires ws_v2 transport, got=%s", wsDecision.Transport)
 	}
-	dedicatedMode := modeRouterV2Enabled && ingressMode == OpenAIWSIngressModeDedicated
+	dedicatedMode := ingressMode == OpenAIWSIngressModeDedicated
+	// 会话录制仅覆盖 ctx_pool/shared/dedicated 路径；passthrough 模式不经过本地中继逻辑，不录制。
+	sessionRecorder := s.newOpenAIWSIngressSessionRecorder(account, token)
+	defer logOpenAIWSIngressSessionCapture(sessionRecorder)
+	sessionRecorder.recordClient(firstClientMessage)
+	// 会话级指标在任何退出路径（含异常关闭）都记录；sessionTurns 为已开始的 turn 数。
+	sessionStartedAt := time.Now()
+	sessionTurns := 0
+	defer func() {
+		s.recordOpenAIWSIngressSessionClosed(time.Since(sessionStartedAt), sessionTurns, retErr)
+	}()
 
 	wsURL, err := s.buildOpenAIResponsesWSURL(account)
 	if err != nil {
@@ -2433,6 +3102,12 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 		return rebuilt, nil
 	}
 
+	// sessionStream: 会话首个 turn 的 stream 取值，供 ingress_stream_consistency_policy 比对后续 turn。
+	streamConsistencyPolicy := s.openAIWSIngressStreamConsistencyPolicy()
+	sessionStream := true
+	sessionStreamSet := false
+	duplicateKeyPolicy := s.openAIWSIngressDuplicateKeyPolicy()
+
 	parseClientPayload := func(raw []byte) (openAIWSClientPayload, error) {
 		trimmed := bytes.TrimSpace(raw)
 		if len(trimmed) == 0 {
@@ -2441,6 +3116,13 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 		if !gjson.ValidBytes(trimmed) {
 			return openAIWSClientPayload{}, NewOpenAIWSClientCloseError(coderws.StatusPolicyViolation, "invalid websocket request payload", errors.New("invalid json"))
 		}
+		if duplicateKeyPolicy != openAIWSDuplicateKeyPolicyOff {
+			canonical, dupErr := applyOpenAIWSDuplicateKeyPolicy(trimmed, duplicateKeyPolicy, account.ID)
+			if dupErr != nil {
+				return openAIWSClientPayload{}, dupErr
+			}
+			trimmed = canonical
+		}
 
 		values := gjson.GetManyBytes(trimmed, "type", "model", "prompt_cache_key", "previous_response_id")
 		eventType := strings.TrimSpace(values[0].String())
@@ -2469,6 +3151,13 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 		}
 
 		originalModel := strings.TrimSpace(values[1].String())
+		if originalModel == "" {
+			if injected, defaultModel, ok := ApplyOpenAIGroupDefaultModel(normalized, getOpenAIGroupFromContext(c)); ok {
+				normalized = injected
+				originalModel = defaultModel
+				logOpenAIWSModeInfo("ingress_ws_default_model_injected account_id=%d model=%s", account.ID, defaultModel)
+			}
+		}
 		if originalModel == "" {
 			return openAIWSClientPayload{}, NewOpenAIWSClientCloseError(
 				coderws.StatusPolicyViolation,
@@ -2493,8 +3182,17 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 			}
 			normalized = next
 		}
-		mappedModel := account.GetMappedModel(originalModel)
-		if normalizedModel := normalizeCodexModel(mappedModel); normalizedModel != "" {
+		if s.openAIWSModelRequiresHTTP(account, originalModel) {
+			logOpenAIWSModeInfo("ingress_ws_model_http_only_rejected account_id=%d model=%s", account.ID, truncateOpenAIWSLogValue(originalModel, openAIWSLogValueMaxLen))
+			return openAIWSClientPayload{}, NewOpenAIWSClientCloseErrorWithCode(
+				coderws.StatusPolicyViolation,
+				"model is only available over HTTP; use POST /v1/responses",
+				"model_requires_http",
+				nil,
+			)
+		}
+		mappedModel := account.GetMappedModel(originalModel)
+		if normalizedModel := normalizeCodexModel(mappedModel); normalizedModel != "" {
 			mappedModel = normalizedModel
 		}
 		if mappedModel != originalModel {
@@ -2504,6 +3202,45 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 			}
 			normalized = next
 		}
+		if streamConsistencyPolicy != openAIWSStreamConsistencyPolicyOff {
+			turnStream := openAIWSPayloadBoolFromRaw(normalized, "stream", true)
+			switch {
+			case !sessionStreamSet:
+				sessionStream = turnStream
+				sessionStreamSet = true
+			case turnStream != sessionStream:
+				if streamConsistencyPolicy == openAIWSStreamConsistencyPolicyReject {
+					logOpenAIWSModeInfo("ingress_ws_stream_mode_flip_rejected account_id=%d session_stream=%v turn_stream=%v", account.ID, sessionStream, turnStream)
+					return openAIWSClientPayload{}, NewOpenAIWSClientCloseError(
+						coderws.StatusPolicyViolation,
+						fmt.Sprintf("stream must stay %v for all turns in a websocket session", sessionStream),
+						nil,
+					)
+				}
+				next, setErr := applyPayloadMutation(normalized, "stream", sessionStream)
+				if setErr != nil {
+					return openAIWSClientPayload{}, NewOpenAIWSClientCloseError(coderws.StatusPolicyViolation, "invalid websocket request payload", setErr)
+				}
+				normalized = next
+				logOpenAIWSModeInfo("ingress_ws_stream_mode_coerced account_id=%d session_stream=%v turn_stream=%v", account.ID, sessionStream, turnStream)
+			}
+		}
+		if defaultRules := s.openAIWSModelDefaultParamRules(mappedModel); len(defaultRules) > 0 {
+			// 模型默认参数只补充客户端未携带的字段；重放的请求体已包含默认值，再次合并不会改变内容。
+			next, defaultsErr := applyOpenAIWSModelDefaultParamsRaw(normalized, defaultRules)
+			if defaultsErr != nil {
+				return openAIWSClientPayload{}, NewOpenAIWSClientCloseError(coderws.StatusPolicyViolation, "invalid websocket request payload", defaultsErr)
+			}
+			normalized = next
+		}
+		if rewriteRules := s.openAIWSRequestRewriteRules(account); len(rewriteRules) > 0 {
+			// 账号级改写作用于最终发往上游的请求体；rawForHash 保持客户端原文，不影响会话哈希。
+			next, rewriteErr := applyOpenAIWSRequestRewriteRaw(normalized, rewriteRules)
+			if rewriteErr != nil {
+				return openAIWSClientPayload{}, NewOpenAIWSClientCloseError(coderws.StatusPolicyViolation, "invalid websocket request payload", rewriteErr)
+			}
+			normalized = next
+		}
 
 		return openAIWSClientPayload{
 			payloadRaw:         normalized,
@@ -2564,6 +3301,36 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 		return errors.New("openai ws conn pool is nil")
 	}
 
+	// 客户端消息由后台 goroutine 持续读取，以便在 turn 排队等待上游连接时也能感知客户端断开：
+	// 断开后 clientCtx 被取消，排队中的获取随即放弃并释放队列名额，不再为已离开的客户端建连。
+	// 读取与消费之间无缓冲，读到的消息被取走前不会继续读取，保持原有的逐条背压。
+	clientCtx, cancelClientCtx := context.WithCancel(ctx)
+	defer cancelClientCtx()
+	type openAIWSIngressClientFrame struct {
+		msgType coderws.MessageType
+		payload []byte
+	}
+	clientFrames := make(chan openAIWSIngressClientFrame)
+	clientReadDone := make(chan struct{})
+	var clientReadErr error
+	GoWithPanicStateDump(func() {
+		defer close(clientReadDone)
+		for {
+			msgType, payload, readErr := clientConn.Read(ctx)
+			if readErr != nil {
+				clientReadErr = readErr
+				cancelClientCtx()
+				return
+			}
+			select {
+			case clientFrames <- openAIWSIngressClientFrame{msgType: msgType, payload: payload}:
+			case <-clientCtx.Done():
+				clientReadErr = clientCtx.Err()
+				return
+			}
+		}
+	})
+
 	logOpenAIWSModeInfo(
 		"ingress_ws_protocol_confirm account_id=%d account_type=%s transport=%s ws_host=%s ws_path=%s ws_mode=%s store_disabled=%v has_session_hash=%v has_previous_response_id=%v",
 		account.ID,
@@ -2609,20 +3376,51 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 		)
 	}
 
-	acquireTimeout := s.openAIWSAcquireTimeout()
+	acquireTimeout := s.openAIWSAcquireTimeout(ctx)
 	if acquireTimeout <= 0 {
 		acquireTimeout = 30 * time.Second
 	}
 
+	// recoveryReconnectPending 标记下一次获取连接属于恢复重连，需占用全局恢复重连名额。
+	recoveryReconnectPending := false
 	acquireTurnLease := func(turn int, preferred string, forcePreferredConn bool) (*openAIWSConnLease, error) {
 		req := cloneOpenAIWSAcquireRequest(baseAcquireReq)
 		req.PreferredConnID = strings.TrimSpace(preferred)
 		req.ForcePreferredConn = forcePreferredConn
 		// dedicated 模式下每次获取均新建连接，避免跨会话复用残留上下文。
 		req.ForceNewConn = dedicatedMode
-		acquireCtx, acquireCancel := context.WithTimeout(ctx, acquireTimeout)
+		releaseRecoverySlot := func() {}
+		if recoveryReconnectPending {
+			recoveryReconnectPending = false
+			release, slotErr := s.acquireOpenAIWSRecoveryReconnectSlot(ctx)
+			if slotErr != nil {
+				logOpenAIWSModeInfo(
+					"ingress_ws_recovery_reconnect_rejected account_id=%d turn=%d cause=%s",
+					account.ID,
+					turn,
+					truncateOpenAIWSLogValue(slotErr.Error(), openAIWSLogValueMaxLen),
+				)
+				return nil, NewOpenAIWSClientCloseError(
+					coderws.StatusTryAgainLater,
+					"upstream recovery reconnects are saturated, please retry later",
+					slotErr,
+				)
+			}
+			releaseRecoverySlot = release
+		}
+		acquireCtx, acquireCancel := context.WithTimeout(clientCtx, acquireTimeout)
 		lease, acquireErr := pool.Acquire(acquireCtx, req)
 		acquireCancel()
+		releaseRecoverySlot()
+		if acquireErr != nil && clientCtx.Err() != nil && ctx.Err() == nil {
+			logOpenAIWSModeInfo(
+				"ingress_ws_client_closed_while_acquiring account_id=%d turn=%d preferred_conn_id=%s",
+				account.ID,
+				turn,
+				truncateOpenAIWSLogValue(preferred, openAIWSIDValueMaxLen),
+			)
+			return nil, errOpenAIWSIngressClientGone
+		}
 		if acquireErr != nil {
 			dialStatus, dialClass, dialCloseStatus, dialCloseReason, dialRespServer, dialRespVia, dialRespCFRay, dialRespReqID := summarizeOpenAIWSDialError(acquireErr)
 			logOpenAIWSModeInfo(
@@ -2645,10 +3443,8 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 				wsPath,
 				account.ProxyID != nil && account.Proxy != nil,
 			)
-			var dialErr *openAIWSDialError
-			if errors.As(acquireErr, &dialErr) && dialErr != nil && dialErr.StatusCode == http.StatusTooManyRequests {
-				s.persistOpenAIWSRateLimitSignal(ctx, account, dialErr.ResponseHeaders, nil, "rate_limit_exceeded", "rate_limit_error", strings.TrimSpace(acquireErr.Error()))
-			}
+			// 入站会话的获取失败会随错误返回，由 handler 统一上报调度结果，这里不重复计入 5xx。
+			s.reportOpenAIWSDialFailure(ctx, account, acquireErr, false)
 			if errors.Is(acquireErr, errOpenAIWSPreferredConnUnavailable) {
 				return nil, NewOpenAIWSClientCloseError(
 					coderws.StatusPolicyViolation,
@@ -2691,16 +3487,17 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 		return lease, nil
 	}
 
-	writeClientMessage := func(message []byte) error {
-		writeCtx, cancel := context.WithTimeout(ctx, s.openAIWSWriteTimeout())
-		defer cancel()
-		return clientConn.Write(writeCtx, coderws.MessageText, message)
-	}
+	relay := newOpenAIWSIngressTurnRelay(ctx, s, account, clientConn, sessionRecorder, ingressMode, debugEnabled)
+	writeClientMessage := relay.writeClientMessage
 
 	readClientMessage := func() ([]byte, error) {
-		msgType, payload, readErr := clientConn.Read(ctx)
-		if readErr != nil {
-			return nil, readErr
+		var msgType coderws.MessageType
+		var payload []byte
+		select {
+		case frame := <-clientFrames:
+			msgType, payload = frame.msgType, frame.payload
+		case <-clientReadDone:
+			return nil, clientReadErr
 		}
 		if msgType != coderws.MessageText && msgType != coderws.MessageBinary {
 			return nil, NewOpenAIWSClientCloseError(
@@ -2709,232 +3506,11 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 				nil,
 			)
 		}
+		sessionRecorder.recordClient(payload)
 		return payload, nil
 	}
 
-	sendAndRelay := func(turn int, lease *openAIWSConnLease, payload []byte, payloadBytes int, originalModel string) (*OpenAIForwardResult, error) {
-		if lease == nil {
-			return nil, errors.New("upstream websocket lease is nil")
-		}
-		turnStart := time.Now()
-		wroteDownstream := false
-		if err := lease.WriteJSONWithContextTimeout(ctx, json.RawMessage(payload), s.openAIWSWriteTimeout()); err != nil {
-			return nil, wrapOpenAIWSIngressTurnError(
-				"write_upstream",
-				fmt.Errorf("write upstream websocket request: %w", err),
-				false,
-			)
-		}
-		if debugEnabled {
-			logOpenAIWSModeDebug(
-				"ingress_ws_turn_request_sent account_id=%d turn=%d conn_id=%s payload_bytes=%d",
-				account.ID,
-				turn,
-				truncateOpenAIWSLogValue(lease.ConnID(), openAIWSIDValueMaxLen),
-				payloadBytes,
-			)
-		}
-
-		responseID := ""
-		usage := OpenAIUsage{}
-		var firstTokenMs *int
-		reqStream := openAIWSPayloadBoolFromRaw(payload, "stream", true)
-		turnPreviousResponseID := openAIWSPayloadStringFromRaw(payload, "previous_response_id")
-		turnPreviousResponseIDKind := ClassifyOpenAIPreviousResponseIDKind(turnPreviousResponseID)
-		turnPromptCacheKey := openAIWSPayloadStringFromRaw(payload, "prompt_cache_key")
-		turnStoreDisabled := s.isOpenAIWSStoreDisabledInRequestRaw(payload, account)
-		turnHasFunctionCallOutput := gjson.GetBytes(payload, `input.#(type=="function_call_output")`).Exists()
-		eventCount := 0
-		tokenEventCount := 0
-		terminalEventCount := 0
-		firstEventType := ""
-		lastEventType := ""
-		needModelReplace := false
-		clientDisconnected := false
-		mappedModel := ""
-		var mappedModelBytes []byte
-		if originalModel != "" {
-			mappedModel = account.GetMappedModel(originalModel)
-			if normalizedModel := normalizeCodexModel(mappedModel); normalizedModel != "" {
-				mappedModel = normalizedModel
-			}
-			needModelReplace = mappedModel != "" && mappedModel != originalModel
-			if needModelReplace {
-				mappedModelBytes = []byte(mappedModel)
-			}
-		}
-		for {
-			upstreamMessage, readErr := lease.ReadMessageWithContextTimeout(ctx, s.openAIWSReadTimeout())
-			if readErr != nil {
-				lease.MarkBroken()
-				return nil, wrapOpenAIWSIngressTurnError(
-					"read_upstream",
-					fmt.Errorf("read upstream websocket event: %w", readErr),
-					wroteDownstream,
-				)
-			}
-
-			eventType, eventResponseID, _ := parseOpenAIWSEventEnvelope(upstreamMessage)
-			if responseID == "" && eventResponseID != "" {
-				responseID = eventResponseID
-			}
-			if eventType != "" {
-				eventCount++
-				if firstEventType == "" {
-					firstEventType = eventType
-				}
-				lastEventType = eventType
-			}
-			if eventType == "error" {
-				errCodeRaw, errTypeRaw, errMsgRaw := parseOpenAIWSErrorEventFields(upstreamMessage)
-				s.persistOpenAIWSRateLimitSignal(ctx, account, lease.HandshakeHeaders(), upstreamMessage, errCodeRaw, errTypeRaw, errMsgRaw)
-				fallbackReason, _ := classifyOpenAIWSErrorEventFromRaw(errCodeRaw, errTypeRaw, errMsgRaw)
-				errCode, errType, errMessage := summarizeOpenAIWSErrorEventFieldsFromRaw(errCodeRaw, errTypeRaw, errMsgRaw)
-				recoverablePrevNotFound := fallbackReason == openAIWSIngressStagePreviousResponseNotFound &&
-					turnPreviousResponseID != "" &&
-					!turnHasFunctionCallOutput &&
-					s.openAIWSIngressPreviousResponseRecoveryEnabled() &&
-					!wroteDownstream
-				if recoverablePrevNotFound {
-					// 可恢复场景使用非 error 关键字日志，避免被 LegacyPrintf 误判为 ERROR 级别。
-					logOpenAIWSModeInfo(
-						"ingress_ws_prev_response_recoverable account_id=%d turn=%d conn_id=%s idx=%d reason=%s code=%s type=%s message=%s previous_response_id=%s previous_response_id_kind=%s response_id=%s store_disabled=%v has_prompt_cache_key=%v",
-						account.ID,
-						turn,
-						truncateOpenAIWSLogValue(lease.ConnID(), openAIWSIDValueMaxLen),
-						eventCount,
-						truncateOpenAIWSLogValue(fallbackReason, openAIWSLogValueMaxLen),
-						errCode,
-						errType,
-						errMessage,
-						truncateOpenAIWSLogValue(turnPreviousResponseID, openAIWSIDValueMaxLen),
-						normalizeOpenAIWSLogValue(turnPreviousResponseIDKind),
-						truncateOpenAIWSLogValue(responseID, openAIWSIDValueMaxLen),
-						turnStoreDisabled,
-						turnPromptCacheKey != "",
-					)
-				} else {
-					logOpenAIWSModeInfo(
-						"ingress_ws_error_event account_id=%d turn=%d conn_id=%s idx=%d fallback_reason=%s err_code=%s err_type=%s err_message=%s previous_response_id=%s previous_response_id_kind=%s response_id=%s store_disabled=%v has_prompt_cache_key=%v",
-						account.ID,
-						turn,
-						truncateOpenAIWSLogValue(lease.ConnID(), openAIWSIDValueMaxLen),
-						eventCount,
-						truncateOpenAIWSLogValue(fallbackReason, openAIWSLogValueMaxLen),
-						errCode,
-						errType,
-						errMessage,
-						truncateOpenAIWSLogValue(turnPreviousResponseID, openAIWSIDValueMaxLen),
-						normalizeOpenAIWSLogValue(turnPreviousResponseIDKind),
-						truncateOpenAIWSLogValue(responseID, openAIWSIDValueMaxLen),
-						turnStoreDisabled,
-						turnPromptCacheKey != "",
-					)
-				}
-				// previous_response_not_found 在 ingress 模式支持单次恢复重试：
-				// 不把该 error 直接下发客户端，而是由上层去掉 previous_response_id 后重放当前 turn。
-				if recoverablePrevNotFound {
-					lease.MarkBroken()
-					errMsg := strings.TrimSpace(errMsgRaw)
-					if errMsg == "" {
-						errMsg = "previous response not found"
-					}
-					return nil, wrapOpenAIWSIngressTurnError(
-						openAIWSIngressStagePreviousResponseNotFound,
-						errors.New(errMsg),
-						false,
-					)
-				}
-			}
-			isTokenEvent := isOpenAIWSTokenEvent(eventType)
-			if isTokenEvent {
-				tokenEventCount++
-			}
-			isTerminalEvent := isOpenAIWSTerminalEvent(eventType)
-			if isTerminalEvent {
-				terminalEventCount++
-			}
-			if firstTokenMs == nil && isTokenEvent {
-				ms := int(time.Since(turnStart).Milliseconds())
-				firstTokenMs = &ms
-			}
-			if openAIWSEventShouldParseUsage(eventType) {
-				parseOpenAIWSResponseUsageFromCompletedEvent(upstreamMessage, &usage)
-			}
-
-			if !clientDisconnected {
-				if needModelReplace && len(mappedModelBytes) > 0 && openAIWSEventMayContainModel(eventType) && bytes.Contains(upstreamMessage, mappedModelBytes) {
-					upstreamMessage = replaceOpenAIWSMessageModel(upstreamMessage, mappedModel, originalModel)
-				}
-				if openAIWSEventMayContainToolCalls(eventType) && openAIWSMessageLikelyContainsToolCalls(upstreamMessage) {
-					if corrected, changed := s.toolCorrector.CorrectToolCallsInSSEBytes(upstreamMessage); changed {
-						upstreamMessage = corrected
-					}
-				}
-				if err := writeClientMessage(upstreamMessage); err != nil {
-					if isOpenAIWSClientDisconnectError(err) {
-						clientDisconnected = true
-						closeStatus, closeReason := summarizeOpenAIWSReadCloseError(err)
-						logOpenAIWSModeInfo(
-							"ingress_ws_client_disconnected_drain account_id=%d turn=%d conn_id=%s close_status=%s close_reason=%s",
-							account.ID,
-							turn,
-							truncateOpenAIWSLogValue(lease.ConnID(), openAIWSIDValueMaxLen),
-							closeStatus,
-							truncateOpenAIWSLogValue(closeReason, openAIWSHeaderValueMaxLen),
-						)
-					} else {
-						return nil, wrapOpenAIWSIngressTurnError(
-							"write_client",
-							fmt.Errorf("write client websocket event: %w", err),
-							wroteDownstream,
-						)
-					}
-				} else {
-					wroteDownstream = true
-				}
-			}
-			if isTerminalEvent {
-				// 客户端已断连时，上游连接的 session 状态不可信，标记 broken 避免回池复用。
-				if clientDisconnected {
-					lease.MarkBroken()
-				}
-				firstTokenMsValue := -1
-				if firstTokenMs != nil {
-					firstTokenMsValue = *firstTokenMs
-				}
-				if debugEnabled {
-					logOpenAIWSModeDebug(
-						"ingress_ws_turn_completed account_id=%d turn=%d conn_id=%s response_id=%s duration_ms=%d events=%d token_events=%d terminal_events=%d first_event=%s last_event=%s first_token_ms=%d client_disconnected=%v",
-						account.ID,
-						turn,
-						truncateOpenAIWSLogValue(lease.ConnID(), openAIWSIDValueMaxLen),
-						truncateOpenAIWSLogValue(responseID, openAIWSIDValueMaxLen),
-						time.Since(turnStart).Milliseconds(),
-						eventCount,
-						tokenEventCount,
-						terminalEventCount,
-						truncateOpenAIWSLogValue(firstEventType, openAIWSLogValueMaxLen),
-						truncateOpenAIWSLogValue(lastEventType, openAIWSLogValueMaxLen),
-						firstTokenMsValue,
-						clientDisconnected,
-					)
-				}
-				return &OpenAIForwardResult{
-					RequestID:       responseID,
-					Usage:           usage,
-					Model:           originalModel,
-					ServiceTier:     extractOpenAIServiceTierFromBody(payload),
-					ReasoningEffort: extractOpenAIReasoningEffortFromBody(payload, originalModel),
-					Stream:          reqStream,
-					OpenAIWSMode:    true,
-					ResponseHeaders: lease.HandshakeHeaders(),
-					Duration:        time.Since(turnStart),
-					FirstTokenMs:    firstTokenMs,
-				}, nil
-			}
-		}
-	}
+	midTurnReconnectMode := s.openAIWSIngressMidTurnReconnectMode()
 
 	currentPayload := firstPayload.payloadRaw
 	currentOriginalModel := firstPayload.originalModel
@@ -2992,15 +3568,43 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 	}
 	defer releaseSessionLease()
 
+	handoffSession := s.registerOpenAIWSHandoffSession(groupID, sessionHash)
+	defer s.unregisterOpenAIWSHandoffSession(handoffSession)
+
 	turn := 1
 	turnRetry := 0
 	turnPrevRecoveryTried := false
+	// turnMitigations 按顺序记录本轮尝试过的恢复手段，轮次结束时写入结果并汇总到恢复层计数。
+	var turnMitigations []string
+	noteTurnMitigation := func(layer string) {
+		turnMitigations = append(turnMitigations, layer)
+		s.recordOpenAIWSRecoveryAttempt(layer)
+	}
+	fullCreateReplays := 0
 	lastTurnFinishedAt := time.Time{}
+	// 预检 ping 空闲阈值按上游连接抖动一次，连接切换后重新取值。
+	preflightPingIdleConnID := ""
+	preflightPingIdle := openAIWSIngressPreflightPingIdle
+	// stickyConnTarget: 本轮期望复用的上游连接（首轮为命中的粘连连接，其后为上一轮使用的连接）；
+	// stickyConnMissReason 记录本轮首个导致放弃该连接的事件，轮次结束时汇总到粘连复用统计。
+	stickyConnTarget := preferredConnID
+	stickyConnMissReason := ""
+	noteStickyConnMiss := func(reason string) {
+		if stickyConnTarget != "" && stickyConnMissReason == "" {
+			stickyConnMissReason = reason
+		}
+	}
 	lastTurnResponseID := ""
+	// responseChainStartedAt: 当前 previous_response_id 链首个 response 的完成时间，用于 session_response_max_age_seconds。
+	responseChainStartedAt := time.Time{}
+	sessionResponseMaxAge := s.openAIWSSessionResponseMaxAge()
+	maxReplayInputBytes := s.openAIWSMaxReplayInputBytes()
+	replayInputRules := s.openAIWSReplayInputRules()
 	lastTurnPayload := []byte(nil)
 	var lastTurnStrictState *openAIWSIngressPreviousTurnStrictState
 	lastTurnReplayInput := []json.RawMessage(nil)
 	lastTurnReplayInputExists := false
+	var lastTurnCallIDs map[string]struct{}
 	currentTurnReplayInput := []json.RawMessage(nil)
 	currentTurnReplayInputExists := false
 	skipBeforeTurn := false
@@ -3016,6 +3620,163 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 		sessionConnID = ""
 		preferredConnID = ""
 	}
+	// allowFullCreateReplay 限制恢复逻辑在单个会话内触发的全量 create 重放次数，
+	// 避免异常客户端每轮都触发昂贵的全量重放而静默放大成本。
+	allowFullCreateReplay := func(turn int, connID string, trigger string) bool {
+		maxReplays := s.openAIWSMaxFullCreateReplaysPerSession()
+		if maxReplays <= 0 || fullCreateReplays < maxReplays {
+			return true
+		}
+		s.recordOpenAIWSFullCreateReplayCapped()
+		logOpenAIWSModeInfo(
+			"ingress_ws_full_create_replay_capped account_id=%d turn=%d conn_id=%s trigger=%s replays=%d max_replays=%d",
+			account.ID,
+			turn,
+			truncateOpenAIWSLogValue(connID, openAIWSIDValueMaxLen),
+			normalizeOpenAIWSLogValue(trigger),
+			fullCreateReplays,
+			maxReplays,
+		)
+		return false
+	}
+	markFullCreateReplay := func() {
+		fullCreateReplays++
+		s.recordOpenAIWSFullCreateReplay()
+	}
+	// reselectIngressAccount 在续链断裂降级为全量 create 后，按配置通过调度器重新选择账号；
+	// 全量 create 不依赖原账号上下文，换到负载更低的账号不影响语义。调用前需已释放当前会话租约。
+	// 上层未提供 ReselectAccount、选择失败或新账号不满足 WSv2 时保持当前账号。
+	switchIngressAccount := func(turn int, trigger string) {
+		if hooks == nil || hooks.ReselectAccount == nil {
+			return
+		}
+		previousAccountID := account.ID
+		nextAccount, nextToken, reselectErr := hooks.ReselectAccount(turn, account, currentOriginalModel)
+		if reselectErr != nil || nextAccount == nil || strings.TrimSpace(nextToken) == "" {
+			cause := "-"
+			if reselectErr != nil {
+				cause = truncateOpenAIWSLogValue(reselectErr.Error(), openAIWSLogValueMaxLen)
+			}
+			logOpenAIWSModeInfo(
+				"ingress_ws_account_reselect_skip account_id=%d turn=%d trigger=%s reason=no_candidate cause=%s",
+				previousAccountID,
+				turn,
+				normalizeOpenAIWSLogValue(trigger),
+				cause,
+			)
+			return
+		}
+		if nextAccount.ID == previousAccountID {
+			return
+		}
+		nextDecision := s.getOpenAIWSProtocolResolver().Resolve(nextAccount)
+		if nextDecision.Transport != OpenAIUpstreamTransportResponsesWebsocketV2 {
+			logOpenAIWSModeInfo(
+				"ingress_ws_account_reselect_skip account_id=%d turn=%d trigger=%s reason=transport_mismatch next_account_id=%d transport=%s",
+				previousAccountID,
+				turn,
+				normalizeOpenAIWSLogValue(trigger),
+				nextAccount.ID,
+				normalizeOpenAIWSLogValue(string(nextDecision.Transport)),
+			)
+			return
+		}
+		nextWSURL, urlErr := s.buildOpenAIResponsesWSURL(nextAccount)
+		if urlErr != nil {
+			logOpenAIWSModeInfo(
+				"ingress_ws_account_reselect_skip account_id=%d turn=%d trigger=%s reason=build_ws_url next_account_id=%d cause=%s",
+				previousAccountID,
+				turn,
+				normalizeOpenAIWSLogValue(trigger),
+				nextAccount.ID,
+				truncateOpenAIWSLogValue(urlErr.Error(), openAIWSLogValueMaxLen),
+			)
+			return
+		}
+		account = nextAccount
+		token = nextToken
+		wsDecision = nextDecision
+		wsURL = nextWSURL
+		if parsedURL, parseErr := url.Parse(wsURL); parseErr == nil && parsedURL != nil {
+			wsHost = normalizeOpenAIWSLogValue(parsedURL.Host)
+			wsPath = normalizeOpenAIWSLogValue(parsedURL.Path)
+		}
+		// turn_state 与 conn 亲和均绑定在原账号上游，换账号后全部重置。
+		turnState = ""
+		preferredConnID = ""
+		nextHeaders, _ := s.buildOpenAIWSHeaders(c, account, token, wsDecision, isCodexCLI, "", strings.TrimSpace(c.GetHeader(openAIWSTurnMetadataHeader)), firstPayload.promptCacheKey)
+		baseAcquireReq = openAIWSAcquireRequest{
+			Account: account,
+			WSURL:   wsURL,
+			Headers: nextHeaders,
+		}
+		if account.ProxyID != nil && account.Proxy != nil {
+			baseAcquireReq.ProxyURL = account.Proxy.URL()
+		}
+		if currentOriginalModel != "" {
+			mappedModel := account.GetMappedModel(currentOriginalModel)
+			if normalizedModel := normalizeCodexModel(mappedModel); normalizedModel != "" {
+				mappedModel = normalizedModel
+			}
+			if updated, setErr := sjson.SetBytes(currentPayload, "model", mappedModel); setErr == nil {
+				currentPayload = updated
+				currentPayloadBytes = len(updated)
+			}
+		}
+		storeDisabled = s.isOpenAIWSStoreDisabledInRequestRaw(currentPayload, account)
+		s.openaiWSRetryMetrics.accountReselect.Add(1)
+		logOpenAIWSModeInfo(
+			"ingress_ws_account_reselected account_id=%d turn=%d trigger=%s previous_account_id=%d ws_host=%s",
+			account.ID,
+			turn,
+			normalizeOpenAIWSLogValue(trigger),
+			previousAccountID,
+			wsHost,
+		)
+	}
+	reselectIngressAccount := func(turn int, trigger string) {
+		if !s.openAIWSReselectAccountOnContinuityBreak() {
+			return
+		}
+		switchIngressAccount(turn, trigger)
+	}
+	// pendingModelChangeFrom 非空表示下一 turn 相对上一 turn 切换了模型，值为上一 turn 的模型。
+	pendingModelChangeFrom := ""
+	modelChangeForcesReselect := s.openAIWSModelChangeForcesReselect()
+	// handleIngressModelChange 在 BeforeTurn 之后处理模型切换：账号支持新模型且未强制重选时保持粘连；
+	// 否则通过 ReselectAccount 重新调度，换账号后释放原连接，由后续流程在新账号上建连。
+	handleIngressModelChange := func(turn int, previousModel string) {
+		supported := account.IsModelSupported(currentOriginalModel)
+		if supported && !modelChangeForcesReselect {
+			logOpenAIWSModeInfo(
+				"ingress_ws_model_change account_id=%d turn=%d previous_model=%s model=%s action=keep_account",
+				account.ID,
+				turn,
+				normalizeOpenAIWSLogValue(previousModel),
+				normalizeOpenAIWSLogValue(currentOriginalModel),
+			)
+			return
+		}
+		trigger := "model_change"
+		if !supported {
+			trigger = "model_unsupported"
+		}
+		previousAccountID := account.ID
+		switchIngressAccount(turn, trigger)
+		if account.ID != previousAccountID {
+			noteStickyConnMiss(openAIWSStickyMissAccountSwitch)
+			resetSessionLease(false)
+		}
+		logOpenAIWSModeInfo(
+			"ingress_ws_model_change account_id=%d turn=%d previous_model=%s model=%s action=%s previous_account_id=%d",
+			account.ID,
+			turn,
+			normalizeOpenAIWSLogValue(previousModel),
+			normalizeOpenAIWSLogValue(currentOriginalModel),
+			normalizeOpenAIWSLogValue(trigger),
+			previousAccountID,
+		)
+	}
 	recoverIngressPrevResponseNotFound := func(relayErr error, turn int, connID string) bool {
 		if !isOpenAIWSIngressPreviousResponseNotFound(relayErr) {
 			return false
@@ -3023,6 +3784,9 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 		if turnPrevRecoveryTried || !s.openAIWSIngressPreviousResponseRecoveryEnabled() {
 			return false
 		}
+		if !allowFullCreateReplay(turn, connID, "previous_response_not_found") {
+			return false
+		}
 		if isStrictAffinityTurn(currentPayload) {
 			// Layer 2：严格亲和链路命中 previous_response_not_found 时，降级为“去掉 previous_response_id 后重放一次”。
 			// 该错误说明续链锚点已失效，继续 strict fail-close 只会直接中断本轮请求。
@@ -3073,12 +3837,24 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 		)
 		currentPayload = updatedWithInput
 		currentPayloadBytes = len(updatedWithInput)
+		noteTurnMitigation(openAIWSRecoveryPrevIDDrop)
+		markFullCreateReplay()
+		noteStickyConnMiss(openAIWSStickyMissPrevResponseNotFound)
 		resetSessionLease(true)
+		recoveryReconnectPending = true
+		reselectIngressAccount(turn, "previous_response_not_found")
 		skipBeforeTurn = true
 		return true
 	}
 	retryIngressTurn := func(relayErr error, turn int, connID string) bool {
-		if !isOpenAIWSIngressTurnRetryable(relayErr) || turnRetry >= 1 {
+		midTurnReplay := ""
+		if !isOpenAIWSIngressTurnRetryable(relayErr) {
+			if !relay.progress.canReconnect(relayErr, midTurnReconnectMode) {
+				return false
+			}
+			midTurnReplay = midTurnReconnectMode
+		}
+		if turnRetry >= 1 {
 			return false
 		}
 		if isStrictAffinityTurn(currentPayload) {
@@ -3091,25 +3867,74 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 			return false
 		}
 		turnRetry++
+		noteTurnMitigation(openAIWSRecoveryTurnRetry)
+		retryReason := openAIWSIngressTurnRetryReason(relayErr)
+		if midTurnReplay != "" {
+			relay.progress.armReplay(midTurnReplay, retryReason)
+		}
 		logOpenAIWSModeInfo(
-			"ingress_ws_turn_retry account_id=%d turn=%d retry=%d reason=%s conn_id=%s",
+			"ingress_ws_turn_retry account_id=%d turn=%d retry=%d reason=%s conn_id=%s mid_turn=%s forwarded_events=%d",
 			account.ID,
 			turn,
 			turnRetry,
-			truncateOpenAIWSLogValue(openAIWSIngressTurnRetryReason(relayErr), openAIWSLogValueMaxLen),
+			truncateOpenAIWSLogValue(retryReason, openAIWSLogValueMaxLen),
 			truncateOpenAIWSLogValue(connID, openAIWSIDValueMaxLen),
+			normalizeOpenAIWSLogValue(midTurnReplay),
+			relay.progress.forwarded,
 		)
+		noteStickyConnMiss(openAIWSStickyMissTurnRetry)
 		resetSessionLease(true)
 		skipBeforeTurn = true
 		return true
 	}
+	clientPingEnabled := s.openAIWSIngressClientPingEnabled()
+	staleCallOutputPolicy := s.openAIWSIngressStaleCallOutputPolicy()
+	fullInputPolicy := s.openAIWSIngressStoreDisabledFullInputPolicy()
+	// turnFullInputMode/turnFullInputReason 记录本轮对完整 input + previous_response_id 的解释，随结果上报后清空。
+	turnFullInputMode, turnFullInputReason := "", ""
+	// handleClientPing 对当前会话绑定的上游连接执行预检 ping，返回上游是否可用。
+	// 仅探测已绑定的连接：未绑定连接时直接报告不可用，不在 turn 之外获取租约占用账号并发槽位；
+	// ping 失败则释放连接并标记下一轮重连，由下一个 turn 按常规流程重新获取。
+	// 客户端 ping 只在 turn 之间处理：turn 进行中后台读取 goroutine 会阻塞在投递上，
+	// 期间到达的 ping 在当前 turn 结束后按到达顺序应答。
+	handleClientPing := func(turn int) bool {
+		if sessionLease == nil {
+			logOpenAIWSModeInfo(
+				"ingress_ws_client_ping_no_lease account_id=%d turn=%d",
+				account.ID,
+				turn,
+			)
+			return false
+		}
+		pingErr := sessionLease.PingWithTimeout(openAIWSConnHealthCheckTO)
+		if pingErr == nil {
+			return true
+		}
+		logOpenAIWSModeInfo(
+			"ingress_ws_client_ping_upstream_fail account_id=%d turn=%d conn_id=%s cause=%s",
+			account.ID,
+			turn,
+			truncateOpenAIWSLogValue(sessionConnID, openAIWSIDValueMaxLen),
+			truncateOpenAIWSLogValue(pingErr.Error(), openAIWSLogValueMaxLen),
+		)
+		noteStickyConnMiss(openAIWSStickyMissClientPingFailed)
+		resetSessionLease(true)
+		recoveryReconnectPending = true
+		return false
+	}
 	for {
+		sessionTurns = turn
 		if !skipBeforeTurn && hooks != nil && hooks.BeforeTurn != nil {
 			if err := hooks.BeforeTurn(turn); err != nil {
 				return err
 			}
 		}
 		skipBeforeTurn = false
+		if pendingModelChangeFrom != "" {
+			previousModel := pendingModelChangeFrom
+			pendingModelChangeFrom = ""
+			handleIngressModelChange(turn, previousModel)
+		}
 		currentPreviousResponseID := openAIWSPayloadStringFromRaw(currentPayload, "previous_response_id")
 		expectedPrev := strings.TrimSpace(lastTurnResponseID)
 		hasFunctionCallOutput := gjson.GetBytes(currentPayload, `input.#(type=="function_call_output")`).Exists()
@@ -3150,7 +3975,25 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 			lastTurnReplayInputExists,
 			currentPayload,
 			currentPreviousResponseID != "",
+			maxReplayInputBytes,
+			replayInputRules,
 		)
+		if errors.Is(replayInputErr, errOpenAIWSReplayInputTooLarge) {
+			logOpenAIWSModeInfo(
+				"ingress_ws_replay_input_too_large account_id=%d turn=%d conn_id=%s max_replay_input_bytes=%d payload_bytes=%d",
+				account.ID,
+				turn,
+				truncateOpenAIWSLogValue(sessionConnID, openAIWSIDValueMaxLen),
+				maxReplayInputBytes,
+				currentPayloadBytes,
+			)
+			return NewOpenAIWSClientCloseErrorWithCode(
+				coderws.StatusMessageTooBig,
+				"conversation input is too large to keep for replay; please start a new conversation",
+				"replay_input_too_large",
+				replayInputErr,
+			)
+		}
 		if replayInputErr != nil {
 			logOpenAIWSModeInfo(
 				"ingress_ws_replay_input_skip account_id=%d turn=%d conn_id=%s reason=build_error cause=%s",
@@ -3165,7 +4008,55 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 			currentTurnReplayInput = nextReplayInput
 			currentTurnReplayInputExists = nextReplayInputExists
 		}
+		fullInputAuto, fullInputDecided := false, false
 		if storeDisabled && turn > 1 && currentPreviousResponseID != "" {
+			decision, applies, resolveErr := resolveOpenAIWSStoreDisabledFullInput(
+				fullInputPolicy,
+				currentPayload,
+				lastTurnReplayInput,
+				currentPreviousResponseID,
+				expectedPrev,
+			)
+			switch {
+			case !applies:
+			case resolveErr != nil:
+				logOpenAIWSModeInfo(
+					"ingress_ws_store_disabled_full_input_skip account_id=%d turn=%d conn_id=%s policy=%s cause=%s previous_response_id=%s",
+					account.ID,
+					turn,
+					truncateOpenAIWSLogValue(sessionConnID, openAIWSIDValueMaxLen),
+					normalizeOpenAIWSLogValue(fullInputPolicy),
+					truncateOpenAIWSLogValue(resolveErr.Error(), openAIWSLogValueMaxLen),
+					truncateOpenAIWSLogValue(currentPreviousResponseID, openAIWSIDValueMaxLen),
+				)
+				fullInputAuto = true
+				turnFullInputReason = openAIWSStoreDisabledFullInputReasonRewriteFailed
+			case decision.Mode == "":
+				fullInputAuto = true
+				turnFullInputReason = decision.Reason
+			default:
+				logOpenAIWSModeInfo(
+					"ingress_ws_store_disabled_full_input account_id=%d turn=%d conn_id=%s policy=%s mode=%s reason=%s previous_response_id=%s expected_previous_response_id=%s",
+					account.ID,
+					turn,
+					truncateOpenAIWSLogValue(sessionConnID, openAIWSIDValueMaxLen),
+					normalizeOpenAIWSLogValue(fullInputPolicy),
+					normalizeOpenAIWSLogValue(decision.Mode),
+					normalizeOpenAIWSLogValue(decision.Reason),
+					truncateOpenAIWSLogValue(currentPreviousResponseID, openAIWSIDValueMaxLen),
+					truncateOpenAIWSLogValue(expectedPrev, openAIWSIDValueMaxLen),
+				)
+				currentPayload = decision.Payload
+				currentPayloadBytes = len(decision.Payload)
+				turnFullInputMode = decision.Mode
+				turnFullInputReason = decision.Reason
+				fullInputDecided = true
+				if decision.Mode == openAIWSStoreDisabledFullInputPolicyFullCreate {
+					currentPreviousResponseID = ""
+				}
+			}
+		}
+		if storeDisabled && turn > 1 && currentPreviousResponseID != "" && !fullInputDecided {
 			shouldKeepPreviousResponseID := false
 			strictReason := ""
 			var strictErr error
@@ -3250,9 +4141,115 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 				}
 			}
 		}
+		if fullInputAuto {
+			// auto 策略（或改写失败）时以严格续链判定的结果作为本轮的解释。
+			turnFullInputMode = openAIWSStoreDisabledFullInputPolicyIncremental
+			if currentPreviousResponseID == "" {
+				turnFullInputMode = openAIWSStoreDisabledFullInputPolicyFullCreate
+			}
+		}
+		if sessionResponseMaxAge > 0 &&
+			currentPreviousResponseID != "" &&
+			!responseChainStartedAt.IsZero() &&
+			time.Since(responseChainStartedAt) > sessionResponseMaxAge &&
+			currentTurnReplayInputExists &&
+			allowFullCreateReplay(turn, sessionConnID, "session_response_max_age") {
+			// 续链超过最长存活时间：上游可能已回收链上 response，主动改为携带完整输入的全量 create。
+			updatedPayload, removed, dropErr := dropPreviousResponseIDFromRawPayload(currentPayload)
+			if dropErr == nil && removed {
+				updatedPayload, dropErr = setOpenAIWSPayloadInputSequence(updatedPayload, currentTurnReplayInput, currentTurnReplayInputExists)
+			}
+			if dropErr != nil || !removed {
+				logOpenAIWSModeInfo(
+					"ingress_ws_session_response_max_age_skip account_id=%d turn=%d conn_id=%s previous_response_id=%s",
+					account.ID,
+					turn,
+					truncateOpenAIWSLogValue(sessionConnID, openAIWSIDValueMaxLen),
+					truncateOpenAIWSLogValue(currentPreviousResponseID, openAIWSIDValueMaxLen),
+				)
+			} else {
+				logOpenAIWSModeInfo(
+					"ingress_ws_session_response_max_age account_id=%d turn=%d conn_id=%s action=drop_previous_response_id_full_create chain_age_ms=%d previous_response_id=%s",
+					account.ID,
+					turn,
+					truncateOpenAIWSLogValue(sessionConnID, openAIWSIDValueMaxLen),
+					time.Since(responseChainStartedAt).Milliseconds(),
+					truncateOpenAIWSLogValue(currentPreviousResponseID, openAIWSIDValueMaxLen),
+				)
+				currentPayload = updatedPayload
+				currentPayloadBytes = len(updatedPayload)
+				currentPreviousResponseID = ""
+				markFullCreateReplay()
+			}
+		}
+		if staleCallOutputPolicy != openAIWSStaleCallOutputPolicyOff &&
+			lastTurnCallIDs != nil &&
+			currentPreviousResponseID != "" &&
+			currentPreviousResponseID == expectedPrev {
+			if staleCallIDs := findOpenAIWSStaleFunctionCallOutputs(currentPayload, lastTurnCallIDs); len(staleCallIDs) > 0 {
+				action := openAIWSStaleCallOutputPolicyDrop
+				if staleCallOutputPolicy == openAIWSStaleCallOutputPolicyFullCreate && allowFullCreateReplay(turn, sessionConnID, "stale_function_call_output") {
+					action = openAIWSStaleCallOutputPolicyFullCreate
+				}
+				var updatedPayload []byte
+				var guardErr error
+				if action == openAIWSStaleCallOutputPolicyFullCreate {
+					var removed bool
+					updatedPayload, removed, guardErr = dropPreviousResponseIDFromRawPayload(currentPayload)
+					if guardErr == nil && removed {
+						updatedPayload, guardErr = setOpenAIWSPayloadInputSequence(updatedPayload, currentTurnReplayInput, currentTurnReplayInputExists)
+					} else if guardErr == nil {
+						guardErr = errors.New("previous_response_id not removed")
+					}
+				} else {
+					updatedPayload, _, guardErr = dropOpenAIWSFunctionCallOutputsByCallID(currentPayload, staleCallIDs)
+				}
+				if guardErr != nil {
+					logOpenAIWSModeInfo(
+						"ingress_ws_stale_function_call_output_skip account_id=%d turn=%d conn_id=%s action=%s stale_call_ids=%d cause=%s",
+						account.ID,
+						turn,
+						truncateOpenAIWSLogValue(sessionConnID, openAIWSIDValueMaxLen),
+						action,
+						len(staleCallIDs),
+						truncateOpenAIWSLogValue(guardErr.Error(), openAIWSLogValueMaxLen),
+					)
+				} else {
+					currentPayload = updatedPayload
+					currentPayloadBytes = len(updatedPayload)
+					if action == openAIWSStaleCallOutputPolicyFullCreate {
+						currentPreviousResponseID = ""
+						markFullCreateReplay()
+					} else if rebuilt, rebuiltExists, rebuildErr := buildOpenAIWSReplayInputSequence(
+						lastTurnReplayInput,
+						lastTurnReplayInputExists,
+						currentPayload,
+						true,
+						maxReplayInputBytes,
+						replayInputRules,
+					); rebuildErr == nil {
+						currentTurnReplayInput = rebuilt
+						currentTurnReplayInputExists = rebuiltExists
+					}
+					logOpenAIWSModeInfo(
+						"ingress_ws_stale_function_call_output account_id=%d turn=%d conn_id=%s action=%s stale_call_ids=%d first_stale_call_id=%s previous_response_id=%s",
+						account.ID,
+						turn,
+						truncateOpenAIWSLogValue(sessionConnID, openAIWSIDValueMaxLen),
+						action,
+						len(staleCallIDs),
+						truncateOpenAIWSLogValue(staleCallIDs[0], openAIWSIDValueMaxLen),
+						truncateOpenAIWSLogValue(expectedPrev, openAIWSIDValueMaxLen),
+					)
+				}
+			}
+		}
 		forcePreferredConn := isStrictAffinityTurn(currentPayload)
 		if sessionLease == nil {
 			acquiredLease, acquireErr := acquireTurnLease(turn, preferredConnID, forcePreferredConn)
+			if errors.Is(acquireErr, errOpenAIWSIngressClientGone) {
+				return nil
+			}
 			if acquireErr != nil {
 				return fmt.Errorf("acquire upstream websocket: %w", acquireErr)
 			}
@@ -3265,8 +4262,12 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 			}
 		}
 		shouldPreflightPing := turn > 1 && sessionLease != nil && turnRetry == 0
-		if shouldPreflightPing && openAIWSIngressPreflightPingIdle > 0 && !lastTurnFinishedAt.IsZero() {
-			if time.Since(lastTurnFinishedAt) < openAIWSIngressPreflightPingIdle {
+		if shouldPreflightPing && sessionConnID != preflightPingIdleConnID {
+			preflightPingIdleConnID = sessionConnID
+			preflightPingIdle = jitterOpenAIWSIngressPreflightPingIdle(openAIWSIngressPreflightPingIdle, openAIWSIngressPreflightPingJitterRatio, rand.Float64())
+		}
+		if shouldPreflightPing && preflightPingIdle > 0 && !lastTurnFinishedAt.IsZero() {
+			if time.Since(lastTurnFinishedAt) < preflightPingIdle {
 				shouldPreflightPing = false
 			}
 		}
@@ -3279,8 +4280,9 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 					truncateOpenAIWSLogValue(sessionConnID, openAIWSIDValueMaxLen),
 					truncateOpenAIWSLogValue(pingErr.Error(), openAIWSLogValueMaxLen),
 				)
+				noteStickyConnMiss(openAIWSStickyMissPreflightPingFailed)
 				if forcePreferredConn {
-					if !turnPrevRecoveryTried && currentPreviousResponseID != "" {
+					if !turnPrevRecoveryTried && currentPreviousResponseID != "" && allowFullCreateReplay(turn, sessionConnID, "preflight_ping_fail") {
 						updatedPayload, removed, dropErr := dropPreviousResponseIDFromRawPayload(currentPayload)
 						if dropErr != nil || !removed {
 							reason := "not_removed"
@@ -3321,7 +4323,10 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 								turnPrevRecoveryTried = true
 								currentPayload = updatedWithInput
 								currentPayloadBytes = len(updatedWithInput)
+								noteTurnMitigation(openAIWSRecoveryPreflightPrevIDDrop)
+								markFullCreateReplay()
 								resetSessionLease(true)
+								recoveryReconnectPending = true
 								skipBeforeTurn = true
 								continue
 							}
@@ -3335,9 +4340,15 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 					)
 				}
 				resetSessionLease(true)
+				noteTurnMitigation(openAIWSRecoveryPreflightReconnect)
+				recoveryReconnectPending = true
 
 				acquiredLease, acquireErr := acquireTurnLease(turn, preferredConnID, forcePreferredConn)
+				if errors.Is(acquireErr, errOpenAIWSIngressClientGone) {
+					return nil
+				}
 				if acquireErr != nil {
+					s.recordOpenAIWSTurnRecovery(turnMitigations, false)
 					return fmt.Errorf("acquire upstream websocket after preflight ping fail: %w", acquireErr)
 				}
 				sessionLease = acquiredLease
@@ -3370,7 +4381,7 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 			)
 		}
 
-		result, relayErr := sendAndRelay(turn, sessionLease, currentPayload, currentPayloadBytes, currentOriginalModel)
+		result, relayErr := relay.sendAndRelay(turn, sessionLease, currentPayload, currentPayloadBytes, currentOriginalModel)
 		if relayErr != nil {
 			if recoverIngressPrevResponseNotFound(relayErr, turn, connID) {
 				continue
@@ -3382,26 +4393,45 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 			if unwrapped := errors.Unwrap(relayErr); unwrapped != nil {
 				finalErr = unwrapped
 			}
+			applyOpenAIWSTurnRecovery(result, turnMitigations, false)
+			s.recordOpenAIWSTurnRecovery(turnMitigations, false)
+			s.recordOpenAIWSStickyConnReuse(result, stickyConnTarget, connID, stickyConnMissReason)
+			applyOpenAIWSStoreDisabledFullInput(result, turnFullInputMode, turnFullInputReason)
+			// result 非 nil 时为 best-effort 的部分 usage（PartialUsage=true），由上层决定是否计费。
 			if hooks != nil && hooks.AfterTurn != nil {
-				hooks.AfterTurn(turn, nil, finalErr)
+				hooks.AfterTurn(turn, result, finalErr)
 			}
 			sessionLease.MarkBroken()
 			return finalErr
 		}
 		turnRetry = 0
 		turnPrevRecoveryTried = false
+		applyOpenAIWSTurnRecovery(result, turnMitigations, true)
+		s.recordOpenAIWSTurnRecovery(turnMitigations, true)
+		turnMitigations = nil
+		s.recordOpenAIWSStickyConnReuse(result, stickyConnTarget, connID, stickyConnMissReason)
+		applyOpenAIWSStoreDisabledFullInput(result, turnFullInputMode, turnFullInputReason)
+		turnFullInputMode, turnFullInputReason = "", ""
+		stickyConnTarget = connID
+		stickyConnMissReason = ""
 		lastTurnFinishedAt = time.Now()
+		if currentPreviousResponseID == "" || responseChainStartedAt.IsZero() {
+			// 全量 create 开启新链；首个 turn 即为续链时无法得知链的真实起点，从本 turn 起算。
+			responseChainStartedAt = lastTurnFinishedAt
+		}
 		if hooks != nil && hooks.AfterTurn != nil {
 			hooks.AfterTurn(turn, result, nil)
 		}
 		if result == nil {
 			return errors.New("websocket turn result is nil")
 		}
+		s.maybeShadowOpenAIWSTurn(c, account, turn, currentPayload, currentOriginalModel, result.Duration)
 		responseID := strings.TrimSpace(result.RequestID)
 		lastTurnResponseID = responseID
 		lastTurnPayload = cloneOpenAIWSPayloadBytes(currentPayload)
 		lastTurnReplayInput = cloneOpenAIWSRawMessages(currentTurnReplayInput)
 		lastTurnReplayInputExists = currentTurnReplayInputExists
+		lastTurnCallIDs = relay.callIDs
 		nextStrictState, strictStateErr := buildOpenAIWSIngressPreviousTurnStrictState(currentPayload)
 		if strictStateErr != nil {
 			lastTurnStrictState = nil
@@ -3420,28 +4450,66 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 			ttl := s.openAIWSResponseStickyTTL()
 			logOpenAIWSBindResponseAccountWarn(groupID, account.ID, responseID, stateStore.BindResponseAccount(ctx, groupID, responseID, account.ID, ttl))
 			stateStore.BindResponseConn(responseID, connID, ttl)
+			stateStore.BindSessionResponseAnchor(groupID, sessionHash, responseID, account.ID, ttl)
 		}
 		if stateStore != nil && storeDisabled && sessionHash != "" {
 			stateStore.BindSessionConn(groupID, sessionHash, connID, s.openAIWSSessionStickyTTL())
 		}
+		handoffSession.completeTurn(account.ID, responseID, turn)
 		if connID != "" {
 			preferredConnID = connID
 		}
+		if sessionLease.Retired() {
+			// 连接已被回收（如账号凭证轮换）：当前 turn 完成后释放并关闭，下一 turn 重新建连。
+			logOpenAIWSModeInfo(
+				"ingress_ws_session_conn_retired account_id=%d turn=%d conn_id=%s",
+				account.ID,
+				turn,
+				truncateOpenAIWSLogValue(connID, openAIWSIDValueMaxLen),
+			)
+			noteStickyConnMiss(openAIWSStickyMissConnRetired)
+			resetSessionLease(false)
+			if nextToken, ok := s.reloadOpenAIWSAccountToken(ctx, account.ID); ok && nextToken != token {
+				token = nextToken
+				baseAcquireReq.Headers = cloneHeader(baseAcquireReq.Headers)
+				baseAcquireReq.Headers.Set("authorization", "Bearer "+token)
+			}
+		}
+		if sessionLease != nil && s.openAIWSForceDedicatedAll() {
+			// force_dedicated_all：与 HTTP 模式一致，每个 turn 结束即关闭上游连接，下一 turn 重新拨号。
+			resetSessionLease(true)
+			stickyConnTarget = ""
+		}
 
-		nextClientMessage, readErr := readClientMessage()
-		if readErr != nil {
-			if isOpenAIWSClientDisconnectError(readErr) {
-				closeStatus, closeReason := summarizeOpenAIWSReadCloseError(readErr)
-				logOpenAIWSModeInfo(
-					"ingress_ws_client_closed account_id=%d conn_id=%s close_status=%s close_reason=%s",
-					account.ID,
-					truncateOpenAIWSLogValue(connID, openAIWSIDValueMaxLen),
-					closeStatus,
-					truncateOpenAIWSLogValue(closeReason, openAIWSHeaderValueMaxLen),
-				)
-				return nil
+		var nextClientMessage []byte
+		for {
+			message, readErr := readClientMessage()
+			if readErr != nil {
+				if isOpenAIWSClientDisconnectError(readErr) {
+					closeStatus, closeReason := summarizeOpenAIWSReadCloseError(readErr)
+					logOpenAIWSModeInfo(
+						"ingress_ws_client_closed account_id=%d conn_id=%s close_status=%s close_reason=%s",
+						account.ID,
+						truncateOpenAIWSLogValue(connID, openAIWSIDValueMaxLen),
+						closeStatus,
+						truncateOpenAIWSLogValue(closeReason, openAIWSHeaderValueMaxLen),
+					)
+					return nil
+				}
+				return fmt.Errorf("read client websocket request: %w", readErr)
+			}
+			if !clientPingEnabled || !isOpenAIWSIngressClientPingMessage(message) {
+				nextClientMessage = message
+				break
+			}
+			// 客户端 ping 不计入 turn：不触发 BeforeTurn/AfterTurn hooks，也不递增 turn 计数。
+			upstreamHealthy := handleClientPing(turn)
+			if err := writeClientMessage(buildOpenAIWSIngressPongMessage(upstreamHealthy)); err != nil {
+				if isOpenAIWSClientDisconnectError(err) {
+					return nil
+				}
+				return fmt.Errorf("write client websocket pong: %w", err)
 			}
-			return fmt.Errorf("read client websocket request: %w", readErr)
 		}
 
 		nextPayload, parseErr := parseClientPayload(nextClientMessage)
@@ -3488,6 +4556,9 @@ func (s *OpenAIGatewayService) ProxyResponsesWebSocketFromClient(
 				}
 			}
 		}
+		if nextPayload.originalModel != currentOriginalModel {
+			pendingModelChangeFrom = currentOriginalModel
+		}
 		currentPayload = nextPayload.payloadRaw
 		currentOriginalModel = nextPayload.originalModel
 		currentPayloadBytes = nextPayload.payloadBytes
@@ -3579,7 +4650,7 @@ func (s *OpenAIGatewayService) performOpenAIWSGeneratePrewarm(
 	prewarmEventCount := 0
 	prewarmTerminalCount := 0
 	for {
-		message, readErr := lease.ReadMessageWithContextTimeout(ctx, s.openAIWSReadTimeout())
+		message, readErr := lease.ReadMessageWithContextTimeout(ctx, s.openAIWSReadTimeoutForRequest(ctx))
 		if readErr != nil {
 			lease.MarkBroken()
 			closeStatus, closeReason := summarizeOpenAIWSReadCloseError(readErr)
@@ -3595,6 +4666,13 @@ func (s *OpenAIGatewayService) performOpenAIWSGeneratePrewarm(
 			return wrapOpenAIWSFallback("prewarm_"+classifyOpenAIWSReadFallbackReason(readErr), readErr)
 		}
 
+		if !gjson.ValidBytes(message) {
+			if s.handleOpenAIWSMalformedUpstreamEvent(account.ID, connID, "prewarm", message) {
+				lease.MarkBroken()
+				return wrapOpenAIWSFallback("prewarm_malformed_upstream_event", errOpenAIWSMalformedUpstreamEvent)
+			}
+			continue
+		}
 		eventType, eventResponseID, _ := parseOpenAIWSEventEnvelope(message)
 		if eventType == "" {
 			continue
@@ -3770,6 +4848,21 @@ func getOpenAIGroupIDFromContext(c *gin.Context) int64 {
 	return *apiKey.GroupID
 }
 
+func getOpenAIGroupFromContext(c *gin.Context) *Group {
+	if c == nil {
+		return nil
+	}
+	value, exists := c.Get("api_key")
+	if !exists {
+		return nil
+	}
+	apiKey, ok := value.(*APIKey)
+	if !ok || apiKey == nil {
+		return nil
+	}
+	return apiKey.Group
+}
+
 // SelectAccountByPreviousResponseID 按 previous_response_id 命中账号粘连。
 // 未命中或账号不可用时返回 (nil, nil)，由调用方继续走常规调度。
 func (s *OpenAIGatewayService) SelectAccountByPreviousResponseID(
@@ -3778,6 +4871,19 @@ func (s *OpenAIGatewayService) SelectAccountByPreviousResponseID(
 	previousResponseID string,
 	requestedModel string,
 	excludedIDs map[int64]struct{},
+) (*AccountSelectionResult, error) {
+	return s.selectAccountByPreviousResponseID(ctx, groupID, previousResponseID, "", requestedModel, excludedIDs)
+}
+
+// selectAccountByPreviousResponseID 在 response_id 全局粘连未命中时，
+// 回退到会话内的 response_id 锚点集合，保证分支续链仍路由到产生该 response 的账号。
+func (s *OpenAIGatewayService) selectAccountByPreviousResponseID(
+	ctx context.Context,
+	groupID *int64,
+	previousResponseID string,
+	sessionHash string,
+	requestedModel string,
+	excludedIDs map[int64]struct{},
 ) (*AccountSelectionResult, error) {
 	if s == nil {
 		return nil, nil
@@ -3792,9 +4898,26 @@ func (s *OpenAIGatewayService) SelectAccountByPreviousResponseID(
 	}
 
 	accountID, err := store.GetResponseAccount(ctx, derefGroupID(groupID), responseID)
-	if err != nil || accountID <= 0 {
+	if err != nil {
+		if IsOpenAIWSStateStoreUnavailableError(err) {
+			return nil, err
+		}
+		accountID = 0
+	}
+	if accountID <= 0 && sessionHash != "" {
+		if anchorAccountID, ok := store.GetSessionResponseAnchor(derefGroupID(groupID), sessionHash, responseID); ok {
+			accountID = anchorAccountID
+		}
+	}
+	if accountID <= 0 {
 		return nil, nil
 	}
+	dropBinding := func() {
+		_ = store.DeleteResponseAccount(ctx, derefGroupID(groupID), responseID)
+		if sessionHash != "" {
+			store.DeleteSessionResponseAnchor(derefGroupID(groupID), sessionHash, responseID)
+		}
+	}
 	if excludedIDs != nil {
 		if _, excluded := excludedIDs[accountID]; excluded {
 			return nil, nil
@@ -3803,7 +4926,7 @@ func (s *OpenAIGatewayService) SelectAccountByPreviousResponseID(
 
 	account, err := s.getSchedulableAccount(ctx, accountID)
 	if err != nil || account == nil {
-		_ = store.DeleteResponseAccount(ctx, derefGroupID(groupID), responseID)
+		dropBinding()
 		return nil, nil
 	}
 	// 非 WSv2 场景（如 force_http/全局关闭）不应使用 previous_response_id 粘连，
@@ -3812,7 +4935,7 @@ func (s *OpenAIGatewayService) SelectAccountByPreviousResponseID(
 		return nil, nil
 	}
 	if shouldClearStickySession(account, requestedModel) || !account.IsOpenAI() || !account.IsSchedulable() {
-		_ = store.DeleteResponseAccount(ctx, derefGroupID(groupID), responseID)
+		dropBinding()
 		return nil, nil
 	}
 	if requestedModel != "" && !account.IsModelSupported(requestedModel) {
@@ -3849,6 +4972,27 @@ func (s *OpenAIGatewayService) SelectAccountByPreviousResponseID(
 	return nil, nil
 }
 
+// jitterOpenAIWSIngressPreflightPingIdle 按 sample∈[0,1) 在 idle 上下 ratio 比例内抖动预检 ping 空闲阈值。
+// idle<=0（关闭预检空闲判断）或 ratio<=0 时原样返回；ratio 上限为 1，结果不小于 0。
+func jitterOpenAIWSIngressPreflightPingIdle(idle time.Duration, ratio float64, sample float64) time.Duration {
+	if idle <= 0 || ratio <= 0 {
+		return idle
+	}
+	if ratio > 1 {
+		ratio = 1
+	}
+	if sample < 0 {
+		sample = 0
+	} else if sample >= 1 {
+		sample = math.Nextafter(1, 0)
+	}
+	jittered := idle + time.Duration((2*sample-1)*ratio*float64(idle))
+	if jittered < 0 {
+		return 0
+	}
+	return jittered
+}
+
 func classifyOpenAIWSAcquireError(err error) string {
 	if err == nil {
 		return "acquire_conn"
@@ -3910,6 +5054,35 @@ func (s *OpenAIGatewayService) persistOpenAIWSRateLimitSignal(ctx context.Contex
 	s.rateLimitService.HandleUpstreamError(ctx, account, http.StatusTooManyRequests, headers, responseBody)
 }
 
+// reportOpenAIWSDialFailure 按握手失败的上游 HTTP 状态码把失败反馈到对应的账号健康机制：
+//   - 401/403：凭证问题，交由限流服务处理（可能临时或永久标记不可调度）；
+//   - 429：限额冷却；
+//   - 5xx：瞬时故障，不改账号状态，仅在 reportTransient 时计入调度错误率/熔断。
+//
+// 无状态码的网络错误及其他状态码不做账号级处理。
+func (s *OpenAIGatewayService) reportOpenAIWSDialFailure(ctx context.Context, account *Account, err error, reportTransient bool) {
+	if s == nil || account == nil || err == nil {
+		return
+	}
+	var dialErr *openAIWSDialError
+	if !errors.As(err, &dialErr) || dialErr == nil || dialErr.StatusCode <= 0 {
+		return
+	}
+	switch classifyOpenAIWSAcquireError(err) {
+	case "auth_failed":
+		if s.rateLimitService != nil && account.Platform == PlatformOpenAI {
+			s.rateLimitService.HandleUpstreamError(ctx, account, dialErr.StatusCode, dialErr.ResponseHeaders, nil)
+		}
+	case "upstream_rate_limited":
+		s.persistOpenAIWSRateLimitSignal(ctx, account, dialErr.ResponseHeaders, nil, "rate_limit_exceeded", "rate_limit_error", strings.TrimSpace(err.Error()))
+	case "upstream_5xx":
+		if reportTransient {
+			s.ReportOpenAIAccountScheduleResult(account.ID, false, nil)
+			s.RecordOpenAIAccountError(account.ID, err)
+		}
+	}
+}
+
 func classifyOpenAIWSErrorEventFromRaw(codeRaw, errTypeRaw, msgRaw string) (string, bool) {
 	code := strings.ToLower(strings.TrimSpace(codeRaw))
 	errType := strings.ToLower(strings.TrimSpace(errTypeRaw))
@@ -0,0 +1,370 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	coderws "github.com/coder/websocket"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestIsOpenAIWSIngressClientPingMessage(t *testing.T) {
+	require.True(t, isOpenAIWSIngressClientPingMessage([]byte(`{"type":"ping"}`)))
+	require.True(t, isOpenAIWSIngressClientPingMessage([]byte(` {"type": "ping"} `)))
+	require.False(t, isOpenAIWSIngressClientPingMessage([]byte(`{"type":"response.create","model":"gpt-5.1"}`)))
+	require.False(t, isOpenAIWSIngressClientPingMessage([]byte(`{"type":"ping"`)))
+	require.False(t, isOpenAIWSIngressClientPingMessage(nil))
+	require.Equal(t, "pong", gjson.GetBytes(buildOpenAIWSIngressPongMessage(true), "type").String())
+	require.True(t, gjson.GetBytes(buildOpenAIWSIngressPongMessage(true), "upstream_healthy").Bool())
+	require.False(t, gjson.GetBytes(buildOpenAIWSIngressPongMessage(false), "upstream_healthy").Bool())
+}
+
+func TestJitterOpenAIWSIngressPreflightPingIdle(t *testing.T) {
+	idle := 20 * time.Second
+	require.Equal(t, 16*time.Second, jitterOpenAIWSIngressPreflightPingIdle(idle, 0.2, 0))
+	require.Equal(t, idle, jitterOpenAIWSIngressPreflightPingIdle(idle, 0.2, 0.5))
+
+	// 抖动在 [idle*(1-ratio), idle*(1+ratio)) 内，且不同连接取到的阈值不同。
+	lower := 16 * time.Second
+	upper := 24 * time.Second
+	seen := make(map[time.Duration]struct{})
+	for i := 0; i <= 100; i++ {
+		got := jitterOpenAIWSIngressPreflightPingIdle(idle, 0.2, float64(i)/100)
+		require.GreaterOrEqual(t, got, lower)
+		require.Less(t, got, upper)
+		seen[got] = struct{}{}
+	}
+	require.Greater(t, len(seen), 1)
+
+	// 关闭空闲判断或关闭抖动时原样返回；超界比例被收敛。
+	require.Equal(t, time.Duration(0), jitterOpenAIWSIngressPreflightPingIdle(0, 0.2, 0.9))
+	require.Equal(t, idle, jitterOpenAIWSIngressPreflightPingIdle(idle, 0, 0.9))
+	require.Equal(t, time.Duration(0), jitterOpenAIWSIngressPreflightPingIdle(idle, 5, 0))
+	require.Less(t, jitterOpenAIWSIngressPreflightPingIdle(idle, 5, 1), 2*idle)
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_ClientPingFailureReconnectsOnNextTurn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{}
+	cfg.Security.URLAllowlist.Enabled = false
+	cfg.Security.URLAllowlist.AllowInsecureHTTP = true
+	cfg.Gateway.OpenAIWS.Enabled = true
+	cfg.Gateway.OpenAIWS.OAuthEnabled = true
+	cfg.Gateway.OpenAIWS.APIKeyEnabled = true
+	cfg.Gateway.OpenAIWS.ResponsesWebsocketsV2 = true
+	cfg.Gateway.OpenAIWS.IngressClientPingEnabled = true
+	cfg.Gateway.OpenAIWS.MaxConnsPerAccount = 1
+	cfg.Gateway.OpenAIWS.MinIdlePerAccount = 0
+	cfg.Gateway.OpenAIWS.MaxIdlePerAccount = 1
+	cfg.Gateway.OpenAIWS.QueueLimitPerConn = 8
+	cfg.Gateway.OpenAIWS.DialTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.ReadTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.WriteTimeoutSeconds = 3
+
+	// 首个连接在首轮事件读完后 ping 失败，模拟空闲期间上游连接失活。
+	firstConn := &openAIWSPreflightFailConn{
+		events: [][]byte{
+			[]byte(`{"type":"response.completed","response":{"id":"resp_client_ping_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+		},
+	}
+	secondConn := &openAIWSCaptureConn{
+		events: [][]byte{
+			[]byte(`{"type":"response.completed","response":{"id":"resp_client_ping_2","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+		},
+	}
+	dialer := &openAIWSQueueDialer{
+		conns: []openAIWSClientConn{firstConn, secondConn},
+	}
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(dialer)
+
+	svc := &OpenAIGatewayService{
+		cfg:              cfg,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     pool,
+	}
+
+	account := &Account{
+		ID:          131,
+		Name:        "openai-ingress-client-ping",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{
+			"api_key": "sk-test",
+		},
+		Extra: map[string]any{
+			"responses_websockets_v2_enabled": true,
+		},
+	}
+
+	var turnsMu sync.Mutex
+	beforeTurns := make([]int, 0, 2)
+	afterTurns := make([]int, 0, 2)
+	hooks := &OpenAIWSIngressHooks{
+		BeforeTurn: func(turn int) error {
+			turnsMu.Lock()
+			beforeTurns = append(beforeTurns, turn)
+			turnsMu.Unlock()
+			return nil
+		},
+		AfterTurn: func(turn int, _ *OpenAIForwardResult, _ error) {
+			turnsMu.Lock()
+			afterTurns = append(afterTurns, turn)
+			turnsMu.Unlock()
+		},
+	}
+
+	serverErrCh := make(chan error, 1)
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := coderws.Accept(w, r, &coderws.AcceptOptions{
+			CompressionMode: coderws.CompressionContextTakeover,
+		})
+		if err != nil {
+			serverErrCh <- err
+			return
+		}
+		defer func() {
+			_ = conn.CloseNow()
+		}()
+
+		rec := httptest.NewRecorder()
+		ginCtx, _ := gin.CreateTestContext(rec)
+		req := r.Clone(r.Context())
+		req.Header = req.Header.Clone()
+		req.Header.Set("User-Agent", "unit-test-agent/1.0")
+		ginCtx.Request = req
+
+		readCtx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		msgType, firstMessage, readErr := conn.Read(readCtx)
+		cancel()
+		if readErr != nil {
+			serverErrCh <- readErr
+			return
+		}
+		if msgType != coderws.MessageText && msgType != coderws.MessageBinary {
+			serverErrCh <- errors.New("unsupported websocket client message type")
+			return
+		}
+
+		serverErrCh <- svc.ProxyResponsesWebSocketFromClient(r.Context(), ginCtx, conn, account, "sk-test", firstMessage, hooks)
+	}))
+	defer wsServer.Close()
+
+	dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+	clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http"), nil)
+	cancelDial()
+	require.NoError(t, err)
+	defer func() {
+		_ = clientConn.CloseNow()
+	}()
+
+	writeMessage := func(payload string) {
+		writeCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		require.NoError(t, clientConn.Write(writeCtx, coderws.MessageText, []byte(payload)))
+	}
+	readMessage := func() []byte {
+		readCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		msgType, message, readErr := clientConn.Read(readCtx)
+		require.NoError(t, readErr)
+		require.Equal(t, coderws.MessageText, msgType)
+		return message
+	}
+
+	writeMessage(`{"type":"response.create","model":"gpt-5.1","stream":false}`)
+	firstTurn := readMessage()
+	require.Equal(t, "resp_client_ping_1", gjson.GetBytes(firstTurn, "response.id").String())
+
+	writeMessage(`{"type":"ping"}`)
+	pong := readMessage()
+	require.Equal(t, "pong", gjson.GetBytes(pong, "type").String())
+	require.False(t, gjson.GetBytes(pong, "upstream_healthy").Bool(), "上游 ping 失败应回报不可用")
+	require.Equal(t, 1, dialer.DialCount(), "客户端 ping 不应在 turn 之外重新建连")
+
+	writeMessage(`{"type":"ping"}`)
+	pong = readMessage()
+	require.False(t, gjson.GetBytes(pong, "upstream_healthy").Bool(), "失败连接已释放，未绑定连接时应回报不可用")
+	require.Equal(t, 1, dialer.DialCount())
+
+	writeMessage(`{"type":"response.create","model":"gpt-5.1","stream":false}`)
+	secondTurn := readMessage()
+	require.Equal(t, "resp_client_ping_2", gjson.GetBytes(secondTurn, "response.id").String())
+	require.Equal(t, 2, dialer.DialCount(), "下一个 turn 应重新建连")
+
+	require.NoError(t, clientConn.Close(coderws.StatusNormalClosure, "done"))
+	select {
+	case serverErr := <-serverErrCh:
+		require.NoError(t, serverErr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待 ingress websocket 结束超时")
+	}
+
+	require.Equal(t, 1, firstConn.WriteCount(), "ping 失败的旧连接不应再承载后续 turn")
+	require.Equal(t, 1, firstConn.PingCount(), "连接释放后的 ping 不应再探测旧连接")
+	require.Len(t, secondConn.writes, 1, "第二轮 turn 应发送到重连后的新连接")
+	turnsMu.Lock()
+	defer turnsMu.Unlock()
+	require.Equal(t, []int{1, 2}, beforeTurns, "客户端 ping 不应计入 turn")
+	require.Equal(t, []int{1, 2}, afterTurns)
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_ClientPingWithoutBoundLeaseReportsUnhealthy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{}
+	cfg.Security.URLAllowlist.Enabled = false
+	cfg.Security.URLAllowlist.AllowInsecureHTTP = true
+	cfg.Gateway.OpenAIWS.Enabled = true
+	cfg.Gateway.OpenAIWS.OAuthEnabled = true
+	cfg.Gateway.OpenAIWS.APIKeyEnabled = true
+	cfg.Gateway.OpenAIWS.ResponsesWebsocketsV2 = true
+	cfg.Gateway.OpenAIWS.IngressClientPingEnabled = true
+	// force_dedicated_all 下每个 turn 结束即释放上游连接，turn 之间会话不持有租约。
+	cfg.Gateway.OpenAIWS.ForceDedicatedAll = true
+	cfg.Gateway.OpenAIWS.MaxConnsPerAccount = 1
+	cfg.Gateway.OpenAIWS.MinIdlePerAccount = 0
+	cfg.Gateway.OpenAIWS.MaxIdlePerAccount = 1
+	cfg.Gateway.OpenAIWS.QueueLimitPerConn = 8
+	cfg.Gateway.OpenAIWS.DialTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.ReadTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.WriteTimeoutSeconds = 3
+
+	firstConn := &openAIWSCaptureConn{
+		events: [][]byte{
+			[]byte(`{"type":"response.completed","response":{"id":"resp_client_ping_no_lease_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+		},
+	}
+	secondConn := &openAIWSCaptureConn{
+		events: [][]byte{
+			[]byte(`{"type":"response.completed","response":{"id":"resp_client_ping_no_lease_2","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+		},
+	}
+	dialer := &openAIWSQueueDialer{
+		conns: []openAIWSClientConn{firstConn, secondConn},
+	}
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(dialer)
+
+	svc := &OpenAIGatewayService{
+		cfg:              cfg,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     pool,
+	}
+
+	account := &Account{
+		ID:          132,
+		Name:        "openai-ingress-client-ping-no-lease",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{
+			"api_key": "sk-test",
+		},
+		Extra: map[string]any{
+			"responses_websockets_v2_enabled": true,
+		},
+	}
+
+	serverErrCh := make(chan error, 1)
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := coderws.Accept(w, r, &coderws.AcceptOptions{
+			CompressionMode: coderws.CompressionContextTakeover,
+		})
+		if err != nil {
+			serverErrCh <- err
+			return
+		}
+		defer func() {
+			_ = conn.CloseNow()
+		}()
+
+		rec := httptest.NewRecorder()
+		ginCtx, _ := gin.CreateTestContext(rec)
+		req := r.Clone(r.Context())
+		req.Header = req.Header.Clone()
+		req.Header.Set("User-Agent", "unit-test-agent/1.0")
+		ginCtx.Request = req
+
+		readCtx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		msgType, firstMessage, readErr := conn.Read(readCtx)
+		cancel()
+		if readErr != nil {
+			serverErrCh <- readErr
+			return
+		}
+		if msgType != coderws.MessageText && msgType != coderws.MessageBinary {
+			serverErrCh <- errors.New("unsupported websocket client message type")
+			return
+		}
+
+		serverErrCh <- svc.ProxyResponsesWebSocketFromClient(r.Context(), ginCtx, conn, account, "sk-test", firstMessage, nil)
+	}))
+	defer wsServer.Close()
+
+	dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+	clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http"), nil)
+	cancelDial()
+	require.NoError(t, err)
+	defer func() {
+		_ = clientConn.CloseNow()
+	}()
+
+	writeMessage := func(payload string) {
+		writeCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		require.NoError(t, clientConn.Write(writeCtx, coderws.MessageText, []byte(payload)))
+	}
+	readMessage := func() []byte {
+		readCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		msgType, message, readErr := clientConn.Read(readCtx)
+		require.NoError(t, readErr)
+		require.Equal(t, coderws.MessageText, msgType)
+		return message
+	}
+
+	writeMessage(`{"type":"response.create","model":"gpt-5.1","stream":false}`)
+	firstTurn := readMessage()
+	require.Equal(t, "resp_client_ping_no_lease_1", gjson.GetBytes(firstTurn, "response.id").String())
+
+	writeMessage(`{"type":"ping"}`)
+	pong := readMessage()
+	require.Equal(t, "pong", gjson.GetBytes(pong, "type").String())
+	require.False(t, gjson.GetBytes(pong, "upstream_healthy").Bool(), "未绑定上游连接时应回报不可用")
+	require.Equal(t, 1, dialer.DialCount(), "客户端 ping 不应在 turn 之外获取租约或建连")
+
+	writeMessage(`{"type":"response.create","model":"gpt-5.1","stream":false}`)
+	secondTurn := readMessage()
+	require.Equal(t, "resp_client_ping_no_lease_2", gjson.GetBytes(secondTurn, "response.id").String())
+	require.Equal(t, 2, dialer.DialCount())
+
+	require.NoError(t, clientConn.Close(coderws.StatusNormalClosure, "done"))
+	select {
+	case serverErr := <-serverErrCh:
+		require.NoError(t, serverErr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待 ingress websocket 结束超时")
+	}
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -1865,6 +1866,18 @@ func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_PreviousResponse
 		},
 	}
 
+	var turnResultsMu sync.Mutex
+	turnResults := make(map[int]*OpenAIForwardResult)
+	hooks := &OpenAIWSIngressHooks{
+		AfterTurn: func(turn int, result *OpenAIForwardResult, turnErr error) {
+			turnResultsMu.Lock()
+			defer turnResultsMu.Unlock()
+			if turnErr == nil {
+				turnResults[turn] = result
+			}
+		},
+	}
+
 	serverErrCh := make(chan error, 1)
 	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		conn, err := coderws.Accept(w, r, &coderws.AcceptOptions{
@@ -1897,7 +1910,7 @@ func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_PreviousResponse
 			return
 		}
 
-		serverErrCh <- svc.ProxyResponsesWebSocketFromClient(r.Context(), ginCtx, conn, account, "sk-test", firstMessage, nil)
+		serverErrCh <- svc.ProxyResponsesWebSocketFromClient(r.Context(), ginCtx, conn, account, "sk-test", firstMessage, hooks)
 	}))
 	defer wsServer.Close()
 
@@ -1953,6 +1966,172 @@ func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_PreviousResponse
 	secondConn.mu.Unlock()
 	require.Len(t, secondWrites, 1, "恢复重试应在第二个连接发送一次请求")
 	require.False(t, gjson.Get(requestToJSONString(secondWrites[0]), "previous_response_id").Exists(), "恢复重试应移除 previous_response_id")
+
+	turnResultsMu.Lock()
+	defer turnResultsMu.Unlock()
+	require.NotNil(t, turnResults[1])
+	require.Empty(t, turnResults[1].RecoveryMitigations, "首轮未触发恢复")
+	require.NotNil(t, turnResults[2])
+	require.Equal(t, []string{openAIWSRecoveryPrevIDDrop}, turnResults[2].RecoveryMitigations)
+	require.Equal(t, openAIWSRecoveryPrevIDDrop, turnResults[2].RecoverySucceededBy)
+	require.Equal(t, "[prev_id_drop→success]", turnResults[2].RecoveryTrace())
+
+	recovery := svc.SnapshotOpenAIWSRecoveryMetrics()
+	require.Equal(t, int64(1), recovery.RecoveredTurnsTotal)
+	require.Zero(t, recovery.UnrecoveredTurnsTotal)
+	require.Equal(t, OpenAIWSRecoveryLayerMetrics{AttemptTotal: 1, SuccessTotal: 1}, recovery.Layers[openAIWSRecoveryPrevIDDrop])
+	require.Zero(t, recovery.Layers[openAIWSRecoveryTurnRetry].AttemptTotal)
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_PreviousResponseNotFoundReplayCapSurfacesError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{}
+	cfg.Security.URLAllowlist.Enabled = false
+	cfg.Security.URLAllowlist.AllowInsecureHTTP = true
+	cfg.Gateway.OpenAIWS.Enabled = true
+	cfg.Gateway.OpenAIWS.OAuthEnabled = true
+	cfg.Gateway.OpenAIWS.APIKeyEnabled = true
+	cfg.Gateway.OpenAIWS.ResponsesWebsocketsV2 = true
+	cfg.Gateway.OpenAIWS.IngressPreviousResponseRecoveryEnabled = true
+	cfg.Gateway.OpenAIWS.MaxFullCreateReplaysPerSession = 1
+	cfg.Gateway.OpenAIWS.MaxConnsPerAccount = 1
+	cfg.Gateway.OpenAIWS.MinIdlePerAccount = 0
+	cfg.Gateway.OpenAIWS.MaxIdlePerAccount = 1
+	cfg.Gateway.OpenAIWS.QueueLimitPerConn = 8
+	cfg.Gateway.OpenAIWS.DialTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.ReadTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.WriteTimeoutSeconds = 3
+
+	firstConn := &openAIWSCaptureConn{
+		events: [][]byte{
+			[]byte(`{"type":"response.completed","response":{"id":"resp_turn_prev_recover_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+			[]byte(`{"type":"error","error":{"type":"invalid_request_error","code":"previous_response_not_found","message":""}}`),
+		},
+	}
+	secondConn := &openAIWSCaptureConn{
+		events: [][]byte{
+			[]byte(`{"type":"response.completed","response":{"id":"resp_turn_prev_recover_2","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+			[]byte(`{"type":"error","error":{"type":"invalid_request_error","code":"previous_response_not_found","message":""}}`),
+		},
+	}
+	dialer := &openAIWSQueueDialer{
+		conns: []openAIWSClientConn{firstConn, secondConn},
+	}
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(dialer)
+
+	svc := &OpenAIGatewayService{
+		cfg:              cfg,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     pool,
+	}
+
+	account := &Account{
+		ID:          132,
+		Name:        "openai-ingress-replay-cap",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{
+			"api_key": "sk-test",
+		},
+		Extra: map[string]any{
+			"responses_websockets_v2_enabled": true,
+		},
+	}
+
+	serverErrCh := make(chan error, 1)
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := coderws.Accept(w, r, &coderws.AcceptOptions{
+			CompressionMode: coderws.CompressionContextTakeover,
+		})
+		if err != nil {
+			serverErrCh <- err
+			return
+		}
+		defer func() {
+			_ = conn.CloseNow()
+		}()
+
+		rec := httptest.NewRecorder()
+		ginCtx, _ := gin.CreateTestContext(rec)
+		req := r.Clone(r.Context())
+		req.Header = req.Header.Clone()
+		req.Header.Set("User-Agent", "unit-test-agent/1.0")
+		ginCtx.Request = req
+
+		readCtx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		msgType, firstMessage, readErr := conn.Read(readCtx)
+		cancel()
+		if readErr != nil {
+			serverErrCh <- readErr
+			return
+		}
+		if msgType != coderws.MessageText && msgType != coderws.MessageBinary {
+			serverErrCh <- errors.New("unsupported websocket client message type")
+			return
+		}
+
+		serverErrCh <- svc.ProxyResponsesWebSocketFromClient(r.Context(), ginCtx, conn, account, "sk-test", firstMessage, nil)
+	}))
+	defer wsServer.Close()
+
+	dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+	clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http"), nil)
+	cancelDial()
+	require.NoError(t, err)
+	defer func() {
+		_ = clientConn.CloseNow()
+	}()
+
+	writeMessage := func(payload string) {
+		writeCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		require.NoError(t, clientConn.Write(writeCtx, coderws.MessageText, []byte(payload)))
+	}
+	readMessage := func() []byte {
+		readCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		msgType, message, readErr := clientConn.Read(readCtx)
+		require.NoError(t, readErr)
+		require.Equal(t, coderws.MessageText, msgType)
+		return message
+	}
+
+	writeMessage(`{"type":"response.create","model":"gpt-5.1","stream":false,"previous_response_id":"resp_seed_anchor"}`)
+	firstTurn := readMessage()
+	require.Equal(t, "resp_turn_prev_recover_1", gjson.GetBytes(firstTurn, "response.id").String())
+
+	writeMessage(`{"type":"response.create","model":"gpt-5.1","stream":false,"previous_response_id":"resp_turn_prev_recover_1"}`)
+	secondTurn := readMessage()
+	require.Equal(t, "response.completed", gjson.GetBytes(secondTurn, "type").String())
+	require.Equal(t, "resp_turn_prev_recover_2", gjson.GetBytes(secondTurn, "response.id").String())
+
+	// 第三轮再次命中 previous_response_not_found，已达重放上限，应直接返回上游错误而非再次全量重放。
+	writeMessage(`{"type":"response.create","model":"gpt-5.1","stream":false,"previous_response_id":"resp_turn_prev_recover_2"}`)
+	select {
+	case serverErr := <-serverErrCh:
+		require.Error(t, serverErr)
+		require.Contains(t, serverErr.Error(), "previous response not found")
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待 ingress websocket 结束超时")
+	}
+
+	require.Equal(t, 2, dialer.DialCount(), "超出重放上限后不应再换连重放")
+	secondConn.mu.Lock()
+	secondWriteCount := len(secondConn.writes)
+	secondConn.mu.Unlock()
+	require.Equal(t, 2, secondWriteCount, "第三轮仅发送一次原始请求")
+
+	metrics := svc.SnapshotOpenAIWSRetryMetrics()
+	require.Equal(t, int64(1), metrics.FullCreateReplayTotal)
+	require.Equal(t, int64(1), metrics.FullCreateReplayCappedTotal)
 }
 
 func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_StoreDisabledStrictAffinityPreviousResponseNotFoundLayer2Recovery(t *testing.T) {
@@ -2358,82 +2537,347 @@ func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_RejectsMessageID
 	}
 }
 
-type openAIWSQueueDialer struct {
-	mu        sync.Mutex
-	conns     []openAIWSClientConn
-	dialCount int
-}
-
-func (d *openAIWSQueueDialer) Dial(
-	ctx context.Context,
-	wsURL string,
-	headers http.Header,
-	proxyURL string,
-) (openAIWSClientConn, int, http.Header, error) {
-	_ = ctx
-	_ = wsURL
-	_ = headers
-	_ = proxyURL
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	d.dialCount++
-	if len(d.conns) == 0 {
-		return nil, 503, nil, errors.New("no test conn")
-	}
-	conn := d.conns[0]
-	if len(d.conns) > 1 {
-		d.conns = d.conns[1:]
-	}
-	return conn, 0, nil, nil
-}
-
-func (d *openAIWSQueueDialer) DialCount() int {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	return d.dialCount
-}
-
-type openAIWSPreflightFailConn struct {
-	mu         sync.Mutex
-	events     [][]byte
-	pingFails  bool
-	writeCount int
-	pingCount  int
-}
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_ForceDedicatedAllOverridesAccountMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
 
-func (c *openAIWSPreflightFailConn) WriteJSON(context.Context, any) error {
-	c.mu.Lock()
-	c.writeCount++
-	c.mu.Unlock()
-	return nil
-}
+	cfg := &config.Config{}
+	cfg.Security.URLAllowlist.Enabled = false
+	cfg.Security.URLAllowlist.AllowInsecureHTTP = true
+	cfg.Gateway.OpenAIWS.Enabled = true
+	cfg.Gateway.OpenAIWS.OAuthEnabled = true
+	cfg.Gateway.OpenAIWS.APIKeyEnabled = true
+	cfg.Gateway.OpenAIWS.ResponsesWebsocketsV2 = true
+	cfg.Gateway.OpenAIWS.ModeRouterV2Enabled = true
+	cfg.Gateway.OpenAIWS.IngressModeDefault = OpenAIWSIngressModeCtxPool
+	cfg.Gateway.OpenAIWS.ForceDedicatedAll = true
+	cfg.Gateway.OpenAIWS.MaxConnsPerAccount = 1
+	cfg.Gateway.OpenAIWS.MinIdlePerAccount = 0
+	cfg.Gateway.OpenAIWS.MaxIdlePerAccount = 1
+	cfg.Gateway.OpenAIWS.QueueLimitPerConn = 8
+	cfg.Gateway.OpenAIWS.DialTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.ReadTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.WriteTimeoutSeconds = 3
 
-func (c *openAIWSPreflightFailConn) ReadMessage(context.Context) ([]byte, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if len(c.events) == 0 {
-		return nil, io.EOF
+	dialer := &openAIWSQueueDialer{
+		conns: []openAIWSClientConn{
+			&openAIWSCaptureConn{events: [][]byte{
+				[]byte(`{"type":"response.completed","response":{"id":"resp_force_all_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+			}},
+			&openAIWSCaptureConn{events: [][]byte{
+				[]byte(`{"type":"response.completed","response":{"id":"resp_force_all_2","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+			}},
+		},
 	}
-	event := c.events[0]
-	c.events = c.events[1:]
-	if len(c.events) == 0 {
-		c.pingFails = true
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(dialer)
+
+	svc := &OpenAIGatewayService{
+		cfg:              cfg,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     pool,
 	}
-	return event, nil
-}
 
-func (c *openAIWSPreflightFailConn) Ping(context.Context) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.pingCount++
-	if c.pingFails {
-		return errors.New("preflight ping failed")
+	account := &Account{
+		ID:          442,
+		Name:        "openai-ingress-force-dedicated",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{
+			"api_key": "sk-test",
+		},
+		Extra: map[string]any{
+			"openai_apikey_responses_websockets_v2_mode": OpenAIWSIngressModeCtxPool,
+		},
 	}
-	return nil
-}
 
-func (c *openAIWSPreflightFailConn) Close() error {
-	return nil
+	var modesMu sync.Mutex
+	connModes := make([]string, 0, 2)
+	hooks := &OpenAIWSIngressHooks{
+		AfterTurn: func(_ int, result *OpenAIForwardResult, _ error) {
+			if result == nil {
+				return
+			}
+			modesMu.Lock()
+			connModes = append(connModes, result.OpenAIWSConnMode)
+			modesMu.Unlock()
+		},
+	}
+
+	serverErrCh := make(chan error, 2)
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := coderws.Accept(w, r, &coderws.AcceptOptions{
+			CompressionMode: coderws.CompressionContextTakeover,
+		})
+		if err != nil {
+			serverErrCh <- err
+			return
+		}
+		defer func() {
+			_ = conn.CloseNow()
+		}()
+
+		rec := httptest.NewRecorder()
+		ginCtx, _ := gin.CreateTestContext(rec)
+		req := r.Clone(r.Context())
+		req.Header = req.Header.Clone()
+		req.Header.Set("User-Agent", "unit-test-agent/1.0")
+		ginCtx.Request = req
+
+		readCtx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		_, firstMessage, readErr := conn.Read(readCtx)
+		cancel()
+		if readErr != nil {
+			serverErrCh <- readErr
+			return
+		}
+		serverErrCh <- svc.ProxyResponsesWebSocketFromClient(r.Context(), ginCtx, conn, account, "sk-test", firstMessage, hooks)
+	}))
+	defer wsServer.Close()
+
+	runSingleTurnSession := func(expectedResponseID string) {
+		dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+		clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http"), nil)
+		cancelDial()
+		require.NoError(t, err)
+		defer func() {
+			_ = clientConn.CloseNow()
+		}()
+
+		writeCtx, cancelWrite := context.WithTimeout(context.Background(), 3*time.Second)
+		err = clientConn.Write(writeCtx, coderws.MessageText, []byte(`{"type":"response.create","model":"gpt-5.1","stream":false}`))
+		cancelWrite()
+		require.NoError(t, err)
+
+		readCtx, cancelRead := context.WithTimeout(context.Background(), 3*time.Second)
+		_, event, readErr := clientConn.Read(readCtx)
+		cancelRead()
+		require.NoError(t, readErr)
+		require.Equal(t, expectedResponseID, gjson.GetBytes(event, "response.id").String())
+
+		require.NoError(t, clientConn.Close(coderws.StatusNormalClosure, "done"))
+		select {
+		case serverErr := <-serverErrCh:
+			require.NoError(t, serverErr)
+		case <-time.After(5 * time.Second):
+			t.Fatal("等待 ingress websocket 结束超时")
+		}
+	}
+
+	runSingleTurnSession("resp_force_all_1")
+	runSingleTurnSession("resp_force_all_2")
+
+	require.Equal(t, 2, dialer.DialCount(), "force_dedicated_all 应覆盖账号 ctx_pool 模式，会话间不复用上游连接")
+	modesMu.Lock()
+	defer modesMu.Unlock()
+	require.Equal(t, []string{OpenAIWSIngressModeDedicated, OpenAIWSIngressModeDedicated}, connModes)
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_ForceDedicatedAllDialsFreshConnPerTurn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{}
+	cfg.Security.URLAllowlist.Enabled = false
+	cfg.Security.URLAllowlist.AllowInsecureHTTP = true
+	cfg.Gateway.OpenAIWS.Enabled = true
+	cfg.Gateway.OpenAIWS.OAuthEnabled = true
+	cfg.Gateway.OpenAIWS.APIKeyEnabled = true
+	cfg.Gateway.OpenAIWS.ResponsesWebsocketsV2 = true
+	cfg.Gateway.OpenAIWS.ModeRouterV2Enabled = true
+	cfg.Gateway.OpenAIWS.IngressModeDefault = OpenAIWSIngressModeCtxPool
+	cfg.Gateway.OpenAIWS.ForceDedicatedAll = true
+	cfg.Gateway.OpenAIWS.MaxConnsPerAccount = 1
+	cfg.Gateway.OpenAIWS.MinIdlePerAccount = 0
+	cfg.Gateway.OpenAIWS.MaxIdlePerAccount = 1
+	cfg.Gateway.OpenAIWS.QueueLimitPerConn = 8
+	cfg.Gateway.OpenAIWS.DialTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.ReadTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.WriteTimeoutSeconds = 3
+
+	firstConn := &openAIWSCaptureConn{events: [][]byte{
+		[]byte(`{"type":"response.completed","response":{"id":"resp_force_turn_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+		// 若第二个 turn 复用了该连接会读到此事件。
+		[]byte(`{"type":"response.completed","response":{"id":"resp_force_turn_reused","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+	}}
+	secondConn := &openAIWSCaptureConn{events: [][]byte{
+		[]byte(`{"type":"response.completed","response":{"id":"resp_force_turn_2","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+	}}
+	dialer := &openAIWSQueueDialer{conns: []openAIWSClientConn{firstConn, secondConn}}
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(dialer)
+
+	svc := &OpenAIGatewayService{
+		cfg:              cfg,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     pool,
+	}
+
+	account := &Account{
+		ID:          443,
+		Name:        "openai-ingress-force-dedicated-turns",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{
+			"api_key": "sk-test",
+		},
+	}
+
+	serverErrCh := make(chan error, 1)
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := coderws.Accept(w, r, &coderws.AcceptOptions{
+			CompressionMode: coderws.CompressionContextTakeover,
+		})
+		if err != nil {
+			serverErrCh <- err
+			return
+		}
+		defer func() {
+			_ = conn.CloseNow()
+		}()
+
+		rec := httptest.NewRecorder()
+		ginCtx, _ := gin.CreateTestContext(rec)
+		req := r.Clone(r.Context())
+		req.Header = req.Header.Clone()
+		req.Header.Set("User-Agent", "unit-test-agent/1.0")
+		ginCtx.Request = req
+
+		readCtx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		_, firstMessage, readErr := conn.Read(readCtx)
+		cancel()
+		if readErr != nil {
+			serverErrCh <- readErr
+			return
+		}
+		serverErrCh <- svc.ProxyResponsesWebSocketFromClient(r.Context(), ginCtx, conn, account, "sk-test", firstMessage, nil)
+	}))
+	defer wsServer.Close()
+
+	dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+	clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http"), nil)
+	cancelDial()
+	require.NoError(t, err)
+	defer func() {
+		_ = clientConn.CloseNow()
+	}()
+
+	for _, expectedResponseID := range []string{"resp_force_turn_1", "resp_force_turn_2"} {
+		writeCtx, cancelWrite := context.WithTimeout(context.Background(), 3*time.Second)
+		err = clientConn.Write(writeCtx, coderws.MessageText, []byte(`{"type":"response.create","model":"gpt-5.1","stream":false}`))
+		cancelWrite()
+		require.NoError(t, err)
+
+		readCtx, cancelRead := context.WithTimeout(context.Background(), 3*time.Second)
+		_, event, readErr := clientConn.Read(readCtx)
+		cancelRead()
+		require.NoError(t, readErr)
+		require.Equal(t, expectedResponseID, gjson.GetBytes(event, "response.id").String())
+	}
+
+	// 同一 ingress 会话内每个 turn 都重新拨号，上一 turn 的连接在轮次结束后即关闭。
+	require.Equal(t, 2, dialer.DialCount(), "force_dedicated_all 下 ingress 会话应每轮新建上游连接")
+	firstConn.mu.Lock()
+	firstClosed, firstWrites := firstConn.closed, len(firstConn.writes)
+	firstConn.mu.Unlock()
+	require.True(t, firstClosed, "上一 turn 的上游连接应在轮次结束后关闭")
+	require.Equal(t, 1, firstWrites)
+
+	require.NoError(t, clientConn.Close(coderws.StatusNormalClosure, "done"))
+	select {
+	case serverErr := <-serverErrCh:
+		require.NoError(t, serverErr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待 ingress websocket 结束超时")
+	}
+}
+
+type openAIWSQueueDialer struct {
+	mu        sync.Mutex
+	conns     []openAIWSClientConn
+	dialCount int
+}
+
+func (d *openAIWSQueueDialer) Dial(
+	ctx context.Context,
+	wsURL string,
+	headers http.Header,
+	proxyURL string,
+) (openAIWSClientConn, int, http.Header, error) {
+	_ = ctx
+	_ = wsURL
+	_ = headers
+	_ = proxyURL
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dialCount++
+	if len(d.conns) == 0 {
+		return nil, 503, nil, errors.New("no test conn")
+	}
+	conn := d.conns[0]
+	if len(d.conns) > 1 {
+		d.conns = d.conns[1:]
+	}
+	return conn, 0, nil, nil
+}
+
+func (d *openAIWSQueueDialer) DialCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dialCount
+}
+
+type openAIWSPreflightFailConn struct {
+	mu         sync.Mutex
+	events     [][]byte
+	pingFails  bool
+	writeCount int
+	pingCount  int
+}
+
+func (c *openAIWSPreflightFailConn) WriteJSON(context.Context, any) error {
+	c.mu.Lock()
+	c.writeCount++
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *openAIWSPreflightFailConn) ReadMessage(context.Context) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.events) == 0 {
+		return nil, io.EOF
+	}
+	event := c.events[0]
+	c.events = c.events[1:]
+	if len(c.events) == 0 {
+		c.pingFails = true
+	}
+	return event, nil
+}
+
+func (c *openAIWSPreflightFailConn) Ping(context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pingCount++
+	if c.pingFails {
+		return errors.New("preflight ping failed")
+	}
+	return nil
+}
+
+func (c *openAIWSPreflightFailConn) Close() error {
+	return nil
 }
 
 func (c *openAIWSPreflightFailConn) WriteCount() int {
@@ -2619,3 +3063,1103 @@ func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_ClientDisconnect
 		t.Fatal("未收到断连后的 turn 结果回调")
 	}
 }
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_DropsMalformedUpstreamEvent(t *testing.T) {
+	upstream := &openAIWSCaptureConn{
+		events: [][]byte{
+			[]byte(`{"type":"response.created","response":{"id":"resp_ingress_malformed_1","model":"gpt-5.1"}}`),
+			[]byte(`{"sequence":1,"note":"unknown_shape"}`),
+			[]byte(`{"type":"response.output_text.delta","delta":"tr`),
+			[]byte(`{"type":"response.completed","response":{"id":"resp_ingress_malformed_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+		},
+	}
+	account := &Account{
+		ID:          138,
+		Name:        "openai-ingress-malformed-event",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{"api_key": "sk-test"},
+		Extra:       map[string]any{"responses_websockets_v2_enabled": true},
+	}
+	received := runOpenAIWSIngressSessionForTest(t, newOpenAIWSIngressCaptureTestConfig(), account, "sk-test", upstream, [][]byte{
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false}`),
+	})
+
+	require.Len(t, received, 3, "非法 JSON 帧应被丢弃，其余帧正常转发")
+	require.JSONEq(t, `{"sequence":1,"note":"unknown_shape"}`, string(received[1]), "结构未知的合法 JSON 帧应原样透传")
+	require.Equal(t, "response.completed", gjson.GetBytes(received[2], "type").String())
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_PartialUsageOnErrorAfterOutput(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name         string
+		events       [][]byte
+		expectResult bool
+	}{
+		{
+			name: "usage_fragment_before_upstream_drop",
+			events: [][]byte{
+				[]byte(`{"type":"response.created","response":{"id":"resp_partial_usage_1","model":"gpt-5.1"}}`),
+				[]byte(`{"type":"response.output_text.delta","delta":"hel"}`),
+				[]byte(`{"type":"response.output_text.delta","delta":"lo"}`),
+				[]byte(`{"type":"response.in_progress","response":{"id":"resp_partial_usage_1","usage":{"input_tokens":7,"output_tokens":3,"input_tokens_details":{"cached_tokens":2}}}}`),
+			},
+			expectResult: true,
+		},
+		{
+			name: "no_usage_fragment",
+			events: [][]byte{
+				[]byte(`{"type":"response.created","response":{"id":"resp_partial_usage_2","model":"gpt-5.1"}}`),
+				[]byte(`{"type":"response.output_text.delta","delta":"hello"}`),
+			},
+			expectResult: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := newOpenAIWSIngressCaptureTestConfig()
+			pool := newOpenAIWSConnPool(cfg)
+			pool.setClientDialerForTest(&openAIWSQueueDialer{conns: []openAIWSClientConn{&openAIWSCaptureConn{events: tc.events}}})
+			svc := &OpenAIGatewayService{
+				cfg:              cfg,
+				httpUpstream:     &httpUpstreamRecorder{},
+				cache:            &stubGatewayCache{},
+				openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+				toolCorrector:    NewCodexToolCorrector(),
+				openaiWSPool:     pool,
+			}
+			account := &Account{
+				ID:          118,
+				Name:        "openai-ingress-partial-usage",
+				Platform:    PlatformOpenAI,
+				Type:        AccountTypeAPIKey,
+				Status:      StatusActive,
+				Schedulable: true,
+				Concurrency: 1,
+				Credentials: map[string]any{"api_key": "sk-test"},
+				Extra:       map[string]any{"responses_websockets_v2_enabled": true},
+			}
+
+			type afterTurnCall struct {
+				result *OpenAIForwardResult
+				err    error
+			}
+			afterTurnCh := make(chan afterTurnCall, 1)
+			hooks := &OpenAIWSIngressHooks{
+				AfterTurn: func(_ int, result *OpenAIForwardResult, turnErr error) {
+					afterTurnCh <- afterTurnCall{result: result, err: turnErr}
+				},
+			}
+			serverErrCh := make(chan error, 1)
+			wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, err := coderws.Accept(w, r, &coderws.AcceptOptions{CompressionMode: coderws.CompressionContextTakeover})
+				if err != nil {
+					serverErrCh <- err
+					return
+				}
+				defer func() {
+					_ = conn.CloseNow()
+				}()
+
+				rec := httptest.NewRecorder()
+				ginCtx, _ := gin.CreateTestContext(rec)
+				ginCtx.Request = r.Clone(r.Context())
+
+				readCtx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+				_, firstMessage, readErr := conn.Read(readCtx)
+				cancel()
+				if readErr != nil {
+					serverErrCh <- readErr
+					return
+				}
+				serverErrCh <- svc.ProxyResponsesWebSocketFromClient(r.Context(), ginCtx, conn, account, "sk-test", firstMessage, hooks)
+			}))
+			defer wsServer.Close()
+
+			dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+			clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http"), nil)
+			cancelDial()
+			require.NoError(t, err)
+			defer func() {
+				_ = clientConn.CloseNow()
+			}()
+
+			writeCtx, cancelWrite := context.WithTimeout(context.Background(), 3*time.Second)
+			require.NoError(t, clientConn.Write(writeCtx, coderws.MessageText, []byte(`{"type":"response.create","model":"gpt-5.1","stream":true}`)))
+			cancelWrite()
+			go func() {
+				for {
+					readCtx, cancelRead := context.WithTimeout(context.Background(), 3*time.Second)
+					_, _, readErr := clientConn.Read(readCtx)
+					cancelRead()
+					if readErr != nil {
+						return
+					}
+				}
+			}()
+
+			select {
+			case serverErr := <-serverErrCh:
+				require.Error(t, serverErr, "上游在输出后断开应返回错误")
+			case <-time.After(5 * time.Second):
+				t.Fatal("等待 ingress websocket 结束超时")
+			}
+
+			select {
+			case call := <-afterTurnCh:
+				require.Error(t, call.err)
+				if !tc.expectResult {
+					require.Nil(t, call.result, "未观测到 usage 片段时不应返回部分结果")
+					return
+				}
+				require.NotNil(t, call.result)
+				require.True(t, call.result.PartialUsage)
+				require.Equal(t, "resp_partial_usage_1", call.result.RequestID)
+				require.Equal(t, 7, call.result.Usage.InputTokens)
+				require.Equal(t, 3, call.result.Usage.OutputTokens)
+				require.Equal(t, 2, call.result.Usage.CacheReadInputTokens)
+				require.Equal(t, "gpt-5.1", call.result.Model)
+			case <-time.After(2 * time.Second):
+				t.Fatal("未收到失败 turn 的 AfterTurn 回调")
+			}
+		})
+	}
+}
+
+type openAIWSHeaderRecordingDialer struct {
+	openAIWSQueueDialer
+	headersMu sync.Mutex
+	headers   []http.Header
+}
+
+func (d *openAIWSHeaderRecordingDialer) Dial(
+	ctx context.Context,
+	wsURL string,
+	headers http.Header,
+	proxyURL string,
+) (openAIWSClientConn, int, http.Header, error) {
+	d.headersMu.Lock()
+	d.headers = append(d.headers, headers.Clone())
+	d.headersMu.Unlock()
+	return d.openAIWSQueueDialer.Dial(ctx, wsURL, headers, proxyURL)
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_ReselectsAccountOnContinuityBreak(t *testing.T) {
+	newAccount := func(id int64, apiKey string) *Account {
+		return &Account{
+			ID:          id,
+			Name:        "openai-ingress-reselect",
+			Platform:    PlatformOpenAI,
+			Type:        AccountTypeAPIKey,
+			Status:      StatusActive,
+			Schedulable: true,
+			Concurrency: 1,
+			Credentials: map[string]any{"api_key": apiKey},
+			Extra:       map[string]any{"responses_websockets_v2_enabled": true},
+		}
+	}
+	clientMessages := [][]byte{
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"input":[{"type":"input_text","text":"hi"}]}`),
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"previous_response_id":"resp_reselect_1","input":[{"type":"input_text","text":"again"}]}`),
+	}
+
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("enabled=%v", enabled), func(t *testing.T) {
+			cfg := newOpenAIWSIngressCaptureTestConfig()
+			cfg.Gateway.OpenAIWS.IngressPreviousResponseRecoveryEnabled = true
+			cfg.Gateway.OpenAIWS.ReselectAccountOnContinuityBreak = enabled
+
+			firstConn := &openAIWSCaptureConn{
+				events: [][]byte{
+					[]byte(`{"type":"response.completed","response":{"id":"resp_reselect_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+					[]byte(`{"type":"error","error":{"type":"invalid_request_error","code":"previous_response_not_found","message":""}}`),
+				},
+			}
+			secondConn := &openAIWSCaptureConn{
+				events: [][]byte{
+					[]byte(`{"type":"response.completed","response":{"id":"resp_reselect_2","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+				},
+			}
+			dialer := &openAIWSHeaderRecordingDialer{openAIWSQueueDialer: openAIWSQueueDialer{conns: []openAIWSClientConn{firstConn, secondConn}}}
+			pool := newOpenAIWSConnPool(cfg)
+			pool.setClientDialerForTest(dialer)
+			svc := &OpenAIGatewayService{
+				cfg:              cfg,
+				httpUpstream:     &httpUpstreamRecorder{},
+				cache:            &stubGatewayCache{},
+				openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+				toolCorrector:    NewCodexToolCorrector(),
+				openaiWSPool:     pool,
+			}
+
+			primary := newAccount(131, "sk-primary")
+			alternate := newAccount(132, "sk-alternate")
+			var reselectMu sync.Mutex
+			reselectCalls := 0
+			var reselectFrom int64
+			var afterTurnResponseIDs []string
+			hooks := &OpenAIWSIngressHooks{
+				ReselectAccount: func(_ int, current *Account, _ string) (*Account, string, error) {
+					reselectMu.Lock()
+					defer reselectMu.Unlock()
+					reselectCalls++
+					reselectFrom = current.ID
+					return alternate, "sk-alternate", nil
+				},
+				AfterTurn: func(_ int, result *OpenAIForwardResult, _ error) {
+					if result != nil {
+						reselectMu.Lock()
+						afterTurnResponseIDs = append(afterTurnResponseIDs, result.RequestID)
+						reselectMu.Unlock()
+					}
+				},
+			}
+
+			received := runOpenAIWSIngressSessionWithServiceForTest(t, svc, primary, "sk-primary", clientMessages, hooks)
+			require.Equal(t, "resp_reselect_2", gjson.GetBytes(received[len(received)-1], "response.id").String())
+
+			reselectMu.Lock()
+			defer reselectMu.Unlock()
+			require.Equal(t, []string{"resp_reselect_1", "resp_reselect_2"}, afterTurnResponseIDs)
+			dialer.headersMu.Lock()
+			defer dialer.headersMu.Unlock()
+			require.Len(t, dialer.headers, 2, "续链断裂后应新建连接重放")
+			require.Equal(t, "Bearer sk-primary", dialer.headers[0].Get("authorization"))
+			if !enabled {
+				require.Zero(t, reselectCalls, "默认配置不应重新调度账号")
+				require.Equal(t, "Bearer sk-primary", dialer.headers[1].Get("authorization"))
+				return
+			}
+			require.Equal(t, 1, reselectCalls, "续链断裂降级全量 create 时应重新调度一次")
+			require.Equal(t, primary.ID, reselectFrom)
+			require.Equal(t, "Bearer sk-alternate", dialer.headers[1].Get("authorization"), "重放应使用新账号建连")
+			require.Equal(t, int64(1), svc.SnapshotOpenAIWSRetryMetrics().AccountReselectTotal)
+		})
+	}
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_ModelChangeKeepsStickyAccount(t *testing.T) {
+	newAccount := func(id int64, apiKey string, models ...string) *Account {
+		mapping := make(map[string]any, len(models))
+		for _, model := range models {
+			mapping[model] = model
+		}
+		return &Account{
+			ID:          id,
+			Name:        "openai-ingress-model-change",
+			Platform:    PlatformOpenAI,
+			Type:        AccountTypeAPIKey,
+			Status:      StatusActive,
+			Schedulable: true,
+			Concurrency: 1,
+			Credentials: map[string]any{"api_key": apiKey, "model_mapping": mapping},
+			Extra:       map[string]any{"responses_websockets_v2_enabled": true},
+		}
+	}
+	clientMessages := [][]byte{
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"input":[{"type":"input_text","text":"hi"}]}`),
+		[]byte(`{"type":"response.create","model":"gpt-5.2","stream":false,"input":[{"type":"input_text","text":"escalate"}]}`),
+	}
+	completed := func(id string) []byte {
+		return []byte(`{"type":"response.completed","response":{"id":"` + id + `","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`)
+	}
+
+	cases := []struct {
+		name          string
+		forceReselect bool
+		primaryModels []string
+		wantSwitch    bool
+	}{
+		{name: "supported_model_keeps_account", primaryModels: []string{"gpt-5.1", "gpt-5.2"}},
+		{name: "forced_reselect", forceReselect: true, primaryModels: []string{"gpt-5.1", "gpt-5.2"}, wantSwitch: true},
+		{name: "unsupported_model_reselects", primaryModels: []string{"gpt-5.1"}, wantSwitch: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := newOpenAIWSIngressCaptureTestConfig()
+			cfg.Gateway.OpenAIWS.ModelChangeForcesReselect = tc.forceReselect
+
+			firstConn := &openAIWSCaptureConn{events: [][]byte{completed("resp_model_change_1")}}
+			secondConn := &openAIWSCaptureConn{events: [][]byte{completed("resp_model_change_2")}}
+			if !tc.wantSwitch {
+				firstConn.events = append(firstConn.events, completed("resp_model_change_2"))
+			}
+			dialer := &openAIWSHeaderRecordingDialer{openAIWSQueueDialer: openAIWSQueueDialer{conns: []openAIWSClientConn{firstConn, secondConn}}}
+			pool := newOpenAIWSConnPool(cfg)
+			pool.setClientDialerForTest(dialer)
+			svc := &OpenAIGatewayService{
+				cfg:              cfg,
+				httpUpstream:     &httpUpstreamRecorder{},
+				cache:            &stubGatewayCache{},
+				openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+				toolCorrector:    NewCodexToolCorrector(),
+				openaiWSPool:     pool,
+			}
+
+			primary := newAccount(141, "sk-primary", tc.primaryModels...)
+			alternate := newAccount(142, "sk-alternate", "gpt-5.1", "gpt-5.2")
+			var reselectMu sync.Mutex
+			var reselectModels []string
+			hooks := &OpenAIWSIngressHooks{
+				ReselectAccount: func(_ int, _ *Account, requestedModel string) (*Account, string, error) {
+					reselectMu.Lock()
+					defer reselectMu.Unlock()
+					reselectModels = append(reselectModels, requestedModel)
+					return alternate, "sk-alternate", nil
+				},
+			}
+
+			received := runOpenAIWSIngressSessionWithServiceForTest(t, svc, primary, "sk-primary", clientMessages, hooks)
+			require.Equal(t, "resp_model_change_2", gjson.GetBytes(received[len(received)-1], "response.id").String())
+
+			reselectMu.Lock()
+			defer reselectMu.Unlock()
+			dialer.headersMu.Lock()
+			defer dialer.headersMu.Unlock()
+			if !tc.wantSwitch {
+				require.Empty(t, reselectModels, "账号支持新模型时不应重新调度")
+				require.Len(t, dialer.headers, 1, "切换模型后应继续复用原账号连接")
+				firstConn.mu.Lock()
+				defer firstConn.mu.Unlock()
+				require.Len(t, firstConn.writes, 2)
+				require.Equal(t, "gpt-5.2", firstConn.writes[1]["model"], "第二轮应以新模型发往原账号")
+				return
+			}
+			require.Equal(t, []string{"gpt-5.2"}, reselectModels, "应按新模型重新调度一次")
+			require.Len(t, dialer.headers, 2)
+			require.Equal(t, "Bearer sk-primary", dialer.headers[0].Get("authorization"))
+			require.Equal(t, "Bearer sk-alternate", dialer.headers[1].Get("authorization"), "换账号后应在新账号上建连")
+			secondConn.mu.Lock()
+			defer secondConn.mu.Unlock()
+			require.Len(t, secondConn.writes, 1)
+			require.Equal(t, "gpt-5.2", secondConn.writes[0]["model"])
+		})
+	}
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_StreamConsistencyPolicy(t *testing.T) {
+	account := &Account{
+		ID:          451,
+		Name:        "openai-ingress-stream-consistency",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{"api_key": "sk-test"},
+		Extra:       map[string]any{"responses_websockets_v2_enabled": true},
+	}
+	newUpstream := func() *openAIWSCaptureConn {
+		return &openAIWSCaptureConn{
+			events: [][]byte{
+				[]byte(`{"type":"response.completed","response":{"id":"resp_stream_mode_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+				[]byte(`{"type":"response.completed","response":{"id":"resp_stream_mode_2","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+			},
+		}
+	}
+	clientMessages := [][]byte{
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":true,"input":[{"type":"input_text","text":"hi"}]}`),
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"previous_response_id":"resp_stream_mode_1","input":[{"type":"input_text","text":"again"}]}`),
+	}
+
+	for _, policy := range []string{"off", "coerce"} {
+		t.Run(policy, func(t *testing.T) {
+			cfg := newOpenAIWSIngressCaptureTestConfig()
+			cfg.Gateway.OpenAIWS.IngressStreamConsistencyPolicy = policy
+			upstream := newUpstream()
+			runOpenAIWSIngressSessionForTest(t, cfg, account, "sk-test", upstream, clientMessages)
+
+			upstream.mu.Lock()
+			writes := append([]map[string]any(nil), upstream.writes...)
+			upstream.mu.Unlock()
+			require.Len(t, writes, 2)
+			require.Equal(t, true, writes[0]["stream"])
+			if policy == "coerce" {
+				require.Equal(t, true, writes[1]["stream"], "coerce 策略应把翻转的 stream 改写为首个 turn 的取值")
+			} else {
+				require.Equal(t, false, writes[1]["stream"], "off 策略应原样转发")
+			}
+		})
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		cfg := newOpenAIWSIngressCaptureTestConfig()
+		cfg.Gateway.OpenAIWS.IngressStreamConsistencyPolicy = "reject"
+		upstream := newUpstream()
+		pool := newOpenAIWSConnPool(cfg)
+		pool.setClientDialerForTest(&openAIWSQueueDialer{conns: []openAIWSClientConn{upstream}})
+		svc := &OpenAIGatewayService{
+			cfg:              cfg,
+			httpUpstream:     &httpUpstreamRecorder{},
+			cache:            &stubGatewayCache{},
+			openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+			toolCorrector:    NewCodexToolCorrector(),
+			openaiWSPool:     pool,
+		}
+
+		serverErrCh := make(chan error, 1)
+		wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := coderws.Accept(w, r, &coderws.AcceptOptions{CompressionMode: coderws.CompressionContextTakeover})
+			if err != nil {
+				serverErrCh <- err
+				return
+			}
+			defer func() {
+				_ = conn.CloseNow()
+			}()
+			rec := httptest.NewRecorder()
+			ginCtx, _ := gin.CreateTestContext(rec)
+			ginCtx.Request = r.Clone(r.Context())
+			readCtx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+			_, firstMessage, readErr := conn.Read(readCtx)
+			cancel()
+			if readErr != nil {
+				serverErrCh <- readErr
+				return
+			}
+			serverErrCh <- svc.ProxyResponsesWebSocketFromClient(r.Context(), ginCtx, conn, account, "sk-test", firstMessage, nil)
+		}))
+		defer wsServer.Close()
+
+		dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+		clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http"), nil)
+		cancelDial()
+		require.NoError(t, err)
+		defer func() {
+			_ = clientConn.CloseNow()
+		}()
+
+		writeCtx, cancelWrite := context.WithTimeout(context.Background(), 3*time.Second)
+		require.NoError(t, clientConn.Write(writeCtx, coderws.MessageText, clientMessages[0]))
+		cancelWrite()
+		readCtx, cancelRead := context.WithTimeout(context.Background(), 3*time.Second)
+		_, firstEvent, err := clientConn.Read(readCtx)
+		cancelRead()
+		require.NoError(t, err)
+		require.Equal(t, "response.completed", gjson.GetBytes(firstEvent, "type").String())
+
+		writeCtx, cancelWrite = context.WithTimeout(context.Background(), 3*time.Second)
+		require.NoError(t, clientConn.Write(writeCtx, coderws.MessageText, clientMessages[1]))
+		cancelWrite()
+
+		select {
+		case serverErr := <-serverErrCh:
+			var closeErr *OpenAIWSClientCloseError
+			require.ErrorAs(t, serverErr, &closeErr)
+			require.Equal(t, coderws.StatusPolicyViolation, closeErr.StatusCode())
+			require.Contains(t, closeErr.Reason(), "stream must stay true")
+		case <-time.After(5 * time.Second):
+			t.Fatal("等待 ingress websocket 结束超时")
+		}
+		upstream.mu.Lock()
+		require.Len(t, upstream.writes, 1, "被拒绝的 turn 不应发往上游")
+		upstream.mu.Unlock()
+	})
+}
+
+// openAIWSAuthRecordingDialer 记录每次建连使用的 Authorization 头，连接按队列依次返回。
+type openAIWSAuthRecordingDialer struct {
+	inner *openAIWSQueueDialer
+	mu    sync.Mutex
+	auths []string
+}
+
+func (d *openAIWSAuthRecordingDialer) Dial(
+	ctx context.Context,
+	wsURL string,
+	headers http.Header,
+	proxyURL string,
+) (openAIWSClientConn, int, http.Header, error) {
+	d.mu.Lock()
+	d.auths = append(d.auths, headers.Get("authorization"))
+	d.mu.Unlock()
+	return d.inner.Dial(ctx, wsURL, headers, proxyURL)
+}
+
+func (d *openAIWSAuthRecordingDialer) snapshot() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.auths...)
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_RecycleAccountConnectionsRedialsWithRotatedKey(t *testing.T) {
+	cfg := newOpenAIWSIngressCaptureTestConfig()
+	first := &openAIWSCaptureConn{events: [][]byte{
+		[]byte(`{"type":"response.completed","response":{"id":"resp_recycle_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+	}}
+	second := &openAIWSCaptureConn{events: [][]byte{
+		[]byte(`{"type":"response.completed","response":{"id":"resp_recycle_2","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+	}}
+	dialer := &openAIWSAuthRecordingDialer{inner: &openAIWSQueueDialer{conns: []openAIWSClientConn{first, second}}}
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(dialer)
+
+	accounts := []Account{{
+		ID:          145,
+		Name:        "openai-ingress-recycle",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{"api_key": "sk-old"},
+		Extra:       map[string]any{"responses_websockets_v2_enabled": true},
+	}}
+	repo := stubOpenAIAccountRepo{accounts: accounts}
+	svc := &OpenAIGatewayService{
+		cfg:              cfg,
+		accountRepo:      repo,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     pool,
+	}
+	account := &repo.accounts[0]
+
+	var recycled int
+	hooks := &OpenAIWSIngressHooks{
+		AfterTurn: func(turn int, _ *OpenAIForwardResult, _ error) {
+			if turn != 1 {
+				return
+			}
+			// 第一个 turn 结束前完成凭证轮换：会话连接应在该 turn 后关闭，下一 turn 以新凭证重新建连。
+			repo.accounts[0].Credentials = map[string]any{"api_key": "sk-new"}
+			recycled = svc.RecycleAccountConnections(account.ID)
+		},
+	}
+	received := runOpenAIWSIngressSessionWithServiceForTest(t, svc, account, "sk-old", [][]byte{
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"input":"one"}`),
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"input":"two"}`),
+	}, hooks)
+
+	require.Len(t, received, 2)
+	require.Equal(t, 1, recycled)
+	require.Equal(t, []string{"Bearer sk-old", "Bearer sk-new"}, dialer.snapshot())
+	first.mu.Lock()
+	require.True(t, first.closed, "被回收的连接应在当前 turn 结束后关闭")
+	require.Len(t, first.writes, 1)
+	first.mu.Unlock()
+	second.mu.Lock()
+	require.Len(t, second.writes, 1)
+	second.mu.Unlock()
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_SessionResponseMaxAgeForcesFullCreate(t *testing.T) {
+	cfg := newOpenAIWSIngressCaptureTestConfig()
+	cfg.Gateway.OpenAIWS.SessionResponseMaxAgeSeconds = 1
+	upstream := &openAIWSCaptureConn{events: [][]byte{
+		[]byte(`{"type":"response.completed","response":{"id":"resp_age_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+		[]byte(`{"type":"response.completed","response":{"id":"resp_age_2","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+	}}
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(&openAIWSQueueDialer{conns: []openAIWSClientConn{upstream}})
+	svc := &OpenAIGatewayService{
+		cfg:              cfg,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     pool,
+	}
+	account := &Account{
+		ID:          146,
+		Name:        "openai-ingress-response-max-age",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{"api_key": "sk-max-age"},
+		Extra:       map[string]any{"responses_websockets_v2_enabled": true},
+	}
+	hooks := &OpenAIWSIngressHooks{
+		AfterTurn: func(turn int, _ *OpenAIForwardResult, _ error) {
+			if turn == 1 {
+				// 让续链超过 session_response_max_age_seconds。
+				time.Sleep(1100 * time.Millisecond)
+			}
+		},
+	}
+
+	received := runOpenAIWSIngressSessionWithServiceForTest(t, svc, account, "sk-max-age", [][]byte{
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"input":[{"type":"input_text","text":"one"}]}`),
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"previous_response_id":"resp_age_1","input":[{"type":"input_text","text":"two"}]}`),
+	}, hooks)
+	require.Len(t, received, 2)
+
+	upstream.mu.Lock()
+	defer upstream.mu.Unlock()
+	require.Len(t, upstream.writes, 2)
+	_, hasPrev := upstream.writes[1]["previous_response_id"]
+	require.False(t, hasPrev, "续链超过最长存活时间后应去掉 previous_response_id")
+	input, ok := upstream.writes[1]["input"].([]any)
+	require.True(t, ok)
+	require.Len(t, input, 2, "全量 create 应携带此前各轮的完整输入")
+	require.Equal(t, int64(1), svc.SnapshotOpenAIWSRetryMetrics().FullCreateReplayTotal)
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_ClientDisconnectCancelsQueuedTurn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{}
+	cfg.Security.URLAllowlist.Enabled = false
+	cfg.Security.URLAllowlist.AllowInsecureHTTP = true
+	cfg.Gateway.OpenAIWS.Enabled = true
+	cfg.Gateway.OpenAIWS.OAuthEnabled = true
+	cfg.Gateway.OpenAIWS.APIKeyEnabled = true
+	cfg.Gateway.OpenAIWS.ResponsesWebsocketsV2 = true
+	cfg.Gateway.OpenAIWS.MaxConnsPerAccount = 1
+	cfg.Gateway.OpenAIWS.MinIdlePerAccount = 0
+	cfg.Gateway.OpenAIWS.MaxIdlePerAccount = 1
+	cfg.Gateway.OpenAIWS.QueueLimitPerConn = 8
+	cfg.Gateway.OpenAIWS.DialTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.ReadTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.WriteTimeoutSeconds = 3
+
+	captureConn := &openAIWSCaptureConn{}
+	captureDialer := &openAIWSCaptureDialer{conn: captureConn}
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(captureDialer)
+
+	svc := &OpenAIGatewayService{
+		cfg:              cfg,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     pool,
+	}
+
+	account := &Account{
+		ID:          141,
+		Name:        "openai-ingress-queued-disconnect",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{
+			"api_key": "sk-test",
+		},
+		Extra: map[string]any{
+			"responses_websockets_v2_enabled": true,
+		},
+	}
+
+	// 前一个慢 turn 占用该账号唯一的上游连接，新会话的 turn 只能排队等待。
+	wsURL, err := svc.buildOpenAIResponsesWSURL(account)
+	require.NoError(t, err)
+	slowLease, err := pool.Acquire(context.Background(), openAIWSAcquireRequest{Account: account, WSURL: wsURL})
+	require.NoError(t, err)
+	defer slowLease.Release()
+	require.Equal(t, 1, captureDialer.DialCount())
+
+	serverErrCh := make(chan error, 1)
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := coderws.Accept(w, r, &coderws.AcceptOptions{
+			CompressionMode: coderws.CompressionContextTakeover,
+		})
+		if err != nil {
+			serverErrCh <- err
+			return
+		}
+		defer func() {
+			_ = conn.CloseNow()
+		}()
+
+		rec := httptest.NewRecorder()
+		ginCtx, _ := gin.CreateTestContext(rec)
+		req := r.Clone(r.Context())
+		req.Header = req.Header.Clone()
+		req.Header.Set("User-Agent", "unit-test-agent/1.0")
+		ginCtx.Request = req
+
+		readCtx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		_, firstMessage, readErr := conn.Read(readCtx)
+		cancel()
+		if readErr != nil {
+			serverErrCh <- readErr
+			return
+		}
+		serverErrCh <- svc.ProxyResponsesWebSocketFromClient(r.Context(), ginCtx, conn, account, "sk-test", firstMessage, nil)
+	}))
+	defer wsServer.Close()
+
+	dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+	clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http"), nil)
+	cancelDial()
+	require.NoError(t, err)
+	defer func() {
+		_ = clientConn.CloseNow()
+	}()
+
+	writeCtx, cancelWrite := context.WithTimeout(context.Background(), 3*time.Second)
+	require.NoError(t, clientConn.Write(writeCtx, coderws.MessageText, []byte(`{"type":"response.create","model":"gpt-5.1","stream":false}`)))
+	cancelWrite()
+
+	require.Eventually(t, func() bool {
+		_, waiters, _ := pool.AccountPoolLoad(account.ID)
+		return waiters == 1
+	}, 3*time.Second, 10*time.Millisecond, "turn 应在慢 turn 之后排队")
+
+	disconnectedAt := time.Now()
+	require.NoError(t, clientConn.CloseNow())
+
+	select {
+	case serverErr := <-serverErrCh:
+		require.NoError(t, serverErr, "客户端断开导致的排队取消应视为正常结束")
+	case <-time.After(2 * time.Second):
+		t.Fatal("客户端断开后排队中的 turn 应立即取消，而不是等到获取超时")
+	}
+	require.Less(t, time.Since(disconnectedAt), time.Second)
+
+	_, waiters, conns := pool.AccountPoolLoad(account.ID)
+	require.Zero(t, waiters, "排队名额应在客户端断开后释放")
+	require.Equal(t, 1, conns)
+	require.Equal(t, 1, captureDialer.DialCount(), "已断开客户端的 turn 不应再建连")
+	require.Empty(t, captureConn.writes, "排队中被取消的 turn 不应发往上游")
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_RejectsHTTPOnlyModel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := newOpenAIWSIngressCaptureTestConfig()
+	cfg.Gateway.OpenAIWS.ModelTransports = []config.GatewayOpenAIWSModelTransport{{Model: "gpt-image-*", Transport: "http"}}
+
+	captureConn := &openAIWSCaptureConn{
+		events: [][]byte{
+			[]byte(`{"type":"response.completed","response":{"id":"resp_model_ok","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+		},
+	}
+	captureDialer := &openAIWSCaptureDialer{conn: captureConn}
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(captureDialer)
+	svc := &OpenAIGatewayService{
+		cfg:              cfg,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     pool,
+	}
+	account := &Account{
+		ID:          142,
+		Name:        "openai-ingress-http-only-model",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{
+			"api_key": "sk-test",
+		},
+		Extra: map[string]any{
+			"responses_websockets_v2_enabled": true,
+		},
+	}
+
+	serverErrCh := make(chan error, 1)
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := coderws.Accept(w, r, &coderws.AcceptOptions{
+			CompressionMode: coderws.CompressionContextTakeover,
+		})
+		if err != nil {
+			serverErrCh <- err
+			return
+		}
+		defer func() {
+			_ = conn.CloseNow()
+		}()
+
+		rec := httptest.NewRecorder()
+		ginCtx, _ := gin.CreateTestContext(rec)
+		req := r.Clone(r.Context())
+		req.Header = req.Header.Clone()
+		req.Header.Set("User-Agent", "unit-test-agent/1.0")
+		ginCtx.Request = req
+
+		readCtx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		_, firstMessage, readErr := conn.Read(readCtx)
+		cancel()
+		if readErr != nil {
+			serverErrCh <- readErr
+			return
+		}
+		serverErrCh <- svc.ProxyResponsesWebSocketFromClient(r.Context(), ginCtx, conn, account, "sk-test", firstMessage, nil)
+	}))
+	defer wsServer.Close()
+
+	dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+	clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http"), nil)
+	cancelDial()
+	require.NoError(t, err)
+	defer func() {
+		_ = clientConn.CloseNow()
+	}()
+
+	writeMessage := func(payload string) {
+		writeCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		require.NoError(t, clientConn.Write(writeCtx, coderws.MessageText, []byte(payload)))
+	}
+
+	// 首轮使用允许 WS 的模型正常完成；后续切换到仅 HTTP 模型时关闭会话。
+	writeMessage(`{"type":"response.create","model":"gpt-5.1","stream":false}`)
+	readCtx, cancelRead := context.WithTimeout(context.Background(), 3*time.Second)
+	_, event, readErr := clientConn.Read(readCtx)
+	cancelRead()
+	require.NoError(t, readErr)
+	require.Equal(t, "resp_model_ok", gjson.GetBytes(event, "response.id").String())
+
+	writeMessage(`{"type":"response.create","model":"gpt-image-1","stream":false}`)
+
+	select {
+	case serverErr := <-serverErrCh:
+		var closeErr *OpenAIWSClientCloseError
+		require.ErrorAs(t, serverErr, &closeErr)
+		require.Equal(t, coderws.StatusPolicyViolation, closeErr.StatusCode())
+		require.Equal(t, "model_requires_http", closeErr.ErrorCode())
+		require.Contains(t, closeErr.Reason(), "only available over HTTP")
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待 ingress websocket 结束超时")
+	}
+	require.Len(t, captureConn.writes, 1, "仅 HTTP 模型的 turn 不应发往上游 websocket")
+
+	// 策略关闭属于异常结束，会话级指标仍需记录。
+	sessionMetrics := svc.SnapshotOpenAIWSIngressSessionMetrics()
+	require.Equal(t, int64(1), sessionMetrics.ClosedTotal)
+	require.Equal(t, int64(1), sessionMetrics.AbnormalClosedTotal)
+	require.Equal(t, int64(1), sessionMetrics.Turns.Count)
+	require.Equal(t, int64(1), sessionMetrics.Turns.Sum)
+	require.Equal(t, int64(1), sessionMetrics.DurationSeconds.Count)
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_ReplayInputTooLargeClosesTurn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := newOpenAIWSIngressCaptureTestConfig()
+	cfg.Gateway.OpenAIWS.MaxReplayInputBytes = 256 * 1024
+
+	captureConn := &openAIWSCaptureConn{
+		events: [][]byte{
+			[]byte(`{"type":"response.completed","response":{"id":"resp_large_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+		},
+	}
+	captureDialer := &openAIWSCaptureDialer{conn: captureConn}
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(captureDialer)
+	svc := &OpenAIGatewayService{
+		cfg:              cfg,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     pool,
+	}
+	account := &Account{
+		ID:          144,
+		Name:        "openai-ingress-large-input",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{
+			"api_key": "sk-test",
+		},
+		Extra: map[string]any{
+			"responses_websockets_v2_enabled": true,
+		},
+	}
+
+	serverErrCh := make(chan error, 1)
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := coderws.Accept(w, r, &coderws.AcceptOptions{
+			CompressionMode: coderws.CompressionContextTakeover,
+		})
+		if err != nil {
+			serverErrCh <- err
+			return
+		}
+		defer func() {
+			_ = conn.CloseNow()
+		}()
+		conn.SetReadLimit(-1)
+
+		rec := httptest.NewRecorder()
+		ginCtx, _ := gin.CreateTestContext(rec)
+		req := r.Clone(r.Context())
+		req.Header = req.Header.Clone()
+		req.Header.Set("User-Agent", "unit-test-agent/1.0")
+		ginCtx.Request = req
+
+		readCtx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		_, firstMessage, readErr := conn.Read(readCtx)
+		cancel()
+		if readErr != nil {
+			serverErrCh <- readErr
+			return
+		}
+		serverErrCh <- svc.ProxyResponsesWebSocketFromClient(r.Context(), ginCtx, conn, account, "sk-test", firstMessage, nil)
+	}))
+	defer wsServer.Close()
+
+	dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+	clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http"), nil)
+	cancelDial()
+	require.NoError(t, err)
+	defer func() {
+		_ = clientConn.CloseNow()
+	}()
+
+	largeText := strings.Repeat("x", 200*1024)
+	writeMessage := func(payload string) {
+		writeCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		require.NoError(t, clientConn.Write(writeCtx, coderws.MessageText, []byte(payload)))
+	}
+
+	// 首轮大 input 仍在上限内正常完成；续链追加后累计超限，本轮不再发往上游。
+	writeMessage(`{"type":"response.create","model":"gpt-5.1","stream":false,"input":[{"type":"input_text","text":"` + largeText + `"}]}`)
+	readCtx, cancelRead := context.WithTimeout(context.Background(), 3*time.Second)
+	_, event, readErr := clientConn.Read(readCtx)
+	cancelRead()
+	require.NoError(t, readErr)
+	require.Equal(t, "resp_large_1", gjson.GetBytes(event, "response.id").String())
+
+	writeMessage(`{"type":"response.create","model":"gpt-5.1","stream":false,"previous_response_id":"resp_large_1","input":[{"type":"input_text","text":"` + strings.Repeat("y", 200*1024) + `"}]}`)
+
+	select {
+	case serverErr := <-serverErrCh:
+		var closeErr *OpenAIWSClientCloseError
+		require.ErrorAs(t, serverErr, &closeErr)
+		require.ErrorIs(t, serverErr, errOpenAIWSReplayInputTooLarge)
+		require.Equal(t, coderws.StatusMessageTooBig, closeErr.StatusCode())
+		require.Equal(t, "replay_input_too_large", closeErr.ErrorCode())
+		require.Contains(t, closeErr.Reason(), "start a new conversation")
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待 ingress websocket 结束超时")
+	}
+	require.Len(t, captureConn.writes, 1, "超限的 turn 不应发往上游 websocket")
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_AppliesAccountRequestRewrite(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := newOpenAIWSIngressCaptureTestConfig()
+	cfg.Gateway.OpenAIWS.AccountRequestRewrites = []config.GatewayOpenAIWSAccountRequestRewrite{{
+		AccountID: 143,
+		Rules: []config.GatewayOpenAIWSRequestRewriteRule{
+			{Op: "set", Path: "service_tier", Value: "priority"},
+			{Op: "remove", Path: "metadata.debug"},
+		},
+	}}
+
+	captureConn := &openAIWSCaptureConn{
+		events: [][]byte{
+			[]byte(`{"type":"response.completed","response":{"id":"resp_rewrite_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+			[]byte(`{"type":"response.completed","response":{"id":"resp_rewrite_2","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+		},
+	}
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(&openAIWSCaptureDialer{conn: captureConn})
+	svc := &OpenAIGatewayService{
+		cfg:              cfg,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     pool,
+	}
+	account := &Account{
+		ID:          143,
+		Name:        "openai-ingress-request-rewrite",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{
+			"api_key": "sk-test",
+		},
+		Extra: map[string]any{
+			"responses_websockets_v2_enabled": true,
+		},
+	}
+
+	serverErrCh := make(chan error, 1)
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := coderws.Accept(w, r, &coderws.AcceptOptions{
+			CompressionMode: coderws.CompressionContextTakeover,
+		})
+		if err != nil {
+			serverErrCh <- err
+			return
+		}
+		defer func() {
+			_ = conn.CloseNow()
+		}()
+
+		rec := httptest.NewRecorder()
+		ginCtx, _ := gin.CreateTestContext(rec)
+		req := r.Clone(r.Context())
+		req.Header = req.Header.Clone()
+		req.Header.Set("User-Agent", "unit-test-agent/1.0")
+		ginCtx.Request = req
+
+		readCtx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		_, firstMessage, readErr := conn.Read(readCtx)
+		cancel()
+		if readErr != nil {
+			serverErrCh <- readErr
+			return
+		}
+		serverErrCh <- svc.ProxyResponsesWebSocketFromClient(r.Context(), ginCtx, conn, account, "sk-test", firstMessage, nil)
+	}))
+	defer wsServer.Close()
+
+	dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+	clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http"), nil)
+	cancelDial()
+	require.NoError(t, err)
+	defer func() {
+		_ = clientConn.CloseNow()
+	}()
+
+	roundTrip := func(payload string, wantResponseID string) {
+		writeCtx, cancelWrite := context.WithTimeout(context.Background(), 3*time.Second)
+		require.NoError(t, clientConn.Write(writeCtx, coderws.MessageText, []byte(payload)))
+		cancelWrite()
+		readCtx, cancelRead := context.WithTimeout(context.Background(), 3*time.Second)
+		_, event, readErr := clientConn.Read(readCtx)
+		cancelRead()
+		require.NoError(t, readErr)
+		require.Equal(t, wantResponseID, gjson.GetBytes(event, "response.id").String())
+	}
+	roundTrip(`{"type":"response.create","model":"gpt-5.1","stream":false,"service_tier":"default","metadata":{"debug":"1","trace":"t"}}`, "resp_rewrite_1")
+	roundTrip(`{"type":"response.create","model":"gpt-5.1","stream":false,"previous_response_id":"resp_rewrite_1"}`, "resp_rewrite_2")
+	require.NoError(t, clientConn.Close(coderws.StatusNormalClosure, "done"))
+
+	select {
+	case serverErr := <-serverErrCh:
+		require.NoError(t, serverErr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待 ingress websocket 结束超时")
+	}
+
+	require.Len(t, captureConn.writes, 2)
+	for i, write := range captureConn.writes {
+		require.Equal(t, "priority", write["service_tier"], "turn %d 应应用账号改写", i+1)
+		metadata, _ := write["metadata"].(map[string]any)
+		require.NotContains(t, metadata, "debug")
+	}
+	require.Equal(t, map[string]any{"trace": "t"}, captureConn.writes[0]["metadata"])
+}
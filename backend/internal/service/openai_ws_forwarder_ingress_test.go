@@ -6,10 +6,13 @@ import (
 	"errors"
 	"io"
 	"net"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/Wei-Shaw/sub2api/internal/config"
 	coderws "github.com/coder/websocket"
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/require"
 	"github.com/tidwall/gjson"
 )
@@ -61,6 +64,123 @@ func TestIsOpenAIWSIngressPreviousResponseNotFound(t *testing.T) {
 	))
 }
 
+func TestValidateOpenAIWSIngressFirstClientMessage(t *testing.T) {
+	require.NoError(t, ValidateOpenAIWSIngressFirstClientMessage([]byte(`{"type":"response.create","model":"gpt-5.1"}`)))
+	require.NoError(t, ValidateOpenAIWSIngressFirstClientMessage([]byte(`{"model":"gpt-5.1"}`)), "缺省 type 视为 response.create")
+
+	cases := map[string]string{
+		"":                                       "empty first message",
+		"not-json":                               "not valid JSON",
+		`"response.create"`:                      "must be a JSON object",
+		`{}`:                                     "model is required",
+		`{"type":"response.append","model":"x"}`: "response.append is not supported",
+		`{"type":"session.update","model":"x"}`:  "got type: session.update",
+	}
+	for payload, wantReason := range cases {
+		err := ValidateOpenAIWSIngressFirstClientMessage([]byte(payload))
+		require.Error(t, err, payload)
+		var closeErr *OpenAIWSClientCloseError
+		require.ErrorAs(t, err, &closeErr)
+		require.Equal(t, coderws.StatusPolicyViolation, closeErr.StatusCode())
+		require.Contains(t, closeErr.Reason(), wantReason)
+	}
+}
+
+func TestOpenAIGatewayService_ValidateOpenAIWSIngressSessionIdentity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{}
+	svc := &OpenAIGatewayService{cfg: cfg}
+	newCtx := func(header, value string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/v1/responses", nil)
+		if header != "" {
+			c.Request.Header.Set(header, value)
+		}
+		return c
+	}
+	anonymous := []byte(`{"type":"response.create","model":"gpt-5.1","input":[{"role":"user","content":"hi"}]}`)
+
+	require.NoError(t, svc.ValidateOpenAIWSIngressSessionIdentity(newCtx("", ""), anonymous), "默认宽松模式允许匿名会话")
+
+	cfg.Gateway.OpenAIWS.IngressRequireSessionID = true
+	err := svc.ValidateOpenAIWSIngressSessionIdentity(newCtx("", ""), anonymous)
+	require.Error(t, err)
+	var closeErr *OpenAIWSClientCloseError
+	require.ErrorAs(t, err, &closeErr)
+	require.Equal(t, coderws.StatusPolicyViolation, closeErr.StatusCode())
+	require.Equal(t, "session_id_required", closeErr.ErrorCode())
+	require.Contains(t, closeErr.Reason(), "session identifier required")
+	require.LessOrEqual(t, len(closeErr.Reason()), 123, "close reason 不能超过 WebSocket 控制帧上限")
+
+	require.Error(t, svc.ValidateOpenAIWSIngressSessionIdentity(newCtx("session_id", "  "), anonymous), "空白标识视为缺失")
+	require.NoError(t, svc.ValidateOpenAIWSIngressSessionIdentity(newCtx("session_id", "sess_1"), anonymous))
+	require.NoError(t, svc.ValidateOpenAIWSIngressSessionIdentity(newCtx("conversation_id", "conv_1"), anonymous))
+	require.NoError(t, svc.ValidateOpenAIWSIngressSessionIdentity(newCtx("", ""), []byte(`{"type":"response.create","model":"gpt-5.1","prompt_cache_key":"pck_1"}`)))
+}
+
+func TestBuildOpenAIWSClientCloseErrorEvent(t *testing.T) {
+	t.Parallel()
+
+	policyErr := NewOpenAIWSClientCloseError(coderws.StatusPolicyViolation, "model is required", nil)
+	var closeErr *OpenAIWSClientCloseError
+	require.ErrorAs(t, policyErr, &closeErr)
+	require.Equal(t, "invalid_request", closeErr.ErrorCode())
+
+	event := BuildOpenAIWSClientCloseErrorEvent(closeErr.StatusCode(), closeErr.Reason(), closeErr.ErrorCode())
+	require.True(t, json.Valid(event))
+	require.Equal(t, "error", gjson.GetBytes(event, "type").String())
+	require.Equal(t, "invalid_request_error", gjson.GetBytes(event, "error.type").String())
+	require.Equal(t, "invalid_request", gjson.GetBytes(event, "error.code").String())
+	require.Equal(t, "model is required", gjson.GetBytes(event, "error.message").String())
+	require.False(t, gjson.GetBytes(event, "error.retryable").Bool())
+	require.False(t, gjson.GetBytes(event, "error.retry_after").Exists())
+
+	busyErr := NewOpenAIWSClientCloseErrorWithCode(coderws.StatusTryAgainLater, "account is busy", "account_busy", nil)
+	require.ErrorAs(t, busyErr, &closeErr)
+	require.Equal(t, "account_busy", closeErr.ErrorCode())
+	event = BuildOpenAIWSClientCloseErrorEvent(closeErr.StatusCode(), closeErr.Reason(), closeErr.ErrorCode())
+	require.Equal(t, "server_error", gjson.GetBytes(event, "error.type").String())
+	require.Equal(t, "account_busy", gjson.GetBytes(event, "error.code").String())
+	require.True(t, gjson.GetBytes(event, "error.retryable").Bool())
+	require.Equal(t, int64(openAIWSClientCloseRetryAfterSeconds), gjson.GetBytes(event, "error.retry_after").Int())
+
+	event = BuildOpenAIWSClientCloseErrorEvent(coderws.StatusInternalError, "upstream failed", "")
+	require.Equal(t, "internal_error", gjson.GetBytes(event, "error.code").String())
+	require.True(t, gjson.GetBytes(event, "error.retryable").Bool())
+	require.False(t, gjson.GetBytes(event, "error.retry_after").Exists())
+}
+
+func TestBuildOpenAIWSIngressCapabilitiesEvent(t *testing.T) {
+	t.Parallel()
+
+	var nilService *OpenAIGatewayService
+	event := nilService.BuildOpenAIWSIngressCapabilitiesEvent(1024, 30*time.Second)
+	require.True(t, json.Valid(event))
+	require.Equal(t, "gateway.capabilities", gjson.GetBytes(event, "type").String())
+	require.True(t, gjson.GetBytes(event, "features.binary_messages").Bool())
+	require.False(t, gjson.GetBytes(event, "features.cancel").Bool())
+	require.False(t, gjson.GetBytes(event, "features.multiplexing").Bool())
+	require.False(t, gjson.GetBytes(event, "features.client_ping").Bool())
+	require.False(t, gjson.GetBytes(event, "features.stream_heartbeat").Bool())
+	require.Equal(t, openAIWSStreamConsistencyPolicyOff, gjson.GetBytes(event, "features.stream_consistency_policy").String())
+	require.Equal(t, int64(1024), gjson.GetBytes(event, "limits.max_message_bytes").Int())
+	require.Equal(t, int64(30000), gjson.GetBytes(event, "limits.first_message_timeout_ms").Int())
+	require.False(t, gjson.GetBytes(event, "limits.stream_heartbeat_interval_ms").Exists())
+
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.IngressClientPingEnabled = true
+	cfg.Gateway.OpenAIWS.ClientCloseErrorEventEnabled = true
+	cfg.Gateway.OpenAIWS.IngressStreamHeartbeatIntervalMS = 15000
+	cfg.Gateway.OpenAIWS.IngressStreamConsistencyPolicy = openAIWSStreamConsistencyPolicyReject
+	svc := &OpenAIGatewayService{cfg: cfg}
+	event = svc.BuildOpenAIWSIngressCapabilitiesEvent(2048, time.Second)
+	require.True(t, gjson.GetBytes(event, "features.client_ping").Bool())
+	require.True(t, gjson.GetBytes(event, "features.close_error_event").Bool())
+	require.True(t, gjson.GetBytes(event, "features.stream_heartbeat").Bool())
+	require.Equal(t, openAIWSStreamConsistencyPolicyReject, gjson.GetBytes(event, "features.stream_consistency_policy").String())
+	require.Equal(t, int64(15000), gjson.GetBytes(event, "limits.stream_heartbeat_interval_ms").Int())
+}
+
 func TestOpenAIWSIngressPreviousResponseRecoveryEnabled(t *testing.T) {
 	t.Parallel()
 
@@ -636,6 +756,8 @@ func TestBuildOpenAIWSReplayInputSequence(t *testing.T) {
 			true,
 			[]byte(`{"input":[{"type":"input_text","text":"new"}]}`),
 			false,
+			0,
+			openAIWSReplayInputRules{},
 		)
 		require.NoError(t, err)
 		require.True(t, exists)
@@ -649,6 +771,8 @@ func TestBuildOpenAIWSReplayInputSequence(t *testing.T) {
 			true,
 			[]byte(`{"previous_response_id":"resp_1","input":[{"type":"input_text","text":"world"}]}`),
 			true,
+			0,
+			openAIWSReplayInputRules{},
 		)
 		require.NoError(t, err)
 		require.True(t, exists)
@@ -663,6 +787,8 @@ func TestBuildOpenAIWSReplayInputSequence(t *testing.T) {
 			true,
 			[]byte(`{"previous_response_id":"resp_1","input":[{"type":"input_text","text":"hello"},{"type":"input_text","text":"world"}]}`),
 			true,
+			0,
+			openAIWSReplayInputRules{},
 		)
 		require.NoError(t, err)
 		require.True(t, exists)
@@ -670,6 +796,33 @@ func TestBuildOpenAIWSReplayInputSequence(t *testing.T) {
 		require.Equal(t, "hello", gjson.GetBytes(items[0], "text").String())
 		require.Equal(t, "world", gjson.GetBytes(items[1], "text").String())
 	})
+
+	t.Run("exceeds_max_bytes", func(t *testing.T) {
+		maxBytes := len(lastFull[0]) + 8
+		items, exists, err := buildOpenAIWSReplayInputSequence(
+			lastFull,
+			true,
+			[]byte(`{"previous_response_id":"resp_1","input":[{"type":"input_text","text":"world"}]}`),
+			true,
+			maxBytes,
+			openAIWSReplayInputRules{},
+		)
+		require.ErrorIs(t, err, errOpenAIWSReplayInputTooLarge)
+		require.False(t, exists)
+		require.Nil(t, items)
+
+		items, exists, err = buildOpenAIWSReplayInputSequence(
+			lastFull,
+			true,
+			[]byte(`{"previous_response_id":"resp_1"}`),
+			true,
+			maxBytes,
+			openAIWSReplayInputRules{},
+		)
+		require.NoError(t, err)
+		require.True(t, exists)
+		require.Len(t, items, 1)
+	})
 }
 
 func TestSetOpenAIWSPayloadInputSequence(t *testing.T) {
@@ -458,6 +458,77 @@ func TestOpenAIGatewayService_Forward_WSv2_OAuthStoreFalseByDefault(t *testing.T
 	require.Equal(t, "conv-oauth-1", captureDialer.lastHeaders.Get("conversation_id"))
 }
 
+func TestOpenAIGatewayService_Forward_WSv2_ForwardsAllowlistedClientHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/openai/v1/responses", nil)
+	c.Request.Header.Set("User-Agent", "codex_cli_rs/0.98.0")
+	c.Request.Header.Set("X-Client-Beta", "responses_websockets=2026-02-06,custom=1")
+	c.Request.Header.Set("X-Client-Trace", "trace-1")
+	c.Request.Header.Set("X-Not-Allowlisted", "secret")
+
+	cfg := &config.Config{}
+	cfg.Security.URLAllowlist.Enabled = false
+	cfg.Security.URLAllowlist.AllowInsecureHTTP = true
+	cfg.Gateway.OpenAIWS.Enabled = true
+	cfg.Gateway.OpenAIWS.OAuthEnabled = true
+	cfg.Gateway.OpenAIWS.APIKeyEnabled = true
+	cfg.Gateway.OpenAIWS.ResponsesWebsocketsV2 = true
+	cfg.Gateway.OpenAIWS.MaxConnsPerAccount = 1
+	cfg.Gateway.OpenAIWS.MinIdlePerAccount = 0
+	cfg.Gateway.OpenAIWS.MaxIdlePerAccount = 1
+	cfg.Gateway.OpenAIWS.ForwardClientHeaders = map[string]string{
+		"x-client-beta":  "OpenAI-Beta",
+		"x-client-trace": "",
+	}
+
+	captureConn := &openAIWSCaptureConn{
+		events: [][]byte{
+			[]byte(`{"type":"response.completed","response":{"id":"resp_fwd_headers_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+		},
+	}
+	captureDialer := &openAIWSCaptureDialer{conn: captureConn}
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(captureDialer)
+
+	svc := &OpenAIGatewayService{
+		cfg:              cfg,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     pool,
+	}
+	account := &Account{
+		ID:          31,
+		Name:        "openai-ws-forward-headers",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{
+			"api_key": "sk-test",
+		},
+		Extra: map[string]any{
+			"responses_websockets_v2_enabled": true,
+		},
+	}
+
+	body := []byte(`{"model":"gpt-5.1","stream":false,"input":[{"type":"input_text","text":"hello"}]}`)
+	result, err := svc.Forward(context.Background(), c, account, body)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+
+	require.Equal(t, "responses_websockets=2026-02-06,custom=1", captureDialer.lastHeaders.Get("OpenAI-Beta"), "白名单映射应覆盖内置 OpenAI-Beta")
+	require.Equal(t, "trace-1", captureDialer.lastHeaders.Get("X-Client-Trace"), "目标为空时按同名转发")
+	require.Empty(t, captureDialer.lastHeaders.Get("X-Client-Beta"), "重命名后不应保留源头名")
+	require.Empty(t, captureDialer.lastHeaders.Get("X-Not-Allowlisted"), "白名单外的客户端头不应转发")
+	require.Equal(t, "Bearer sk-test", captureDialer.lastHeaders.Get("authorization"))
+}
+
 func TestOpenAIGatewayService_Forward_WSv2_OAuthOriginatorCompatibility(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -1263,6 +1334,167 @@ func TestOpenAIGatewayService_Forward_WSv2ReadTimeoutAppliesPerRead(t *testing.T
 	require.Nil(t, upstream.lastReq, "每次 Read 都应独立应用超时；总时长超过 read_timeout 不应误回退 HTTP")
 }
 
+func TestOpenAIGatewayService_Forward_WSv2_ForceDedicatedAllDialsFreshConnPerTurn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{}
+	cfg.Security.URLAllowlist.Enabled = false
+	cfg.Security.URLAllowlist.AllowInsecureHTTP = true
+	cfg.Gateway.OpenAIWS.Enabled = true
+	cfg.Gateway.OpenAIWS.OAuthEnabled = true
+	cfg.Gateway.OpenAIWS.APIKeyEnabled = true
+	cfg.Gateway.OpenAIWS.ResponsesWebsocketsV2 = true
+	cfg.Gateway.OpenAIWS.ForceDedicatedAll = true
+	cfg.Gateway.OpenAIWS.MaxConnsPerAccount = 1
+	cfg.Gateway.OpenAIWS.MinIdlePerAccount = 0
+	cfg.Gateway.OpenAIWS.MaxIdlePerAccount = 1
+
+	upstreamConn1 := &openAIWSCaptureConn{
+		events: [][]byte{
+			[]byte(`{"type":"response.completed","response":{"id":"resp_force_dedicated_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+		},
+	}
+	upstreamConn2 := &openAIWSCaptureConn{
+		events: [][]byte{
+			[]byte(`{"type":"response.completed","response":{"id":"resp_force_dedicated_2","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+		},
+	}
+	dialer := &openAIWSQueueDialer{conns: []openAIWSClientConn{upstreamConn1, upstreamConn2}}
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(dialer)
+
+	svc := &OpenAIGatewayService{
+		cfg:              cfg,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     pool,
+	}
+
+	account := &Account{
+		ID:          136,
+		Name:        "openai-force-dedicated",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{
+			"api_key": "sk-test",
+		},
+		Extra: map[string]any{
+			"responses_websockets_v2_enabled": true,
+		},
+	}
+
+	body := []byte(`{"model":"gpt-5.1","stream":false,"input":[{"type":"input_text","text":"hello"}]}`)
+	for i, expectedID := range []string{"resp_force_dedicated_1", "resp_force_dedicated_2"} {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = httptest.NewRequest(http.MethodPost, "/openai/v1/responses", nil)
+		c.Request.Header.Set("session_id", "session-force-dedicated")
+		result, err := svc.Forward(context.Background(), c, account, body)
+		require.NoError(t, err)
+		require.NotNil(t, result)
+		require.Equal(t, expectedID, result.RequestID)
+		require.Equal(t, OpenAIWSIngressModeDedicated, result.OpenAIWSConnMode)
+		require.Equal(t, i+1, dialer.DialCount(), "force_dedicated_all 下每轮都应新建上游连接")
+	}
+
+	upstreamConn1.mu.Lock()
+	closed := upstreamConn1.closed
+	upstreamConn1.mu.Unlock()
+	require.True(t, closed, "force_dedicated_all 下每轮结束后应关闭连接")
+	_, _, conns := pool.AccountPoolLoad(account.ID)
+	require.Zero(t, conns, "force_dedicated_all 下连接不应留在池中复用")
+}
+
+func TestOpenAIGatewayService_Forward_WSv2_MalformedUpstreamEventPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newService := func(policy string, events [][]byte) (*OpenAIGatewayService, *Account) {
+		cfg := &config.Config{}
+		cfg.Security.URLAllowlist.Enabled = false
+		cfg.Security.URLAllowlist.AllowInsecureHTTP = true
+		cfg.Gateway.OpenAIWS.Enabled = true
+		cfg.Gateway.OpenAIWS.OAuthEnabled = true
+		cfg.Gateway.OpenAIWS.APIKeyEnabled = true
+		cfg.Gateway.OpenAIWS.ResponsesWebsocketsV2 = true
+		cfg.Gateway.OpenAIWS.MalformedUpstreamEventPolicy = policy
+		cfg.Gateway.OpenAIWS.MaxConnsPerAccount = 1
+		cfg.Gateway.OpenAIWS.MinIdlePerAccount = 0
+		cfg.Gateway.OpenAIWS.MaxIdlePerAccount = 1
+
+		pool := newOpenAIWSConnPool(cfg)
+		pool.setClientDialerForTest(&openAIWSQueueDialer{conns: []openAIWSClientConn{&openAIWSCaptureConn{events: events}}})
+		svc := &OpenAIGatewayService{
+			cfg:              cfg,
+			httpUpstream:     &httpUpstreamRecorder{},
+			cache:            &stubGatewayCache{},
+			openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+			toolCorrector:    NewCodexToolCorrector(),
+			openaiWSPool:     pool,
+		}
+		account := &Account{
+			ID:          137,
+			Name:        "openai-malformed-event",
+			Platform:    PlatformOpenAI,
+			Type:        AccountTypeAPIKey,
+			Status:      StatusActive,
+			Schedulable: true,
+			Concurrency: 1,
+			Credentials: map[string]any{
+				"api_key": "sk-test",
+			},
+			Extra: map[string]any{
+				"responses_websockets_v2_enabled": true,
+			},
+		}
+		return svc, account
+	}
+	events := [][]byte{
+		[]byte(`{"type":"response.created","response":{"id":"resp_malformed_1","model":"gpt-5.1"}}`),
+		[]byte(`{"sequence":1,"note":"unknown_shape"}`),
+		[]byte(`{"type":"response.output_text.delta","delta":"tr`),
+		[]byte(`{"type":"response.output_text.delta","delta":"ok"}`),
+		[]byte(`{"type":"response.completed","response":{"id":"resp_malformed_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+	}
+	body := []byte(`{"model":"gpt-5.1","stream":true,"input":[{"type":"input_text","text":"hello"}]}`)
+
+	t.Run("drop", func(t *testing.T) {
+		svc, account := newService("drop", events)
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = httptest.NewRequest(http.MethodPost, "/openai/v1/responses", nil)
+
+		result, err := svc.Forward(context.Background(), c, account, body)
+		require.NoError(t, err)
+		require.NotNil(t, result)
+		require.Equal(t, "resp_malformed_1", result.RequestID)
+		require.Contains(t, rec.Body.String(), `data: {"sequence":1,"note":"unknown_shape"}`, "结构未知的合法 JSON 帧应原样透传")
+		require.NotContains(t, rec.Body.String(), `"delta":"tr`, "非法 JSON 帧不应转发给客户端")
+		require.Contains(t, rec.Body.String(), `"delta":"ok"`)
+		require.Equal(t, int64(1), svc.SnapshotOpenAIWSPerformanceMetrics().Relay.MalformedUpstreamEventTotal)
+	})
+
+	t.Run("terminate", func(t *testing.T) {
+		svc, account := newService("terminate", events)
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = httptest.NewRequest(http.MethodPost, "/openai/v1/responses", nil)
+
+		result, err := svc.Forward(context.Background(), c, account, body)
+		require.Error(t, err)
+		require.Nil(t, result)
+		require.ErrorIs(t, err, errOpenAIWSMalformedUpstreamEvent)
+		require.NotContains(t, rec.Body.String(), `"delta":"ok"`, "terminate 策略下不应继续转发后续事件")
+		require.Equal(t, int64(1), svc.SnapshotOpenAIWSRelayMetrics().MalformedUpstreamEventTotal)
+		_, _, conns := svc.getOpenAIWSConnPool().AccountPoolLoad(account.ID)
+		require.Zero(t, conns, "terminate 策略下上游连接应被废弃")
+	})
+}
+
 type openAIWSCaptureDialer struct {
 	mu          sync.Mutex
 	conn        *openAIWSCaptureConn
@@ -1397,3 +1629,119 @@ func cloneMapStringAny(src map[string]any) map[string]any {
 	}
 	return dst
 }
+
+func TestOpenAIGatewayService_Forward_WSv2_HTTPOnlyModelRouting(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var wsDials atomic.Int32
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsDials.Add(1)
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		_ = conn.Close()
+	}))
+	defer wsServer.Close()
+
+	cfg := &config.Config{}
+	cfg.Security.URLAllowlist.Enabled = false
+	cfg.Security.URLAllowlist.AllowInsecureHTTP = true
+	cfg.Gateway.OpenAIWS.Enabled = true
+	cfg.Gateway.OpenAIWS.APIKeyEnabled = true
+	cfg.Gateway.OpenAIWS.ResponsesWebsocketsV2 = true
+	cfg.Gateway.OpenAIWS.MaxConnsPerAccount = 2
+	cfg.Gateway.OpenAIWS.QueueLimitPerConn = 8
+	cfg.Gateway.OpenAIWS.DialTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.ReadTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.WriteTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.ModelTransports = []config.GatewayOpenAIWSModelTransport{{Model: "gpt-image-*", Transport: "http"}}
+
+	account := &Account{
+		ID:          19,
+		Name:        "openai-ws-http-only-model",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 2,
+		Credentials: map[string]any{
+			"api_key":  "sk-test",
+			"base_url": wsServer.URL,
+		},
+		Extra: map[string]any{
+			"responses_websockets_v2_enabled": true,
+		},
+	}
+	newService := func(upstream *httpUpstreamRecorder) *OpenAIGatewayService {
+		return &OpenAIGatewayService{
+			cfg:              cfg,
+			httpUpstream:     upstream,
+			cache:            &stubGatewayCache{},
+			openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+			toolCorrector:    NewCodexToolCorrector(),
+		}
+	}
+	newContext := func() (*gin.Context, *httptest.ResponseRecorder) {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = httptest.NewRequest(http.MethodPost, "/openai/v1/responses", nil)
+		c.Request.Header.Set("User-Agent", "unit-test-agent/1.0")
+		return c, rec
+	}
+	body := []byte(`{"model":"gpt-image-1","stream":false,"input":[{"type":"input_text","text":"draw"}]}`)
+
+	t.Run("downgrade routes over http", func(t *testing.T) {
+		upstream := &httpUpstreamRecorder{
+			resp: &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"usage":{"input_tokens":1,"output_tokens":1}}`)),
+			},
+		}
+		c, _ := newContext()
+		result, err := newService(upstream).Forward(context.Background(), c, account, body)
+		require.NoError(t, err)
+		require.NotNil(t, result)
+		require.False(t, result.OpenAIWSMode)
+		require.NotNil(t, upstream.lastReq, "仅 HTTP 模型应走 HTTP 上游")
+		require.Zero(t, wsDials.Load())
+		transport, _ := c.Get("openai_ws_transport_decision")
+		require.Equal(t, string(OpenAIUpstreamTransportHTTPSSE), transport)
+		reason, _ := c.Get("openai_ws_transport_reason")
+		require.Equal(t, openAIWSModelHTTPOnlyReason, reason)
+	})
+
+	t.Run("reject policy refuses request", func(t *testing.T) {
+		cfg.Gateway.OpenAIWS.ModelTransportPolicy = "reject"
+		defer func() { cfg.Gateway.OpenAIWS.ModelTransportPolicy = "" }()
+		upstream := &httpUpstreamRecorder{}
+		c, rec := newContext()
+		result, err := newService(upstream).Forward(context.Background(), c, account, body)
+		require.Error(t, err)
+		require.Nil(t, result)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		require.Contains(t, gjson.GetBytes(rec.Body.Bytes(), "error.message").String(), "only available over HTTP")
+		require.Nil(t, upstream.lastReq)
+	})
+
+	t.Run("reject policy keeps http clients on http", func(t *testing.T) {
+		cfg.Gateway.OpenAIWS.ModelTransportPolicy = "reject"
+		defer func() { cfg.Gateway.OpenAIWS.ModelTransportPolicy = "" }()
+		upstream := &httpUpstreamRecorder{
+			resp: &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"usage":{"input_tokens":1,"output_tokens":1}}`)),
+			},
+		}
+		c, _ := newContext()
+		SetOpenAIClientTransport(c, OpenAIClientTransportHTTP)
+		_, err := newService(upstream).Forward(context.Background(), c, account, body)
+		require.NoError(t, err)
+		require.NotNil(t, upstream.lastReq)
+	})
+
+	require.Zero(t, wsDials.Load(), "仅 HTTP 模型不应建立上游 websocket")
+}
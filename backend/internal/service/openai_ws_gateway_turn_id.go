@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/ctxkey"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// openAIWSGatewayTurnIDField 开启 inject_gateway_turn_id 后注入到下发事件顶层的字段名。
+const openAIWSGatewayTurnIDField = "gateway_turn_id"
+
+func (s *OpenAIGatewayService) openAIWSInjectGatewayTurnIDEnabled() bool {
+	if s == nil || s.cfg == nil {
+		return false
+	}
+	return s.openAIWSConfig().InjectGatewayTurnID
+}
+
+// openAIWSGatewayTurnIDBase 返回 gateway_turn_id 的请求前缀：优先使用服务端请求 ID，与网关访问日志一致；
+// 上下文中没有请求 ID 时生成进程内唯一 ID。
+func openAIWSGatewayTurnIDBase(ctx context.Context) string {
+	if ctx != nil {
+		if requestID, _ := ctx.Value(ctxkey.RequestID).(string); strings.TrimSpace(requestID) != "" {
+			return strings.TrimSpace(requestID)
+		}
+	}
+	return generateRequestID()
+}
+
+// openAIWSGatewayTurnID 返回 turn 的网关侧标识；同一 turn 的重试与恢复保持同一个值。
+func openAIWSGatewayTurnID(base string, turn int) string {
+	return base + "-" + strconv.Itoa(turn)
+}
+
+// openAIWSEventCarriesGatewayTurnID 只在 response 生命周期事件与 error 事件上注入，避免逐个 delta 改写事件。
+func openAIWSEventCarriesGatewayTurnID(eventType string) bool {
+	switch eventType {
+	case "response.created", "response.in_progress", "response.completed", "response.done",
+		"response.failed", "response.incomplete", "response.cancelled", "error":
+		return true
+	default:
+		return false
+	}
+}
+
+// injectOpenAIWSGatewayTurnID 在事件顶层写入 gateway_turn_id；上游 response.id 等字段保持原样。
+func injectOpenAIWSGatewayTurnID(message []byte, eventType, turnID string) []byte {
+	if len(message) == 0 || turnID == "" || !openAIWSEventCarriesGatewayTurnID(eventType) {
+		return message
+	}
+	if !gjson.ValidBytes(message) {
+		return message
+	}
+	updated, err := sjson.SetBytes(message, openAIWSGatewayTurnIDField, turnID)
+	if err != nil {
+		return message
+	}
+	return updated
+}
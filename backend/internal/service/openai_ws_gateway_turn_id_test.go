@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/ctxkey"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestInjectOpenAIWSGatewayTurnID(t *testing.T) {
+	completed := []byte(`{"type":"response.completed","response":{"id":"resp_upstream_1"}}`)
+	out := injectOpenAIWSGatewayTurnID(completed, "response.completed", "req-1-2")
+	require.Equal(t, "req-1-2", gjson.GetBytes(out, openAIWSGatewayTurnIDField).String())
+	require.Equal(t, "resp_upstream_1", gjson.GetBytes(out, "response.id").String(), "上游 response.id 应原样保留")
+
+	delta := []byte(`{"type":"response.output_text.delta","delta":"hi"}`)
+	require.Equal(t, delta, injectOpenAIWSGatewayTurnID(delta, "response.output_text.delta", "req-1-2"), "delta 事件不注入")
+	require.Equal(t, completed, injectOpenAIWSGatewayTurnID(completed, "response.completed", ""))
+
+	ctx := context.WithValue(context.Background(), ctxkey.RequestID, "req-abc")
+	require.Equal(t, "req-abc-3", openAIWSGatewayTurnID(openAIWSGatewayTurnIDBase(ctx), 3))
+	require.NotEmpty(t, openAIWSGatewayTurnIDBase(context.Background()))
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_InjectGatewayTurnID(t *testing.T) {
+	run := func(t *testing.T, inject bool) [][]byte {
+		cfg := newOpenAIWSIngressCaptureTestConfig()
+		cfg.Gateway.OpenAIWS.InjectGatewayTurnID = inject
+		upstream := &openAIWSCaptureConn{
+			events: [][]byte{
+				[]byte(`{"type":"response.created","response":{"id":"resp_turn_1","model":"gpt-5.1"}}`),
+				[]byte(`{"type":"response.output_text.delta","delta":"hi"}`),
+				[]byte(`{"type":"response.completed","response":{"id":"resp_turn_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+				[]byte(`{"type":"response.completed","response":{"id":"resp_turn_2","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+			},
+		}
+		pool := newOpenAIWSConnPool(cfg)
+		pool.setClientDialerForTest(&openAIWSQueueDialer{conns: []openAIWSClientConn{upstream}})
+		svc := &OpenAIGatewayService{
+			cfg:              cfg,
+			httpUpstream:     &httpUpstreamRecorder{},
+			cache:            &stubGatewayCache{},
+			openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+			toolCorrector:    NewCodexToolCorrector(),
+			openaiWSPool:     pool,
+		}
+		account := &Account{
+			ID:          143,
+			Name:        "openai-ingress-gateway-turn-id",
+			Platform:    PlatformOpenAI,
+			Type:        AccountTypeAPIKey,
+			Status:      StatusActive,
+			Schedulable: true,
+			Concurrency: 1,
+			Credentials: map[string]any{"api_key": "sk-gateway-turn-id"},
+			Extra:       map[string]any{"responses_websockets_v2_enabled": true},
+		}
+		clientMessages := [][]byte{
+			[]byte(`{"type":"response.create","model":"gpt-5.1","stream":true,"store":false,"input":[{"type":"input_text","text":"hello"}]}`),
+			[]byte(`{"type":"response.create","model":"gpt-5.1","stream":true,"store":false,"input":[{"type":"input_text","text":"again"}]}`),
+		}
+		return runOpenAIWSIngressSessionWithServiceForTest(t, svc, account, "sk-gateway-turn-id", clientMessages, nil)
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		received := run(t, false)
+		require.Len(t, received, 4)
+		for _, event := range received {
+			require.False(t, gjson.GetBytes(event, openAIWSGatewayTurnIDField).Exists())
+		}
+		require.Equal(t, "resp_turn_1", gjson.GetBytes(received[2], "response.id").String())
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		received := run(t, true)
+		require.Len(t, received, 4)
+		require.Equal(t, "resp_turn_1", gjson.GetBytes(received[0], "response.id").String(), "store=false 下上游 response.id 仍原样透传")
+		require.Equal(t, "resp_turn_1", gjson.GetBytes(received[2], "response.id").String())
+		require.Equal(t, "resp_turn_2", gjson.GetBytes(received[3], "response.id").String())
+
+		firstTurnID := gjson.GetBytes(received[0], openAIWSGatewayTurnIDField).String()
+		require.True(t, strings.HasSuffix(firstTurnID, "-1"), "turn id=%s", firstTurnID)
+		require.Equal(t, firstTurnID, gjson.GetBytes(received[2], openAIWSGatewayTurnIDField).String(), "同一 turn 的事件取值相同")
+		require.False(t, gjson.GetBytes(received[1], openAIWSGatewayTurnIDField).Exists(), "delta 事件不注入")
+
+		secondTurnID := gjson.GetBytes(received[3], openAIWSGatewayTurnIDField).String()
+		require.Equal(t, strings.TrimSuffix(firstTurnID, "-1")+"-2", secondTurnID, "同一会话的 turn 共享请求前缀")
+	})
+}
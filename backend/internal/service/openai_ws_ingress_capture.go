@@ -0,0 +1,366 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	OpenAIWSIngressCaptureDirectionClient   = "client"
+	OpenAIWSIngressCaptureDirectionUpstream = "upstream"
+
+	openAIWSIngressCaptureVersion   = 1
+	openAIWSIngressCaptureMaxEvents = 20000
+	openAIWSIngressCaptureRedacted  = "***"
+)
+
+// openAIWSIngressCaptureSensitiveKeys 录制落盘前需要脱敏的 JSON 字段（不区分大小写）。
+// 不包含 code/token 等在上游事件中有业务含义的字段，避免破坏回放语义。
+var openAIWSIngressCaptureSensitiveKeys = map[string]struct{}{
+	"api_key":       {},
+	"apikey":        {},
+	"authorization": {},
+	"access_token":  {},
+	"refresh_token": {},
+	"id_token":      {},
+	"client_secret": {},
+	"password":      {},
+	"secret":        {},
+}
+
+// OpenAIWSIngressSessionRecording 一个 ingress 会话的完整录制：按时间顺序记录客户端消息与上游事件。
+type OpenAIWSIngressSessionRecording struct {
+	Version     int                                   `json:"version"`
+	AccountID   int64                                 `json:"account_id"`
+	AccountType string                                `json:"account_type"`
+	StartedAt   time.Time                             `json:"started_at"`
+	EndedAt     time.Time                             `json:"ended_at"`
+	Truncated   bool                                  `json:"truncated,omitempty"`
+	Events      []OpenAIWSIngressSessionRecordedEvent `json:"events"`
+}
+
+// OpenAIWSIngressSessionRecordedEvent 录制中的单条消息；OffsetMS 为相对会话开始的毫秒偏移。
+type OpenAIWSIngressSessionRecordedEvent struct {
+	Direction string          `json:"direction"`
+	OffsetMS  int64           `json:"offset_ms"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// ClientMessages 返回按顺序录制的客户端消息（含首条消息）。
+func (r *OpenAIWSIngressSessionRecording) ClientMessages() [][]byte {
+	return r.payloadsByDirection(OpenAIWSIngressCaptureDirectionClient)
+}
+
+// UpstreamEvents 返回按顺序录制的上游事件。
+func (r *OpenAIWSIngressSessionRecording) UpstreamEvents() [][]byte {
+	return r.payloadsByDirection(OpenAIWSIngressCaptureDirectionUpstream)
+}
+
+func (r *OpenAIWSIngressSessionRecording) payloadsByDirection(direction string) [][]byte {
+	if r == nil {
+		return nil
+	}
+	out := make([][]byte, 0, len(r.Events))
+	for _, event := range r.Events {
+		if event.Direction == direction {
+			out = append(out, []byte(event.Payload))
+		}
+	}
+	return out
+}
+
+// LoadOpenAIWSIngressSessionRecording 读取 ingress_session_capture_dir 下录制的会话文件。
+func LoadOpenAIWSIngressSessionRecording(path string) (*OpenAIWSIngressSessionRecording, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read ingress session recording: %w", err)
+	}
+	var recording OpenAIWSIngressSessionRecording
+	if err := json.Unmarshal(raw, &recording); err != nil {
+		return nil, fmt.Errorf("decode ingress session recording: %w", err)
+	}
+	if recording.Version != openAIWSIngressCaptureVersion {
+		return nil, fmt.Errorf("unsupported ingress session recording version: %d", recording.Version)
+	}
+	return &recording, nil
+}
+
+// OpenAIWSIngressCaptureStats 内存近期录制缓冲的统计。
+type OpenAIWSIngressCaptureStats struct {
+	Retained     int   `json:"retained"`
+	Capacity     int   `json:"capacity"`
+	DroppedTotal int64 `json:"dropped_total"`
+}
+
+// openAIWSIngressCaptureRing 保存最近的会话录制（已脱敏），容量满时覆盖最旧一条并计数。
+type openAIWSIngressCaptureRing struct {
+	mu      sync.Mutex
+	items   []*OpenAIWSIngressSessionRecording
+	next    int
+	count   int
+	dropped atomic.Int64
+}
+
+func (r *openAIWSIngressCaptureRing) push(recording *OpenAIWSIngressSessionRecording, capacity int) {
+	if r == nil || recording == nil || capacity <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.items) != capacity {
+		r.resizeLocked(capacity)
+	}
+	if r.count == capacity {
+		r.dropped.Add(1)
+	} else {
+		r.count++
+	}
+	r.items[r.next] = recording
+	r.next = (r.next + 1) % capacity
+}
+
+// resizeLocked 按新容量重排缓冲，保留最新的记录，超出部分计入丢弃。
+func (r *openAIWSIngressCaptureRing) resizeLocked(capacity int) {
+	recent := r.recentLocked(r.count)
+	if len(recent) > capacity {
+		r.dropped.Add(int64(len(recent) - capacity))
+		recent = recent[:capacity]
+	}
+	r.items = make([]*OpenAIWSIngressSessionRecording, capacity)
+	r.count = len(recent)
+	for i := range recent {
+		r.items[r.count-1-i] = recent[i]
+	}
+	r.next = r.count % capacity
+}
+
+// recentLocked 返回最新的 n 条记录，按从新到旧排序。
+func (r *openAIWSIngressCaptureRing) recentLocked(n int) []*OpenAIWSIngressSessionRecording {
+	if n > r.count {
+		n = r.count
+	}
+	if n <= 0 {
+		return nil
+	}
+	out := make([]*OpenAIWSIngressSessionRecording, 0, n)
+	size := len(r.items)
+	for i := 1; i <= n; i++ {
+		out = append(out, r.items[(r.next-i+size)%size])
+	}
+	return out
+}
+
+func (r *openAIWSIngressCaptureRing) snapshot(n int) []OpenAIWSIngressSessionRecording {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	recent := r.recentLocked(n)
+	r.mu.Unlock()
+	out := make([]OpenAIWSIngressSessionRecording, 0, len(recent))
+	for _, recording := range recent {
+		cloned := *recording
+		cloned.Events = append([]OpenAIWSIngressSessionRecordedEvent(nil), recording.Events...)
+		out = append(out, cloned)
+	}
+	return out
+}
+
+func (r *openAIWSIngressCaptureRing) stats() OpenAIWSIngressCaptureStats {
+	if r == nil {
+		return OpenAIWSIngressCaptureStats{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return OpenAIWSIngressCaptureStats{
+		Retained:     r.count,
+		Capacity:     len(r.items),
+		DroppedTotal: r.dropped.Load(),
+	}
+}
+
+// SnapshotRecentCaptures 返回内存中最近 n 条 ingress 会话录制（已脱敏），按从新到旧排序；n<=0 返回全部。
+func (s *OpenAIGatewayService) SnapshotRecentCaptures(n int) []OpenAIWSIngressSessionRecording {
+	if s == nil {
+		return nil
+	}
+	if n <= 0 {
+		n = s.openaiWSRecentCaptures.stats().Retained
+	}
+	return s.openaiWSRecentCaptures.snapshot(n)
+}
+
+// SnapshotOpenAIWSIngressCaptureStats 返回内存近期录制缓冲的统计。
+func (s *OpenAIGatewayService) SnapshotOpenAIWSIngressCaptureStats() OpenAIWSIngressCaptureStats {
+	if s == nil {
+		return OpenAIWSIngressCaptureStats{}
+	}
+	return s.openaiWSRecentCaptures.stats()
+}
+
+// openAIWSIngressSessionRecorder 在内存中累积会话消息，会话结束时脱敏后一次性落盘并/或放入近期录制缓冲，
+// 热路径只做字节拷贝。超过 openAIWSIngressCaptureMaxEvents 后停止追加并标记 truncated。
+type openAIWSIngressSessionRecorder struct {
+	mu        sync.Mutex
+	dir       string
+	secrets   []string
+	recent    *openAIWSIngressCaptureRing
+	recentMax int
+	recording OpenAIWSIngressSessionRecording
+}
+
+func (s *OpenAIGatewayService) newOpenAIWSIngressSessionRecorder(account *Account, token string) *openAIWSIngressSessionRecorder {
+	if s == nil || s.cfg == nil || account == nil {
+		return nil
+	}
+	dir := strings.TrimSpace(s.cfg.Gateway.OpenAIWS.IngressSessionCaptureDir)
+	recentMax := s.cfg.Gateway.OpenAIWS.IngressSessionCaptureRecentMax
+	if dir == "" && recentMax <= 0 {
+		return nil
+	}
+	secrets := make([]string, 0, 1)
+	if token = strings.TrimSpace(token); token != "" {
+		secrets = append(secrets, token)
+	}
+	return &openAIWSIngressSessionRecorder{
+		dir:       dir,
+		secrets:   secrets,
+		recent:    &s.openaiWSRecentCaptures,
+		recentMax: recentMax,
+		recording: OpenAIWSIngressSessionRecording{
+			Version:     openAIWSIngressCaptureVersion,
+			AccountID:   account.ID,
+			AccountType: account.Type,
+			StartedAt:   time.Now(),
+		},
+	}
+}
+
+func (r *openAIWSIngressSessionRecorder) recordClient(message []byte) {
+	r.record(OpenAIWSIngressCaptureDirectionClient, message)
+}
+
+func (r *openAIWSIngressSessionRecorder) recordUpstream(message []byte) {
+	r.record(OpenAIWSIngressCaptureDirectionUpstream, message)
+}
+
+func (r *openAIWSIngressSessionRecorder) record(direction string, message []byte) {
+	if r == nil || len(message) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.recording.Events) >= openAIWSIngressCaptureMaxEvents {
+		r.recording.Truncated = true
+		return
+	}
+	r.recording.Events = append(r.recording.Events, OpenAIWSIngressSessionRecordedEvent{
+		Direction: direction,
+		OffsetMS:  time.Since(r.recording.StartedAt).Milliseconds(),
+		Payload:   append(json.RawMessage(nil), message...),
+	})
+}
+
+// flush 脱敏后把录制放入近期录制缓冲并写入目录，返回文件路径；无任何消息或未配置目录时不落盘。
+func (r *openAIWSIngressSessionRecorder) flush() (string, error) {
+	if r == nil {
+		return "", nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.recording.Events) == 0 {
+		return "", nil
+	}
+	r.recording.EndedAt = time.Now()
+	for i := range r.recording.Events {
+		r.recording.Events[i].Payload = redactOpenAIWSIngressCapturePayload(r.recording.Events[i].Payload, r.secrets)
+	}
+	if r.recentMax > 0 {
+		retained := r.recording
+		r.recent.push(&retained, r.recentMax)
+	}
+	if r.dir == "" {
+		return "", nil
+	}
+	body, err := json.MarshalIndent(&r.recording, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("encode ingress session recording: %w", err)
+	}
+	if err := os.MkdirAll(r.dir, 0o750); err != nil {
+		return "", fmt.Errorf("create ingress session capture dir: %w", err)
+	}
+	name := fmt.Sprintf("openai-ws-ingress-%d-%d.json", r.recording.AccountID, r.recording.StartedAt.UnixNano())
+	path := filepath.Join(r.dir, name)
+	if err := os.WriteFile(path, body, 0o600); err != nil {
+		return "", fmt.Errorf("write ingress session recording: %w", err)
+	}
+	return path, nil
+}
+
+// redactOpenAIWSIngressCapturePayload 抹去会话凭证原文与敏感字段值；非 JSON 消息整体替换为占位字符串。
+func redactOpenAIWSIngressCapturePayload(payload json.RawMessage, secrets []string) json.RawMessage {
+	for _, secret := range secrets {
+		payload = bytes.ReplaceAll(payload, []byte(secret), []byte(openAIWSIngressCaptureRedacted))
+	}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return json.RawMessage(`"<non-json payload redacted>"`)
+	}
+	redacted, err := json.Marshal(redactOpenAIWSIngressCaptureValue(value, 0))
+	if err != nil {
+		return json.RawMessage(`"<redacted>"`)
+	}
+	return redacted
+}
+
+func redactOpenAIWSIngressCaptureValue(value any, depth int) any {
+	if depth > 32 {
+		return openAIWSIngressCaptureRedacted
+	}
+	switch typed := value.(type) {
+	case map[string]any:
+		for key, child := range typed {
+			if _, sensitive := openAIWSIngressCaptureSensitiveKeys[strings.ToLower(key)]; sensitive {
+				typed[key] = openAIWSIngressCaptureRedacted
+				continue
+			}
+			typed[key] = redactOpenAIWSIngressCaptureValue(child, depth+1)
+		}
+		return typed
+	case []any:
+		for i, child := range typed {
+			typed[i] = redactOpenAIWSIngressCaptureValue(child, depth+1)
+		}
+		return typed
+	default:
+		return value
+	}
+}
+
+// logOpenAIWSIngressSessionCapture 会话结束时落盘录制；失败只记录日志，不影响会话结果。
+func logOpenAIWSIngressSessionCapture(recorder *openAIWSIngressSessionRecorder) {
+	if recorder == nil {
+		return
+	}
+	path, err := recorder.flush()
+	if err != nil {
+		logOpenAIWSModeInfo(
+			"ingress_ws_session_capture_fail account_id=%d cause=%s",
+			recorder.recording.AccountID,
+			truncateOpenAIWSLogValue(err.Error(), openAIWSLogValueMaxLen),
+		)
+		return
+	}
+	if path != "" {
+		logOpenAIWSModeInfo("ingress_ws_session_captured account_id=%d path=%s", recorder.recording.AccountID, path)
+	}
+}
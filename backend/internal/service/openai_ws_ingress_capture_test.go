@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	coderws "github.com/coder/websocket"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func newOpenAIWSIngressCaptureTestConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.Security.URLAllowlist.Enabled = false
+	cfg.Security.URLAllowlist.AllowInsecureHTTP = true
+	cfg.Gateway.OpenAIWS.Enabled = true
+	cfg.Gateway.OpenAIWS.OAuthEnabled = true
+	cfg.Gateway.OpenAIWS.APIKeyEnabled = true
+	cfg.Gateway.OpenAIWS.ResponsesWebsocketsV2 = true
+	cfg.Gateway.OpenAIWS.MaxConnsPerAccount = 1
+	cfg.Gateway.OpenAIWS.MinIdlePerAccount = 0
+	cfg.Gateway.OpenAIWS.MaxIdlePerAccount = 1
+	cfg.Gateway.OpenAIWS.QueueLimitPerConn = 8
+	cfg.Gateway.OpenAIWS.DialTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.ReadTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.WriteTimeoutSeconds = 3
+	return cfg
+}
+
+// runOpenAIWSIngressSessionForTest 依次发送客户端消息，每条消息读取到终止事件为止，返回客户端收到的全部消息。
+func runOpenAIWSIngressSessionForTest(t *testing.T, cfg *config.Config, account *Account, token string, upstream openAIWSClientConn, clientMessages [][]byte) [][]byte {
+	t.Helper()
+	require.NotEmpty(t, clientMessages)
+	gin.SetMode(gin.TestMode)
+
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(&openAIWSQueueDialer{conns: []openAIWSClientConn{upstream}})
+	svc := &OpenAIGatewayService{
+		cfg:              cfg,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     pool,
+	}
+	return runOpenAIWSIngressSessionWithServiceForTest(t, svc, account, token, clientMessages, nil)
+}
+
+// runOpenAIWSIngressSessionWithServiceForTest 与 runOpenAIWSIngressSessionForTest 相同，但由调用方提供已装配好的 service 与 hooks。
+func runOpenAIWSIngressSessionWithServiceForTest(t *testing.T, svc *OpenAIGatewayService, account *Account, token string, clientMessages [][]byte, hooks *OpenAIWSIngressHooks) [][]byte {
+	t.Helper()
+	require.NotEmpty(t, clientMessages)
+	gin.SetMode(gin.TestMode)
+
+	serverErrCh := make(chan error, 1)
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := coderws.Accept(w, r, &coderws.AcceptOptions{CompressionMode: coderws.CompressionContextTakeover})
+		if err != nil {
+			serverErrCh <- err
+			return
+		}
+		defer func() {
+			_ = conn.CloseNow()
+		}()
+
+		rec := httptest.NewRecorder()
+		ginCtx, _ := gin.CreateTestContext(rec)
+		req := r.Clone(r.Context())
+		req.Header = req.Header.Clone()
+		req.Header.Set("User-Agent", "unit-test-agent/1.0")
+		ginCtx.Request = req
+
+		readCtx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		_, firstMessage, readErr := conn.Read(readCtx)
+		cancel()
+		if readErr != nil {
+			serverErrCh <- readErr
+			return
+		}
+		serverErrCh <- svc.ProxyResponsesWebSocketFromClient(r.Context(), ginCtx, conn, account, token, firstMessage, hooks)
+	}))
+	defer wsServer.Close()
+
+	dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+	clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http"), nil)
+	cancelDial()
+	require.NoError(t, err)
+	defer func() {
+		_ = clientConn.CloseNow()
+	}()
+
+	received := make([][]byte, 0, len(clientMessages)*2)
+	for _, message := range clientMessages {
+		writeCtx, cancelWrite := context.WithTimeout(context.Background(), 3*time.Second)
+		require.NoError(t, clientConn.Write(writeCtx, coderws.MessageText, message))
+		cancelWrite()
+		for {
+			readCtx, cancelRead := context.WithTimeout(context.Background(), 3*time.Second)
+			_, downstream, readErr := clientConn.Read(readCtx)
+			cancelRead()
+			require.NoError(t, readErr)
+			received = append(received, downstream)
+			eventType := gjson.GetBytes(downstream, "type").String()
+			if isOpenAIWSTerminalEvent(eventType) || eventType == "error" {
+				break
+			}
+		}
+	}
+
+	require.NoError(t, clientConn.Close(coderws.StatusNormalClosure, "done"))
+	select {
+	case serverErr := <-serverErrCh:
+		require.NoError(t, serverErr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待 ingress websocket 结束超时")
+	}
+	return received
+}
+
+// replayOpenAIWSIngressSessionRecording 以录制的上游事件驱动 stub 连接，重新回放录制的客户端消息。
+func replayOpenAIWSIngressSessionRecording(t *testing.T, recording *OpenAIWSIngressSessionRecording) ([][]byte, *openAIWSCaptureConn) {
+	t.Helper()
+	require.NotNil(t, recording)
+	upstream := &openAIWSCaptureConn{events: recording.UpstreamEvents()}
+	account := &Account{
+		ID:          recording.AccountID,
+		Name:        "openai-ingress-replay",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{"api_key": "sk-replay"},
+		Extra:       map[string]any{"responses_websockets_v2_enabled": true},
+	}
+	received := runOpenAIWSIngressSessionForTest(t, newOpenAIWSIngressCaptureTestConfig(), account, "sk-replay", upstream, recording.ClientMessages())
+	return received, upstream
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_SessionCaptureAndReplay(t *testing.T) {
+	captureDir := filepath.Join(t.TempDir(), "captures")
+	cfg := newOpenAIWSIngressCaptureTestConfig()
+	cfg.Gateway.OpenAIWS.IngressSessionCaptureDir = captureDir
+
+	upstreamEvents := [][]byte{
+		[]byte(`{"type":"response.created","response":{"id":"resp_capture_1","model":"gpt-5.1"}}`),
+		[]byte(`{"type":"response.completed","response":{"id":"resp_capture_1","model":"gpt-5.1","usage":{"input_tokens":3,"output_tokens":2}}}`),
+		[]byte(`{"type":"response.created","response":{"id":"resp_capture_2","model":"gpt-5.1"}}`),
+		[]byte(`{"type":"response.completed","response":{"id":"resp_capture_2","model":"gpt-5.1","usage":{"input_tokens":4,"output_tokens":1}}}`),
+	}
+	clientMessages := [][]byte{
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"instructions":"token sk-capture-secret","metadata":{"api_key":"sk-leaked"}}`),
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"previous_response_id":"resp_capture_1"}`),
+	}
+	account := &Account{
+		ID:          134,
+		Name:        "openai-ingress-capture",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{"api_key": "sk-capture-secret"},
+		Extra:       map[string]any{"responses_websockets_v2_enabled": true},
+	}
+	original := runOpenAIWSIngressSessionForTest(t, cfg, account, "sk-capture-secret", &openAIWSCaptureConn{events: upstreamEvents}, clientMessages)
+
+	var files []string
+	require.Eventually(t, func() bool {
+		files, _ = filepath.Glob(filepath.Join(captureDir, "openai-ws-ingress-134-*.json"))
+		return len(files) == 1
+	}, 3*time.Second, 10*time.Millisecond)
+	raw, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	require.NotContains(t, string(raw), "sk-capture-secret", "会话凭证原文必须脱敏")
+	require.NotContains(t, string(raw), "sk-leaked", "敏感字段值必须脱敏")
+
+	recording, err := LoadOpenAIWSIngressSessionRecording(files[0])
+	require.NoError(t, err)
+	require.Equal(t, int64(134), recording.AccountID)
+	require.Len(t, recording.ClientMessages(), 2)
+	require.Len(t, recording.UpstreamEvents(), 4)
+	require.Equal(t, "resp_capture_1", gjson.GetBytes(recording.ClientMessages()[1], "previous_response_id").String())
+
+	replayed, upstream := replayOpenAIWSIngressSessionRecording(t, recording)
+	require.Len(t, replayed, len(original))
+	for i := range original {
+		require.JSONEq(t, string(original[i]), string(replayed[i]), "回放下发事件应与录制会话一致")
+	}
+	upstream.mu.Lock()
+	defer upstream.mu.Unlock()
+	require.Len(t, upstream.writes, 2)
+	require.Equal(t, "resp_capture_1", upstream.writes[1]["previous_response_id"])
+}
+
+func TestRedactOpenAIWSIngressCapturePayload(t *testing.T) {
+	redacted := redactOpenAIWSIngressCapturePayload(
+		json.RawMessage(`{"type":"error","error":{"code":"previous_response_not_found"},"auth":{"Authorization":"Bearer x","access_token":"tok"},"n":12345678901234567890,"note":"key sk-abc"}`),
+		[]string{"sk-abc"},
+	)
+	require.Equal(t, "previous_response_not_found", gjson.GetBytes(redacted, "error.code").String(), "业务字段 code 不应被脱敏")
+	require.Equal(t, "***", gjson.GetBytes(redacted, "auth.Authorization").String())
+	require.Equal(t, "***", gjson.GetBytes(redacted, "auth.access_token").String())
+	require.Equal(t, "12345678901234567890", gjson.GetBytes(redacted, "n").Raw, "数字应保持原始精度")
+	require.Equal(t, "key ***", gjson.GetBytes(redacted, "note").String())
+
+	require.Equal(t, `"<non-json payload redacted>"`, string(redactOpenAIWSIngressCapturePayload(json.RawMessage(`not-json`), nil)))
+}
+
+func TestOpenAIGatewayService_SnapshotRecentCaptures_BoundedRing(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.IngressSessionCaptureRecentMax = 2
+	svc := &OpenAIGatewayService{cfg: cfg}
+
+	for id := int64(1); id <= 3; id++ {
+		account := &Account{ID: id, Type: AccountTypeAPIKey}
+		recorder := svc.newOpenAIWSIngressSessionRecorder(account, "sk-ring-secret")
+		require.NotNil(t, recorder, "仅开启内存录制时也应创建 recorder")
+		recorder.recordClient([]byte(`{"type":"response.create","instructions":"sk-ring-secret"}`))
+		path, err := recorder.flush()
+		require.NoError(t, err)
+		require.Empty(t, path, "未配置录制目录时不应落盘")
+	}
+
+	recent := svc.SnapshotRecentCaptures(0)
+	require.Len(t, recent, 2)
+	require.Equal(t, int64(3), recent[0].AccountID, "应按从新到旧排序")
+	require.Equal(t, int64(2), recent[1].AccountID)
+	require.NotContains(t, string(recent[0].Events[0].Payload), "sk-ring-secret")
+	require.Len(t, svc.SnapshotRecentCaptures(1), 1)
+	require.Equal(t, OpenAIWSIngressCaptureStats{Retained: 2, Capacity: 2, DroppedTotal: 1}, svc.SnapshotOpenAIWSIngressCaptureStats())
+
+	// 容量调小时保留最新记录，超出部分计入丢弃。
+	cfg.Gateway.OpenAIWS.IngressSessionCaptureRecentMax = 1
+	recorder := svc.newOpenAIWSIngressSessionRecorder(&Account{ID: 4, Type: AccountTypeAPIKey}, "")
+	recorder.recordUpstream([]byte(`{"type":"response.completed"}`))
+	_, err := recorder.flush()
+	require.NoError(t, err)
+	recent = svc.SnapshotRecentCaptures(5)
+	require.Len(t, recent, 1)
+	require.Equal(t, int64(4), recent[0].AccountID)
+	require.Equal(t, OpenAIWSIngressCaptureStats{Retained: 1, Capacity: 1, DroppedTotal: 3}, svc.SnapshotOpenAIWSIngressCaptureStats())
+
+	cfg.Gateway.OpenAIWS.IngressSessionCaptureRecentMax = 0
+	require.Nil(t, svc.newOpenAIWSIngressSessionRecorder(&Account{ID: 5}, ""), "目录与内存录制均关闭时不录制")
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	openAIWSSlowClientPolicyDisconnect = "disconnect"
+	openAIWSSlowClientPolicyDropDeltas = "drop_deltas"
+)
+
+// openAIWSDownstreamEnqueueOutcome 描述一条事件交给下发缓冲后的结果。
+type openAIWSDownstreamEnqueueOutcome int
+
+const (
+	// openAIWSDownstreamQueued 事件已进入缓冲，将按顺序写给客户端。
+	openAIWSDownstreamQueued openAIWSDownstreamEnqueueOutcome = iota
+	// openAIWSDownstreamDropped 缓冲已满且策略为 drop_deltas，增量事件被丢弃。
+	openAIWSDownstreamDropped
+	// openAIWSDownstreamSlowClient 缓冲已满且策略为 disconnect（或 drop_deltas 下非增量事件等待空位超时），调用方应断开客户端。
+	openAIWSDownstreamSlowClient
+	// openAIWSDownstreamWriteFailed 此前的客户端写入已失败，错误随结果返回。
+	openAIWSDownstreamWriteFailed
+)
+
+// openAIWSIngressDownstreamBuffer 将单个 turn 的客户端写入移到独立协程，上游读取循环只做非阻塞入队，
+// 慢客户端因此不会反压上游读取。事件按入队顺序写出；首个写入错误之后的事件不再写出。
+// flush 等待缓冲写空后返回，保证 turn 结束前全部事件已下发，不会与后续 turn 或错误事件交错。
+type openAIWSIngressDownstreamBuffer struct {
+	queue  chan []byte
+	policy string
+	// enqueueTimeout drop_deltas 下非增量事件等待缓冲空位的上限，超时后按 disconnect 处理。
+	enqueueTimeout time.Duration
+	cancel         context.CancelFunc
+	done           chan struct{}
+
+	errMu sync.Mutex
+	err   error
+
+	closeOnce sync.Once
+}
+
+func startOpenAIWSIngressDownstreamBuffer(
+	ctx context.Context,
+	size int,
+	policy string,
+	enqueueTimeout time.Duration,
+	write func(ctx context.Context, message []byte) error,
+) *openAIWSIngressDownstreamBuffer {
+	if size <= 0 || write == nil {
+		return nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	writeCtx, cancel := context.WithCancel(ctx)
+	b := &openAIWSIngressDownstreamBuffer{
+		queue:          make(chan []byte, size),
+		policy:         policy,
+		enqueueTimeout: enqueueTimeout,
+		cancel:         cancel,
+		done:           make(chan struct{}),
+	}
+	GoWithPanicStateDump(func() {
+		defer close(b.done)
+		for message := range b.queue {
+			if b.failure() != nil {
+				continue
+			}
+			if err := write(writeCtx, message); err != nil {
+				b.errMu.Lock()
+				b.err = err
+				b.errMu.Unlock()
+			}
+		}
+	})
+	return b
+}
+
+func (b *openAIWSIngressDownstreamBuffer) failure() error {
+	b.errMu.Lock()
+	defer b.errMu.Unlock()
+	return b.err
+}
+
+// enqueue 非阻塞地提交一条事件。缓冲已满时按策略处理：drop_deltas 丢弃增量事件、
+// 非增量事件最多等待 enqueueTimeout，仍无空位则与 disconnect 一样返回 openAIWSDownstreamSlowClient
+// 由调用方断开客户端，避免完全停止读取的客户端无限期阻塞 turn。
+func (b *openAIWSIngressDownstreamBuffer) enqueue(message []byte, eventType string) (openAIWSDownstreamEnqueueOutcome, error) {
+	if err := b.failure(); err != nil {
+		return openAIWSDownstreamWriteFailed, err
+	}
+	select {
+	case b.queue <- message:
+		return openAIWSDownstreamQueued, nil
+	default:
+	}
+	if b.policy != openAIWSSlowClientPolicyDropDeltas {
+		return openAIWSDownstreamSlowClient, nil
+	}
+	if isOpenAIWSDroppableDeltaEvent(eventType) {
+		return openAIWSDownstreamDropped, nil
+	}
+	if b.enqueueTimeout <= 0 {
+		return openAIWSDownstreamSlowClient, nil
+	}
+	timer := time.NewTimer(b.enqueueTimeout)
+	defer timer.Stop()
+	select {
+	case b.queue <- message:
+		return openAIWSDownstreamQueued, nil
+	case <-b.done:
+		return openAIWSDownstreamWriteFailed, b.failure()
+	case <-timer.C:
+		return openAIWSDownstreamSlowClient, nil
+	}
+}
+
+// flush 停止接收新事件并等待缓冲写空，返回写入过程中的首个错误；可重复调用。
+func (b *openAIWSIngressDownstreamBuffer) flush() error {
+	if b == nil {
+		return nil
+	}
+	b.closeOnce.Do(func() {
+		close(b.queue)
+	})
+	<-b.done
+	b.cancel()
+	return b.failure()
+}
+
+// abort 放弃缓冲中尚未写出的事件并取消进行中的写入；可重复调用。
+func (b *openAIWSIngressDownstreamBuffer) abort() {
+	if b == nil {
+		return
+	}
+	b.cancel()
+	b.errMu.Lock()
+	if b.err == nil {
+		b.err = context.Canceled
+	}
+	b.errMu.Unlock()
+	_ = b.flush()
+}
+
+// isOpenAIWSDroppableDeltaEvent 判断事件是否为可丢弃的增量事件；对应的 *.done / output_item.done 事件携带完整内容。
+func isOpenAIWSDroppableDeltaEvent(eventType string) bool {
+	return strings.HasSuffix(strings.TrimSpace(eventType), ".delta")
+}
+
+// openAIWSIngressSlowClientPolicy 返回下发缓冲写满时的处理策略。
+func (s *OpenAIGatewayService) openAIWSIngressSlowClientPolicy() string {
+	if s != nil && s.cfg != nil && strings.TrimSpace(s.cfg.Gateway.OpenAIWS.IngressSlowClientPolicy) == openAIWSSlowClientPolicyDropDeltas {
+		return openAIWSSlowClientPolicyDropDeltas
+	}
+	return openAIWSSlowClientPolicyDisconnect
+}
+
+// openAIWSIngressDownstreamBufferSize 返回每个 turn 的下发缓冲条数；0 表示同步写入。
+func (s *OpenAIGatewayService) openAIWSIngressDownstreamBufferSize() int {
+	if s == nil || s.cfg == nil || s.cfg.Gateway.OpenAIWS.IngressDownstreamBufferSize <= 0 {
+		return 0
+	}
+	return s.cfg.Gateway.OpenAIWS.IngressDownstreamBufferSize
+}
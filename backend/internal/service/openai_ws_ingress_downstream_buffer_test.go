@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	coderws "github.com/coder/websocket"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+// openAIWSGatedWriter 模拟慢客户端：每次写入都要等待 gate 放行，started 通知写入已开始。
+type openAIWSGatedWriter struct {
+	mu      sync.Mutex
+	written []string
+	started chan struct{}
+	gate    chan struct{}
+}
+
+func newOpenAIWSGatedWriter() *openAIWSGatedWriter {
+	return &openAIWSGatedWriter{started: make(chan struct{}, 16), gate: make(chan struct{})}
+}
+
+func (w *openAIWSGatedWriter) write(ctx context.Context, message []byte) error {
+	w.started <- struct{}{}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-w.gate:
+	}
+	w.mu.Lock()
+	w.written = append(w.written, string(message))
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *openAIWSGatedWriter) snapshot() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.written...)
+}
+
+func TestOpenAIWSIngressDownstreamBuffer_Disabled(t *testing.T) {
+	require.Nil(t, startOpenAIWSIngressDownstreamBuffer(context.Background(), 0, openAIWSSlowClientPolicyDisconnect, time.Second, newOpenAIWSGatedWriter().write))
+	var buffer *openAIWSIngressDownstreamBuffer
+	require.NoError(t, buffer.flush())
+	buffer.abort()
+}
+
+func TestOpenAIWSIngressDownstreamBuffer_DisconnectPolicy(t *testing.T) {
+	writer := newOpenAIWSGatedWriter()
+	buffer := startOpenAIWSIngressDownstreamBuffer(context.Background(), 1, openAIWSSlowClientPolicyDisconnect, time.Second, writer.write)
+
+	outcome, err := buffer.enqueue([]byte("a"), "response.output_text.delta")
+	require.NoError(t, err)
+	require.Equal(t, openAIWSDownstreamQueued, outcome)
+	<-writer.started
+
+	outcome, _ = buffer.enqueue([]byte("b"), "response.output_text.delta")
+	require.Equal(t, openAIWSDownstreamQueued, outcome)
+	outcome, _ = buffer.enqueue([]byte("c"), "response.completed")
+	require.Equal(t, openAIWSDownstreamSlowClient, outcome, "缓冲写满时不应阻塞调用方")
+
+	buffer.abort()
+	require.ErrorIs(t, buffer.flush(), context.Canceled)
+	require.Empty(t, writer.snapshot(), "abort 后不应再写出缓冲中的事件")
+}
+
+func TestOpenAIWSIngressDownstreamBuffer_DropDeltasPolicy(t *testing.T) {
+	writer := newOpenAIWSGatedWriter()
+	buffer := startOpenAIWSIngressDownstreamBuffer(context.Background(), 1, openAIWSSlowClientPolicyDropDeltas, time.Second, writer.write)
+
+	outcome, _ := buffer.enqueue([]byte("a"), "response.output_text.delta")
+	require.Equal(t, openAIWSDownstreamQueued, outcome)
+	<-writer.started
+	outcome, _ = buffer.enqueue([]byte("b"), "response.output_text.delta")
+	require.Equal(t, openAIWSDownstreamQueued, outcome)
+	outcome, _ = buffer.enqueue([]byte("c"), "response.output_text.delta")
+	require.Equal(t, openAIWSDownstreamDropped, outcome)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(writer.gate)
+	}()
+	outcome, err := buffer.enqueue([]byte("d"), "response.completed")
+	require.NoError(t, err)
+	require.Equal(t, openAIWSDownstreamQueued, outcome, "非增量事件应等待缓冲空位而不是被丢弃")
+
+	require.NoError(t, buffer.flush())
+	require.NoError(t, buffer.flush())
+	require.Equal(t, []string{"a", "b", "d"}, writer.snapshot())
+}
+
+func TestOpenAIWSIngressDownstreamBuffer_DropDeltasTerminalEventTimesOutToDisconnect(t *testing.T) {
+	writer := newOpenAIWSGatedWriter()
+	buffer := startOpenAIWSIngressDownstreamBuffer(context.Background(), 1, openAIWSSlowClientPolicyDropDeltas, 50*time.Millisecond, writer.write)
+
+	outcome, _ := buffer.enqueue([]byte("a"), "response.output_text.delta")
+	require.Equal(t, openAIWSDownstreamQueued, outcome)
+	<-writer.started
+	outcome, _ = buffer.enqueue([]byte("b"), "response.output_text.delta")
+	require.Equal(t, openAIWSDownstreamQueued, outcome)
+
+	// 客户端完全停止读取：缓冲已满时 terminal 事件只等待 enqueueTimeout，随后按 disconnect 处理。
+	start := time.Now()
+	outcome, err := buffer.enqueue([]byte("c"), "response.completed")
+	require.NoError(t, err)
+	require.Equal(t, openAIWSDownstreamSlowClient, outcome)
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	require.Less(t, time.Since(start), time.Second, "非增量事件不应无限期阻塞 turn")
+
+	buffer.abort()
+	require.ErrorIs(t, buffer.flush(), context.Canceled)
+	require.Empty(t, writer.snapshot())
+}
+
+func TestOpenAIWSIngressDownstreamBuffer_WriteFailure(t *testing.T) {
+	writeErr := errors.New("write failed")
+	buffer := startOpenAIWSIngressDownstreamBuffer(context.Background(), 4, openAIWSSlowClientPolicyDisconnect, time.Second, func(context.Context, []byte) error {
+		return writeErr
+	})
+	_, err := buffer.enqueue([]byte("a"), "response.created")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		outcome, enqueueErr := buffer.enqueue([]byte("b"), "response.created")
+		return outcome == openAIWSDownstreamWriteFailed && errors.Is(enqueueErr, writeErr)
+	}, time.Second, 5*time.Millisecond)
+	require.ErrorIs(t, buffer.flush(), writeErr)
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_SlowClientDisconnect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := newOpenAIWSIngressCaptureTestConfig()
+	cfg.Gateway.OpenAIWS.IngressDownstreamBufferSize = 2
+	cfg.Gateway.OpenAIWS.IngressSlowClientPolicy = openAIWSSlowClientPolicyDisconnect
+
+	// 大体积增量事件足以写满 TCP 缓冲，使不读取的客户端阻塞网关写入。
+	const deltaCount = 64
+	chunk := make([]byte, 128*1024)
+	_, err := rand.Read(chunk)
+	require.NoError(t, err)
+	text := hex.EncodeToString(chunk)
+	events := make([][]byte, 0, deltaCount+1)
+	for i := 0; i < deltaCount; i++ {
+		events = append(events, []byte(fmt.Sprintf(`{"type":"response.output_text.delta","response_id":"resp_slow","delta":"%s"}`, text)))
+	}
+	events = append(events, []byte(`{"type":"response.completed","response":{"id":"resp_slow","model":"gpt-5.1","usage":{"input_tokens":3,"output_tokens":5}}}`))
+	upstream := &openAIWSCaptureConn{events: events}
+
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(&openAIWSQueueDialer{conns: []openAIWSClientConn{upstream}})
+	svc := &OpenAIGatewayService{
+		cfg:              cfg,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     pool,
+	}
+	account := &Account{
+		ID:          143,
+		Name:        "openai-ingress-slow-client",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{"api_key": "sk-slow-client"},
+		Extra:       map[string]any{"responses_websockets_v2_enabled": true},
+	}
+
+	var resultMu sync.Mutex
+	var turnResult *OpenAIForwardResult
+	hooks := &OpenAIWSIngressHooks{
+		AfterTurn: func(_ int, result *OpenAIForwardResult, _ error) {
+			resultMu.Lock()
+			turnResult = result
+			resultMu.Unlock()
+		},
+	}
+	serverDone := make(chan struct{})
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(serverDone)
+		conn, acceptErr := coderws.Accept(w, r, nil)
+		if acceptErr != nil {
+			return
+		}
+		defer func() {
+			_ = conn.CloseNow()
+		}()
+		conn.SetReadLimit(-1)
+		ginCtx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ginCtx.Request = r.Clone(r.Context())
+		readCtx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		_, firstMessage, readErr := conn.Read(readCtx)
+		cancel()
+		if readErr != nil {
+			return
+		}
+		_ = svc.ProxyResponsesWebSocketFromClient(r.Context(), ginCtx, conn, account, "sk-slow-client", firstMessage, hooks)
+	}))
+	defer wsServer.Close()
+
+	dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+	clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http"), nil)
+	cancelDial()
+	require.NoError(t, err)
+	defer func() {
+		_ = clientConn.CloseNow()
+	}()
+	clientConn.SetReadLimit(-1)
+
+	writeCtx, cancelWrite := context.WithTimeout(context.Background(), 3*time.Second)
+	require.NoError(t, clientConn.Write(writeCtx, coderws.MessageText, []byte(`{"type":"response.create","model":"gpt-5.1","stream":true}`)))
+	cancelWrite()
+
+	// 客户端不读取任何事件：网关应断开客户端并继续读完上游，而不是阻塞到上游读超时。
+	select {
+	case <-serverDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("慢客户端未被断开，ingress 会话未结束")
+	}
+
+	require.Equal(t, int64(1), svc.SnapshotOpenAIWSRelayMetrics().SlowClientDisconnectTotal)
+	upstream.mu.Lock()
+	require.Empty(t, upstream.events, "上游事件应被完整读取")
+	upstream.mu.Unlock()
+	resultMu.Lock()
+	require.NotNil(t, turnResult, "被断开的 turn 仍应产出结果用于计费")
+	require.Equal(t, 5, turnResult.Usage.OutputTokens)
+	resultMu.Unlock()
+
+	for {
+		readCtx, cancelRead := context.WithTimeout(context.Background(), 3*time.Second)
+		_, _, readErr := clientConn.Read(readCtx)
+		cancelRead()
+		if readErr != nil {
+			require.NotErrorIs(t, readErr, context.DeadlineExceeded, "客户端应观察到连接被关闭")
+			break
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var openAIWSIngressHeartbeatMessage = []byte(`{"type":"ping"}`)
+
+// openAIWSIngressDownstreamHeartbeat 在流式 turn 等待上游输出期间向客户端发送合成心跳。
+// 首个真实事件下发时调用 stop 结束本 turn 的心跳；网关自身的控制事件（如 turn 重置）调用 touch 顺延。
+// stop 会等待心跳协程退出，保证心跳不会晚于真实事件到达客户端。
+// 心跳不计入 wroteDownstream，不影响 previous_response_id 恢复等依赖“是否已下发”的判定。
+type openAIWSIngressDownstreamHeartbeat struct {
+	interval      time.Duration
+	lastWriteNano atomic.Int64
+	sentCount     atomic.Int64
+	done          chan struct{}
+	stopOnce      sync.Once
+	wg            sync.WaitGroup
+}
+
+func startOpenAIWSIngressDownstreamHeartbeat(interval time.Duration, write func([]byte) error) *openAIWSIngressDownstreamHeartbeat {
+	if interval <= 0 || write == nil {
+		return nil
+	}
+	h := &openAIWSIngressDownstreamHeartbeat{
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+	h.touch()
+
+	tick := interval / 2
+	if tick <= 0 {
+		tick = interval
+	}
+	h.wg.Add(1)
+	GoWithPanicStateDump(func() {
+		defer h.wg.Done()
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-h.done:
+				return
+			case <-ticker.C:
+			}
+			if time.Since(time.Unix(0, h.lastWriteNano.Load())) < h.interval {
+				continue
+			}
+			select {
+			case <-h.done:
+				return
+			default:
+			}
+			// 写失败通常意味着客户端已断开，交由主链路的下发逻辑处理，这里直接退出。
+			if err := write(openAIWSIngressHeartbeatMessage); err != nil {
+				return
+			}
+			h.sentCount.Add(1)
+			h.touch()
+		}
+	})
+	return h
+}
+
+func (h *openAIWSIngressDownstreamHeartbeat) touch() {
+	if h == nil {
+		return
+	}
+	h.lastWriteNano.Store(time.Now().UnixNano())
+}
+
+func (h *openAIWSIngressDownstreamHeartbeat) stop() {
+	if h == nil {
+		return
+	}
+	h.stopOnce.Do(func() {
+		close(h.done)
+	})
+	h.wg.Wait()
+}
+
+func (h *openAIWSIngressDownstreamHeartbeat) sent() int64 {
+	if h == nil {
+		return 0
+	}
+	return h.sentCount.Load()
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	coderws "github.com/coder/websocket"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestOpenAIWSIngressDownstreamHeartbeat_SendsWhenIdleAndStopsCleanly(t *testing.T) {
+	require.Nil(t, startOpenAIWSIngressDownstreamHeartbeat(0, func([]byte) error { return nil }))
+
+	var mu sync.Mutex
+	writes := 0
+	lastType := ""
+	heartbeat := startOpenAIWSIngressDownstreamHeartbeat(10*time.Millisecond, func(message []byte) error {
+		mu.Lock()
+		writes++
+		lastType = gjson.GetBytes(message, "type").String()
+		mu.Unlock()
+		return nil
+	})
+	require.Eventually(t, func() bool { return heartbeat.sent() >= 2 }, time.Second, 5*time.Millisecond)
+	heartbeat.stop()
+	heartbeat.stop()
+
+	mu.Lock()
+	stoppedAt := writes
+	mu.Unlock()
+	time.Sleep(40 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, stoppedAt, writes, "stop 之后不应再发送心跳")
+	require.Equal(t, "ping", lastType)
+}
+
+func TestOpenAIWSIngressDownstreamHeartbeat_TouchDefersAndWriteErrorExits(t *testing.T) {
+	heartbeat := startOpenAIWSIngressDownstreamHeartbeat(40*time.Millisecond, func([]byte) error { return nil })
+	defer heartbeat.stop()
+	deadline := time.Now().Add(120 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		heartbeat.touch()
+		time.Sleep(5 * time.Millisecond)
+	}
+	require.Zero(t, heartbeat.sent(), "持续有真实事件下发时不应发送心跳")
+
+	failing := startOpenAIWSIngressDownstreamHeartbeat(5*time.Millisecond, func([]byte) error { return errors.New("client gone") })
+	time.Sleep(30 * time.Millisecond)
+	failing.stop()
+	require.Zero(t, failing.sent())
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_StreamHeartbeatDuringUpstreamSilence(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{}
+	cfg.Security.URLAllowlist.Enabled = false
+	cfg.Security.URLAllowlist.AllowInsecureHTTP = true
+	cfg.Gateway.OpenAIWS.Enabled = true
+	cfg.Gateway.OpenAIWS.OAuthEnabled = true
+	cfg.Gateway.OpenAIWS.APIKeyEnabled = true
+	cfg.Gateway.OpenAIWS.ResponsesWebsocketsV2 = true
+	cfg.Gateway.OpenAIWS.IngressStreamHeartbeatIntervalMS = 20
+	cfg.Gateway.OpenAIWS.MaxConnsPerAccount = 1
+	cfg.Gateway.OpenAIWS.MinIdlePerAccount = 0
+	cfg.Gateway.OpenAIWS.MaxIdlePerAccount = 1
+	cfg.Gateway.OpenAIWS.QueueLimitPerConn = 8
+	cfg.Gateway.OpenAIWS.DialTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.ReadTimeoutSeconds = 3
+	cfg.Gateway.OpenAIWS.WriteTimeoutSeconds = 3
+
+	upstream := &openAIWSCaptureConn{
+		// 首个真实事件前静默 150ms，之后到终止事件前再静默 150ms（均远大于心跳间隔）。
+		readDelays: []time.Duration{150 * time.Millisecond, 150 * time.Millisecond, 150 * time.Millisecond},
+		events: [][]byte{
+			[]byte(`{"type":"response.created","response":{"id":"resp_heartbeat_1","model":"gpt-5.1"}}`),
+			[]byte(`{"type":"response.completed","response":{"id":"resp_heartbeat_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+			[]byte(`{"type":"response.completed","response":{"id":"resp_heartbeat_2","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+		},
+	}
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(&openAIWSQueueDialer{conns: []openAIWSClientConn{upstream}})
+
+	svc := &OpenAIGatewayService{
+		cfg:              cfg,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     pool,
+	}
+	account := &Account{
+		ID:          133,
+		Name:        "openai-ingress-heartbeat",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{"api_key": "sk-test"},
+		Extra:       map[string]any{"responses_websockets_v2_enabled": true},
+	}
+
+	serverErrCh := make(chan error, 1)
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := coderws.Accept(w, r, &coderws.AcceptOptions{CompressionMode: coderws.CompressionContextTakeover})
+		if err != nil {
+			serverErrCh <- err
+			return
+		}
+		defer func() {
+			_ = conn.CloseNow()
+		}()
+
+		rec := httptest.NewRecorder()
+		ginCtx, _ := gin.CreateTestContext(rec)
+		req := r.Clone(r.Context())
+		req.Header = req.Header.Clone()
+		req.Header.Set("User-Agent", "unit-test-agent/1.0")
+		ginCtx.Request = req
+
+		readCtx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		_, firstMessage, readErr := conn.Read(readCtx)
+		cancel()
+		if readErr != nil {
+			serverErrCh <- readErr
+			return
+		}
+		serverErrCh <- svc.ProxyResponsesWebSocketFromClient(r.Context(), ginCtx, conn, account, "sk-test", firstMessage, nil)
+	}))
+	defer wsServer.Close()
+
+	dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+	clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http"), nil)
+	cancelDial()
+	require.NoError(t, err)
+	defer func() {
+		_ = clientConn.CloseNow()
+	}()
+
+	writeMessage := func(payload string) {
+		writeCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		require.NoError(t, clientConn.Write(writeCtx, coderws.MessageText, []byte(payload)))
+	}
+	// readTurn 读取直到终止事件，返回首个真实事件之前/之后收到的心跳数量与终止事件。
+	readTurn := func() (int, int, []byte) {
+		pingsBefore, pingsAfter := 0, 0
+		sawRealEvent := false
+		for {
+			readCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			_, message, readErr := clientConn.Read(readCtx)
+			cancel()
+			require.NoError(t, readErr)
+			switch gjson.GetBytes(message, "type").String() {
+			case "ping":
+				if sawRealEvent {
+					pingsAfter++
+				} else {
+					pingsBefore++
+				}
+			case "response.completed":
+				return pingsBefore, pingsAfter, message
+			default:
+				sawRealEvent = true
+			}
+		}
+	}
+
+	writeMessage(`{"type":"response.create","model":"gpt-5.1","stream":true}`)
+	streamPings, pingsAfterRealEvent, completed := readTurn()
+	require.Equal(t, "resp_heartbeat_1", gjson.GetBytes(completed, "response.id").String())
+	require.GreaterOrEqual(t, streamPings, 1, "上游静默期间应下发合成心跳")
+	require.Zero(t, pingsAfterRealEvent, "首个真实事件下发后，即使后续间隔超过心跳间隔也不应再发送心跳")
+
+	writeMessage(`{"type":"response.create","model":"gpt-5.1","stream":false}`)
+	nonStreamPings, _, completed := readTurn()
+	require.Equal(t, "resp_heartbeat_2", gjson.GetBytes(completed, "response.id").String())
+	require.Zero(t, nonStreamPings, "stream=false 的 turn 不应下发心跳")
+
+	require.NoError(t, clientConn.Close(coderws.StatusNormalClosure, "done"))
+	select {
+	case serverErr := <-serverErrCh:
+		require.NoError(t, serverErr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待 ingress websocket 结束超时")
+	}
+}
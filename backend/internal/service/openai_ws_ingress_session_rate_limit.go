@@ -0,0 +1,178 @@
+package service
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// openAIWSSessionCreateRateWindow 新建会话速率统计窗口（滑动估算）。
+	openAIWSSessionCreateRateWindow = time.Minute
+	// openAIWSSessionCreateIdleTTL 超过该时长无新建会话的 API Key 状态被清理。
+	openAIWSSessionCreateIdleTTL = 10 * time.Minute
+)
+
+// OpenAIWSIngressSessionCreateRate 单个 API Key 的新建 ingress 会话统计。
+type OpenAIWSIngressSessionCreateRate struct {
+	APIKeyID int64 `json:"api_key_id"`
+	// RatePerMinute 最近一分钟的新建会话尝试数（含被限流的），按相邻窗口滑动估算。
+	RatePerMinute float64 `json:"rate_per_minute"`
+	AcceptedTotal int64   `json:"accepted_total"`
+	RejectedTotal int64   `json:"rejected_total"`
+}
+
+type openAIWSSessionCreateBucket struct {
+	tokens     float64
+	refilledAt time.Time
+	lastSeenAt time.Time
+
+	windowStart time.Time
+	windowCount int64
+	prevCount   int64
+
+	acceptedTotal int64
+	rejectedTotal int64
+}
+
+// openAIWSSessionCreateLimiter 按 API Key 的新建 ingress 会话令牌桶，同时统计各 API Key 的新建速率。
+// 限流关闭时仍统计速率，便于据此设置阈值；长时间无新建会话的 API Key 状态按需清理。
+type openAIWSSessionCreateLimiter struct {
+	// now 为可注入时钟，nil 时使用 time.Now。
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[int64]*openAIWSSessionCreateBucket
+	lastSweep time.Time
+
+	rejectedTotal atomic.Int64
+}
+
+func (l *openAIWSSessionCreateLimiter) clock() time.Time {
+	if l.now != nil {
+		return l.now()
+	}
+	return time.Now()
+}
+
+// allow 记录一次新建会话尝试，并按 perMinute/burst 判断是否放行；perMinute<=0 表示不限流。
+// burst<=0 时桶容量取 perMinute。
+func (l *openAIWSSessionCreateLimiter) allow(apiKeyID int64, perMinute, burst int) bool {
+	if l == nil {
+		return true
+	}
+	if burst <= 0 {
+		burst = perMinute
+	}
+	now := l.clock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweepLocked(now)
+	if l.buckets == nil {
+		l.buckets = make(map[int64]*openAIWSSessionCreateBucket)
+	}
+	bucket, ok := l.buckets[apiKeyID]
+	if !ok {
+		bucket = &openAIWSSessionCreateBucket{tokens: float64(burst), refilledAt: now, windowStart: now}
+		l.buckets[apiKeyID] = bucket
+	}
+	bucket.lastSeenAt = now
+	bucket.countAttempt(now)
+
+	if perMinute <= 0 {
+		bucket.acceptedTotal++
+		return true
+	}
+	if elapsed := now.Sub(bucket.refilledAt); elapsed > 0 {
+		bucket.tokens += elapsed.Minutes() * float64(perMinute)
+	}
+	bucket.refilledAt = now
+	if bucket.tokens > float64(burst) {
+		bucket.tokens = float64(burst)
+	}
+	if bucket.tokens < 1 {
+		bucket.rejectedTotal++
+		l.rejectedTotal.Add(1)
+		return false
+	}
+	bucket.tokens--
+	bucket.acceptedTotal++
+	return true
+}
+
+func (b *openAIWSSessionCreateBucket) countAttempt(now time.Time) {
+	b.rollWindow(now)
+	b.windowCount++
+}
+
+// rollWindow 将统计窗口推进到 now 所在窗口；跨越多个窗口时上一窗口计数清零。
+func (b *openAIWSSessionCreateBucket) rollWindow(now time.Time) {
+	elapsed := now.Sub(b.windowStart)
+	if elapsed < openAIWSSessionCreateRateWindow {
+		return
+	}
+	windows := elapsed / openAIWSSessionCreateRateWindow
+	if windows == 1 {
+		b.prevCount = b.windowCount
+	} else {
+		b.prevCount = 0
+	}
+	b.windowCount = 0
+	b.windowStart = b.windowStart.Add(windows * openAIWSSessionCreateRateWindow)
+}
+
+// ratePerMinute 以上一窗口按剩余比例加权、加上当前窗口计数估算最近一分钟的新建数。
+func (b *openAIWSSessionCreateBucket) ratePerMinute(now time.Time) float64 {
+	b.rollWindow(now)
+	elapsed := float64(now.Sub(b.windowStart)) / float64(openAIWSSessionCreateRateWindow)
+	return float64(b.prevCount)*(1-elapsed) + float64(b.windowCount)
+}
+
+func (l *openAIWSSessionCreateLimiter) sweepLocked(now time.Time) {
+	if now.Sub(l.lastSweep) < openAIWSSessionCreateRateWindow {
+		return
+	}
+	l.lastSweep = now
+	for apiKeyID, bucket := range l.buckets {
+		if now.Sub(bucket.lastSeenAt) >= openAIWSSessionCreateIdleTTL {
+			delete(l.buckets, apiKeyID)
+		}
+	}
+}
+
+// snapshot 返回各 API Key 的新建会话统计，按速率降序排列。
+func (l *openAIWSSessionCreateLimiter) snapshot() []OpenAIWSIngressSessionCreateRate {
+	if l == nil {
+		return nil
+	}
+	now := l.clock()
+	l.mu.Lock()
+	rates := make([]OpenAIWSIngressSessionCreateRate, 0, len(l.buckets))
+	for apiKeyID, bucket := range l.buckets {
+		rates = append(rates, OpenAIWSIngressSessionCreateRate{
+			APIKeyID:      apiKeyID,
+			RatePerMinute: bucket.ratePerMinute(now),
+			AcceptedTotal: bucket.acceptedTotal,
+			RejectedTotal: bucket.rejectedTotal,
+		})
+	}
+	l.mu.Unlock()
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].RatePerMinute != rates[j].RatePerMinute {
+			return rates[i].RatePerMinute > rates[j].RatePerMinute
+		}
+		return rates[i].APIKeyID < rates[j].APIKeyID
+	})
+	return rates
+}
+
+// AllowOpenAIWSIngressSession 在 ingress 握手完成后调用，判断该 API Key 是否可新建会话；
+// 返回 false 时调用方应以可重试关闭拒绝本次会话。
+func (s *OpenAIGatewayService) AllowOpenAIWSIngressSession(apiKeyID int64) bool {
+	if s == nil || s.cfg == nil {
+		return true
+	}
+	wsCfg := s.openAIWSConfig()
+	return s.openaiWSSessionCreates.allow(apiKeyID, wsCfg.IngressSessionCreatePerMinute, wsCfg.IngressSessionCreateBurst)
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIWSIngressSessionRateLimit_TokenBucketPerAPIKey(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.IngressSessionCreatePerMinute = 60
+	cfg.Gateway.OpenAIWS.IngressSessionCreateBurst = 2
+	svc := &OpenAIGatewayService{cfg: cfg}
+	svc.openaiWSSessionCreates.now = func() time.Time { return now }
+
+	// 桶容量 2：前两次放行，第三次拒绝；其他 API Key 不受影响。
+	require.True(t, svc.AllowOpenAIWSIngressSession(1))
+	require.True(t, svc.AllowOpenAIWSIngressSession(1))
+	require.False(t, svc.AllowOpenAIWSIngressSession(1))
+	require.True(t, svc.AllowOpenAIWSIngressSession(2))
+
+	// 每分钟 60 个即每秒补充 1 个。
+	now = now.Add(time.Second)
+	require.True(t, svc.AllowOpenAIWSIngressSession(1))
+	require.False(t, svc.AllowOpenAIWSIngressSession(1))
+
+	sessions := svc.SnapshotOpenAIWSIngressSessionMetrics()
+	require.Equal(t, int64(2), sessions.RateLimitedTotal)
+	require.Equal(t, []OpenAIWSIngressSessionCreateRate{
+		{APIKeyID: 1, RatePerMinute: 5, AcceptedTotal: 3, RejectedTotal: 2},
+		{APIKeyID: 2, RatePerMinute: 1, AcceptedTotal: 1},
+	}, sessions.CreateRates)
+
+	// 下一窗口过半时，上一窗口计数按剩余比例计入速率。
+	now = now.Add(89 * time.Second)
+	require.InDelta(t, 2.5, svc.SnapshotOpenAIWSIngressSessionMetrics().CreateRates[0].RatePerMinute, 1e-9)
+
+	// 热更新关闭限流后全部放行，但仍统计速率。
+	cfg.Gateway.OpenAIWS.IngressSessionCreatePerMinute = 0
+	for i := 0; i < 5; i++ {
+		require.True(t, svc.AllowOpenAIWSIngressSession(1))
+	}
+	require.Equal(t, int64(8), svc.SnapshotOpenAIWSIngressSessionMetrics().CreateRates[0].AcceptedTotal)
+
+	// 长时间无新建会话的 API Key 被清理。
+	now = now.Add(openAIWSSessionCreateIdleTTL)
+	require.True(t, svc.AllowOpenAIWSIngressSession(3))
+	rates := svc.SnapshotOpenAIWSIngressSessionMetrics().CreateRates
+	require.Len(t, rates, 1)
+	require.Equal(t, int64(3), rates[0].APIKeyID)
+}
@@ -0,0 +1,542 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	coderws "github.com/coder/websocket"
+	"github.com/tidwall/gjson"
+)
+
+// openAIWSIngressTurnRelay 承载 ingress 会话逐 turn 转发所需的会话级依赖与跨 turn 状态：
+// 把 turn 请求写往上游，读取上游事件下发给客户端，直到终止事件。会话内 turn 串行执行，无需加锁。
+type openAIWSIngressTurnRelay struct {
+	svc          *OpenAIGatewayService
+	ctx          context.Context
+	account      *Account
+	clientConn   *coderws.Conn
+	recorder     *openAIWSIngressSessionRecorder
+	ingressMode  string
+	debugEnabled bool
+
+	downstreamBufferSize int
+	slowClientPolicy     string
+	// gatewayTurnIDBase 会话内各 turn 的 gateway_turn_id 前缀，仅在开启 inject_gateway_turn_id 时使用。
+	gatewayTurnIDBase string
+
+	// progress 记录当前 turn 已下发给客户端的事件进度，供 ingress_mid_turn_reconnect_mode 在中途重连后续传或重置。
+	progress *openAIWSIngressTurnRelayProgress
+	// callIDs 记录当前 turn 上游输出的工具调用 call_id，turn 成功后作为下一轮 function_call_output 的校验依据。
+	callIDs map[string]struct{}
+}
+
+func newOpenAIWSIngressTurnRelay(
+	ctx context.Context,
+	s *OpenAIGatewayService,
+	account *Account,
+	clientConn *coderws.Conn,
+	recorder *openAIWSIngressSessionRecorder,
+	ingressMode string,
+	debugEnabled bool,
+) *openAIWSIngressTurnRelay {
+	return &openAIWSIngressTurnRelay{
+		svc:                  s,
+		ctx:                  ctx,
+		account:              account,
+		clientConn:           clientConn,
+		recorder:             recorder,
+		ingressMode:          ingressMode,
+		debugEnabled:         debugEnabled,
+		downstreamBufferSize: s.openAIWSIngressDownstreamBufferSize(),
+		slowClientPolicy:     s.openAIWSIngressSlowClientPolicy(),
+		gatewayTurnIDBase:    openAIWSGatewayTurnIDBase(ctx),
+		progress:             &openAIWSIngressTurnRelayProgress{maxSequence: -1},
+	}
+}
+
+func (r *openAIWSIngressTurnRelay) writeClientMessageWithContext(parent context.Context, message []byte) error {
+	writeCtx, cancel := context.WithTimeout(parent, r.svc.openAIWSWriteTimeout())
+	defer cancel()
+	return r.clientConn.Write(writeCtx, coderws.MessageText, message)
+}
+
+func (r *openAIWSIngressTurnRelay) writeClientMessage(message []byte) error {
+	return r.writeClientMessageWithContext(r.ctx, message)
+}
+
+// openAIWSIngressTurnAttempt 单次 sendAndRelay（一个 turn 的一次上游尝试）的转发状态。
+type openAIWSIngressTurnAttempt struct {
+	relay         *openAIWSIngressTurnRelay
+	turn          int
+	lease         *openAIWSConnLease
+	payload       []byte
+	originalModel string
+	start         time.Time
+
+	replayMode      string
+	replayReason    string
+	replayForwarded int
+	// wroteDownstream 本次尝试（或中途重连前的尝试）是否已向客户端下发过事件。
+	wroteDownstream bool
+
+	reqStream              bool
+	previousResponseID     string
+	previousResponseIDKind string
+	promptCacheKey         string
+	storeDisabled          bool
+	hasFunctionCallOutput  bool
+	gatewayTurnID          string
+	mappedModel            string
+	mappedModelBytes       []byte
+	needModelReplace       bool
+	heartbeat              *openAIWSIngressDownstreamHeartbeat
+	downstream             *openAIWSIngressDownstreamBuffer
+	releaseDisconnectDrain func()
+	clientDisconnected     bool
+
+	responseID          string
+	usage               OpenAIUsage
+	usageMissingMessage []byte
+	sawPartialUsage     bool
+	firstTokenMs        *int
+	eventCount          int
+	tokenEventCount     int
+	terminalEventCount  int
+	firstEventType      string
+	lastEventType       string
+}
+
+// sendAndRelay 把 payload 写往 lease 对应的上游连接并转发本 turn 的上游事件，直到终止事件或出错。
+func (r *openAIWSIngressTurnRelay) sendAndRelay(turn int, lease *openAIWSConnLease, payload []byte, payloadBytes int, originalModel string) (*OpenAIForwardResult, error) {
+	if lease == nil {
+		return nil, errors.New("upstream websocket lease is nil")
+	}
+	s := r.svc
+	r.callIDs = make(map[string]struct{})
+	t := &openAIWSIngressTurnAttempt{
+		relay:         r,
+		turn:          turn,
+		lease:         lease,
+		payload:       payload,
+		originalModel: originalModel,
+		start:         time.Now(),
+	}
+	t.replayMode, t.replayReason, t.replayForwarded = r.progress.beginAttempt()
+	// 中途重连后的重放：客户端已收到本 turn 的部分输出。
+	t.wroteDownstream = t.replayMode != ""
+	if err := lease.WriteJSONWithContextTimeout(r.ctx, json.RawMessage(payload), s.openAIWSWriteTimeout()); err != nil {
+		return nil, wrapOpenAIWSIngressTurnError(
+			"write_upstream",
+			fmt.Errorf("write upstream websocket request: %w", err),
+			false,
+		)
+	}
+	if r.debugEnabled {
+		logOpenAIWSModeDebug(
+			"ingress_ws_turn_request_sent account_id=%d turn=%d conn_id=%s payload_bytes=%d",
+			r.account.ID,
+			turn,
+			truncateOpenAIWSLogValue(lease.ConnID(), openAIWSIDValueMaxLen),
+			payloadBytes,
+		)
+	}
+
+	t.reqStream = openAIWSPayloadBoolFromRaw(payload, "stream", true)
+	t.previousResponseID = openAIWSPayloadStringFromRaw(payload, "previous_response_id")
+	t.previousResponseIDKind = ClassifyOpenAIPreviousResponseIDKind(t.previousResponseID)
+	t.promptCacheKey = openAIWSPayloadStringFromRaw(payload, "prompt_cache_key")
+	t.storeDisabled = s.isOpenAIWSStoreDisabledInRequestRaw(payload, r.account)
+	t.hasFunctionCallOutput = gjson.GetBytes(payload, `input.#(type=="function_call_output")`).Exists()
+	if t.reqStream {
+		t.heartbeat = startOpenAIWSIngressDownstreamHeartbeat(s.openAIWSIngressStreamHeartbeatInterval(), r.writeClientMessage)
+	}
+	defer t.heartbeat.stop()
+	t.downstream = startOpenAIWSIngressDownstreamBuffer(r.ctx, r.downstreamBufferSize, r.slowClientPolicy, s.openAIWSWriteTimeout(), r.writeClientMessageWithContext)
+	defer func() {
+		_ = t.downstream.flush()
+	}()
+	defer func() {
+		if t.releaseDisconnectDrain != nil {
+			t.releaseDisconnectDrain()
+		}
+	}()
+	if s.openAIWSInjectGatewayTurnIDEnabled() {
+		t.gatewayTurnID = openAIWSGatewayTurnID(r.gatewayTurnIDBase, turn)
+	}
+	if t.replayMode == openAIWSMidTurnReconnectReset {
+		if err := r.writeClientMessage(buildOpenAIWSTurnResetEvent(t.replayReason, t.replayForwarded, t.gatewayTurnID)); err != nil {
+			return nil, wrapOpenAIWSIngressTurnError(
+				"write_client",
+				fmt.Errorf("write client websocket turn reset event: %w", err),
+				true,
+			)
+		}
+		t.heartbeat.touch()
+	}
+	if originalModel != "" {
+		t.mappedModel = r.account.GetMappedModel(originalModel)
+		if normalizedModel := normalizeCodexModel(t.mappedModel); normalizedModel != "" {
+			t.mappedModel = normalizedModel
+		}
+		t.needModelReplace = t.mappedModel != "" && t.mappedModel != originalModel
+		if t.needModelReplace {
+			t.mappedModelBytes = []byte(t.mappedModel)
+		}
+	}
+	for {
+		upstreamMessage, readErr := lease.ReadMessageWithContextTimeout(r.ctx, s.openAIWSReadTimeoutForRequest(r.ctx))
+		if readErr != nil {
+			lease.MarkBroken()
+			r.progress.clientGone = t.clientDisconnected
+			return t.partialResult(), wrapOpenAIWSIngressTurnError(
+				"read_upstream",
+				fmt.Errorf("read upstream websocket event: %w", readErr),
+				t.wroteDownstream,
+			)
+		}
+		r.recorder.recordUpstream(upstreamMessage)
+
+		if !gjson.ValidBytes(upstreamMessage) {
+			if s.handleOpenAIWSMalformedUpstreamEvent(r.account.ID, lease.ConnID(), "ingress", upstreamMessage) {
+				lease.MarkBroken()
+				return t.partialResult(), wrapOpenAIWSIngressTurnError(
+					"malformed_upstream_event",
+					errOpenAIWSMalformedUpstreamEvent,
+					t.wroteDownstream,
+				)
+			}
+			continue
+		}
+		result, done, err := t.relayEvent(upstreamMessage)
+		if err != nil || done {
+			return result, err
+		}
+	}
+}
+
+// relayEvent 处理一条合法的上游事件；done 表示本 turn 已结束（终止事件或出错）。
+func (t *openAIWSIngressTurnAttempt) relayEvent(upstreamMessage []byte) (*OpenAIForwardResult, bool, error) {
+	r := t.relay
+	eventType, eventResponseID, _ := parseOpenAIWSEventEnvelope(upstreamMessage)
+	if t.responseID == "" && eventResponseID != "" {
+		t.responseID = eventResponseID
+	}
+	if eventType != "" {
+		t.eventCount++
+		if t.firstEventType == "" {
+			t.firstEventType = eventType
+		}
+		t.lastEventType = eventType
+	}
+	if eventType == "error" {
+		if err := t.handleErrorEvent(upstreamMessage); err != nil {
+			return nil, true, err
+		}
+	}
+	isTokenEvent := isOpenAIWSTokenEvent(eventType)
+	if isTokenEvent {
+		t.tokenEventCount++
+	}
+	isTerminalEvent := isOpenAIWSTerminalEvent(eventType)
+	if isTerminalEvent {
+		t.terminalEventCount++
+	}
+	if t.firstTokenMs == nil && isTokenEvent {
+		ms := int(time.Since(t.start).Milliseconds())
+		t.firstTokenMs = &ms
+	}
+	if openAIWSEventShouldParseUsage(eventType) {
+		parseOpenAIWSResponseUsageFromCompletedEvent(upstreamMessage, &t.usage)
+		if openAIWSCompletedEventMissingUsage(upstreamMessage) {
+			t.usageMissingMessage = upstreamMessage
+		} else {
+			t.usageMissingMessage = nil
+		}
+	} else if parseOpenAIWSPartialUsageFragment(upstreamMessage, &t.usage) {
+		t.sawPartialUsage = true
+	}
+
+	if isTerminalEvent {
+		// 终止事件下发前先停掉心跳，保证客户端不会在 turn 结束后再收到合成心跳。
+		t.heartbeat.stop()
+	}
+	if openAIWSEventMayContainToolCalls(eventType) {
+		collectOpenAIWSEventCallIDs(upstreamMessage, eventType, r.callIDs)
+	}
+	skipReplayed := false
+	if !t.clientDisconnected {
+		// resume 重放时跳过客户端已收到的事件；终止事件与 error 事件总是下发，避免重放较短时 turn 无法结束。
+		resuming := t.replayMode == openAIWSMidTurnReconnectResume && !isTerminalEvent && eventType != "error"
+		skipReplayed = r.progress.observe(upstreamMessage, resuming)
+	}
+	if !t.clientDisconnected && !skipReplayed {
+		if err := t.forwardToClient(upstreamMessage, eventType); err != nil {
+			return t.partialResult(), true, err
+		}
+	}
+	if !isTerminalEvent {
+		return nil, false, nil
+	}
+	if flushErr := t.downstream.flush(); flushErr != nil && !t.clientDisconnected {
+		if turnErr := t.handleClientWriteErr(flushErr); turnErr != nil {
+			return t.partialResult(), true, turnErr
+		}
+	}
+	return t.complete(), true, nil
+}
+
+// handleErrorEvent 记录上游 error 事件；可恢复的 previous_response_not_found 返回对应的 turn 错误，
+// 由上层去掉 previous_response_id 后重放当前 turn，其余 error 事件照常下发客户端。
+func (t *openAIWSIngressTurnAttempt) handleErrorEvent(upstreamMessage []byte) error {
+	r := t.relay
+	s := r.svc
+	errCodeRaw, errTypeRaw, errMsgRaw := parseOpenAIWSErrorEventFields(upstreamMessage)
+	s.persistOpenAIWSRateLimitSignal(r.ctx, r.account, t.lease.HandshakeHeaders(), upstreamMessage, errCodeRaw, errTypeRaw, errMsgRaw)
+	fallbackReason, _ := classifyOpenAIWSErrorEventFromRaw(errCodeRaw, errTypeRaw, errMsgRaw)
+	errCode, errType, errMessage := summarizeOpenAIWSErrorEventFieldsFromRaw(errCodeRaw, errTypeRaw, errMsgRaw)
+	if t.previousResponseID != "" && fallbackReason == openAIWSIngressStagePreviousResponseNotFound {
+		s.reportOpenAIAccountPreviousResponseOutcome(r.account.ID, true)
+	}
+	recoverablePrevNotFound := fallbackReason == openAIWSIngressStagePreviousResponseNotFound &&
+		t.previousResponseID != "" &&
+		!t.hasFunctionCallOutput &&
+		s.openAIWSIngressPreviousResponseRecoveryEnabled() &&
+		!t.wroteDownstream
+	if recoverablePrevNotFound {
+		// 可恢复场景使用非 error 关键字日志，避免被 LegacyPrintf 误判为 ERROR 级别。
+		logOpenAIWSModeInfo(
+			"ingress_ws_prev_response_recoverable account_id=%d turn=%d conn_id=%s idx=%d reason=%s code=%s type=%s message=%s previous_response_id=%s previous_response_id_kind=%s response_id=%s store_disabled=%v has_prompt_cache_key=%v",
+			r.account.ID,
+			t.turn,
+			truncateOpenAIWSLogValue(t.lease.ConnID(), openAIWSIDValueMaxLen),
+			t.eventCount,
+			truncateOpenAIWSLogValue(fallbackReason, openAIWSLogValueMaxLen),
+			errCode,
+			errType,
+			errMessage,
+			truncateOpenAIWSLogValue(t.previousResponseID, openAIWSIDValueMaxLen),
+			normalizeOpenAIWSLogValue(t.previousResponseIDKind),
+			truncateOpenAIWSLogValue(t.responseID, openAIWSIDValueMaxLen),
+			t.storeDisabled,
+			t.promptCacheKey != "",
+		)
+	} else {
+		logOpenAIWSModeInfo(
+			"ingress_ws_error_event account_id=%d turn=%d conn_id=%s idx=%d fallback_reason=%s err_code=%s err_type=%s err_message=%s previous_response_id=%s previous_response_id_kind=%s response_id=%s store_disabled=%v has_prompt_cache_key=%v",
+			r.account.ID,
+			t.turn,
+			truncateOpenAIWSLogValue(t.lease.ConnID(), openAIWSIDValueMaxLen),
+			t.eventCount,
+			truncateOpenAIWSLogValue(fallbackReason, openAIWSLogValueMaxLen),
+			errCode,
+			errType,
+			errMessage,
+			truncateOpenAIWSLogValue(t.previousResponseID, openAIWSIDValueMaxLen),
+			normalizeOpenAIWSLogValue(t.previousResponseIDKind),
+			truncateOpenAIWSLogValue(t.responseID, openAIWSIDValueMaxLen),
+			t.storeDisabled,
+			t.promptCacheKey != "",
+		)
+	}
+	if !recoverablePrevNotFound {
+		return nil
+	}
+	// previous_response_not_found 在 ingress 模式支持单次恢复重试：不把该 error 直接下发客户端。
+	t.lease.MarkBroken()
+	errMsg := strings.TrimSpace(errMsgRaw)
+	if errMsg == "" {
+		errMsg = "previous response not found"
+	}
+	return wrapOpenAIWSIngressTurnError(
+		openAIWSIngressStagePreviousResponseNotFound,
+		errors.New(errMsg),
+		false,
+	)
+}
+
+// forwardToClient 改写并下发一条上游事件；返回非 nil 时当前 turn 应立即结束。
+func (t *openAIWSIngressTurnAttempt) forwardToClient(upstreamMessage []byte, eventType string) error {
+	r := t.relay
+	s := r.svc
+	if t.needModelReplace && len(t.mappedModelBytes) > 0 && openAIWSEventMayContainModel(eventType) && bytes.Contains(upstreamMessage, t.mappedModelBytes) {
+		upstreamMessage = replaceOpenAIWSMessageModel(upstreamMessage, t.mappedModel, t.originalModel)
+	}
+	if t.gatewayTurnID != "" {
+		upstreamMessage = injectOpenAIWSGatewayTurnID(upstreamMessage, eventType, t.gatewayTurnID)
+	}
+	if openAIWSEventMayContainToolCalls(eventType) && openAIWSMessageLikelyContainsToolCalls(upstreamMessage) {
+		if corrected, changed := s.toolCorrector.CorrectToolCallsInSSEBytes(upstreamMessage); changed {
+			upstreamMessage = corrected
+		}
+	}
+	var writeErr error
+	if t.downstream == nil {
+		if writeErr = r.writeClientMessage(upstreamMessage); writeErr == nil {
+			t.wroteDownstream = true
+			// 真实事件开始下发后本 turn 不再需要合成心跳，即便后续出现长时间间隔。
+			t.heartbeat.stop()
+		}
+	} else {
+		outcome, enqueueErr := t.downstream.enqueue(upstreamMessage, eventType)
+		switch outcome {
+		case openAIWSDownstreamQueued:
+			t.wroteDownstream = true
+			t.heartbeat.stop()
+		case openAIWSDownstreamDropped:
+			s.openaiWSRelayMetrics.slowClientDroppedDelta.Add(1)
+		case openAIWSDownstreamSlowClient:
+			// 客户端消费过慢：断开客户端而不是阻塞上游读取，上游继续读完当前 turn 以便计费。
+			// 慢客户端无法及时完成关闭握手，这里直接关闭底层连接。
+			t.clientDisconnected = true
+			s.openaiWSRelayMetrics.slowClientDisconnect.Add(1)
+			_ = r.clientConn.CloseNow()
+			t.downstream.abort()
+			logOpenAIWSModeInfo(
+				"ingress_ws_slow_client_disconnect account_id=%d turn=%d conn_id=%s buffer_size=%d event=%s",
+				r.account.ID,
+				t.turn,
+				truncateOpenAIWSLogValue(t.lease.ConnID(), openAIWSIDValueMaxLen),
+				r.downstreamBufferSize,
+				truncateOpenAIWSLogValue(eventType, openAIWSLogValueMaxLen),
+			)
+			if drainErr := t.startDisconnectDrain(); drainErr != nil {
+				return drainErr
+			}
+		default:
+			writeErr = enqueueErr
+		}
+	}
+	if writeErr != nil {
+		return t.handleClientWriteErr(writeErr)
+	}
+	return nil
+}
+
+// startDisconnectDrain 客户端断连后申请 drain 名额；并发已满时中止上游并结束当前 turn。
+func (t *openAIWSIngressTurnAttempt) startDisconnectDrain() error {
+	release, ok := t.relay.svc.beginOpenAIWSDisconnectDrain()
+	if !ok {
+		t.lease.MarkBroken()
+		logOpenAIWSModeInfo(
+			"ingress_ws_client_disconnected_drain_saturated account_id=%d turn=%d conn_id=%s",
+			t.relay.account.ID,
+			t.turn,
+			truncateOpenAIWSLogValue(t.lease.ConnID(), openAIWSIDValueMaxLen),
+		)
+		return wrapOpenAIWSIngressTurnError("client_disconnect_drain_saturated", errOpenAIWSDisconnectDrainSaturated, t.wroteDownstream)
+	}
+	t.releaseDisconnectDrain = release
+	return nil
+}
+
+// handleClientWriteErr 处理客户端写入失败：客户端断连时转为仅读取上游直到 turn 结束，其余错误终止当前 turn。
+func (t *openAIWSIngressTurnAttempt) handleClientWriteErr(err error) error {
+	if !isOpenAIWSClientDisconnectError(err) {
+		return wrapOpenAIWSIngressTurnError(
+			"write_client",
+			fmt.Errorf("write client websocket event: %w", err),
+			t.wroteDownstream,
+		)
+	}
+	t.clientDisconnected = true
+	if drainErr := t.startDisconnectDrain(); drainErr != nil {
+		return drainErr
+	}
+	closeStatus, closeReason := summarizeOpenAIWSReadCloseError(err)
+	logOpenAIWSModeInfo(
+		"ingress_ws_client_disconnected_drain account_id=%d turn=%d conn_id=%s close_status=%s close_reason=%s",
+		t.relay.account.ID,
+		t.turn,
+		truncateOpenAIWSLogValue(t.lease.ConnID(), openAIWSIDValueMaxLen),
+		closeStatus,
+		truncateOpenAIWSLogValue(closeReason, openAIWSHeaderValueMaxLen),
+	)
+	return nil
+}
+
+// partialResult 在 turn 已向客户端输出后失败时，携带尽力解析到的 usage 片段供计费；
+// 未下发任何内容或未观测到 usage 时返回 nil，保持原有“失败 turn 不计费”语义。
+func (t *openAIWSIngressTurnAttempt) partialResult() *OpenAIForwardResult {
+	if !t.wroteDownstream || !t.sawPartialUsage {
+		return nil
+	}
+	if t.usage.InputTokens <= 0 && t.usage.OutputTokens <= 0 && t.usage.CacheReadInputTokens <= 0 {
+		return nil
+	}
+	result := t.result()
+	result.PartialUsage = true
+	return result
+}
+
+func (t *openAIWSIngressTurnAttempt) result() *OpenAIForwardResult {
+	return &OpenAIForwardResult{
+		RequestID:        t.responseID,
+		Usage:            t.usage,
+		Model:            t.originalModel,
+		ServiceTier:      extractOpenAIServiceTierFromBody(t.payload),
+		ReasoningEffort:  extractOpenAIReasoningEffortFromBody(t.payload, t.originalModel),
+		Stream:           t.reqStream,
+		OpenAIWSMode:     true,
+		OpenAIWSConnMode: t.relay.ingressMode,
+		ResponseHeaders:  t.lease.HandshakeHeaders(),
+		Duration:         time.Since(t.start),
+		FirstTokenMs:     t.firstTokenMs,
+	}
+}
+
+// complete 在终止事件下发后收尾：记录日志与续链结果，返回本 turn 的计费结果。
+func (t *openAIWSIngressTurnAttempt) complete() *OpenAIForwardResult {
+	r := t.relay
+	s := r.svc
+	// 客户端已断连时，上游连接的 session 状态不可信，标记 broken 避免回池复用。
+	if t.clientDisconnected {
+		t.lease.MarkBroken()
+	}
+	if t.replayMode != "" {
+		logOpenAIWSModeInfo(
+			"ingress_ws_mid_turn_replay_completed account_id=%d turn=%d conn_id=%s mode=%s reason=%s previously_forwarded=%d skipped_events=%d response_id=%s",
+			r.account.ID,
+			t.turn,
+			truncateOpenAIWSLogValue(t.lease.ConnID(), openAIWSIDValueMaxLen),
+			normalizeOpenAIWSLogValue(t.replayMode),
+			normalizeOpenAIWSLogValue(t.replayReason),
+			t.replayForwarded,
+			r.progress.skipped,
+			truncateOpenAIWSLogValue(t.responseID, openAIWSIDValueMaxLen),
+		)
+	}
+	if r.debugEnabled {
+		firstTokenMsValue := -1
+		if t.firstTokenMs != nil {
+			firstTokenMsValue = *t.firstTokenMs
+		}
+		logOpenAIWSModeDebug(
+			"ingress_ws_turn_completed account_id=%d turn=%d conn_id=%s response_id=%s duration_ms=%d events=%d token_events=%d terminal_events=%d first_event=%s last_event=%s first_token_ms=%d client_disconnected=%v",
+			r.account.ID,
+			t.turn,
+			truncateOpenAIWSLogValue(t.lease.ConnID(), openAIWSIDValueMaxLen),
+			truncateOpenAIWSLogValue(t.responseID, openAIWSIDValueMaxLen),
+			time.Since(t.start).Milliseconds(),
+			t.eventCount,
+			t.tokenEventCount,
+			t.terminalEventCount,
+			truncateOpenAIWSLogValue(t.firstEventType, openAIWSLogValueMaxLen),
+			truncateOpenAIWSLogValue(t.lastEventType, openAIWSLogValueMaxLen),
+			firstTokenMsValue,
+			t.clientDisconnected,
+		)
+	}
+	if t.previousResponseID != "" {
+		s.reportOpenAIAccountPreviousResponseOutcome(r.account.ID, false)
+	}
+	result := t.result()
+	if t.usageMissingMessage != nil {
+		s.applyOpenAIWSUsageMissingPolicy(result, t.payload, t.usageMissingMessage)
+	}
+	return result
+}
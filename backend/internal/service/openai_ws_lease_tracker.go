@@ -0,0 +1,164 @@
+package service
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// openAIWSLeaseHoldBucketsMs 为连接租约持有时长直方图的桶上界（毫秒），最后一个桶为 +Inf。
+// 普通 turn 通常在分钟内释放，ingress 会话租约跨整个会话，因此上界覆盖到小时级。
+var openAIWSLeaseHoldBucketsMs = [...]int64{1000, 5000, 30000, 60000, 300000, 900000, 3600000}
+
+// openAIWSLeaseHoldHistogram 记录已释放租约的持有时长分布（从 Acquire 成功到 Release）。
+type openAIWSLeaseHoldHistogram struct {
+	counts [len(openAIWSLeaseHoldBucketsMs) + 1]atomic.Int64
+	sumMs  atomic.Int64
+	maxMs  atomic.Int64
+}
+
+// OpenAIWSLeaseHoldSnapshot 租约持有时长分布快照；分位值取所在桶的上界，落入 +Inf 桶时取观测最大值。
+type OpenAIWSLeaseHoldSnapshot struct {
+	Count   int64
+	SumMs   int64
+	MaxMs   int64
+	P50Ms   int64
+	P95Ms   int64
+	P99Ms   int64
+	Buckets []OpenAIWSDialLatencyBucket
+}
+
+// OpenAIWSHeldLeaseSnapshot 当前未释放的单个租约。
+type OpenAIWSHeldLeaseSnapshot struct {
+	AccountID int64
+	ConnID    string
+	AgeMs     int64
+	// Leaked 是否已超过 lease_leak_threshold_seconds 并被巡检报告。
+	Leaked bool
+}
+
+func (h *openAIWSLeaseHoldHistogram) observe(hold time.Duration) {
+	ms := hold.Milliseconds()
+	if ms < 0 {
+		ms = 0
+	}
+	idx := len(openAIWSLeaseHoldBucketsMs)
+	for i, upper := range openAIWSLeaseHoldBucketsMs {
+		if ms <= upper {
+			idx = i
+			break
+		}
+	}
+	h.counts[idx].Add(1)
+	h.sumMs.Add(ms)
+	for {
+		current := h.maxMs.Load()
+		if ms <= current || h.maxMs.CompareAndSwap(current, ms) {
+			return
+		}
+	}
+}
+
+func (h *openAIWSLeaseHoldHistogram) snapshot() OpenAIWSLeaseHoldSnapshot {
+	// 复用建连耗时快照的分桶分位估算。
+	latency := OpenAIWSDialLatencySnapshot{
+		SumMs:   h.sumMs.Load(),
+		MaxMs:   h.maxMs.Load(),
+		Buckets: make([]OpenAIWSDialLatencyBucket, 0, len(h.counts)),
+	}
+	for i := range h.counts {
+		bucket := OpenAIWSDialLatencyBucket{Count: h.counts[i].Load()}
+		if i < len(openAIWSLeaseHoldBucketsMs) {
+			bucket.UpperMs = openAIWSLeaseHoldBucketsMs[i]
+		}
+		latency.Count += bucket.Count
+		latency.Buckets = append(latency.Buckets, bucket)
+	}
+	return OpenAIWSLeaseHoldSnapshot{
+		Count:   latency.Count,
+		SumMs:   latency.SumMs,
+		MaxMs:   latency.MaxMs,
+		P50Ms:   latency.quantileMs(0.50),
+		P95Ms:   latency.quantileMs(0.95),
+		P99Ms:   latency.quantileMs(0.99),
+		Buckets: latency.Buckets,
+	}
+}
+
+// trackLease 登记 Acquire 成功返回的租约，Release 时由 untrackLease 注销。
+// 始终满足 leaseAcquireTotal - leaseReleaseTotal = 当前持有租约数。
+func (p *openAIWSConnPool) trackLease(lease *openAIWSConnLease) {
+	if p == nil || lease == nil || lease.conn == nil {
+		return
+	}
+	lease.acquiredAt = time.Now()
+	lease.tracked = true
+	p.leases.Store(lease, struct{}{})
+	p.metrics.leaseAcquireTotal.Add(1)
+}
+
+func (p *openAIWSConnPool) untrackLease(lease *openAIWSConnLease) {
+	if p == nil || lease == nil || !lease.tracked {
+		return
+	}
+	p.leases.Delete(lease)
+	p.metrics.leaseReleaseTotal.Add(1)
+	p.leaseHold.observe(time.Since(lease.acquiredAt))
+}
+
+func (p *openAIWSConnPool) leaseLeakThreshold() time.Duration {
+	if p != nil && p.cfg != nil && p.cfg.Gateway.OpenAIWS.LeaseLeakThresholdSeconds > 0 {
+		return time.Duration(p.cfg.Gateway.OpenAIWS.LeaseLeakThresholdSeconds) * time.Second
+	}
+	return 0
+}
+
+// runLeaseLeakSweep 巡检持有超过阈值的租约：每个租约只报告一次（告警日志 + leaseLeakTotal），不强制回收。
+func (p *openAIWSConnPool) runLeaseLeakSweep(now time.Time) {
+	threshold := p.leaseLeakThreshold()
+	if threshold <= 0 {
+		return
+	}
+	p.leases.Range(func(key, _ any) bool {
+		lease, ok := key.(*openAIWSConnLease)
+		if !ok || lease == nil {
+			return true
+		}
+		age := now.Sub(lease.acquiredAt)
+		if age < threshold || !lease.leakReported.CompareAndSwap(false, true) {
+			return true
+		}
+		p.metrics.leaseLeakTotal.Add(1)
+		logger.L().Warn(
+			"openai.ws_lease_held_beyond_threshold",
+			zap.Int64("account_id", lease.accountID),
+			zap.String("conn_id", lease.ConnID()),
+			zap.Int64("held_ms", age.Milliseconds()),
+			zap.Int64("threshold_ms", threshold.Milliseconds()),
+		)
+		return true
+	})
+}
+
+// snapshotHeldLeases 返回当前未释放的租约，按持有时长从长到短排序。
+func (p *openAIWSConnPool) snapshotHeldLeases(now time.Time) []OpenAIWSHeldLeaseSnapshot {
+	held := make([]OpenAIWSHeldLeaseSnapshot, 0)
+	p.leases.Range(func(key, _ any) bool {
+		lease, ok := key.(*openAIWSConnLease)
+		if !ok || lease == nil {
+			return true
+		}
+		held = append(held, OpenAIWSHeldLeaseSnapshot{
+			AccountID: lease.accountID,
+			ConnID:    lease.ConnID(),
+			AgeMs:     now.Sub(lease.acquiredAt).Milliseconds(),
+			Leaked:    lease.leakReported.Load(),
+		})
+		return true
+	})
+	sort.Slice(held, func(i, j int) bool { return held[i].AgeMs > held[j].AgeMs })
+	return held
+}
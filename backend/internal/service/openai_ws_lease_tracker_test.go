@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIWSConnPool_LeaseLeakSweep(t *testing.T) {
+	cfg := newOpenAIWSIngressCaptureTestConfig()
+	cfg.Gateway.OpenAIWS.LeaseLeakThresholdSeconds = 60
+	pool := newOpenAIWSConnPool(cfg)
+	defer pool.Close()
+	pool.setClientDialerForTest(&openAIWSQueueDialer{conns: []openAIWSClientConn{&openAIWSCaptureConn{}}})
+	account := &Account{ID: 131, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Concurrency: 1}
+
+	lease, err := pool.Acquire(context.Background(), openAIWSAcquireRequest{
+		Account: account,
+		WSURL:   "wss://example.com/v1/responses",
+	})
+	require.NoError(t, err)
+
+	metrics := pool.SnapshotMetrics()
+	require.Equal(t, int64(1), metrics.LeasesHeld)
+	require.Len(t, metrics.HeldLeases, 1)
+	require.Equal(t, account.ID, metrics.HeldLeases[0].AccountID)
+	require.Equal(t, lease.ConnID(), metrics.HeldLeases[0].ConnID)
+
+	pool.runLeaseLeakSweep(time.Now().Add(30 * time.Second))
+	require.Zero(t, pool.SnapshotMetrics().LeaseLeakTotal)
+	// 超过阈值的租约只报告一次。
+	pool.runLeaseLeakSweep(time.Now().Add(2 * time.Minute))
+	pool.runLeaseLeakSweep(time.Now().Add(3 * time.Minute))
+	metrics = pool.SnapshotMetrics()
+	require.Equal(t, int64(1), metrics.LeaseLeakTotal)
+	require.True(t, metrics.HeldLeases[0].Leaked)
+
+	lease.Release()
+	lease.Release()
+	metrics = pool.SnapshotMetrics()
+	require.Equal(t, int64(1), metrics.LeaseAcquireTotal)
+	require.Equal(t, int64(1), metrics.LeaseReleaseTotal)
+	require.Zero(t, metrics.LeasesHeld)
+	require.Empty(t, metrics.HeldLeases)
+	require.Equal(t, int64(1), metrics.LeaseHold.Count)
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_LeaseAccountingBalances(t *testing.T) {
+	account := &Account{
+		ID:          132,
+		Name:        "openai-ingress-lease-accounting",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{"api_key": "sk-test"},
+		Extra:       map[string]any{"responses_websockets_v2_enabled": true},
+	}
+	cfg := newOpenAIWSIngressCaptureTestConfig()
+	pool := newOpenAIWSConnPool(cfg)
+	defer pool.Close()
+	pool.setClientDialerForTest(&openAIWSQueueDialer{conns: []openAIWSClientConn{
+		&openAIWSCaptureConn{
+			events: [][]byte{
+				[]byte(`{"type":"response.completed","response":{"id":"resp_lease_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+				[]byte(`{"type":"response.completed","response":{"id":"resp_lease_2","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+			},
+		},
+	}})
+	svc := &OpenAIGatewayService{
+		cfg:              cfg,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     pool,
+	}
+	clientMessages := [][]byte{
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"input":[{"type":"input_text","text":"a"}]}`),
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"previous_response_id":"resp_lease_1","input":[{"type":"input_text","text":"b"}]}`),
+	}
+	received := runOpenAIWSIngressSessionWithServiceForTest(t, svc, account, "sk-test", clientMessages, nil)
+	require.Len(t, received, 2)
+
+	// 会话结束后所有租约均已释放，且获取/释放计数与 AcquireTotal 对账一致。
+	require.Eventually(t, func() bool {
+		return pool.SnapshotMetrics().LeasesHeld == 0
+	}, 2*time.Second, 10*time.Millisecond)
+	metrics := pool.SnapshotMetrics()
+	require.Positive(t, metrics.LeaseAcquireTotal)
+	require.Equal(t, metrics.AcquireTotal, metrics.LeaseAcquireTotal)
+	require.Equal(t, metrics.LeaseAcquireTotal, metrics.LeaseReleaseTotal)
+	require.Equal(t, metrics.LeaseReleaseTotal, metrics.LeaseHold.Count)
+	require.Empty(t, metrics.HeldLeases)
+	require.Zero(t, metrics.LeaseLeakTotal)
+}
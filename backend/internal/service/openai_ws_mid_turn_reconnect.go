@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	openAIWSMidTurnReconnectOff    = "off"
+	openAIWSMidTurnReconnectResume = "resume"
+	openAIWSMidTurnReconnectReset  = "reset"
+
+	// openAIWSTurnResetEventType reset 模式下重放前下发给客户端的标记事件类型。
+	openAIWSTurnResetEventType = "gateway.turn_reset"
+)
+
+// openAIWSIngressMidTurnReconnectMode 返回 turn 已向客户端下发部分事件后上游读取失败时的重连方式。
+func (s *OpenAIGatewayService) openAIWSIngressMidTurnReconnectMode() string {
+	if s == nil || s.cfg == nil {
+		return openAIWSMidTurnReconnectOff
+	}
+	switch strings.TrimSpace(s.cfg.Gateway.OpenAIWS.IngressMidTurnReconnectMode) {
+	case openAIWSMidTurnReconnectResume:
+		return openAIWSMidTurnReconnectResume
+	case openAIWSMidTurnReconnectReset:
+		return openAIWSMidTurnReconnectReset
+	default:
+		return openAIWSMidTurnReconnectOff
+	}
+}
+
+// openAIWSIngressTurnRelayProgress 记录当前 turn 已下发给客户端的事件进度。
+// 每个到达下发环节的上游事件按出现顺序占一个位置（慢客户端策略丢弃的事件同样占位），
+// 同时记录已下发事件中最大的 sequence_number；turn 中途重连重放时据此决定跳过哪些事件。
+type openAIWSIngressTurnRelayProgress struct {
+	forwarded   int
+	maxSequence int64
+	clientGone  bool
+
+	// replayMode 非空表示当前为中途重连后的重放（resume/reset），仅对下一次 attempt 生效。
+	replayMode   string
+	replayReason string
+	// position 当前 attempt 中已到达下发环节的事件数。
+	position int
+	skipped  int
+}
+
+// armReplay 标记下一次 attempt 为中途重连后的重放。
+func (p *openAIWSIngressTurnRelayProgress) armReplay(mode, reason string) {
+	p.replayMode = mode
+	p.replayReason = reason
+}
+
+// beginAttempt 在每次发送 turn 请求前调用：非重放与 reset 重放时清空进度，resume 重放时保留已下发进度。
+// 返回本次 attempt 的重放模式（空表示正常 attempt）、重放原因与此前已下发的事件数。
+func (p *openAIWSIngressTurnRelayProgress) beginAttempt() (mode, reason string, forwarded int) {
+	mode, reason, forwarded = p.replayMode, p.replayReason, p.forwarded
+	p.replayMode, p.replayReason = "", ""
+	p.position = 0
+	p.skipped = 0
+	p.clientGone = false
+	if mode != openAIWSMidTurnReconnectResume {
+		p.forwarded = 0
+		p.maxSequence = -1
+	}
+	return mode, reason, forwarded
+}
+
+// observe 在事件下发前调用，返回是否应跳过该事件（仅 resume 重放时跳过已下发过的部分）。
+// 带 sequence_number 的事件按序号比较，缺失时按事件位置比较。
+func (p *openAIWSIngressTurnRelayProgress) observe(message []byte, resuming bool) bool {
+	p.position++
+	sequence := int64(-1)
+	if value := gjson.GetBytes(message, "sequence_number"); value.Type == gjson.Number {
+		sequence = value.Int()
+	}
+	if resuming {
+		alreadyForwarded := p.position <= p.forwarded
+		if sequence >= 0 && p.maxSequence >= 0 {
+			alreadyForwarded = sequence <= p.maxSequence
+		}
+		if alreadyForwarded {
+			p.skipped++
+			return true
+		}
+	}
+	if p.position > p.forwarded {
+		p.forwarded = p.position
+	}
+	if sequence > p.maxSequence {
+		p.maxSequence = sequence
+	}
+	return false
+}
+
+// canReconnect 判断已向客户端下发部分事件的 turn 失败后能否按 mode 重连重放：
+// 仅限上游读取失败（连接中断、健康检查判定断开等），客户端已断开或请求被取消时不重放。
+func (p *openAIWSIngressTurnRelayProgress) canReconnect(err error, mode string) bool {
+	if mode != openAIWSMidTurnReconnectResume && mode != openAIWSMidTurnReconnectReset {
+		return false
+	}
+	if p.clientGone || p.forwarded == 0 {
+		return false
+	}
+	var turnErr *openAIWSIngressTurnError
+	if !errors.As(err, &turnErr) || turnErr == nil || !turnErr.wroteDownstream {
+		return false
+	}
+	if errors.Is(turnErr.cause, context.Canceled) || errors.Is(turnErr.cause, context.DeadlineExceeded) {
+		return false
+	}
+	return turnErr.stage == "read_upstream"
+}
+
+// openAIWSTurnResetEvent reset 模式的标记事件：客户端收到后应丢弃本 turn 此前收到的部分输出，
+// 随后的事件为重放 turn 的完整输出。
+type openAIWSTurnResetEvent struct {
+	Type            string `json:"type"`
+	Reason          string `json:"reason"`
+	DiscardedEvents int    `json:"discarded_events"`
+	GatewayTurnID   string `json:"gateway_turn_id,omitempty"`
+}
+
+func buildOpenAIWSTurnResetEvent(reason string, discardedEvents int, gatewayTurnID string) []byte {
+	payload, _ := json.Marshal(openAIWSTurnResetEvent{
+		Type:            openAIWSTurnResetEventType,
+		Reason:          reason,
+		DiscardedEvents: discardedEvents,
+		GatewayTurnID:   gatewayTurnID,
+	})
+	return payload
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestOpenAIWSIngressTurnRelayProgress_ResumeSkipsForwardedEvents(t *testing.T) {
+	progress := &openAIWSIngressTurnRelayProgress{maxSequence: -1}
+	mode, _, _ := progress.beginAttempt()
+	require.Empty(t, mode)
+	require.False(t, progress.observe([]byte(`{"type":"response.created","sequence_number":0}`), false))
+	require.False(t, progress.observe([]byte(`{"type":"response.output_text.delta","sequence_number":1}`), false))
+
+	err := wrapOpenAIWSIngressTurnError("read_upstream", io.EOF, true)
+	require.False(t, progress.canReconnect(err, openAIWSMidTurnReconnectOff))
+	require.True(t, progress.canReconnect(err, openAIWSMidTurnReconnectResume))
+	require.False(t, progress.canReconnect(wrapOpenAIWSIngressTurnError("read_upstream", context.Canceled, true), openAIWSMidTurnReconnectResume))
+	require.False(t, progress.canReconnect(wrapOpenAIWSIngressTurnError("write_client", errors.New("broken pipe"), true), openAIWSMidTurnReconnectResume))
+
+	progress.armReplay(openAIWSMidTurnReconnectResume, "read_upstream")
+	mode, reason, forwarded := progress.beginAttempt()
+	require.Equal(t, openAIWSMidTurnReconnectResume, mode)
+	require.Equal(t, "read_upstream", reason)
+	require.Equal(t, 2, forwarded)
+	require.True(t, progress.observe([]byte(`{"type":"response.created","sequence_number":0}`), true))
+	require.True(t, progress.observe([]byte(`{"type":"response.output_text.delta","sequence_number":1}`), true))
+	require.False(t, progress.observe([]byte(`{"type":"response.output_text.delta","sequence_number":2}`), true))
+	require.Equal(t, 2, progress.skipped)
+
+	// 缺少 sequence_number 时按事件位置判定。
+	progress = &openAIWSIngressTurnRelayProgress{maxSequence: -1}
+	progress.beginAttempt()
+	progress.observe([]byte(`{"type":"response.created"}`), false)
+	progress.armReplay(openAIWSMidTurnReconnectResume, "read_upstream")
+	progress.beginAttempt()
+	require.True(t, progress.observe([]byte(`{"type":"response.created"}`), true))
+	require.False(t, progress.observe([]byte(`{"type":"response.output_text.delta"}`), true))
+
+	// reset 重放不保留已下发进度。
+	progress.armReplay(openAIWSMidTurnReconnectReset, "read_upstream")
+	mode, _, forwarded = progress.beginAttempt()
+	require.Equal(t, openAIWSMidTurnReconnectReset, mode)
+	require.Equal(t, 2, forwarded)
+	require.False(t, progress.observe([]byte(`{"type":"response.created"}`), false))
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_MidTurnReconnect(t *testing.T) {
+	account := &Account{
+		ID:          122,
+		Name:        "openai-ingress-mid-turn-reconnect",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{"api_key": "sk-test"},
+		Extra:       map[string]any{"responses_websockets_v2_enabled": true},
+	}
+	clientMessages := [][]byte{
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":true,"input":[{"type":"input_text","text":"hello"}]}`),
+	}
+	newUpstreams := func() []openAIWSClientConn {
+		return []openAIWSClientConn{
+			// 首个连接输出部分事件后断开（io.EOF）。
+			&openAIWSCaptureConn{
+				events: [][]byte{
+					[]byte(`{"type":"response.created","sequence_number":0,"response":{"id":"resp_mid_1","model":"gpt-5.1"}}`),
+					[]byte(`{"type":"response.output_text.delta","sequence_number":1,"delta":"Hel"}`),
+				},
+			},
+			&openAIWSCaptureConn{
+				events: [][]byte{
+					[]byte(`{"type":"response.created","sequence_number":0,"response":{"id":"resp_mid_2","model":"gpt-5.1"}}`),
+					[]byte(`{"type":"response.output_text.delta","sequence_number":1,"delta":"Hel"}`),
+					[]byte(`{"type":"response.output_text.delta","sequence_number":2,"delta":"lo"}`),
+					[]byte(`{"type":"response.completed","sequence_number":3,"response":{"id":"resp_mid_2","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":2}}}`),
+				},
+			},
+		}
+	}
+	eventSummary := func(messages [][]byte) []string {
+		summary := make([]string, 0, len(messages))
+		for _, message := range messages {
+			eventType := gjson.GetBytes(message, "type").String()
+			if delta := gjson.GetBytes(message, "delta").String(); delta != "" {
+				eventType += ":" + delta
+			}
+			summary = append(summary, eventType)
+		}
+		return summary
+	}
+
+	cases := []struct {
+		mode string
+		want []string
+	}{
+		{
+			mode: "resume",
+			want: []string{"response.created", "response.output_text.delta:Hel", "response.output_text.delta:lo", "response.completed"},
+		},
+		{
+			mode: "reset",
+			want: []string{
+				"response.created", "response.output_text.delta:Hel",
+				openAIWSTurnResetEventType,
+				"response.created", "response.output_text.delta:Hel", "response.output_text.delta:lo", "response.completed",
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.mode, func(t *testing.T) {
+			cfg := newOpenAIWSIngressCaptureTestConfig()
+			cfg.Gateway.OpenAIWS.IngressMidTurnReconnectMode = tc.mode
+			dialer := &openAIWSQueueDialer{conns: newUpstreams()}
+			pool := newOpenAIWSConnPool(cfg)
+			pool.setClientDialerForTest(dialer)
+			svc := &OpenAIGatewayService{
+				cfg:              cfg,
+				httpUpstream:     &httpUpstreamRecorder{},
+				cache:            &stubGatewayCache{},
+				openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+				toolCorrector:    NewCodexToolCorrector(),
+				openaiWSPool:     pool,
+			}
+			var turnResult *OpenAIForwardResult
+			hooks := &OpenAIWSIngressHooks{
+				AfterTurn: func(_ int, result *OpenAIForwardResult, turnErr error) {
+					if turnErr == nil {
+						turnResult = result
+					}
+				},
+			}
+			received := runOpenAIWSIngressSessionWithServiceForTest(t, svc, account, "sk-test", clientMessages, hooks)
+			require.Equal(t, tc.want, eventSummary(received))
+			require.Equal(t, 2, dialer.DialCount())
+
+			require.NotNil(t, turnResult)
+			require.Equal(t, "resp_mid_2", turnResult.RequestID)
+			require.Equal(t, []string{openAIWSRecoveryTurnRetry}, turnResult.RecoveryMitigations)
+			if tc.mode == "reset" {
+				reset := received[2]
+				require.Equal(t, "read_upstream", gjson.GetBytes(reset, "reason").String())
+				require.Equal(t, int64(2), gjson.GetBytes(reset, "discarded_events").Int())
+			}
+		})
+	}
+}
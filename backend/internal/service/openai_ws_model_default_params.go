@@ -0,0 +1,134 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// openAIWSModelDefaultParams 预编译的单个模型默认参数；params 复用改写规则结构（op 固定为 set）。
+type openAIWSModelDefaultParams struct {
+	pattern string
+	prefix  bool
+	params  []openAIWSRequestRewriteRule
+}
+
+// compileOpenAIWSModelDefaultParams 编译 model_default_params；非法条目已在配置加载时拒绝，这里仅防御性跳过。
+func compileOpenAIWSModelDefaultParams(defaults []config.GatewayOpenAIWSModelDefaultParams) []openAIWSModelDefaultParams {
+	compiled := make([]openAIWSModelDefaultParams, 0, len(defaults))
+	for _, modelDefault := range defaults {
+		pattern, prefix := strings.CutSuffix(strings.ToLower(strings.TrimSpace(modelDefault.Model)), "*")
+		if pattern == "" {
+			continue
+		}
+		next := openAIWSModelDefaultParams{pattern: pattern, prefix: prefix}
+		for _, param := range modelDefault.Params {
+			segments, ok := config.SplitOpenAIWSRequestRewritePath(param.Path)
+			if !ok {
+				continue
+			}
+			if _, protected := config.OpenAIWSRequestRewriteProtectedFields[segments[0]]; protected {
+				continue
+			}
+			raw, err := json.Marshal(param.Value)
+			if err != nil || param.Value == nil {
+				continue
+			}
+			next.params = append(next.params, openAIWSRequestRewriteRule{
+				op:       openAIWSRequestRewriteOpSet,
+				path:     strings.Join(segments, "."),
+				segments: segments,
+				rawValue: raw,
+			})
+		}
+		if len(next.params) > 0 {
+			compiled = append(compiled, next)
+		}
+	}
+	return compiled
+}
+
+// openAIWSModelDefaultParamRules 返回上游模型命中的默认参数：精确匹配优先，其次最长前缀；未命中返回 nil。
+func (s *OpenAIGatewayService) openAIWSModelDefaultParamRules(model string) []openAIWSRequestRewriteRule {
+	model = strings.ToLower(strings.TrimSpace(model))
+	if s == nil || s.cfg == nil || model == "" {
+		return nil
+	}
+	s.openaiWSModelDefaultsOnce.Do(func() {
+		s.openaiWSModelDefaults = compileOpenAIWSModelDefaultParams(s.cfg.Gateway.OpenAIWS.ModelDefaultParams)
+	})
+	var matched []openAIWSRequestRewriteRule
+	matchedPrefixLen := -1
+	for _, modelDefault := range s.openaiWSModelDefaults {
+		if !modelDefault.prefix {
+			if modelDefault.pattern == model {
+				return modelDefault.params
+			}
+			continue
+		}
+		if strings.HasPrefix(model, modelDefault.pattern) && len(modelDefault.pattern) > matchedPrefixLen {
+			matched = modelDefault.params
+			matchedPrefixLen = len(modelDefault.pattern)
+		}
+	}
+	return matched
+}
+
+// applyOpenAIWSModelDefaultParamsRaw 将默认参数合并进原始 JSON 请求体：路径已存在（客户端已指定）或
+// 沿途存在非对象字段时跳过，因此重复执行（如全量重放）结果逐字节一致。
+func applyOpenAIWSModelDefaultParamsRaw(payload []byte, rules []openAIWSRequestRewriteRule) ([]byte, error) {
+	for _, rule := range rules {
+		if !openAIWSRawPathSettable(payload, rule.segments) {
+			continue
+		}
+		next, err := sjson.SetRawBytes(payload, rule.path, rule.rawValue)
+		if err != nil {
+			return nil, err
+		}
+		payload = next
+	}
+	return payload, nil
+}
+
+func openAIWSRawPathSettable(payload []byte, segments []string) bool {
+	for i := 1; i < len(segments); i++ {
+		parent := gjson.GetBytes(payload, strings.Join(segments[:i], "."))
+		if !parent.Exists() {
+			return true
+		}
+		if !parent.IsObject() {
+			return false
+		}
+	}
+	return !gjson.GetBytes(payload, strings.Join(segments, ".")).Exists()
+}
+
+// applyOpenAIWSModelDefaultParamsMap 对 map 形式的请求体合并默认参数，语义与 applyOpenAIWSModelDefaultParamsRaw 一致；
+// 写入沿用改写规则的写时复制，不会修改调用方共享的原始请求体。
+func applyOpenAIWSModelDefaultParamsMap(payload map[string]any, rules []openAIWSRequestRewriteRule) {
+	for i, rule := range rules {
+		if openAIWSMapPathSettable(payload, rule.segments) {
+			applyOpenAIWSRequestRewriteMap(payload, rules[i:i+1])
+		}
+	}
+}
+
+func openAIWSMapPathSettable(payload map[string]any, segments []string) bool {
+	parent := payload
+	for _, segment := range segments[:len(segments)-1] {
+		value, exists := parent[segment]
+		if !exists {
+			return true
+		}
+		child, ok := value.(map[string]any)
+		if !ok {
+			return false
+		}
+		parent = child
+	}
+	_, exists := parent[segments[len(segments)-1]]
+	return !exists
+}
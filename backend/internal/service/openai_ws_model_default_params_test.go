@@ -0,0 +1,89 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func newOpenAIWSModelDefaultParamsTestService() *OpenAIGatewayService {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.ModelDefaultParams = []config.GatewayOpenAIWSModelDefaultParams{
+		{Model: "gpt-5*", Params: []config.GatewayOpenAIWSModelDefaultParam{
+			{Path: "reasoning.effort", Value: "medium"},
+			{Path: "service_tier", Value: "flex"},
+		}},
+		{Model: "GPT-5.1-Codex", Params: []config.GatewayOpenAIWSModelDefaultParam{
+			{Path: "reasoning.effort", Value: "high"},
+			{Path: "text", Value: map[string]any{"verbosity": "low"}},
+		}},
+	}
+	return &OpenAIGatewayService{cfg: cfg}
+}
+
+func TestOpenAIWSModelDefaultParams_ClientOverridesWin(t *testing.T) {
+	svc := newOpenAIWSModelDefaultParamsTestService()
+	require.Len(t, svc.openAIWSModelDefaultParamRules("gpt-5.1"), 2)
+	// 精确匹配优先于前缀匹配，大小写不敏感。
+	require.Equal(t, `"high"`, string(svc.openAIWSModelDefaultParamRules("gpt-5.1-codex")[0].rawValue))
+	require.Nil(t, svc.openAIWSModelDefaultParamRules("o3"))
+
+	rules := svc.openAIWSModelDefaultParamRules("gpt-5.1")
+	// 未携带的字段写入默认值；同一对象内客户端已有的字段保留。
+	raw := []byte(`{"type":"response.create","model":"gpt-5.1","reasoning":{"summary":"auto"}}`)
+	merged, err := applyOpenAIWSModelDefaultParamsRaw(raw, rules)
+	require.NoError(t, err)
+	require.Equal(t, "medium", gjson.GetBytes(merged, "reasoning.effort").String())
+	require.Equal(t, "auto", gjson.GetBytes(merged, "reasoning.summary").String())
+	require.Equal(t, "flex", gjson.GetBytes(merged, "service_tier").String())
+
+	// 客户端显式指定（含 null）时不覆盖；沿途字段不是对象时跳过。
+	raw = []byte(`{"type":"response.create","model":"gpt-5.1","reasoning":{"effort":"low"},"service_tier":null}`)
+	merged, err = applyOpenAIWSModelDefaultParamsRaw(raw, rules)
+	require.NoError(t, err)
+	require.Equal(t, string(raw), string(merged))
+	raw = []byte(`{"type":"response.create","model":"gpt-5.1","reasoning":"minimal","service_tier":"auto"}`)
+	merged, err = applyOpenAIWSModelDefaultParamsRaw(raw, rules)
+	require.NoError(t, err)
+	require.Equal(t, string(raw), string(merged))
+
+	// 重放时再次合并，请求体逐字节一致。
+	raw = []byte(`{"type":"response.create","model":"gpt-5.1"}`)
+	merged, err = applyOpenAIWSModelDefaultParamsRaw(raw, rules)
+	require.NoError(t, err)
+	again, err := applyOpenAIWSModelDefaultParamsRaw(merged, rules)
+	require.NoError(t, err)
+	require.Equal(t, string(merged), string(again))
+
+	// map 形式与原始 JSON 结果一致，且不修改调用方的请求体。
+	reqBody := map[string]any{"model": "gpt-5.1", "reasoning": map[string]any{"summary": "auto"}, "service_tier": "priority"}
+	payload := svc.buildOpenAIWSCreatePayload(reqBody, &Account{ID: 1, Type: AccountTypeAPIKey})
+	require.Equal(t, map[string]any{"summary": "auto", "effort": "medium"}, payload["reasoning"])
+	require.Equal(t, "priority", payload["service_tier"])
+	require.Equal(t, map[string]any{"summary": "auto"}, reqBody["reasoning"])
+	encoded, err := json.Marshal(payload)
+	require.NoError(t, err)
+	rawMerged, err := applyOpenAIWSModelDefaultParamsRaw(encoded, rules)
+	require.NoError(t, err)
+	require.JSONEq(t, string(encoded), string(rawMerged))
+}
+
+func TestOpenAIWSModelDefaultParams_AccountRewriteAppliedAfterDefaults(t *testing.T) {
+	svc := newOpenAIWSModelDefaultParamsTestService()
+	svc.cfg.Gateway.OpenAIWS.AccountRequestRewrites = []config.GatewayOpenAIWSAccountRequestRewrite{
+		{AccountID: 9, Rules: []config.GatewayOpenAIWSRequestRewriteRule{{Op: "set", Path: "service_tier", Value: "priority"}}},
+	}
+
+	// 账号级改写在默认参数之后执行，强制值覆盖默认值。
+	payload := svc.buildOpenAIWSCreatePayload(map[string]any{"model": "gpt-5.2"}, &Account{ID: 9, Type: AccountTypeAPIKey})
+	require.Equal(t, map[string]any{"effort": "medium"}, payload["reasoning"])
+	require.Equal(t, "priority", payload["service_tier"])
+
+	payload = svc.buildOpenAIWSCreatePayload(map[string]any{"model": "gpt-5.1-codex"}, &Account{ID: 10, Type: AccountTypeAPIKey})
+	require.Equal(t, map[string]any{"effort": "high"}, payload["reasoning"])
+	require.Equal(t, map[string]any{"verbosity": "low"}, payload["text"])
+	require.NotContains(t, payload, "service_tier")
+}
@@ -0,0 +1,364 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// OpenMetricsContentType OpenMetrics 1.0 文本格式的 Content-Type。
+	OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+	openAIWSMetricsPath               = "/metrics"
+	openAIWSMetricsDefaultMaxAccounts = 100
+	openAIWSMetricsScrapeTimeout      = 5 * time.Second
+	openAIWSMetricsShutdownTimeout    = 3 * time.Second
+)
+
+// openMetricsWriter 零依赖的 OpenMetrics 文本序列化器：每个指标族先写 TYPE/HELP 再写样本，族之间不交错，
+// 末尾以 # EOF 结束。counter 样本自动追加 _total 后缀；histogram 桶须按上界升序传入，输出为累计计数。
+type openMetricsWriter struct {
+	buf bytes.Buffer
+}
+
+var openMetricsTextEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+type openMetricsLabel struct {
+	name  string
+	value string
+}
+
+type openMetricsBucket struct {
+	// upper 桶上界，math.Inf(1) 表示 +Inf 桶。
+	upper float64
+	// count 落入该桶的样本数（非累计）。
+	count int64
+}
+
+func (w *openMetricsWriter) family(name, metricType, help string) {
+	w.buf.WriteString("# TYPE ")
+	w.buf.WriteString(name)
+	w.buf.WriteByte(' ')
+	w.buf.WriteString(metricType)
+	w.buf.WriteString("\n# HELP ")
+	w.buf.WriteString(name)
+	w.buf.WriteByte(' ')
+	w.buf.WriteString(escapeOpenMetricsText(help))
+	w.buf.WriteByte('\n')
+}
+
+func (w *openMetricsWriter) sample(name string, labels []openMetricsLabel, value string) {
+	w.buf.WriteString(name)
+	if len(labels) > 0 {
+		w.buf.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.buf.WriteString(label.name)
+			w.buf.WriteString(`="`)
+			w.buf.WriteString(escapeOpenMetricsText(label.value))
+			w.buf.WriteByte('"')
+		}
+		w.buf.WriteByte('}')
+	}
+	w.buf.WriteByte(' ')
+	w.buf.WriteString(value)
+	w.buf.WriteByte('\n')
+}
+
+func (w *openMetricsWriter) counter(name, help string, value int64) {
+	w.family(name, "counter", help)
+	w.sample(name+"_total", nil, strconv.FormatInt(value, 10))
+}
+
+func (w *openMetricsWriter) gauge(name, help string, value float64) {
+	w.family(name, "gauge", help)
+	w.sample(name, nil, formatOpenMetricsFloat(value))
+}
+
+// histogramSample 写入一组直方图样本；buckets 按上界升序（+Inf 桶在最后或缺省），输出累计计数与 +Inf 桶。
+func (w *openMetricsWriter) histogramSample(name string, labels []openMetricsLabel, buckets []openMetricsBucket, sum float64) {
+	var cumulative int64
+	bucketLabels := make([]openMetricsLabel, len(labels), len(labels)+1)
+	copy(bucketLabels, labels)
+	for _, bucket := range buckets {
+		cumulative += bucket.count
+		if math.IsInf(bucket.upper, 1) {
+			continue
+		}
+		w.sample(name+"_bucket", append(bucketLabels, openMetricsLabel{"le", formatOpenMetricsFloat(bucket.upper)}), strconv.FormatInt(cumulative, 10))
+	}
+	w.sample(name+"_bucket", append(bucketLabels, openMetricsLabel{"le", "+Inf"}), strconv.FormatInt(cumulative, 10))
+	w.sample(name+"_count", labels, strconv.FormatInt(cumulative, 10))
+	w.sample(name+"_sum", labels, formatOpenMetricsFloat(sum))
+}
+
+func (w *openMetricsWriter) eof() {
+	w.buf.WriteString("# EOF\n")
+}
+
+// formatOpenMetricsFloat 输出 OpenMetrics 要求的数值：整数值带 .0 后缀（le 标签需为规范浮点形式），特殊值为 NaN/+Inf/-Inf。
+func formatOpenMetricsFloat(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	formatted := strconv.FormatFloat(value, 'g', -1, 64)
+	if !strings.ContainsAny(formatted, ".eE") {
+		formatted += ".0"
+	}
+	return formatted
+}
+
+// escapeOpenMetricsText 转义标签值与 HELP 文本中的反斜杠、双引号与换行。
+func escapeOpenMetricsText(value string) string {
+	if !strings.ContainsAny(value, "\\\"\n") {
+		return value
+	}
+	return openMetricsTextEscaper.Replace(value)
+}
+
+func openMetricsBool(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// openAIWSMetricsBucketsFromDialLatency 将建连/租约耗时直方图（UpperMs=0 表示 +Inf）转换为通用桶。
+func openAIWSMetricsBucketsFromDialLatency(buckets []OpenAIWSDialLatencyBucket) []openMetricsBucket {
+	out := make([]openMetricsBucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		upper := math.Inf(1)
+		if bucket.UpperMs > 0 {
+			upper = float64(bucket.UpperMs)
+		}
+		out = append(out, openMetricsBucket{upper: upper, count: bucket.Count})
+	}
+	return out
+}
+
+func (s *OpenAIGatewayService) openAIWSMetricsMaxAccounts() int {
+	if s != nil && s.cfg != nil && s.cfg.Gateway.OpenAIWS.MetricsMaxAccounts > 0 {
+		return s.cfg.Gateway.OpenAIWS.MetricsMaxAccounts
+	}
+	return openAIWSMetricsDefaultMaxAccounts
+}
+
+// WriteOpenAIWSOpenMetrics 将调度指标、连接池指标与账号运行时统计序列化为 OpenMetrics 文本写入 w。
+// 按账号打标签的指标最多包含 metrics_max_accounts 个账号（按账号 ID 升序），其余只计入 accounts_omitted。
+func (s *OpenAIGatewayService) WriteOpenAIWSOpenMetrics(ctx context.Context, w io.Writer) error {
+	om := &openMetricsWriter{}
+	s.writeOpenAISchedulerOpenMetrics(om)
+	s.writeOpenAIWSPoolOpenMetrics(om)
+	s.writeOpenAIAccountRuntimeOpenMetrics(ctx, om)
+	om.eof()
+	_, err := w.Write(om.buf.Bytes())
+	return err
+}
+
+func (s *OpenAIGatewayService) writeOpenAISchedulerOpenMetrics(om *openMetricsWriter) {
+	m := s.SnapshotOpenAIAccountSchedulerMetrics()
+	const p = "sub2api_openai_scheduler_"
+	om.counter(p+"select", "Account selections made by the scheduler.", m.SelectTotal)
+	om.counter(p+"sticky_previous_hit", "Selections served by previous_response_id stickiness.", m.StickyPreviousHitTotal)
+	om.counter(p+"sticky_session_hit", "Selections served by session hash stickiness.", m.StickySessionHitTotal)
+	om.counter(p+"load_balance_select", "Selections made by load balancing.", m.LoadBalanceSelectTotal)
+	om.counter(p+"account_switch", "Account switches reported by the gateway.", m.AccountSwitchTotal)
+	om.counter(p+"latency_ms", "Cumulative scheduler latency in milliseconds.", m.SchedulerLatencyMsTotal)
+	om.counter(p+"circuit_breaker_trip", "Circuit breaker trips.", m.CircuitBreakerTripTotal)
+	om.counter(p+"circuit_breaker_manual_reset", "Manual circuit breaker resets.", m.CircuitBreakerManualResetTotal)
+	om.counter(p+"circuit_breaker_warmup_exempt", "Failures not counted during circuit breaker warmup.", m.CircuitBreakerWarmupExemptTotal)
+	om.counter(p+"circuit_breaker_auto_disable", "Accounts auto-disabled after repeated trips.", m.CircuitBreakerAutoDisableTotal)
+	om.counter(p+"runtime_stats_replica_rebuild", "Runtime stats read replica rebuilds.", m.RuntimeStatsReplicaRebuildTotal)
+	om.counter(p+"runtime_stats_replica_hit", "Runtime stats read replica hits.", m.RuntimeStatsReplicaHitTotal)
+	om.counter(p+"scoring_full", "Load balance scorings without candidate prefilter.", m.ScoringFullTotal)
+	om.counter(p+"scoring_prefiltered", "Load balance scorings with candidate prefilter.", m.ScoringPrefilteredTotal)
+	om.counter(p+"prefilter_dropped_candidate", "Candidates dropped by the prefilter.", m.PrefilterDroppedCandidateTotal)
+	om.counter(p+"min_score_excluded_candidate", "Candidates excluded by scheduler_min_score_threshold.", m.MinScoreExcludedCandidateTotal)
+	om.counter(p+"half_open_probe_released", "Half-open candidates dropped by the probe strategy.", m.HalfOpenProbeReleasedTotal)
+	om.counter(p+"group_paused_reject", "Selections rejected because the group is paused.", m.GroupPausedRejectTotal)
+	om.counter(p+"transport_fallback", "Selections that fell back to any transport.", m.TransportFallbackTotal)
+	om.counter(p+"sticky_session_cap_overflow", "Sticky binds skipped by sticky_sessions_per_account_max.", m.StickySessionCapOverflowTotal)
+	om.counter(p+"canary_select", "Selections routed to canary accounts.", m.CanarySelectTotal)
+	om.counter(p+"canary_rollback", "Canary account rollbacks.", m.CanaryRollbackTotal)
+	om.counter(p+"sticky_ttl_skew_sampled", "Sticky bindings sampled for TTL skew.", m.StickyTTLSkew.SampledTotal)
+	om.counter(p+"sticky_ttl_skew_early_expiry", "Sampled sticky bindings that expired before the configured TTL.", m.StickyTTLSkew.EarlyExpiryTotal)
+	om.counter(p+"sticky_ttl_skew_late_expiry", "Sampled sticky bindings that outlived the configured TTL.", m.StickyTTLSkew.LateExpiryTotal)
+	om.gauge(p+"sticky_hit_ratio", "Share of selections served by stickiness.", m.StickyHitRatio)
+	om.gauge(p+"account_switch_rate", "Account switches per selection.", m.AccountSwitchRate)
+	om.gauge(p+"load_skew_avg", "Average load skew across candidates.", m.LoadSkewAvg)
+	om.gauge(p+"latency_ms_avg", "Average scheduler latency in milliseconds.", m.SchedulerLatencyMsAvg)
+	om.gauge(p+"runtime_stats_accounts", "Accounts with runtime stats.", float64(m.RuntimeStatsAccountCount))
+	om.gauge(p+"sticky_ttl_skew_max_abs_ratio", "Largest observed sticky TTL skew as a fraction of TTL.", m.StickyTTLSkew.MaxAbsSkewRatio)
+}
+
+func (s *OpenAIGatewayService) writeOpenAIWSPoolOpenMetrics(om *openMetricsWriter) {
+	pool := s.getOpenAIWSConnPool()
+	if pool == nil {
+		return
+	}
+	m := pool.SnapshotMetrics()
+	const p = "sub2api_openai_ws_pool_"
+	om.counter(p+"acquire", "Connection acquire attempts.", m.AcquireTotal)
+	om.counter(p+"acquire_reuse", "Acquires that reused an idle connection.", m.AcquireReuseTotal)
+	om.counter(p+"acquire_create", "Acquires that dialed a new connection.", m.AcquireCreateTotal)
+	om.counter(p+"acquire_queue_wait", "Acquires that waited in queue.", m.AcquireQueueWaitTotal)
+	om.counter(p+"acquire_queue_wait_ms", "Cumulative acquire queue wait in milliseconds.", m.AcquireQueueWaitMsTotal)
+	om.counter(p+"conn_pick", "Connection picks.", m.ConnPickTotal)
+	om.counter(p+"conn_pick_ms", "Cumulative connection pick time in milliseconds.", m.ConnPickMsTotal)
+	om.counter(p+"scale_up", "Pool scale-up events.", m.ScaleUpTotal)
+	om.counter(p+"scale_down", "Pool scale-down events.", m.ScaleDownTotal)
+	om.counter(p+"idle_timeout_evict", "Connections evicted by idle timeout.", m.IdleTimeoutEvictTotal)
+	om.counter(p+"lease_acquire", "Leases acquired.", m.LeaseAcquireTotal)
+	om.counter(p+"lease_release", "Leases released.", m.LeaseReleaseTotal)
+	om.counter(p+"lease_leak", "Leases held longer than lease_leak_threshold_seconds.", m.LeaseLeakTotal)
+	om.gauge(p+"leases_held", "Leases currently held.", float64(m.LeasesHeld))
+
+	om.family(p+"lease_hold_ms", "histogram", "Hold time of released leases in milliseconds.")
+	om.histogramSample(p+"lease_hold_ms", nil, openAIWSMetricsBucketsFromDialLatency(m.LeaseHold.Buckets), float64(m.LeaseHold.SumMs))
+
+	accountIDs := make([]int64, 0, len(m.DialLatencyByAccount))
+	for accountID := range m.DialLatencyByAccount {
+		accountIDs = append(accountIDs, accountID)
+	}
+	sort.Slice(accountIDs, func(i, j int) bool { return accountIDs[i] < accountIDs[j] })
+	if maxAccounts := s.openAIWSMetricsMaxAccounts(); len(accountIDs) > maxAccounts {
+		accountIDs = accountIDs[:maxAccounts]
+	}
+	om.family(p+"dial_latency_ms", "histogram", "Upstream websocket dial latency per account in milliseconds.")
+	for _, accountID := range accountIDs {
+		latency := m.DialLatencyByAccount[accountID]
+		labels := []openMetricsLabel{{"account_id", strconv.FormatInt(accountID, 10)}}
+		om.histogramSample(p+"dial_latency_ms", labels, openAIWSMetricsBucketsFromDialLatency(latency.Buckets), float64(latency.SumMs))
+	}
+}
+
+var openAIWSMetricsCircuitStates = []string{
+	openAICircuitBreakerStateClosed,
+	openAICircuitBreakerStateOpen,
+	openAICircuitBreakerStateHalfOpen,
+}
+
+func (s *OpenAIGatewayService) writeOpenAIAccountRuntimeOpenMetrics(ctx context.Context, om *openMetricsWriter) {
+	stats := s.SnapshotOpenAIAccountRuntimeStats(ctx)
+	sort.Slice(stats, func(i, j int) bool { return stats[i].AccountID < stats[j].AccountID })
+	omitted := 0
+	if maxAccounts := s.openAIWSMetricsMaxAccounts(); len(stats) > maxAccounts {
+		omitted = len(stats) - maxAccounts
+		stats = stats[:maxAccounts]
+	}
+	om.gauge("sub2api_openai_metrics_accounts_omitted", "Accounts left out of per-account metrics by metrics_max_accounts.", float64(omitted))
+
+	const p = "sub2api_openai_account_"
+	perAccount := []struct {
+		name  string
+		help  string
+		value func(OpenAIAccountRuntimeStatsSnapshot) (float64, bool)
+	}{
+		{"error_rate", "EWMA error rate.", func(st OpenAIAccountRuntimeStatsSnapshot) (float64, bool) { return st.ErrorRate, true }},
+		{"ttft_ms", "EWMA time to first token in milliseconds.", func(st OpenAIAccountRuntimeStatsSnapshot) (float64, bool) { return st.TTFTMs, st.HasTTFT }},
+		{"prev_not_found_rate", "EWMA previous_response_not_found rate.", func(st OpenAIAccountRuntimeStatsSnapshot) (float64, bool) { return st.PrevNotFoundRate, true }},
+		{"health_score", "Account health score (0-100).", func(st OpenAIAccountRuntimeStatsSnapshot) (float64, bool) {
+			return float64(st.AccountHealthScore), true
+		}},
+		{"quota_cooldown", "Whether the account is in a rate limit or overload cooldown.", func(st OpenAIAccountRuntimeStatsSnapshot) (float64, bool) {
+			return openMetricsBool(st.QuotaCooldown), true
+		}},
+		{"sticky_sessions", "Sticky sessions bound to the account in this process.", func(st OpenAIAccountRuntimeStatsSnapshot) (float64, bool) {
+			return float64(st.StickySessions), true
+		}},
+	}
+	for _, metric := range perAccount {
+		om.family(p+metric.name, "gauge", metric.help)
+		for _, st := range stats {
+			if value, ok := metric.value(st); ok {
+				om.sample(p+metric.name, []openMetricsLabel{{"account_id", strconv.FormatInt(st.AccountID, 10)}}, formatOpenMetricsFloat(value))
+			}
+		}
+	}
+	om.family(p+"circuit_state", "stateset", "Circuit breaker state of the account.")
+	for _, st := range stats {
+		accountID := strconv.FormatInt(st.AccountID, 10)
+		for _, state := range openAIWSMetricsCircuitStates {
+			labels := []openMetricsLabel{{"account_id", accountID}, {p + "circuit_state", state}}
+			om.sample(p+"circuit_state", labels, strconv.Itoa(int(openMetricsBool(st.CircuitState == state))))
+		}
+	}
+}
+
+// OpenAIWSOpenMetricsHandler 返回输出 OpenMetrics 文本的 HTTP handler。
+func (s *OpenAIGatewayService) OpenAIWSOpenMetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), openAIWSMetricsScrapeTimeout)
+		defer cancel()
+		var buf bytes.Buffer
+		if err := s.WriteOpenAIWSOpenMetrics(ctx, &buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", OpenMetricsContentType)
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(buf.Bytes())
+		}
+	})
+}
+
+// StartOpenAIWSMetricsServer 按 metrics_listen_addr 启动独立的 OpenMetrics 监听（路径 /metrics），
+// 返回的 stop 会关闭监听。未配置地址时为空操作；监听失败只记录日志，不影响主服务。
+func (s *OpenAIGatewayService) StartOpenAIWSMetricsServer() (stop func()) {
+	if s == nil || s.cfg == nil {
+		return func() {}
+	}
+	addr := strings.TrimSpace(s.cfg.Gateway.OpenAIWS.MetricsListenAddr)
+	if addr == "" {
+		return func() {}
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		logOpenAIWSModeInfo("metrics_server_listen_failed addr=%s err=%v", addr, err)
+		return func() {}
+	}
+	mux := http.NewServeMux()
+	mux.Handle(openAIWSMetricsPath, s.OpenAIWSOpenMetricsHandler())
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: openAIWSMetricsScrapeTimeout,
+		WriteTimeout:      2 * openAIWSMetricsScrapeTimeout,
+	}
+	GoWithPanicStateDump(func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logOpenAIWSModeInfo("metrics_server_stopped addr=%s err=%v", addr, err)
+		}
+	})
+	logOpenAIWSModeInfo("metrics_server_started addr=%s path=%s", listener.Addr().String(), openAIWSMetricsPath)
+	var stopOnce sync.Once
+	return func() {
+		stopOnce.Do(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), openAIWSMetricsShutdownTimeout)
+			defer cancel()
+			_ = server.Shutdown(ctx)
+		})
+	}
+}
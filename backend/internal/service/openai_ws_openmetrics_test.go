@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	openMetricsSampleLine = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(?:\{(.*)\})? (\S+)$`)
+	openMetricsLabelPair  = regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)="((?:[^"\\\n]|\\[\\"n])*)"(?:,|$)`)
+	openMetricsMetaLine   = regexp.MustCompile(`^# (TYPE|HELP) ([a-zA-Z_:][a-zA-Z0-9_:]*) (.*)$`)
+)
+
+type openMetricsTestHistogram struct {
+	les     []float64
+	buckets []float64
+	count   float64
+}
+
+// validateOpenMetricsText 按 OpenMetrics 1.0 文本格式校验 body：元数据先于样本、指标族不重复不交错、
+// 样本名后缀与类型匹配、标签与数值语法正确、序列不重复、直方图桶累计递增且 +Inf 桶等于 _count、以 # EOF 结尾。
+// 返回 “样本名{标签}” -> 数值，供断言具体取值。
+func validateOpenMetricsText(t *testing.T, body string) map[string]float64 {
+	t.Helper()
+	require.True(t, strings.HasSuffix(body, "\n# EOF\n"), "must end with # EOF")
+	lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	require.Equal(t, "# EOF", lines[len(lines)-1])
+
+	samples := make(map[string]float64)
+	familyTypes := make(map[string]string)
+	histograms := make(map[string]*openMetricsTestHistogram)
+	currentFamily, currentType := "", ""
+	for lineNo, line := range lines[:len(lines)-1] {
+		if strings.HasPrefix(line, "#") {
+			meta := openMetricsMetaLine.FindStringSubmatch(line)
+			require.NotNil(t, meta, "line %d: bad metadata %q", lineNo, line)
+			if meta[1] == "TYPE" {
+				_, seen := familyTypes[meta[2]]
+				require.False(t, seen, "line %d: family %s declared twice", lineNo, meta[2])
+				require.Contains(t, []string{"counter", "gauge", "histogram", "stateset", "info", "summary", "gaugehistogram", "unknown"}, meta[3])
+				familyTypes[meta[2]] = meta[3]
+				currentFamily, currentType = meta[2], meta[3]
+			} else {
+				require.Equal(t, currentFamily, meta[2], "line %d: HELP for a different family", lineNo)
+			}
+			continue
+		}
+		match := openMetricsSampleLine.FindStringSubmatch(line)
+		require.NotNil(t, match, "line %d: bad sample %q", lineNo, line)
+		name, rawLabels, rawValue := match[1], match[2], match[3]
+		value, err := strconv.ParseFloat(rawValue, 64)
+		require.NoError(t, err, "line %d: bad value", lineNo)
+
+		labels := make(map[string]string)
+		var labelNames []string
+		for rest := rawLabels; rest != ""; {
+			pair := openMetricsLabelPair.FindStringSubmatch(rest)
+			require.NotNil(t, pair, "line %d: bad labels %q", lineNo, rawLabels)
+			_, dup := labels[pair[1]]
+			require.False(t, dup, "line %d: duplicate label %s", lineNo, pair[1])
+			labels[pair[1]] = pair[2]
+			labelNames = append(labelNames, pair[1])
+			rest = rest[len(pair[0]):]
+		}
+		sort.Strings(labelNames)
+		var seriesKey, groupKey strings.Builder
+		seriesKey.WriteString(name)
+		groupKey.WriteString(currentFamily)
+		for _, labelName := range labelNames {
+			seriesKey.WriteString("," + labelName + "=" + labels[labelName])
+			if labelName != "le" {
+				groupKey.WriteString("," + labelName + "=" + labels[labelName])
+			}
+		}
+		_, dup := samples[seriesKey.String()]
+		require.False(t, dup, "line %d: duplicate series %s", lineNo, seriesKey.String())
+		samples[seriesKey.String()] = value
+
+		switch currentType {
+		case "counter":
+			require.Equal(t, currentFamily+"_total", name, "line %d", lineNo)
+			require.GreaterOrEqual(t, value, 0.0)
+		case "gauge":
+			require.Equal(t, currentFamily, name, "line %d", lineNo)
+		case "stateset":
+			require.Equal(t, currentFamily, name, "line %d", lineNo)
+			require.Contains(t, labels, currentFamily, "line %d: stateset sample needs a label named after the family", lineNo)
+			require.Contains(t, []float64{0, 1}, value)
+		case "histogram":
+			hist := histograms[groupKey.String()]
+			if hist == nil {
+				hist = &openMetricsTestHistogram{count: -1}
+				histograms[groupKey.String()] = hist
+			}
+			switch name {
+			case currentFamily + "_bucket":
+				le, err := strconv.ParseFloat(labels["le"], 64)
+				require.NoError(t, err, "line %d: bad le", lineNo)
+				if n := len(hist.les); n > 0 {
+					require.Greater(t, le, hist.les[n-1], "line %d: le must increase", lineNo)
+					require.GreaterOrEqual(t, value, hist.buckets[n-1], "line %d: buckets must be cumulative", lineNo)
+				}
+				require.Equal(t, -1.0, hist.count, "line %d: bucket after _count", lineNo)
+				hist.les = append(hist.les, le)
+				hist.buckets = append(hist.buckets, value)
+			case currentFamily + "_count":
+				hist.count = value
+			case currentFamily + "_sum":
+			default:
+				t.Fatalf("line %d: sample %s does not belong to histogram %s", lineNo, name, currentFamily)
+			}
+		default:
+			t.Fatalf("line %d: sample before any TYPE", lineNo)
+		}
+	}
+	for key, hist := range histograms {
+		require.NotEmpty(t, hist.les, key)
+		require.Equal(t, "+Inf", formatOpenMetricsFloat(hist.les[len(hist.les)-1]), "%s: last bucket must be +Inf", key)
+		require.Equal(t, hist.buckets[len(hist.buckets)-1], hist.count, "%s: +Inf bucket must equal _count", key)
+	}
+	return samples
+}
+
+func TestOpenAIWSOpenMetrics_WellFormedOutput(t *testing.T) {
+	accounts := []Account{
+		{ID: 6101, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true},
+		{ID: 6102, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true},
+		{ID: 6103, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true},
+	}
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerEnabled = true
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerFailThreshold = 1
+	cfg.Gateway.OpenAIWS.SchedulerCircuitBreakerCooldownSeconds = 3600
+	cfg.Gateway.OpenAIWS.MetricsMaxAccounts = 2
+	svc := &OpenAIGatewayService{
+		accountRepo: stubOpenAIAccountRepo{accounts: accounts},
+		cache:       &stubGatewayCache{},
+		cfg:         cfg,
+	}
+	ttft := 700
+	svc.ReportOpenAIAccountScheduleResult(6101, true, &ttft)
+	svc.ReportOpenAIAccountScheduleResult(6102, false, nil)
+	svc.ReportOpenAIAccountScheduleResult(6103, true, &ttft)
+	pool := svc.getOpenAIWSConnPool()
+	pool.recordDialLatency(6101, 80*time.Millisecond)
+	pool.recordDialLatency(6101, 20*time.Second)
+	pool.recordDialLatency(6102, 120*time.Millisecond)
+	pool.recordDialLatency(6103, 300*time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	svc.OpenAIWSOpenMetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, OpenMetricsContentType, rec.Header().Get("Content-Type"))
+	samples := validateOpenMetricsText(t, rec.Body.String())
+
+	require.Equal(t, 1.0, samples["sub2api_openai_scheduler_circuit_breaker_trip_total"])
+	require.Equal(t, 700.0, samples["sub2api_openai_account_ttft_ms,account_id=6101"])
+	require.Equal(t, 1.0, samples["sub2api_openai_account_circuit_state,account_id=6102,sub2api_openai_account_circuit_state=open"])
+	require.Equal(t, 0.0, samples["sub2api_openai_account_circuit_state,account_id=6102,sub2api_openai_account_circuit_state=closed"])
+	require.Equal(t, 1.0, samples["sub2api_openai_ws_pool_dial_latency_ms_bucket,account_id=6101,le=100.0"])
+	require.Equal(t, 2.0, samples["sub2api_openai_ws_pool_dial_latency_ms_bucket,account_id=6101,le=+Inf"])
+	require.Equal(t, 20080.0, samples["sub2api_openai_ws_pool_dial_latency_ms_sum,account_id=6101"])
+
+	// 按账号 ID 截取 metrics_max_accounts 个账号，其余只计入 omitted。
+	require.Equal(t, 1.0, samples["sub2api_openai_metrics_accounts_omitted"])
+	for key := range samples {
+		require.NotContains(t, key, "account_id=6103")
+	}
+
+	rec = httptest.NewRecorder()
+	svc.OpenAIWSOpenMetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestOpenAIWSOpenMetrics_WriterEscapingAndFloats(t *testing.T) {
+	om := &openMetricsWriter{}
+	om.family("demo_info", "gauge", "Help with \\ and \n newline.")
+	om.sample("demo_info", []openMetricsLabel{{"path", "a\"b\\c\nd"}}, formatOpenMetricsFloat(1))
+	om.gauge("demo_ratio", "Ratio.", 0.25)
+	om.family("demo_latency", "histogram", "Latency.")
+	om.histogramSample("demo_latency", nil, []openMetricsBucket{{upper: 1, count: 2}, {upper: 10, count: 0}}, 1.5)
+	om.eof()
+
+	body := om.buf.String()
+	samples := validateOpenMetricsText(t, body)
+	require.Contains(t, body, `# HELP demo_info Help with \\ and \n newline.`)
+	require.Contains(t, body, `demo_info{path="a\"b\\c\nd"} 1.0`)
+	require.Equal(t, 0.25, samples["demo_ratio"])
+	require.Equal(t, 2.0, samples["demo_latency_bucket,le=+Inf"])
+	require.Equal(t, "+Inf", formatOpenMetricsFloat(math.Inf(1)))
+	require.Equal(t, "1e+21", formatOpenMetricsFloat(1e21))
+}
+
+func TestOpenAIWSOpenMetrics_StartServer(t *testing.T) {
+	svc := &OpenAIGatewayService{cfg: &config.Config{}}
+	stop := svc.StartOpenAIWSMetricsServer()
+	stop()
+	stop()
+
+	svc.cfg.Gateway.OpenAIWS.MetricsListenAddr = "127.0.0.1:0"
+	stop = svc.StartOpenAIWSMetricsServer()
+	defer stop()
+	var buf strings.Builder
+	require.NoError(t, svc.WriteOpenAIWSOpenMetrics(context.Background(), &buf))
+	validateOpenMetricsText(t, buf.String())
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math"
 	"net/http"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
@@ -79,6 +80,10 @@ type openAIWSConnLease struct {
 	connPick  time.Duration
 	reused    bool
 	released  atomic.Bool
+	// acquiredAt/tracked 由 trackLease 在 Acquire 返回前写入，用于统计持有时长与泄漏巡检。
+	acquiredAt   time.Time
+	tracked      bool
+	leakReported atomic.Bool
 }
 
 func (l *openAIWSConnLease) activeConn() (*openAIWSConn, error) {
@@ -208,6 +213,15 @@ func (l *openAIWSConnLease) MarkBroken() {
 		return
 	}
 	l.pool.evictConn(l.accountID, l.conn.id)
+	if l.conn.retired.Load() {
+		// 账号已下线时连接不在池中，evictConn 无法找到它，需直接关闭。
+		l.conn.close()
+	}
+}
+
+// Retired 返回租约连接是否已被下线/驱逐/回收；为 true 时会话不应在当前 turn 之后继续复用该连接。
+func (l *openAIWSConnLease) Retired() bool {
+	return l != nil && l.conn != nil && l.conn.retired.Load()
 }
 
 func (l *openAIWSConnLease) Release() {
@@ -217,6 +231,12 @@ func (l *openAIWSConnLease) Release() {
 	if !l.released.CompareAndSwap(false, true) {
 		return
 	}
+	l.pool.untrackLease(l)
+	if l.conn.retired.Load() {
+		// 账号已下线：当前 turn 完成后直接关闭连接，不再归还给排队者复用。
+		l.conn.close()
+		return
+	}
 	l.conn.release()
 }
 
@@ -237,6 +257,10 @@ type openAIWSConn struct {
 	createdAtNano atomic.Int64
 	lastUsedNano  atomic.Int64
 	prewarmed     atomic.Bool
+	// retired: 所属账号已下线、连接被按标签驱逐或因凭证轮换被回收，租约释放时关闭连接。
+	retired atomic.Bool
+	// tags: 建连时确定的连接元数据标签（endpoint/account/proxy），用于按标签批量驱逐；创建后只读。
+	tags []string
 }
 
 func newOpenAIWSConn(id string, _ int64, ws openAIWSClientConn, handshakeHeaders http.Header) *openAIWSConn {
@@ -498,6 +522,18 @@ func (c *openAIWSConn) handshakeHeader(name string) string {
 	return strings.TrimSpace(c.handshakeHeaders.Get(strings.TrimSpace(name)))
 }
 
+func (c *openAIWSConn) hasTag(tag string) bool {
+	if c == nil || tag == "" {
+		return false
+	}
+	for _, item := range c.tags {
+		if item == tag {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *openAIWSConn) isPrewarmed() bool {
 	if c == nil {
 		return false
@@ -525,6 +561,14 @@ type openAIWSAccountPool struct {
 	prewarmFailAt time.Time
 }
 
+// accountLocked 返回最近一次 acquire 的账号，用于读取账号级连接池覆盖；调用方需持有 ap.mu。
+func (ap *openAIWSAccountPool) accountLocked() *Account {
+	if ap == nil || ap.lastAcquire == nil {
+		return nil
+	}
+	return ap.lastAcquire.Account
+}
+
 type OpenAIWSPoolMetricsSnapshot struct {
 	AcquireTotal            int64
 	AcquireReuseTotal       int64
@@ -535,6 +579,20 @@ type OpenAIWSPoolMetricsSnapshot struct {
 	ConnPickMsTotal         int64
 	ScaleUpTotal            int64
 	ScaleDownTotal          int64
+	IdleTimeoutEvictTotal   int64
+	// LeaseAcquireTotal/LeaseReleaseTotal 成功获取/释放的租约数，两者之差恒等于 LeasesHeld；
+	// AcquireTotal 另含获取失败的请求，因此 AcquireTotal - LeaseReleaseTotal - LeasesHeld 为失败的获取数。
+	LeaseAcquireTotal int64
+	LeaseReleaseTotal int64
+	// LeasesHeld 当前未释放的租约数；HeldLeases 为其明细（按持有时长从长到短）。
+	LeasesHeld int64
+	HeldLeases []OpenAIWSHeldLeaseSnapshot
+	// LeaseLeakTotal 持有超过 lease_leak_threshold_seconds 的租约数（疑似泄漏，每个租约计一次）。
+	LeaseLeakTotal int64
+	// LeaseHold 已释放租约的持有时长分布。
+	LeaseHold OpenAIWSLeaseHoldSnapshot
+	// DialLatencyByAccount 各账号上游建连耗时分布（key: accountID）。
+	DialLatencyByAccount map[int64]OpenAIWSDialLatencySnapshot
 }
 
 type openAIWSPoolMetrics struct {
@@ -547,6 +605,10 @@ type openAIWSPoolMetrics struct {
 	connPickMs            atomic.Int64
 	scaleUpTotal          atomic.Int64
 	scaleDownTotal        atomic.Int64
+	idleTimeoutEvictTotal atomic.Int64
+	leaseAcquireTotal     atomic.Int64
+	leaseReleaseTotal     atomic.Int64
+	leaseLeakTotal        atomic.Int64
 }
 
 type openAIWSConnPool struct {
@@ -557,7 +619,10 @@ type openAIWSConnPool struct {
 	accounts sync.Map // key: int64(accountID), value: *openAIWSAccountPool
 	seq      atomic.Uint64
 
-	metrics openAIWSPoolMetrics
+	metrics     openAIWSPoolMetrics
+	dialLatency sync.Map // key: int64(accountID), value: *openAIWSDialLatencyHistogram
+	leases      sync.Map // key: *openAIWSConnLease，当前未释放的租约
+	leaseHold   openAIWSLeaseHoldHistogram
 
 	workerStopCh chan struct{}
 	workerWg     sync.WaitGroup
@@ -578,6 +643,9 @@ func (p *openAIWSConnPool) SnapshotMetrics() OpenAIWSPoolMetricsSnapshot {
 	if p == nil {
 		return OpenAIWSPoolMetricsSnapshot{}
 	}
+	// 先读释放数再读获取数，并发获取/释放时 LeasesHeld 不会出现负值。
+	leaseReleaseTotal := p.metrics.leaseReleaseTotal.Load()
+	leaseAcquireTotal := p.metrics.leaseAcquireTotal.Load()
 	return OpenAIWSPoolMetricsSnapshot{
 		AcquireTotal:            p.metrics.acquireTotal.Load(),
 		AcquireReuseTotal:       p.metrics.acquireReuseTotal.Load(),
@@ -588,6 +656,14 @@ func (p *openAIWSConnPool) SnapshotMetrics() OpenAIWSPoolMetricsSnapshot {
 		ConnPickMsTotal:         p.metrics.connPickMs.Load(),
 		ScaleUpTotal:            p.metrics.scaleUpTotal.Load(),
 		ScaleDownTotal:          p.metrics.scaleDownTotal.Load(),
+		IdleTimeoutEvictTotal:   p.metrics.idleTimeoutEvictTotal.Load(),
+		LeaseAcquireTotal:       leaseAcquireTotal,
+		LeaseReleaseTotal:       leaseReleaseTotal,
+		LeasesHeld:              leaseAcquireTotal - leaseReleaseTotal,
+		HeldLeases:              p.snapshotHeldLeases(time.Now()),
+		LeaseLeakTotal:          p.metrics.leaseLeakTotal.Load(),
+		LeaseHold:               p.leaseHold.snapshot(),
+		DialLatencyByAccount:    p.SnapshotDialLatency(),
 	}
 }
 
@@ -641,14 +717,14 @@ func (p *openAIWSConnPool) startBackgroundWorkers() {
 		return
 	}
 	p.workerWg.Add(2)
-	go func() {
+	GoWithPanicStateDump(func() {
 		defer p.workerWg.Done()
 		p.runBackgroundPingWorker()
-	}()
-	go func() {
+	})
+	GoWithPanicStateDump(func() {
 		defer p.workerWg.Done()
 		p.runBackgroundCleanupWorker()
-	}()
+	})
 }
 
 type openAIWSIdlePingCandidate struct {
@@ -733,7 +809,9 @@ func (p *openAIWSConnPool) runBackgroundCleanupWorker() {
 	for {
 		select {
 		case <-ticker.C:
-			p.runBackgroundCleanupSweep(time.Now())
+			now := time.Now()
+			p.runBackgroundCleanupSweep(now)
+			p.runLeaseLeakSweep(now)
 		case <-p.workerStopCh:
 			return
 		}
@@ -745,10 +823,12 @@ func (p *openAIWSConnPool) runBackgroundCleanupSweep(now time.Time) {
 		return
 	}
 	type cleanupResult struct {
-		evicted []*openAIWSConn
+		accountID int64
+		evicted   []*openAIWSConn
 	}
 	results := make([]cleanupResult, 0)
-	p.accounts.Range(func(_ any, value any) bool {
+	p.accounts.Range(func(key any, value any) bool {
+		accountID, _ := key.(int64)
 		ap, ok := value.(*openAIWSAccountPool)
 		if !ok || ap == nil {
 			return true
@@ -762,12 +842,14 @@ func (p *openAIWSConnPool) runBackgroundCleanupSweep(now time.Time) {
 		ap.lastCleanupAt = now
 		ap.mu.Unlock()
 		if len(evicted) > 0 {
-			results = append(results, cleanupResult{evicted: evicted})
+			results = append(results, cleanupResult{accountID: accountID, evicted: evicted})
 		}
 		return true
 	})
 	for _, result := range results {
 		closeOpenAIWSConns(result.evicted)
+		// 淘汰后可能低于 min_idle_per_account，按目标连接数重新预热补足。
+		p.ensureTargetIdleAsync(result.accountID)
 	}
 }
 
@@ -775,7 +857,11 @@ func (p *openAIWSConnPool) Acquire(ctx context.Context, req openAIWSAcquireReque
 	if p != nil {
 		p.metrics.acquireTotal.Add(1)
 	}
-	return p.acquire(ctx, cloneOpenAIWSAcquireRequest(req), 0)
+	lease, err := p.acquire(ctx, cloneOpenAIWSAcquireRequest(req), 0)
+	if err == nil {
+		p.trackLease(lease)
+	}
+	return lease, err
 }
 
 func (p *openAIWSConnPool) acquire(ctx context.Context, req openAIWSAcquireRequest, retry int) (*openAIWSConnLease, error) {
@@ -1137,7 +1223,9 @@ func (p *openAIWSConnPool) cleanupAccountLocked(ap *openAIWSAccountPool, now tim
 	if ap == nil {
 		return nil
 	}
-	maxAge := p.maxConnAge()
+	account := ap.accountLocked()
+	maxAge := p.maxConnAgeForAccount(account)
+	idleTimeout := p.connIdleTimeoutForAccount(account)
 
 	evicted := make([]*openAIWSConn, 0)
 	for id, conn := range ap.conns {
@@ -1167,13 +1255,23 @@ func (p *openAIWSConnPool) cleanupAccountLocked(ap *openAIWSAccountPool, now tim
 				delete(ap.pinnedConns, id)
 			}
 			evicted = append(evicted, conn)
+			continue
+		}
+		// 长时间空闲的连接大概率已被中间设备/上游静默断开，直接回收而不是等下次预检 ping 失败再重连。
+		if idleTimeout > 0 && !conn.isLeased() && conn.waiters.Load() == 0 && conn.idleDuration(now) > idleTimeout {
+			delete(ap.conns, id)
+			if len(ap.pinnedConns) > 0 {
+				delete(ap.pinnedConns, id)
+			}
+			evicted = append(evicted, conn)
+			p.metrics.idleTimeoutEvictTotal.Add(1)
 		}
 	}
 
 	if maxConns <= 0 {
 		maxConns = p.maxConnsHardCap()
 	}
-	maxIdle := p.maxIdlePerAccount()
+	maxIdle := p.maxIdlePerAccountFor(account)
 	if maxIdle < 0 || maxIdle > maxConns {
 		maxIdle = maxConns
 	}
@@ -1324,7 +1422,9 @@ func (p *openAIWSConnPool) ensureTargetIdleAsync(accountID int64) {
 	ap.creating += need
 	p.metrics.scaleUpTotal.Add(int64(need))
 
-	go p.prewarmConns(accountID, req, need)
+	GoWithPanicStateDump(func() {
+		p.prewarmConns(accountID, req, need)
+	})
 }
 
 func (p *openAIWSConnPool) targetConnCountLocked(ap *openAIWSAccountPool, maxConns int) int {
@@ -1340,6 +1440,10 @@ func (p *openAIWSConnPool) targetConnCountLocked(ap *openAIWSAccountPool, maxCon
 	if minIdle < 0 {
 		minIdle = 0
 	}
+	// 账号覆盖的空闲上限低于全局 min_idle 时以账号上限为准，避免预热后又被清理淘汰。
+	if maxIdle, ok := ap.accountLocked().GetOpenAIWSMaxIdlePerAccount(); ok && minIdle > maxIdle {
+		minIdle = maxIdle
+	}
 	if minIdle > maxConns {
 		minIdle = maxConns
 	}
@@ -1432,6 +1536,104 @@ func (p *openAIWSConnPool) evictConn(accountID int64, connID string) {
 	}
 }
 
+// RetireAccount 在账号被移除时下线其账户池：空闲连接立即关闭；
+// 正在承载 turn 的连接保持可用直到租约释放，随后关闭，避免中途打断请求或泄漏连接。
+func (p *openAIWSConnPool) RetireAccount(accountID int64) {
+	if p == nil || accountID <= 0 {
+		return
+	}
+	p.dialLatency.Delete(accountID)
+	value, ok := p.accounts.LoadAndDelete(accountID)
+	if !ok || value == nil {
+		return
+	}
+	ap, typed := value.(*openAIWSAccountPool)
+	if !typed || ap == nil {
+		return
+	}
+	idle := make([]*openAIWSConn, 0)
+	ap.mu.Lock()
+	for id, conn := range ap.conns {
+		delete(ap.conns, id)
+		if conn == nil {
+			continue
+		}
+		conn.retired.Store(true)
+		// 抢占租约成功说明连接空闲，可直接关闭；否则由持有者 Release 时关闭。
+		if conn.tryAcquire() {
+			idle = append(idle, conn)
+		}
+	}
+	ap.pinnedConns = make(map[string]int)
+	ap.lastAcquire = nil
+	ap.mu.Unlock()
+	closeOpenAIWSConns(idle)
+}
+
+// RecycleAccount 在账号凭证轮换后回收其全部连接，返回回收的连接数：连接立即从池中移除、不再被新的 turn 选中，
+// 空闲连接立即关闭，承载 turn 的连接在租约释放后关闭；账户池保留，后续 turn 使用新凭证重新建连。
+func (p *openAIWSConnPool) RecycleAccount(accountID int64) int {
+	if p == nil || accountID <= 0 {
+		return 0
+	}
+	ap, ok := p.getAccountPool(accountID)
+	if !ok || ap == nil {
+		return 0
+	}
+	recycled := 0
+	idle := make([]*openAIWSConn, 0)
+	ap.mu.Lock()
+	for id, conn := range ap.conns {
+		delete(ap.conns, id)
+		delete(ap.pinnedConns, id)
+		if conn == nil {
+			continue
+		}
+		conn.retired.Store(true)
+		recycled++
+		if conn.tryAcquire() {
+			idle = append(idle, conn)
+		}
+	}
+	ap.mu.Unlock()
+	closeOpenAIWSConns(idle)
+	return recycled
+}
+
+// EvictConnsByTag 驱逐所有带指定标签的连接，返回命中的连接数：
+// 连接立即从池中移除、不再被新的 turn 选中；空闲连接立即关闭，承载 turn 的连接在租约释放后关闭。
+func (p *openAIWSConnPool) EvictConnsByTag(tag string) int {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if p == nil || tag == "" {
+		return 0
+	}
+	evicted := 0
+	idle := make([]*openAIWSConn, 0)
+	p.accounts.Range(func(_, value any) bool {
+		ap, typed := value.(*openAIWSAccountPool)
+		if !typed || ap == nil {
+			return true
+		}
+		ap.mu.Lock()
+		for id, conn := range ap.conns {
+			if conn == nil || !conn.hasTag(tag) {
+				continue
+			}
+			delete(ap.conns, id)
+			delete(ap.pinnedConns, id)
+			conn.retired.Store(true)
+			evicted++
+			if conn.tryAcquire() {
+				idle = append(idle, conn)
+			}
+		}
+		ap.mu.Unlock()
+		return true
+	})
+	closeOpenAIWSConns(idle)
+	return evicted
+}
+
 func (p *openAIWSConnPool) PinConn(accountID int64, connID string) bool {
 	if p == nil || accountID <= 0 {
 		return false
@@ -1485,6 +1687,7 @@ func (p *openAIWSConnPool) dialConn(ctx context.Context, req openAIWSAcquireRequ
 	if p == nil || p.clientDialer == nil {
 		return nil, errors.New("openai ws client dialer is nil")
 	}
+	dialStart := time.Now()
 	conn, status, handshakeHeaders, err := p.clientDialer.Dial(ctx, req.WSURL, req.Headers, req.ProxyURL)
 	if err != nil {
 		return nil, &openAIWSDialError{
@@ -1500,8 +1703,42 @@ func (p *openAIWSConnPool) dialConn(ctx context.Context, req openAIWSAcquireRequ
 			Err:             errors.New("openai ws dialer returned nil connection"),
 		}
 	}
+	p.recordDialLatency(req.Account.ID, time.Since(dialStart))
 	id := p.nextConnID(req.Account.ID)
-	return newOpenAIWSConn(id, req.Account.ID, conn, handshakeHeaders), nil
+	wsConn := newOpenAIWSConn(id, req.Account.ID, conn, handshakeHeaders)
+	wsConn.tags = buildOpenAIWSConnTags(req)
+	return wsConn, nil
+}
+
+const (
+	openAIWSConnTagAccount  = "account"
+	openAIWSConnTagEndpoint = "endpoint"
+	openAIWSConnTagProxy    = "proxy"
+)
+
+// OpenAIWSConnTag 构造 "key:value" 形式的连接标签，如 endpoint:api.openai.com、account:42、proxy:direct。
+func OpenAIWSConnTag(key string, value string) string {
+	return strings.ToLower(strings.TrimSpace(key)) + ":" + strings.ToLower(strings.TrimSpace(value))
+}
+
+// buildOpenAIWSConnTags 根据建连请求生成连接标签：上游 endpoint 主机、账号 ID 与代理主机（无代理为 direct）。
+func buildOpenAIWSConnTags(req openAIWSAcquireRequest) []string {
+	tags := make([]string, 0, 3)
+	if req.Account != nil {
+		tags = append(tags, OpenAIWSConnTag(openAIWSConnTagAccount, strconv.FormatInt(req.Account.ID, 10)))
+	}
+	if parsed, err := url.Parse(strings.TrimSpace(req.WSURL)); err == nil && parsed.Host != "" {
+		tags = append(tags, OpenAIWSConnTag(openAIWSConnTagEndpoint, parsed.Host))
+	}
+	proxyHost := "direct"
+	if proxyURL := strings.TrimSpace(req.ProxyURL); proxyURL != "" {
+		proxyHost = proxyURL
+		if parsed, err := url.Parse(proxyURL); err == nil && parsed.Host != "" {
+			proxyHost = parsed.Host
+		}
+	}
+	tags = append(tags, OpenAIWSConnTag(openAIWSConnTagProxy, proxyHost))
+	return tags
 }
 
 func (p *openAIWSConnPool) nextConnID(accountID int64) string {
@@ -1608,10 +1845,41 @@ func (p *openAIWSConnPool) maxIdlePerAccount() int {
 	return 4
 }
 
+// maxIdlePerAccountFor 返回账号的空闲连接数上限：账号 extra 覆盖优先，否则沿用全局配置。
+func (p *openAIWSConnPool) maxIdlePerAccountFor(account *Account) int {
+	if maxIdle, ok := account.GetOpenAIWSMaxIdlePerAccount(); ok {
+		return maxIdle
+	}
+	return p.maxIdlePerAccount()
+}
+
 func (p *openAIWSConnPool) maxConnAge() time.Duration {
 	return openAIWSConnMaxAge
 }
 
+// maxConnAgeForAccount 返回账号的连接最大存活时间：账号 extra 覆盖优先，否则为全局 60 分钟。
+func (p *openAIWSConnPool) maxConnAgeForAccount(account *Account) time.Duration {
+	if seconds := account.GetOpenAIWSConnMaxLifetimeSeconds(); seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return p.maxConnAge()
+}
+
+func (p *openAIWSConnPool) connIdleTimeout() time.Duration {
+	if p != nil && p.cfg != nil && p.cfg.Gateway.OpenAIWS.ConnIdleTimeoutSeconds > 0 {
+		return time.Duration(p.cfg.Gateway.OpenAIWS.ConnIdleTimeoutSeconds) * time.Second
+	}
+	return 0
+}
+
+// connIdleTimeoutForAccount 返回账号的连接空闲回收阈值：账号 extra 覆盖优先，否则沿用全局配置。
+func (p *openAIWSConnPool) connIdleTimeoutForAccount(account *Account) time.Duration {
+	if seconds := account.GetOpenAIWSConnIdleTimeoutSeconds(); seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return p.connIdleTimeout()
+}
+
 func (p *openAIWSConnPool) queueLimitPerConn() int {
 	if p != nil && p.cfg != nil && p.cfg.Gateway.OpenAIWS.QueueLimitPerConn > 0 {
 		return p.cfg.Gateway.OpenAIWS.QueueLimitPerConn
@@ -717,6 +717,131 @@ func TestOpenAIWSConnPool_BackgroundCleanupSweep_WithoutAcquire(t *testing.T) {
 	require.False(t, exists, "后台清理应在无新 acquire 时也回收过期连接")
 }
 
+func TestOpenAIWSConnPool_BackgroundCleanupSweep_IdleTimeoutRewarmsMinIdle(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.MaxConnsPerAccount = 4
+	cfg.Gateway.OpenAIWS.MinIdlePerAccount = 1
+	cfg.Gateway.OpenAIWS.MaxIdlePerAccount = 4
+	cfg.Gateway.OpenAIWS.PoolTargetUtilization = 0.8
+	cfg.Gateway.OpenAIWS.DialTimeoutSeconds = 1
+	cfg.Gateway.OpenAIWS.ConnIdleTimeoutSeconds = 60
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(&openAIWSFakeDialer{})
+
+	accountID := int64(303)
+	ap := pool.getOrCreateAccountPool(accountID)
+	idle := newOpenAIWSConn("idle_timeout_bg", accountID, &openAIWSFakeConn{}, nil)
+	idle.lastUsedNano.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	busy := newOpenAIWSConn("idle_timeout_leased", accountID, &openAIWSFakeConn{}, nil)
+	busy.lastUsedNano.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	require.True(t, busy.tryAcquire())
+	fresh := newOpenAIWSConn("idle_timeout_fresh", accountID, &openAIWSFakeConn{}, nil)
+	ap.mu.Lock()
+	ap.conns[idle.id] = idle
+	ap.conns[busy.id] = busy
+	ap.conns[fresh.id] = fresh
+	ap.mu.Unlock()
+
+	pool.runBackgroundCleanupSweep(time.Now())
+
+	ap.mu.Lock()
+	_, idleExists := ap.conns[idle.id]
+	_, busyExists := ap.conns[busy.id]
+	_, freshExists := ap.conns[fresh.id]
+	ap.mu.Unlock()
+	require.False(t, idleExists, "空闲超时的连接应被回收")
+	require.True(t, busyExists, "租用中的连接不受空闲超时影响")
+	require.True(t, freshExists, "未超时的空闲连接应保留")
+	require.Equal(t, int64(1), pool.SnapshotMetrics().IdleTimeoutEvictTotal)
+	busy.release()
+
+	// 回收后低于 min_idle 时重新预热补足。
+	ap.mu.Lock()
+	ap.lastAcquire = &openAIWSAcquireRequest{
+		Account: &Account{ID: accountID, Platform: PlatformOpenAI, Type: AccountTypeAPIKey},
+		WSURL:   "wss://example.com/v1/responses",
+	}
+	for id := range ap.conns {
+		ap.conns[id].lastUsedNano.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	}
+	ap.mu.Unlock()
+
+	pool.runBackgroundCleanupSweep(time.Now())
+
+	require.Eventually(t, func() bool {
+		ap.mu.Lock()
+		defer ap.mu.Unlock()
+		_, busyExists := ap.conns[busy.id]
+		_, freshExists := ap.conns[fresh.id]
+		return !busyExists && !freshExists && len(ap.conns) >= 1 && !ap.prewarmActive
+	}, 2*time.Second, 20*time.Millisecond)
+	require.Equal(t, int64(3), pool.SnapshotMetrics().IdleTimeoutEvictTotal)
+}
+
+func TestOpenAIWSConnPool_BackgroundCleanupSweep_PerAccountIdleOverrides(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.MaxConnsPerAccount = 4
+	cfg.Gateway.OpenAIWS.MaxIdlePerAccount = 4
+	cfg.Gateway.OpenAIWS.ConnIdleTimeoutSeconds = 300
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(&openAIWSFakeDialer{})
+
+	// flaky 账号覆盖为更短的空闲回收、存活时间与更少的空闲连接；steady 账号沿用全局配置。
+	flaky := &Account{
+		ID:          311,
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Concurrency: 4,
+		Extra: map[string]any{
+			"openai_ws_conn_idle_timeout_seconds": 30,
+			"openai_ws_conn_max_lifetime_seconds": "600",
+			"openai_ws_max_idle_per_account":      1,
+		},
+	}
+	steady := &Account{ID: 312, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Concurrency: 4}
+
+	now := time.Now()
+	seed := func(account *Account) (*openAIWSAccountPool, map[string]*openAIWSConn) {
+		ap := pool.getOrCreateAccountPool(account.ID)
+		conns := map[string]*openAIWSConn{
+			"idle":  newOpenAIWSConn("idle_"+account.Name, account.ID, &openAIWSFakeConn{}, nil),
+			"old":   newOpenAIWSConn("old_"+account.Name, account.ID, &openAIWSFakeConn{}, nil),
+			"fresh": newOpenAIWSConn("fresh_"+account.Name, account.ID, &openAIWSFakeConn{}, nil),
+			"spare": newOpenAIWSConn("spare_"+account.Name, account.ID, &openAIWSFakeConn{}, nil),
+		}
+		conns["idle"].lastUsedNano.Store(now.Add(-2 * time.Minute).UnixNano())
+		conns["old"].createdAtNano.Store(now.Add(-20 * time.Minute).UnixNano())
+		conns["spare"].lastUsedNano.Store(now.Add(-10 * time.Second).UnixNano())
+		ap.mu.Lock()
+		ap.lastAcquire = &openAIWSAcquireRequest{Account: account, WSURL: "wss://example.com/v1/responses"}
+		for _, conn := range conns {
+			ap.conns[conn.id] = conn
+		}
+		ap.mu.Unlock()
+		return ap, conns
+	}
+	flaky.Name, steady.Name = "flaky", "steady"
+	flakyPool, flakyConns := seed(flaky)
+	steadyPool, steadyConns := seed(steady)
+
+	pool.runBackgroundCleanupSweep(now)
+
+	remaining := func(ap *openAIWSAccountPool, conns map[string]*openAIWSConn) []string {
+		ap.mu.Lock()
+		defer ap.mu.Unlock()
+		out := make([]string, 0, len(conns))
+		for _, name := range []string{"idle", "old", "fresh", "spare"} {
+			if _, ok := ap.conns[conns[name].id]; ok {
+				out = append(out, name)
+			}
+		}
+		return out
+	}
+	require.Equal(t, []string{"fresh"}, remaining(flakyPool, flakyConns), "账号覆盖：空闲 30s、存活 10 分钟后回收，且最多保留 1 条空闲连接")
+	require.Equal(t, []string{"idle", "old", "fresh", "spare"}, remaining(steadyPool, steadyConns), "未覆盖的账号沿用全局配置")
+	require.Equal(t, int64(1), pool.SnapshotMetrics().IdleTimeoutEvictTotal)
+}
+
 func TestOpenAIWSConnPool_BackgroundWorkerGuardBranches(t *testing.T) {
 	var nilPool *openAIWSConnPool
 	require.NotPanics(t, func() {
@@ -1414,6 +1539,93 @@ func TestOpenAIWSConnPool_Acquire_ErrorBranches(t *testing.T) {
 	require.ErrorIs(t, err, errOpenAIWSConnQueueFull)
 }
 
+func TestOpenAIWSConnPool_RetireAccountMidTurnCompletesThenTearsDown(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.MaxConnsPerAccount = 2
+	cfg.Gateway.OpenAIWS.MinIdlePerAccount = 0
+	cfg.Gateway.OpenAIWS.MaxIdlePerAccount = 2
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(&openAIWSFakeDialer{})
+
+	account := &Account{ID: 5101, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Concurrency: 2}
+	req := openAIWSAcquireRequest{Account: account, WSURL: "wss://example.com/v1/responses"}
+
+	// turn 开始：持有一条连接，同时池中另有一条空闲连接。
+	lease, err := pool.Acquire(context.Background(), req)
+	require.NoError(t, err)
+	idle := newOpenAIWSConn("idle_conn", account.ID, &openAIWSFakeConn{}, nil)
+	ap, ok := pool.getAccountPool(account.ID)
+	require.True(t, ok)
+	ap.mu.Lock()
+	ap.conns[idle.id] = idle
+	ap.mu.Unlock()
+	require.True(t, pool.PinConn(account.ID, lease.ConnID()))
+
+	pool.RetireAccount(account.ID)
+
+	_, ok = pool.getAccountPool(account.ID)
+	require.False(t, ok, "账号下线后账户池应被移除")
+	select {
+	case <-idle.closedCh:
+	default:
+		t.Fatal("空闲连接应在账号下线时立即关闭")
+	}
+	select {
+	case <-lease.conn.closedCh:
+		t.Fatal("进行中 turn 的连接不应被提前关闭")
+	default:
+	}
+
+	// turn 在原连接上继续完成，池操作不应 panic。
+	require.NoError(t, lease.WriteJSON(map[string]any{"type": "response.create"}, time.Second))
+	message, err := lease.ReadMessage(time.Second)
+	require.NoError(t, err)
+	require.Contains(t, string(message), "response.completed")
+	pool.UnpinConn(account.ID, lease.ConnID())
+	require.False(t, pool.PinConn(account.ID, lease.ConnID()))
+	inflight, waiters, conns := pool.AccountPoolLoad(account.ID)
+	require.Zero(t, inflight+waiters+conns)
+
+	lease.Release()
+	select {
+	case <-lease.conn.closedCh:
+	default:
+		t.Fatal("turn 结束释放租约后连接应被关闭")
+	}
+	lease.Release()
+	lease.MarkBroken()
+
+	// 账号重新出现时应重新建连，不复用已下线的连接。
+	next, err := pool.Acquire(context.Background(), req)
+	require.NoError(t, err)
+	require.NotEqual(t, lease.ConnID(), next.ConnID())
+	require.False(t, next.Reused())
+	next.Release()
+}
+
+func TestOpenAIWSConnLease_MarkBrokenAfterRetireClosesConn(t *testing.T) {
+	pool := newOpenAIWSConnPool(&config.Config{})
+	accountID := int64(5102)
+	conn := newOpenAIWSConn("retired_broken", accountID, &openAIWSFakeConn{}, nil)
+	require.True(t, conn.tryAcquire())
+	ap := pool.getOrCreateAccountPool(accountID)
+	ap.mu.Lock()
+	ap.conns[conn.id] = conn
+	ap.mu.Unlock()
+
+	pool.RetireAccount(accountID)
+	pool.RetireAccount(accountID)
+
+	lease := &openAIWSConnLease{pool: pool, accountID: accountID, conn: conn}
+	lease.MarkBroken()
+	select {
+	case <-conn.closedCh:
+	default:
+		t.Fatal("账号下线后标记 broken 的连接应被关闭")
+	}
+	lease.Release()
+}
+
 type openAIWSFakeDialer struct{}
 
 func (d *openAIWSFakeDialer) Dial(
@@ -1688,6 +1900,81 @@ func TestOpenAIWSConnPool_DialConnNilConnection(t *testing.T) {
 	require.Contains(t, err.Error(), "nil connection")
 }
 
+type openAIWSDelayDialer struct {
+	delay time.Duration
+}
+
+func (d *openAIWSDelayDialer) Dial(
+	ctx context.Context,
+	wsURL string,
+	headers http.Header,
+	proxyURL string,
+) (openAIWSClientConn, int, http.Header, error) {
+	_ = wsURL
+	_ = headers
+	_ = proxyURL
+	select {
+	case <-ctx.Done():
+		return nil, 0, nil, ctx.Err()
+	case <-time.After(d.delay):
+	}
+	return &openAIWSFakeConn{}, 0, nil, nil
+}
+
+func TestOpenAIWSConnPool_RecordsDialLatencyPerAccount(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.MaxConnsPerAccount = 2
+	cfg.Gateway.OpenAIWS.DialTimeoutSeconds = 3
+
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(&openAIWSDelayDialer{delay: 120 * time.Millisecond})
+	account := &Account{ID: 95, Platform: PlatformOpenAI, Type: AccountTypeAPIKey}
+
+	lease, err := pool.Acquire(context.Background(), openAIWSAcquireRequest{
+		Account: account,
+		WSURL:   "wss://example.com/v1/responses",
+	})
+	require.NoError(t, err)
+	lease.Release()
+
+	snapshot := pool.SnapshotMetrics().DialLatencyByAccount
+	require.Len(t, snapshot, 1)
+	latency := snapshot[account.ID]
+	require.Equal(t, int64(1), latency.Count)
+	require.GreaterOrEqual(t, latency.SumMs, int64(120))
+	require.GreaterOrEqual(t, latency.MaxMs, int64(120))
+	require.GreaterOrEqual(t, latency.P99Ms, int64(120))
+	require.Len(t, latency.Buckets, len(openAIWSDialLatencyBucketsMs)+1)
+	for _, bucket := range latency.Buckets {
+		if bucket.UpperMs != 0 && bucket.UpperMs < 120 {
+			require.Zero(t, bucket.Count, "耗时不应落入上界小于实际延迟的桶")
+		}
+	}
+
+	pool.RetireAccount(account.ID)
+	require.Empty(t, pool.SnapshotDialLatency(), "账号下线后应清理其建连耗时分布")
+}
+
+func TestOpenAIWSDialLatencyHistogram_Quantiles(t *testing.T) {
+	var histogram openAIWSDialLatencyHistogram
+	require.Zero(t, histogram.snapshot().P99Ms)
+
+	for i := 0; i < 98; i++ {
+		histogram.observe(30 * time.Millisecond)
+	}
+	histogram.observe(700 * time.Millisecond)
+	histogram.observe(12 * time.Second)
+
+	snapshot := histogram.snapshot()
+	require.Equal(t, int64(100), snapshot.Count)
+	require.Equal(t, int64(50), snapshot.P50Ms, "分位值取所在桶上界")
+	require.Equal(t, int64(50), snapshot.P95Ms)
+	require.Equal(t, int64(1000), snapshot.P99Ms)
+	require.Equal(t, int64(12000), snapshot.MaxMs)
+	require.Equal(t, int64(1), snapshot.Buckets[len(snapshot.Buckets)-1].Count)
+	require.Equal(t, int64(12000), snapshot.quantileMs(1))
+}
+
 func TestOpenAIWSConnPool_SnapshotTransportMetrics(t *testing.T) {
 	cfg := &config.Config{}
 	pool := newOpenAIWSConnPool(cfg)
@@ -1707,3 +1994,138 @@ func TestOpenAIWSConnPool_SnapshotTransportMetrics(t *testing.T) {
 	require.Equal(t, int64(2), snapshot.ProxyClientCacheMisses)
 	require.InDelta(t, 1.0/3.0, snapshot.TransportReuseRatio, 0.0001)
 }
+
+func TestOpenAIWSConnPool_EvictConnsByTag(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.MaxConnsPerAccount = 2
+	cfg.Gateway.OpenAIWS.MinIdlePerAccount = 0
+	cfg.Gateway.OpenAIWS.MaxIdlePerAccount = 2
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(&openAIWSFakeDialer{})
+
+	deprecated := &Account{ID: 5201, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Concurrency: 2}
+	healthy := &Account{ID: 5202, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Concurrency: 2}
+	deprecatedReq := openAIWSAcquireRequest{Account: deprecated, WSURL: "wss://old.example.com/v1/responses"}
+	healthyReq := openAIWSAcquireRequest{Account: healthy, WSURL: "wss://new.example.com/v1/responses", ProxyURL: "http://proxy.local:8080"}
+
+	active, err := pool.Acquire(context.Background(), deprecatedReq)
+	require.NoError(t, err)
+	idleLease, err := pool.Acquire(context.Background(), openAIWSAcquireRequest{Account: deprecated, WSURL: deprecatedReq.WSURL, ForceNewConn: true})
+	require.NoError(t, err)
+	idleConn := idleLease.conn
+	idleLease.Release()
+	other, err := pool.Acquire(context.Background(), healthyReq)
+	require.NoError(t, err)
+	other.Release()
+
+	require.ElementsMatch(t, []string{"account:5201", "endpoint:old.example.com", "proxy:direct"}, active.conn.tags)
+	require.ElementsMatch(t, []string{"account:5202", "endpoint:new.example.com", "proxy:proxy.local:8080"}, other.conn.tags)
+
+	require.Zero(t, pool.EvictConnsByTag(""))
+	require.Zero(t, pool.EvictConnsByTag("endpoint:missing.example.com"))
+	require.Equal(t, 2, pool.EvictConnsByTag(OpenAIWSConnTag("endpoint", "OLD.example.com")))
+
+	select {
+	case <-idleConn.closedCh:
+	default:
+		t.Fatal("空闲的命中连接应立即关闭")
+	}
+	select {
+	case <-active.conn.closedCh:
+		t.Fatal("承载 turn 的命中连接不应被提前关闭")
+	default:
+	}
+	select {
+	case <-other.conn.closedCh:
+		t.Fatal("未命中标签的连接不应受影响")
+	default:
+	}
+	_, _, conns := pool.AccountPoolLoad(deprecated.ID)
+	require.Zero(t, conns, "命中连接应从池中移除")
+	_, _, conns = pool.AccountPoolLoad(healthy.ID)
+	require.Equal(t, 1, conns)
+
+	require.NoError(t, active.WriteJSON(map[string]any{"type": "response.create"}, time.Second))
+	_, err = active.ReadMessage(time.Second)
+	require.NoError(t, err)
+	active.Release()
+	select {
+	case <-active.conn.closedCh:
+	default:
+		t.Fatal("turn 结束释放租约后命中连接应被关闭")
+	}
+
+	next, err := pool.Acquire(context.Background(), deprecatedReq)
+	require.NoError(t, err)
+	require.False(t, next.Reused(), "驱逐后应重新建连")
+	next.Release()
+
+	svc := &OpenAIGatewayService{openaiWSPool: pool}
+	require.Equal(t, 1, svc.EvictOpenAIWSConnsByTag("account:5202"))
+}
+
+func TestOpenAIWSConnPool_RecycleAccount(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.MaxConnsPerAccount = 2
+	cfg.Gateway.OpenAIWS.MinIdlePerAccount = 0
+	cfg.Gateway.OpenAIWS.MaxIdlePerAccount = 2
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(&openAIWSFakeDialer{})
+
+	rotated := &Account{ID: 5301, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Concurrency: 2}
+	other := &Account{ID: 5302, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Concurrency: 2}
+	rotatedReq := openAIWSAcquireRequest{Account: rotated, WSURL: "wss://example.com/v1/responses"}
+
+	active, err := pool.Acquire(context.Background(), rotatedReq)
+	require.NoError(t, err)
+	idleLease, err := pool.Acquire(context.Background(), openAIWSAcquireRequest{Account: rotated, WSURL: rotatedReq.WSURL, ForceNewConn: true})
+	require.NoError(t, err)
+	idleConn := idleLease.conn
+	idleLease.Release()
+	otherLease, err := pool.Acquire(context.Background(), openAIWSAcquireRequest{Account: other, WSURL: rotatedReq.WSURL})
+	require.NoError(t, err)
+	otherLease.Release()
+	require.True(t, pool.PinConn(rotated.ID, active.ConnID()))
+
+	require.Zero(t, pool.RecycleAccount(0))
+	require.Zero(t, pool.RecycleAccount(9999))
+	require.Equal(t, 2, pool.RecycleAccount(rotated.ID))
+
+	select {
+	case <-idleConn.closedCh:
+	default:
+		t.Fatal("空闲连接应在回收时立即关闭")
+	}
+	select {
+	case <-active.conn.closedCh:
+		t.Fatal("承载 turn 的连接不应被提前关闭")
+	default:
+	}
+	require.True(t, active.Retired())
+	require.False(t, otherLease.Retired(), "其他账号的连接不应受影响")
+	_, ok := pool.getAccountPool(rotated.ID)
+	require.True(t, ok, "回收连接不应移除账户池")
+	_, _, conns := pool.AccountPoolLoad(rotated.ID)
+	require.Zero(t, conns)
+	_, _, conns = pool.AccountPoolLoad(other.ID)
+	require.Equal(t, 1, conns)
+
+	require.NoError(t, active.WriteJSON(map[string]any{"type": "response.create"}, time.Second))
+	_, err = active.ReadMessage(time.Second)
+	require.NoError(t, err)
+	active.Release()
+	select {
+	case <-active.conn.closedCh:
+	default:
+		t.Fatal("turn 结束释放租约后连接应被关闭")
+	}
+
+	next, err := pool.Acquire(context.Background(), rotatedReq)
+	require.NoError(t, err)
+	require.False(t, next.Reused(), "回收后应使用新凭证重新建连")
+	next.Release()
+
+	svc := &OpenAIGatewayService{openaiWSPool: pool}
+	require.Equal(t, 1, svc.RecycleAccountConnections(rotated.ID))
+	require.Zero(t, svc.RecycleAccountConnections(0))
+}
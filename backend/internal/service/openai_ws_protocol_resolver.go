@@ -1,6 +1,10 @@
 package service
 
-import "github.com/Wei-Shaw/sub2api/internal/config"
+import (
+	"strings"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+)
 
 // OpenAIUpstreamTransport 表示 OpenAI 上游传输协议。
 type OpenAIUpstreamTransport string
@@ -21,6 +25,8 @@ type OpenAIWSProtocolDecision struct {
 // OpenAIWSProtocolResolver 定义 OpenAI 上游协议决策。
 type OpenAIWSProtocolResolver interface {
 	Resolve(account *Account) OpenAIWSProtocolDecision
+	// ResolveForModel 在 Resolve 的基础上叠加 model_transports 的模型级限制。
+	ResolveForModel(account *Account, model string) OpenAIWSProtocolDecision
 }
 
 type defaultOpenAIWSProtocolResolver struct {
@@ -112,6 +118,60 @@ func (r *defaultOpenAIWSProtocolResolver) Resolve(account *Account) OpenAIWSProt
 	return openAIWSHTTPDecision("feature_disabled")
 }
 
+// openAIWSModelHTTPOnlyReason 为仅 HTTP 模型强制走 HTTP 时的决策原因。
+const openAIWSModelHTTPOnlyReason = "model_http_only"
+
+// ResolveForModel 仅 HTTP 的模型（匹配请求模型或账号映射后的模型）始终走 HTTP，其余与 Resolve 一致。
+func (r *defaultOpenAIWSProtocolResolver) ResolveForModel(account *Account, model string) OpenAIWSProtocolDecision {
+	decision := r.Resolve(account)
+	if decision.Transport == OpenAIUpstreamTransportHTTPSSE || r == nil || r.cfg == nil {
+		return decision
+	}
+	if openAIWSModelRequiresHTTP(r.cfg.Gateway.OpenAIWS.ModelTransports, account, model) {
+		return openAIWSHTTPDecision(openAIWSModelHTTPOnlyReason)
+	}
+	return decision
+}
+
+// openAIWSModelRequiresHTTP 判断模型是否被 model_transports 限制为仅 HTTP。
+func openAIWSModelRequiresHTTP(rules []config.GatewayOpenAIWSModelTransport, account *Account, model string) bool {
+	model = strings.TrimSpace(model)
+	if len(rules) == 0 || model == "" {
+		return false
+	}
+	if matchOpenAIWSModelTransport(rules, model) == "http" {
+		return true
+	}
+	if account != nil {
+		if mapped := strings.TrimSpace(account.GetMappedModel(model)); mapped != "" && mapped != model {
+			return matchOpenAIWSModelTransport(rules, mapped) == "http"
+		}
+	}
+	return false
+}
+
+// matchOpenAIWSModelTransport 返回模型命中规则的传输协议：精确匹配优先，其次最长前缀；未命中返回空串。
+func matchOpenAIWSModelTransport(rules []config.GatewayOpenAIWSModelTransport, model string) string {
+	model = strings.ToLower(model)
+	matched := ""
+	matchedPrefixLen := -1
+	for _, rule := range rules {
+		pattern := strings.ToLower(strings.TrimSpace(rule.Model))
+		transport := strings.ToLower(strings.TrimSpace(rule.Transport))
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(model, prefix) && len(prefix) > matchedPrefixLen {
+				matched = transport
+				matchedPrefixLen = len(prefix)
+			}
+			continue
+		}
+		if pattern == model {
+			return transport
+		}
+	}
+	return matched
+}
+
 func openAIWSHTTPDecision(reason string) OpenAIWSProtocolDecision {
 	return OpenAIWSProtocolDecision{
 		Transport: OpenAIUpstreamTransportHTTPSSE,
@@ -215,3 +215,53 @@ func TestOpenAIWSProtocolResolver_Resolve_ModeRouterV2(t *testing.T) {
 		require.Equal(t, "account_concurrency_invalid", decision.Reason)
 	})
 }
+
+func TestOpenAIWSProtocolResolver_ResolveForModel(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.Enabled = true
+	cfg.Gateway.OpenAIWS.APIKeyEnabled = true
+	cfg.Gateway.OpenAIWS.ResponsesWebsocketsV2 = true
+	cfg.Gateway.OpenAIWS.ModelTransports = []config.GatewayOpenAIWSModelTransport{
+		{Model: "gpt-image-*", Transport: "http"},
+		{Model: "gpt-image-1-ws", Transport: "any"},
+		{Model: "o1-pro", Transport: "HTTP"},
+		{Model: "gpt-5*", Transport: "any"},
+		{Model: "gpt-5.1-legacy*", Transport: "http"},
+	}
+	account := &Account{
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Concurrency: 1,
+		Credentials: map[string]any{
+			"model_mapping": map[string]any{"image-alias": "gpt-image-1"},
+		},
+		Extra: map[string]any{"responses_websockets_v2_enabled": true},
+	}
+	resolver := NewOpenAIWSProtocolResolver(cfg)
+
+	cases := []struct {
+		model string
+		want  OpenAIUpstreamTransport
+	}{
+		{model: "gpt-5.1", want: OpenAIUpstreamTransportResponsesWebsocketV2},
+		{model: "", want: OpenAIUpstreamTransportResponsesWebsocketV2},
+		{model: "gpt-image-1", want: OpenAIUpstreamTransportHTTPSSE},
+		{model: "GPT-Image-2", want: OpenAIUpstreamTransportHTTPSSE},
+		{model: "gpt-image-1-ws", want: OpenAIUpstreamTransportResponsesWebsocketV2},
+		{model: "o1-pro", want: OpenAIUpstreamTransportHTTPSSE},
+		{model: "o1-pro-2025", want: OpenAIUpstreamTransportResponsesWebsocketV2},
+		{model: "gpt-5.1-legacy-mini", want: OpenAIUpstreamTransportHTTPSSE},
+		{model: "image-alias", want: OpenAIUpstreamTransportHTTPSSE},
+	}
+	for _, tc := range cases {
+		decision := resolver.ResolveForModel(account, tc.model)
+		require.Equal(t, tc.want, decision.Transport, "model=%q", tc.model)
+		if tc.want == OpenAIUpstreamTransportHTTPSSE {
+			require.Equal(t, openAIWSModelHTTPOnlyReason, decision.Reason)
+		}
+	}
+
+	// 账号本身走 HTTP 时保持原有决策原因。
+	httpAccount := &Account{Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Concurrency: 1}
+	require.Equal(t, "account_disabled", resolver.ResolveForModel(httpAccount, "gpt-image-1").Reason)
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// openAIWSRecoveryReconnectQueueWait 恢复重连在全局上限已满时的最长排队时间。
+const openAIWSRecoveryReconnectQueueWait = 5 * time.Second
+
+var errOpenAIWSRecoveryReconnectSaturated = errors.New("openai ws recovery reconnects saturated")
+
+// openAIWSRecoveryReconnectLimiter 全服务范围的恢复重连信号量。
+// 上限在每次获取时读取，热更新后立即生效；零值可直接使用。
+type openAIWSRecoveryReconnectLimiter struct {
+	mu       sync.Mutex
+	inFlight int
+	// wake 在有空位释放时关闭并替换，用于唤醒全部排队者重新竞争。
+	wake chan struct{}
+
+	inFlightGauge atomic.Int64
+	queuedTotal   atomic.Int64
+	rejectedTotal atomic.Int64
+}
+
+// acquire 获取一个恢复重连名额；limit<=0 表示不限制。已满时排队直到有空位、ctx 结束或超过 maxWait。
+func (l *openAIWSRecoveryReconnectLimiter) acquire(ctx context.Context, limit int, maxWait time.Duration) (func(), error) {
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	queued := false
+	for {
+		l.mu.Lock()
+		if limit <= 0 || l.inFlight < limit {
+			l.inFlight++
+			l.mu.Unlock()
+			l.inFlightGauge.Add(1)
+			var once sync.Once
+			return func() { once.Do(l.release) }, nil
+		}
+		if l.wake == nil {
+			l.wake = make(chan struct{})
+		}
+		wake := l.wake
+		l.mu.Unlock()
+
+		if !queued {
+			queued = true
+			l.queuedTotal.Add(1)
+			timer = time.NewTimer(maxWait)
+		}
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			l.rejectedTotal.Add(1)
+			return nil, ctx.Err()
+		case <-timer.C:
+			l.rejectedTotal.Add(1)
+			return nil, errOpenAIWSRecoveryReconnectSaturated
+		}
+	}
+}
+
+func (l *openAIWSRecoveryReconnectLimiter) release() {
+	l.mu.Lock()
+	l.inFlight--
+	if l.wake != nil {
+		close(l.wake)
+		l.wake = nil
+	}
+	l.mu.Unlock()
+	l.inFlightGauge.Add(-1)
+}
+
+// openAIWSMaxConcurrentRecoveryReconnects 返回全局恢复重连并发上限，0 表示不限制。
+func (s *OpenAIGatewayService) openAIWSMaxConcurrentRecoveryReconnects() int {
+	if s == nil || s.cfg == nil || s.openAIWSConfig().MaxConcurrentRecoveryReconnects <= 0 {
+		return 0
+	}
+	return s.openAIWSConfig().MaxConcurrentRecoveryReconnects
+}
+
+// acquireOpenAIWSRecoveryReconnectSlot 为一次恢复重连占用全局名额，返回的 release 必须在重连结束后调用。
+func (s *OpenAIGatewayService) acquireOpenAIWSRecoveryReconnectSlot(ctx context.Context) (func(), error) {
+	return s.openaiWSRecoveryReconnects.acquire(ctx, s.openAIWSMaxConcurrentRecoveryReconnects(), openAIWSRecoveryReconnectQueueWait)
+}
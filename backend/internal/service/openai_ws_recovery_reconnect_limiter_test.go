@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIWSRecoveryReconnectLimiter_BoundsInFlight(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.MaxConcurrentRecoveryReconnects = 2
+	svc := &OpenAIGatewayService{cfg: cfg}
+	ctx := context.Background()
+
+	release1, err := svc.acquireOpenAIWSRecoveryReconnectSlot(ctx)
+	require.NoError(t, err)
+	release2, err := svc.acquireOpenAIWSRecoveryReconnectSlot(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), svc.SnapshotOpenAIWSRecoveryMetrics().ReconnectInFlight)
+
+	// 名额已满：排队等待，直到有名额释放。
+	acquired := make(chan func(), 1)
+	go func() {
+		release, acquireErr := svc.acquireOpenAIWSRecoveryReconnectSlot(ctx)
+		if acquireErr == nil {
+			acquired <- release
+		}
+	}()
+	require.Eventually(t, func() bool {
+		return svc.SnapshotOpenAIWSRecoveryMetrics().ReconnectQueuedTotal == 1
+	}, time.Second, 5*time.Millisecond)
+	select {
+	case <-acquired:
+		t.Fatal("名额已满时不应立即获取成功")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	release1()
+	release1() // 重复释放应为幂等
+	var release3 func()
+	select {
+	case release3 = <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("释放名额后排队的重连应获取成功")
+	}
+	require.Equal(t, int64(2), svc.SnapshotOpenAIWSRecoveryMetrics().ReconnectInFlight)
+
+	// 排队期间会话结束：放弃重连并计入拒绝次数。
+	cancelCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = svc.acquireOpenAIWSRecoveryReconnectSlot(cancelCtx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, int64(1), svc.SnapshotOpenAIWSRecoveryMetrics().ReconnectRejectedTotal)
+
+	release2()
+	release3()
+	snapshot := svc.SnapshotOpenAIWSRecoveryMetrics()
+	require.Zero(t, snapshot.ReconnectInFlight)
+	require.Equal(t, int64(2), snapshot.ReconnectQueuedTotal)
+}
+
+func TestOpenAIWSRecoveryReconnectLimiter_QueueWaitTimeout(t *testing.T) {
+	var limiter openAIWSRecoveryReconnectLimiter
+	release, err := limiter.acquire(context.Background(), 1, time.Second)
+	require.NoError(t, err)
+	defer release()
+
+	_, err = limiter.acquire(context.Background(), 1, 10*time.Millisecond)
+	require.ErrorIs(t, err, errOpenAIWSRecoveryReconnectSaturated)
+	require.Equal(t, int64(1), limiter.rejectedTotal.Load())
+
+	// 上限为 0 表示不限制。
+	unlimited, err := limiter.acquire(context.Background(), 0, 10*time.Millisecond)
+	require.NoError(t, err)
+	unlimited()
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// ingress WS 单轮恢复手段（按触发位置区分层级）。
+const (
+	// openAIWSRecoveryPreflightReconnect 轮次开始前预检 ping 失败，透明重建上游连接。
+	openAIWSRecoveryPreflightReconnect = "preflight_reconnect"
+	// openAIWSRecoveryPreflightPrevIDDrop 严格亲和链路预检 ping 失败，去掉 previous_response_id 后全量重放。
+	openAIWSRecoveryPreflightPrevIDDrop = "preflight_prev_id_drop"
+	// openAIWSRecoveryPrevIDDrop Layer 2：上游返回 previous_response_not_found，去掉 previous_response_id 后全量重放。
+	openAIWSRecoveryPrevIDDrop = "prev_id_drop"
+	// openAIWSRecoveryTurnRetry 可重试错误下换连接重发本轮。
+	openAIWSRecoveryTurnRetry = "turn_retry"
+)
+
+// openAIWSRecoveryLayers 固定各层在计数数组中的下标，同时决定快照输出的层集合。
+var openAIWSRecoveryLayers = [...]string{
+	openAIWSRecoveryPreflightReconnect,
+	openAIWSRecoveryPreflightPrevIDDrop,
+	openAIWSRecoveryPrevIDDrop,
+	openAIWSRecoveryTurnRetry,
+}
+
+func openAIWSRecoveryLayerIndex(layer string) int {
+	for i, candidate := range openAIWSRecoveryLayers {
+		if candidate == layer {
+			return i
+		}
+	}
+	return -1
+}
+
+type openAIWSRecoveryMetrics struct {
+	attempts         [len(openAIWSRecoveryLayers)]atomic.Int64
+	successes        [len(openAIWSRecoveryLayers)]atomic.Int64
+	recoveredTurns   atomic.Int64
+	unrecoveredTurns atomic.Int64
+}
+
+// OpenAIWSRecoveryLayerMetrics 单个恢复层的尝试/成功次数。
+// 成功指该层是本轮最后一次尝试且本轮最终成功。
+type OpenAIWSRecoveryLayerMetrics struct {
+	AttemptTotal int64 `json:"attempt_total"`
+	SuccessTotal int64 `json:"success_total"`
+}
+
+type OpenAIWSRecoveryMetricsSnapshot struct {
+	Layers                map[string]OpenAIWSRecoveryLayerMetrics `json:"layers"`
+	RecoveredTurnsTotal   int64                                   `json:"recovered_turns_total"`
+	UnrecoveredTurnsTotal int64                                   `json:"unrecovered_turns_total"`
+	// ReconnectInFlight 当前占用全局名额、正在进行的恢复重连数。
+	ReconnectInFlight int64 `json:"reconnect_in_flight"`
+	// ReconnectQueuedTotal 因全局上限已满而排队的恢复重连次数。
+	ReconnectQueuedTotal int64 `json:"reconnect_queued_total"`
+	// ReconnectRejectedTotal 排队超时或会话结束而放弃的恢复重连次数。
+	ReconnectRejectedTotal int64 `json:"reconnect_rejected_total"`
+}
+
+func (s *OpenAIGatewayService) recordOpenAIWSRecoveryAttempt(layer string) {
+	if s == nil {
+		return
+	}
+	if idx := openAIWSRecoveryLayerIndex(layer); idx >= 0 {
+		s.openaiWSRecoveryMetrics.attempts[idx].Add(1)
+	}
+}
+
+// recordOpenAIWSTurnRecovery 在轮次结束时汇总本轮恢复轨迹；未触发任何恢复的轮次不计数。
+func (s *OpenAIGatewayService) recordOpenAIWSTurnRecovery(mitigations []string, succeeded bool) {
+	if s == nil || len(mitigations) == 0 {
+		return
+	}
+	if !succeeded {
+		s.openaiWSRecoveryMetrics.unrecoveredTurns.Add(1)
+		return
+	}
+	s.openaiWSRecoveryMetrics.recoveredTurns.Add(1)
+	if idx := openAIWSRecoveryLayerIndex(mitigations[len(mitigations)-1]); idx >= 0 {
+		s.openaiWSRecoveryMetrics.successes[idx].Add(1)
+	}
+}
+
+func (s *OpenAIGatewayService) SnapshotOpenAIWSRecoveryMetrics() OpenAIWSRecoveryMetricsSnapshot {
+	if s == nil {
+		return OpenAIWSRecoveryMetricsSnapshot{}
+	}
+	snapshot := OpenAIWSRecoveryMetricsSnapshot{
+		Layers:                 make(map[string]OpenAIWSRecoveryLayerMetrics, len(openAIWSRecoveryLayers)),
+		RecoveredTurnsTotal:    s.openaiWSRecoveryMetrics.recoveredTurns.Load(),
+		UnrecoveredTurnsTotal:  s.openaiWSRecoveryMetrics.unrecoveredTurns.Load(),
+		ReconnectInFlight:      s.openaiWSRecoveryReconnects.inFlightGauge.Load(),
+		ReconnectQueuedTotal:   s.openaiWSRecoveryReconnects.queuedTotal.Load(),
+		ReconnectRejectedTotal: s.openaiWSRecoveryReconnects.rejectedTotal.Load(),
+	}
+	for i, layer := range openAIWSRecoveryLayers {
+		snapshot.Layers[layer] = OpenAIWSRecoveryLayerMetrics{
+			AttemptTotal: s.openaiWSRecoveryMetrics.attempts[i].Load(),
+			SuccessTotal: s.openaiWSRecoveryMetrics.successes[i].Load(),
+		}
+	}
+	return snapshot
+}
+
+// applyOpenAIWSTurnRecovery 将本轮恢复轨迹写入结果；succeeded 时最后一次尝试即为生效的恢复层。
+func applyOpenAIWSTurnRecovery(result *OpenAIForwardResult, mitigations []string, succeeded bool) {
+	if result == nil || len(mitigations) == 0 {
+		return
+	}
+	result.RecoveryMitigations = append([]string(nil), mitigations...)
+	result.RecoverySucceededBy = ""
+	if succeeded {
+		result.RecoverySucceededBy = mitigations[len(mitigations)-1]
+	}
+}
+
+// RecoveryTrace renders the ordered mitigations of the turn, e.g.
+// "[preflight_reconnect, prev_id_drop→success]". Empty when no recovery ran.
+func (r *OpenAIForwardResult) RecoveryTrace() string {
+	if r == nil || len(r.RecoveryMitigations) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, mitigation := range r.RecoveryMitigations {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(mitigation)
+		if i == len(r.RecoveryMitigations)-1 && r.RecoverySucceededBy != "" {
+			b.WriteString("→success")
+		}
+	}
+	b.WriteByte(']')
+	return b.String()
+}
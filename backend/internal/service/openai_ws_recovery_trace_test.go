@@ -0,0 +1,62 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIForwardResult_RecoveryTrace(t *testing.T) {
+	var nilResult *OpenAIForwardResult
+	require.Empty(t, nilResult.RecoveryTrace())
+	require.Empty(t, (&OpenAIForwardResult{}).RecoveryTrace())
+
+	result := &OpenAIForwardResult{}
+	applyOpenAIWSTurnRecovery(result, []string{openAIWSRecoveryPreflightReconnect, openAIWSRecoveryPrevIDDrop}, true)
+	require.Equal(t, openAIWSRecoveryPrevIDDrop, result.RecoverySucceededBy)
+	require.Equal(t, "[preflight_reconnect, prev_id_drop→success]", result.RecoveryTrace())
+
+	failed := &OpenAIForwardResult{}
+	applyOpenAIWSTurnRecovery(failed, []string{openAIWSRecoveryTurnRetry}, false)
+	require.Empty(t, failed.RecoverySucceededBy)
+	require.Equal(t, "[turn_retry]", failed.RecoveryTrace())
+}
+
+func TestApplyOpenAIWSTurnRecovery_CopiesMitigations(t *testing.T) {
+	mitigations := []string{openAIWSRecoveryTurnRetry}
+	result := &OpenAIForwardResult{}
+	applyOpenAIWSTurnRecovery(result, mitigations, true)
+	mitigations[0] = "mutated"
+	require.Equal(t, []string{openAIWSRecoveryTurnRetry}, result.RecoveryMitigations)
+
+	applyOpenAIWSTurnRecovery(nil, mitigations, true)
+	untouched := &OpenAIForwardResult{}
+	applyOpenAIWSTurnRecovery(untouched, nil, true)
+	require.Nil(t, untouched.RecoveryMitigations)
+}
+
+func TestOpenAIGatewayService_RecoveryMetrics(t *testing.T) {
+	svc := &OpenAIGatewayService{}
+
+	svc.recordOpenAIWSRecoveryAttempt(openAIWSRecoveryPreflightReconnect)
+	svc.recordOpenAIWSRecoveryAttempt(openAIWSRecoveryPrevIDDrop)
+	svc.recordOpenAIWSTurnRecovery([]string{openAIWSRecoveryPreflightReconnect, openAIWSRecoveryPrevIDDrop}, true)
+
+	svc.recordOpenAIWSRecoveryAttempt(openAIWSRecoveryTurnRetry)
+	svc.recordOpenAIWSTurnRecovery([]string{openAIWSRecoveryTurnRetry}, false)
+
+	svc.recordOpenAIWSRecoveryAttempt("unknown_layer")
+	svc.recordOpenAIWSTurnRecovery(nil, true)
+
+	snapshot := svc.SnapshotOpenAIWSRecoveryMetrics()
+	require.Equal(t, int64(1), snapshot.RecoveredTurnsTotal)
+	require.Equal(t, int64(1), snapshot.UnrecoveredTurnsTotal)
+	require.Len(t, snapshot.Layers, len(openAIWSRecoveryLayers))
+	require.Equal(t, OpenAIWSRecoveryLayerMetrics{AttemptTotal: 1}, snapshot.Layers[openAIWSRecoveryPreflightReconnect])
+	require.Equal(t, OpenAIWSRecoveryLayerMetrics{AttemptTotal: 1, SuccessTotal: 1}, snapshot.Layers[openAIWSRecoveryPrevIDDrop])
+	require.Equal(t, OpenAIWSRecoveryLayerMetrics{AttemptTotal: 1}, snapshot.Layers[openAIWSRecoveryTurnRetry])
+	require.Equal(t, OpenAIWSRecoveryLayerMetrics{}, snapshot.Layers[openAIWSRecoveryPreflightPrevIDDrop])
+
+	var nilSvc *OpenAIGatewayService
+	require.Empty(t, nilSvc.SnapshotOpenAIWSRecoveryMetrics().Layers)
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	openAIWSReplayFunctionCallOutputMergeAppend  = "append"
+	openAIWSReplayFunctionCallOutputMergeReplace = "replace"
+)
+
+// openAIWSReplayInputRules 全量重放缓冲（store=false 续链降级为全量 create 时重放的累计 input）的合并规则。
+//
+// 无论规则如何，以下约束始终成立：
+//  1. 缓冲中的条目按到达顺序排列，合并只会追加或原位替换，不会重排；
+//  2. 客户端发送的全量 input（以缓冲为前缀）原样采用，规则只作用于追加到缓冲末尾的增量；
+//  3. 同一份缓冲与增量的合并结果是确定的，全量重放与原始请求的 input 一致。
+//
+// 零值即默认行为：不去重，function_call_output 按到达顺序追加。
+type openAIWSReplayInputRules struct {
+	// dedupeConsecutive 丢弃与紧邻前一项完全相同（规范化 JSON 后）的增量条目。
+	dedupeConsecutive bool
+	// replaceFunctionCallOutput 缓冲中已有同 call_id 的 function_call_output 时原位替换，而非再追加一条。
+	replaceFunctionCallOutput bool
+}
+
+func (s *OpenAIGatewayService) openAIWSReplayInputRules() openAIWSReplayInputRules {
+	if s == nil || s.cfg == nil {
+		return openAIWSReplayInputRules{}
+	}
+	wsCfg := &s.cfg.Gateway.OpenAIWS
+	return openAIWSReplayInputRules{
+		dedupeConsecutive:         wsCfg.ReplayInputDedupeConsecutive,
+		replaceFunctionCallOutput: strings.TrimSpace(wsCfg.ReplayInputFunctionCallOutputMerge) == openAIWSReplayFunctionCallOutputMergeReplace,
+	}
+}
+
+// mergeOpenAIWSReplayInputDelta 按规则将增量 items 并入缓冲 previous，返回的切片与入参共享元素（调用方负责复制），
+// 但不会修改 previous 本身。
+func mergeOpenAIWSReplayInputDelta(previous, items []json.RawMessage, rules openAIWSReplayInputRules) []json.RawMessage {
+	merged := make([]json.RawMessage, 0, len(previous)+len(items))
+	merged = append(merged, previous...)
+
+	var outputIndex map[string]int
+	if rules.replaceFunctionCallOutput {
+		outputIndex = make(map[string]int)
+		for idx, item := range merged {
+			if callID := openAIWSReplayFunctionCallOutputID(item); callID != "" {
+				outputIndex[callID] = idx
+			}
+		}
+	}
+	for _, item := range items {
+		callID := ""
+		if outputIndex != nil {
+			callID = openAIWSReplayFunctionCallOutputID(item)
+			if idx, ok := outputIndex[callID]; ok && callID != "" {
+				merged[idx] = item
+				continue
+			}
+		}
+		if rules.dedupeConsecutive && len(merged) > 0 &&
+			bytes.Equal(normalizeOpenAIWSJSONForCompareOrRaw(merged[len(merged)-1]), normalizeOpenAIWSJSONForCompareOrRaw(item)) {
+			continue
+		}
+		merged = append(merged, item)
+		if callID != "" {
+			outputIndex[callID] = len(merged) - 1
+		}
+	}
+	return merged
+}
+
+func openAIWSReplayFunctionCallOutputID(item json.RawMessage) string {
+	if gjson.GetBytes(item, "type").String() != "function_call_output" {
+		return ""
+	}
+	return strings.TrimSpace(gjson.GetBytes(item, "call_id").String())
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func openAIWSReplayInputTexts(items []json.RawMessage) []string {
+	texts := make([]string, 0, len(items))
+	for _, item := range items {
+		if output := gjson.GetBytes(item, "output"); output.Exists() {
+			texts = append(texts, gjson.GetBytes(item, "call_id").String()+"="+output.String())
+			continue
+		}
+		texts = append(texts, gjson.GetBytes(item, "text").String())
+	}
+	return texts
+}
+
+func TestBuildOpenAIWSReplayInputSequence_DedupeConsecutive(t *testing.T) {
+	previous := []json.RawMessage{
+		json.RawMessage(`{"type":"input_text","text":"hello"}`),
+		json.RawMessage(`{"type":"input_text","text":"world"}`),
+	}
+	// 重发的 world 与缓冲末尾相同；delta 内部连续的 hi 也相同（字段顺序不同但规范化后一致）。
+	payload := []byte(`{"previous_response_id":"resp_1","input":[{"text":"world","type":"input_text"},{"type":"input_text","text":"hi"},{"text":"hi","type":"input_text"},{"type":"input_text","text":"world"}]}`)
+
+	items, exists, err := buildOpenAIWSReplayInputSequence(previous, true, payload, true, 0, openAIWSReplayInputRules{})
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, []string{"hello", "world", "world", "hi", "hi", "world"}, openAIWSReplayInputTexts(items))
+
+	items, exists, err = buildOpenAIWSReplayInputSequence(previous, true, payload, true, 0, openAIWSReplayInputRules{dedupeConsecutive: true})
+	require.NoError(t, err)
+	require.True(t, exists)
+	// 只去掉紧邻重复项，非相邻的 world 保留，顺序不变。
+	require.Equal(t, []string{"hello", "world", "hi", "world"}, openAIWSReplayInputTexts(items))
+	require.Len(t, previous, 2)
+
+	// 客户端发送的全量 input（以缓冲为前缀）原样采用，不做去重。
+	fullPayload := []byte(`{"previous_response_id":"resp_1","input":[{"type":"input_text","text":"hello"},{"type":"input_text","text":"world"},{"type":"input_text","text":"world"}]}`)
+	items, _, err = buildOpenAIWSReplayInputSequence(previous, true, fullPayload, true, 0, openAIWSReplayInputRules{dedupeConsecutive: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"hello", "world", "world"}, openAIWSReplayInputTexts(items))
+
+	// 大小上限按去重后的结果计算。
+	maxBytes := len(previous[0]) + len(previous[1])
+	retry := []byte(`{"previous_response_id":"resp_1","input":[{"type":"input_text","text":"world"}]}`)
+	items, _, err = buildOpenAIWSReplayInputSequence(previous, true, retry, true, maxBytes, openAIWSReplayInputRules{dedupeConsecutive: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"hello", "world"}, openAIWSReplayInputTexts(items))
+	_, _, err = buildOpenAIWSReplayInputSequence(previous, true, retry, true, maxBytes, openAIWSReplayInputRules{})
+	require.ErrorIs(t, err, errOpenAIWSReplayInputTooLarge)
+}
+
+func TestBuildOpenAIWSReplayInputSequence_FunctionCallOutputMerge(t *testing.T) {
+	previous := []json.RawMessage{
+		json.RawMessage(`{"type":"input_text","text":"hello"}`),
+		json.RawMessage(`{"type":"function_call","call_id":"call_1","name":"lookup"}`),
+		json.RawMessage(`{"type":"function_call_output","call_id":"call_1","output":"v1"}`),
+	}
+	payload := []byte(`{"previous_response_id":"resp_1","input":[{"type":"function_call_output","call_id":"call_1","output":"v2"},{"type":"function_call_output","call_id":"call_2","output":"a"},{"type":"function_call_output","call_id":"call_2","output":"b"}]}`)
+
+	items, _, err := buildOpenAIWSReplayInputSequence(previous, true, payload, true, 0, openAIWSReplayInputRules{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"hello", "", "call_1=v1", "call_1=v2", "call_2=a", "call_2=b"}, openAIWSReplayInputTexts(items))
+
+	items, _, err = buildOpenAIWSReplayInputSequence(previous, true, payload, true, 0, openAIWSReplayInputRules{replaceFunctionCallOutput: true})
+	require.NoError(t, err)
+	// 同 call_id 的输出原位替换，仍紧随对应的 function_call；新 call_id 追加，delta 内重复的同样合并为一条。
+	require.Equal(t, []string{"hello", "", "call_1=v2", "call_2=b"}, openAIWSReplayInputTexts(items))
+	require.Equal(t, "v1", gjson.GetBytes(previous[2], "output").String())
+}
+
+func TestOpenAIWSReplayInputRules_FromConfig(t *testing.T) {
+	cfg := &config.Config{}
+	svc := &OpenAIGatewayService{cfg: cfg}
+	require.Equal(t, openAIWSReplayInputRules{}, svc.openAIWSReplayInputRules())
+
+	cfg.Gateway.OpenAIWS.ReplayInputDedupeConsecutive = true
+	cfg.Gateway.OpenAIWS.ReplayInputFunctionCallOutputMerge = "replace"
+	require.Equal(t, openAIWSReplayInputRules{dedupeConsecutive: true, replaceFunctionCallOutput: true}, svc.openAIWSReplayInputRules())
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	openAIWSRequestRewriteOpSet    = "set"
+	openAIWSRequestRewriteOpRemove = "remove"
+)
+
+// openAIWSRequestRewriteRule 预编译的请求体改写规则；set 的值在编译时序列化一次，保证每次改写结果逐字节一致。
+type openAIWSRequestRewriteRule struct {
+	op       string
+	path     string
+	segments []string
+	rawValue []byte
+}
+
+// compileOpenAIWSRequestRewrites 按账号编译 account_request_rewrites；非法规则已在配置加载时拒绝，这里仅防御性跳过。
+func compileOpenAIWSRequestRewrites(rewrites []config.GatewayOpenAIWSAccountRequestRewrite) map[int64][]openAIWSRequestRewriteRule {
+	if len(rewrites) == 0 {
+		return nil
+	}
+	compiled := make(map[int64][]openAIWSRequestRewriteRule, len(rewrites))
+	for _, rewrite := range rewrites {
+		if rewrite.AccountID <= 0 {
+			continue
+		}
+		for _, rule := range rewrite.Rules {
+			segments, ok := config.SplitOpenAIWSRequestRewritePath(rule.Path)
+			if !ok {
+				continue
+			}
+			if _, protected := config.OpenAIWSRequestRewriteProtectedFields[segments[0]]; protected {
+				continue
+			}
+			next := openAIWSRequestRewriteRule{
+				op:       strings.ToLower(strings.TrimSpace(rule.Op)),
+				path:     strings.Join(segments, "."),
+				segments: segments,
+			}
+			switch next.op {
+			case openAIWSRequestRewriteOpSet:
+				raw, err := json.Marshal(rule.Value)
+				if err != nil || rule.Value == nil {
+					continue
+				}
+				next.rawValue = raw
+			case openAIWSRequestRewriteOpRemove:
+			default:
+				continue
+			}
+			compiled[rewrite.AccountID] = append(compiled[rewrite.AccountID], next)
+		}
+	}
+	return compiled
+}
+
+// openAIWSRequestRewriteRules 返回账号的请求体改写规则；未配置时为 nil。
+func (s *OpenAIGatewayService) openAIWSRequestRewriteRules(account *Account) []openAIWSRequestRewriteRule {
+	if s == nil || s.cfg == nil || account == nil {
+		return nil
+	}
+	s.openaiWSRequestRewritesOnce.Do(func() {
+		s.openaiWSRequestRewrites = compileOpenAIWSRequestRewrites(s.cfg.Gateway.OpenAIWS.AccountRequestRewrites)
+	})
+	return s.openaiWSRequestRewrites[account.ID]
+}
+
+// applyOpenAIWSRequestRewriteRaw 对原始 JSON 请求体按顺序执行改写。
+func applyOpenAIWSRequestRewriteRaw(payload []byte, rules []openAIWSRequestRewriteRule) ([]byte, error) {
+	for _, rule := range rules {
+		var err error
+		switch rule.op {
+		case openAIWSRequestRewriteOpSet:
+			payload, err = sjson.SetRawBytes(payload, rule.path, rule.rawValue)
+		case openAIWSRequestRewriteOpRemove:
+			payload, err = sjson.DeleteBytes(payload, rule.path)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
+// applyOpenAIWSRequestRewriteMap 对 map 形式的请求体按顺序执行改写，语义与 applyOpenAIWSRequestRewriteRaw 一致。
+// 沿路径的嵌套对象写时复制，不会修改调用方共享的原始请求体。
+func applyOpenAIWSRequestRewriteMap(payload map[string]any, rules []openAIWSRequestRewriteRule) {
+	for _, rule := range rules {
+		switch rule.op {
+		case openAIWSRequestRewriteOpSet:
+			var value any
+			if err := json.Unmarshal(rule.rawValue, &value); err != nil {
+				continue
+			}
+			parent := payload
+			for _, segment := range rule.segments[:len(rule.segments)-1] {
+				child, _ := parent[segment].(map[string]any)
+				cloned := make(map[string]any, len(child)+1)
+				for k, v := range child {
+					cloned[k] = v
+				}
+				parent[segment] = cloned
+				parent = cloned
+			}
+			parent[rule.segments[len(rule.segments)-1]] = value
+		case openAIWSRequestRewriteOpRemove:
+			parent := payload
+			found := true
+			for _, segment := range rule.segments[:len(rule.segments)-1] {
+				child, ok := parent[segment].(map[string]any)
+				if !ok {
+					found = false
+					break
+				}
+				cloned := make(map[string]any, len(child))
+				for k, v := range child {
+					cloned[k] = v
+				}
+				parent[segment] = cloned
+				parent = cloned
+			}
+			if found {
+				delete(parent, rule.segments[len(rule.segments)-1])
+			}
+		}
+	}
+}
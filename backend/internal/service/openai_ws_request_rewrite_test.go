@@ -0,0 +1,75 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestOpenAIWSRequestRewrite_RawAndMapConsistent(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.AccountRequestRewrites = []config.GatewayOpenAIWSAccountRequestRewrite{
+		{
+			AccountID: 7,
+			Rules: []config.GatewayOpenAIWSRequestRewriteRule{
+				{Op: "set", Path: "service_tier", Value: "priority"},
+				{Op: "set", Path: "reasoning.effort", Value: "high"},
+				{Op: "remove", Path: "metadata.debug"},
+				{Op: "remove", Path: "missing.field"},
+			},
+		},
+	}
+	svc := &OpenAIGatewayService{cfg: cfg}
+	rules := svc.openAIWSRequestRewriteRules(&Account{ID: 7})
+	require.Len(t, rules, 4)
+	require.Nil(t, svc.openAIWSRequestRewriteRules(&Account{ID: 8}))
+
+	raw := []byte(`{"type":"response.create","model":"gpt-5.1","service_tier":"default","reasoning":{"summary":"auto"},"metadata":{"debug":"1","trace":"t"}}`)
+	rewritten, err := applyOpenAIWSRequestRewriteRaw(raw, rules)
+	require.NoError(t, err)
+	require.Equal(t, "priority", gjson.GetBytes(rewritten, "service_tier").String())
+	require.Equal(t, "high", gjson.GetBytes(rewritten, "reasoning.effort").String())
+	require.Equal(t, "auto", gjson.GetBytes(rewritten, "reasoning.summary").String())
+	require.False(t, gjson.GetBytes(rewritten, "metadata.debug").Exists())
+	require.Equal(t, "t", gjson.GetBytes(rewritten, "metadata.trace").String())
+
+	// 幂等：对已改写的请求体（如全量重放）再次执行，结果逐字节一致。
+	again, err := applyOpenAIWSRequestRewriteRaw(rewritten, rules)
+	require.NoError(t, err)
+	require.Equal(t, string(rewritten), string(again))
+
+	var reqBody map[string]any
+	require.NoError(t, json.Unmarshal(raw, &reqBody))
+	payload := make(map[string]any, len(reqBody))
+	for k, v := range reqBody {
+		payload[k] = v
+	}
+	applyOpenAIWSRequestRewriteMap(payload, rules)
+	encoded, err := json.Marshal(payload)
+	require.NoError(t, err)
+	require.JSONEq(t, string(rewritten), string(encoded))
+
+	// 嵌套对象写时复制，原始请求体不受影响（HTTP 回退等仍使用原文）。
+	require.Equal(t, map[string]any{"summary": "auto"}, reqBody["reasoning"])
+	require.Equal(t, map[string]any{"debug": "1", "trace": "t"}, reqBody["metadata"])
+}
+
+func TestOpenAIGatewayService_BuildOpenAIWSCreatePayload_AppliesAccountRewrite(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.AccountRequestRewrites = []config.GatewayOpenAIWSAccountRequestRewrite{
+		{AccountID: 9, Rules: []config.GatewayOpenAIWSRequestRewriteRule{{Op: "set", Path: "service_tier", Value: "flex"}}},
+	}
+	svc := &OpenAIGatewayService{cfg: cfg}
+	reqBody := map[string]any{"model": "gpt-5.1", "input": []any{}}
+
+	payload := svc.buildOpenAIWSCreatePayload(reqBody, &Account{ID: 9, Type: AccountTypeAPIKey})
+	require.Equal(t, "flex", payload["service_tier"])
+	require.Equal(t, "response.create", payload["type"])
+
+	other := svc.buildOpenAIWSCreatePayload(reqBody, &Account{ID: 10, Type: AccountTypeAPIKey})
+	require.NotContains(t, other, "service_tier")
+	require.NotContains(t, reqBody, "service_tier")
+}
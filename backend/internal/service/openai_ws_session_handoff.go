@@ -0,0 +1,349 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// openAIWSSessionHandoffVersion 交接文件格式版本；版本不一致的文件直接丢弃，不做兼容迁移。
+const openAIWSSessionHandoffVersion = 1
+
+// OpenAIWSSessionHandoff 热升级时旧实例交给新实例的 ingress 会话状态。
+//
+// 只迁移"客户端重连后续链所需的状态"：会话粘连账号、最近一次完成的 response_id、turn 序号、
+// turn_state 以及会话锚点与 response_id -> account_id 的进程内绑定。以下内容无法迁移：
+//   - 客户端与网关之间的 WS 连接本身（不做 socket 传递），停机时连接断开，客户端需要重连；
+//   - 进行中的 turn 与上游 WS 连接：停机时正在生成的响应会中断，客户端应以最近一次完成的
+//     response_id 作为 previous_response_id 重新发送当前 turn；
+//   - response_id -> conn_id 的连接内上下文复用，新实例会重新建立上游连接。
+type OpenAIWSSessionHandoff struct {
+	Version          int                              `json:"version"`
+	GeneratedAt      time.Time                        `json:"generated_at"`
+	Sessions         []OpenAIWSHandoffSession         `json:"sessions"`
+	TurnStates       []OpenAIWSHandoffTurnState       `json:"turn_states,omitempty"`
+	SessionAnchors   []OpenAIWSHandoffSessionAnchors  `json:"session_anchors,omitempty"`
+	ResponseAccounts []OpenAIWSHandoffResponseAccount `json:"response_accounts,omitempty"`
+}
+
+// OpenAIWSHandoffSession 停机时仍在线、且至少完成过一个 turn 的 ingress 会话。
+type OpenAIWSHandoffSession struct {
+	GroupID        int64  `json:"group_id"`
+	SessionHash    string `json:"session_hash"`
+	AccountID      int64  `json:"account_id"`
+	LastResponseID string `json:"last_response_id,omitempty"`
+	// Turn 会话内已完成的 turn 数（含此前实例交接过来的 turn）。
+	Turn int `json:"turn"`
+}
+
+// OpenAIWSHandoffTurnState 会话的 x-codex-turn-state 绑定；SessionKey 为状态存储内部的 "<group_id>:<session_hash>"。
+type OpenAIWSHandoffTurnState struct {
+	SessionKey string    `json:"session_key"`
+	TurnState  string    `json:"turn_state"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// OpenAIWSHandoffSessionAnchors 会话内最近的 response_id 锚点（下标 0 最新），CreatedAt 原样保留以延续最长存活时间。
+type OpenAIWSHandoffSessionAnchors struct {
+	SessionKey string                          `json:"session_key"`
+	Anchors    []OpenAIWSHandoffResponseAnchor `json:"anchors"`
+	CreatedAt  time.Time                       `json:"created_at"`
+	ExpiresAt  time.Time                       `json:"expires_at"`
+}
+
+type OpenAIWSHandoffResponseAnchor struct {
+	ResponseID string    `json:"response_id"`
+	AccountID  int64     `json:"account_id"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// OpenAIWSHandoffResponseAccount 进程内 response_id -> account_id 绑定；Redis 中的同名绑定不受交接影响。
+type OpenAIWSHandoffResponseAccount struct {
+	ResponseID string    `json:"response_id"`
+	AccountID  int64     `json:"account_id"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// openAIWSHandoffSessionTracker 单条 ingress 连接的会话进度，每个 turn 完成后更新。
+type openAIWSHandoffSessionTracker struct {
+	key openAIStickyAccountSessionKey
+	// resumedTurns 连接建立时从交接状态继承的已完成 turn 数。
+	resumedTurns int
+
+	mu      sync.Mutex
+	session OpenAIWSHandoffSession
+}
+
+func (t *openAIWSHandoffSessionTracker) completeTurn(accountID int64, responseID string, turn int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.session.AccountID = accountID
+	if responseID = strings.TrimSpace(responseID); responseID != "" {
+		t.session.LastResponseID = responseID
+	}
+	t.session.Turn = t.resumedTurns + turn
+}
+
+func (t *openAIWSHandoffSessionTracker) snapshot() OpenAIWSHandoffSession {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.session
+}
+
+// openAIWSHandoffResumedSession 新实例回灌的会话进度，等待同一会话的首个 ingress 连接认领。
+type openAIWSHandoffResumedSession struct {
+	turn      int
+	expiresAt time.Time
+}
+
+// registerOpenAIWSHandoffSession 登记一条 ingress 会话，并认领交接过来的 turn 序号；sessionHash 为空时返回 nil。
+func (s *OpenAIGatewayService) registerOpenAIWSHandoffSession(groupID int64, sessionHash string) *openAIWSHandoffSessionTracker {
+	sessionHash = strings.TrimSpace(sessionHash)
+	if s == nil || sessionHash == "" {
+		return nil
+	}
+	key := openAIStickyAccountSessionKey{groupID: groupID, sessionHash: sessionHash}
+	tracker := &openAIWSHandoffSessionTracker{
+		key:     key,
+		session: OpenAIWSHandoffSession{GroupID: groupID, SessionHash: sessionHash},
+	}
+	if value, ok := s.openaiWSHandoffResumed.LoadAndDelete(key); ok {
+		if resumed, ok := value.(openAIWSHandoffResumedSession); ok && time.Now().Before(resumed.expiresAt) {
+			tracker.resumedTurns = resumed.turn
+			tracker.session.Turn = resumed.turn
+			logOpenAIWSModeInfo("ingress_ws_session_handoff_resumed group_id=%d turn=%d", groupID, resumed.turn)
+		}
+	}
+	s.openaiWSHandoffSessions.Store(key, tracker)
+	return tracker
+}
+
+// unregisterOpenAIWSHandoffSession 会话结束时移除登记；同一会话已被更新的连接接管时不受影响。
+func (s *OpenAIGatewayService) unregisterOpenAIWSHandoffSession(tracker *openAIWSHandoffSessionTracker) {
+	if s == nil || tracker == nil {
+		return
+	}
+	s.openaiWSHandoffSessions.CompareAndDelete(tracker.key, tracker)
+}
+
+// ExportOpenAIWSSessionHandoff 汇总当前进程内可交接的会话状态，只包含未过期的绑定。
+func (s *OpenAIGatewayService) ExportOpenAIWSSessionHandoff() OpenAIWSSessionHandoff {
+	handoff := OpenAIWSSessionHandoff{
+		Version:     openAIWSSessionHandoffVersion,
+		GeneratedAt: time.Now(),
+		Sessions:    []OpenAIWSHandoffSession{},
+	}
+	if s == nil {
+		return handoff
+	}
+	s.openaiWSHandoffSessions.Range(func(_, value any) bool {
+		tracker, ok := value.(*openAIWSHandoffSessionTracker)
+		if !ok {
+			return true
+		}
+		if session := tracker.snapshot(); session.Turn > 0 && session.AccountID > 0 {
+			handoff.Sessions = append(handoff.Sessions, session)
+		}
+		return true
+	})
+	if store, ok := s.getOpenAIWSStateStore().(*defaultOpenAIWSStateStore); ok {
+		store.exportHandoff(&handoff, handoff.GeneratedAt)
+	}
+	return handoff
+}
+
+// ImportOpenAIWSSessionHandoff 将交接状态回灌到当前进程：重建会话粘连与进程内绑定，
+// 并记录各会话的 turn 序号，供同一会话重连后的首个 ingress 连接继续计数。返回回灌的会话数。
+func (s *OpenAIGatewayService) ImportOpenAIWSSessionHandoff(ctx context.Context, handoff OpenAIWSSessionHandoff) int {
+	if s == nil {
+		return 0
+	}
+	now := time.Now()
+	if store, ok := s.getOpenAIWSStateStore().(*defaultOpenAIWSStateStore); ok {
+		store.importHandoff(handoff, now)
+	}
+	ttl := s.openAIWSSessionStickyTTL()
+	restored := 0
+	for _, session := range handoff.Sessions {
+		hash := strings.TrimSpace(session.SessionHash)
+		if hash == "" || session.AccountID <= 0 {
+			continue
+		}
+		groupID := session.GroupID
+		if err := s.BindStickySession(ctx, &groupID, hash, session.AccountID); err != nil {
+			logOpenAIWSModeInfo("session_handoff_bind_sticky_failed group_id=%d account_id=%d err=%v", groupID, session.AccountID, err)
+		}
+		key := openAIStickyAccountSessionKey{groupID: groupID, sessionHash: hash}
+		s.openaiWSHandoffResumed.Store(key, openAIWSHandoffResumedSession{turn: session.Turn, expiresAt: now.Add(ttl)})
+		restored++
+	}
+	return restored
+}
+
+// OpenAIWSSessionHandoffPath 返回配置的会话交接文件路径；为空表示未开启。
+func (s *OpenAIGatewayService) OpenAIWSSessionHandoffPath() string {
+	if s == nil || s.cfg == nil {
+		return ""
+	}
+	return strings.TrimSpace(s.cfg.Gateway.OpenAIWS.SessionHandoffPath)
+}
+
+// WriteOpenAIWSSessionHandoff 将会话交接状态写入 path（先写临时文件再改名，避免新实例读到半截文件），返回写入的会话数。
+func (s *OpenAIGatewayService) WriteOpenAIWSSessionHandoff(path string) (int, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return 0, errors.New("session handoff path is empty")
+	}
+	handoff := s.ExportOpenAIWSSessionHandoff()
+	data, err := json.Marshal(handoff)
+	if err != nil {
+		return 0, fmt.Errorf("marshal session handoff: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, fmt.Errorf("create session handoff dir: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return 0, fmt.Errorf("write session handoff: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return 0, fmt.Errorf("rename session handoff: %w", err)
+	}
+	return len(handoff.Sessions), nil
+}
+
+// RestoreOpenAIWSSessionHandoff 读取并回灌 path 处的交接文件，读取后即删除，避免之后的重启重复回灌。
+// 文件不存在时为空操作；版本不符或超过 session_handoff_max_age_seconds 的文件丢弃不回灌。返回回灌的会话数。
+func (s *OpenAIGatewayService) RestoreOpenAIWSSessionHandoff(ctx context.Context, path string) (int, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return 0, errors.New("session handoff path is empty")
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read session handoff: %w", err)
+	}
+	if err := os.Remove(path); err != nil {
+		return 0, fmt.Errorf("remove session handoff: %w", err)
+	}
+	var handoff OpenAIWSSessionHandoff
+	if err := json.Unmarshal(data, &handoff); err != nil {
+		return 0, fmt.Errorf("unmarshal session handoff: %w", err)
+	}
+	if handoff.Version != openAIWSSessionHandoffVersion {
+		return 0, fmt.Errorf("session handoff version %d is not supported", handoff.Version)
+	}
+	if maxAge := s.openAIWSSessionHandoffMaxAge(); time.Since(handoff.GeneratedAt) > maxAge {
+		return 0, fmt.Errorf("session handoff generated at %s is older than %s", handoff.GeneratedAt.Format(time.RFC3339), maxAge)
+	}
+	return s.ImportOpenAIWSSessionHandoff(ctx, handoff), nil
+}
+
+func (s *OpenAIGatewayService) openAIWSSessionHandoffMaxAge() time.Duration {
+	if s != nil && s.cfg != nil && s.cfg.Gateway.OpenAIWS.SessionHandoffMaxAgeSeconds > 0 {
+		return time.Duration(s.cfg.Gateway.OpenAIWS.SessionHandoffMaxAgeSeconds) * time.Second
+	}
+	return 2 * time.Minute
+}
+
+// exportHandoff 导出未过期的 turn_state、会话锚点与 response_id -> account_id 绑定；response_id -> conn_id 不导出。
+func (s *defaultOpenAIWSStateStore) exportHandoff(handoff *OpenAIWSSessionHandoff, now time.Time) {
+	s.sessionToTurnStateMu.RLock()
+	for key, binding := range s.sessionToTurnState {
+		if !now.Before(binding.expiresAt) {
+			continue
+		}
+		handoff.TurnStates = append(handoff.TurnStates, OpenAIWSHandoffTurnState{SessionKey: key, TurnState: binding.turnState, ExpiresAt: binding.expiresAt})
+	}
+	s.sessionToTurnStateMu.RUnlock()
+
+	s.sessionToAnchorsMu.Lock()
+	for key, binding := range s.sessionToAnchors {
+		if !now.Before(binding.expiresAt) || s.sessionAnchorsExceedMaxAge(binding, now) {
+			continue
+		}
+		anchors := make([]OpenAIWSHandoffResponseAnchor, 0, len(binding.anchors))
+		for _, anchor := range binding.anchors {
+			if now.Before(anchor.expiresAt) {
+				anchors = append(anchors, OpenAIWSHandoffResponseAnchor{ResponseID: anchor.responseID, AccountID: anchor.accountID, ExpiresAt: anchor.expiresAt})
+			}
+		}
+		if len(anchors) > 0 {
+			handoff.SessionAnchors = append(handoff.SessionAnchors, OpenAIWSHandoffSessionAnchors{
+				SessionKey: key,
+				Anchors:    anchors,
+				CreatedAt:  binding.createdAt,
+				ExpiresAt:  binding.expiresAt,
+			})
+		}
+	}
+	s.sessionToAnchorsMu.Unlock()
+
+	s.responseToAccountMu.RLock()
+	for id, binding := range s.responseToAccount {
+		if binding.accountID <= 0 || !now.Before(binding.expiresAt) {
+			continue
+		}
+		handoff.ResponseAccounts = append(handoff.ResponseAccounts, OpenAIWSHandoffResponseAccount{ResponseID: id, AccountID: binding.accountID, ExpiresAt: binding.expiresAt})
+	}
+	s.responseToAccountMu.RUnlock()
+}
+
+// importHandoff 按原过期时间回灌交接状态，已过期的条目跳过；只写进程内绑定，不回写 Redis。
+func (s *defaultOpenAIWSStateStore) importHandoff(handoff OpenAIWSSessionHandoff, now time.Time) {
+	s.sessionToTurnStateMu.Lock()
+	for _, item := range handoff.TurnStates {
+		state := strings.TrimSpace(item.TurnState)
+		if item.SessionKey == "" || state == "" || !now.Before(item.ExpiresAt) {
+			continue
+		}
+		ensureBindingCapacity(s.sessionToTurnState, item.SessionKey, openAIWSStateStoreMaxEntriesPerMap)
+		s.sessionToTurnState[item.SessionKey] = openAIWSTurnStateBinding{turnState: state, expiresAt: item.ExpiresAt}
+	}
+	s.sessionToTurnStateMu.Unlock()
+
+	s.sessionToAnchorsMu.Lock()
+	for _, item := range handoff.SessionAnchors {
+		if item.SessionKey == "" || !now.Before(item.ExpiresAt) {
+			continue
+		}
+		binding := openAIWSSessionAnchorsBinding{expiresAt: item.ExpiresAt, createdAt: item.CreatedAt}
+		for _, anchor := range item.Anchors {
+			id := normalizeOpenAIWSResponseID(anchor.ResponseID)
+			if id == "" || anchor.AccountID <= 0 || !now.Before(anchor.ExpiresAt) || len(binding.anchors) >= openAIWSSessionResponseAnchorsMax {
+				continue
+			}
+			binding.anchors = append(binding.anchors, openAIWSSessionResponseAnchor{responseID: id, accountID: anchor.AccountID, expiresAt: anchor.ExpiresAt})
+		}
+		if len(binding.anchors) == 0 || s.sessionAnchorsExceedMaxAge(binding, now) {
+			continue
+		}
+		ensureBindingCapacity(s.sessionToAnchors, item.SessionKey, openAIWSStateStoreMaxEntriesPerMap)
+		s.sessionToAnchors[item.SessionKey] = binding
+	}
+	s.sessionToAnchorsMu.Unlock()
+
+	s.responseToAccountMu.Lock()
+	for _, item := range handoff.ResponseAccounts {
+		id := normalizeOpenAIWSResponseID(item.ResponseID)
+		if id == "" || item.AccountID <= 0 || !now.Before(item.ExpiresAt) {
+			continue
+		}
+		ensureBindingCapacity(s.responseToAccount, id, openAIWSStateStoreMaxEntriesPerMap)
+		s.responseToAccount[id] = openAIWSAccountBinding{accountID: item.AccountID, expiresAt: item.ExpiresAt}
+	}
+	s.responseToAccountMu.Unlock()
+}
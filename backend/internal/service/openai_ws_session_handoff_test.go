@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func newOpenAIWSSessionHandoffTestService(accounts []Account) (*OpenAIGatewayService, *stubGatewayCache) {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.Enabled = true
+	cfg.Gateway.OpenAIWS.APIKeyEnabled = true
+	cfg.Gateway.OpenAIWS.ResponsesWebsocketsV2 = true
+	cfg.Gateway.OpenAIWS.SessionHandoffMaxAgeSeconds = 60
+	cache := &stubGatewayCache{}
+	return &OpenAIGatewayService{
+		accountRepo:        stubOpenAIAccountRepo{accounts: accounts},
+		cache:              cache,
+		cfg:                cfg,
+		concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+	}, cache
+}
+
+func TestOpenAIWSSessionHandoff_MigratesSessionStateToNewInstance(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(90)
+	wsExtra := map[string]any{"openai_apikey_responses_websockets_v2_enabled": true}
+	accounts := []Account{
+		{ID: 9001, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 5, Extra: wsExtra},
+		{ID: 9002, Platform: PlatformOpenAI, Type: AccountTypeAPIKey, Status: StatusActive, Schedulable: true, Concurrency: 5, Extra: wsExtra},
+	}
+	path := filepath.Join(t.TempDir(), "handoff.json")
+
+	// 旧实例：会话在账号 9002 上完成了两个 turn，另有一条已结束的会话不应被交接。
+	oldSvc, _ := newOpenAIWSSessionHandoffTestService(accounts)
+	oldStore := oldSvc.getOpenAIWSStateStore()
+	session := oldSvc.registerOpenAIWSHandoffSession(groupID, "session_live")
+	for turn, responseID := range []string{"resp_1", "resp_2"} {
+		require.NoError(t, oldStore.BindResponseAccount(ctx, groupID, responseID, 9002, time.Hour))
+		oldStore.BindResponseConn(responseID, "conn_old", time.Hour)
+		oldStore.BindSessionResponseAnchor(groupID, "session_live", responseID, 9002, time.Hour)
+		session.completeTurn(9002, responseID, turn+1)
+	}
+	oldStore.BindSessionTurnState(groupID, "session_live", "ts_live", time.Hour)
+	closed := oldSvc.registerOpenAIWSHandoffSession(groupID, "session_closed")
+	closed.completeTurn(9001, "resp_closed", 1)
+	oldSvc.unregisterOpenAIWSHandoffSession(closed)
+
+	written, err := oldSvc.WriteOpenAIWSSessionHandoff(path)
+	require.NoError(t, err)
+	require.Equal(t, 1, written)
+
+	// 新实例使用独立的缓存，只能依赖交接文件恢复状态。
+	newSvc, newCache := newOpenAIWSSessionHandoffTestService(accounts)
+	restored, err := newSvc.RestoreOpenAIWSSessionHandoff(ctx, path)
+	require.NoError(t, err)
+	require.Equal(t, 1, restored)
+	_, statErr := os.Stat(path)
+	require.True(t, os.IsNotExist(statErr), "交接文件回灌后应删除，避免重复回灌")
+
+	newStore := newSvc.getOpenAIWSStateStore()
+	require.Equal(t, int64(9002), newCache.sessionBindings["openai:session_live"])
+	turnState, ok := newStore.GetSessionTurnState(groupID, "session_live")
+	require.True(t, ok)
+	require.Equal(t, "ts_live", turnState)
+	anchorAccountID, ok := newStore.GetSessionResponseAnchor(groupID, "session_live", "resp_1")
+	require.True(t, ok)
+	require.Equal(t, int64(9002), anchorAccountID)
+	responseAccountID, err := newStore.GetResponseAccount(ctx, groupID, "resp_2")
+	require.NoError(t, err)
+	require.Equal(t, int64(9002), responseAccountID)
+	// 连接内上下文无法迁移。
+	_, ok = newStore.GetResponseConn("resp_2")
+	require.False(t, ok)
+
+	// 客户端重连后按最近的 response_id 续链，命中原账号。
+	selection, decision, err := newSvc.SelectAccountWithScheduler(ctx, &groupID, "resp_2", "session_live", "gpt-5.1", nil, OpenAIUpstreamTransportAny)
+	require.NoError(t, err)
+	require.NotNil(t, selection)
+	require.Equal(t, int64(9002), selection.Account.ID)
+	require.Equal(t, openAIAccountScheduleLayerPreviousResponse, decision.Layer)
+
+	// 重连后的首个连接继承 turn 序号，只能认领一次。
+	resumed := newSvc.registerOpenAIWSHandoffSession(groupID, "session_live")
+	resumed.completeTurn(9002, "resp_3", 1)
+	require.Equal(t, 3, resumed.snapshot().Turn)
+	require.Equal(t, "resp_3", resumed.snapshot().LastResponseID)
+	require.Equal(t, 0, newSvc.registerOpenAIWSHandoffSession(groupID, "session_live").resumedTurns)
+}
+
+func TestOpenAIWSSessionHandoff_RejectsStaleFile(t *testing.T) {
+	svc, cache := newOpenAIWSSessionHandoffTestService(nil)
+	path := filepath.Join(t.TempDir(), "handoff.json")
+	handoff := OpenAIWSSessionHandoff{
+		Version:     openAIWSSessionHandoffVersion,
+		GeneratedAt: time.Now().Add(-2 * time.Minute),
+		Sessions:    []OpenAIWSHandoffSession{{GroupID: 1, SessionHash: "session_stale", AccountID: 7, Turn: 4}},
+	}
+	data, err := json.Marshal(handoff)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	restored, err := svc.RestoreOpenAIWSSessionHandoff(context.Background(), path)
+	require.Error(t, err)
+	require.Zero(t, restored)
+	require.Empty(t, cache.sessionBindings)
+	_, statErr := os.Stat(path)
+	require.True(t, os.IsNotExist(statErr))
+
+	// 文件不存在时为空操作。
+	restored, err = svc.RestoreOpenAIWSSessionHandoff(context.Background(), path)
+	require.NoError(t, err)
+	require.Zero(t, restored)
+}
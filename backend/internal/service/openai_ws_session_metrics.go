@@ -0,0 +1,146 @@
+package service
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// ingress 会话时长（秒）与每会话 turn 数的直方图桶上界；超过最后一个上界的样本计入 +Inf 桶。
+var (
+	openAIWSIngressSessionDurationBucketsSeconds = []int64{1, 10, 60, 300, 900, 1800, 3600, 7200}
+	openAIWSIngressSessionTurnsBuckets           = []int64{1, 2, 5, 10, 20, 50, 100, 200}
+)
+
+// OpenAIWSHistogramBucket 直方图单个桶；Count 为落在 (上一桶上界, Le] 区间内的样本数（非累计）。
+type OpenAIWSHistogramBucket struct {
+	Le    string `json:"le"`
+	Count int64  `json:"count"`
+}
+
+// OpenAIWSHistogramSnapshot 直方图快照。
+type OpenAIWSHistogramSnapshot struct {
+	Count   int64                     `json:"count"`
+	Sum     int64                     `json:"sum"`
+	Buckets []OpenAIWSHistogramBucket `json:"buckets"`
+}
+
+// OpenAIWSIngressSessionMetricsSnapshot ingress 会话级指标快照（ctx_pool/shared/dedicated 路径，不含 passthrough）。
+type OpenAIWSIngressSessionMetricsSnapshot struct {
+	ClosedTotal         int64                     `json:"closed_total"`
+	AbnormalClosedTotal int64                     `json:"abnormal_closed_total"`
+	DurationSeconds     OpenAIWSHistogramSnapshot `json:"duration_seconds"`
+	Turns               OpenAIWSHistogramSnapshot `json:"turns"`
+	// RateLimitedTotal 因新建会话超过 ingress_session_create_per_minute 被拒绝的次数。
+	RateLimitedTotal int64 `json:"rate_limited_total"`
+	// CreateRates 各 API Key 的新建会话速率，按速率降序。
+	CreateRates []OpenAIWSIngressSessionCreateRate `json:"create_rates"`
+}
+
+// openAIWSHistogram 固定桶直方图，桶上界在创建后不可变，observe 无锁。
+type openAIWSHistogram struct {
+	bounds []int64
+	counts []atomic.Int64 // len(bounds)+1，最后一个为 +Inf 桶
+	count  atomic.Int64
+	sum    atomic.Int64
+}
+
+func newOpenAIWSHistogram(bounds []int64) *openAIWSHistogram {
+	return &openAIWSHistogram{
+		bounds: bounds,
+		counts: make([]atomic.Int64, len(bounds)+1),
+	}
+}
+
+func (h *openAIWSHistogram) observe(value int64) {
+	if h == nil {
+		return
+	}
+	if value < 0 {
+		value = 0
+	}
+	idx := len(h.bounds)
+	for i, bound := range h.bounds {
+		if value <= bound {
+			idx = i
+			break
+		}
+	}
+	h.counts[idx].Add(1)
+	h.count.Add(1)
+	h.sum.Add(value)
+}
+
+func (h *openAIWSHistogram) snapshot() OpenAIWSHistogramSnapshot {
+	if h == nil {
+		return OpenAIWSHistogramSnapshot{}
+	}
+	buckets := make([]OpenAIWSHistogramBucket, 0, len(h.counts))
+	for i := range h.counts {
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = strconv.FormatInt(h.bounds[i], 10)
+		}
+		buckets = append(buckets, OpenAIWSHistogramBucket{Le: le, Count: h.counts[i].Load()})
+	}
+	return OpenAIWSHistogramSnapshot{
+		Count:   h.count.Load(),
+		Sum:     h.sum.Load(),
+		Buckets: buckets,
+	}
+}
+
+type openAIWSIngressSessionMetrics struct {
+	closed   atomic.Int64
+	abnormal atomic.Int64
+	duration *openAIWSHistogram
+	turns    *openAIWSHistogram
+}
+
+func newOpenAIWSIngressSessionMetrics() *openAIWSIngressSessionMetrics {
+	return &openAIWSIngressSessionMetrics{
+		duration: newOpenAIWSHistogram(openAIWSIngressSessionDurationBucketsSeconds),
+		turns:    newOpenAIWSHistogram(openAIWSIngressSessionTurnsBuckets),
+	}
+}
+
+func (s *OpenAIGatewayService) getOpenAIWSIngressSessionMetrics() *openAIWSIngressSessionMetrics {
+	if s == nil {
+		return nil
+	}
+	s.openaiWSSessionMetricsOnce.Do(func() {
+		s.openaiWSSessionMetrics = newOpenAIWSIngressSessionMetrics()
+	})
+	return s.openaiWSSessionMetrics
+}
+
+// recordOpenAIWSIngressSessionClosed 在 ingress 会话结束时记录一次会话时长与 turn 数；
+// 非 nil 错误（上游失败、策略关闭等）计为异常关闭，但同样计入直方图。
+func (s *OpenAIGatewayService) recordOpenAIWSIngressSessionClosed(duration time.Duration, turns int, sessionErr error) {
+	metrics := s.getOpenAIWSIngressSessionMetrics()
+	if metrics == nil {
+		return
+	}
+	metrics.closed.Add(1)
+	if sessionErr != nil {
+		metrics.abnormal.Add(1)
+	}
+	metrics.duration.observe(int64(duration / time.Second))
+	metrics.turns.observe(int64(turns))
+}
+
+// SnapshotOpenAIWSIngressSessionMetrics 返回 ingress 会话时长与每会话 turn 数分布，以及各 API Key 的新建会话速率。
+func (s *OpenAIGatewayService) SnapshotOpenAIWSIngressSessionMetrics() OpenAIWSIngressSessionMetricsSnapshot {
+	metrics := s.getOpenAIWSIngressSessionMetrics()
+	if metrics == nil {
+		return OpenAIWSIngressSessionMetricsSnapshot{}
+	}
+	return OpenAIWSIngressSessionMetricsSnapshot{
+		ClosedTotal:         metrics.closed.Load(),
+		AbnormalClosedTotal: metrics.abnormal.Load(),
+		DurationSeconds:     metrics.duration.snapshot(),
+		Turns:               metrics.turns.snapshot(),
+		RateLimitedTotal:    s.openaiWSSessionCreates.rejectedTotal.Load(),
+		CreateRates:         s.openaiWSSessionCreates.snapshot(),
+	}
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIGatewayService_RecordOpenAIWSIngressSessionClosed(t *testing.T) {
+	svc := &OpenAIGatewayService{}
+
+	svc.recordOpenAIWSIngressSessionClosed(500*time.Millisecond, 1, nil)
+	svc.recordOpenAIWSIngressSessionClosed(45*time.Second, 4, nil)
+	svc.recordOpenAIWSIngressSessionClosed(3*time.Hour, 500, errors.New("upstream failed"))
+
+	snapshot := svc.SnapshotOpenAIWSIngressSessionMetrics()
+	require.Equal(t, int64(3), snapshot.ClosedTotal)
+	require.Equal(t, int64(1), snapshot.AbnormalClosedTotal)
+
+	require.Equal(t, int64(3), snapshot.DurationSeconds.Count)
+	require.Equal(t, int64(0+45+3*3600), snapshot.DurationSeconds.Sum)
+	durationCounts := make(map[string]int64, len(snapshot.DurationSeconds.Buckets))
+	for _, bucket := range snapshot.DurationSeconds.Buckets {
+		durationCounts[bucket.Le] = bucket.Count
+	}
+	require.Equal(t, int64(1), durationCounts["1"])
+	require.Equal(t, int64(1), durationCounts["60"])
+	require.Equal(t, int64(1), durationCounts["+Inf"], "超过最大上界的会话计入 +Inf 桶")
+
+	require.Len(t, snapshot.Turns.Buckets, len(openAIWSIngressSessionTurnsBuckets)+1)
+	require.Equal(t, int64(505), snapshot.Turns.Sum)
+	turnCounts := make(map[string]int64, len(snapshot.Turns.Buckets))
+	for _, bucket := range snapshot.Turns.Buckets {
+		turnCounts[bucket.Le] = bucket.Count
+	}
+	require.Equal(t, int64(1), turnCounts["1"])
+	require.Equal(t, int64(1), turnCounts["5"])
+	require.Equal(t, int64(1), turnCounts["+Inf"])
+
+	require.Equal(t, snapshot, svc.SnapshotOpenAIWSPerformanceMetrics().Sessions)
+}
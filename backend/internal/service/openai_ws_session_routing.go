@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"strings"
+)
+
+const (
+	// OpenAISessionConnModeHTTP 会话走 HTTP/SSE 上游，不使用 WS 连接。
+	OpenAISessionConnModeHTTP = "http"
+	// OpenAISessionConnModePool 会话走 responses_websockets（v1）上游，复用共享连接池。
+	OpenAISessionConnModePool = "pool"
+	// OpenAISessionConnModeCtxPool 会话走 ws_v2 上游，按会话上下文复用连接池。
+	OpenAISessionConnModeCtxPool = OpenAIWSIngressModeCtxPool
+	// OpenAISessionConnModeDedicated 会话走 ws_v2 上游，每轮独占新建连接。
+	OpenAISessionConnModeDedicated = OpenAIWSIngressModeDedicated
+	// OpenAISessionConnModePassthrough 会话走 ws_v2 上游，客户端帧直通，不经过本地中继。
+	OpenAISessionConnModePassthrough = OpenAIWSIngressModePassthrough
+)
+
+// OpenAISessionRoutingDescription 描述某个会话当前的路由决策（只读诊断），
+// 汇总粘性账号、协议决策与 ModeRouterV2 的入站模式解析结果。
+type OpenAISessionRoutingDescription struct {
+	GroupID     int64  `json:"group_id"`
+	SessionHash string `json:"session_hash"`
+	// Bound 表示会话存在粘性账号绑定且账号仍可加载。
+	Bound     bool  `json:"bound"`
+	AccountID int64 `json:"account_id,omitempty"`
+	// ModeRouterV2Enabled 为 false 时入站模式固定为 ctx_pool（force_dedicated_all 时为 dedicated）。
+	ModeRouterV2Enabled bool   `json:"mode_router_v2_enabled"`
+	IngressMode         string `json:"ingress_mode,omitempty"`
+	Transport           string `json:"transport,omitempty"`
+	TransportReason     string `json:"transport_reason,omitempty"`
+	// ConnMode 为最终连接形态：http/pool/ctx_pool/dedicated/passthrough。
+	ConnMode      string `json:"conn_mode,omitempty"`
+	SessionConnID string `json:"session_conn_id,omitempty"`
+	HasTurnState  bool   `json:"has_turn_state"`
+}
+
+// openAIWSIngressModeDefault 返回分组在 WS 入站时的默认模式：优先取 ingress_mode_group_defaults 中该分组的配置，
+// 未配置时回退到全局 ingress_mode_default。
+func (s *OpenAIGatewayService) openAIWSIngressModeDefault(groupID int64) string {
+	if s == nil || s.cfg == nil {
+		return ""
+	}
+	if groupID > 0 {
+		for _, groupDefault := range s.cfg.Gateway.OpenAIWS.IngressModeGroupDefaults {
+			if groupDefault.GroupID == groupID {
+				return groupDefault.Mode
+			}
+		}
+	}
+	return s.cfg.Gateway.OpenAIWS.IngressModeDefault
+}
+
+// resolveOpenAIWSIngressMode 解析账号在 WS 入站时的生效模式，与 ProxyResponsesWebSocketFromClient 的判定保持一致：
+// 未开启 ModeRouterV2 时固定为 ctx_pool；账号未配置 mode 时按分组默认模式；账号模式为 off 时保持 off；
+// force_dedicated_all 覆盖为 dedicated。
+func (s *OpenAIGatewayService) resolveOpenAIWSIngressMode(groupID int64, account *Account) string {
+	ingressMode := OpenAIWSIngressModeCtxPool
+	if s != nil && s.cfg != nil && s.cfg.Gateway.OpenAIWS.ModeRouterV2Enabled {
+		ingressMode = account.ResolveOpenAIResponsesWebSocketV2Mode(s.openAIWSIngressModeDefault(groupID))
+		if ingressMode == OpenAIWSIngressModeOff {
+			return ingressMode
+		}
+	}
+	if s.openAIWSForceDedicatedAll() {
+		ingressMode = OpenAIWSIngressModeDedicated
+	}
+	return ingressMode
+}
+
+// DescribeSessionRouting 返回会话的路由诊断信息：绑定账号、入站模式、上游协议及连接形态。
+// 仅读取粘性绑定与本地状态，不续期 TTL，也不会触发调度。
+func (s *OpenAIGatewayService) DescribeSessionRouting(ctx context.Context, groupID int64, sessionHash string) (*OpenAISessionRoutingDescription, error) {
+	sessionHash = strings.TrimSpace(sessionHash)
+	desc := &OpenAISessionRoutingDescription{
+		GroupID:             groupID,
+		SessionHash:         sessionHash,
+		ModeRouterV2Enabled: s != nil && s.cfg != nil && s.cfg.Gateway.OpenAIWS.ModeRouterV2Enabled,
+	}
+	if s == nil || sessionHash == "" {
+		return desc, nil
+	}
+	if stateStore := s.getOpenAIWSStateStore(); stateStore != nil {
+		if connID, ok := stateStore.GetSessionConn(groupID, sessionHash); ok {
+			desc.SessionConnID = connID
+		}
+		_, desc.HasTurnState = stateStore.GetSessionTurnState(groupID, sessionHash)
+	}
+
+	accountID, err := s.getStickySessionAccountID(ctx, &groupID, sessionHash)
+	if err != nil || accountID <= 0 {
+		return desc, nil
+	}
+	account, err := s.getSchedulableAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return desc, nil
+	}
+	desc.Bound = true
+	desc.AccountID = account.ID
+
+	decision := s.getOpenAIWSProtocolResolver().Resolve(account)
+	desc.Transport = string(decision.Transport)
+	desc.TransportReason = decision.Reason
+	desc.IngressMode = s.resolveOpenAIWSIngressMode(groupID, account)
+	desc.ConnMode = resolveOpenAISessionConnMode(decision.Transport, desc.IngressMode)
+	return desc, nil
+}
+
+func resolveOpenAISessionConnMode(transport OpenAIUpstreamTransport, ingressMode string) string {
+	switch transport {
+	case OpenAIUpstreamTransportResponsesWebsocketV2:
+	case OpenAIUpstreamTransportResponsesWebsocket:
+		return OpenAISessionConnModePool
+	default:
+		return OpenAISessionConnModeHTTP
+	}
+	switch ingressMode {
+	case OpenAIWSIngressModeDedicated:
+		return OpenAISessionConnModeDedicated
+	case OpenAIWSIngressModePassthrough:
+		return OpenAISessionConnModePassthrough
+	case OpenAIWSIngressModeOff:
+		return OpenAISessionConnModeHTTP
+	default:
+		return OpenAISessionConnModeCtxPool
+	}
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIGatewayService_DescribeSessionRouting(t *testing.T) {
+	groupID := int64(31)
+	newAccount := func(id int64, mode string) Account {
+		return Account{
+			ID:          id,
+			Platform:    PlatformOpenAI,
+			Type:        AccountTypeOAuth,
+			Status:      StatusActive,
+			Schedulable: true,
+			Concurrency: 1,
+			Extra: map[string]any{
+				"openai_oauth_responses_websockets_v2_mode":    mode,
+				"openai_oauth_responses_websockets_v2_enabled": true,
+			},
+		}
+	}
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.Enabled = true
+	cfg.Gateway.OpenAIWS.OAuthEnabled = true
+	cfg.Gateway.OpenAIWS.ResponsesWebsocketsV2 = true
+	cfg.Gateway.OpenAIWS.ModeRouterV2Enabled = true
+	cfg.Gateway.OpenAIWS.IngressModeDefault = OpenAIWSIngressModeCtxPool
+	cache := &stubGatewayCache{sessionBindings: map[string]int64{
+		"openai:sess_ctx":         7101,
+		"openai:sess_passthrough": 7102,
+		"openai:sess_off":         7103,
+	}}
+	svc := &OpenAIGatewayService{
+		accountRepo: stubOpenAIAccountRepo{accounts: []Account{
+			newAccount(7101, OpenAIWSIngressModeCtxPool),
+			newAccount(7102, OpenAIWSIngressModePassthrough),
+			newAccount(7103, OpenAIWSIngressModeOff),
+		}},
+		cache: cache,
+		cfg:   cfg,
+	}
+	ctx := context.Background()
+	describe := func(sessionHash string) *OpenAISessionRoutingDescription {
+		desc, err := svc.DescribeSessionRouting(ctx, groupID, sessionHash)
+		require.NoError(t, err)
+		require.NotNil(t, desc)
+		return desc
+	}
+
+	unbound := describe("sess_unknown")
+	require.False(t, unbound.Bound)
+	require.Zero(t, unbound.AccountID)
+	require.Empty(t, unbound.ConnMode)
+
+	svc.getOpenAIWSStateStore().BindSessionConn(groupID, "sess_ctx", "conn_1", time.Minute)
+	svc.getOpenAIWSStateStore().BindSessionTurnState(groupID, "sess_ctx", "turn_state_1", time.Minute)
+	desc := describe("sess_ctx")
+	require.True(t, desc.Bound)
+	require.Equal(t, int64(7101), desc.AccountID)
+	require.True(t, desc.ModeRouterV2Enabled)
+	require.Equal(t, OpenAIWSIngressModeCtxPool, desc.IngressMode)
+	require.Equal(t, string(OpenAIUpstreamTransportResponsesWebsocketV2), desc.Transport)
+	require.Equal(t, "ws_v2_mode_ctx_pool", desc.TransportReason)
+	require.Equal(t, OpenAISessionConnModeCtxPool, desc.ConnMode)
+	require.Equal(t, "conn_1", desc.SessionConnID)
+	require.True(t, desc.HasTurnState)
+
+	desc = describe("sess_passthrough")
+	require.Equal(t, OpenAIWSIngressModePassthrough, desc.IngressMode)
+	require.Equal(t, OpenAISessionConnModePassthrough, desc.ConnMode)
+
+	desc = describe("sess_off")
+	require.True(t, desc.Bound)
+	require.Equal(t, OpenAIWSIngressModeOff, desc.IngressMode)
+	require.Equal(t, string(OpenAIUpstreamTransportHTTPSSE), desc.Transport)
+	require.Equal(t, "account_mode_off", desc.TransportReason)
+	require.Equal(t, OpenAISessionConnModeHTTP, desc.ConnMode)
+
+	// force_dedicated_all 覆盖账号级 mode。
+	cfg.Gateway.OpenAIWS.ForceDedicatedAll = true
+	desc = describe("sess_ctx")
+	require.Equal(t, OpenAIWSIngressModeDedicated, desc.IngressMode)
+	require.Equal(t, OpenAISessionConnModeDedicated, desc.ConnMode)
+	cfg.Gateway.OpenAIWS.ForceDedicatedAll = false
+
+	// 关闭 ModeRouterV2 且仅开启 v1 时走共享连接池。
+	cfg.Gateway.OpenAIWS.ModeRouterV2Enabled = false
+	cfg.Gateway.OpenAIWS.ResponsesWebsocketsV2 = false
+	cfg.Gateway.OpenAIWS.ResponsesWebsockets = true
+	desc = describe("sess_passthrough")
+	require.False(t, desc.ModeRouterV2Enabled)
+	require.Equal(t, OpenAIWSIngressModeCtxPool, desc.IngressMode)
+	require.Equal(t, string(OpenAIUpstreamTransportResponsesWebsocket), desc.Transport)
+	require.Equal(t, OpenAISessionConnModePool, desc.ConnMode)
+
+	// 全局强制 HTTP。
+	cfg.Gateway.OpenAIWS.ForceHTTP = true
+	desc = describe("sess_ctx")
+	require.Equal(t, "global_force_http", desc.TransportReason)
+	require.Equal(t, OpenAISessionConnModeHTTP, desc.ConnMode)
+}
+
+func TestOpenAIGatewayService_ResolveOpenAIWSIngressMode_GroupDefaults(t *testing.T) {
+	account := Account{
+		ID:          7201,
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeOAuth,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+	}
+	overridden := Account{
+		ID:          7202,
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeOAuth,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Extra:       map[string]any{"openai_oauth_responses_websockets_v2_mode": OpenAIWSIngressModeCtxPool},
+	}
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.Enabled = true
+	cfg.Gateway.OpenAIWS.OAuthEnabled = true
+	cfg.Gateway.OpenAIWS.ResponsesWebsocketsV2 = true
+	cfg.Gateway.OpenAIWS.ModeRouterV2Enabled = true
+	cfg.Gateway.OpenAIWS.IngressModeDefault = OpenAIWSIngressModeCtxPool
+	cfg.Gateway.OpenAIWS.IngressModeGroupDefaults = []config.GatewayOpenAIWSIngressModeGroupDefault{
+		{GroupID: 41, Mode: OpenAIWSIngressModePassthrough},
+		{GroupID: 42, Mode: OpenAIWSIngressModeOff},
+	}
+	svc := &OpenAIGatewayService{
+		accountRepo: stubOpenAIAccountRepo{accounts: []Account{account}},
+		cache:       &stubGatewayCache{sessionBindings: map[string]int64{"openai:sess_group": account.ID}},
+		cfg:         cfg,
+	}
+
+	require.Equal(t, OpenAIWSIngressModePassthrough, svc.resolveOpenAIWSIngressMode(41, &account))
+	require.Equal(t, OpenAIWSIngressModeOff, svc.resolveOpenAIWSIngressMode(42, &account))
+	// 未配置的分组回退到全局默认。
+	require.Equal(t, OpenAIWSIngressModeCtxPool, svc.resolveOpenAIWSIngressMode(43, &account))
+	require.Equal(t, OpenAIWSIngressModeCtxPool, svc.resolveOpenAIWSIngressMode(0, &account))
+	// 账号显式配置的 mode 优先于分组默认。
+	require.Equal(t, OpenAIWSIngressModeCtxPool, svc.resolveOpenAIWSIngressMode(42, &overridden))
+
+	ctx := context.Background()
+	desc, err := svc.DescribeSessionRouting(ctx, 41, "sess_group")
+	require.NoError(t, err)
+	require.Equal(t, OpenAIWSIngressModePassthrough, desc.IngressMode)
+	require.Equal(t, OpenAISessionConnModePassthrough, desc.ConnMode)
+	desc, err = svc.DescribeSessionRouting(ctx, 42, "sess_group")
+	require.NoError(t, err)
+	require.Equal(t, OpenAIWSIngressModeOff, desc.IngressMode)
+
+	// 关闭 ModeRouterV2 时分组默认不生效。
+	cfg.Gateway.OpenAIWS.ModeRouterV2Enabled = false
+	require.Equal(t, OpenAIWSIngressModeCtxPool, svc.resolveOpenAIWSIngressMode(42, &account))
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// openAIWSShadowMaxInFlight 影子转发全局在途上限；达到上限时直接跳过采样，保证影子流量不会堆积。
+const openAIWSShadowMaxInFlight = 16
+
+// OpenAIWSShadowMetricsSnapshot 影子转发（流量镜像）指标快照。
+type OpenAIWSShadowMetricsSnapshot struct {
+	SampledTotal   int64 `json:"sampled_total"`
+	SkippedTotal   int64 `json:"skipped_total"`
+	SuccessTotal   int64 `json:"success_total"`
+	ErrorTotal     int64 `json:"error_total"`
+	LatencyMsTotal int64 `json:"latency_ms_total"`
+	InFlight       int64 `json:"in_flight"`
+}
+
+type openAIWSShadowMetrics struct {
+	sampled   atomic.Int64
+	skipped   atomic.Int64
+	success   atomic.Int64
+	errors    atomic.Int64
+	latencyMs atomic.Int64
+	inFlight  atomic.Int64
+}
+
+// SnapshotOpenAIWSShadowMetrics 返回影子转发指标快照。
+func (s *OpenAIGatewayService) SnapshotOpenAIWSShadowMetrics() OpenAIWSShadowMetricsSnapshot {
+	if s == nil {
+		return OpenAIWSShadowMetricsSnapshot{}
+	}
+	return OpenAIWSShadowMetricsSnapshot{
+		SampledTotal:   s.openaiWSShadowMetrics.sampled.Load(),
+		SkippedTotal:   s.openaiWSShadowMetrics.skipped.Load(),
+		SuccessTotal:   s.openaiWSShadowMetrics.success.Load(),
+		ErrorTotal:     s.openaiWSShadowMetrics.errors.Load(),
+		LatencyMsTotal: s.openaiWSShadowMetrics.latencyMs.Load(),
+		InFlight:       s.openaiWSShadowMetrics.inFlight.Load(),
+	}
+}
+
+// maybeShadowOpenAIWSTurn 按 shadow_sample_ratio 采样，把已完成的主 turn 复制一份异步发往影子账号。
+// 调用方只做采样与参数拷贝，不做任何阻塞操作；影子请求使用独立建连（不经过主账号连接池与并发槽位），
+// 响应全部丢弃，仅记录延迟与错误。primaryDuration 用于在日志中与影子延迟对比。
+func (s *OpenAIGatewayService) maybeShadowOpenAIWSTurn(c *gin.Context, primary *Account, turn int, payload []byte, originalModel string, primaryDuration time.Duration) {
+	if s == nil || s.cfg == nil || primary == nil || len(payload) == 0 {
+		return
+	}
+	shadowAccountID := s.cfg.Gateway.OpenAIWS.ShadowAccountID
+	ratio := s.cfg.Gateway.OpenAIWS.ShadowSampleRatio
+	if shadowAccountID <= 0 || ratio <= 0 || shadowAccountID == primary.ID {
+		return
+	}
+	if ratio < 1 && rand.Float64() >= ratio {
+		return
+	}
+	if s.openaiWSShadowMetrics.inFlight.Add(1) > openAIWSShadowMaxInFlight {
+		s.openaiWSShadowMetrics.inFlight.Add(-1)
+		s.openaiWSShadowMetrics.skipped.Add(1)
+		return
+	}
+	s.openaiWSShadowMetrics.sampled.Add(1)
+
+	// gin.Context 在请求结束后会被复用，这里只拷贝请求头供影子建连使用。
+	clientHeaders := make(http.Header)
+	if c != nil && c.Request != nil {
+		clientHeaders = c.Request.Header.Clone()
+	}
+	shadowPayload := cloneOpenAIWSPayloadBytes(payload)
+	primaryAccountID := primary.ID
+
+	GoWithPanicStateDump(func() {
+		defer s.openaiWSShadowMetrics.inFlight.Add(-1)
+		start := time.Now()
+		terminalEvent, err := s.runOpenAIWSShadowTurn(clientHeaders, shadowAccountID, shadowPayload, originalModel)
+		duration := time.Since(start)
+		if err != nil {
+			s.openaiWSShadowMetrics.errors.Add(1)
+		} else {
+			s.openaiWSShadowMetrics.success.Add(1)
+			s.openaiWSShadowMetrics.latencyMs.Add(duration.Milliseconds())
+		}
+		errText := "-"
+		if err != nil {
+			errText = truncateOpenAIWSLogValue(err.Error(), openAIWSLogValueMaxLen)
+		}
+		logOpenAIWSModeInfo(
+			"shadow_turn_finished primary_account_id=%d shadow_account_id=%d turn=%d primary_duration_ms=%d shadow_duration_ms=%d terminal_event=%s ok=%v err=%s",
+			primaryAccountID,
+			shadowAccountID,
+			turn,
+			primaryDuration.Milliseconds(),
+			duration.Milliseconds(),
+			normalizeOpenAIWSLogValue(terminalEvent),
+			err == nil,
+			errText,
+		)
+	})
+}
+
+// runOpenAIWSShadowTurn 向影子账号独立建连并发送一次 response.create，读取到终止事件即结束。
+// 影子账号没有主链路的响应历史，因此会去掉 previous_response_id。
+func (s *OpenAIGatewayService) runOpenAIWSShadowTurn(clientHeaders http.Header, shadowAccountID int64, payload []byte, originalModel string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.openAIWSDialTimeout()+s.openAIWSReadTimeout())
+	defer cancel()
+
+	if s.accountRepo == nil {
+		return "", errors.New("account repository is nil")
+	}
+	account, err := s.accountRepo.GetByID(ctx, shadowAccountID)
+	if err != nil {
+		return "", fmt.Errorf("load shadow account: %w", err)
+	}
+	if account == nil || account.Platform != PlatformOpenAI {
+		return "", errors.New("shadow account is not an openai account")
+	}
+	token, _, err := s.GetAccessToken(ctx, account)
+	if err != nil {
+		return "", fmt.Errorf("get shadow access token: %w", err)
+	}
+	wsURL, err := s.buildOpenAIResponsesWSURL(account)
+	if err != nil {
+		return "", fmt.Errorf("build shadow ws url: %w", err)
+	}
+
+	if gjson.GetBytes(payload, "previous_response_id").Exists() {
+		if trimmed, delErr := sjson.DeleteBytes(payload, "previous_response_id"); delErr == nil {
+			payload = trimmed
+		}
+	}
+	if originalModel != "" {
+		mappedModel := account.GetMappedModel(originalModel)
+		if normalized := normalizeCodexModel(mappedModel); normalized != "" {
+			mappedModel = normalized
+		}
+		if mappedModel != "" {
+			if updated, setErr := sjson.SetBytes(payload, "model", mappedModel); setErr == nil {
+				payload = updated
+			}
+		}
+	}
+
+	shadowCtx := &gin.Context{Request: &http.Request{Header: clientHeaders}}
+	isCodexCLI := s.cfg != nil && s.cfg.Gateway.ForceCodexCLI
+	decision := OpenAIWSProtocolDecision{Transport: OpenAIUpstreamTransportResponsesWebsocketV2}
+	headers, _ := s.buildOpenAIWSHeaders(shadowCtx, account, token, decision, isCodexCLI, "", "", "")
+	proxyURL := ""
+	if account.ProxyID != nil && account.Proxy != nil {
+		proxyURL = account.Proxy.URL()
+	}
+
+	dialer := s.getOpenAIWSPassthroughDialer()
+	if dialer == nil {
+		return "", errors.New("openai ws shadow dialer is nil")
+	}
+	dialCtx, cancelDial := context.WithTimeout(ctx, s.openAIWSDialTimeout())
+	conn, _, _, err := dialer.Dial(dialCtx, wsURL, headers, proxyURL)
+	cancelDial()
+	if err != nil {
+		return "", fmt.Errorf("dial shadow websocket: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if err := conn.WriteJSON(ctx, json.RawMessage(payload)); err != nil {
+		return "", fmt.Errorf("write shadow websocket request: %w", err)
+	}
+	for {
+		message, err := conn.ReadMessage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("read shadow websocket event: %w", err)
+		}
+		eventType, _, _ := parseOpenAIWSEventEnvelope(message)
+		if eventType == "error" {
+			code, errType, errMessage := summarizeOpenAIWSErrorEventFieldsFromRaw(parseOpenAIWSErrorEventFields(message))
+			return eventType, fmt.Errorf("shadow upstream error event code=%s type=%s message=%s", code, errType, errMessage)
+		}
+		if isOpenAIWSTerminalEvent(eventType) {
+			if strings.TrimSpace(eventType) != "response.completed" && strings.TrimSpace(eventType) != "response.done" {
+				return eventType, fmt.Errorf("shadow turn ended with %s", eventType)
+			}
+			return eventType, nil
+		}
+	}
+}
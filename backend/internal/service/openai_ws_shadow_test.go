@@ -0,0 +1,100 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIGatewayService_ShadowForwardsSampledTurnWithoutAffectingPrimary(t *testing.T) {
+	cfg := newOpenAIWSIngressCaptureTestConfig()
+	cfg.Gateway.OpenAIWS.ShadowAccountID = 402
+	cfg.Gateway.OpenAIWS.ShadowSampleRatio = 1
+
+	primaryUpstream := &openAIWSCaptureConn{
+		events: [][]byte{
+			[]byte(`{"type":"response.created","response":{"id":"resp_shadow_primary_1","model":"gpt-5.1"}}`),
+			[]byte(`{"type":"response.completed","response":{"id":"resp_shadow_primary_1","model":"gpt-5.1","usage":{"input_tokens":2,"output_tokens":1}}}`),
+		},
+	}
+	shadowUpstream := &openAIWSCaptureConn{
+		events: [][]byte{
+			[]byte(`{"type":"response.created","response":{"id":"resp_shadow_mirror_1","model":"gpt-5.1"}}`),
+			[]byte(`{"type":"response.completed","response":{"id":"resp_shadow_mirror_1","model":"gpt-5.1","usage":{"input_tokens":2,"output_tokens":1}}}`),
+		},
+	}
+	shadowDialer := &openAIWSQueueDialer{conns: []openAIWSClientConn{shadowUpstream}}
+
+	primary := &Account{
+		ID:          401,
+		Name:        "openai-shadow-primary",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{"api_key": "sk-primary"},
+		Extra:       map[string]any{"responses_websockets_v2_enabled": true},
+	}
+	shadow := Account{
+		ID:          402,
+		Name:        "openai-shadow-mirror",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{"api_key": "sk-shadow"},
+	}
+
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(&openAIWSQueueDialer{conns: []openAIWSClientConn{primaryUpstream}})
+	svc := &OpenAIGatewayService{
+		accountRepo:               stubOpenAIAccountRepo{accounts: []Account{shadow}},
+		cfg:                       cfg,
+		httpUpstream:              &httpUpstreamRecorder{},
+		cache:                     &stubGatewayCache{},
+		openaiWSResolver:          NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:             NewCodexToolCorrector(),
+		openaiWSPool:              pool,
+		openaiWSPassthroughDialer: shadowDialer,
+	}
+
+	received := runOpenAIWSIngressSessionWithServiceForTest(t, svc, primary, "sk-primary", [][]byte{
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"previous_response_id":"resp_prev_shadow","input":[{"type":"input_text","text":"hello"}]}`),
+	}, nil)
+	require.Len(t, received, 2, "影子响应不应下发到客户端")
+	for _, message := range received {
+		require.NotContains(t, string(message), "resp_shadow_mirror_1")
+	}
+
+	require.Eventually(t, func() bool {
+		return svc.SnapshotOpenAIWSShadowMetrics().SuccessTotal == 1
+	}, 3*time.Second, 10*time.Millisecond)
+	metrics := svc.SnapshotOpenAIWSShadowMetrics()
+	require.Equal(t, int64(1), metrics.SampledTotal)
+	require.Zero(t, metrics.ErrorTotal)
+	require.Equal(t, 1, shadowDialer.DialCount(), "影子请求应走独立建连")
+
+	require.NotNil(t, shadowUpstream.lastWrite)
+	require.Equal(t, "gpt-5.1", shadowUpstream.lastWrite["model"])
+	_, hasPrev := shadowUpstream.lastWrite["previous_response_id"]
+	require.False(t, hasPrev, "影子请求应去掉 previous_response_id")
+	require.Equal(t, int64(1), pool.SnapshotMetrics().AcquireTotal, "影子请求不应占用主账号连接池")
+}
+
+func TestOpenAIGatewayService_ShadowSkipsWhenDisabledOrSameAccount(t *testing.T) {
+	cfg := newOpenAIWSIngressCaptureTestConfig()
+	svc := &OpenAIGatewayService{cfg: cfg}
+	primary := &Account{ID: 403, Platform: PlatformOpenAI}
+	payload := []byte(`{"type":"response.create","model":"gpt-5.1"}`)
+
+	svc.maybeShadowOpenAIWSTurn(nil, primary, 1, payload, "gpt-5.1", time.Millisecond)
+	require.Zero(t, svc.SnapshotOpenAIWSShadowMetrics().SampledTotal, "未配置影子账号时不应采样")
+
+	cfg.Gateway.OpenAIWS.ShadowAccountID = primary.ID
+	cfg.Gateway.OpenAIWS.ShadowSampleRatio = 1
+	svc.maybeShadowOpenAIWSTurn(nil, primary, 1, payload, "gpt-5.1", time.Millisecond)
+	require.Zero(t, svc.SnapshotOpenAIWSShadowMetrics().SampledTotal, "影子账号与主账号相同时不应采样")
+}
@@ -4,11 +4,16 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
 )
 
 const (
@@ -17,8 +22,27 @@ const (
 	openAIWSStateStoreCleanupMaxPerMap = 512
 	openAIWSStateStoreMaxEntriesPerMap = 65536
 	openAIWSStateStoreRedisTimeout     = 3 * time.Second
+	// openAIWSSessionResponseAnchorsMax 每个会话保留的最近 response_id 锚点数量上限。
+	openAIWSSessionResponseAnchorsMax = 8
+	// openAIWSStateStoreDegradedLogEvery fail-open 降级日志的最小间隔，避免后端故障期间刷屏。
+	openAIWSStateStoreDegradedLogEvery = 10 * time.Second
 )
 
+// ErrOpenAIWSStateStoreUnavailable fail-closed 模式下粘连状态存储后端不可用，调用方应以可重试错误拒绝请求。
+var ErrOpenAIWSStateStoreUnavailable = errors.New("openai ws state store backend unavailable")
+
+// IsOpenAIWSStateStoreUnavailableError 判断错误是否为粘连状态存储后端不可用（fail-closed）。
+func IsOpenAIWSStateStoreUnavailableError(err error) bool {
+	return errors.Is(err, ErrOpenAIWSStateStoreUnavailable)
+}
+
+// OpenAIWSStateStoreMetricsSnapshot 粘连状态存储后端故障计数。
+type OpenAIWSStateStoreMetricsSnapshot struct {
+	BackendErrorTotal int64 `json:"backend_error_total"`
+	FailOpenTotal     int64 `json:"fail_open_total"`
+	FailClosedTotal   int64 `json:"fail_closed_total"`
+}
+
 type openAIWSAccountBinding struct {
 	accountID int64
 	expiresAt time.Time
@@ -39,12 +63,27 @@ type openAIWSSessionConnBinding struct {
 	expiresAt time.Time
 }
 
+type openAIWSSessionResponseAnchor struct {
+	responseID string
+	accountID  int64
+	expiresAt  time.Time
+}
+
+// openAIWSSessionAnchorsBinding 会话内最近的 response_id 锚点，按最近使用排序（下标 0 最新）。
+// createdAt 为绑定首次建立的时间，续期不刷新，用于按最长存活时间强制过期。
+type openAIWSSessionAnchorsBinding struct {
+	anchors   []openAIWSSessionResponseAnchor
+	expiresAt time.Time
+	createdAt time.Time
+}
+
 // OpenAIWSStateStore 管理 WSv2 的粘连状态。
 // - response_id -> account_id 用于续链路由
 // - response_id -> conn_id 用于连接内上下文复用
 //
 // response_id -> account_id 优先走 GatewayCache（Redis），同时维护本地热缓存。
 // response_id -> conn_id 仅在本进程内有效。
+// session -> 最近 response_id 锚点集合用于分支续链：会话从较早的 response 分叉时仍能命中原账号。
 type OpenAIWSStateStore interface {
 	BindResponseAccount(ctx context.Context, groupID int64, responseID string, accountID int64, ttl time.Duration) error
 	GetResponseAccount(ctx context.Context, groupID int64, responseID string) (int64, error)
@@ -61,6 +100,10 @@ type OpenAIWSStateStore interface {
 	BindSessionConn(groupID int64, sessionHash, connID string, ttl time.Duration)
 	GetSessionConn(groupID int64, sessionHash string) (string, bool)
 	DeleteSessionConn(groupID int64, sessionHash string)
+
+	BindSessionResponseAnchor(groupID int64, sessionHash, responseID string, accountID int64, ttl time.Duration)
+	GetSessionResponseAnchor(groupID int64, sessionHash, responseID string) (int64, bool)
+	DeleteSessionResponseAnchor(groupID int64, sessionHash, responseID string)
 }
 
 type defaultOpenAIWSStateStore struct {
@@ -74,8 +117,19 @@ type defaultOpenAIWSStateStore struct {
 	sessionToTurnState   map[string]openAIWSTurnStateBinding
 	sessionToConnMu      sync.RWMutex
 	sessionToConn        map[string]openAIWSSessionConnBinding
+	sessionToAnchorsMu   sync.Mutex
+	sessionToAnchors     map[string]openAIWSSessionAnchorsBinding
+	// sessionAnchorsMaxAge 返回会话锚点绑定的绝对最长存活时间；nil 或返回 <=0 表示不限制。
+	sessionAnchorsMaxAge func() time.Duration
+	// failClosed 返回后端故障时是否 fail-closed；nil 表示 fail-open。
+	failClosed func() bool
 
 	lastCleanupUnixNano atomic.Int64
+
+	backendErrors     atomic.Int64
+	failOpenTotal     atomic.Int64
+	failClosedTotal   atomic.Int64
+	lastDegradedLogAt atomic.Int64
 }
 
 // NewOpenAIWSStateStore 创建默认 WS 状态存储。
@@ -86,6 +140,7 @@ func NewOpenAIWSStateStore(cache GatewayCache) OpenAIWSStateStore {
 		responseToConn:     make(map[string]openAIWSConnBinding, 256),
 		sessionToTurnState: make(map[string]openAIWSTurnStateBinding, 256),
 		sessionToConn:      make(map[string]openAIWSSessionConnBinding, 256),
+		sessionToAnchors:   make(map[string]openAIWSSessionAnchorsBinding, 256),
 	}
 	store.lastCleanupUnixNano.Store(time.Now().UnixNano())
 	return store
@@ -111,7 +166,22 @@ func (s *defaultOpenAIWSStateStore) BindResponseAccount(ctx context.Context, gro
 	cacheKey := openAIWSResponseAccountCacheKey(id)
 	cacheCtx, cancel := withOpenAIWSStateStoreRedisTimeout(ctx)
 	defer cancel()
-	return s.cache.SetSessionAccountID(cacheCtx, groupID, cacheKey, accountID, ttl)
+	// 写入失败由调用方记录告警；进程内绑定已写入，本进程内续链仍可命中。
+	return s.countBackendError(s.cache.SetSessionAccountID(cacheCtx, groupID, cacheKey, accountID, ttl))
+}
+
+// responseBindingCountsByAccount 统计各账号未过期的进程内 response_id 绑定数量，供诊断快照使用。
+func (s *defaultOpenAIWSStateStore) responseBindingCountsByAccount(now time.Time) map[int64]int {
+	counts := make(map[int64]int)
+	s.responseToAccountMu.RLock()
+	defer s.responseToAccountMu.RUnlock()
+	for _, binding := range s.responseToAccount {
+		if binding.accountID <= 0 || !now.Before(binding.expiresAt) {
+			continue
+		}
+		counts[binding.accountID]++
+	}
+	return counts
 }
 
 func (s *defaultOpenAIWSStateStore) GetResponseAccount(ctx context.Context, groupID int64, responseID string) (int64, error) {
@@ -140,8 +210,11 @@ func (s *defaultOpenAIWSStateStore) GetResponseAccount(ctx context.Context, grou
 	cacheCtx, cancel := withOpenAIWSStateStoreRedisTimeout(ctx)
 	defer cancel()
 	accountID, err := s.cache.GetSessionAccountID(cacheCtx, groupID, cacheKey)
-	if err != nil || accountID <= 0 {
-		// 缓存读取失败不阻断主流程，按未命中降级。
+	if err != nil {
+		// 未命中（redis.Nil）与 fail-open 下的后端故障均按未命中处理，不阻断主流程。
+		return 0, s.handleReadBackendError("get_response_account", err)
+	}
+	if accountID <= 0 {
 		return 0, nil
 	}
 	return accountID, nil
@@ -161,7 +234,48 @@ func (s *defaultOpenAIWSStateStore) DeleteResponseAccount(ctx context.Context, g
 	}
 	cacheCtx, cancel := withOpenAIWSStateStoreRedisTimeout(ctx)
 	defer cancel()
-	return s.cache.DeleteSessionAccountID(cacheCtx, groupID, openAIWSResponseAccountCacheKey(id))
+	return s.countBackendError(s.cache.DeleteSessionAccountID(cacheCtx, groupID, openAIWSResponseAccountCacheKey(id)))
+}
+
+// countBackendError 统计写路径的后端错误并原样返回，写失败不影响当前请求，由调用方决定是否告警。
+func (s *defaultOpenAIWSStateStore) countBackendError(err error) error {
+	if err != nil && !errors.Is(err, redis.Nil) {
+		s.backendErrors.Add(1)
+	}
+	return err
+}
+
+// handleReadBackendError 按 state_store_failure_mode 处理读路径的后端错误：redis.Nil 视为未命中；
+// fail-open 记录降级计数与节流日志后返回 nil（按无粘连继续），fail-closed 返回包装了 ErrOpenAIWSStateStoreUnavailable 的错误。
+func (s *defaultOpenAIWSStateStore) handleReadBackendError(op string, err error) error {
+	if err == nil || errors.Is(err, redis.Nil) {
+		return nil
+	}
+	s.backendErrors.Add(1)
+	if s.failClosed != nil && s.failClosed() {
+		s.failClosedTotal.Add(1)
+		return fmt.Errorf("%w: %s: %v", ErrOpenAIWSStateStoreUnavailable, op, err)
+	}
+	degraded := s.failOpenTotal.Add(1)
+	now := time.Now().UnixNano()
+	last := s.lastDegradedLogAt.Load()
+	if now-last >= int64(openAIWSStateStoreDegradedLogEvery) && s.lastDegradedLogAt.CompareAndSwap(last, now) {
+		logger.L().Warn(
+			"openai.ws_state_store_degraded",
+			zap.String("op", op),
+			zap.Int64("fail_open_total", degraded),
+			zap.Error(err),
+		)
+	}
+	return nil
+}
+
+func (s *defaultOpenAIWSStateStore) snapshotMetrics() OpenAIWSStateStoreMetricsSnapshot {
+	return OpenAIWSStateStoreMetricsSnapshot{
+		BackendErrorTotal: s.backendErrors.Load(),
+		FailOpenTotal:     s.failOpenTotal.Load(),
+		FailClosedTotal:   s.failClosedTotal.Load(),
+	}
 }
 
 func (s *defaultOpenAIWSStateStore) BindResponseConn(responseID, connID string, ttl time.Duration) {
@@ -299,6 +413,111 @@ func (s *defaultOpenAIWSStateStore) DeleteSessionConn(groupID int64, sessionHash
 	s.sessionToConnMu.Unlock()
 }
 
+// BindSessionResponseAnchor 记录会话内的 response_id 锚点；超过上限时淘汰最久未使用的锚点。
+func (s *defaultOpenAIWSStateStore) BindSessionResponseAnchor(groupID int64, sessionHash, responseID string, accountID int64, ttl time.Duration) {
+	key := openAIWSSessionTurnStateKey(groupID, sessionHash)
+	id := normalizeOpenAIWSResponseID(responseID)
+	if key == "" || id == "" || accountID <= 0 {
+		return
+	}
+	ttl = normalizeOpenAIWSTTL(ttl)
+	s.maybeCleanup()
+
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	s.sessionToAnchorsMu.Lock()
+	defer s.sessionToAnchorsMu.Unlock()
+	ensureBindingCapacity(s.sessionToAnchors, key, openAIWSStateStoreMaxEntriesPerMap)
+	binding := s.sessionToAnchors[key]
+	if binding.createdAt.IsZero() || now.After(binding.expiresAt) || s.sessionAnchorsExceedMaxAge(binding, now) {
+		// 新会话、已过期或超过最长存活时间：丢弃旧锚点，从当前 response 重新开始计时。
+		binding = openAIWSSessionAnchorsBinding{createdAt: now}
+	}
+	anchors := make([]openAIWSSessionResponseAnchor, 0, openAIWSSessionResponseAnchorsMax)
+	anchors = append(anchors, openAIWSSessionResponseAnchor{responseID: id, accountID: accountID, expiresAt: expiresAt})
+	for _, anchor := range binding.anchors {
+		if len(anchors) >= openAIWSSessionResponseAnchorsMax {
+			break
+		}
+		if anchor.responseID == id || now.After(anchor.expiresAt) {
+			continue
+		}
+		anchors = append(anchors, anchor)
+	}
+	binding.anchors = anchors
+	if expiresAt.After(binding.expiresAt) {
+		binding.expiresAt = expiresAt
+	}
+	s.sessionToAnchors[key] = binding
+}
+
+// GetSessionResponseAnchor 查找会话内 response_id 锚点对应的账号，命中时将其提升为最近使用。
+func (s *defaultOpenAIWSStateStore) GetSessionResponseAnchor(groupID int64, sessionHash, responseID string) (int64, bool) {
+	key := openAIWSSessionTurnStateKey(groupID, sessionHash)
+	id := normalizeOpenAIWSResponseID(responseID)
+	if key == "" || id == "" {
+		return 0, false
+	}
+	s.maybeCleanup()
+
+	now := time.Now()
+	s.sessionToAnchorsMu.Lock()
+	defer s.sessionToAnchorsMu.Unlock()
+	binding, ok := s.sessionToAnchors[key]
+	if !ok || now.After(binding.expiresAt) {
+		return 0, false
+	}
+	if s.sessionAnchorsExceedMaxAge(binding, now) {
+		delete(s.sessionToAnchors, key)
+		return 0, false
+	}
+	for i, anchor := range binding.anchors {
+		if anchor.responseID != id {
+			continue
+		}
+		if now.After(anchor.expiresAt) {
+			return 0, false
+		}
+		copy(binding.anchors[1:i+1], binding.anchors[:i])
+		binding.anchors[0] = anchor
+		return anchor.accountID, true
+	}
+	return 0, false
+}
+
+func (s *defaultOpenAIWSStateStore) sessionAnchorsExceedMaxAge(binding openAIWSSessionAnchorsBinding, now time.Time) bool {
+	if s.sessionAnchorsMaxAge == nil || binding.createdAt.IsZero() {
+		return false
+	}
+	maxAge := s.sessionAnchorsMaxAge()
+	return maxAge > 0 && now.Sub(binding.createdAt) > maxAge
+}
+
+func (s *defaultOpenAIWSStateStore) DeleteSessionResponseAnchor(groupID int64, sessionHash, responseID string) {
+	key := openAIWSSessionTurnStateKey(groupID, sessionHash)
+	id := normalizeOpenAIWSResponseID(responseID)
+	if key == "" || id == "" {
+		return
+	}
+	s.sessionToAnchorsMu.Lock()
+	defer s.sessionToAnchorsMu.Unlock()
+	binding, ok := s.sessionToAnchors[key]
+	if !ok {
+		return
+	}
+	for i, anchor := range binding.anchors {
+		if anchor.responseID == id {
+			binding.anchors = append(binding.anchors[:i], binding.anchors[i+1:]...)
+			break
+		}
+	}
+	if len(binding.anchors) == 0 {
+		delete(s.sessionToAnchors, key)
+		return
+	}
+	s.sessionToAnchors[key] = binding
+}
+
 func (s *defaultOpenAIWSStateStore) maybeCleanup() {
 	if s == nil {
 		return
@@ -328,6 +547,10 @@ func (s *defaultOpenAIWSStateStore) maybeCleanup() {
 	s.sessionToConnMu.Lock()
 	cleanupExpiredSessionConnBindings(s.sessionToConn, now, openAIWSStateStoreCleanupMaxPerMap)
 	s.sessionToConnMu.Unlock()
+
+	s.sessionToAnchorsMu.Lock()
+	cleanupExpiredSessionAnchorsBindings(s.sessionToAnchors, now, openAIWSStateStoreCleanupMaxPerMap)
+	s.sessionToAnchorsMu.Unlock()
 }
 
 func cleanupExpiredAccountBindings(bindings map[string]openAIWSAccountBinding, now time.Time, maxScan int) {
@@ -394,6 +617,22 @@ func cleanupExpiredSessionConnBindings(bindings map[string]openAIWSSessionConnBi
 	}
 }
 
+func cleanupExpiredSessionAnchorsBindings(bindings map[string]openAIWSSessionAnchorsBinding, now time.Time, maxScan int) {
+	if len(bindings) == 0 || maxScan <= 0 {
+		return
+	}
+	scanned := 0
+	for key, binding := range bindings {
+		if now.After(binding.expiresAt) {
+			delete(bindings, key)
+		}
+		scanned++
+		if scanned >= maxScan {
+			break
+		}
+	}
+}
+
 func ensureBindingCapacity[T any](bindings map[string]T, incomingKey string, maxEntries int) {
 	if len(bindings) < maxEntries || maxEntries <= 0 {
 		return
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/require"
 )
 
@@ -233,3 +234,195 @@ func TestWithOpenAIWSStateStoreRedisTimeout_WithParentContext(t *testing.T) {
 	_, ok := ctx.Deadline()
 	require.True(t, ok, "应附加短超时")
 }
+
+func TestOpenAIWSStateStore_SessionResponseAnchorsBoundedLRU(t *testing.T) {
+	store := NewOpenAIWSStateStore(nil)
+	groupID := int64(11)
+
+	for i := 0; i < openAIWSSessionResponseAnchorsMax; i++ {
+		store.BindSessionResponseAnchor(groupID, "session_anchor", fmt.Sprintf("resp_anchor_%d", i), int64(100+i), time.Minute)
+	}
+	// 访问最早的锚点，使其成为最近使用，避免被下一次绑定淘汰。
+	accountID, ok := store.GetSessionResponseAnchor(groupID, "session_anchor", "resp_anchor_0")
+	require.True(t, ok)
+	require.Equal(t, int64(100), accountID)
+
+	store.BindSessionResponseAnchor(groupID, "session_anchor", "resp_anchor_new", 200, time.Minute)
+	_, ok = store.GetSessionResponseAnchor(groupID, "session_anchor", "resp_anchor_0")
+	require.True(t, ok, "最近访问过的锚点应被保留")
+	_, ok = store.GetSessionResponseAnchor(groupID, "session_anchor", "resp_anchor_1")
+	require.False(t, ok, "超出上限时应淘汰最久未使用的锚点")
+	accountID, ok = store.GetSessionResponseAnchor(groupID, "session_anchor", "resp_anchor_new")
+	require.True(t, ok)
+	require.Equal(t, int64(200), accountID)
+
+	// group/session 隔离
+	_, ok = store.GetSessionResponseAnchor(groupID+1, "session_anchor", "resp_anchor_new")
+	require.False(t, ok)
+	_, ok = store.GetSessionResponseAnchor(groupID, "session_other", "resp_anchor_new")
+	require.False(t, ok)
+
+	store.DeleteSessionResponseAnchor(groupID, "session_anchor", "resp_anchor_new")
+	_, ok = store.GetSessionResponseAnchor(groupID, "session_anchor", "resp_anchor_new")
+	require.False(t, ok)
+}
+
+func TestOpenAIWSStateStore_SessionResponseAnchorTTL(t *testing.T) {
+	store := NewOpenAIWSStateStore(nil)
+	store.BindSessionResponseAnchor(12, "session_anchor_ttl", "resp_short", 301, 30*time.Millisecond)
+	store.BindSessionResponseAnchor(12, "session_anchor_ttl", "resp_long", 302, time.Minute)
+
+	time.Sleep(60 * time.Millisecond)
+	_, ok := store.GetSessionResponseAnchor(12, "session_anchor_ttl", "resp_short")
+	require.False(t, ok)
+	accountID, ok := store.GetSessionResponseAnchor(12, "session_anchor_ttl", "resp_long")
+	require.True(t, ok)
+	require.Equal(t, int64(302), accountID)
+}
+
+func TestOpenAIWSStateStore_SessionResponseAnchorMaxAge(t *testing.T) {
+	raw := NewOpenAIWSStateStore(nil)
+	store, ok := raw.(*defaultOpenAIWSStateStore)
+	require.True(t, ok)
+	maxAge := 80 * time.Millisecond
+	store.sessionAnchorsMaxAge = func() time.Duration { return maxAge }
+
+	// 每轮续期都使用很长的 TTL，但会话绑定仍应在最长存活时间后强制失效。
+	store.BindSessionResponseAnchor(13, "session_anchor_age", "resp_age_1", 401, time.Hour)
+	time.Sleep(50 * time.Millisecond)
+	store.BindSessionResponseAnchor(13, "session_anchor_age", "resp_age_2", 401, time.Hour)
+	accountID, found := store.GetSessionResponseAnchor(13, "session_anchor_age", "resp_age_1")
+	require.True(t, found, "未超过最长存活时间时续期不影响查询")
+	require.Equal(t, int64(401), accountID)
+
+	time.Sleep(50 * time.Millisecond)
+	_, found = store.GetSessionResponseAnchor(13, "session_anchor_age", "resp_age_2")
+	require.False(t, found, "超过最长存活时间后即使 TTL 未到也应失效")
+
+	// 失效后重新绑定从当前 response 开始计时，旧锚点不再保留。
+	store.BindSessionResponseAnchor(13, "session_anchor_age", "resp_age_3", 402, time.Hour)
+	accountID, found = store.GetSessionResponseAnchor(13, "session_anchor_age", "resp_age_3")
+	require.True(t, found)
+	require.Equal(t, int64(402), accountID)
+	_, found = store.GetSessionResponseAnchor(13, "session_anchor_age", "resp_age_1")
+	require.False(t, found)
+
+	maxAge = 0
+	time.Sleep(100 * time.Millisecond)
+	_, found = store.GetSessionResponseAnchor(13, "session_anchor_age", "resp_age_3")
+	require.True(t, found, "max age 为 0 时不限制")
+}
+
+// openAIWSFailingGatewayCache 模拟 Redis 故障：所有会话绑定读写均返回后端错误。
+type openAIWSFailingGatewayCache struct {
+	stubGatewayCache
+	err error
+}
+
+func (c *openAIWSFailingGatewayCache) GetSessionAccountID(context.Context, int64, string) (int64, error) {
+	return 0, c.err
+}
+
+func (c *openAIWSFailingGatewayCache) SetSessionAccountID(context.Context, int64, string, int64, time.Duration) error {
+	return c.err
+}
+
+func (c *openAIWSFailingGatewayCache) DeleteSessionAccountID(context.Context, int64, string) error {
+	return c.err
+}
+
+func TestOpenAIWSStateStore_BackendFailureModes(t *testing.T) {
+	ctx := context.Background()
+	backendErr := errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")
+
+	t.Run("fail open degrades to in-memory state", func(t *testing.T) {
+		store := NewOpenAIWSStateStore(&openAIWSFailingGatewayCache{err: backendErr}).(*defaultOpenAIWSStateStore)
+
+		// 写入失败原样返回供调用方告警，进程内绑定仍可命中。
+		require.ErrorIs(t, store.BindResponseAccount(ctx, 1, "resp_local", 7, time.Minute), backendErr)
+		accountID, err := store.GetResponseAccount(ctx, 1, "resp_local")
+		require.NoError(t, err)
+		require.Equal(t, int64(7), accountID)
+
+		// 其他实例写入的绑定不可见，按无粘连处理。
+		accountID, err = store.GetResponseAccount(ctx, 1, "resp_remote")
+		require.NoError(t, err)
+		require.Zero(t, accountID)
+
+		metrics := store.snapshotMetrics()
+		require.Equal(t, int64(2), metrics.BackendErrorTotal)
+		require.Equal(t, int64(1), metrics.FailOpenTotal)
+		require.Zero(t, metrics.FailClosedTotal)
+	})
+
+	t.Run("fail closed surfaces retryable error", func(t *testing.T) {
+		store := NewOpenAIWSStateStore(&openAIWSFailingGatewayCache{err: backendErr}).(*defaultOpenAIWSStateStore)
+		store.failClosed = func() bool { return true }
+
+		require.ErrorIs(t, store.BindResponseAccount(ctx, 1, "resp_local", 7, time.Minute), backendErr)
+
+		// 进程内命中无需访问后端，不受影响。
+		accountID, err := store.GetResponseAccount(ctx, 1, "resp_local")
+		require.NoError(t, err)
+		require.Equal(t, int64(7), accountID)
+
+		_, err = store.GetResponseAccount(ctx, 1, "resp_remote")
+		require.True(t, IsOpenAIWSStateStoreUnavailableError(err))
+		require.ErrorContains(t, err, "connection refused")
+
+		metrics := store.snapshotMetrics()
+		require.Equal(t, int64(2), metrics.BackendErrorTotal)
+		require.Equal(t, int64(1), metrics.FailClosedTotal)
+		require.Zero(t, metrics.FailOpenTotal)
+	})
+
+	t.Run("cache miss is not a backend failure", func(t *testing.T) {
+		store := NewOpenAIWSStateStore(&openAIWSFailingGatewayCache{err: redis.Nil}).(*defaultOpenAIWSStateStore)
+		store.failClosed = func() bool { return true }
+
+		accountID, err := store.GetResponseAccount(ctx, 1, "resp_missing")
+		require.NoError(t, err)
+		require.Zero(t, accountID)
+		require.Zero(t, store.snapshotMetrics().BackendErrorTotal)
+	})
+}
+
+func TestOpenAIGatewayService_SelectAccountByPreviousResponseID_StateStoreFailureMode(t *testing.T) {
+	ctx := context.Background()
+	groupID := int64(31)
+	account := Account{
+		ID:          41,
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 2,
+		Extra: map[string]any{
+			"openai_apikey_responses_websockets_v2_enabled": true,
+		},
+	}
+	newService := func(mode string) *OpenAIGatewayService {
+		cfg := newOpenAIWSV2TestConfig()
+		cfg.Gateway.OpenAIWS.StateStoreFailureMode = mode
+		cache := &openAIWSFailingGatewayCache{err: errors.New("redis: i/o timeout")}
+		return &OpenAIGatewayService{
+			accountRepo:        stubOpenAIAccountRepo{accounts: []Account{account}},
+			cache:              cache,
+			cfg:                cfg,
+			concurrencyService: NewConcurrencyService(stubConcurrencyCache{}),
+		}
+	}
+
+	svc := newService("open")
+	selection, err := svc.SelectAccountByPreviousResponseID(ctx, &groupID, "resp_other_instance", "gpt-5.1", nil)
+	require.NoError(t, err)
+	require.Nil(t, selection, "fail-open 时按无粘连继续调度")
+	require.Equal(t, int64(1), svc.SnapshotOpenAIWSStateStoreMetrics().FailOpenTotal)
+	require.Equal(t, int64(1), svc.SnapshotOpenAIWSPerformanceMetrics().StateStore.FailOpenTotal)
+
+	svc = newService("closed")
+	selection, err = svc.SelectAccountByPreviousResponseID(ctx, &groupID, "resp_other_instance", "gpt-5.1", nil)
+	require.Nil(t, selection)
+	require.True(t, IsOpenAIWSStateStoreUnavailableError(err))
+	require.Equal(t, int64(1), svc.SnapshotOpenAIWSStateStoreMetrics().FailClosedTotal)
+}
@@ -0,0 +1,108 @@
+package service
+
+import "sync/atomic"
+
+// 单轮未复用粘连上游连接的原因（按首个导致放弃原连接的事件记录）。
+const (
+	// openAIWSStickyMissPreferredConnMissing 期望复用的连接已不可用（过期、被回收或被占用），获取到了其他连接。
+	openAIWSStickyMissPreferredConnMissing = "preferred_conn_missing"
+	// openAIWSStickyMissPreflightPingFailed 轮次开始前预检 ping 失败，重建上游连接。
+	openAIWSStickyMissPreflightPingFailed = "preflight_ping_failed"
+	// openAIWSStickyMissPrevResponseNotFound 上游返回 previous_response_not_found，放弃原连接后全量重放。
+	openAIWSStickyMissPrevResponseNotFound = "prev_response_not_found"
+	// openAIWSStickyMissTurnRetry 可重试错误下换连接重发本轮。
+	openAIWSStickyMissTurnRetry = "turn_retry"
+	// openAIWSStickyMissClientPingFailed 客户端 ping 触发的上游探活失败，轮次间已重建连接。
+	openAIWSStickyMissClientPingFailed = "client_ping_failed"
+	// openAIWSStickyMissConnRetired 上一轮结束时连接已被回收（如凭证轮换）。
+	openAIWSStickyMissConnRetired = "conn_retired"
+	// openAIWSStickyMissAccountSwitch 会话切换了账号，原账号上的连接不可复用。
+	openAIWSStickyMissAccountSwitch = "account_switch"
+)
+
+// openAIWSStickyMissReasons 固定各原因在计数数组中的下标，同时决定快照输出的原因集合。
+var openAIWSStickyMissReasons = [...]string{
+	openAIWSStickyMissPreferredConnMissing,
+	openAIWSStickyMissPreflightPingFailed,
+	openAIWSStickyMissPrevResponseNotFound,
+	openAIWSStickyMissTurnRetry,
+	openAIWSStickyMissClientPingFailed,
+	openAIWSStickyMissConnRetired,
+	openAIWSStickyMissAccountSwitch,
+}
+
+func openAIWSStickyMissReasonIndex(reason string) int {
+	for i, candidate := range openAIWSStickyMissReasons {
+		if candidate == reason {
+			return i
+		}
+	}
+	return -1
+}
+
+type openAIWSStickyReuseMetrics struct {
+	eligible atomic.Int64
+	reused   atomic.Int64
+	misses   [len(openAIWSStickyMissReasons)]atomic.Int64
+}
+
+// OpenAIWSStickyReuseMetricsSnapshot 粘连连接复用统计：仅统计存在期望复用连接的轮次
+// （会话非首轮，或首轮命中了 previous_response_id / 会话绑定的连接）。
+type OpenAIWSStickyReuseMetricsSnapshot struct {
+	EligibleTurnsTotal int64            `json:"eligible_turns_total"`
+	ReusedTurnsTotal   int64            `json:"reused_turns_total"`
+	MissReasons        map[string]int64 `json:"miss_reasons"`
+}
+
+// resolveOpenAIWSStickyConnReuse 判断本轮是否复用了期望的连接。
+// target 为空表示本轮没有可复用的连接，不参与统计；实际连接与 target 不同且未记录原因时归为 preferred_conn_missing。
+func resolveOpenAIWSStickyConnReuse(target, actual, missReason string) (eligible bool, reused bool, reason string) {
+	if target == "" {
+		return false, false, ""
+	}
+	if actual != "" && actual == target {
+		return true, true, ""
+	}
+	if missReason == "" {
+		missReason = openAIWSStickyMissPreferredConnMissing
+	}
+	return true, false, missReason
+}
+
+// recordOpenAIWSStickyConnReuse 汇总本轮粘连复用结果并写入 result（可为 nil）。
+func (s *OpenAIGatewayService) recordOpenAIWSStickyConnReuse(result *OpenAIForwardResult, target, actual, missReason string) {
+	eligible, reused, reason := resolveOpenAIWSStickyConnReuse(target, actual, missReason)
+	if !eligible {
+		return
+	}
+	if result != nil {
+		result.StickyConnReused = reused
+		result.StickyConnMissReason = reason
+	}
+	if s == nil {
+		return
+	}
+	s.openaiWSStickyReuseMetrics.eligible.Add(1)
+	if reused {
+		s.openaiWSStickyReuseMetrics.reused.Add(1)
+		return
+	}
+	if idx := openAIWSStickyMissReasonIndex(reason); idx >= 0 {
+		s.openaiWSStickyReuseMetrics.misses[idx].Add(1)
+	}
+}
+
+func (s *OpenAIGatewayService) SnapshotOpenAIWSStickyReuseMetrics() OpenAIWSStickyReuseMetricsSnapshot {
+	if s == nil {
+		return OpenAIWSStickyReuseMetricsSnapshot{}
+	}
+	snapshot := OpenAIWSStickyReuseMetricsSnapshot{
+		EligibleTurnsTotal: s.openaiWSStickyReuseMetrics.eligible.Load(),
+		ReusedTurnsTotal:   s.openaiWSStickyReuseMetrics.reused.Load(),
+		MissReasons:        make(map[string]int64, len(openAIWSStickyMissReasons)),
+	}
+	for i, reason := range openAIWSStickyMissReasons {
+		snapshot.MissReasons[reason] = s.openaiWSStickyReuseMetrics.misses[i].Load()
+	}
+	return snapshot
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveOpenAIWSStickyConnReuse(t *testing.T) {
+	eligible, reused, reason := resolveOpenAIWSStickyConnReuse("", "conn_a", "")
+	require.False(t, eligible)
+	require.False(t, reused)
+	require.Empty(t, reason)
+
+	eligible, reused, reason = resolveOpenAIWSStickyConnReuse("conn_a", "conn_a", "")
+	require.True(t, eligible)
+	require.True(t, reused)
+	require.Empty(t, reason)
+
+	eligible, reused, reason = resolveOpenAIWSStickyConnReuse("conn_a", "conn_b", "")
+	require.True(t, eligible)
+	require.False(t, reused)
+	require.Equal(t, openAIWSStickyMissPreferredConnMissing, reason)
+
+	eligible, reused, reason = resolveOpenAIWSStickyConnReuse("conn_a", "conn_b", openAIWSStickyMissPreflightPingFailed)
+	require.True(t, eligible)
+	require.False(t, reused)
+	require.Equal(t, openAIWSStickyMissPreflightPingFailed, reason)
+}
+
+func TestOpenAIGatewayService_RecordOpenAIWSStickyConnReuse(t *testing.T) {
+	svc := &OpenAIGatewayService{}
+
+	untracked := &OpenAIForwardResult{}
+	svc.recordOpenAIWSStickyConnReuse(untracked, "", "conn_a", "")
+	require.False(t, untracked.StickyConnReused)
+	require.Empty(t, untracked.StickyConnMissReason)
+
+	reused := &OpenAIForwardResult{}
+	svc.recordOpenAIWSStickyConnReuse(reused, "conn_a", "conn_a", "")
+	require.True(t, reused.StickyConnReused)
+	require.Empty(t, reused.StickyConnMissReason)
+
+	missed := &OpenAIForwardResult{}
+	svc.recordOpenAIWSStickyConnReuse(missed, "conn_a", "conn_b", openAIWSStickyMissTurnRetry)
+	require.False(t, missed.StickyConnReused)
+	require.Equal(t, openAIWSStickyMissTurnRetry, missed.StickyConnMissReason)
+	svc.recordOpenAIWSStickyConnReuse(nil, "conn_a", "conn_c", "")
+
+	snapshot := svc.SnapshotOpenAIWSStickyReuseMetrics()
+	require.Equal(t, int64(3), snapshot.EligibleTurnsTotal)
+	require.Equal(t, int64(1), snapshot.ReusedTurnsTotal)
+	require.Equal(t, int64(1), snapshot.MissReasons[openAIWSStickyMissTurnRetry])
+	require.Equal(t, int64(1), snapshot.MissReasons[openAIWSStickyMissPreferredConnMissing])
+	require.Len(t, snapshot.MissReasons, len(openAIWSStickyMissReasons))
+	require.Equal(t, snapshot, svc.SnapshotOpenAIWSPerformanceMetrics().StickyReuse)
+}
+
+func TestOpenAIWSFakeUpstream_IngressStickyConnReuseReasons(t *testing.T) {
+	upstream := newOpenAIWSFakeUpstream(t,
+		openAIWSFakeUpstreamTurn{},
+		openAIWSFakeUpstreamTurn{},
+		openAIWSFakeUpstreamTurn{events: [][]byte{openAIWSFakeErrorEvent("previous_response_not_found", "")}},
+	)
+	cfg := newOpenAIWSIngressCaptureTestConfig()
+	cfg.Gateway.OpenAIWS.IngressPreviousResponseRecoveryEnabled = true
+	svc := upstream.newService(cfg)
+
+	var mu sync.Mutex
+	results := make(map[int]*OpenAIForwardResult)
+	hooks := &OpenAIWSIngressHooks{
+		AfterTurn: func(turn int, result *OpenAIForwardResult, turnErr error) {
+			if turnErr != nil || result == nil {
+				return
+			}
+			mu.Lock()
+			results[turn] = result
+			mu.Unlock()
+		},
+	}
+	received := runOpenAIWSIngressSessionWithServiceForTest(t, svc, upstream.account(401), "sk-test", [][]byte{
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false}`),
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"previous_response_id":"resp_fake_1"}`),
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"previous_response_id":"resp_fake_2"}`),
+	}, hooks)
+	require.Len(t, received, 3)
+	require.Equal(t, 2, upstream.connCount())
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, results, 3)
+	// 首轮没有可复用的连接，不参与统计。
+	require.False(t, results[1].StickyConnReused)
+	require.Empty(t, results[1].StickyConnMissReason)
+	require.True(t, results[2].StickyConnReused)
+	require.Empty(t, results[2].StickyConnMissReason)
+	require.False(t, results[3].StickyConnReused)
+	require.Equal(t, openAIWSStickyMissPrevResponseNotFound, results[3].StickyConnMissReason)
+
+	snapshot := svc.SnapshotOpenAIWSStickyReuseMetrics()
+	require.Equal(t, int64(2), snapshot.EligibleTurnsTotal)
+	require.Equal(t, int64(1), snapshot.ReusedTurnsTotal)
+	require.Equal(t, int64(1), snapshot.MissReasons[openAIWSStickyMissPrevResponseNotFound])
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+const (
+	openAIWSStoreDisabledFullInputPolicyAuto        = "auto"
+	openAIWSStoreDisabledFullInputPolicyIncremental = "incremental"
+	openAIWSStoreDisabledFullInputPolicyFullCreate  = "full_create"
+)
+
+// store=false 续链 turn 同时携带完整 input 与 previous_response_id 时，最终采用的解释及原因。
+const (
+	openAIWSStoreDisabledFullInputReasonPolicy         = "policy"
+	openAIWSStoreDisabledFullInputReasonAuto           = "auto"
+	openAIWSStoreDisabledFullInputReasonPrevIDMismatch = "previous_response_id_mismatch"
+	openAIWSStoreDisabledFullInputReasonNoNewInput     = "no_new_input"
+	openAIWSStoreDisabledFullInputReasonRewriteFailed  = "rewrite_failed"
+)
+
+// openAIWSIngressStoreDisabledFullInputPolicy 返回 store=false 续链 turn 同时携带完整 input 与 previous_response_id 时的解释策略。
+func (s *OpenAIGatewayService) openAIWSIngressStoreDisabledFullInputPolicy() string {
+	if s == nil || s.cfg == nil {
+		return openAIWSStoreDisabledFullInputPolicyAuto
+	}
+	switch strings.TrimSpace(s.cfg.Gateway.OpenAIWS.IngressStoreDisabledFullInputPolicy) {
+	case openAIWSStoreDisabledFullInputPolicyIncremental:
+		return openAIWSStoreDisabledFullInputPolicyIncremental
+	case openAIWSStoreDisabledFullInputPolicyFullCreate:
+		return openAIWSStoreDisabledFullInputPolicyFullCreate
+	default:
+		return openAIWSStoreDisabledFullInputPolicyAuto
+	}
+}
+
+// openAIWSStoreDisabledFullInputDecision 为一次解释的结果。
+// Mode 为空表示交由严格续链判定（auto 策略）；Payload 为按 Mode 改写后的请求。
+type openAIWSStoreDisabledFullInputDecision struct {
+	Mode    string
+	Reason  string
+	Payload []byte
+}
+
+// resolveOpenAIWSStoreDisabledFullInput 判断本轮 input 是否为完整历史（以上一轮全量 input 为前缀），
+// 是则按策略选择增量续链或全量 create；不适用时 ok=false，auto 策略只标记适用、不改写。
+// 显式策略下，previous_response_id 不是上一轮响应 ID（完整 input 与续链锚点指向不同的链）或 input 没有新增项时两者矛盾，
+// 无论策略如何都去掉 previous_response_id，以自洽的完整 input 全量发送。
+func resolveOpenAIWSStoreDisabledFullInput(
+	policy string,
+	payload []byte,
+	previousFullInput []json.RawMessage,
+	previousResponseID string,
+	expectedPreviousResponseID string,
+) (decision openAIWSStoreDisabledFullInputDecision, ok bool, err error) {
+	previousResponseID = strings.TrimSpace(previousResponseID)
+	if previousResponseID == "" || len(previousFullInput) == 0 {
+		return decision, false, nil
+	}
+	items, exists, extractErr := openAIWSExtractNormalizedInputSequence(payload)
+	if extractErr != nil || !exists || !openAIWSRawItemsHasPrefix(items, previousFullInput) {
+		return decision, false, nil
+	}
+
+	if policy != openAIWSStoreDisabledFullInputPolicyIncremental && policy != openAIWSStoreDisabledFullInputPolicyFullCreate {
+		return openAIWSStoreDisabledFullInputDecision{Reason: openAIWSStoreDisabledFullInputReasonAuto, Payload: payload}, true, nil
+	}
+	mode := policy
+	reason := openAIWSStoreDisabledFullInputReasonPolicy
+	switch {
+	case previousResponseID != strings.TrimSpace(expectedPreviousResponseID):
+		mode, reason = openAIWSStoreDisabledFullInputPolicyFullCreate, openAIWSStoreDisabledFullInputReasonPrevIDMismatch
+	case len(items) == len(previousFullInput):
+		mode, reason = openAIWSStoreDisabledFullInputPolicyFullCreate, openAIWSStoreDisabledFullInputReasonNoNewInput
+	}
+
+	switch mode {
+	case openAIWSStoreDisabledFullInputPolicyIncremental:
+		updated, setErr := setOpenAIWSPayloadInputSequence(payload, items[len(previousFullInput):], true)
+		if setErr != nil {
+			return decision, true, setErr
+		}
+		return openAIWSStoreDisabledFullInputDecision{Mode: mode, Reason: reason, Payload: updated}, true, nil
+	default:
+		updated, removed, dropErr := dropPreviousResponseIDFromRawPayload(payload)
+		if dropErr != nil {
+			return decision, true, dropErr
+		}
+		if !removed {
+			return decision, true, errors.New("previous_response_id not removed")
+		}
+		return openAIWSStoreDisabledFullInputDecision{Mode: mode, Reason: reason, Payload: updated}, true, nil
+	}
+}
+
+// applyOpenAIWSStoreDisabledFullInput 将本轮对完整 input + previous_response_id 的解释写入结果。
+func applyOpenAIWSStoreDisabledFullInput(result *OpenAIForwardResult, mode, reason string) {
+	if result == nil || mode == "" {
+		return
+	}
+	result.StoreDisabledFullInputMode = mode
+	result.StoreDisabledFullInputReason = reason
+}
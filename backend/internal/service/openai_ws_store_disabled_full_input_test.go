@@ -0,0 +1,189 @@
+package service
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestResolveOpenAIWSStoreDisabledFullInput(t *testing.T) {
+	previousFullInput := []json.RawMessage{json.RawMessage(`{"type":"message","role":"user","content":"a"}`)}
+	fullPayload := []byte(`{"type":"response.create","store":false,"previous_response_id":"resp_1","input":[` +
+		`{"type":"message","role":"user","content":"a"},` +
+		`{"type":"message","role":"user","content":"b"}]}`)
+
+	cases := []struct {
+		name       string
+		policy     string
+		payload    []byte
+		prevID     string
+		expected   string
+		wantOK     bool
+		wantMode   string
+		wantReason string
+		wantPrev   bool
+		wantInputs int64
+	}{
+		{
+			name:     "delta_input_not_applicable",
+			policy:   openAIWSStoreDisabledFullInputPolicyIncremental,
+			payload:  []byte(`{"previous_response_id":"resp_1","input":[{"type":"message","role":"user","content":"b"}]}`),
+			prevID:   "resp_1",
+			expected: "resp_1",
+		},
+		{
+			name:       "auto_leaves_payload",
+			policy:     openAIWSStoreDisabledFullInputPolicyAuto,
+			payload:    fullPayload,
+			prevID:     "resp_1",
+			expected:   "resp_1",
+			wantOK:     true,
+			wantReason: openAIWSStoreDisabledFullInputReasonAuto,
+			wantPrev:   true,
+			wantInputs: 2,
+		},
+		{
+			name:       "incremental_trims_chain_prefix",
+			policy:     openAIWSStoreDisabledFullInputPolicyIncremental,
+			payload:    fullPayload,
+			prevID:     "resp_1",
+			expected:   "resp_1",
+			wantOK:     true,
+			wantMode:   openAIWSStoreDisabledFullInputPolicyIncremental,
+			wantReason: openAIWSStoreDisabledFullInputReasonPolicy,
+			wantPrev:   true,
+			wantInputs: 1,
+		},
+		{
+			name:       "full_create_drops_previous_response_id",
+			policy:     openAIWSStoreDisabledFullInputPolicyFullCreate,
+			payload:    fullPayload,
+			prevID:     "resp_1",
+			expected:   "resp_1",
+			wantOK:     true,
+			wantMode:   openAIWSStoreDisabledFullInputPolicyFullCreate,
+			wantReason: openAIWSStoreDisabledFullInputReasonPolicy,
+			wantInputs: 2,
+		},
+		{
+			name:       "incremental_prev_mismatch_forces_full_create",
+			policy:     openAIWSStoreDisabledFullInputPolicyIncremental,
+			payload:    fullPayload,
+			prevID:     "resp_1",
+			expected:   "resp_other",
+			wantOK:     true,
+			wantMode:   openAIWSStoreDisabledFullInputPolicyFullCreate,
+			wantReason: openAIWSStoreDisabledFullInputReasonPrevIDMismatch,
+			wantInputs: 2,
+		},
+		{
+			name:       "incremental_without_new_input_forces_full_create",
+			policy:     openAIWSStoreDisabledFullInputPolicyIncremental,
+			payload:    []byte(`{"previous_response_id":"resp_1","input":[{"type":"message","role":"user","content":"a"}]}`),
+			prevID:     "resp_1",
+			expected:   "resp_1",
+			wantOK:     true,
+			wantMode:   openAIWSStoreDisabledFullInputPolicyFullCreate,
+			wantReason: openAIWSStoreDisabledFullInputReasonNoNewInput,
+			wantInputs: 1,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			decision, ok, err := resolveOpenAIWSStoreDisabledFullInput(tc.policy, tc.payload, previousFullInput, tc.prevID, tc.expected)
+			require.NoError(t, err)
+			require.Equal(t, tc.wantOK, ok)
+			if !ok {
+				return
+			}
+			require.Equal(t, tc.wantMode, decision.Mode)
+			require.Equal(t, tc.wantReason, decision.Reason)
+			require.Equal(t, tc.wantPrev, gjson.GetBytes(decision.Payload, "previous_response_id").Exists())
+			require.Equal(t, tc.wantInputs, gjson.GetBytes(decision.Payload, "input.#").Int())
+		})
+	}
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_StoreDisabledFullInputPolicy(t *testing.T) {
+	account := &Account{
+		ID:          121,
+		Name:        "openai-ingress-full-input",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{"api_key": "sk-test"},
+		Extra:       map[string]any{"responses_websockets_v2_enabled": true},
+	}
+	clientMessages := [][]byte{
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"store":false,"input":[{"type":"message","role":"user","content":"a"}]}`),
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"store":false,"previous_response_id":"resp_full_input_1","input":[` +
+			`{"type":"message","role":"user","content":"a"},` +
+			`{"type":"message","role":"user","content":"b"}]}`),
+	}
+
+	cases := []struct {
+		policy     string
+		wantMode   string
+		wantReason string
+		wantPrev   bool
+		wantInputs int
+	}{
+		{policy: "auto", wantMode: "incremental", wantReason: "auto", wantPrev: true, wantInputs: 2},
+		{policy: "incremental", wantMode: "incremental", wantReason: "policy", wantPrev: true, wantInputs: 1},
+		{policy: "full_create", wantMode: "full_create", wantReason: "policy", wantPrev: false, wantInputs: 2},
+	}
+	for _, tc := range cases {
+		t.Run(tc.policy, func(t *testing.T) {
+			cfg := newOpenAIWSIngressCaptureTestConfig()
+			cfg.Gateway.OpenAIWS.IngressStoreDisabledFullInputPolicy = tc.policy
+			upstream := &openAIWSCaptureConn{
+				events: [][]byte{
+					[]byte(`{"type":"response.completed","response":{"id":"resp_full_input_1","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+					[]byte(`{"type":"response.completed","response":{"id":"resp_full_input_2","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+				},
+			}
+			pool := newOpenAIWSConnPool(cfg)
+			pool.setClientDialerForTest(&openAIWSQueueDialer{conns: []openAIWSClientConn{upstream}})
+			svc := &OpenAIGatewayService{
+				cfg:              cfg,
+				httpUpstream:     &httpUpstreamRecorder{},
+				cache:            &stubGatewayCache{},
+				openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+				toolCorrector:    NewCodexToolCorrector(),
+				openaiWSPool:     pool,
+			}
+			var mu sync.Mutex
+			results := make(map[int]*OpenAIForwardResult)
+			hooks := &OpenAIWSIngressHooks{
+				AfterTurn: func(turn int, result *OpenAIForwardResult, _ error) {
+					mu.Lock()
+					defer mu.Unlock()
+					results[turn] = result
+				},
+			}
+			received := runOpenAIWSIngressSessionWithServiceForTest(t, svc, account, "sk-test", clientMessages, hooks)
+			require.NotEmpty(t, received)
+
+			upstream.mu.Lock()
+			writes := append([]map[string]any(nil), upstream.writes...)
+			upstream.mu.Unlock()
+			require.Len(t, writes, 2)
+			_, hasPrev := writes[1]["previous_response_id"]
+			require.Equal(t, tc.wantPrev, hasPrev)
+			require.Len(t, writes[1]["input"], tc.wantInputs)
+
+			mu.Lock()
+			defer mu.Unlock()
+			require.NotNil(t, results[1])
+			require.Empty(t, results[1].StoreDisabledFullInputMode, "首轮没有 previous_response_id，不应标记")
+			require.NotNil(t, results[2])
+			require.Equal(t, tc.wantMode, results[2].StoreDisabledFullInputMode)
+			require.Equal(t, tc.wantReason, results[2].StoreDisabledFullInputReason)
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	coderws "github.com/coder/websocket"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIGatewayService_OpenAIWSTimeoutOverrideClamping(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Gateway.OpenAIWS.DialTimeoutSeconds = 10
+	cfg.Gateway.OpenAIWS.ReadTimeoutSeconds = 900
+	cfg.Gateway.OpenAIWS.RequestTimeoutOverrideMinSeconds = 5
+	cfg.Gateway.OpenAIWS.RequestTimeoutOverrideMaxSeconds = 60
+	svc := &OpenAIGatewayService{cfg: cfg}
+
+	base := context.Background()
+	require.Equal(t, 10*time.Second, svc.openAIWSDialTimeoutForRequest(base), "无覆盖时使用配置默认值")
+	require.Equal(t, 900*time.Second, svc.openAIWSReadTimeoutForRequest(base))
+	require.Equal(t, 12*time.Second, svc.openAIWSAcquireTimeout(base))
+
+	tooSmall := WithUpstreamTimeoutOverride(base, time.Second, time.Second)
+	require.Equal(t, 5*time.Second, svc.openAIWSDialTimeoutForRequest(tooSmall))
+	require.Equal(t, 5*time.Second, svc.openAIWSReadTimeoutForRequest(tooSmall))
+
+	tooLarge := WithUpstreamTimeoutOverride(base, time.Hour, time.Hour)
+	require.Equal(t, 60*time.Second, svc.openAIWSDialTimeoutForRequest(tooLarge))
+	require.Equal(t, 60*time.Second, svc.openAIWSReadTimeoutForRequest(tooLarge))
+	require.Equal(t, 62*time.Second, svc.openAIWSAcquireTimeout(tooLarge))
+
+	readOnly := WithUpstreamTimeoutOverride(base, 0, 30*time.Second)
+	require.Equal(t, 10*time.Second, svc.openAIWSDialTimeoutForRequest(readOnly), "未覆盖的项保持配置默认值")
+	require.Equal(t, 30*time.Second, svc.openAIWSReadTimeoutForRequest(readOnly))
+
+	// 未配置上下限时使用内置区间 [1s, 30m]。
+	defaults := &OpenAIGatewayService{}
+	require.Equal(t, time.Second, defaults.openAIWSReadTimeoutForRequest(WithUpstreamTimeoutOverride(base, 0, time.Millisecond)))
+	require.Equal(t, 30*time.Minute, defaults.openAIWSReadTimeoutForRequest(WithUpstreamTimeoutOverride(base, 0, 2*time.Hour)))
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_ReadTimeoutOverridePropagates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := newOpenAIWSIngressCaptureTestConfig()
+	cfg.Gateway.OpenAIWS.ReadTimeoutSeconds = 30
+	cfg.Gateway.OpenAIWS.RequestTimeoutOverrideMinSeconds = 1
+	cfg.Gateway.OpenAIWS.RequestTimeoutOverrideMaxSeconds = 60
+
+	upstream := &openAIWSCaptureConn{
+		readDelays: []time.Duration{5 * time.Second},
+		events: [][]byte{
+			[]byte(`{"type":"response.completed","response":{"id":"resp_timeout_override","model":"gpt-5.1","usage":{"input_tokens":1,"output_tokens":1}}}`),
+		},
+	}
+	pool := newOpenAIWSConnPool(cfg)
+	pool.setClientDialerForTest(&openAIWSQueueDialer{conns: []openAIWSClientConn{upstream}})
+	svc := &OpenAIGatewayService{
+		cfg:              cfg,
+		httpUpstream:     &httpUpstreamRecorder{},
+		cache:            &stubGatewayCache{},
+		openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+		toolCorrector:    NewCodexToolCorrector(),
+		openaiWSPool:     pool,
+	}
+	account := &Account{
+		ID:          135,
+		Name:        "openai-ingress-timeout-override",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAPIKey,
+		Status:      StatusActive,
+		Schedulable: true,
+		Concurrency: 1,
+		Credentials: map[string]any{"api_key": "sk-test"},
+		Extra:       map[string]any{"responses_websockets_v2_enabled": true},
+	}
+
+	serverErrCh := make(chan error, 1)
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := coderws.Accept(w, r, &coderws.AcceptOptions{CompressionMode: coderws.CompressionContextTakeover})
+		if err != nil {
+			serverErrCh <- err
+			return
+		}
+		defer func() {
+			_ = conn.CloseNow()
+		}()
+
+		rec := httptest.NewRecorder()
+		ginCtx, _ := gin.CreateTestContext(rec)
+		ginCtx.Request = r.Clone(r.Context())
+
+		readCtx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		_, firstMessage, readErr := conn.Read(readCtx)
+		cancel()
+		if readErr != nil {
+			serverErrCh <- readErr
+			return
+		}
+		// 请求级覆盖：0.2s 被钳制到下限 1s，远小于配置的 30s 读超时。
+		ctx := WithUpstreamTimeoutOverride(r.Context(), 0, 200*time.Millisecond)
+		serverErrCh <- svc.ProxyResponsesWebSocketFromClient(ctx, ginCtx, conn, account, "sk-test", firstMessage, nil)
+	}))
+	defer wsServer.Close()
+
+	dialCtx, cancelDial := context.WithTimeout(context.Background(), 3*time.Second)
+	clientConn, _, err := coderws.Dial(dialCtx, "ws"+strings.TrimPrefix(wsServer.URL, "http"), nil)
+	cancelDial()
+	require.NoError(t, err)
+	defer func() {
+		_ = clientConn.CloseNow()
+	}()
+
+	startedAt := time.Now()
+	writeCtx, cancelWrite := context.WithTimeout(context.Background(), 3*time.Second)
+	require.NoError(t, clientConn.Write(writeCtx, coderws.MessageText, []byte(`{"type":"response.create","model":"gpt-5.1","stream":false}`)))
+	cancelWrite()
+
+	select {
+	case serverErr := <-serverErrCh:
+		require.Error(t, serverErr)
+		require.Contains(t, serverErr.Error(), "read upstream websocket event")
+		elapsed := time.Since(startedAt)
+		require.GreaterOrEqual(t, elapsed, 900*time.Millisecond, "覆盖值应被钳制到配置下限")
+		require.Less(t, elapsed, 4*time.Second, "应使用请求级读超时而不是配置默认值")
+	case <-time.After(10 * time.Second):
+		t.Fatal("等待 ingress websocket 结束超时")
+	}
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// 上游 response.completed 缺失 usage 时的计费策略。
+const (
+	openAIWSUsageMissingPolicyUnbilled = "unbilled"
+	openAIWSUsageMissingPolicyZero     = "zero"
+	openAIWSUsageMissingPolicyEstimate = "estimate"
+)
+
+// openAIWSCompletedEventMissingUsage 判断 response.completed 事件是否完全缺失 response.usage。
+// usage 存在但各项为 0 不视为缺失。
+func openAIWSCompletedEventMissingUsage(message []byte) bool {
+	if len(message) == 0 {
+		return false
+	}
+	return !gjson.GetBytes(message, "response.usage").Exists()
+}
+
+func (s *OpenAIGatewayService) openAIWSUsageMissingPolicy() string {
+	if s != nil && s.cfg != nil {
+		switch policy := strings.TrimSpace(s.cfg.Gateway.OpenAIWS.UsageMissingPolicy); policy {
+		case openAIWSUsageMissingPolicyZero, openAIWSUsageMissingPolicyEstimate:
+			return policy
+		}
+	}
+	return openAIWSUsageMissingPolicyUnbilled
+}
+
+// applyOpenAIWSUsageMissingPolicy 在终止事件缺失 usage 时按配置策略补全结果并计数。
+// requestPayload 为发往上游的请求体，completedMessage 为 response.completed 原始帧，仅 estimate 策略使用。
+func (s *OpenAIGatewayService) applyOpenAIWSUsageMissingPolicy(result *OpenAIForwardResult, requestPayload, completedMessage []byte) {
+	if s == nil || result == nil {
+		return
+	}
+	s.openaiWSRelayMetrics.usageMissingTurn.Add(1)
+	result.UsageMissing = true
+	policy := s.openAIWSUsageMissingPolicy()
+	switch policy {
+	case openAIWSUsageMissingPolicyEstimate:
+		result.Usage = OpenAIUsage{
+			InputTokens:  estimateOpenAIWSRequestTokens(requestPayload),
+			OutputTokens: estimateOpenAIWSCompletedOutputTokens(completedMessage),
+		}
+		result.UsageEstimated = true
+	case openAIWSUsageMissingPolicyUnbilled:
+		result.UsageUnbilled = true
+	}
+	logOpenAIWSModeInfo(
+		"usage_missing response_id=%s policy=%s input_tokens=%d output_tokens=%d",
+		truncateOpenAIWSLogValue(result.RequestID, openAIWSIDValueMaxLen),
+		policy,
+		result.Usage.InputTokens,
+		result.Usage.OutputTokens,
+	)
+}
+
+// estimateOpenAIWSRequestTokens 按 instructions 与 input 中的文本粗略估算输入 token。
+func estimateOpenAIWSRequestTokens(requestPayload []byte) int {
+	if len(requestPayload) == 0 {
+		return 0
+	}
+	var b strings.Builder
+	values := gjson.GetManyBytes(requestPayload, "instructions", "input")
+	collectOpenAIWSEstimateText(values[0], &b)
+	collectOpenAIWSEstimateText(values[1], &b)
+	return estimateTokensForText(b.String())
+}
+
+// estimateOpenAIWSCompletedOutputTokens 按 response.output 中的文本与工具调用参数粗略估算输出 token。
+func estimateOpenAIWSCompletedOutputTokens(completedMessage []byte) int {
+	if len(completedMessage) == 0 {
+		return 0
+	}
+	var b strings.Builder
+	collectOpenAIWSEstimateText(gjson.GetBytes(completedMessage, "response.output"), &b)
+	return estimateTokensForText(b.String())
+}
+
+// collectOpenAIWSEstimateText 收集节点中参与估算的文本：裸字符串本身，以及对象中 text/arguments/output 字段的字符串值。
+func collectOpenAIWSEstimateText(node gjson.Result, b *strings.Builder) {
+	switch {
+	case node.Type == gjson.String:
+		appendOpenAIWSEstimateText(b, node.String())
+	case node.IsArray():
+		for _, item := range node.Array() {
+			collectOpenAIWSEstimateText(item, b)
+		}
+	case node.IsObject():
+		node.ForEach(func(key, value gjson.Result) bool {
+			switch key.String() {
+			case "text", "arguments", "output":
+				if value.Type == gjson.String {
+					appendOpenAIWSEstimateText(b, value.String())
+					return true
+				}
+			}
+			if value.IsArray() || value.IsObject() {
+				collectOpenAIWSEstimateText(value, b)
+			}
+			return true
+		})
+	}
+}
+
+func appendOpenAIWSEstimateText(b *strings.Builder, text string) {
+	if text == "" {
+		return
+	}
+	if b.Len() > 0 {
+		b.WriteByte('\n')
+	}
+	b.WriteString(text)
+}
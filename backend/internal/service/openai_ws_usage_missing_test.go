@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIWSCompletedEventMissingUsage(t *testing.T) {
+	require.True(t, openAIWSCompletedEventMissingUsage([]byte(`{"type":"response.completed","response":{"id":"resp_1"}}`)))
+	require.False(t, openAIWSCompletedEventMissingUsage([]byte(`{"type":"response.completed","response":{"id":"resp_1","usage":{"input_tokens":0,"output_tokens":0}}}`)))
+	require.False(t, openAIWSCompletedEventMissingUsage(nil))
+}
+
+func TestEstimateOpenAIWSUsageTokens(t *testing.T) {
+	require.Zero(t, estimateOpenAIWSRequestTokens(nil))
+	require.Zero(t, estimateOpenAIWSCompletedOutputTokens(nil))
+
+	request := []byte(`{"type":"response.create","instructions":"be brief","input":[{"type":"message","role":"user","content":[{"type":"input_text","text":"hello there, how are you today?"}]},{"type":"function_call_output","call_id":"call_1","output":"42"}]}`)
+	require.Equal(t, estimateTokensForText("be brief\nhello there, how are you today?\n42"), estimateOpenAIWSRequestTokens(request))
+	require.Equal(t, estimateTokensForText("plain string input"), estimateOpenAIWSRequestTokens([]byte(`{"input":"plain string input"}`)))
+
+	completed := []byte(`{"type":"response.completed","response":{"id":"resp_1","output":[{"type":"message","content":[{"type":"output_text","text":"I am fine, thanks."}]},{"type":"function_call","name":"lookup","arguments":"{\"q\":\"weather\"}"}]}}`)
+	require.Equal(t, estimateTokensForText("I am fine, thanks.\n{\"q\":\"weather\"}"), estimateOpenAIWSCompletedOutputTokens(completed))
+}
+
+func TestApplyOpenAIWSUsageMissingPolicy(t *testing.T) {
+	request := []byte(`{"input":"hello there, how are you today?"}`)
+	completed := []byte(`{"type":"response.completed","response":{"id":"resp_1","output":[{"type":"message","content":[{"type":"output_text","text":"I am fine."}]}]}}`)
+
+	for _, tc := range []struct {
+		policy       string
+		wantUnbilled bool
+		wantEstimate bool
+	}{
+		{policy: "", wantUnbilled: true},
+		{policy: "unbilled", wantUnbilled: true},
+		{policy: "zero"},
+		{policy: "estimate", wantEstimate: true},
+	} {
+		t.Run("policy="+tc.policy, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Gateway.OpenAIWS.UsageMissingPolicy = tc.policy
+			svc := &OpenAIGatewayService{cfg: cfg}
+			result := &OpenAIForwardResult{RequestID: "resp_1"}
+
+			svc.applyOpenAIWSUsageMissingPolicy(result, request, completed)
+
+			require.True(t, result.UsageMissing)
+			require.Equal(t, tc.wantUnbilled, result.UsageUnbilled)
+			require.Equal(t, tc.wantEstimate, result.UsageEstimated)
+			if tc.wantEstimate {
+				require.Equal(t, estimateTokensForText("hello there, how are you today?"), result.Usage.InputTokens)
+				require.Equal(t, estimateTokensForText("I am fine."), result.Usage.OutputTokens)
+				require.Positive(t, result.Usage.InputTokens)
+			} else {
+				require.Equal(t, OpenAIUsage{}, result.Usage)
+			}
+			require.Equal(t, int64(1), svc.SnapshotOpenAIWSRelayMetrics().UsageMissingTurnTotal)
+		})
+	}
+}
+
+func TestOpenAIGatewayService_RecordUsageSkipsUnbilledTurn(t *testing.T) {
+	svc := &OpenAIGatewayService{}
+	err := svc.RecordUsage(context.Background(), &OpenAIRecordUsageInput{
+		Result: &OpenAIForwardResult{
+			RequestID:     "resp_unbilled",
+			Usage:         OpenAIUsage{InputTokens: 10},
+			UsageMissing:  true,
+			UsageUnbilled: true,
+		},
+	})
+	require.NoError(t, err)
+}
+
+func TestOpenAIGatewayService_ProxyResponsesWebSocketFromClient_UsageMissingPolicy(t *testing.T) {
+	clientMessages := [][]byte{
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"input":[{"type":"input_text","text":"hello there, how are you today?"}]}`),
+		[]byte(`{"type":"response.create","model":"gpt-5.1","stream":false,"previous_response_id":"resp_usage_missing","input":[{"type":"input_text","text":"again"}]}`),
+	}
+
+	for _, policy := range []string{"unbilled", "zero", "estimate"} {
+		t.Run(policy, func(t *testing.T) {
+			cfg := newOpenAIWSIngressCaptureTestConfig()
+			cfg.Gateway.OpenAIWS.UsageMissingPolicy = policy
+
+			upstream := &openAIWSCaptureConn{
+				events: [][]byte{
+					[]byte(`{"type":"response.completed","response":{"id":"resp_usage_missing","model":"gpt-5.1","output":[{"type":"message","content":[{"type":"output_text","text":"I am fine, thanks."}]}]}}`),
+					[]byte(`{"type":"response.completed","response":{"id":"resp_usage_present","model":"gpt-5.1","usage":{"input_tokens":3,"output_tokens":2}}}`),
+				},
+			}
+			pool := newOpenAIWSConnPool(cfg)
+			pool.setClientDialerForTest(&openAIWSQueueDialer{conns: []openAIWSClientConn{upstream}})
+			svc := &OpenAIGatewayService{
+				cfg:              cfg,
+				httpUpstream:     &httpUpstreamRecorder{},
+				cache:            &stubGatewayCache{},
+				openaiWSResolver: NewOpenAIWSProtocolResolver(cfg),
+				toolCorrector:    NewCodexToolCorrector(),
+				openaiWSPool:     pool,
+			}
+			account := &Account{
+				ID:          141,
+				Name:        "openai-ingress-usage-missing",
+				Platform:    PlatformOpenAI,
+				Type:        AccountTypeAPIKey,
+				Status:      StatusActive,
+				Schedulable: true,
+				Concurrency: 1,
+				Credentials: map[string]any{"api_key": "sk-usage-missing"},
+				Extra:       map[string]any{"responses_websockets_v2_enabled": true},
+			}
+
+			var resultsMu sync.Mutex
+			var results []*OpenAIForwardResult
+			hooks := &OpenAIWSIngressHooks{
+				AfterTurn: func(_ int, result *OpenAIForwardResult, _ error) {
+					if result != nil {
+						resultsMu.Lock()
+						results = append(results, result)
+						resultsMu.Unlock()
+					}
+				},
+			}
+
+			runOpenAIWSIngressSessionWithServiceForTest(t, svc, account, "sk-usage-missing", clientMessages, hooks)
+
+			resultsMu.Lock()
+			defer resultsMu.Unlock()
+			require.Len(t, results, 2)
+			missing, present := results[0], results[1]
+			require.True(t, missing.UsageMissing)
+			require.Equal(t, policy == "unbilled", missing.UsageUnbilled)
+			require.Equal(t, policy == "estimate", missing.UsageEstimated)
+			if policy == "estimate" {
+				require.Positive(t, missing.Usage.InputTokens)
+				require.Equal(t, estimateTokensForText("I am fine, thanks."), missing.Usage.OutputTokens)
+			} else {
+				require.Equal(t, OpenAIUsage{}, missing.Usage)
+			}
+
+			require.False(t, present.UsageMissing, "上游携带 usage 的 turn 不应受策略影响")
+			require.False(t, present.UsageUnbilled)
+			require.False(t, present.UsageEstimated)
+			require.Equal(t, 3, present.Usage.InputTokens)
+			require.Equal(t, int64(1), svc.SnapshotOpenAIWSRelayMetrics().UsageMissingTurnTotal)
+		})
+	}
+}
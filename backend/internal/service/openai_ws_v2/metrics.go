@@ -8,22 +8,35 @@ import (
 type MetricsSnapshot struct {
 	SemanticMutationTotal  int64 `json:"semantic_mutation_total"`
 	UsageParseFailureTotal int64 `json:"usage_parse_failure_total"`
+	// ActiveRelayGoroutines 当前存活的 relay 协程数（双向转发 + 空闲看门狗），会话结束后应回落到 0。
+	ActiveRelayGoroutines int64 `json:"active_relay_goroutines"`
 }
 
 var (
 	// passthrough 路径默认不会做语义改写，该计数通常应保持为 0（保留用于未来防御性校验）。
 	passthroughSemanticMutationTotal  atomic.Int64
 	passthroughUsageParseFailureTotal atomic.Int64
+	passthroughActiveRelayGoroutines  atomic.Int64
 )
 
 func recordUsageParseFailure() {
 	passthroughUsageParseFailureTotal.Add(1)
 }
 
+// goRelay 启动 relay 协程并计入 ActiveRelayGoroutines，协程退出时自动回减。
+func goRelay(fn func()) {
+	passthroughActiveRelayGoroutines.Add(1)
+	go func() {
+		defer passthroughActiveRelayGoroutines.Add(-1)
+		fn()
+	}()
+}
+
 // SnapshotMetrics 返回当前 passthrough 指标快照。
 func SnapshotMetrics() MetricsSnapshot {
 	return MetricsSnapshot{
 		SemanticMutationTotal:  passthroughSemanticMutationTotal.Load(),
 		UsageParseFailureTotal: passthroughUsageParseFailureTotal.Load(),
+		ActiveRelayGoroutines:  passthroughActiveRelayGoroutines.Load(),
 	}
 }
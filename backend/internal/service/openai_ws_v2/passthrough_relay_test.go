@@ -750,3 +750,65 @@ func (c *errorOnWriteFrameConn) WriteFrame(_ context.Context, _ coderws.MessageT
 func (c *errorOnWriteFrameConn) Close() error {
 	return nil
 }
+
+// 不使用 t.Parallel：ActiveRelayGoroutines 为进程级计数，需在无其它 relay 并发时断言回落到 0。
+func TestRelay_GoroutinesReturnToBaselineAfterSessions(t *testing.T) {
+	firstPayload := []byte(`{"type":"response.create","model":"gpt-4o","input":[]}`)
+	completed := []byte(`{"type":"response.completed","response":{"id":"resp_leak","usage":{"input_tokens":1,"output_tokens":1}}}`)
+
+	// 会话进行中计数应可观测。
+	blockedCtx, blockedCancel := context.WithCancel(context.Background())
+	blockedDone := make(chan struct{})
+	go func() {
+		defer close(blockedDone)
+		_, _ = Relay(blockedCtx, newPassthroughTestFrameConn(nil, false), newPassthroughTestFrameConn(nil, false), firstPayload, RelayOptions{})
+	}()
+	require.Eventually(t, func() bool {
+		return SnapshotMetrics().ActiveRelayGoroutines >= 2
+	}, time.Second, 5*time.Millisecond)
+	blockedCancel()
+	<-blockedDone
+
+	const sessions = 40
+	var wg sync.WaitGroup
+	for i := 0; i < sessions; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			var clientConn, upstreamConn FrameConn
+			options := RelayOptions{UpstreamDrainTimeout: 50 * time.Millisecond}
+			switch i % 4 {
+			case 0:
+				// 上游正常结束，客户端仍保持打开。
+				clientConn = newPassthroughTestFrameConn(nil, false)
+				upstreamConn = newPassthroughTestFrameConn([]passthroughTestFrame{{msgType: coderws.MessageText, payload: completed}}, true)
+			case 1:
+				// 客户端断开，上游静默直到 drain 超时。
+				clientConn = newPassthroughTestFrameConn(nil, true)
+				upstreamConn = newPassthroughTestFrameConn(nil, false)
+			case 2:
+				// 客户端断开，drain 窗口内读到延迟的终止事件。
+				clientConn = newPassthroughTestFrameConn(nil, true)
+				upstreamConn = &delayedReadFrameConn{
+					base:       newPassthroughTestFrameConn([]passthroughTestFrame{{msgType: coderws.MessageText, payload: completed}}, false),
+					firstDelay: 10 * time.Millisecond,
+				}
+			default:
+				// 请求上下文中途取消，两端均无数据。
+				shortCtx, shortCancel := context.WithTimeout(ctx, 30*time.Millisecond)
+				defer shortCancel()
+				ctx = shortCtx
+				clientConn = newPassthroughTestFrameConn(nil, false)
+				upstreamConn = newPassthroughTestFrameConn(nil, false)
+			}
+			_, _ = Relay(ctx, clientConn, upstreamConn, firstPayload, options)
+		}(i)
+	}
+	wg.Wait()
+
+	require.Eventually(t, func() bool {
+		return SnapshotMetrics().ActiveRelayGoroutines == 0
+	}, 2*time.Second, 10*time.Millisecond, "relay 协程应在会话结束后全部退出")
+}
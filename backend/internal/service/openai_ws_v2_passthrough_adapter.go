@@ -124,7 +124,7 @@ func (s *OpenAIGatewayService) proxyResponsesWebSocketV2Passthrough(
 		return errors.New("openai ws passthrough dialer is nil")
 	}
 
-	dialCtx, cancelDial := context.WithTimeout(ctx, s.openAIWSDialTimeout())
+	dialCtx, cancelDial := context.WithTimeout(ctx, s.openAIWSDialTimeoutForRequest(ctx))
 	defer cancelDial()
 	upstreamConn, statusCode, handshakeHeaders, err := dialer.Dial(dialCtx, wsURL, headers, proxyURL)
 	if err != nil {
@@ -178,13 +178,14 @@ func (s *OpenAIGatewayService) proxyResponsesWebSocketV2Passthrough(
 						CacheCreationInputTokens: turn.Usage.CacheCreationInputTokens,
 						CacheReadInputTokens:     turn.Usage.CacheReadInputTokens,
 					},
-					Model:           turn.RequestModel,
-					ServiceTier:     requestServiceTier,
-					Stream:          true,
-					OpenAIWSMode:    true,
-					ResponseHeaders: cloneHeader(handshakeHeaders),
-					Duration:        turn.Duration,
-					FirstTokenMs:    turn.FirstTokenMs,
+					Model:            turn.RequestModel,
+					ServiceTier:      requestServiceTier,
+					Stream:           true,
+					OpenAIWSMode:     true,
+					OpenAIWSConnMode: OpenAIWSIngressModePassthrough,
+					ResponseHeaders:  cloneHeader(handshakeHeaders),
+					Duration:         turn.Duration,
+					FirstTokenMs:     turn.FirstTokenMs,
 				}
 				logOpenAIWSV2Passthrough(
 					"relay_turn_completed account_id=%d turn=%d request_id=%s terminal_event=%s duration_ms=%d first_token_ms=%d input_tokens=%d output_tokens=%d cache_read_tokens=%d",
@@ -226,13 +227,14 @@ func (s *OpenAIGatewayService) proxyResponsesWebSocketV2Passthrough(
 			CacheCreationInputTokens: relayResult.Usage.CacheCreationInputTokens,
 			CacheReadInputTokens:     relayResult.Usage.CacheReadInputTokens,
 		},
-		Model:           relayResult.RequestModel,
-		ServiceTier:     requestServiceTier,
-		Stream:          true,
-		OpenAIWSMode:    true,
-		ResponseHeaders: cloneHeader(handshakeHeaders),
-		Duration:        relayResult.Duration,
-		FirstTokenMs:    relayResult.FirstTokenMs,
+		Model:            relayResult.RequestModel,
+		ServiceTier:      requestServiceTier,
+		Stream:           true,
+		OpenAIWSMode:     true,
+		OpenAIWSConnMode: OpenAIWSIngressModePassthrough,
+		ResponseHeaders:  cloneHeader(handshakeHeaders),
+		Duration:         relayResult.Duration,
+		FirstTokenMs:     relayResult.FirstTokenMs,
 	}
 
 	turnCount := int(completedTurns.Load())
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"sync/atomic"
+	"time"
 
 	"github.com/Wei-Shaw/sub2api/internal/pkg/ctxkey"
 )
@@ -18,6 +19,10 @@ type RequestMetadata struct {
 	PrefetchedStickyGroupID    *int64
 	SingleAccountRetry         *bool
 	AccountSwitchCount         *int
+	APIKeyID                   *int64
+	ClientRegion               *string
+	UpstreamDialTimeout        *time.Duration
+	UpstreamReadTimeout        *time.Duration
 }
 
 var (
@@ -116,6 +121,42 @@ func WithAccountSwitchCount(ctx context.Context, value int, bridgeOldKeys bool)
 	})
 }
 
+// WithAPIKeyID 记录当前请求所属的 API Key，供调度层做 API Key 维度的短窗口粘连。
+// 该字段为新增元数据，无旧 ctxkey.* 需要桥接。
+func WithAPIKeyID(ctx context.Context, apiKeyID int64) context.Context {
+	return updateRequestMetadata(ctx, false, func(md *RequestMetadata) {
+		v := apiKeyID
+		md.APIKeyID = &v
+	}, nil)
+}
+
+// WithClientRegion 记录客户端地域，供调度层做地域亲和；空值不写入。
+// 该字段为新增元数据，无旧 ctxkey.* 需要桥接。
+func WithClientRegion(ctx context.Context, region string) context.Context {
+	if region == "" {
+		return ctx
+	}
+	return updateRequestMetadata(ctx, false, func(md *RequestMetadata) {
+		v := region
+		md.ClientRegion = &v
+	}, nil)
+}
+
+// WithUpstreamTimeoutOverride 为当前请求覆盖上游建连/单事件读超时；非正值表示该项不覆盖。
+// 实际生效值由网关按 request_timeout_override_{min,max}_seconds 钳制。
+func WithUpstreamTimeoutOverride(ctx context.Context, dialTimeout, readTimeout time.Duration) context.Context {
+	return updateRequestMetadata(ctx, false, func(md *RequestMetadata) {
+		if dialTimeout > 0 {
+			v := dialTimeout
+			md.UpstreamDialTimeout = &v
+		}
+		if readTimeout > 0 {
+			v := readTimeout
+			md.UpstreamReadTimeout = &v
+		}
+	}, nil)
+}
+
 func IsMaxTokensOneHaikuRequestFromContext(ctx context.Context) (bool, bool) {
 	if md := metadataFromContext(ctx); md != nil && md.IsMaxTokensOneHaikuRequest != nil {
 		return *md.IsMaxTokensOneHaikuRequest, true
@@ -214,3 +255,33 @@ func AccountSwitchCountFromContext(ctx context.Context) (int, bool) {
 	}
 	return 0, false
 }
+
+func APIKeyIDFromContext(ctx context.Context) (int64, bool) {
+	if md := metadataFromContext(ctx); md != nil && md.APIKeyID != nil {
+		return *md.APIKeyID, true
+	}
+	return 0, false
+}
+
+// ClientRegionFromContext 返回请求的客户端地域；未设置时返回空串。
+func ClientRegionFromContext(ctx context.Context) string {
+	if md := metadataFromContext(ctx); md != nil && md.ClientRegion != nil {
+		return *md.ClientRegion
+	}
+	return ""
+}
+
+// UpstreamTimeoutOverrideFromContext 返回请求级上游超时覆盖；未设置的项返回 0。
+func UpstreamTimeoutOverrideFromContext(ctx context.Context) (dialTimeout, readTimeout time.Duration, ok bool) {
+	md := metadataFromContext(ctx)
+	if md == nil {
+		return 0, 0, false
+	}
+	if md.UpstreamDialTimeout != nil {
+		dialTimeout = *md.UpstreamDialTimeout
+	}
+	if md.UpstreamReadTimeout != nil {
+		readTimeout = *md.UpstreamReadTimeout
+	}
+	return dialTimeout, readTimeout, dialTimeout > 0 || readTimeout > 0
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/Wei-Shaw/sub2api/internal/pkg/ctxkey"
 	"github.com/stretchr/testify/require"
@@ -117,3 +118,24 @@ func TestRequestMetadataRead_PreferMetadataOverLegacy(t *testing.T) {
 	require.True(t, thinking)
 	require.Equal(t, false, ctx.Value(ctxkey.ThinkingEnabled))
 }
+
+func TestRequestMetadata_UpstreamTimeoutOverride(t *testing.T) {
+	_, _, ok := UpstreamTimeoutOverrideFromContext(context.Background())
+	require.False(t, ok)
+
+	ctx := WithAccountSwitchCount(context.Background(), 1, false)
+	ctx = WithUpstreamTimeoutOverride(ctx, 0, 0)
+	_, _, ok = UpstreamTimeoutOverrideFromContext(ctx)
+	require.False(t, ok, "非正值不应视为覆盖")
+
+	ctx = WithUpstreamTimeoutOverride(ctx, 3*time.Second, 0)
+	ctx = WithUpstreamTimeoutOverride(ctx, 0, 45*time.Second)
+	dial, read, ok := UpstreamTimeoutOverrideFromContext(ctx)
+	require.True(t, ok)
+	require.Equal(t, 3*time.Second, dial, "后续只覆盖 read 时应保留已设置的 dial")
+	require.Equal(t, 45*time.Second, read)
+
+	switchCount, ok := AccountSwitchCountFromContext(ctx)
+	require.True(t, ok)
+	require.Equal(t, 1, switchCount)
+}
@@ -32,6 +32,9 @@ type SchedulerSnapshotService struct {
 	fallbackLimit *fallbackLimiter
 	lagMu         sync.Mutex
 	lagFailures   int
+
+	accountRemovedMu    sync.RWMutex
+	accountRemovedHooks []func(accountID int64)
 }
 
 func NewSchedulerSnapshotService(
@@ -56,6 +59,29 @@ func NewSchedulerSnapshotService(
 	}
 }
 
+// OnAccountRemoved 注册账号被删除或停用（非 active / 不可调度）时的回调，
+// 由 outbox 事件处理触发，用于下线该账号持有的上游长连接等资源。
+func (s *SchedulerSnapshotService) OnAccountRemoved(hook func(accountID int64)) {
+	if s == nil || hook == nil {
+		return
+	}
+	s.accountRemovedMu.Lock()
+	s.accountRemovedHooks = append(s.accountRemovedHooks, hook)
+	s.accountRemovedMu.Unlock()
+}
+
+func (s *SchedulerSnapshotService) notifyAccountRemoved(accountID int64) {
+	if accountID <= 0 {
+		return
+	}
+	s.accountRemovedMu.RLock()
+	hooks := s.accountRemovedHooks
+	s.accountRemovedMu.RUnlock()
+	for _, hook := range hooks {
+		hook(accountID)
+	}
+}
+
 func (s *SchedulerSnapshotService) Start() {
 	if s == nil || s.cache == nil {
 		return
@@ -349,6 +375,9 @@ func (s *SchedulerSnapshotService) handleBulkAccountEvent(ctx context.Context, p
 			continue
 		}
 		found[account.ID] = struct{}{}
+		if !account.IsActive() || !account.Schedulable {
+			s.notifyAccountRemoved(account.ID)
+		}
 		if s.cache != nil {
 			if err := s.cache.SetAccount(ctx, account); err != nil {
 				return err
@@ -361,11 +390,12 @@ func (s *SchedulerSnapshotService) handleBulkAccountEvent(ctx context.Context, p
 		}
 	}
 
-	if s.cache != nil {
-		for _, id := range ids {
-			if _, ok := found[id]; ok {
-				continue
-			}
+	for _, id := range ids {
+		if _, ok := found[id]; ok {
+			continue
+		}
+		s.notifyAccountRemoved(id)
+		if s.cache != nil {
 			if err := s.cache.DeleteAccount(ctx, id); err != nil {
 				return err
 			}
@@ -395,6 +425,7 @@ func (s *SchedulerSnapshotService) handleAccountEvent(ctx context.Context, accou
 	account, err := s.accountRepo.GetByID(ctx, *accountID)
 	if err != nil {
 		if errors.Is(err, ErrAccountNotFound) {
+			s.notifyAccountRemoved(*accountID)
 			if s.cache != nil {
 				if err := s.cache.DeleteAccount(ctx, *accountID); err != nil {
 					return err
@@ -404,6 +435,9 @@ func (s *SchedulerSnapshotService) handleAccountEvent(ctx context.Context, accou
 		}
 		return err
 	}
+	if !account.IsActive() || !account.Schedulable {
+		s.notifyAccountRemoved(account.ID)
+	}
 	if s.cache != nil {
 		if err := s.cache.SetAccount(ctx, account); err != nil {
 			return err
@@ -10,6 +10,13 @@ export interface BackupS3Config {
   force_path_style: boolean
 }
 
+export type BackupStorageMode = 'remote' | 'local' | 'local_remote'
+
+export interface BackupStorageConfig {
+  mode: BackupStorageMode
+  local_dir: string
+}
+
 export interface BackupScheduleConfig {
   enabled: boolean
   cron_expr: string
@@ -19,7 +26,7 @@ export interface BackupScheduleConfig {
 
 export interface BackupRecord {
   id: string
-  status: 'pending' | 'running' | 'completed' | 'failed'
+  status: 'pending' | 'running' | 'completed' | 'partial' | 'failed'
   backup_type: string
   file_name: string
   s3_key: string
@@ -29,6 +36,29 @@ export interface BackupRecord {
   started_at: string
   finished_at?: string
   expires_at?: string
+  storage_mode?: BackupStorageMode
+  local_path?: string
+  upload_status?: 'uploaded' | 'pending' | 'failed'
+  upload_attempts?: number
+  upload_error?: string
+  checksum_sha256?: string
+  timings?: BackupPhaseTimings
+  upload_state?: BackupUploadState
+}
+
+export interface BackupUploadState {
+  upload_id: string
+  part_size: number
+  parts: { part_number: number; etag: string; size: number }[]
+}
+
+export interface BackupPhaseTimings {
+  read_ms: number
+  compress_ms: number
+  checksum_ms: number
+  write_ms: number
+  upload_ms: number
+  total_ms: number
 }
 
 export interface CreateBackupRequest {
@@ -56,6 +86,17 @@ export async function testS3Connection(config: BackupS3Config): Promise<TestS3Re
   return data
 }
 
+// Storage
+export async function getStorageConfig(): Promise<BackupStorageConfig> {
+  const { data } = await apiClient.get<BackupStorageConfig>('/admin/backups/storage-config')
+  return data
+}
+
+export async function updateStorageConfig(config: BackupStorageConfig): Promise<BackupStorageConfig> {
+  const { data } = await apiClient.put<BackupStorageConfig>('/admin/backups/storage-config', config)
+  return data
+}
+
 // Schedule
 export async function getSchedule(): Promise<BackupScheduleConfig> {
   const { data } = await apiClient.get<BackupScheduleConfig>('/admin/backups/schedule')
@@ -101,6 +142,8 @@ export const backupAPI = {
   getS3Config,
   updateS3Config,
   testS3Connection,
+  getStorageConfig,
+  updateStorageConfig,
   getSchedule,
   updateSchedule,
   createBackup,